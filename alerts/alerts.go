@@ -0,0 +1,621 @@
+// Package alerts watches chassis metrics and notifies people when they cross
+// thresholds.
+//
+// A rule compares a metric (a named func returning a number) against a
+// threshold every evaluation interval. When a rule is breached the module
+// publishes an alert.triggered event and notifies the rule's channels
+// (email, SMS, webhook). An alert is notified once when it fires and then at
+// most once per cooldown while it stays breached; when the metric recovers
+// the module publishes alert.resolved and notifies the same channels.
+//
+// # Metrics
+//
+// These metrics are registered automatically when their module is present:
+//
+//	queue.backlog       pending jobs (queue)
+//	queue.failed        failed jobs (queue)
+//	queue.dead          quarantined poison jobs (queue)
+//	auth.failed_logins  failed logins in the last rate window (auth, events)
+//	email.bounces       hard bounces in the last rate window (email, events)
+//	storage.bytes       bytes stored, when quotas track usage (storage)
+//	chassis.panics      panics recovered at module boundaries (always)
+//
+// Register others with WithMetric or RegisterMetric, or count events with
+// WithEventRate:
+//
+//	alerts.New(
+//	    alerts.WithMetric("users.signups", signupsFunc),
+//	    alerts.WithEventRate("webhooks.failed", "job.failed", time.Hour),
+//	)
+//
+// # Usage
+//
+// Register the module after the modules it watches:
+//
+//	app := chassis.New(
+//	    chassis.WithModules(
+//	        events.New(),
+//	        email.New(),
+//	        queue.New(),
+//	        alerts.New(
+//	            alerts.WithChannel("ops", alerts.EmailChannel("ops@example.com")),
+//	            alerts.WithRule(alerts.Rule{
+//	                Name:      "queue-backlog",
+//	                Metric:    alerts.MetricQueueBacklog,
+//	                Operator:  alerts.Above,
+//	                Threshold: 1000,
+//	                Cooldown:  15 * time.Minute,
+//	                Channels:  []string{"ops"},
+//	            }),
+//	        ),
+//	    ),
+//	)
+//
+// # Configuration
+//
+// Channels and rules can also come from config.yaml:
+//
+//	alerts:
+//	  interval: 30s
+//	  rate_window: 5m
+//	  channels:
+//	    ops:
+//	      type: email
+//	      to: ops@example.com, oncall@example.com
+//	    pager:
+//	      type: webhook
+//	      url: https://example.com/alerts
+//	      secret: ${ALERTS_WEBHOOK_SECRET}
+//	  rules:
+//	    failed-logins:
+//	      metric: auth.failed_logins
+//	      above: 50
+//	      cooldown: 30m
+//	      channels: ops, pager
+//
+// SMS channels need a sender from WithSMSSender. Alert state is kept in
+// memory, so an alert still breached after a restart fires again.
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrRuleNotFound   = chassis.NewError(chassis.CodeNotFound, "alert rule not found")
+	ErrMetricNotFound = chassis.NewError(chassis.CodeNotFound, "alert metric not found")
+	ErrInvalidRule    = chassis.NewError(chassis.CodeInvalidArgument, "alert rule needs a name, a metric and an operator")
+)
+
+// Events published when the events module is registered.
+// The payload is an *Alert.
+const (
+	EventAlertTriggered = "alert.triggered"
+	EventAlertResolved  = "alert.resolved"
+)
+
+// Operator is how a rule compares a metric with its threshold.
+type Operator string
+
+const (
+	Above Operator = "above"
+	Below Operator = "below"
+)
+
+// Rule is a threshold over a metric.
+type Rule struct {
+	Name      string
+	Metric    string
+	Operator  Operator
+	Threshold float64
+
+	// Cooldown is the minimum time between notifications for the rule,
+	// including an alert that fires again shortly after resolving. Zero
+	// uses the module default.
+	Cooldown time.Duration
+
+	// Channels are the names of the channels to notify.
+	Channels []string
+}
+
+func (rule Rule) valid() bool {
+	return rule.Name != "" && rule.Metric != "" && (rule.Operator == Above || rule.Operator == Below)
+}
+
+func (rule Rule) breached(value float64) bool {
+	if rule.Operator == Below {
+		return value < rule.Threshold
+	}
+	return value > rule.Threshold
+}
+
+// AlertStatus represents the state of an alert.
+type AlertStatus string
+
+const (
+	StatusFiring   AlertStatus = "firing"
+	StatusResolved AlertStatus = "resolved"
+)
+
+// Alert is one breach of a rule, from when it fires until it resolves.
+type Alert struct {
+	ID          string
+	Rule        string
+	Metric      string
+	Operator    Operator
+	Threshold   float64
+	Value       float64
+	Status      AlertStatus
+	TriggeredAt time.Time
+	NotifiedAt  time.Time
+	ResolvedAt  *time.Time
+}
+
+// Summary returns a one-line description of the alert, used as the subject
+// of notifications.
+func (alert *Alert) Summary() string {
+	if alert.Status == StatusResolved {
+		return fmt.Sprintf("[resolved] %s: %s is %g", alert.Rule, alert.Metric, alert.Value)
+	}
+	return fmt.Sprintf("[firing] %s: %s is %g (%s %g)", alert.Rule, alert.Metric, alert.Value, alert.Operator, alert.Threshold)
+}
+
+// Metric returns the current value of something the module watches.
+type Metric func(ctx context.Context) (float64, error)
+
+// Defaults for the evaluation loop.
+const (
+	DefaultInterval   = 30 * time.Second
+	DefaultCooldown   = 15 * time.Minute
+	DefaultRateWindow = 5 * time.Minute
+)
+
+// Module is the alerts module implementation.
+type Module struct {
+	app        *chassis.App
+	interval   time.Duration
+	cooldown   time.Duration
+	rateWindow time.Duration
+	now        func() time.Time
+	smsSender  SMSSender
+
+	mu       sync.Mutex
+	metrics  map[string]Metric
+	rates    []*eventRate
+	channels map[string]Channel
+	rules    map[string]Rule
+	active   map[string]*Alert
+
+	// lastNotified is kept across resolves so a flapping metric is not
+	// notified more than once per cooldown
+	lastNotified map[string]time.Time
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// Option is a function that configures the alerts module.
+type Option func(*Module)
+
+// WithRule adds a rule.
+func WithRule(rule Rule) Option {
+	return func(mod *Module) {
+		mod.rules[rule.Name] = rule
+	}
+}
+
+// WithMetric registers a metric under name.
+func WithMetric(name string, metric Metric) Option {
+	return func(mod *Module) {
+		mod.metrics[name] = metric
+	}
+}
+
+// WithEventRate registers a metric counting events of eventType published
+// in the last window.
+func WithEventRate(name, eventType string, window time.Duration) Option {
+	return func(mod *Module) {
+		mod.rates = append(mod.rates, mod.newEventRate(name, eventType, window))
+	}
+}
+
+// WithChannel registers a notification channel under name.
+func WithChannel(name string, channel Channel) Option {
+	return func(mod *Module) {
+		mod.channels[name] = channel
+	}
+}
+
+// WithSMSSender sets the sender used by SMS channels from config.
+func WithSMSSender(sender SMSSender) Option {
+	return func(mod *Module) {
+		mod.smsSender = sender
+	}
+}
+
+// WithInterval sets how often rules are evaluated. Zero disables the
+// background loop; call Evaluate to check rules.
+func WithInterval(interval time.Duration) Option {
+	return func(mod *Module) {
+		mod.interval = interval
+	}
+}
+
+// WithCooldown sets the cooldown for rules that don't set their own.
+func WithCooldown(cooldown time.Duration) Option {
+	return func(mod *Module) {
+		mod.cooldown = cooldown
+	}
+}
+
+// WithRateWindow sets the window of the built-in event rate metrics.
+func WithRateWindow(window time.Duration) Option {
+	return func(mod *Module) {
+		mod.rateWindow = window
+	}
+}
+
+// WithClock sets the time source. Intended for tests.
+func WithClock(now func() time.Time) Option {
+	return func(mod *Module) {
+		mod.now = now
+	}
+}
+
+// New creates a new alerts module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		interval:     DefaultInterval,
+		cooldown:     DefaultCooldown,
+		rateWindow:   DefaultRateWindow,
+		now:          time.Now,
+		metrics:      make(map[string]Metric),
+		channels:     make(map[string]Channel),
+		rules:        make(map[string]Rule),
+		active:       make(map[string]*Alert),
+		lastNotified: make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "alerts"
+}
+
+// SecretKeys marks webhook channel URLs as secret, as chat webhooks carry
+// their token in the URL.
+func (mod *Module) SecretKeys() []string {
+	return []string{"alerts.channels.*.url"}
+}
+
+// Init reads channels and rules from config, registers the built-in
+// metrics and starts the evaluation loop.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	if cfg := app.ConfigData(); cfg != nil {
+		for key, duration := range map[string]*time.Duration{
+			"alerts.interval":    &mod.interval,
+			"alerts.cooldown":    &mod.cooldown,
+			"alerts.rate_window": &mod.rateWindow,
+		} {
+			if cfg.Get(key) != nil {
+				value, err := cfg.MustGetDuration(key)
+				if err != nil {
+					return err
+				}
+				*duration = value
+			}
+		}
+		if err := mod.loadConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range mod.rules {
+		if !rule.valid() {
+			return fmt.Errorf("alerts rule %q: %w", rule.Name, ErrInvalidRule)
+		}
+	}
+
+	mod.registerBuiltins(app)
+
+	mod.mu.Lock()
+	for _, channel := range mod.channels {
+		if bindable, ok := channel.(appBinder); ok {
+			bindable.bind(app)
+		}
+	}
+	rates := mod.rates
+	mod.mu.Unlock()
+
+	if eventsMod, ok := app.TryEvents(); ok {
+		for _, rate := range rates {
+			rate.subscribe(eventsMod, mod.now)
+		}
+	}
+
+	if mod.interval > 0 {
+		mod.stop = make(chan struct{})
+		mod.stopped.Add(1)
+		go mod.loop()
+	}
+
+	app.Logger().Info("alerts module initialized", "rules", len(mod.rules), "channels", len(mod.channels))
+	return nil
+}
+
+// Shutdown stops the evaluation loop and event subscriptions.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	if mod.stop != nil {
+		close(mod.stop)
+		mod.stopped.Wait()
+		mod.stop = nil
+	}
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	for _, rate := range mod.rates {
+		rate.stop()
+	}
+	return nil
+}
+
+// AddRule adds or replaces a rule.
+func (mod *Module) AddRule(rule Rule) error {
+	if !rule.valid() {
+		return ErrInvalidRule
+	}
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	mod.rules[rule.Name] = rule
+	return nil
+}
+
+// RemoveRule removes a rule and forgets its active alert without resolving it.
+func (mod *Module) RemoveRule(name string) error {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	if _, ok := mod.rules[name]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(mod.rules, name)
+	delete(mod.active, name)
+	delete(mod.lastNotified, name)
+	return nil
+}
+
+// Rules returns all rules sorted by name.
+func (mod *Module) Rules() []Rule {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	rules := make([]Rule, 0, len(mod.rules))
+	for _, rule := range mod.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// RegisterMetric registers a metric under name, replacing any existing one.
+func (mod *Module) RegisterMetric(name string, metric Metric) {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	mod.metrics[name] = metric
+}
+
+// RegisterChannel registers a notification channel under name.
+func (mod *Module) RegisterChannel(name string, channel Channel) {
+	if bindable, ok := channel.(appBinder); ok && mod.app != nil {
+		bindable.bind(mod.app)
+	}
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	mod.channels[name] = channel
+}
+
+// Active returns the alerts that are currently firing, oldest first.
+func (mod *Module) Active() []*Alert {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	alerts := make([]*Alert, 0, len(mod.active))
+	for _, alert := range mod.active {
+		copied := *alert
+		alerts = append(alerts, &copied)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].TriggeredAt.Before(alerts[j].TriggeredAt) })
+	return alerts
+}
+
+// Evaluate checks every rule once, firing, re-notifying and resolving
+// alerts as needed. It returns the errors of metrics that could not be read;
+// rules over other metrics are still evaluated.
+func (mod *Module) Evaluate(ctx context.Context) error {
+	var errs []error
+	for _, rule := range mod.Rules() {
+		if err := mod.evaluateRule(ctx, rule); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notification is an alert to send to a rule's channels, collected under
+// the lock and sent outside it.
+type notification struct {
+	alert    *Alert
+	channels []string
+	event    string
+}
+
+func (mod *Module) evaluateRule(ctx context.Context, rule Rule) error {
+	mod.mu.Lock()
+	metric, ok := mod.metrics[rule.Metric]
+	mod.mu.Unlock()
+	if !ok {
+		return ErrMetricNotFound
+	}
+
+	value, err := metric(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := mod.now()
+	cooldown := rule.Cooldown
+	if cooldown <= 0 {
+		cooldown = mod.cooldown
+	}
+
+	var pending *notification
+	mod.mu.Lock()
+	alert, firing := mod.active[rule.Name]
+	lastNotified, notifiedBefore := mod.lastNotified[rule.Name]
+	coolingDown := notifiedBefore && now.Sub(lastNotified) < cooldown
+
+	switch {
+	case rule.breached(value) && !firing:
+		alert = &Alert{
+			ID:          uuid.New().String(),
+			Rule:        rule.Name,
+			Metric:      rule.Metric,
+			Operator:    rule.Operator,
+			Threshold:   rule.Threshold,
+			Value:       value,
+			Status:      StatusFiring,
+			TriggeredAt: now,
+		}
+		mod.active[rule.Name] = alert
+		if !coolingDown {
+			alert.NotifiedAt = now
+			mod.lastNotified[rule.Name] = now
+			pending = &notification{alert: alert, channels: rule.Channels, event: EventAlertTriggered}
+		}
+
+	case rule.breached(value):
+		alert.Value = value
+		if !coolingDown {
+			alert.NotifiedAt = now
+			mod.lastNotified[rule.Name] = now
+			pending = &notification{alert: alert, channels: rule.Channels, event: EventAlertTriggered}
+		}
+
+	case firing:
+		alert.Value = value
+		alert.Status = StatusResolved
+		alert.ResolvedAt = &now
+		delete(mod.active, rule.Name)
+		// Only tell channels about a recovery they heard the alert for
+		if !alert.NotifiedAt.IsZero() {
+			pending = &notification{alert: alert, channels: rule.Channels, event: EventAlertResolved}
+		}
+	}
+
+	var copied Alert
+	if pending != nil {
+		copied = *pending.alert
+		pending.alert = &copied
+	}
+	mod.mu.Unlock()
+
+	if pending != nil {
+		mod.notify(ctx, pending)
+	}
+	return nil
+}
+
+// notify publishes the alert event and sends it to each channel. Channel
+// failures are logged; they don't stop other channels.
+func (mod *Module) notify(ctx context.Context, pending *notification) {
+	mod.app.PublishEvent(ctx, pending.event, pending.alert)
+
+	for _, name := range pending.channels {
+		mod.mu.Lock()
+		channel, ok := mod.channels[name]
+		mod.mu.Unlock()
+		if !ok {
+			mod.app.Logger().Warn("alert channel not found", "rule", pending.alert.Rule, "channel", name)
+			continue
+		}
+		if err := channel.Notify(ctx, pending.alert); err != nil {
+			mod.app.Logger().Error("alert notification failed", "rule", pending.alert.Rule, "channel", name, "error", err)
+		}
+	}
+}
+
+func (mod *Module) loop() {
+	defer mod.stopped.Done()
+	ticker := time.NewTicker(mod.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mod.stop:
+			return
+		case <-ticker.C:
+			if err := mod.Evaluate(context.Background()); err != nil {
+				mod.app.Logger().Warn("alert evaluation failed", "error", err)
+			}
+		}
+	}
+}
+
+// loadConfig reads the alerts.channels and alerts.rules sections.
+func (mod *Module) loadConfig(cfg chassis.ConfigData) error {
+	for name := range cfg.Section("alerts.channels") {
+		section := cfg.Section("alerts.channels." + name)
+		channel, err := mod.channelFromConfig(section)
+		if err != nil {
+			return fmt.Errorf("alerts channel %s: %w", name, err)
+		}
+		mod.channels[name] = channel
+	}
+
+	for name := range cfg.Section("alerts.rules") {
+		section := cfg.Section("alerts.rules." + name)
+		rule := Rule{
+			Name:     name,
+			Metric:   section.GetString("metric"),
+			Channels: section.GetStringSlice("channels"),
+		}
+		if above, ok := number(section.Get("above")); ok {
+			rule.Operator, rule.Threshold = Above, above
+		} else if below, ok := number(section.Get("below")); ok {
+			rule.Operator, rule.Threshold = Below, below
+		}
+		if section.Get("cooldown") != nil {
+			cooldown, err := section.MustGetDuration("cooldown")
+			if err != nil {
+				return fmt.Errorf("alerts rule %s: %w", name, err)
+			}
+			rule.Cooldown = cooldown
+		}
+		mod.rules[name] = rule
+	}
+	return nil
+}
+
+func number(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
@@ -0,0 +1,305 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/webhooks/verify"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	alerts []*Alert
+}
+
+func (rec *recorder) Notify(ctx context.Context, alert *Alert) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.alerts = append(rec.alerts, alert)
+	return nil
+}
+
+func (rec *recorder) statuses() []AlertStatus {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var statuses []AlertStatus
+	for _, alert := range rec.alerts {
+		statuses = append(statuses, alert.Status)
+	}
+	return statuses
+}
+
+func setupAlerts(t *testing.T, opts ...Option) (*Module, *chassis.App, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	mod := New(append([]Option{WithInterval(0), WithClock(clock.Now)}, opts...)...)
+	app := chassis.New(chassis.WithModules(events.New(), mod))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return mod, app, clock
+}
+
+func TestEvaluate_FireCooldownResolve(t *testing.T) {
+	var value float64
+	channel := &recorder{}
+	mod, app, clock := setupAlerts(t,
+		WithMetric("backlog", func(ctx context.Context) (float64, error) { return value, nil }),
+		WithChannel("ops", channel),
+		WithRule(Rule{Name: "backlog-high", Metric: "backlog", Operator: Above, Threshold: 100, Cooldown: 10 * time.Minute, Channels: []string{"ops"}}),
+	)
+	ctx := context.Background()
+
+	var published []string
+	app.Events().Subscribe(EventAlertTriggered, func(ctx context.Context, eventType string, payload any) {
+		published = append(published, eventType)
+	})
+	app.Events().Subscribe(EventAlertResolved, func(ctx context.Context, eventType string, payload any) {
+		published = append(published, eventType)
+	})
+
+	value = 50
+	_ = mod.Evaluate(ctx)
+	if len(channel.statuses()) != 0 || len(mod.Active()) != 0 {
+		t.Fatal("no alert expected below the threshold")
+	}
+
+	value = 150
+	_ = mod.Evaluate(ctx)
+	if got := channel.statuses(); len(got) != 1 || got[0] != StatusFiring {
+		t.Fatalf("expected one firing notification, got %v", got)
+	}
+	active := mod.Active()
+	if len(active) != 1 || active[0].Value != 150 {
+		t.Fatalf("expected one active alert, got %+v", active)
+	}
+
+	// Still breached within the cooldown: no repeat
+	clock.Advance(5 * time.Minute)
+	value = 200
+	_ = mod.Evaluate(ctx)
+	if got := channel.statuses(); len(got) != 1 {
+		t.Errorf("expected notification to be deduplicated, got %v", got)
+	}
+
+	// Still breached after the cooldown: reminder for the same alert
+	clock.Advance(6 * time.Minute)
+	_ = mod.Evaluate(ctx)
+	if got := channel.statuses(); len(got) != 2 || channel.alerts[1].ID != channel.alerts[0].ID {
+		t.Errorf("expected a reminder for the same alert, got %v", got)
+	}
+
+	value = 10
+	_ = mod.Evaluate(ctx)
+	if got := channel.statuses(); len(got) != 3 || got[2] != StatusResolved {
+		t.Errorf("expected a resolved notification, got %v", got)
+	}
+	if len(mod.Active()) != 0 {
+		t.Error("resolved alert should not be active")
+	}
+
+	want := []string{EventAlertTriggered, EventAlertTriggered, EventAlertResolved}
+	if strings.Join(published, ",") != strings.Join(want, ",") {
+		t.Errorf("published %v, want %v", published, want)
+	}
+}
+
+func TestEvaluate_FlappingIsSuppressed(t *testing.T) {
+	var value float64
+	channel := &recorder{}
+	mod, _, clock := setupAlerts(t,
+		WithMetric("rate", func(ctx context.Context) (float64, error) { return value, nil }),
+		WithChannel("ops", channel),
+		WithRule(Rule{Name: "rate-low", Metric: "rate", Operator: Below, Threshold: 1, Cooldown: time.Hour, Channels: []string{"ops"}}),
+	)
+	ctx := context.Background()
+
+	value = 0
+	_ = mod.Evaluate(ctx) // fires
+	value = 5
+	_ = mod.Evaluate(ctx) // resolves
+	clock.Advance(time.Minute)
+	value = 0
+	_ = mod.Evaluate(ctx) // fires again within the cooldown: silent
+	if len(mod.Active()) != 1 {
+		t.Error("the alert should be active even while its notification is suppressed")
+	}
+	value = 5
+	_ = mod.Evaluate(ctx) // resolves silently
+
+	if got := channel.statuses(); len(got) != 2 {
+		t.Errorf("expected only the first fire and resolve to notify, got %v", got)
+	}
+}
+
+func TestEvaluate_MetricErrors(t *testing.T) {
+	channel := &recorder{}
+	failure := errors.New("metric unavailable")
+	mod, _, _ := setupAlerts(t,
+		WithMetric("broken", func(ctx context.Context) (float64, error) { return 0, failure }),
+		WithMetric("ok", func(ctx context.Context) (float64, error) { return 10, nil }),
+		WithChannel("ops", channel),
+		WithRule(Rule{Name: "a-broken", Metric: "broken", Operator: Above, Threshold: 1}),
+		WithRule(Rule{Name: "b-missing", Metric: "missing", Operator: Above, Threshold: 1}),
+		WithRule(Rule{Name: "c-ok", Metric: "ok", Operator: Above, Threshold: 1, Channels: []string{"ops"}}),
+	)
+
+	err := mod.Evaluate(context.Background())
+	if !errors.Is(err, failure) || !errors.Is(err, ErrMetricNotFound) {
+		t.Errorf("expected metric errors to be reported, got %v", err)
+	}
+	if len(channel.statuses()) != 1 {
+		t.Error("rules over healthy metrics should still be evaluated")
+	}
+}
+
+func TestAddRule(t *testing.T) {
+	mod, _, _ := setupAlerts(t)
+	if err := mod.AddRule(Rule{Name: "x", Metric: "m"}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("expected ErrInvalidRule, got %v", err)
+	}
+	if err := mod.AddRule(Rule{Name: "x", Metric: "m", Operator: Above}); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if rules := mod.Rules(); len(rules) != 1 || rules[0].Name != "x" {
+		t.Errorf("Rules = %+v", rules)
+	}
+	if err := mod.RemoveRule("x"); err != nil {
+		t.Errorf("RemoveRule failed: %v", err)
+	}
+	if err := mod.RemoveRule("x"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("expected ErrRuleNotFound, got %v", err)
+	}
+}
+
+func TestEventRate(t *testing.T) {
+	channel := &recorder{}
+	mod, app, clock := setupAlerts(t,
+		WithEventRate("failures", "job.failed", time.Minute),
+		WithChannel("ops", channel),
+		WithRule(Rule{Name: "failures", Metric: "failures", Operator: Above, Threshold: 2, Channels: []string{"ops"}}),
+	)
+	ctx := context.Background()
+
+	for range 3 {
+		app.Events().Publish(ctx, "job.failed", nil)
+	}
+	_ = mod.Evaluate(ctx)
+	if got := channel.statuses(); len(got) != 1 || channel.alerts[0].Value != 3 {
+		t.Fatalf("expected the rate to fire at 3 events, got %v", got)
+	}
+
+	// Events age out of the window
+	clock.Advance(2 * time.Minute)
+	_ = mod.Evaluate(ctx)
+	if got := channel.statuses(); len(got) != 2 || got[1] != StatusResolved {
+		t.Errorf("expected the rate to resolve, got %v", got)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ = io.ReadAll(request.Body)
+		received <- request
+	}))
+	defer server.Close()
+
+	var sentTo, sentSubject string
+	configPath := writeConfig(t, `
+alerts:
+  channels:
+    ops:
+      type: email
+      to: ops@example.com
+    pager:
+      type: webhook
+      url: `+server.URL+`
+      secret: s3cret
+  rules:
+    backlog:
+      metric: backlog
+      above: 10
+      channels: [ops, pager]
+`)
+	mod := New(
+		WithInterval(0),
+		WithMetric("backlog", func(ctx context.Context) (float64, error) { return 11, nil }),
+	)
+	app := chassis.New(
+		chassis.WithConfigFile(configPath),
+		chassis.WithModules(
+			email.New(email.WithProvider(email.NewLogProvider(func(to, subject, body string) {
+				sentTo, sentSubject = to, subject
+			}))),
+			mod,
+		),
+	)
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	if err := mod.Evaluate(context.Background()); err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if sentTo != "ops@example.com" || !strings.Contains(sentSubject, "backlog") {
+		t.Errorf("email channel sent %q to %q", sentSubject, sentTo)
+	}
+
+	request := <-received
+	if err := verify.New([]byte("s3cret")).Verify(context.Background(), request.Header.Get(verify.DefaultHeader), body); err != nil {
+		t.Errorf("webhook signature should verify: %v", err)
+	}
+	if !strings.Contains(string(body), `"Rule":"backlog"`) {
+		t.Errorf("unexpected webhook body %s", body)
+	}
+}
+
+func TestConfig_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown channel": "alerts:\n  channels:\n    x:\n      type: pigeon\n",
+		"sms sender":      "alerts:\n  channels:\n    x:\n      type: sms\n      to: \"+15550100\"\n",
+		"rule operator":   "alerts:\n  rules:\n    x:\n      metric: m\n",
+	}
+	for name, configYAML := range tests {
+		app := chassis.New(chassis.WithConfigFile(writeConfig(t, configYAML)))
+		if err := New(WithInterval(0)).Init(context.Background(), app); err == nil {
+			t.Errorf("%s: expected Init to fail", name)
+		}
+	}
+}
+
+func writeConfig(t *testing.T, configYAML string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,178 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/webhooks/verify"
+)
+
+var (
+	ErrEmailNotRegistered = chassis.NewError(chassis.CodeFailedPrecondition, "alert email channel needs the email module")
+	ErrSMSSenderRequired  = chassis.NewError(chassis.CodeFailedPrecondition, "alert SMS channel needs an SMS sender")
+	ErrUnknownChannelType = chassis.NewError(chassis.CodeInvalidArgument, "alert channel type must be email, sms or webhook")
+)
+
+// Channel delivers alert notifications.
+type Channel interface {
+	Notify(ctx context.Context, alert *Alert) error
+}
+
+// ChannelFunc adapts a function to the Channel interface.
+type ChannelFunc func(ctx context.Context, alert *Alert) error
+
+// Notify calls fn(ctx, alert).
+func (fn ChannelFunc) Notify(ctx context.Context, alert *Alert) error {
+	return fn(ctx, alert)
+}
+
+// appBinder is implemented by channels that use other modules. The module
+// binds them to the app during Init.
+type appBinder interface {
+	bind(app *chassis.App)
+}
+
+// EmailChannel sends alerts to the given addresses through the email module.
+func EmailChannel(to ...string) Channel {
+	return &emailChannel{to: to}
+}
+
+type emailChannel struct {
+	to  []string
+	app *chassis.App
+}
+
+func (channel *emailChannel) bind(app *chassis.App) {
+	channel.app = app
+}
+
+func (channel *emailChannel) Notify(ctx context.Context, alert *Alert) error {
+	emailMod, ok := channel.app.TryEmail()
+	if !ok {
+		return ErrEmailNotRegistered
+	}
+	var errs []error
+	for _, to := range channel.to {
+		if err := emailMod.Send(ctx, to, alert.Summary(), alertBody(alert)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SMSSender sends text messages. Implement it over your SMS provider
+// (Twilio, SNS, ...) to use SMS channels.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// SMSChannel sends the alert summary to the given phone numbers.
+func SMSChannel(sender SMSSender, to ...string) Channel {
+	return &smsChannel{sender: sender, to: to}
+}
+
+type smsChannel struct {
+	sender SMSSender
+	to     []string
+}
+
+func (channel *smsChannel) Notify(ctx context.Context, alert *Alert) error {
+	if channel.sender == nil {
+		return ErrSMSSenderRequired
+	}
+	var errs []error
+	for _, to := range channel.to {
+		if err := channel.sender.SendSMS(ctx, to, alert.Summary()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookChannel POSTs the alert as JSON to url. When secret is set, requests
+// carry an X-Chassis-Signature header that receivers check with the
+// webhooks/verify package.
+func WebhookChannel(url, secret string) Channel {
+	return &webhookChannel{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type webhookChannel struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (channel *webhookChannel) Notify(ctx context.Context, alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build alert request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if channel.secret != "" {
+		request.Header.Set(verify.DefaultHeader, verify.SignatureHeader([]byte(channel.secret), time.Now(), body))
+	}
+
+	response, err := channel.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("alert webhook responded with %s", response.Status)
+	}
+	return nil
+}
+
+// alertBody is the plain text body of alert emails.
+func alertBody(alert *Alert) string {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Rule:      %s\n", alert.Rule)
+	fmt.Fprintf(&body, "Status:    %s\n", alert.Status)
+	fmt.Fprintf(&body, "Metric:    %s = %g\n", alert.Metric, alert.Value)
+	fmt.Fprintf(&body, "Threshold: %s %g\n", alert.Operator, alert.Threshold)
+	fmt.Fprintf(&body, "Triggered: %s\n", alert.TriggeredAt.UTC().Format(time.RFC3339))
+	if alert.ResolvedAt != nil {
+		fmt.Fprintf(&body, "Resolved:  %s\n", alert.ResolvedAt.UTC().Format(time.RFC3339))
+	}
+	return body.String()
+}
+
+// channelFromConfig builds a channel from an alerts.channels.<name> section.
+func (mod *Module) channelFromConfig(section chassis.ConfigData) (Channel, error) {
+	switch section.GetString("type") {
+	case "email":
+		return EmailChannel(section.GetStringSlice("to")...), nil
+	case "sms":
+		if mod.smsSender == nil {
+			return nil, ErrSMSSenderRequired
+		}
+		return SMSChannel(mod.smsSender, section.GetStringSlice("to")...), nil
+	case "webhook":
+		url := section.GetString("url")
+		if url == "" {
+			return nil, errors.New("webhook channel needs a url")
+		}
+		return WebhookChannel(url, section.GetString("secret")), nil
+	default:
+		return nil, ErrUnknownChannelType
+	}
+}
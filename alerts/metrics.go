@@ -0,0 +1,139 @@
+package alerts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/queue"
+)
+
+// Built-in metric names.
+const (
+	MetricQueueBacklog = "queue.backlog"
+	MetricQueueFailed  = "queue.failed"
+	MetricQueueDead    = "queue.dead"
+	MetricFailedLogins = "auth.failed_logins"
+	MetricEmailBounces = "email.bounces"
+	MetricStorageBytes = "storage.bytes"
+	MetricPanics       = "chassis.panics"
+)
+
+// registerBuiltins registers the metrics of the modules that are present.
+// Metrics registered by options take precedence.
+func (mod *Module) registerBuiltins(app *chassis.App) {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+
+	mod.setDefaultMetric(MetricPanics, func(ctx context.Context) (float64, error) {
+		var total uint64
+		for _, count := range app.Panics() {
+			total += count
+		}
+		return float64(total), nil
+	})
+	if queueAPI, ok := app.TryQueue(); ok {
+		if queueMod, ok := queueAPI.(*queue.Module); ok {
+			mod.setDefaultMetric(MetricQueueBacklog, jobCount(queueMod, queue.StatusPending))
+			mod.setDefaultMetric(MetricQueueFailed, jobCount(queueMod, queue.StatusFailed))
+			mod.setDefaultMetric(MetricQueueDead, jobCount(queueMod, queue.StatusDead))
+		}
+	}
+	if storageMod, ok := app.TryStorage(); ok {
+		mod.setDefaultMetric(MetricStorageBytes, func(ctx context.Context) (float64, error) {
+			used, err := storageMod.Usage(ctx, "")
+			return float64(used), err
+		})
+	}
+	if app.HasModule("auth") {
+		mod.setDefaultRate(MetricFailedLogins, auth.EventLoginFailed)
+	}
+	if app.HasModule("email") {
+		mod.setDefaultRate(MetricEmailBounces, email.EventEmailBounced)
+	}
+}
+
+func (mod *Module) setDefaultMetric(name string, metric Metric) {
+	if _, ok := mod.metrics[name]; !ok {
+		mod.metrics[name] = metric
+	}
+}
+
+func (mod *Module) setDefaultRate(name, eventType string) {
+	if _, ok := mod.metrics[name]; !ok {
+		mod.rates = append(mod.rates, mod.newEventRate(name, eventType, mod.rateWindow))
+	}
+}
+
+func jobCount(queueMod *queue.Module, status queue.JobStatus) Metric {
+	return func(ctx context.Context) (float64, error) {
+		result, err := queueMod.List(ctx, status, pagination.Request{Limit: 1})
+		if err != nil {
+			return 0, err
+		}
+		return float64(result.Total), nil
+	}
+}
+
+// newEventRate creates a rate and registers it as a metric. The caller
+// holds mod.mu or is still configuring the module.
+func (mod *Module) newEventRate(name, eventType string, window time.Duration) *eventRate {
+	rate := &eventRate{eventType: eventType, window: window}
+	mod.metrics[name] = func(ctx context.Context) (float64, error) {
+		return float64(rate.count(mod.now())), nil
+	}
+	return rate
+}
+
+// eventRate counts events of one type over a sliding window.
+type eventRate struct {
+	eventType string
+	window    time.Duration
+
+	mu          sync.Mutex
+	times       []time.Time
+	unsubscribe func()
+}
+
+func (rate *eventRate) subscribe(bus chassis.EventsModule, now func() time.Time) {
+	unsubscribe := bus.Subscribe(rate.eventType, func(ctx context.Context, eventType string, payload any) {
+		rate.add(now())
+	})
+	rate.mu.Lock()
+	rate.unsubscribe = unsubscribe
+	rate.mu.Unlock()
+}
+
+func (rate *eventRate) stop() {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+	if rate.unsubscribe != nil {
+		rate.unsubscribe()
+		rate.unsubscribe = nil
+	}
+}
+
+func (rate *eventRate) add(at time.Time) {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+	rate.times = append(rate.times, at)
+}
+
+// count returns the number of events in the window ending at now, dropping
+// older ones.
+func (rate *eventRate) count(now time.Time) int {
+	rate.mu.Lock()
+	defer rate.mu.Unlock()
+
+	cutoff := now.Add(-rate.window)
+	keep := 0
+	for keep < len(rate.times) && !rate.times[keep].After(cutoff) {
+		keep++
+	}
+	rate.times = rate.times[keep:]
+	return len(rate.times)
+}
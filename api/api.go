@@ -0,0 +1,159 @@
+// Package api writes JSON responses and standardized error envelopes for
+// HTTP handlers built on chassis.
+//
+// Errors are rendered from the chassis error taxonomy, so module errors map
+// to stable codes and status codes without per-handler translation:
+//
+//	user, err := app.Users().GetByID(ctx, id)
+//	if err != nil {
+//	    api.WriteError(writer, request, err) // 404 {"code":"not_found",...}
+//	    return
+//	}
+//
+// Every error response has the same shape:
+//
+//	{
+//	    "code": "not_found",
+//	    "message": "user not found",
+//	    "details": {...},
+//	    "request_id": "..."
+//	}
+//
+// Uncategorized errors are reported as "internal" with a generic message;
+// the original error is logged rather than sent to the client.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/talosaether/chassis"
+)
+
+// RequestIDHeader is the header read for the request ID when none is set on the context.
+const RequestIDHeader = chassis.RequestIDHeader
+
+// ErrorResponse is the JSON body written for every API error.
+type ErrorResponse struct {
+	Code      chassis.ErrorCode `json:"code"`
+	Message   string            `json:"message"`
+	Details   any               `json:"details,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// WithRequestID returns a context carrying the request ID. It is
+// chassis.WithRequestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return chassis.WithRequestID(ctx, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored on the context, if any.
+// It is chassis.RequestIDFromContext.
+func RequestIDFromContext(ctx context.Context) string {
+	return chassis.RequestIDFromContext(ctx)
+}
+
+// RequestID returns the ID of the request, from its context or the X-Request-ID header.
+func RequestID(request *http.Request) string {
+	if requestID := RequestIDFromContext(request.Context()); requestID != "" {
+		return requestID
+	}
+	return request.Header.Get(RequestIDHeader)
+}
+
+// StatusForCode returns the HTTP status code for an error code.
+func StatusForCode(code chassis.ErrorCode) int {
+	switch code {
+	case chassis.CodeInvalidArgument:
+		return http.StatusBadRequest
+	case chassis.CodeNotFound:
+		return http.StatusNotFound
+	case chassis.CodeAlreadyExists:
+		return http.StatusConflict
+	case chassis.CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case chassis.CodePermissionDenied:
+		return http.StatusForbidden
+	case chassis.CodeFailedPrecondition:
+		return http.StatusPreconditionFailed
+	case chassis.CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case chassis.CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case chassis.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewErrorResponse builds the envelope and status code for err. The
+// message is the chassis Error's own, without the cause it wraps, which
+// may hold internal details.
+func NewErrorResponse(request *http.Request, err error) (int, ErrorResponse) {
+	code := chassis.ErrorCodeOf(err)
+	response := ErrorResponse{
+		Code:      code,
+		RequestID: RequestID(request),
+	}
+
+	var chassisErr *chassis.Error
+	switch {
+	case errors.As(err, &chassisErr):
+		response.Message = chassisErr.Message
+		response.Details = chassisErr.Details
+	case code == chassis.CodeUnavailable:
+		response.Message = "service unavailable"
+	default:
+		response.Message = "internal server error"
+	}
+
+	return StatusForCode(code), response
+}
+
+// WriteError writes err as a JSON error envelope.
+// Internal errors, and client errors wrapping a cause the envelope leaves
+// out, are logged with the request ID so they can be correlated.
+func WriteError(writer http.ResponseWriter, request *http.Request, err error) {
+	status, response := NewErrorResponse(request, err)
+	var chassisErr *chassis.Error
+	switch {
+	case status >= http.StatusInternalServerError:
+		logFailure(request, slog.LevelError, response.RequestID, err)
+	case errors.As(err, &chassisErr) && chassisErr.Err != nil:
+		logFailure(request, slog.LevelWarn, response.RequestID, err)
+	}
+	WriteJSON(writer, status, response)
+}
+
+func logFailure(request *http.Request, level slog.Level, requestID string, err error) {
+	slog.Default().Log(request.Context(), level, "request failed",
+		"method", request.Method,
+		"path", request.URL.Path,
+		"request_id", requestID,
+		"error", err,
+	)
+}
+
+// Error writes an error envelope with the given code and message.
+// Shorthand for WriteError with chassis.NewError.
+func Error(writer http.ResponseWriter, request *http.Request, code chassis.ErrorCode, message string) {
+	WriteError(writer, request, chassis.NewError(code, message))
+}
+
+// MethodNotAllowed writes a 405 error envelope.
+func MethodNotAllowed(writer http.ResponseWriter, request *http.Request) {
+	Error(writer, request, chassis.CodeMethodNotAllowed, "method not allowed")
+}
+
+// WriteJSON writes value as JSON with the given status code.
+func WriteJSON(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		slog.Default().Error("failed to encode JSON response", "error", err)
+	}
+}
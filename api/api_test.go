@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/users"
+)
+
+func decodeEnvelope(t *testing.T, recorder *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected application/json, got %q", contentType)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode envelope: %v", err)
+	}
+	return response
+}
+
+func TestWriteError_ModuleErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   chassis.ErrorCode
+	}{
+		{"user not found", users.ErrNotFound, http.StatusNotFound, chassis.CodeNotFound},
+		{"email exists", users.ErrEmailExists, http.StatusConflict, chassis.CodeAlreadyExists},
+		{"wrong password", users.ErrWrongPassword, http.StatusUnauthorized, chassis.CodeUnauthenticated},
+		{"invalid role", orgs.ErrInvalidRole, http.StatusBadRequest, chassis.CodeInvalidArgument},
+		{"wrapped", fmt.Errorf("lookup failed: %w", orgs.ErrNotFound), http.StatusNotFound, chassis.CodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			recorder := httptest.NewRecorder()
+			WriteError(recorder, request, tt.err)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			response := decodeEnvelope(t, recorder)
+			if response.Code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, response.Code)
+			}
+			if response.Message == "" {
+				t.Error("expected a message")
+			}
+		})
+	}
+}
+
+func TestWriteError_InternalHidesMessage(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	recorder := httptest.NewRecorder()
+	WriteError(recorder, request, errors.New("database password is hunter2"))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", recorder.Code)
+	}
+	response := decodeEnvelope(t, recorder)
+	if response.Code != chassis.CodeInternal {
+		t.Errorf("expected internal code, got %q", response.Code)
+	}
+	if response.Message != "internal server error" {
+		t.Errorf("internal error message leaked: %q", response.Message)
+	}
+}
+
+func TestWriteError_HidesCause(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	recorder := httptest.NewRecorder()
+	WriteError(recorder, request, chassis.WrapError(chassis.CodeInvalidArgument, "invalid tenant", errors.New("no row in tenants_secret")))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", recorder.Code)
+	}
+	if response := decodeEnvelope(t, recorder); response.Message != "invalid tenant" {
+		t.Errorf("expected only the error's own message, got %q", response.Message)
+	}
+}
+
+func TestWriteError_ContextCanceled(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	recorder := httptest.NewRecorder()
+	WriteError(recorder, request, fmt.Errorf("query: %w", context.Canceled))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", recorder.Code)
+	}
+}
+
+func TestWriteError_DetailsAndRequestID(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	request.Header.Set(RequestIDHeader, "req-header")
+	recorder := httptest.NewRecorder()
+
+	details := map[string]string{"field": "name"}
+	WriteError(recorder, request, chassis.ErrorWithDetails(chassis.CodeInvalidArgument, "name is required", details))
+
+	response := decodeEnvelope(t, recorder)
+	if response.RequestID != "req-header" {
+		t.Errorf("expected request ID from header, got %q", response.RequestID)
+	}
+	gotDetails, ok := response.Details.(map[string]any)
+	if !ok || gotDetails["field"] != "name" {
+		t.Errorf("expected details to round-trip, got %v", response.Details)
+	}
+}
+
+func TestRequestID_ContextTakesPrecedence(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "from-header")
+	request = request.WithContext(WithRequestID(request.Context(), "from-context"))
+
+	if got := RequestID(request); got != "from-context" {
+		t.Errorf("expected context request ID, got %q", got)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	request := httptest.NewRequest(http.MethodDelete, "/", nil)
+	recorder := httptest.NewRecorder()
+	MethodNotAllowed(recorder, request)
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", recorder.Code)
+	}
+	if response := decodeEnvelope(t, recorder); response.Code != chassis.CodeMethodNotAllowed {
+		t.Errorf("expected method_not_allowed, got %q", response.Code)
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	cause := errors.New("disk full")
+	err := chassis.WrapError(chassis.CodeUnavailable, "storage unavailable", cause)
+
+	if !errors.Is(err, cause) {
+		t.Error("wrapped error should unwrap to cause")
+	}
+	if chassis.ErrorCodeOf(err) != chassis.CodeUnavailable {
+		t.Errorf("expected unavailable, got %q", chassis.ErrorCodeOf(err))
+	}
+	if err.Error() != "storage unavailable: disk full" {
+		t.Errorf("unexpected message: %q", err.Error())
+	}
+}
+
+type endpointModule struct {
+	endpoints []chassis.Endpoint
+}
+
+func (mod *endpointModule) Name() string                                     { return "endpoints" }
+func (mod *endpointModule) Init(ctx context.Context, app *chassis.App) error { return nil }
+func (mod *endpointModule) Shutdown(ctx context.Context) error               { return nil }
+func (mod *endpointModule) Endpoints() []chassis.Endpoint                    { return mod.endpoints }
+
+func okHandler(body string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(body))
+	})
+}
+
+func newExposeApp(t *testing.T, configYAML string, mod chassis.Module) *chassis.App {
+	t.Helper()
+	opts := []chassis.Option{}
+	if configYAML != "" {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(configYAML), 0600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		opts = append(opts, chassis.WithConfigFile(path))
+	}
+	opts = append(opts, chassis.WithModules(mod))
+	return chassis.New(opts...)
+}
+
+func get(mux http.Handler, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestMount_Defaults(t *testing.T) {
+	mod := &endpointModule{endpoints: []chassis.Endpoint{
+		{Name: "stats", Path: "/stats", Handler: okHandler("stats"), Enabled: true},
+		{Name: "dashboard", Path: "/dashboard", Handler: okHandler("dashboard")},
+		{Name: "inbox", Path: "/inbox", Handler: okHandler("inbox"), DevOnly: true},
+	}}
+	app := newExposeApp(t, "", mod)
+	mux := http.NewServeMux()
+	Mount(app, mux)
+
+	if recorder := get(mux, "/healthz"); recorder.Code != http.StatusOK {
+		t.Errorf("health endpoint should be mounted by default, got %d", recorder.Code)
+	}
+	if recorder := get(mux, "/stats"); recorder.Body.String() != "stats" {
+		t.Errorf("enabled endpoint should be mounted, got %d", recorder.Code)
+	}
+	if recorder := get(mux, "/dashboard"); recorder.Code != http.StatusNotFound {
+		t.Errorf("disabled endpoint should not be mounted, got %d", recorder.Code)
+	}
+	if recorder := get(mux, "/inbox"); recorder.Code != http.StatusOK {
+		t.Errorf("dev-only endpoint should be mounted in development, got %d", recorder.Code)
+	}
+}
+
+func TestMount_ExposeConfig(t *testing.T) {
+	mod := &endpointModule{endpoints: []chassis.Endpoint{
+		{Name: "stats", Path: "/stats", Handler: okHandler("stats"), Enabled: true},
+		{Name: "dashboard", Path: "/dashboard", Handler: okHandler("dashboard")},
+		{Name: "secret", Path: "/secret", Handler: okHandler("secret"), Enabled: true},
+		{Name: "jobs", Path: "/jobs", Handler: okHandler("jobs"), Enabled: true, Permission: "queue:read"},
+	}}
+	app := newExposeApp(t, `
+http:
+  expose:
+    health: false
+    stats:
+      path: /internal/stats
+    dashboard:
+      enabled: true
+    secret:
+      permission: authenticated
+`, mod)
+	mux := http.NewServeMux()
+	mounted := Mount(app, mux)
+
+	if len(mounted) != 3 {
+		t.Errorf("expected 3 mounted endpoints, got %d", len(mounted))
+	}
+	if recorder := get(mux, "/healthz"); recorder.Code != http.StatusNotFound {
+		t.Errorf("health should be disabled, got %d", recorder.Code)
+	}
+	if recorder := get(mux, "/internal/stats"); recorder.Body.String() != "stats" {
+		t.Errorf("stats should move to configured path, got %d", recorder.Code)
+	}
+	if recorder := get(mux, "/dashboard"); recorder.Body.String() != "dashboard" {
+		t.Errorf("dashboard should be enabled by config, got %d", recorder.Code)
+	}
+
+	// A permission without a resource to check it in isn't mounted
+	if recorder := get(mux, "/jobs?org_id=mine"); recorder.Code != http.StatusNotFound {
+		t.Errorf("endpoint without a resource should not be mounted, got %d", recorder.Code)
+	}
+
+	// No auth module registered: guarded endpoints fail closed
+	recorder := get(mux, "/secret")
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("guarded endpoint without auth module should be forbidden, got %d", recorder.Code)
+	}
+}
+
+func TestMount_DuplicatePathSkipped(t *testing.T) {
+	mod := &endpointModule{endpoints: []chassis.Endpoint{
+		{Name: "first", Path: "/same", Handler: okHandler("first"), Enabled: true},
+		{Name: "second", Path: "/same", Handler: okHandler("second"), Enabled: true},
+	}}
+	app := newExposeApp(t, "", mod)
+	mux := http.NewServeMux()
+	Mount(app, mux)
+
+	if recorder := get(mux, "/same"); recorder.Body.String() != "first" {
+		t.Errorf("first endpoint should keep the path, got %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/talosaether/chassis"
+)
+
+// PermissionAuthenticated lets any logged-in user call an endpoint.
+const PermissionAuthenticated = "authenticated"
+
+// Mount registers the built-in endpoints of all modules on mux, plus the
+// health endpoint and any extra endpoints given. The http.expose config
+// section controls each endpoint by name:
+//
+//	http:
+//	  expose:
+//	    health:
+//	      path: /internal/health
+//	    queue_dashboard:
+//	      enabled: true
+//	      permission: queue:read
+//	      resource: ${OPS_ORG_ID}
+//	    pprof: false
+//
+// A bare boolean enables or disables an endpoint. Endpoints behind a
+// permission require the auth module; permissions other than
+// "authenticated" also require the permissions module and a resource, the
+// org the permission is checked in. If a required module is missing,
+// requests are rejected rather than served unprotected; an endpoint without
+// a resource isn't mounted.
+//
+// Mount returns the endpoints that were mounted, with config applied.
+func Mount(app *chassis.App, mux *http.ServeMux, extra ...chassis.Endpoint) []chassis.Endpoint {
+	endpoints := append([]chassis.Endpoint{HealthEndpoint(app)}, app.Endpoints()...)
+	endpoints = append(endpoints, extra...)
+
+	var mounted []chassis.Endpoint
+	paths := make(map[string]string)
+	for _, endpoint := range endpoints {
+		endpoint, enabled := applyExposeConfig(app, endpoint)
+		if !enabled {
+			app.Logger().Debug("endpoint not exposed", "endpoint", endpoint.Name)
+			continue
+		}
+		if endpoint.Permission != "" && endpoint.Permission != PermissionAuthenticated && endpoint.Resource == "" {
+			app.Logger().Error("endpoint permission has no resource to check it in",
+				"endpoint", endpoint.Name,
+				"permission", endpoint.Permission,
+			)
+			continue
+		}
+		if other, taken := paths[endpoint.Path]; taken {
+			app.Logger().Error("endpoint path already in use",
+				"endpoint", endpoint.Name,
+				"path", endpoint.Path,
+				"used_by", other,
+			)
+			continue
+		}
+		paths[endpoint.Path] = endpoint.Name
+
+		mux.Handle(endpoint.Path, guard(app, endpoint))
+		mounted = append(mounted, endpoint)
+		app.Logger().Info("endpoint mounted",
+			"endpoint", endpoint.Name,
+			"path", endpoint.Path,
+			"permission", endpoint.Permission,
+		)
+	}
+	return mounted
+}
+
+// applyExposeConfig overlays http.expose.<name> on the endpoint defaults.
+func applyExposeConfig(app *chassis.App, endpoint chassis.Endpoint) (chassis.Endpoint, bool) {
+	enabled := endpoint.Enabled || (endpoint.DevOnly && app.Config().Env == "development")
+
+	setting := app.ConfigData().Get("http.expose." + endpoint.Name)
+	if toggle, ok := setting.(bool); ok {
+		return endpoint, toggle
+	}
+
+	section := app.ConfigData().Section("http.expose." + endpoint.Name)
+	if section == nil {
+		return endpoint, enabled
+	}
+	if toggle, ok := section["enabled"].(bool); ok {
+		enabled = toggle
+	} else {
+		// Configuring an endpoint without saying otherwise exposes it
+		enabled = true
+	}
+	if path := section.GetString("path"); path != "" {
+		endpoint.Path = path
+	}
+	// Presence matters here: permission: "" makes an endpoint public
+	if permission, ok := section["permission"].(string); ok {
+		endpoint.Permission = permission
+	}
+	if resource, ok := section["resource"].(string); ok {
+		endpoint.Resource = resource
+	}
+	return endpoint, enabled
+}
+
+// guard wraps an endpoint handler with its permission check.
+func guard(app *chassis.App, endpoint chassis.Endpoint) http.Handler {
+	if endpoint.Permission == "" {
+		return endpoint.Handler
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !app.HasModule("auth") {
+			Error(writer, request, chassis.CodePermissionDenied, "endpoint requires the auth module")
+			return
+		}
+		userID := app.Auth().GetUserID(request.Context(), request)
+		if userID == "" {
+			Error(writer, request, chassis.CodeUnauthenticated, "authentication required")
+			return
+		}
+
+		if endpoint.Permission != PermissionAuthenticated {
+			if !app.HasModule("permissions") {
+				Error(writer, request, chassis.CodePermissionDenied, "endpoint requires the permissions module")
+				return
+			}
+			// The resource comes from config, never the request, so callers
+			// can't pick an org in which they hold the permission
+			if endpoint.Resource == "" || !app.Permissions().Can(request.Context(), userID, endpoint.Permission, endpoint.Resource) {
+				Error(writer, request, chassis.CodePermissionDenied, "permission denied")
+				return
+			}
+		}
+
+		endpoint.Handler.ServeHTTP(writer, request)
+	})
+}
+
+// HealthEndpoint returns the built-in health endpoint, which reports the
+// registered modules and the status of the services run by app.Run. The
+// status is "degraded" while a service waits to restart after a panic. It
+// is public and mounted at /healthz by default.
+func HealthEndpoint(app *chassis.App) chassis.Endpoint {
+	return chassis.Endpoint{
+		Name:    "health",
+		Path:    "/healthz",
+		Enabled: true,
+		Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			modules := make([]string, 0)
+			for _, mod := range app.Modules() {
+				modules = append(modules, mod.Name())
+			}
+			status := "ok"
+			services := app.Services()
+			for _, service := range services {
+				if service.State == chassis.ServiceRestarting {
+					status = "degraded"
+				}
+			}
+			WriteJSON(writer, http.StatusOK, map[string]any{
+				"status":   status,
+				"modules":  modules,
+				"services": services,
+			})
+		}),
+	}
+}
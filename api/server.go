@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// Server is a module serving HTTP while the app runs. It implements
+// chassis.Service, so app.Run listens once every module is registered and
+// drains in-flight requests on shutdown:
+//
+//	mux := http.NewServeMux()
+//	app := chassis.New(chassis.WithModules(..., api.NewServer(mux, api.WithAddr(":8080"))))
+//	api.Mount(app, mux)
+//	err := app.Run(ctx)
+//
+// The address can also be set with http.addr. Requests carry the app and
+// a request-scoped logger in their context; see chassis.FromContext.
+type Server struct {
+	app     *chassis.App
+	handler http.Handler
+	addr    string
+
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithAddr sets the address to listen on; ":8080" by default.
+func WithAddr(addr string) ServerOption {
+	return func(srv *Server) {
+		srv.addr = addr
+	}
+}
+
+// NewServer creates a Server module serving handler.
+func NewServer(handler http.Handler, opts ...ServerOption) *Server {
+	srv := &Server{handler: handler, addr: ":8080"}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
+
+// Name returns the module identifier.
+func (srv *Server) Name() string {
+	return "http"
+}
+
+// Init reads http.addr.
+func (srv *Server) Init(ctx context.Context, app *chassis.App) error {
+	srv.app = app
+	if cfg := app.ConfigData(); cfg != nil {
+		if addr := cfg.GetString("http.addr"); addr != "" {
+			srv.addr = addr
+		}
+	}
+	return nil
+}
+
+// Start listens and serves until ctx is cancelled. Implements
+// chassis.Service.
+func (srv *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", srv.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", srv.addr, err)
+	}
+	server := &http.Server{Handler: srv.app.Middleware(srv.handler), ReadHeaderTimeout: 10 * time.Second}
+	srv.mu.Lock()
+	srv.server, srv.listener = server, listener
+	srv.mu.Unlock()
+	srv.app.Logger().Info("http server listening", "addr", listener.Addr().String())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		// Shutdown drains the connections within the app's shutdown timeout
+		return nil
+	}
+}
+
+// Addr returns the address the server listens on once started, e.g. to
+// find the port chosen for ":0".
+func (srv *Server) Addr() string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.listener == nil {
+		return ""
+	}
+	return srv.listener.Addr().String()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	server := srv.server
+	srv.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
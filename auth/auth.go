@@ -17,25 +17,117 @@
 //
 //	// Protect routes with middleware
 //	http.Handle("/protected", app.Auth().RequireAuth(handler))
+//
+// # Login locations
+//
+// LoginRequest stores the client IP and user agent on the session, as Login
+// does when the context carries WithClientInfo. With a GeoIP provider the IP
+// is resolved to a country and city:
+//
+//	auth.New(auth.WithGeoIP(auth.GeoIPFunc(func(ctx context.Context, ip string) (*auth.GeoLocation, error) {
+//	    record, err := geoDB.City(net.ParseIP(ip))
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return &auth.GeoLocation{Country: record.Country.IsoCode, City: record.City.Names["en"]}, nil
+//	})))
+//
+// Logins from a country or device (browser and OS) the user hasn't used
+// before publish auth.suspicious_login. Behind a reverse proxy, set
+// auth.trust_proxy_headers so the IP is read from X-Forwarded-For.
+//
+// # Impersonation
+//
+// Support staff can act as a user with Impersonate, which replaces their
+// session cookie with a short-lived session of the target that records
+// who started it. Session.ImpersonatorID names the admin, and
+// RequireNotImpersonating keeps such sessions away from sensitive
+// endpoints:
+//
+//	http.Handle("/account/password", authMod.RequireAuth(authMod.RequireNotImpersonating(handler)))
+//
+// Starting and stopping publish auth.impersonation_started and
+// auth.impersonation_stopped for audit logs.
+//
+// # Remember me
+//
+// Sessions are short (auth.session_ttl). Logging in with a context from
+// WithRememberMe also issues a long-lived token (auth.remember_ttl, 30
+// days by default) in a second cookie; RequireAuth exchanges it for a new
+// session once the short one expires, rotating the token on every use.
+//
+// # Single sign-on
+//
+// Organizations can sign their members in through a SAML 2.0 identity
+// provider such as Okta or Azure AD. Enable it with the public URL the SSO
+// endpoints are served at (auth.sso.base_url, or WithSSO), then configure
+// each organization's connection from its IdP metadata:
+//
+//	authMod := auth.New(auth.WithSSO("https://app.example.com/sso"))
+//	connection, err := authMod.ConfigureSSO(ctx, orgID, auth.SSOInput{
+//	    Metadata:      metadataXML,
+//	    NameAttribute: "displayName",
+//	    Domains:       []string{"example.com"},
+//	    Required:      true,
+//	})
+//
+// SSOHandler serves /{org ID}/login, /{org ID}/acs and /{org ID}/metadata
+// (mounted at /sso/ by api.Mount). Signing in verifies the signed
+// assertion, creates or links the user by an identity of provider
+// "saml:<org ID>" and adds them to the organization. Members of an
+// organization whose connection is Required can't log in with a password:
+// Login fails with ErrSSORequired. Configuration changes and sign-ins
+// publish auth.sso_configured, auth.sso_removed, auth.sso_login and
+// auth.sso_login_failed for audit logs.
 package auth
 
 import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
 )
 
 var (
-	ErrInvalidSession   = errors.New("invalid or expired session")
-	ErrNotAuthenticated = errors.New("not authenticated")
+	ErrInvalidSession   = chassis.NewError(chassis.CodeUnauthenticated, "invalid or expired session")
+	ErrNotAuthenticated = chassis.NewError(chassis.CodeUnauthenticated, "not authenticated")
+)
+
+// Lifecycle events published when the events module is registered.
+// The payload is a *SessionEvent.
+const (
+	EventLogin  = "auth.login"
+	EventLogout = "auth.logout"
 )
 
+// EventLoginFailed is published when Login rejects an email and password.
+// The payload is a *LoginFailedEvent.
+const EventLoginFailed = "auth.login_failed"
+
+// LoginFailedEvent is the payload of failed login events. UserID is set
+// when the email belongs to a user, so apps can alert on repeated
+// failures against one account.
+type LoginFailedEvent struct {
+	Email     string
+	UserID    string
+	IP        string
+	UserAgent string
+	Reason    string
+}
+
+// SessionEvent is the payload of login and logout events.
+type SessionEvent struct {
+	UserID    string
+	SessionID string
+}
+
 // Session represents an authenticated user session.
 type Session struct {
 	ID        string
@@ -43,6 +135,22 @@ type Session struct {
 	Token     string
 	ExpiresAt time.Time
 	CreatedAt time.Time
+
+	// Client details, set when the login carried ClientInfo
+	IP        string
+	UserAgent string
+	Country   string
+	City      string
+
+	// ImpersonatorID is the admin acting as UserID, for sessions started
+	// with Impersonate.
+	ImpersonatorID string
+}
+
+// Impersonated reports whether an admin started the session with
+// Impersonate.
+func (session *Session) Impersonated() bool {
+	return session.ImpersonatorID != ""
 }
 
 // Module is the auth module implementation.
@@ -53,6 +161,24 @@ type Module struct {
 	sessionTTL   time.Duration
 	secureCookie bool
 	app          *chassis.App
+
+	geoIP             GeoIPProvider
+	trustProxyHeaders bool
+	knownLogins       KnownLoginStore
+	history           LoginHistoryStore
+	historyRetention  time.Duration
+
+	impersonationTTL time.Duration
+	canImpersonate   ImpersonationCheck
+
+	rememberTTL time.Duration
+	remember    RememberStore
+
+	ssoBaseURL  string
+	ssoEntityID string
+	sso         SSOStore
+
+	sweepInterval time.Duration
 }
 
 // Options configures the auth module.
@@ -62,6 +188,21 @@ type Options struct {
 	CookieName   string
 	SessionTTL   time.Duration
 	SecureCookie bool
+
+	GeoIP             GeoIPProvider
+	TrustProxyHeaders bool
+
+	LoginHistoryRetention time.Duration
+
+	ImpersonationTTL   time.Duration
+	ImpersonationCheck ImpersonationCheck
+
+	RememberTTL time.Duration
+
+	SSOBaseURL  string
+	SSOEntityID string
+
+	SweepInterval time.Duration
 }
 
 // Option is a function that configures the auth module.
@@ -102,6 +243,21 @@ func WithSecureCookie(secure bool) Option {
 	}
 }
 
+// WithGeoIP resolves session IPs to locations with provider.
+func WithGeoIP(provider GeoIPProvider) Option {
+	return func(opts *Options) {
+		opts.GeoIP = provider
+	}
+}
+
+// WithTrustProxyHeaders reads client IPs from X-Forwarded-For. Only enable
+// it behind a proxy that sets the header, or clients can spoof their IP.
+func WithTrustProxyHeaders(trust bool) Option {
+	return func(opts *Options) {
+		opts.TrustProxyHeaders = trust
+	}
+}
+
 // New creates a new auth module with the given options.
 func New(opts ...Option) *Module {
 	options := &Options{
@@ -109,6 +265,11 @@ func New(opts ...Option) *Module {
 		CookieName:   "session",
 		SessionTTL:   24 * time.Hour,
 		SecureCookie: false,
+
+		ImpersonationTTL:      DefaultImpersonationTTL,
+		RememberTTL:           DefaultRememberTTL,
+		SweepInterval:         DefaultSweepInterval,
+		LoginHistoryRetention: DefaultLoginHistoryRetention,
 	}
 
 	for _, opt := range opts {
@@ -121,6 +282,20 @@ func New(opts ...Option) *Module {
 		cookieName:   options.CookieName,
 		sessionTTL:   options.SessionTTL,
 		secureCookie: options.SecureCookie,
+
+		geoIP:             options.GeoIP,
+		trustProxyHeaders: options.TrustProxyHeaders,
+		historyRetention:  options.LoginHistoryRetention,
+
+		impersonationTTL: options.ImpersonationTTL,
+		canImpersonate:   options.ImpersonationCheck,
+
+		rememberTTL: options.RememberTTL,
+
+		ssoBaseURL:  options.SSOBaseURL,
+		ssoEntityID: options.SSOEntityID,
+
+		sweepInterval: options.SweepInterval,
 	}
 }
 
@@ -129,6 +304,12 @@ func (mod *Module) Name() string {
 	return "auth"
 }
 
+// Dependencies returns the modules auth needs. Implements
+// chassis.Dependent.
+func (mod *Module) Dependencies() []string {
+	return []string{"users"}
+}
+
 // Init initializes the auth module.
 func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 	mod.app = app
@@ -141,19 +322,58 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		if cookieName := cfg.GetString("auth.cookie_name"); cookieName != "" {
 			mod.cookieName = cookieName
 		}
-		if ttlStr := cfg.GetString("auth.session_ttl"); ttlStr != "" {
-			if ttl, err := time.ParseDuration(ttlStr); err == nil {
-				mod.sessionTTL = ttl
+		if cfg.Get("auth.session_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("auth.session_ttl")
+			if err != nil {
+				return err
 			}
+			mod.sessionTTL = ttl
 		}
 		if cfg.GetBool("auth.secure_cookie") {
 			mod.secureCookie = true
 		}
+		if cfg.GetBool("auth.trust_proxy_headers") {
+			mod.trustProxyHeaders = true
+		}
+		if cfg.Get("auth.remember_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("auth.remember_ttl")
+			if err != nil {
+				return err
+			}
+			mod.rememberTTL = ttl
+		}
+		if cfg.Get("auth.impersonation_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("auth.impersonation_ttl")
+			if err != nil {
+				return err
+			}
+			mod.impersonationTTL = ttl
+		}
+		if cfg.Get("auth.login_history_retention") != nil {
+			retention, err := cfg.MustGetDuration("auth.login_history_retention")
+			if err != nil {
+				return err
+			}
+			mod.historyRetention = retention
+		}
+		if baseURL := cfg.GetString("auth.sso.base_url"); baseURL != "" {
+			mod.ssoBaseURL = baseURL
+		}
+		if entityID := cfg.GetString("auth.sso.entity_id"); entityID != "" {
+			mod.ssoEntityID = entityID
+		}
+		if cfg.Get("auth.sweep_interval") != nil {
+			interval, err := cfg.MustGetDuration("auth.sweep_interval")
+			if err != nil {
+				return err
+			}
+			mod.sweepInterval = interval
+		}
 	}
 
 	// Use custom store if provided, otherwise create SQLite store
 	if mod.store == nil {
-		sqliteStore, err := NewSQLiteSessionStore(mod.dbPath)
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
 		if err != nil {
 			return fmt.Errorf("failed to create session store: %w", err)
 		}
@@ -163,9 +383,48 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		app.Logger().Info("auth using custom session store")
 	}
 
+	if known, ok := mod.store.(KnownLoginStore); ok {
+		mod.knownLogins = known
+	} else {
+		mod.knownLogins = NewMemoryKnownLoginStore()
+	}
+	if history, ok := mod.store.(LoginHistoryStore); ok {
+		mod.history = history
+	} else {
+		mod.history = NewMemoryLoginHistoryStore()
+	}
+	if remember, ok := mod.store.(RememberStore); ok {
+		mod.remember = remember
+	} else {
+		mod.remember = NewMemoryRememberStore()
+	}
+	if sso, ok := mod.store.(SSOStore); ok {
+		mod.sso = sso
+	} else {
+		mod.sso = NewMemorySSOStore()
+	}
+	mod.ssoBaseURL = strings.TrimSuffix(mod.ssoBaseURL, "/")
+	if mod.sweepInterval <= 0 {
+		mod.sweepInterval = DefaultSweepInterval
+	}
+
 	return nil
 }
 
+// openSQLiteStore creates the store on the database named by
+// auth.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteSessionStore, error) {
+	db, err := app.ModuleDatabase("auth")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteSessionStore(dbPath)
+	}
+	return NewSQLiteSessionStoreFromDB(db)
+}
+
 // Shutdown cleans up the auth module.
 func (mod *Module) Shutdown(ctx context.Context) error {
 	if mod.store != nil {
@@ -174,47 +433,174 @@ func (mod *Module) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "sessions.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "sessions.db"))
+}
+
 // UserIdentifier is implemented by user types that can provide their ID.
 type UserIdentifier interface {
 	GetID() string
 }
 
+// LoginRequest is Login with the client IP and user agent of request
+// stored on the session.
+func (mod *Module) LoginRequest(writer http.ResponseWriter, request *http.Request, email, password string) (*Session, error) {
+	ctx := WithClientInfo(request.Context(), mod.ClientInfo(request))
+	return mod.Login(ctx, writer, email, password)
+}
+
 // Login authenticates a user and creates a session.
 // It sets the session cookie on the response writer.
 func (mod *Module) Login(ctx context.Context, writer http.ResponseWriter, email, password string) (*Session, error) {
-	// Authenticate via users module
-	userAny, err := mod.app.Users().Authenticate(ctx, email, password)
+	userID, err := mod.authenticate(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := mod.newSession(ctx, userID, mod.sessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.issueSession(ctx, writer, session); err != nil {
+		return nil, err
+	}
+	if rememberMeFromContext(ctx) {
+		if err := mod.issueRememberToken(ctx, writer, userID); err != nil {
+			return nil, fmt.Errorf("failed to create remember-me token: %w", err)
+		}
+	}
+
+	mod.loggedIn(ctx, email, session)
+	return session, nil
+}
+
+// LoginToken authenticates a user and creates a session without a cookie,
+// for clients that send the session token themselves, such as gRPC
+// clients. Look the session up again with SessionByToken.
+func (mod *Module) LoginToken(ctx context.Context, email, password string) (*Session, error) {
+	userID, err := mod.authenticate(ctx, email, password)
 	if err != nil {
 		return nil, err
 	}
 
+	session, err := mod.newSession(ctx, userID, mod.sessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.store.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	mod.loggedIn(ctx, email, session)
+	return session, nil
+}
+
+// authenticate checks the credentials with the users module and returns
+// the user's ID. Members of organizations requiring SSO are refused with
+// ErrSSORequired.
+func (mod *Module) authenticate(ctx context.Context, email, password string) (string, error) {
+	userAny, err := mod.app.Users().Authenticate(ctx, email, password)
+	if err != nil {
+		mod.loginFailed(ctx, email, err)
+		return "", err
+	}
+
 	// Extract user ID
 	userWithID, ok := userAny.(UserIdentifier)
 	if !ok {
-		return nil, fmt.Errorf("user type does not implement GetID()")
+		return "", fmt.Errorf("user type does not implement GetID()")
 	}
-	userID := userWithID.GetID()
+	if err := mod.checkSSORequired(ctx, userWithID.GetID()); err != nil {
+		mod.loginFailed(ctx, email, err)
+		return "", err
+	}
+	return userWithID.GetID(), nil
+}
 
-	// Generate session token
+// loginFailed records a failed attempt and publishes EventLoginFailed.
+func (mod *Module) loginFailed(ctx context.Context, email string, err error) {
+	attempt := &LoginAttempt{Email: email, Outcome: OutcomeFailure, Reason: err.Error()}
+	if user, lookupErr := mod.app.Users().GetByEmail(ctx, email); lookupErr == nil {
+		if identified, ok := user.(UserIdentifier); ok {
+			attempt.UserID = identified.GetID()
+		}
+	}
+	client := clientInfoFromContext(ctx)
+	location := mod.locate(ctx, client.IP)
+	attempt.IP, attempt.UserAgent = client.IP, client.UserAgent
+	attempt.Country, attempt.City = location.Country, location.City
+	mod.recordAttempt(ctx, attempt)
+
+	mod.app.PublishEvent(ctx, EventLoginFailed, &LoginFailedEvent{
+		Email:     email,
+		UserID:    attempt.UserID,
+		IP:        attempt.IP,
+		UserAgent: attempt.UserAgent,
+		Reason:    attempt.Reason,
+	})
+}
+
+// loggedIn records the successful attempt, publishes the login event of a
+// new session and checks whether it is suspicious.
+func (mod *Module) loggedIn(ctx context.Context, email string, session *Session) {
+	mod.recordAttempt(ctx, &LoginAttempt{
+		UserID:    session.UserID,
+		Email:     email,
+		Outcome:   OutcomeSuccess,
+		IP:        session.IP,
+		UserAgent: session.UserAgent,
+		Country:   session.Country,
+		City:      session.City,
+		SessionID: session.ID,
+	})
+	mod.app.PublishEvent(ctx, EventLogin, &SessionEvent{UserID: session.UserID, SessionID: session.ID})
+	mod.checkSuspicious(ctx, session)
+}
+
+// newSession builds a session for userID lasting ttl, with the client
+// details of ctx.
+func (mod *Module) newSession(ctx context.Context, userID string, ttl time.Duration) (*Session, error) {
 	token, err := generateToken(32)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate session token: %w", err)
 	}
 
 	now := time.Now()
-	session := &Session{
+	client := clientInfoFromContext(ctx)
+	location := mod.locate(ctx, client.IP)
+	return &Session{
 		ID:        generateID(),
 		UserID:    userID,
 		Token:     token,
-		ExpiresAt: now.Add(mod.sessionTTL),
+		ExpiresAt: now.Add(ttl),
 		CreatedAt: now,
-	}
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Country:   location.Country,
+		City:      location.City,
+	}, nil
+}
 
+// issueSession stores a new session and sets its cookie.
+func (mod *Module) issueSession(ctx context.Context, writer http.ResponseWriter, session *Session) error {
 	if err := mod.store.Create(ctx, session); err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
+		return fmt.Errorf("failed to create session: %w", err)
 	}
 
-	// Set cookie
 	http.SetCookie(writer, &http.Cookie{
 		Name:     mod.cookieName,
 		Value:    session.Token,
@@ -224,17 +610,40 @@ func (mod *Module) Login(ctx context.Context, writer http.ResponseWriter, email,
 		Secure:   mod.secureCookie,
 		SameSite: http.SameSiteLaxMode,
 	})
-
-	return session, nil
+	return nil
 }
 
-// Logout invalidates a session and clears the cookie.
+// Logout invalidates a session and its remember-me token and clears the
+// cookies. Logging out of an impersonated session ends the impersonation.
 func (mod *Module) Logout(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	if err := mod.forgetRememberToken(ctx, writer, request); err != nil {
+		return err
+	}
+	return mod.endSession(ctx, writer, request)
+}
+
+// RevokeSessions signs the user out everywhere by deleting all their
+// sessions and remember-me tokens, e.g. after a password reset.
+func (mod *Module) RevokeSessions(ctx context.Context, userID string) error {
+	if err := mod.store.DeleteByUserID(ctx, userID); err != nil {
+		return err
+	}
+	if mod.remember != nil {
+		return mod.remember.DeleteRememberTokensByUserID(ctx, userID)
+	}
+	return nil
+}
+
+// endSession deletes the request's session and clears its cookie.
+func (mod *Module) endSession(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 	cookie, err := request.Cookie(mod.cookieName)
 	if err != nil {
 		return nil // No session to logout
 	}
 
+	// Look up the session first so the logout event can name the user
+	session, lookupErr := mod.store.GetByToken(ctx, cookie.Value)
+
 	if err := mod.store.DeleteByToken(ctx, cookie.Value); err != nil {
 		return err
 	}
@@ -250,6 +659,12 @@ func (mod *Module) Logout(ctx context.Context, writer http.ResponseWriter, reque
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	if lookupErr == nil {
+		mod.app.PublishEvent(ctx, EventLogout, &SessionEvent{UserID: session.UserID, SessionID: session.ID})
+		if session.Impersonated() {
+			mod.impersonationStopped(ctx, session)
+		}
+	}
 	return nil
 }
 
@@ -260,8 +675,13 @@ func (mod *Module) GetSession(ctx context.Context, request *http.Request) (*Sess
 	if err != nil {
 		return nil, ErrInvalidSession
 	}
+	return mod.SessionByToken(ctx, cookie.Value)
+}
 
-	session, err := mod.store.GetByToken(ctx, cookie.Value)
+// SessionByToken retrieves the session with the given token.
+// Returns ErrInvalidSession if it doesn't exist or has expired.
+func (mod *Module) SessionByToken(ctx context.Context, token string) (*Session, error) {
+	session, err := mod.store.GetByToken(ctx, token)
 	if err != nil {
 		return nil, ErrInvalidSession
 	}
@@ -274,6 +694,22 @@ func (mod *Module) GetSession(ctx context.Context, request *http.Request) (*Sess
 	return session, nil
 }
 
+// LogoutToken invalidates the session with the given token, the
+// counterpart of LoginToken. Unknown tokens are not an error.
+func (mod *Module) LogoutToken(ctx context.Context, token string) error {
+	session, lookupErr := mod.store.GetByToken(ctx, token)
+	if err := mod.store.DeleteByToken(ctx, token); err != nil {
+		return err
+	}
+	if lookupErr == nil {
+		mod.app.PublishEvent(ctx, EventLogout, &SessionEvent{UserID: session.UserID, SessionID: session.ID})
+		if session.Impersonated() {
+			mod.impersonationStopped(ctx, session)
+		}
+	}
+	return nil
+}
+
 // GetUserID retrieves the current user ID from a request.
 // Returns empty string if not authenticated.
 // The request parameter should be *http.Request.
@@ -289,22 +725,31 @@ func (mod *Module) GetUserID(ctx context.Context, request any) string {
 	return session.UserID
 }
 
-// RequireAuth returns middleware that requires a valid session.
-// Responds with 401 Unauthorized if no valid session exists.
+// RequireAuth returns middleware that requires a valid session. Once a
+// session expires, a remember-me token starts a new one.
+// Responds with a 401 error envelope if no valid session exists.
 func (mod *Module) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		session, err := mod.GetSession(request.Context(), request)
 		if err != nil {
-			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			session, err = mod.resumeSession(request.Context(), writer, request)
+		}
+		if err != nil {
+			api.WriteError(writer, request, ErrNotAuthenticated)
 			return
 		}
 
-		// Add session to context
-		ctx := context.WithValue(request.Context(), sessionContextKey, session)
-		next.ServeHTTP(writer, request.WithContext(ctx))
+		next.ServeHTTP(writer, request.WithContext(WithSession(request.Context(), session)))
 	})
 }
 
+// WithSession returns a context carrying session, as RequireAuth does for
+// requests. Transports authenticating by token use it to put the caller
+// in context.
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, session)
+}
+
 // SessionFromContext retrieves the session from request context.
 // Returns nil if no session in context (use after RequireAuth middleware).
 func SessionFromContext(ctx context.Context) *Session {
@@ -321,6 +766,12 @@ func UserIDFromContext(ctx context.Context) string {
 	return ""
 }
 
+// SessionUserID returns the user ID of the session in ctx, like
+// UserIDFromContext, for modules that find auth through the app.
+func (mod *Module) SessionUserID(ctx context.Context) string {
+	return UserIDFromContext(ctx)
+}
+
 type contextKey string
 
 const sessionContextKey contextKey = "chassis_session"
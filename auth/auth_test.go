@@ -1,12 +1,36 @@
 package auth
 
 import (
+	"bytes"
+	"compress/flate"
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/base64"
 	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/users"
 )
 
 func setupTestStore(t *testing.T) (*SQLiteSessionStore, func()) {
@@ -364,3 +388,744 @@ func TestErrors(t *testing.T) {
 		t.Errorf("ErrNotAuthenticated message wrong: %q", ErrNotAuthenticated.Error())
 	}
 }
+
+func TestSQLiteSessionStore_KnownLogins(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for i, step := range []struct {
+		country, device       string
+		newCountry, newDevice bool
+	}{
+		{"DE", "Firefox on Linux", false, false}, // first login is never new
+		{"DE", "Firefox on Linux", false, false},
+		{"FR", "Firefox on Linux", true, false},
+		{"FR", "Safari on iOS", false, true},
+		{"", "", false, false},
+	} {
+		newCountry, newDevice, err := store.RecordLogin(ctx, "user-1", step.country, step.device)
+		if err != nil {
+			t.Fatalf("step %d: RecordLogin failed: %v", i, err)
+		}
+		if newCountry != step.newCountry || newDevice != step.newDevice {
+			t.Errorf("step %d: got new country %v, new device %v", i, newCountry, newDevice)
+		}
+	}
+}
+
+func TestSQLiteSessionStore_AddsClientColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE sessions (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, token TEXT UNIQUE NOT NULL, expires_at DATETIME NOT NULL, created_at DATETIME NOT NULL);
+		INSERT INTO sessions VALUES ('old', 'user-1', 'token', '2030-01-01 00:00:00', '2020-01-01 00:00:00')`)
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSQLiteSessionStore(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open an existing database: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if session, err := store.GetByID(context.Background(), "old"); err != nil || session.IP != "" {
+		t.Errorf("expected the old session without client details, got %+v (%v)", session, err)
+	}
+}
+
+func TestModule_LoginLocationsAndSuspiciousLogins(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(
+		WithDBPath(filepath.Join(dir, "sessions.db")),
+		WithTrustProxyHeaders(true),
+		WithGeoIP(GeoIPFunc(func(ctx context.Context, ip string) (*GeoLocation, error) {
+			switch ip {
+			case "203.0.113.7":
+				return &GeoLocation{Country: "DE", City: "Berlin"}, nil
+			case "198.51.100.9":
+				return &GeoLocation{Country: "BR", City: "São Paulo"}, nil
+			}
+			return nil, errors.New("unknown address")
+		})),
+	)
+	app := chassis.New(chassis.WithModules(events.New(), usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	var mu sync.Mutex
+	var suspicious []*SuspiciousLoginEvent
+	app.Events().Subscribe(EventSuspiciousLogin, func(ctx context.Context, eventType string, payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		suspicious = append(suspicious, payload.(*SuspiciousLoginEvent))
+	})
+
+	if _, err := usersMod.Create(context.Background(), "ann@example.com", "password123"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	login := func(forwardedFor, userAgent string) *Session {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/login", nil)
+		request.Header.Set("X-Forwarded-For", forwardedFor+", 10.0.0.1")
+		request.Header.Set("User-Agent", userAgent)
+		session, err := mod.LoginRequest(httptest.NewRecorder(), request, "ann@example.com", "password123")
+		if err != nil {
+			t.Fatalf("LoginRequest failed: %v", err)
+		}
+		return session
+	}
+
+	first := login("203.0.113.7", firefox)
+	if first.IP != "203.0.113.7" || first.Country != "DE" || first.City != "Berlin" || first.UserAgent != firefox {
+		t.Errorf("client details not stored: %+v", first)
+	}
+	if stored, _ := mod.store.GetByID(context.Background(), first.ID); stored.Country != "DE" {
+		t.Errorf("client details not persisted: %+v", stored)
+	}
+	login("203.0.113.7", strings.Replace(firefox, "128.0", "129.0", 2)) // browser update
+	travel := login("198.51.100.9", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 Version/17.5 Mobile/15E148 Safari/604.1")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(suspicious) != 1 {
+		t.Fatalf("expected one suspicious login, got %d", len(suspicious))
+	}
+	event := suspicious[0]
+	if event.SessionID != travel.ID || event.Country != "BR" || event.Device != "Safari on iOS" ||
+		!slices.Equal(event.Reasons, []string{ReasonNewCountry, ReasonNewDevice}) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestModule_ClientInfo(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "192.0.2.1:5555"
+	request.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	if info := New().ClientInfo(request); info.IP != "192.0.2.1" {
+		t.Errorf("X-Forwarded-For must be ignored by default, got %q", info.IP)
+	}
+	if info := New(WithTrustProxyHeaders(true)).ClientInfo(request); info.IP != "203.0.113.7" {
+		t.Errorf("expected the forwarded IP, got %q", info.IP)
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	for userAgent, want := range map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36":               "Chrome on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126": "Edge on macOS",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36":                      "Chrome on Android",
+		"curl/8.5.0": "curl",
+		"custom-bot": "custom-bot",
+		"":           "",
+	} {
+		if got := DeviceName(userAgent); got != want {
+			t.Errorf("DeviceName(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
+
+func TestModule_Impersonate(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(
+		WithDBPath(filepath.Join(dir, "sessions.db")),
+		WithImpersonationTTL(10*time.Minute),
+		WithImpersonationCheck(func(ctx context.Context, adminUserID, targetUserID string) error {
+			if adminUserID != "support" {
+				return ErrImpersonationNotAllowed
+			}
+			return nil
+		}),
+	)
+	app := chassis.New(chassis.WithModules(events.New(), usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var audit []string
+	for _, eventType := range []string{EventImpersonationStarted, EventImpersonationStopped} {
+		app.Events().Subscribe(eventType, func(ctx context.Context, eventType string, payload any) {
+			mu.Lock()
+			defer mu.Unlock()
+			event := payload.(*ImpersonationEvent)
+			audit = append(audit, eventType+" "+event.AdminUserID+" "+event.TargetUserID)
+		})
+	}
+
+	target, err := usersMod.Create(ctx, "ann@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	targetID := target.(*users.User).ID
+
+	if _, err := mod.Impersonate(ctx, httptest.NewRecorder(), "someone", targetID); !errors.Is(err, ErrImpersonationNotAllowed) {
+		t.Errorf("expected the check to refuse, got %v", err)
+	}
+	if _, err := mod.Impersonate(ctx, httptest.NewRecorder(), "support", "missing"); !errors.Is(err, users.ErrNotFound) {
+		t.Errorf("expected unknown targets to fail, got %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	session, err := mod.Impersonate(ctx, recorder, "support", targetID)
+	if err != nil {
+		t.Fatalf("Impersonate failed: %v", err)
+	}
+	if session.UserID != targetID || session.ImpersonatorID != "support" || time.Until(session.ExpiresAt) > 10*time.Minute {
+		t.Errorf("unexpected session %+v", session)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/account/password", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+
+	var seen string
+	handler := mod.RequireAuth(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		seen = UserIDFromContext(request.Context()) + " via " + ImpersonatorFromContext(request.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if seen != targetID+" via support" {
+		t.Errorf("expected both identities on the context, got %q", seen)
+	}
+
+	restricted := httptest.NewRecorder()
+	mod.RequireAuth(mod.RequireNotImpersonating(handler)).ServeHTTP(restricted, request)
+	if restricted.Code != http.StatusForbidden {
+		t.Errorf("expected impersonated sessions to be refused, got %d", restricted.Code)
+	}
+
+	if err := mod.StopImpersonating(ctx, httptest.NewRecorder(), request); err != nil {
+		t.Fatalf("StopImpersonating failed: %v", err)
+	}
+	if _, err := mod.GetSession(ctx, request); err == nil {
+		t.Error("impersonated session should be gone")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{EventImpersonationStarted + " support " + targetID, EventImpersonationStopped + " support " + targetID}
+	if !slices.Equal(audit, want) {
+		t.Errorf("expected audit events %v, got %v", want, audit)
+	}
+}
+
+func TestModule_RememberMe(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "sessions.db")), WithSessionTTL(time.Millisecond), WithRememberTTL(time.Hour))
+	app := chassis.New(chassis.WithModules(usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if _, err := usersMod.Create(ctx, "ann@example.com", "password123"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	cookieNamed := func(cookies []*http.Cookie, name string) *http.Cookie {
+		for _, cookie := range cookies {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	short := httptest.NewRecorder()
+	if _, err := mod.Login(ctx, short, "ann@example.com", "password123"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if cookieNamed(short.Result().Cookies(), "session_remember") != nil {
+		t.Error("logins without remember-me should not get a remember cookie")
+	}
+
+	login := httptest.NewRecorder()
+	if _, err := mod.Login(WithRememberMe(ctx), login, "ann@example.com", "password123"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	first := cookieNamed(login.Result().Cookies(), "session_remember")
+	if first == nil || time.Until(first.Expires) < 59*time.Minute {
+		t.Fatalf("expected a long-lived remember cookie, got %+v", first)
+	}
+
+	protected := mod.RequireAuth(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	serve := func(remember *http.Cookie) *httptest.ResponseRecorder {
+		time.Sleep(5 * time.Millisecond) // let the short session expire
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.AddCookie(cookieNamed(login.Result().Cookies(), "session"))
+		request.AddCookie(remember)
+		response := httptest.NewRecorder()
+		protected.ServeHTTP(response, request)
+		return response
+	}
+
+	resumed := serve(first)
+	if resumed.Code != http.StatusOK {
+		t.Fatalf("remember-me token should resume the session, got %d", resumed.Code)
+	}
+	second := cookieNamed(resumed.Result().Cookies(), "session_remember")
+	if second == nil || second.Value == first.Value || cookieNamed(resumed.Result().Cookies(), "session") == nil {
+		t.Fatal("resuming should issue a session and rotate the remember-me token")
+	}
+	third := cookieNamed(serve(second).Result().Cookies(), "session_remember")
+	if third == nil {
+		t.Fatal("the rotated token should work")
+	}
+
+	// The first token was rotated twice: replaying it means it was stolen
+	if response := serve(first); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected a replayed token to be refused, got %d", response.Code)
+	}
+	if response := serve(third); response.Code != http.StatusUnauthorized {
+		t.Errorf("replay should revoke the whole series, got %d", response.Code)
+	}
+}
+
+func TestSQLiteSessionStore_DeleteExpired(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Now()
+
+	for id, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "live": now.Add(time.Hour)} {
+		session := &Session{ID: id, UserID: "user-1", Token: "token-" + id, ExpiresAt: expiresAt, CreatedAt: now}
+		if err := store.Create(ctx, session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		token := &RememberToken{Series: id, UserID: "user-1", ValidatorHash: "hash", RotatedAt: now, ExpiresAt: expiresAt, CreatedAt: now}
+		if err := store.SaveRememberToken(ctx, token); err != nil {
+			t.Fatalf("SaveRememberToken failed: %v", err)
+		}
+	}
+
+	deleted, err := store.DeleteExpired(ctx, now)
+	if err != nil {
+		t.Fatalf("DeleteExpired failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected the expired session and token deleted, got %d", deleted)
+	}
+	if _, err := store.GetByID(ctx, "expired"); err == nil {
+		t.Error("expired session should be deleted")
+	}
+	if _, err := store.GetByID(ctx, "live"); err != nil {
+		t.Errorf("live session should remain: %v", err)
+	}
+	if _, err := store.GetRememberToken(ctx, "live"); err != nil {
+		t.Errorf("live remember token should remain: %v", err)
+	}
+}
+
+func TestModule_RevokeSessions(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "sessions.db")))
+	app := chassis.New(chassis.WithModules(usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if _, err := usersMod.Create(ctx, "ann@example.com", "password123"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	var sessions []*Session
+	for _, loginCtx := range []context.Context{ctx, WithRememberMe(ctx)} {
+		session, err := mod.Login(loginCtx, httptest.NewRecorder(), "ann@example.com", "password123")
+		if err != nil {
+			t.Fatalf("Login failed: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := mod.RevokeSessions(ctx, sessions[0].UserID); err != nil {
+		t.Fatalf("RevokeSessions failed: %v", err)
+	}
+	for _, session := range sessions {
+		if _, err := mod.store.GetByToken(ctx, session.Token); err == nil {
+			t.Errorf("expected session %s to be revoked", session.ID)
+		}
+	}
+	remember, _ := mod.remember.(*SQLiteSessionStore)
+	if remember == nil {
+		t.Fatal("expected the SQLite store to keep remember-me tokens")
+	}
+	var tokens int
+	if err := remember.db.QueryRow(`SELECT COUNT(*) FROM remember_tokens`).Scan(&tokens); err != nil || tokens != 0 {
+		t.Errorf("expected remember-me tokens to be revoked, got %d (%v)", tokens, err)
+	}
+}
+
+func TestModule_LoginToken(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "sessions.db")))
+	app := chassis.New(chassis.WithModules(usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if _, err := usersMod.Create(ctx, "ann@example.com", "password123"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := mod.LoginToken(ctx, "ann@example.com", "wrong"); chassis.ErrorCodeOf(err) != chassis.CodeUnauthenticated {
+		t.Errorf("expected an unauthenticated error, got %v", err)
+	}
+	session, err := mod.LoginToken(ctx, "ann@example.com", "password123")
+	if err != nil {
+		t.Fatalf("LoginToken failed: %v", err)
+	}
+	got, err := mod.SessionByToken(ctx, session.Token)
+	if err != nil || got.UserID != session.UserID {
+		t.Fatalf("expected the token's session, got %v, %v", got, err)
+	}
+
+	if err := mod.LogoutToken(ctx, session.Token); err != nil {
+		t.Fatalf("LogoutToken failed: %v", err)
+	}
+	if _, err := mod.SessionByToken(ctx, session.Token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expected ErrInvalidSession after logout, got %v", err)
+	}
+}
+
+func TestModule_LoginHistory(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "sessions.db")), WithLoginHistoryRetention(time.Hour))
+	app := chassis.New(chassis.WithModules(events.New(), usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := WithClientInfo(context.Background(), ClientInfo{IP: "198.51.100.9", UserAgent: "curl/8.0"})
+
+	var mu sync.Mutex
+	var failures []*LoginFailedEvent
+	app.Events().Subscribe(EventLoginFailed, func(ctx context.Context, eventType string, payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, payload.(*LoginFailedEvent))
+	})
+
+	created, err := usersMod.Create(ctx, "ann@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	userID := created.(*users.User).ID
+	_, _ = mod.LoginToken(ctx, "ann@example.com", "wrong")
+	_, _ = mod.LoginToken(ctx, "nobody@example.com", "wrong")
+	session, err := mod.LoginToken(ctx, "ann@example.com", "password123")
+	if err != nil {
+		t.Fatalf("LoginToken failed: %v", err)
+	}
+
+	result, err := mod.loginHistory(ctx, userID, pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatalf("LoginHistory failed: %v", err)
+	}
+	if result.Total != 2 || len(result.Items) != 2 {
+		t.Fatalf("expected the user's two attempts, got %+v", result)
+	}
+	latest, failed := result.Items[0], result.Items[1]
+	if latest.Outcome != OutcomeSuccess || latest.SessionID != session.ID || latest.IP != "198.51.100.9" || latest.UserAgent != "curl/8.0" {
+		t.Errorf("unexpected successful attempt %+v", latest)
+	}
+	if failed.Outcome != OutcomeFailure || failed.Reason == "" || failed.Email != "ann@example.com" {
+		t.Errorf("unexpected failed attempt %+v", failed)
+	}
+	if _, err := app.Auth().LoginHistory(ctx, userID, 1); err == nil {
+		t.Error("expected an error for a page that isn't a pagination.Request")
+	}
+
+	mu.Lock()
+	if len(failures) != 2 || failures[0].UserID != userID || failures[0].IP != "198.51.100.9" || failures[1].UserID != "" {
+		t.Errorf("unexpected login_failed events %+v", failures)
+	}
+	mu.Unlock()
+
+	mod.sweep(ctx, time.Now().Add(2*time.Hour))
+	if count, err := mod.history.CountAttempts(ctx, userID); err != nil || count != 0 {
+		t.Errorf("expected the sweep to prune old attempts, got %d, %v", count, err)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	document, err := parseXML([]byte(`<samlp:Response xmlns:samlp="urn:p" xmlns:saml="urn:a" xmlns:unused="urn:u" ID="r">` +
+		`<saml:Assertion Version="2.0" b:x="1" xmlns:b="urn:b" IssueInstant="t" ID="a">` +
+		`<saml:Issuer>idp &amp; co &gt;</saml:Issuer><e a="&quot;&#9;"/><f xmlns="urn:f"><g xmlns=""/></f>` +
+		`</saml:Assertion></samlp:Response>`))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	assertion := document.child("urn:a", "Assertion")
+	tests := []struct {
+		inclusive []string
+		skip      *xmlNode
+		want      string
+	}{
+		{nil, nil, `<saml:Assertion xmlns:b="urn:b" xmlns:saml="urn:a" ID="a" IssueInstant="t" Version="2.0" b:x="1">` +
+			`<saml:Issuer>idp &amp; co &gt;</saml:Issuer><e a="&quot;&#x9;"></e><f xmlns="urn:f"><g xmlns=""></g></f></saml:Assertion>`},
+		{[]string{"unused"}, assertion.elements()[1], `<saml:Assertion xmlns:b="urn:b" xmlns:saml="urn:a" xmlns:unused="urn:u" ID="a" IssueInstant="t" Version="2.0" b:x="1">` +
+			`<saml:Issuer>idp &amp; co &gt;</saml:Issuer><f xmlns="urn:f"><g xmlns=""></g></f></saml:Assertion>`},
+	}
+	for _, tt := range tests {
+		if got := string(canonicalize(assertion, tt.inclusive, tt.skip)); got != tt.want {
+			t.Errorf("canonicalize(%v) =\n%s\nwant\n%s", tt.inclusive, got, tt.want)
+		}
+	}
+
+	if _, err := parseXML([]byte(`<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`)); err == nil {
+		t.Error("expected a DOCTYPE to be refused")
+	}
+}
+
+// testIdP signs SAML responses like an identity provider.
+type testIdP struct {
+	key         *rsa.PrivateKey
+	certificate string // base64 DER
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	return &testIdP{key: key, certificate: base64.StdEncoding.EncodeToString(der)}
+}
+
+func (idp *testIdP) metadata() []byte {
+	return []byte(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>` + idp.certificate + `</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso?app=1"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`)
+}
+
+// response returns a base64 SAMLResponse for nameID answering requestID,
+// with the assertion signed.
+func (idp *testIdP) response(t *testing.T, acsURL, requestID, nameID string) string {
+	t.Helper()
+	now := time.Now().UTC()
+	assertion := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `">` +
+		`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+		`<saml:Subject><saml:NameID>` + nameID + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData InResponseTo="` + requestID +
+		`" Recipient="` + acsURL + `" NotOnOrAfter="` + now.Add(5*time.Minute).Format(time.RFC3339) + `"/></saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(time.RFC3339) + `" NotOnOrAfter="` + now.Add(5*time.Minute).Format(time.RFC3339) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>https://app.example.com/sso</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="displayName"><saml:AttributeValue>Ann Lee</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="department"><saml:AttributeValue>R&amp;D</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement></saml:Assertion>`
+
+	node, err := parseXML([]byte(assertion))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	digest := sha256.Sum256(canonicalize(node, nil, nil))
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#_a1"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	signedNode, err := parseXML([]byte(signedInfo))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	hashed := sha256.Sum256(canonicalize(signedNode, nil, nil))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15 failed: %v", err)
+	}
+	signed := strings.Replace(assertion, `</saml:Issuer>`, `</saml:Issuer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`+
+		signedInfo+`<ds:SignatureValue>`+base64.StdEncoding.EncodeToString(signature)+`</ds:SignatureValue></ds:Signature>`, 1)
+
+	response := `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_r1" Version="2.0" Destination="` + acsURL +
+		`" InResponseTo="` + requestID + `"><samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		signed + `</samlp:Response>`
+	return base64.StdEncoding.EncodeToString([]byte(response))
+}
+
+func TestParseIdPMetadata(t *testing.T) {
+	idp := newTestIdP(t)
+	metadata, err := ParseIdPMetadata(idp.metadata())
+	if err != nil {
+		t.Fatalf("ParseIdPMetadata failed: %v", err)
+	}
+	if metadata.EntityID != "https://idp.example.com" || metadata.SSOURL != "https://idp.example.com/sso?app=1" ||
+		!slices.Equal(metadata.Certificates, []string{idp.certificate}) {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	if _, err := ParseIdPMetadata([]byte(`<EntityDescriptor entityID="x"/>`)); !errors.Is(err, ErrInvalidIdPMetadata) {
+		t.Errorf("expected ErrInvalidIdPMetadata, got %v", err)
+	}
+}
+
+func TestModule_SSO(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "sessions.db")), WithSSO("https://app.example.com/sso/"))
+	app := chassis.New(chassis.WithModules(events.New(), usersMod, orgsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var logins []*SSOLoginEvent
+	var failures []*SSOLoginFailedEvent
+	app.Events().Subscribe(EventSSOLogin, func(ctx context.Context, eventType string, payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logins = append(logins, payload.(*SSOLoginEvent))
+	})
+	app.Events().Subscribe(EventSSOLoginFailed, func(ctx context.Context, eventType string, payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, payload.(*SSOLoginFailedEvent))
+	})
+
+	created, err := orgsMod.Create(ctx, orgs.CreateInput{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	orgID := created.(*orgs.Org).ID()
+	idp := newTestIdP(t)
+	if _, err := mod.ConfigureSSO(ctx, orgID, SSOInput{Metadata: []byte("<nope/>")}); chassis.ErrorCodeOf(err) != chassis.CodeInvalidArgument {
+		t.Errorf("expected invalid metadata to be rejected, got %v", err)
+	}
+	if _, err := mod.ConfigureSSO(ctx, "missing", SSOInput{Metadata: idp.metadata()}); chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+		t.Errorf("expected an unknown organization to be rejected, got %v", err)
+	}
+	if _, err := mod.ConfigureSSO(ctx, orgID, SSOInput{
+		Metadata:         idp.metadata(),
+		NameAttribute:    "displayName",
+		AttributeMapping: map[string]string{"department": "department"},
+		Domains:          []string{"Example.com"},
+		Required:         true,
+	}); err != nil {
+		t.Fatalf("ConfigureSSO failed: %v", err)
+	}
+	if stored, err := mod.GetSSOConnection(ctx, orgID); err != nil || stored.IdPEntityID != "https://idp.example.com" ||
+		stored.Role != "member" || !slices.Equal(stored.Domains, []string{"example.com"}) || stored.AttributeMapping["department"] != "department" {
+		t.Fatalf("unexpected stored connection %+v, %v", stored, err)
+	}
+
+	handler := mod.SSOHandler()
+	acsURL := "https://app.example.com/sso/" + orgID + "/acs"
+	metadata := httptest.NewRecorder()
+	handler.ServeHTTP(metadata, httptest.NewRequest(http.MethodGet, "/sso/"+orgID+"/metadata", nil))
+	if metadata.Code != http.StatusOK || !strings.Contains(metadata.Body.String(), `Location="`+acsURL+`"`) {
+		t.Errorf("unexpected SP metadata %d %s", metadata.Code, metadata.Body.String())
+	}
+
+	// login starts an AuthnRequest and redirects to the IdP
+	login := httptest.NewRecorder()
+	handler.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/sso/"+orgID+"/login?return_to=/dashboard", nil))
+	target, err := url.Parse(login.Header().Get("Location"))
+	if login.Code != http.StatusFound || err != nil || target.Host != "idp.example.com" || target.Query().Get("app") != "1" {
+		t.Fatalf("expected a redirect to the IdP, got %d %q", login.Code, login.Header().Get("Location"))
+	}
+	deflated, _ := base64.StdEncoding.DecodeString(target.Query().Get("SAMLRequest"))
+	inflated, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatalf("invalid SAMLRequest: %v", err)
+	}
+	request, err := parseXML(inflated)
+	if err != nil || !request.is(samlProtocolNS, "AuthnRequest") || request.attr("AssertionConsumerServiceURL") != acsURL {
+		t.Fatalf("unexpected AuthnRequest %s", inflated)
+	}
+	requestID := request.attr("ID")
+
+	acs := func(samlResponse string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		post := httptest.NewRequest(http.MethodPost, "/sso/"+orgID+"/acs", strings.NewReader(url.Values{"SAMLResponse": {samlResponse}}.Encode()))
+		post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler.ServeHTTP(recorder, post)
+		return recorder
+	}
+	response := idp.response(t, acsURL, requestID, "ann@example.com")
+	decoded, _ := base64.StdEncoding.DecodeString(response)
+	tampered := base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(decoded), "Ann Lee", "Mallory", 1)))
+	if recorder := acs(tampered); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected a tampered assertion to be rejected, got %d", recorder.Code)
+	}
+	recorder := acs(response)
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("expected a redirect back, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := acs(response); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected a replayed response to be rejected, got %d", recorder.Code)
+	}
+
+	var cookie *http.Cookie
+	for _, candidate := range recorder.Result().Cookies() {
+		if candidate.Name == "session" {
+			cookie = candidate
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected a session cookie")
+	}
+	session, err := mod.SessionByToken(ctx, cookie.Value)
+	if err != nil {
+		t.Fatalf("SessionByToken failed: %v", err)
+	}
+	user, err := usersMod.GetByID(ctx, session.UserID)
+	if err != nil {
+		t.Fatalf("expected the user to be created: %v", err)
+	}
+	if ann := user.(*users.User); ann.Email != "ann@example.com" || ann.Name != "Ann Lee" || ann.Metadata["department"] != "R&D" {
+		t.Errorf("unexpected user %+v", ann)
+	}
+	if role := orgsMod.GetUserRole(ctx, orgID, session.UserID); role != "member" {
+		t.Errorf("expected the user to join the organization, got role %q", role)
+	}
+	mu.Lock()
+	if len(logins) != 1 || !logins[0].Created || logins[0].UserID != session.UserID || len(failures) != 2 {
+		t.Errorf("unexpected SSO events %+v %+v", logins, failures)
+	}
+	mu.Unlock()
+
+	// Members can't log in with a password while SSO is required
+	bob, err := usersMod.Create(ctx, "bob@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := mod.LoginToken(ctx, "bob@example.com", "password123"); err != nil {
+		t.Fatalf("expected non-members to log in, got %v", err)
+	}
+	if _, err := orgsMod.AddMember(ctx, orgID, bob.(*users.User).ID, "member"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	if _, err := mod.LoginToken(ctx, "bob@example.com", "password123"); !errors.Is(err, ErrSSORequired) {
+		t.Errorf("expected ErrSSORequired, got %v", err)
+	}
+	if err := mod.RemoveSSO(ctx, orgID); err != nil {
+		t.Fatalf("RemoveSSO failed: %v", err)
+	}
+	if _, err := mod.LoginToken(ctx, "bob@example.com", "password123"); err != nil {
+		t.Errorf("expected password logins once SSO is removed, got %v", err)
+	}
+	if _, err := mod.SSOLoginURL(ctx, orgID, "/"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("expected ErrSSONotConfigured, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// sessionLister is implemented by stores that can list every session.
+// The SQLite store implements it; custom stores without it are not checked.
+type sessionLister interface {
+	List(ctx context.Context) ([]*Session, error)
+}
+
+// Check finds expired sessions that were never cleaned up and sessions
+// belonging to users that no longer exist. Implements chassis.Checker.
+func (mod *Module) Check(ctx context.Context) ([]chassis.Issue, error) {
+	lister, ok := mod.store.(sessionLister)
+	if !ok {
+		return nil, nil
+	}
+	sessions, err := lister.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	usersMod, checkUsers := mod.app.TryUsers()
+	userExists := make(map[string]bool)
+	now := time.Now()
+
+	var issues []chassis.Issue
+	for _, session := range sessions {
+		if now.After(session.ExpiresAt) {
+			issues = append(issues, mod.staleSession(session, "expired_session", "session expired at "+session.ExpiresAt.Format(time.RFC3339)))
+			continue
+		}
+
+		if !checkUsers {
+			continue
+		}
+		exists, seen := userExists[session.UserID]
+		if !seen {
+			_, err := usersMod.GetByID(ctx, session.UserID)
+			if err != nil && chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+				return nil, err
+			}
+			exists = err == nil
+			userExists[session.UserID] = exists
+		}
+		if !exists {
+			issues = append(issues, mod.staleSession(session, "orphaned_session", "user "+session.UserID+" does not exist"))
+		}
+	}
+	return issues, nil
+}
+
+func (mod *Module) staleSession(session *Session, kind, reason string) chassis.Issue {
+	sessionID := session.ID
+	return chassis.Issue{
+		Module:   mod.Name(),
+		Kind:     kind,
+		Resource: sessionID,
+		Message:  fmt.Sprintf("session %s: %s", sessionID, reason),
+		Repair:   "delete session " + sessionID,
+		Fix: func(ctx context.Context) error {
+			return mod.store.Delete(ctx, sessionID)
+		},
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// loginForgetter is implemented by known login stores that can forget a
+// user. Both built-in stores implement it.
+type loginForgetter interface {
+	ForgetUser(ctx context.Context, userID string) error
+}
+
+// impersonationDeleter is implemented by session stores that can delete
+// the sessions an admin impersonates users in. SQLiteSessionStore
+// implements it.
+type impersonationDeleter interface {
+	DeleteByImpersonatorID(ctx context.Context, adminUserID string) error
+}
+
+// userSessionLister is implemented by session stores that can list a user's
+// sessions. SQLiteSessionStore implements it.
+type userSessionLister interface {
+	ListByUserID(ctx context.Context, userID string) ([]*Session, error)
+}
+
+// PlanUserCleanup plans deleting the user's sessions, including the ones
+// they impersonate others in, remember-me tokens, known logins and login
+// history.
+// Implements chassis.UserCleaner.
+func (mod *Module) PlanUserCleanup(ctx context.Context, userID string) ([]chassis.CleanupAction, error) {
+	actions := []chassis.CleanupAction{{
+		Module:      mod.Name(),
+		Kind:        "sessions",
+		Resource:    userID,
+		Description: "delete sessions of user " + userID,
+		Apply: func(ctx context.Context) error {
+			return mod.store.DeleteByUserID(ctx, userID)
+		},
+	}}
+	if mod.remember != nil {
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "remember_tokens",
+			Resource:    userID,
+			Description: "delete remember-me tokens of user " + userID,
+			Apply: func(ctx context.Context) error {
+				return mod.remember.DeleteRememberTokensByUserID(ctx, userID)
+			},
+		})
+	}
+	if deleter, ok := mod.store.(impersonationDeleter); ok {
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "impersonations",
+			Resource:    userID,
+			Description: "delete sessions impersonated by user " + userID,
+			Apply: func(ctx context.Context) error {
+				return deleter.DeleteByImpersonatorID(ctx, userID)
+			},
+		})
+	}
+	if forgetter, ok := mod.knownLogins.(loginForgetter); ok {
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "known_logins",
+			Resource:    userID,
+			Description: "forget known login countries and devices of user " + userID,
+			Apply: func(ctx context.Context) error {
+				return forgetter.ForgetUser(ctx, userID)
+			},
+		})
+	}
+	if mod.history != nil {
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "login_history",
+			Resource:    userID,
+			Description: "delete login history of user " + userID,
+			Apply: func(ctx context.Context) error {
+				return mod.history.DeleteAttempts(ctx, userID)
+			},
+		})
+	}
+	return actions, nil
+}
+
+// exportedSession is an entry of sessions.json, without the token.
+type exportedSession struct {
+	ID             string    `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	IP             string    `json:"ip,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	Country        string    `json:"country,omitempty"`
+	City           string    `json:"city,omitempty"`
+	ImpersonatorID string    `json:"impersonator_id,omitempty"`
+}
+
+// ExportUser writes the user's sessions, without their tokens, to
+// sessions.json when the session store can list them, and their login
+// history to login_history.json. Implements chassis.UserExporter.
+func (mod *Module) ExportUser(ctx context.Context, userID string, export chassis.ExportWriter) error {
+	if lister, ok := mod.store.(userSessionLister); ok {
+		sessions, err := lister.ListByUserID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+		exported := make([]exportedSession, len(sessions))
+		for i, session := range sessions {
+			exported[i] = exportedSession{ID: session.ID, CreatedAt: session.CreatedAt, ExpiresAt: session.ExpiresAt,
+				IP: session.IP, UserAgent: session.UserAgent, Country: session.Country, City: session.City,
+				ImpersonatorID: session.ImpersonatorID}
+		}
+		if err := export.WriteJSON("sessions.json", exported); err != nil {
+			return err
+		}
+	}
+
+	attempts := make([]*LoginAttempt, 0)
+	req := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		page, err := mod.loginHistory(ctx, userID, req)
+		if err != nil {
+			return fmt.Errorf("failed to list login history: %w", err)
+		}
+		attempts = append(attempts, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	return export.WriteJSON("login_history.json", attempts)
+}
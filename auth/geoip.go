@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// EventSuspiciousLogin is published when a user logs in from a country or
+// device they haven't used before. Apps can turn it into a verification
+// email. The payload is a *SuspiciousLoginEvent.
+const EventSuspiciousLogin = "auth.suspicious_login"
+
+// Reasons reported in SuspiciousLoginEvent.Reasons.
+const (
+	ReasonNewCountry = "new_country"
+	ReasonNewDevice  = "new_device"
+)
+
+// SuspiciousLoginEvent is the payload of suspicious login events.
+type SuspiciousLoginEvent struct {
+	UserID    string
+	SessionID string
+	IP        string
+	Country   string
+	City      string
+	Device    string
+	Reasons   []string
+}
+
+// ClientInfo describes the client a login came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// WithClientInfo returns a context carrying info for Login to store on the
+// session. LoginRequest sets it from the request.
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoContextKey, info)
+}
+
+func clientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoContextKey).(ClientInfo)
+	return info
+}
+
+const clientInfoContextKey contextKey = "chassis_client_info"
+
+// ClientInfo returns the client IP and user agent of a request. The IP is
+// taken from RemoteAddr, or from the first X-Forwarded-For hop when the
+// module trusts proxy headers (auth.trust_proxy_headers).
+func (mod *Module) ClientInfo(request *http.Request) ClientInfo {
+	ip := request.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if mod.trustProxyHeaders {
+		if forwarded := request.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			ip = strings.TrimSpace(first)
+		}
+	}
+	return ClientInfo{IP: ip, UserAgent: request.UserAgent()}
+}
+
+// GeoLocation is where an IP address is located.
+type GeoLocation struct {
+	Country string // ISO 3166-1 alpha-2 code, e.g. "DE"
+	City    string
+}
+
+// GeoIPProvider resolves IP addresses to locations, e.g. with a MaxMind
+// database or a lookup API.
+type GeoIPProvider interface {
+	Lookup(ctx context.Context, ip string) (*GeoLocation, error)
+}
+
+// GeoIPFunc adapts a function to GeoIPProvider.
+type GeoIPFunc func(ctx context.Context, ip string) (*GeoLocation, error)
+
+func (fn GeoIPFunc) Lookup(ctx context.Context, ip string) (*GeoLocation, error) {
+	return fn(ctx, ip)
+}
+
+// locate resolves ip with the GeoIP provider. Private and loopback
+// addresses aren't looked up, and lookup failures are logged rather than
+// failing the login.
+func (mod *Module) locate(ctx context.Context, ip string) GeoLocation {
+	parsed := net.ParseIP(ip)
+	if mod.geoIP == nil || parsed == nil || parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsUnspecified() {
+		return GeoLocation{}
+	}
+	location, err := mod.geoIP.Lookup(ctx, ip)
+	if err != nil {
+		mod.app.Logger().Warn("geoip lookup failed", "ip", ip, "error", err)
+		return GeoLocation{}
+	}
+	if location == nil {
+		return GeoLocation{}
+	}
+	return *location
+}
+
+// KnownLoginStore remembers the countries and devices each user has logged
+// in from. SQLiteSessionStore implements it; other stores fall back to an
+// in-memory record.
+type KnownLoginStore interface {
+	// RecordLogin records a login and reports whether the country and
+	// device are new for the user. Neither is new on the user's first
+	// login, and empty values are never new.
+	RecordLogin(ctx context.Context, userID, country, device string) (newCountry, newDevice bool, err error)
+}
+
+// MemoryKnownLoginStore keeps known logins in process memory.
+type MemoryKnownLoginStore struct {
+	mu    sync.Mutex
+	users map[string]*knownLogins
+}
+
+type knownLogins struct {
+	countries map[string]bool
+	devices   map[string]bool
+}
+
+// NewMemoryKnownLoginStore creates an in-memory known login store.
+func NewMemoryKnownLoginStore() *MemoryKnownLoginStore {
+	return &MemoryKnownLoginStore{users: make(map[string]*knownLogins)}
+}
+
+func (store *MemoryKnownLoginStore) RecordLogin(ctx context.Context, userID, country, device string) (bool, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	known, ok := store.users[userID]
+	if !ok {
+		known = &knownLogins{countries: make(map[string]bool), devices: make(map[string]bool)}
+		store.users[userID] = known
+	}
+	seen := len(known.countries) > 0 || len(known.devices) > 0
+	newCountry := seen && country != "" && !known.countries[country]
+	newDevice := seen && device != "" && !known.devices[device]
+	if country != "" {
+		known.countries[country] = true
+	}
+	if device != "" {
+		known.devices[device] = true
+	}
+	return newCountry, newDevice, nil
+}
+
+// ForgetUser drops everything known about a user's logins.
+func (store *MemoryKnownLoginStore) ForgetUser(ctx context.Context, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.users, userID)
+	return nil
+}
+
+// checkSuspicious records the session's country and device and publishes
+// EventSuspiciousLogin when either is new for the user.
+func (mod *Module) checkSuspicious(ctx context.Context, session *Session) {
+	device := DeviceName(session.UserAgent)
+	newCountry, newDevice, err := mod.knownLogins.RecordLogin(ctx, session.UserID, session.Country, device)
+	if err != nil {
+		mod.app.Logger().Error("failed to record login", "user_id", session.UserID, "error", err)
+		return
+	}
+
+	var reasons []string
+	if newCountry {
+		reasons = append(reasons, ReasonNewCountry)
+	}
+	if newDevice {
+		reasons = append(reasons, ReasonNewDevice)
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	mod.app.PublishEvent(ctx, EventSuspiciousLogin, &SuspiciousLoginEvent{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		IP:        session.IP,
+		Country:   session.Country,
+		City:      session.City,
+		Device:    device,
+		Reasons:   reasons,
+	})
+}
+
+// DeviceName summarizes a user agent as browser and OS, e.g. "Firefox on
+// Linux", so that browser updates don't count as new devices. Unrecognized
+// agents are returned unchanged.
+func DeviceName(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	browser := firstMatch(userAgent, [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	})
+	system := firstMatch(userAgent, [][2]string{
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	})
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return userAgent
+	}
+}
+
+func firstMatch(userAgent string, patterns [][2]string) string {
+	for _, pattern := range patterns {
+		if strings.Contains(userAgent, pattern[0]) {
+			return pattern[1]
+		}
+	}
+	return ""
+}
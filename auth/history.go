@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// DefaultLoginHistoryRetention is how long login attempts are kept unless
+// WithLoginHistoryRetention or auth.login_history_retention says otherwise.
+const DefaultLoginHistoryRetention = 90 * 24 * time.Hour
+
+// Outcomes of a login attempt, reported in LoginAttempt.Outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// LoginAttempt is one password login, successful or not, as listed by
+// LoginHistory.
+type LoginAttempt struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id,omitempty"` // empty for unknown emails
+	Email     string    `json:"email"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"` // why a failed attempt failed
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	SessionID string    `json:"session_id,omitempty"` // the session a successful attempt started
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginHistoryStore records login attempts. SQLiteSessionStore implements
+// it; other stores fall back to an in-memory history.
+type LoginHistoryStore interface {
+	RecordAttempt(ctx context.Context, attempt *LoginAttempt) error
+	// ListAttempts returns a user's attempts, newest first.
+	ListAttempts(ctx context.Context, userID string, offset, limit int) ([]*LoginAttempt, error)
+	CountAttempts(ctx context.Context, userID string) (int, error)
+	DeleteAttempts(ctx context.Context, userID string) error
+	// PruneAttempts deletes the attempts made before cutoff and returns
+	// how many went.
+	PruneAttempts(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// WithLoginHistoryRetention sets how long login attempts are kept. The
+// sweep started by app.Run deletes older ones.
+func WithLoginHistoryRetention(retention time.Duration) Option {
+	return func(opts *Options) {
+		opts.LoginHistoryRetention = retention
+	}
+}
+
+// LoginHistory returns a page of a user's login attempts, newest first,
+// so users can review their account activity. page must be a
+// pagination.Request; the result is a *pagination.Result[*LoginAttempt].
+func (mod *Module) LoginHistory(ctx context.Context, userID string, page any) (any, error) {
+	req, ok := page.(pagination.Request)
+	if !ok {
+		return nil, fmt.Errorf("invalid page type: expected pagination.Request")
+	}
+	return mod.loginHistory(ctx, userID, req)
+}
+
+// loginHistory is the internal implementation.
+func (mod *Module) loginHistory(ctx context.Context, userID string, req pagination.Request) (*pagination.Result[*LoginAttempt], error) {
+	return db.Paginate(ctx, req,
+		func(ctx context.Context, offset, limit int) ([]*LoginAttempt, error) {
+			return mod.history.ListAttempts(ctx, userID, offset, limit)
+		},
+		func(ctx context.Context) (int, error) { return mod.history.CountAttempts(ctx, userID) },
+	)
+}
+
+// recordAttempt stores a login attempt. Failures are logged rather than
+// failing the login.
+func (mod *Module) recordAttempt(ctx context.Context, attempt *LoginAttempt) {
+	attempt.ID = generateID()
+	attempt.CreatedAt = time.Now()
+	if err := mod.history.RecordAttempt(ctx, attempt); err != nil {
+		mod.app.Logger().Error("failed to record login attempt", "user_id", attempt.UserID, "error", err)
+	}
+}
+
+// MemoryLoginHistoryStore keeps login attempts in process memory.
+type MemoryLoginHistoryStore struct {
+	mu       sync.Mutex
+	attempts []*LoginAttempt // oldest first
+}
+
+// NewMemoryLoginHistoryStore creates an in-memory login history store.
+func NewMemoryLoginHistoryStore() *MemoryLoginHistoryStore {
+	return &MemoryLoginHistoryStore{}
+}
+
+func (store *MemoryLoginHistoryStore) RecordAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	copied := *attempt
+	store.attempts = append(store.attempts, &copied)
+	return nil
+}
+
+func (store *MemoryLoginHistoryStore) ListAttempts(ctx context.Context, userID string, offset, limit int) ([]*LoginAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	attempts := make([]*LoginAttempt, 0)
+	for i := len(store.attempts) - 1; i >= 0; i-- {
+		if store.attempts[i].UserID != userID {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(attempts) == limit {
+			break
+		}
+		copied := *store.attempts[i]
+		attempts = append(attempts, &copied)
+	}
+	return attempts, nil
+}
+
+func (store *MemoryLoginHistoryStore) CountAttempts(ctx context.Context, userID string) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	count := 0
+	for _, attempt := range store.attempts {
+		if attempt.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (store *MemoryLoginHistoryStore) DeleteAttempts(ctx context.Context, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.attempts = slices.DeleteFunc(store.attempts, func(attempt *LoginAttempt) bool {
+		return attempt.UserID == userID
+	})
+	return nil
+}
+
+func (store *MemoryLoginHistoryStore) PruneAttempts(ctx context.Context, cutoff time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	before := len(store.attempts)
+	store.attempts = slices.DeleteFunc(store.attempts, func(attempt *LoginAttempt) bool {
+		return attempt.CreatedAt.Before(cutoff)
+	})
+	return before - len(store.attempts), nil
+}
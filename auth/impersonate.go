@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+var (
+	ErrImpersonationNotAllowed = chassis.NewError(chassis.CodePermissionDenied, "impersonation not allowed")
+	ErrImpersonationRestricted = chassis.NewError(chassis.CodePermissionDenied, "not available while impersonating a user")
+	ErrNotImpersonating        = chassis.NewError(chassis.CodeFailedPrecondition, "session is not impersonating a user")
+)
+
+// Impersonation events published when the events module is registered.
+// The payload is an *ImpersonationEvent.
+const (
+	EventImpersonationStarted = "auth.impersonation_started"
+	EventImpersonationStopped = "auth.impersonation_stopped"
+)
+
+// DefaultImpersonationTTL is how long impersonated sessions last unless
+// WithImpersonationTTL or auth.impersonation_ttl says otherwise.
+const DefaultImpersonationTTL = time.Hour
+
+// ImpersonationEvent is the payload of impersonation events.
+type ImpersonationEvent struct {
+	AdminUserID  string
+	TargetUserID string
+	SessionID    string
+}
+
+// ImpersonationCheck decides whether adminUserID may impersonate
+// targetUserID, returning an error to refuse.
+type ImpersonationCheck func(ctx context.Context, adminUserID, targetUserID string) error
+
+// WithImpersonationTTL sets how long impersonated sessions last.
+func WithImpersonationTTL(ttl time.Duration) Option {
+	return func(opts *Options) {
+		opts.ImpersonationTTL = ttl
+	}
+}
+
+// WithImpersonationCheck sets who may impersonate whom. Without one,
+// Impersonate trusts its caller to have checked the admin.
+//
+//	auth.WithImpersonationCheck(func(ctx context.Context, adminID, targetID string) error {
+//	    if !staff[adminID] {
+//	        return auth.ErrImpersonationNotAllowed
+//	    }
+//	    return nil
+//	})
+func WithImpersonationCheck(check ImpersonationCheck) Option {
+	return func(opts *Options) {
+		opts.ImpersonationCheck = check
+	}
+}
+
+// Impersonate starts a session in which adminUserID acts as targetUserID
+// and sets its cookie in place of the admin's. The session lasts the
+// impersonation TTL and records the admin in ImpersonatorID.
+func (mod *Module) Impersonate(ctx context.Context, writer http.ResponseWriter, adminUserID, targetUserID string) (*Session, error) {
+	if adminUserID == "" || adminUserID == targetUserID {
+		return nil, ErrImpersonationNotAllowed
+	}
+	if usersMod, ok := mod.app.TryUsers(); ok {
+		if _, err := usersMod.GetByID(ctx, targetUserID); err != nil {
+			return nil, err
+		}
+	}
+	if mod.canImpersonate != nil {
+		if err := mod.canImpersonate(ctx, adminUserID, targetUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := mod.newSession(ctx, targetUserID, mod.impersonationTTL)
+	if err != nil {
+		return nil, err
+	}
+	session.ImpersonatorID = adminUserID
+	if err := mod.issueSession(ctx, writer, session); err != nil {
+		return nil, err
+	}
+
+	mod.app.Logger().Info("impersonation started", "admin_user_id", adminUserID, "target_user_id", targetUserID, "session_id", session.ID)
+	mod.app.PublishEvent(ctx, EventImpersonationStarted, impersonationEvent(session))
+	return session, nil
+}
+
+// StopImpersonating ends the impersonated session of request and clears
+// its cookie. The admin's remember-me token, if they have one, signs them
+// back in as themselves on the next request. Sessions that aren't
+// impersonating fail with ErrNotImpersonating and are left alone.
+func (mod *Module) StopImpersonating(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	session, err := mod.GetSession(ctx, request)
+	if err != nil {
+		return err
+	}
+	if !session.Impersonated() {
+		return ErrNotImpersonating
+	}
+	return mod.endSession(ctx, writer, request)
+}
+
+// impersonationStopped records the end of an impersonated session.
+func (mod *Module) impersonationStopped(ctx context.Context, session *Session) {
+	mod.app.Logger().Info("impersonation stopped", "admin_user_id", session.ImpersonatorID, "target_user_id", session.UserID, "session_id", session.ID)
+	mod.app.PublishEvent(ctx, EventImpersonationStopped, impersonationEvent(session))
+}
+
+// RequireNotImpersonating returns middleware that refuses impersonated
+// sessions with a 403 error envelope, for endpoints only the user
+// themselves should reach, such as changing passwords or deleting the
+// account. Use it inside RequireAuth.
+func (mod *Module) RequireNotImpersonating(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if ImpersonatorFromContext(request.Context()) != "" {
+			api.WriteError(writer, request, ErrImpersonationRestricted)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// ImpersonatorFromContext returns the admin impersonating the session's
+// user, or "" if the session isn't impersonated (use after RequireAuth).
+func ImpersonatorFromContext(ctx context.Context) string {
+	if session := SessionFromContext(ctx); session != nil {
+		return session.ImpersonatorID
+	}
+	return ""
+}
+
+func impersonationEvent(session *Session) *ImpersonationEvent {
+	return &ImpersonationEvent{
+		AdminUserID:  session.ImpersonatorID,
+		TargetUserID: session.UserID,
+		SessionID:    session.ID,
+	}
+}
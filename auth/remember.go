@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventSessionResumed is published when a remember-me token starts a new
+// session. The payload is a *SessionEvent.
+const EventSessionResumed = "auth.session_resumed"
+
+// DefaultRememberTTL is how long remember-me tokens last unless
+// WithRememberTTL or auth.remember_ttl says otherwise.
+const DefaultRememberTTL = 30 * 24 * time.Hour
+
+// rememberGrace is how long a rotated token keeps working, so parallel
+// requests sent with the previous cookie aren't mistaken for theft.
+const rememberGrace = time.Minute
+
+// RememberToken is a long-lived token that starts new sessions once the
+// short one expires. The cookie holds "series.validator"; the validator
+// is stored hashed and replaced on every use.
+type RememberToken struct {
+	Series        string
+	UserID        string
+	ValidatorHash string
+	PreviousHash  string // validator hash before the last rotation
+	RotatedAt     time.Time
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// RememberStore persists remember-me tokens. SQLiteSessionStore implements
+// it; other session stores fall back to an in-memory store.
+type RememberStore interface {
+	SaveRememberToken(ctx context.Context, token *RememberToken) error
+	GetRememberToken(ctx context.Context, series string) (*RememberToken, error)
+	DeleteRememberToken(ctx context.Context, series string) error
+	DeleteRememberTokensByUserID(ctx context.Context, userID string) error
+}
+
+// MemoryRememberStore keeps remember-me tokens in process memory.
+type MemoryRememberStore struct {
+	mu     sync.Mutex
+	tokens map[string]RememberToken
+}
+
+// NewMemoryRememberStore creates an in-memory remember-me token store.
+func NewMemoryRememberStore() *MemoryRememberStore {
+	return &MemoryRememberStore{tokens: make(map[string]RememberToken)}
+}
+
+func (store *MemoryRememberStore) SaveRememberToken(ctx context.Context, token *RememberToken) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.tokens[token.Series] = *token
+	return nil
+}
+
+func (store *MemoryRememberStore) GetRememberToken(ctx context.Context, series string) (*RememberToken, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	token, ok := store.tokens[series]
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	return &token, nil
+}
+
+func (store *MemoryRememberStore) DeleteRememberToken(ctx context.Context, series string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.tokens, series)
+	return nil
+}
+
+func (store *MemoryRememberStore) DeleteRememberTokensByUserID(ctx context.Context, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for series, token := range store.tokens {
+		if token.UserID == userID {
+			delete(store.tokens, series)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired deletes the tokens that expired before now.
+func (store *MemoryRememberStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deleted := 0
+	for series, token := range store.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(store.tokens, series)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// WithRememberTTL sets how long remember-me tokens last.
+func WithRememberTTL(ttl time.Duration) Option {
+	return func(opts *Options) {
+		opts.RememberTTL = ttl
+	}
+}
+
+type rememberKey struct{}
+
+// WithRememberMe returns a context asking Login for a remember-me token
+// on top of the session, for a "keep me signed in" checkbox:
+//
+//	ctx := request.Context()
+//	if request.FormValue("remember_me") == "on" {
+//	    ctx = auth.WithRememberMe(ctx)
+//	}
+//	session, err := authMod.LoginRequest(w, request.WithContext(ctx), email, password)
+func WithRememberMe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rememberKey{}, true)
+}
+
+func rememberMeFromContext(ctx context.Context) bool {
+	remember, _ := ctx.Value(rememberKey{}).(bool)
+	return remember
+}
+
+// rememberCookieName is the name of the remember-me cookie.
+func (mod *Module) rememberCookieName() string {
+	return mod.cookieName + "_remember"
+}
+
+// issueRememberToken starts a remember-me series for userID and sets its
+// cookie.
+func (mod *Module) issueRememberToken(ctx context.Context, writer http.ResponseWriter, userID string) error {
+	series, err := generateToken(16)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	token := &RememberToken{
+		Series:    series,
+		UserID:    userID,
+		RotatedAt: now,
+		ExpiresAt: now.Add(mod.rememberTTL),
+		CreatedAt: now,
+	}
+	return mod.rotateRememberToken(ctx, writer, token)
+}
+
+// rotateRememberToken gives token a new validator, saves it and sets the
+// cookie.
+func (mod *Module) rotateRememberToken(ctx context.Context, writer http.ResponseWriter, token *RememberToken) error {
+	validator, err := generateToken(32)
+	if err != nil {
+		return err
+	}
+	token.ValidatorHash = hashRememberValidator(validator)
+	if err := mod.remember.SaveRememberToken(ctx, token); err != nil {
+		return err
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     mod.rememberCookieName(),
+		Value:    token.Series + "." + validator,
+		Path:     "/",
+		Expires:  token.ExpiresAt,
+		HttpOnly: true,
+		Secure:   mod.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// resumeSession starts a new session from the request's remember-me
+// cookie, rotating the token. A validator that doesn't match its series
+// means a stolen cookie was used: the series and the user's sessions are
+// deleted.
+func (mod *Module) resumeSession(ctx context.Context, writer http.ResponseWriter, request *http.Request) (*Session, error) {
+	cookie, err := request.Cookie(mod.rememberCookieName())
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	series, validator, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	token, err := mod.remember.GetRememberToken(ctx, series)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	now := time.Now()
+	if !now.Before(token.ExpiresAt) {
+		_ = mod.remember.DeleteRememberToken(ctx, series) // Best-effort cleanup
+		return nil, ErrInvalidSession
+	}
+
+	hash := hashRememberValidator(validator)
+	switch {
+	case hashesEqual(hash, token.ValidatorHash):
+		token.PreviousHash = token.ValidatorHash
+		token.RotatedAt = now
+		token.ExpiresAt = now.Add(mod.rememberTTL)
+		if err := mod.rotateRememberToken(ctx, writer, token); err != nil {
+			return nil, err
+		}
+	case hashesEqual(hash, token.PreviousHash) && now.Sub(token.RotatedAt) < rememberGrace:
+		// A parallel request with the previous cookie; the fresh one is on
+		// its way to the client
+	default:
+		mod.app.Logger().Warn("remember-me token reused, revoking sessions", "user_id", token.UserID, "series", series)
+		_ = mod.remember.DeleteRememberToken(ctx, series)
+		_ = mod.store.DeleteByUserID(ctx, token.UserID)
+		return nil, ErrInvalidSession
+	}
+
+	session, err := mod.newSession(ctx, token.UserID, mod.sessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.issueSession(ctx, writer, session); err != nil {
+		return nil, err
+	}
+
+	mod.app.PublishEvent(ctx, EventSessionResumed, &SessionEvent{UserID: session.UserID, SessionID: session.ID})
+	return session, nil
+}
+
+// forgetRememberToken deletes the request's remember-me token and clears
+// its cookie.
+func (mod *Module) forgetRememberToken(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	cookie, err := request.Cookie(mod.rememberCookieName())
+	if err != nil {
+		return nil
+	}
+	series, _, _ := strings.Cut(cookie.Value, ".")
+	if err := mod.remember.DeleteRememberToken(ctx, series); err != nil {
+		return err
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     mod.rememberCookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   mod.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func hashRememberValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashesEqual(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
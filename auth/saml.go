@@ -0,0 +1,820 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	_ "crypto/sha256" // registers crypto.SHA256
+	_ "crypto/sha512" // registers crypto.SHA512
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrInvalidSAMLResponse = chassis.NewError(chassis.CodeUnauthenticated, "invalid SAML response")
+	ErrInvalidIdPMetadata  = chassis.NewError(chassis.CodeInvalidArgument, "invalid IdP metadata")
+)
+
+// XML namespaces and algorithm identifiers of the SAML profile the service
+// provider implements.
+const (
+	samlAssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlProtocolNS  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlMetadataNS  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	dsigNS          = "http://www.w3.org/2000/09/xmldsig#"
+	xmlNS           = "http://www.w3.org/XML/1998/namespace"
+
+	samlRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlPostBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	excC14N            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+// signatureHashes and digestHashes are the signature and digest methods
+// accepted in signatures. SHA-1 is refused.
+var (
+	signatureHashes = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+	}
+	digestHashes = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+	}
+)
+
+// samlClockSkew is how far the IdP's clock may be from ours when checking
+// an assertion's validity window.
+const samlClockSkew = 3 * time.Minute
+
+// samlAssertion is what a verified SAML response asserts about the user.
+type samlAssertion struct {
+	RequestID  string // the AuthnRequest answered
+	NameID     string
+	Attributes map[string][]string
+}
+
+// attribute returns the first value of the named attribute, or "".
+func (assertion *samlAssertion) attribute(name string) string {
+	if values := assertion.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// samlProvider is the service provider side of one SSO connection.
+type samlProvider struct {
+	entityID   string
+	acsURL     string
+	connection *SSOConnection
+}
+
+// authnRequest returns a new AuthnRequest's ID and the URL sending it to
+// the IdP with the HTTP-Redirect binding.
+func (sp *samlProvider) authnRequest(now time.Time) (id, redirectURL string, err error) {
+	random := make([]byte, 20)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	id = "_" + hex.EncodeToString(random) // IDs must not start with a digit
+
+	request := struct {
+		XMLName         xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+		ID              string   `xml:",attr"`
+		Version         string   `xml:",attr"`
+		IssueInstant    string   `xml:",attr"`
+		Destination     string   `xml:",attr"`
+		ACSURL          string   `xml:"AssertionConsumerServiceURL,attr"`
+		ProtocolBinding string   `xml:",attr"`
+		Issuer          struct {
+			XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+			Value   string   `xml:",chardata"`
+		}
+	}{
+		ID:              id,
+		Version:         "2.0",
+		IssueInstant:    now.UTC().Format("2006-01-02T15:04:05Z"),
+		Destination:     sp.connection.SSOURL,
+		ACSURL:          sp.acsURL,
+		ProtocolBinding: samlPostBinding,
+	}
+	request.Issuer.Value = sp.entityID
+	document, err := xml.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := writer.Write(document); err != nil {
+		return "", "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+
+	target, err := url.Parse(sp.connection.SSOURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := target.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	target.RawQuery = query.Encode()
+	return id, target.String(), nil
+}
+
+// parseResponse verifies a base64 SAMLResponse and returns its assertion.
+// The response or its assertion must be signed by one of the connection's
+// certificates, and the assertion must be addressed to this service
+// provider and valid at now. The caller checks that it answers a request
+// of its own.
+func (sp *samlProvider) parseResponse(encoded string, now time.Time) (*samlAssertion, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, invalidResponse("SAMLResponse is not base64")
+	}
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, invalidResponse(err.Error())
+	}
+	if !response.is(samlProtocolNS, "Response") {
+		return nil, invalidResponse("not a SAML Response")
+	}
+	if status := response.child(samlProtocolNS, "Status").child(samlProtocolNS, "StatusCode").attr("Value"); status != samlStatusSuccess {
+		return nil, invalidResponse("IdP returned status " + status)
+	}
+	if destination := response.attr("Destination"); destination != "" && destination != sp.acsURL {
+		return nil, invalidResponse("response destination " + destination + " is not this service provider")
+	}
+	if response.child(samlAssertionNS, "EncryptedAssertion") != nil {
+		return nil, invalidResponse("encrypted assertions are not supported")
+	}
+	assertions := response.children(samlAssertionNS, "Assertion")
+	if len(assertions) != 1 {
+		return nil, invalidResponse("response must contain exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// Only what the verified signature covers is read from here on, so
+	// elements injected elsewhere can't be mistaken for the signed ones.
+	certificates, err := parseCertificates(sp.connection.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	signed := assertion
+	signature, err := enveloped(assertion)
+	if err == nil && signature == nil {
+		signed = response
+		signature, err = enveloped(response)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if signature == nil {
+		return nil, invalidResponse("neither the response nor the assertion is signed")
+	}
+	if err := verifySignature(signed, signature, certificates); err != nil {
+		return nil, err
+	}
+
+	if issuer := assertion.child(samlAssertionNS, "Issuer").text(); issuer != sp.connection.IdPEntityID {
+		return nil, invalidResponse("assertion issuer " + issuer + " is not the connection's IdP")
+	}
+	requestID, err := sp.checkSubject(assertion.child(samlAssertionNS, "Subject"), now)
+	if err != nil {
+		return nil, err
+	}
+	if err := sp.checkConditions(assertion.child(samlAssertionNS, "Conditions"), now); err != nil {
+		return nil, err
+	}
+
+	result := &samlAssertion{
+		RequestID:  requestID,
+		NameID:     assertion.child(samlAssertionNS, "Subject").child(samlAssertionNS, "NameID").text(),
+		Attributes: make(map[string][]string),
+	}
+	if result.NameID == "" {
+		return nil, invalidResponse("assertion has no NameID")
+	}
+	for _, statement := range assertion.children(samlAssertionNS, "AttributeStatement") {
+		for _, attribute := range statement.children(samlAssertionNS, "Attribute") {
+			name := attribute.attr("Name")
+			for _, value := range attribute.children(samlAssertionNS, "AttributeValue") {
+				result.Attributes[name] = append(result.Attributes[name], value.text())
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkSubject checks that a bearer subject confirmation is addressed to
+// this service provider and hasn't expired, and returns the ID of the
+// AuthnRequest it answers. Responses the IdP sends unprompted, without
+// one, are refused.
+func (sp *samlProvider) checkSubject(subject *xmlNode, now time.Time) (string, error) {
+	if subject == nil {
+		return "", invalidResponse("assertion has no subject")
+	}
+	for _, confirmation := range subject.children(samlAssertionNS, "SubjectConfirmation") {
+		data := confirmation.child(samlAssertionNS, "SubjectConfirmationData")
+		if confirmation.attr("Method") != samlBearer || data.attr("Recipient") != sp.acsURL {
+			continue
+		}
+		if data.attr("InResponseTo") == "" {
+			return "", invalidResponse("IdP-initiated sign-in is not supported")
+		}
+		if err := checkWindow(data.attr("NotBefore"), data.attr("NotOnOrAfter"), now); err != nil {
+			return "", err
+		}
+		return data.attr("InResponseTo"), nil
+	}
+	return "", invalidResponse("no bearer subject confirmation for this service provider")
+}
+
+// checkConditions checks the assertion's validity window and that this
+// service provider is in its audience.
+func (sp *samlProvider) checkConditions(conditions *xmlNode, now time.Time) error {
+	if conditions == nil {
+		return invalidResponse("assertion has no conditions")
+	}
+	if err := checkWindow(conditions.attr("NotBefore"), conditions.attr("NotOnOrAfter"), now); err != nil {
+		return err
+	}
+	for _, restriction := range conditions.children(samlAssertionNS, "AudienceRestriction") {
+		found := false
+		for _, audience := range restriction.children(samlAssertionNS, "Audience") {
+			found = found || audience.text() == sp.entityID
+		}
+		if !found {
+			return invalidResponse("assertion audience does not include " + sp.entityID)
+		}
+	}
+	return nil
+}
+
+// checkWindow checks that now, give or take the clock skew, is within the
+// NotBefore and NotOnOrAfter timestamps, either of which may be empty.
+func checkWindow(notBefore, notOnOrAfter string, now time.Time) error {
+	if notBefore != "" {
+		start, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return invalidResponse("invalid NotBefore " + notBefore)
+		}
+		if now.Add(samlClockSkew).Before(start) {
+			return invalidResponse("assertion is not valid yet")
+		}
+	}
+	if notOnOrAfter != "" {
+		end, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return invalidResponse("invalid NotOnOrAfter " + notOnOrAfter)
+		}
+		if !now.Add(-samlClockSkew).Before(end) {
+			return invalidResponse("assertion has expired")
+		}
+	}
+	return nil
+}
+
+// enveloped returns the Signature child of element, or nil if it has none.
+func enveloped(element *xmlNode) (*xmlNode, error) {
+	signatures := element.children(dsigNS, "Signature")
+	if len(signatures) > 1 {
+		return nil, invalidResponse("multiple signatures on " + element.local)
+	}
+	if len(signatures) == 0 {
+		return nil, nil
+	}
+	return signatures[0], nil
+}
+
+// verifySignature verifies signature, enveloped in element, with one of
+// certificates. The signature must reference element itself, with the
+// enveloped-signature and exclusive canonicalization transforms.
+func verifySignature(element, signature *xmlNode, certificates []*x509.Certificate) error {
+	signedInfo := signature.child(dsigNS, "SignedInfo")
+	if signedInfo == nil {
+		return invalidResponse("signature has no SignedInfo")
+	}
+	canonicalization := signedInfo.child(dsigNS, "CanonicalizationMethod")
+	if canonicalization.attr("Algorithm") != excC14N {
+		return invalidResponse("unsupported canonicalization method " + canonicalization.attr("Algorithm"))
+	}
+	signatureHash, ok := signatureHashes[signedInfo.child(dsigNS, "SignatureMethod").attr("Algorithm")]
+	if !ok {
+		return invalidResponse("unsupported signature method " + signedInfo.child(dsigNS, "SignatureMethod").attr("Algorithm"))
+	}
+
+	references := signedInfo.children(dsigNS, "Reference")
+	if len(references) != 1 {
+		return invalidResponse("signature must have exactly one reference")
+	}
+	reference := references[0]
+	if id := element.attr("ID"); id == "" || reference.attr("URI") != "#"+id {
+		return invalidResponse("signature does not reference the signed element")
+	}
+	var prefixes []string
+	excluded := false
+	for _, transform := range reference.child(dsigNS, "Transforms").children(dsigNS, "Transform") {
+		switch transform.attr("Algorithm") {
+		case envelopedSignature:
+		case excC14N:
+			excluded = true
+			prefixes = inclusivePrefixes(transform)
+		default:
+			return invalidResponse("unsupported transform " + transform.attr("Algorithm"))
+		}
+	}
+	if !excluded {
+		return invalidResponse("signature must use exclusive canonicalization")
+	}
+	digestHash, ok := digestHashes[reference.child(dsigNS, "DigestMethod").attr("Algorithm")]
+	if !ok {
+		return invalidResponse("unsupported digest method " + reference.child(dsigNS, "DigestMethod").attr("Algorithm"))
+	}
+
+	expected, err := decodeBase64(reference.child(dsigNS, "DigestValue").text())
+	if err != nil {
+		return invalidResponse("invalid digest value")
+	}
+	digest := digestHash.New()
+	digest.Write(canonicalize(element, prefixes, signature))
+	if subtle.ConstantTimeCompare(digest.Sum(nil), expected) != 1 {
+		return invalidResponse("digest mismatch")
+	}
+
+	signatureValue, err := decodeBase64(signature.child(dsigNS, "SignatureValue").text())
+	if err != nil {
+		return invalidResponse("invalid signature value")
+	}
+	hashed := signatureHash.New()
+	hashed.Write(canonicalize(signedInfo, inclusivePrefixes(canonicalization), nil))
+	sum := hashed.Sum(nil)
+	for _, certificate := range certificates {
+		publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(publicKey, signatureHash, sum, signatureValue) == nil {
+			return nil
+		}
+	}
+	return invalidResponse("signature is not from the IdP's certificate")
+}
+
+// inclusivePrefixes returns the PrefixList of an exclusive
+// canonicalization method's InclusiveNamespaces, "#default" meaning the
+// default namespace.
+func inclusivePrefixes(method *xmlNode) []string {
+	var prefixes []string
+	for _, child := range method.elements() {
+		if child.local != "InclusiveNamespaces" || child.space() != excC14N {
+			continue
+		}
+		for _, prefix := range strings.Fields(child.attr("PrefixList")) {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func invalidResponse(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSAMLResponse, reason)
+}
+
+func decodeBase64(value string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+}
+
+// parseCertificates parses certificates given as PEM or bare base64 DER,
+// as they appear in metadata.
+func parseCertificates(encoded []string) ([]*x509.Certificate, error) {
+	certificates := make([]*x509.Certificate, 0, len(encoded))
+	for _, value := range encoded {
+		der, err := decodeBase64(value)
+		if block, _ := pem.Decode([]byte(value)); block != nil {
+			der, err = block.Bytes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: certificate is not PEM or base64", ErrInvalidIdPMetadata)
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIdPMetadata, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// IdPMetadata is what ParseIdPMetadata reads from an identity provider's
+// SAML metadata.
+type IdPMetadata struct {
+	EntityID     string
+	SSOURL       string   // HTTP-Redirect single sign-on location
+	Certificates []string // base64 DER signing certificates
+}
+
+// ParseIdPMetadata reads the entity ID, single sign-on URL and signing
+// certificates from an identity provider's SAML metadata document, as
+// downloaded from Okta, Azure AD or Google Workspace.
+func ParseIdPMetadata(data []byte) (*IdPMetadata, error) {
+	type entityDescriptor struct {
+		EntityID string `xml:"entityID,attr"`
+		IDP      *struct {
+			Keys []struct {
+				Use          string   `xml:"use,attr"`
+				Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+			} `xml:"KeyDescriptor"`
+			Services []struct {
+				Binding  string `xml:"Binding,attr"`
+				Location string `xml:"Location,attr"`
+			} `xml:"SingleSignOnService"`
+		} `xml:"IDPSSODescriptor"`
+	}
+	var document struct {
+		XMLName xml.Name
+		entityDescriptor
+		Entities []entityDescriptor `xml:"EntityDescriptor"`
+	}
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdPMetadata, err)
+	}
+	if document.XMLName.Space != samlMetadataNS {
+		return nil, fmt.Errorf("%w: not a SAML metadata document", ErrInvalidIdPMetadata)
+	}
+	entities := append([]entityDescriptor{document.entityDescriptor}, document.Entities...)
+
+	for _, entity := range entities {
+		if entity.IDP == nil {
+			continue
+		}
+		metadata := &IdPMetadata{EntityID: entity.EntityID}
+		for _, service := range entity.IDP.Services {
+			if service.Binding == samlRedirectBinding {
+				metadata.SSOURL = strings.TrimSpace(service.Location)
+				break
+			}
+		}
+		for _, key := range entity.IDP.Keys {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+			for _, certificate := range key.Certificates {
+				certificate = strings.Join(strings.Fields(certificate), "")
+				if certificate != "" && !slices.Contains(metadata.Certificates, certificate) {
+					metadata.Certificates = append(metadata.Certificates, certificate)
+				}
+			}
+		}
+		if metadata.SSOURL == "" {
+			return nil, fmt.Errorf("%w: no HTTP-Redirect single sign-on service", ErrInvalidIdPMetadata)
+		}
+		if len(metadata.Certificates) == 0 {
+			return nil, fmt.Errorf("%w: no signing certificate", ErrInvalidIdPMetadata)
+		}
+		return metadata, nil
+	}
+	return nil, fmt.Errorf("%w: no IDPSSODescriptor", ErrInvalidIdPMetadata)
+}
+
+// spMetadata returns the service provider's SAML metadata document, for
+// the IdP administrator to register it with.
+func (sp *samlProvider) spMetadata() ([]byte, error) {
+	type acs struct {
+		Binding   string `xml:",attr"`
+		Location  string `xml:",attr"`
+		Index     int    `xml:"index,attr"`
+		IsDefault bool   `xml:"isDefault,attr"`
+	}
+	document := struct {
+		XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+		EntityID string   `xml:"entityID,attr"`
+		SP       struct {
+			AuthnRequestsSigned  bool   `xml:",attr"`
+			WantAssertionsSigned bool   `xml:",attr"`
+			Protocols            string `xml:"protocolSupportEnumeration,attr"`
+			ACS                  acs    `xml:"AssertionConsumerService"`
+		} `xml:"SPSSODescriptor"`
+	}{EntityID: sp.entityID}
+	document.SP.WantAssertionsSigned = true
+	document.SP.Protocols = samlProtocolNS
+	document.SP.ACS = acs{Binding: samlPostBinding, Location: sp.acsURL, IsDefault: true}
+
+	output, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), output...), nil
+}
+
+// xmlNode is an element of a parsed XML document, keeping the namespace
+// prefixes and declarations canonicalization needs.
+type xmlNode struct {
+	parent     *xmlNode
+	prefix     string
+	local      string
+	namespaces map[string]string // declared on this element; "" is the default namespace
+	attrs      []xmlAttr
+	content    []any // *xmlNode and string character data
+}
+
+type xmlAttr struct {
+	prefix, local, value string
+}
+
+// parseXML parses a document into a tree. Documents with a DOCTYPE or
+// other directives are refused.
+func parseXML(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *xmlNode
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{parent: current, prefix: token.Name.Space, local: token.Name.Local}
+			for _, attr := range token.Attr {
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					node.declare("", attr.Value)
+				case attr.Name.Space == "xmlns":
+					node.declare(attr.Name.Local, attr.Value)
+				default:
+					node.attrs = append(node.attrs, xmlAttr{attr.Name.Space, attr.Name.Local, attr.Value})
+				}
+			}
+			switch {
+			case current != nil:
+				current.content = append(current.content, node)
+			case root != nil:
+				return nil, errors.New("XML document has several root elements")
+			default:
+				root = node
+			}
+			current = node
+		case xml.EndElement:
+			if current == nil || token.Name.Space != current.prefix || token.Name.Local != current.local {
+				return nil, errors.New("XML end element does not match its start")
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.content = append(current.content, string(token))
+			} else if len(bytes.TrimSpace(token)) > 0 {
+				return nil, errors.New("XML text outside the root element")
+			}
+		case xml.Directive:
+			return nil, errors.New("XML directives are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("XML document is incomplete")
+	}
+	return root, nil
+}
+
+func (node *xmlNode) declare(prefix, uri string) {
+	if node.namespaces == nil {
+		node.namespaces = make(map[string]string)
+	}
+	node.namespaces[prefix] = uri
+}
+
+// lookup returns the namespace bound to prefix where node is.
+func (node *xmlNode) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNS, true
+	}
+	for scope := node; scope != nil; scope = scope.parent {
+		if uri, ok := scope.namespaces[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", prefix == ""
+}
+
+// space returns the element's namespace.
+func (node *xmlNode) space() string {
+	uri, _ := node.lookup(node.prefix)
+	return uri
+}
+
+// is reports whether the element has the given namespace and local name.
+func (node *xmlNode) is(space, local string) bool {
+	return node != nil && node.local == local && node.space() == space
+}
+
+// attr returns the value of an unprefixed attribute, or "". It is safe to
+// call on a nil node, as are the other lookups, so paths of them can be
+// chained.
+func (node *xmlNode) attr(local string) string {
+	if node == nil {
+		return ""
+	}
+	for _, attr := range node.attrs {
+		if attr.prefix == "" && attr.local == local {
+			return attr.value
+		}
+	}
+	return ""
+}
+
+// elements returns the child elements.
+func (node *xmlNode) elements() []*xmlNode {
+	if node == nil {
+		return nil
+	}
+	var elements []*xmlNode
+	for _, item := range node.content {
+		if child, ok := item.(*xmlNode); ok {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// children returns the child elements with the given name.
+func (node *xmlNode) children(space, local string) []*xmlNode {
+	var matched []*xmlNode
+	for _, child := range node.elements() {
+		if child.is(space, local) {
+			matched = append(matched, child)
+		}
+	}
+	return matched
+}
+
+// child returns the first child element with the given name, or nil.
+func (node *xmlNode) child(space, local string) *xmlNode {
+	if matched := node.children(space, local); len(matched) > 0 {
+		return matched[0]
+	}
+	return nil
+}
+
+// text returns the element's character data, trimmed.
+func (node *xmlNode) text() string {
+	if node == nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, item := range node.content {
+		if data, ok := item.(string); ok {
+			text.WriteString(data)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// canonicalize returns the exclusive canonical form (exc-c14n, without
+// comments) of node's subtree, leaving out the element skip, as the
+// enveloped-signature transform does. inclusive lists the prefixes of an
+// InclusiveNamespaces PrefixList.
+func canonicalize(node *xmlNode, inclusive []string, skip *xmlNode) []byte {
+	var output bytes.Buffer
+	writeCanonical(&output, node, map[string]string{}, inclusive, skip)
+	return output.Bytes()
+}
+
+func writeCanonical(output *bytes.Buffer, node *xmlNode, rendered map[string]string, inclusive []string, skip *xmlNode) {
+	// Declare the namespaces the element and its attributes use, and the
+	// inclusive ones in scope, unless an output ancestor already did.
+	used := append([]string{node.prefix}, inclusive...)
+	for _, attr := range node.attrs {
+		if attr.prefix != "" {
+			used = append(used, attr.prefix)
+		}
+	}
+	type declaration struct{ prefix, uri string }
+	var declarations []declaration
+	scope := rendered
+	for _, prefix := range used {
+		if prefix == "xml" || slices.ContainsFunc(declarations, func(d declaration) bool { return d.prefix == prefix }) {
+			continue
+		}
+		uri, ok := node.lookup(prefix)
+		if !ok || prefix != "" && uri == "" {
+			continue
+		}
+		if current, ok := rendered[prefix]; ok && current == uri || !ok && uri == "" {
+			continue
+		}
+		if len(declarations) == 0 {
+			scope = make(map[string]string, len(rendered)+1)
+			for key, value := range rendered {
+				scope[key] = value
+			}
+		}
+		declarations = append(declarations, declaration{prefix, uri})
+		scope[prefix] = uri
+	}
+	slices.SortFunc(declarations, func(a, b declaration) int { return strings.Compare(a.prefix, b.prefix) })
+
+	type attribute struct {
+		space string
+		xmlAttr
+	}
+	attrs := make([]attribute, len(node.attrs))
+	for i, attr := range node.attrs {
+		space := ""
+		if attr.prefix != "" {
+			space, _ = node.lookup(attr.prefix)
+		}
+		attrs[i] = attribute{space, attr}
+	}
+	slices.SortFunc(attrs, func(a, b attribute) int {
+		if order := strings.Compare(a.space, b.space); order != 0 {
+			return order
+		}
+		return strings.Compare(a.local, b.local)
+	})
+
+	name := qualifiedName(node.prefix, node.local)
+	output.WriteString("<" + name)
+	for _, declaration := range declarations {
+		output.WriteString(" " + qualifiedName("xmlns", declaration.prefix) + `="`)
+		escapeCanonical(output, declaration.uri, true)
+		output.WriteString(`"`)
+	}
+	for _, attr := range attrs {
+		output.WriteString(" " + qualifiedName(attr.prefix, attr.local) + `="`)
+		escapeCanonical(output, attr.value, true)
+		output.WriteString(`"`)
+	}
+	output.WriteString(">")
+	for _, item := range node.content {
+		switch item := item.(type) {
+		case string:
+			escapeCanonical(output, item, false)
+		case *xmlNode:
+			if item != skip {
+				writeCanonical(output, item, scope, inclusive, skip)
+			}
+		}
+	}
+	output.WriteString("</" + name + ">")
+}
+
+func qualifiedName(prefix, local string) string {
+	switch {
+	case prefix == "":
+		return local
+	case prefix == "xmlns" && local == "":
+		return "xmlns"
+	default:
+		return prefix + ":" + local
+	}
+}
+
+// escapeCanonical writes text escaped as canonical XML requires for
+// attribute values or character data.
+func escapeCanonical(output *bytes.Buffer, text string, attribute bool) {
+	for _, r := range text {
+		switch {
+		case r == '&':
+			output.WriteString("&amp;")
+		case r == '<':
+			output.WriteString("&lt;")
+		case r == '>' && !attribute:
+			output.WriteString("&gt;")
+		case r == '"' && attribute:
+			output.WriteString("&quot;")
+		case r == '\t' && attribute:
+			output.WriteString("&#x9;")
+		case r == '\n' && attribute:
+			output.WriteString("&#xA;")
+		case r == '\r':
+			output.WriteString("&#xD;")
+		default:
+			output.WriteRune(r)
+		}
+	}
+}
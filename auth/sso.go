@@ -0,0 +1,591 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/users"
+)
+
+var (
+	ErrSSONotConfigured     = chassis.NewError(chassis.CodeNotFound, "single sign-on is not configured for the organization")
+	ErrSSORequired          = chassis.NewError(chassis.CodePermissionDenied, "organization requires single sign-on")
+	ErrSSODisabled          = chassis.NewError(chassis.CodeFailedPrecondition, "single sign-on is disabled; set auth.sso.base_url")
+	ErrInvalidSSOConnection = chassis.NewError(chassis.CodeInvalidArgument, "SSO connection needs an IdP entity ID, an SSO URL and a certificate")
+	ErrUnknownSSORequest    = chassis.NewError(chassis.CodeUnauthenticated, "unknown or expired single sign-on request")
+)
+
+// SSO events published when the events module is registered, for audit
+// logs. Configuration events carry an *SSOConfigEvent, sign-ins an
+// *SSOLoginEvent and rejected responses an *SSOLoginFailedEvent. A
+// successful sign-in also publishes auth.login.
+const (
+	EventSSOConfigured  = "auth.sso_configured"
+	EventSSORemoved     = "auth.sso_removed"
+	EventSSOLogin       = "auth.sso_login"
+	EventSSOLoginFailed = "auth.sso_login_failed"
+)
+
+// ssoRequestTTL is how long a user has to sign in at the IdP.
+const ssoRequestTTL = 10 * time.Minute
+
+// SSOConfigEvent is the payload of SSO configuration events.
+type SSOConfigEvent struct {
+	OrgID       string
+	IdPEntityID string
+	Required    bool
+}
+
+// SSOLoginEvent is the payload of SSO sign-in events. Created is set when
+// the sign-in created the user.
+type SSOLoginEvent struct {
+	OrgID     string
+	UserID    string
+	SessionID string
+	NameID    string
+	Created   bool
+}
+
+// SSOLoginFailedEvent is the payload of rejected SSO sign-ins.
+type SSOLoginFailedEvent struct {
+	OrgID     string
+	IP        string
+	UserAgent string
+	Reason    string
+}
+
+// SSOConnection is an organization's SAML identity provider.
+type SSOConnection struct {
+	OrgID        string
+	IdPEntityID  string
+	SSOURL       string   // HTTP-Redirect single sign-on URL
+	Certificates []string // base64 DER certificates the IdP signs with
+
+	// EmailAttribute and NameAttribute name the assertion attributes
+	// holding the user's email and name. Without an email attribute the
+	// NameID is the email.
+	EmailAttribute string
+	NameAttribute  string
+	// AttributeMapping stores other assertion attributes in the user's
+	// metadata, by attribute name to metadata key.
+	AttributeMapping map[string]string
+
+	// Domains are the email domains the IdP is trusted for. Their emails
+	// count as verified, so users.link_verified_emails links existing
+	// users; others must link the identity themselves.
+	Domains []string
+	// Role is the organization role of users joining it by signing in.
+	Role string
+	// Required refuses password logins to the organization's members.
+	Required bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Provider returns the users identity provider name of the connection's
+// users, "saml:<org ID>".
+func (connection *SSOConnection) Provider() string {
+	return "saml:" + connection.OrgID
+}
+
+// SSOInput configures an organization's SSO connection. Metadata, an IdP
+// metadata document, sets the entity ID, SSO URL and certificates; fields
+// set explicitly take precedence.
+type SSOInput struct {
+	Metadata     []byte
+	IdPEntityID  string
+	SSOURL       string
+	Certificates []string
+
+	EmailAttribute   string
+	NameAttribute    string
+	AttributeMapping map[string]string
+	Domains          []string
+	Role             string // "member" by default
+	Required         bool
+}
+
+// SSORequest is a pending AuthnRequest, for matching the IdP's response
+// to it once and only once.
+type SSORequest struct {
+	ID        string
+	OrgID     string
+	ReturnTo  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// SSOStore persists SSO connections and pending requests.
+// SQLiteSessionStore implements it; other session stores fall back to an
+// in-memory store.
+type SSOStore interface {
+	SaveSSOConnection(ctx context.Context, connection *SSOConnection) error
+	// GetSSOConnection returns ErrSSONotConfigured if the organization has
+	// no connection.
+	GetSSOConnection(ctx context.Context, orgID string) (*SSOConnection, error)
+	ListSSOConnections(ctx context.Context) ([]*SSOConnection, error)
+	DeleteSSOConnection(ctx context.Context, orgID string) error
+	SaveSSORequest(ctx context.Context, request *SSORequest) error
+	// TakeSSORequest deletes and returns a pending request, or returns
+	// ErrUnknownSSORequest.
+	TakeSSORequest(ctx context.Context, id string) (*SSORequest, error)
+}
+
+// MemorySSOStore keeps SSO connections and requests in process memory.
+type MemorySSOStore struct {
+	mu          sync.Mutex
+	connections map[string]SSOConnection
+	requests    map[string]SSORequest
+}
+
+// NewMemorySSOStore creates an in-memory SSO store.
+func NewMemorySSOStore() *MemorySSOStore {
+	return &MemorySSOStore{
+		connections: make(map[string]SSOConnection),
+		requests:    make(map[string]SSORequest),
+	}
+}
+
+func (store *MemorySSOStore) SaveSSOConnection(ctx context.Context, connection *SSOConnection) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.connections[connection.OrgID] = *connection
+	return nil
+}
+
+func (store *MemorySSOStore) GetSSOConnection(ctx context.Context, orgID string) (*SSOConnection, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	connection, ok := store.connections[orgID]
+	if !ok {
+		return nil, ErrSSONotConfigured
+	}
+	return &connection, nil
+}
+
+func (store *MemorySSOStore) ListSSOConnections(ctx context.Context) ([]*SSOConnection, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	connections := make([]*SSOConnection, 0, len(store.connections))
+	for _, connection := range store.connections {
+		connections = append(connections, &connection)
+	}
+	slices.SortFunc(connections, func(a, b *SSOConnection) int { return strings.Compare(a.OrgID, b.OrgID) })
+	return connections, nil
+}
+
+func (store *MemorySSOStore) DeleteSSOConnection(ctx context.Context, orgID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.connections, orgID)
+	return nil
+}
+
+func (store *MemorySSOStore) SaveSSORequest(ctx context.Context, request *SSORequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.requests[request.ID] = *request
+	return nil
+}
+
+func (store *MemorySSOStore) TakeSSORequest(ctx context.Context, id string) (*SSORequest, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	request, ok := store.requests[id]
+	if !ok {
+		return nil, ErrUnknownSSORequest
+	}
+	delete(store.requests, id)
+	return &request, nil
+}
+
+// DeleteExpired deletes the requests that expired before now.
+func (store *MemorySSOStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deleted := 0
+	for id, request := range store.requests {
+		if !now.Before(request.ExpiresAt) {
+			delete(store.requests, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// WithSSO enables SAML single sign-on, served under baseURL, the public
+// URL SSOHandler is mounted at, e.g. "https://app.example.com/sso".
+func WithSSO(baseURL string) Option {
+	return func(opts *Options) {
+		opts.SSOBaseURL = baseURL
+	}
+}
+
+// WithSSOEntityID sets the service provider entity ID IdPs know the app
+// by. It defaults to the SSO base URL.
+func WithSSOEntityID(entityID string) Option {
+	return func(opts *Options) {
+		opts.SSOEntityID = entityID
+	}
+}
+
+// identityProvisioner is implemented by *users.Module.
+type identityProvisioner interface {
+	SignInWithIdentity(ctx context.Context, input users.IdentityInput) (*users.User, bool, error)
+}
+
+// ConfigureSSO creates or replaces the organization's SSO connection and
+// publishes EventSSOConfigured.
+func (mod *Module) ConfigureSSO(ctx context.Context, orgID string, input SSOInput) (*SSOConnection, error) {
+	if orgsMod, ok := mod.app.TryOrgs(); ok {
+		if _, err := orgsMod.GetByID(ctx, orgID); err != nil {
+			return nil, err
+		}
+	}
+
+	connection := &SSOConnection{
+		OrgID:            orgID,
+		EmailAttribute:   input.EmailAttribute,
+		NameAttribute:    input.NameAttribute,
+		AttributeMapping: input.AttributeMapping,
+		Role:             input.Role,
+		Required:         input.Required,
+	}
+	if len(input.Metadata) > 0 {
+		metadata, err := ParseIdPMetadata(input.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		connection.IdPEntityID, connection.SSOURL, connection.Certificates = metadata.EntityID, metadata.SSOURL, metadata.Certificates
+	}
+	if input.IdPEntityID != "" {
+		connection.IdPEntityID = input.IdPEntityID
+	}
+	if input.SSOURL != "" {
+		connection.SSOURL = input.SSOURL
+	}
+	if len(input.Certificates) > 0 {
+		connection.Certificates = input.Certificates
+	}
+	for _, domain := range input.Domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			connection.Domains = append(connection.Domains, domain)
+		}
+	}
+	if connection.Role == "" {
+		connection.Role = "member"
+	}
+
+	if connection.IdPEntityID == "" || connection.SSOURL == "" || len(connection.Certificates) == 0 {
+		return nil, ErrInvalidSSOConnection
+	}
+	if target, err := url.Parse(connection.SSOURL); err != nil || !target.IsAbs() {
+		return nil, fmt.Errorf("%w: invalid SSO URL %q", ErrInvalidSSOConnection, connection.SSOURL)
+	}
+	if _, err := parseCertificates(connection.Certificates); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	connection.CreatedAt, connection.UpdatedAt = now, now
+	if existing, err := mod.sso.GetSSOConnection(ctx, orgID); err == nil {
+		connection.CreatedAt = existing.CreatedAt
+	} else if !errors.Is(err, ErrSSONotConfigured) {
+		return nil, err
+	}
+	if err := mod.sso.SaveSSOConnection(ctx, connection); err != nil {
+		return nil, err
+	}
+
+	mod.app.PublishEvent(ctx, EventSSOConfigured, &SSOConfigEvent{
+		OrgID:       orgID,
+		IdPEntityID: connection.IdPEntityID,
+		Required:    connection.Required,
+	})
+	return connection, nil
+}
+
+// GetSSOConnection returns the organization's SSO connection, or
+// ErrSSONotConfigured.
+func (mod *Module) GetSSOConnection(ctx context.Context, orgID string) (*SSOConnection, error) {
+	return mod.sso.GetSSOConnection(ctx, orgID)
+}
+
+// RemoveSSO deletes the organization's SSO connection and publishes
+// EventSSORemoved. Its members sign in with passwords again.
+func (mod *Module) RemoveSSO(ctx context.Context, orgID string) error {
+	connection, err := mod.sso.GetSSOConnection(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if err := mod.sso.DeleteSSOConnection(ctx, orgID); err != nil {
+		return err
+	}
+	mod.app.PublishEvent(ctx, EventSSORemoved, &SSOConfigEvent{OrgID: orgID, IdPEntityID: connection.IdPEntityID})
+	return nil
+}
+
+// samlProvider returns the service provider of a connection, or
+// ErrSSODisabled without a base URL.
+func (mod *Module) samlProvider(connection *SSOConnection) (*samlProvider, error) {
+	if mod.ssoBaseURL == "" {
+		return nil, ErrSSODisabled
+	}
+	entityID := mod.ssoEntityID
+	if entityID == "" {
+		entityID = mod.ssoBaseURL
+	}
+	return &samlProvider{
+		entityID:   entityID,
+		acsURL:     mod.ssoBaseURL + "/" + url.PathEscape(connection.OrgID) + "/acs",
+		connection: connection,
+	}, nil
+}
+
+// SSOMetadata returns the service provider metadata to register with the
+// organization's IdP.
+func (mod *Module) SSOMetadata(ctx context.Context, orgID string) ([]byte, error) {
+	connection, err := mod.sso.GetSSOConnection(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := mod.samlProvider(connection)
+	if err != nil {
+		return nil, err
+	}
+	return provider.spMetadata()
+}
+
+// SSOLoginURL starts a sign-in with the organization's IdP and returns the
+// URL to redirect the user to. After signing in they are sent back to
+// returnTo, a path on this site, or "/".
+func (mod *Module) SSOLoginURL(ctx context.Context, orgID, returnTo string) (string, error) {
+	connection, err := mod.sso.GetSSOConnection(ctx, orgID)
+	if err != nil {
+		return "", err
+	}
+	provider, err := mod.samlProvider(connection)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	id, target, err := provider.authnRequest(now)
+	if err != nil {
+		return "", fmt.Errorf("failed to create SAML request: %w", err)
+	}
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		returnTo = "/"
+	}
+	request := &SSORequest{ID: id, OrgID: orgID, ReturnTo: returnTo, ExpiresAt: now.Add(ssoRequestTTL), CreatedAt: now}
+	if err := mod.sso.SaveSSORequest(ctx, request); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// ConsumeSSO verifies the IdP's SAMLResponse to a request from
+// SSOLoginURL, signs the user in, creating or linking them by the
+// assertion's NameID and adding them to the organization, and sets the
+// session cookie. It returns the session and the path the user asked to
+// return to.
+func (mod *Module) ConsumeSSO(ctx context.Context, writer http.ResponseWriter, orgID, samlResponse string) (*Session, string, error) {
+	session, request, err := mod.consumeSSO(ctx, writer, orgID, samlResponse)
+	if err != nil {
+		client := clientInfoFromContext(ctx)
+		mod.app.PublishEvent(ctx, EventSSOLoginFailed, &SSOLoginFailedEvent{
+			OrgID:     orgID,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Reason:    err.Error(),
+		})
+		return nil, "", err
+	}
+	return session, request.ReturnTo, nil
+}
+
+func (mod *Module) consumeSSO(ctx context.Context, writer http.ResponseWriter, orgID, samlResponse string) (*Session, *SSORequest, error) {
+	connection, err := mod.sso.GetSSOConnection(ctx, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := mod.samlProvider(connection)
+	if err != nil {
+		return nil, nil, err
+	}
+	assertion, err := provider.parseResponse(samlResponse, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	// Taking the request makes each response usable once
+	request, err := mod.sso.TakeSSORequest(ctx, assertion.RequestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request.OrgID != orgID || !time.Now().Before(request.ExpiresAt) {
+		return nil, nil, ErrUnknownSSORequest
+	}
+
+	user, created, err := mod.provisionSSOUser(ctx, connection, assertion)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := mod.newSession(ctx, user.ID, mod.sessionTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := mod.issueSession(ctx, writer, session); err != nil {
+		return nil, nil, err
+	}
+
+	mod.app.PublishEvent(ctx, EventSSOLogin, &SSOLoginEvent{
+		OrgID:     orgID,
+		UserID:    user.ID,
+		SessionID: session.ID,
+		NameID:    assertion.NameID,
+		Created:   created,
+	})
+	mod.loggedIn(ctx, user.Email, session)
+	return session, request, nil
+}
+
+// provisionSSOUser signs in the user the assertion names, creating or
+// linking them, updates their mapped profile attributes and makes them a
+// member of the organization.
+func (mod *Module) provisionSSOUser(ctx context.Context, connection *SSOConnection, assertion *samlAssertion) (*users.User, bool, error) {
+	provisioner, ok := mod.app.Users().(identityProvisioner)
+	if !ok {
+		return nil, false, fmt.Errorf("single sign-on requires the chassis users module")
+	}
+	email := assertion.NameID
+	if connection.EmailAttribute != "" {
+		email = assertion.attribute(connection.EmailAttribute)
+	}
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	user, created, err := provisioner.SignInWithIdentity(ctx, users.IdentityInput{
+		Provider: connection.Provider(),
+		Subject:  assertion.NameID,
+		Email:    email,
+		Verified: slices.Contains(connection.Domains, domain),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The IdP is the source of truth for the mapped attributes, so they
+	// are updated on every sign-in.
+	profile := users.ProfileInput{Metadata: make(map[string]any)}
+	if name := assertion.attribute(connection.NameAttribute); connection.NameAttribute != "" && name != "" && name != user.Name {
+		profile.Name = &name
+	}
+	for attribute, key := range connection.AttributeMapping {
+		if values, ok := assertion.Attributes[attribute]; ok && key != "" {
+			if len(values) == 1 {
+				profile.Metadata[key] = values[0]
+			} else {
+				profile.Metadata[key] = values
+			}
+		}
+	}
+	if profile.Name != nil || len(profile.Metadata) > 0 {
+		updated, err := mod.app.Users().UpdateProfile(ctx, user.ID, profile)
+		if err != nil {
+			return nil, false, err
+		}
+		user = updated.(*users.User)
+	}
+
+	if orgsMod, ok := mod.app.TryOrgs(); ok && orgsMod.GetUserRole(ctx, connection.OrgID, user.ID) == "" {
+		if _, err := orgsMod.AddMember(ctx, connection.OrgID, user.ID, connection.Role); err != nil {
+			return nil, false, fmt.Errorf("failed to add user to organization: %w", err)
+		}
+	}
+	return user, created, nil
+}
+
+// checkSSORequired refuses password logins to members of organizations
+// whose SSO connection is required.
+func (mod *Module) checkSSORequired(ctx context.Context, userID string) error {
+	orgsMod, ok := mod.app.TryOrgs()
+	if mod.sso == nil || !ok {
+		return nil
+	}
+	connections, err := mod.sso.ListSSOConnections(ctx)
+	if err != nil {
+		return err
+	}
+	for _, connection := range connections {
+		if connection.Required && orgsMod.GetUserRole(ctx, connection.OrgID, userID) != "" {
+			return fmt.Errorf("%w: sign in through organization %s", ErrSSORequired, connection.OrgID)
+		}
+	}
+	return nil
+}
+
+// SSOHandler serves the SAML service provider endpoints of every
+// organization, wherever it is mounted:
+//
+//	GET  {base}/{org ID}/login?return_to=/path  redirects to the IdP
+//	POST {base}/{org ID}/acs                    receives the IdP's response
+//	GET  {base}/{org ID}/metadata               service provider metadata
+func (mod *Module) SSOHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		segments := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+		if len(segments) < 2 {
+			api.WriteError(writer, request, chassis.NewError(chassis.CodeNotFound, "unknown SSO endpoint"))
+			return
+		}
+		orgID, action := segments[len(segments)-2], segments[len(segments)-1]
+		ctx := request.Context()
+
+		switch {
+		case action == "login" && request.Method == http.MethodGet:
+			target, err := mod.SSOLoginURL(ctx, orgID, request.URL.Query().Get("return_to"))
+			if err != nil {
+				api.WriteError(writer, request, err)
+				return
+			}
+			http.Redirect(writer, request, target, http.StatusFound)
+		case action == "acs" && request.Method == http.MethodPost:
+			ctx = WithClientInfo(ctx, mod.ClientInfo(request))
+			_, returnTo, err := mod.ConsumeSSO(ctx, writer, orgID, request.PostFormValue("SAMLResponse"))
+			if err != nil {
+				api.WriteError(writer, request, err)
+				return
+			}
+			http.Redirect(writer, request, returnTo, http.StatusSeeOther)
+		case action == "metadata" && request.Method == http.MethodGet:
+			metadata, err := mod.SSOMetadata(ctx, orgID)
+			if err != nil {
+				api.WriteError(writer, request, err)
+				return
+			}
+			writer.Header().Set("Content-Type", "application/samlmetadata+xml")
+			_, _ = writer.Write(metadata)
+		case action == "login" || action == "acs" || action == "metadata":
+			api.WriteError(writer, request, chassis.NewError(chassis.CodeMethodNotAllowed, "method not allowed"))
+		default:
+			api.WriteError(writer, request, chassis.NewError(chassis.CodeNotFound, "unknown SSO endpoint"))
+		}
+	})
+}
+
+// Endpoints serves SSOHandler at /sso/ when single sign-on is enabled.
+// Implements chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{{
+		Name:    "sso",
+		Path:    "/sso/",
+		Handler: mod.SSOHandler(),
+		Enabled: mod.ssoBaseURL != "",
+	}}
+}
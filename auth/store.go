@@ -3,12 +3,13 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/internal/sqlite"
 )
 
 // SessionStore defines the interface for session persistence.
@@ -24,26 +25,32 @@ type SessionStore interface {
 
 // SQLiteSessionStore implements SessionStore using SQLite.
 type SQLiteSessionStore struct {
-	db *sql.DB
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
 }
 
 // NewSQLiteSessionStore creates a new SQLite-backed session store.
 func NewSQLiteSessionStore(dbPath string) (*SQLiteSessionStore, error) {
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	store, err := NewSQLiteSessionStoreFromDB(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		_ = db.Close()
+		return nil, err
 	}
+	store.owned = true
+	return store, nil
+}
 
+// NewSQLiteSessionStoreFromDB creates a session store on a database the
+// caller owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteSessionStoreFromDB(db *sql.DB) (*SQLiteSessionStore, error) {
 	if err := initSessionSchema(db); err != nil {
-		_ = db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
-
 	return &SQLiteSessionStore{db: db}, nil
 }
 
@@ -58,61 +65,485 @@ func initSessionSchema(db *sql.DB) error {
 		);
 		CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 		CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+		CREATE TABLE IF NOT EXISTS remember_tokens (
+			series TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			validator_hash TEXT NOT NULL,
+			previous_hash TEXT NOT NULL DEFAULT '',
+			rotated_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_remember_tokens_user_id ON remember_tokens(user_id);
+
+		CREATE TABLE IF NOT EXISTS known_logins (
+			user_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			value TEXT NOT NULL,
+			first_seen DATETIME NOT NULL,
+			PRIMARY KEY (user_id, kind, value)
+		);
+
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			outcome TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			country TEXT NOT NULL,
+			city TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			created_ms INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_login_attempts_user_id ON login_attempts(user_id, created_ms);
+		CREATE INDEX IF NOT EXISTS idx_login_attempts_created_ms ON login_attempts(created_ms);
+
+		CREATE TABLE IF NOT EXISTS sso_connections (
+			org_id TEXT PRIMARY KEY,
+			idp_entity_id TEXT NOT NULL,
+			sso_url TEXT NOT NULL,
+			certificates TEXT NOT NULL,
+			email_attribute TEXT NOT NULL,
+			name_attribute TEXT NOT NULL,
+			attribute_mapping TEXT NOT NULL,
+			domains TEXT NOT NULL,
+			role TEXT NOT NULL,
+			required INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS sso_requests (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			return_to TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+		);
 	`
-	_, err := db.Exec(schema)
-	return err
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	return addSessionClientColumns(db)
+}
+
+// addSessionClientColumns adds the client and impersonator columns to
+// session tables created before they existed.
+func addSessionClientColumns(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('sessions')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range []string{"ip", "user_agent", "country", "city", "impersonator_id"} {
+		if existing[column] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE sessions ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+const sessionColumns = `id, user_id, token, expires_at, created_at, ip, user_agent, country, city, impersonator_id`
+
 // Create inserts a new session into the database.
 func (store *SQLiteSessionStore) Create(ctx context.Context, session *Session) error {
-	query := `INSERT INTO sessions (id, user_id, token, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`
-	_, err := store.db.ExecContext(ctx, query, session.ID, session.UserID, session.Token, session.ExpiresAt, session.CreatedAt)
+	query := `INSERT INTO sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, session.ID, session.UserID, session.Token, session.ExpiresAt, session.CreatedAt,
+		session.IP, session.UserAgent, session.Country, session.City, session.ImpersonatorID)
 	return err
 }
 
 // GetByID retrieves a session by its ID.
 func (store *SQLiteSessionStore) GetByID(ctx context.Context, id string) (*Session, error) {
-	query := `SELECT id, user_id, token, expires_at, created_at FROM sessions WHERE id = ?`
-	row := store.db.QueryRowContext(ctx, query, id)
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+	row := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, id)
 	return scanSession(row)
 }
 
 // GetByToken retrieves a session by its token.
 func (store *SQLiteSessionStore) GetByToken(ctx context.Context, token string) (*Session, error) {
-	query := `SELECT id, user_id, token, expires_at, created_at FROM sessions WHERE token = ?`
-	row := store.db.QueryRowContext(ctx, query, token)
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE token = ?`
+	row := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, token)
 	return scanSession(row)
 }
 
 // Delete removes a session by its ID.
 func (store *SQLiteSessionStore) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM sessions WHERE id = ?`
-	_, err := store.db.ExecContext(ctx, query, id)
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, id)
 	return err
 }
 
 // DeleteByToken removes a session by its token.
 func (store *SQLiteSessionStore) DeleteByToken(ctx context.Context, token string) error {
 	query := `DELETE FROM sessions WHERE token = ?`
-	_, err := store.db.ExecContext(ctx, query, token)
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, token)
 	return err
 }
 
 // DeleteByUserID removes all sessions for a user.
 func (store *SQLiteSessionStore) DeleteByUserID(ctx context.Context, userID string) error {
 	query := `DELETE FROM sessions WHERE user_id = ?`
-	_, err := store.db.ExecContext(ctx, query, userID)
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, userID)
+	return err
+}
+
+// ListByUserID returns a user's sessions, oldest first.
+func (store *SQLiteSessionStore) ListByUserID(ctx context.Context, userID string) ([]*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ? ORDER BY created_at`
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteByImpersonatorID removes the sessions an admin started with
+// Impersonate.
+func (store *SQLiteSessionStore) DeleteByImpersonatorID(ctx context.Context, adminUserID string) error {
+	query := `DELETE FROM sessions WHERE impersonator_id = ?`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, adminUserID)
+	return err
+}
+
+// List returns every session, including expired ones. Used by the consistency checker.
+func (store *SQLiteSessionStore) List(ctx context.Context) ([]*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions ORDER BY created_at`
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RecordLogin records the country and device of a login and reports
+// whether each is new for the user. Implements KnownLoginStore.
+func (store *SQLiteSessionStore) RecordLogin(ctx context.Context, userID, country, device string) (bool, bool, error) {
+	tx, err := sqlite.Begin(ctx, store.db)
+	if err != nil {
+		return false, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var known int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM known_logins WHERE user_id = ?`, userID).Scan(&known); err != nil {
+		return false, false, err
+	}
+
+	// The user's first login establishes what's known
+	seen := known > 0
+	var isNew [2]bool
+	for i, kv := range [][2]string{{"country", country}, {"device", device}} {
+		if kv[1] == "" {
+			continue
+		}
+		query := `INSERT OR IGNORE INTO known_logins (user_id, kind, value, first_seen) VALUES (?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, userID, kv[0], kv[1], time.Now())
+		if err != nil {
+			return false, false, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return false, false, err
+		}
+		isNew[i] = seen && inserted > 0
+	}
+	return isNew[0], isNew[1], tx.Commit()
+}
+
+// RecordAttempt stores a login attempt. Implements LoginHistoryStore.
+func (store *SQLiteSessionStore) RecordAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	query := `INSERT INTO login_attempts (id, user_id, email, outcome, reason, ip, user_agent, country, city, session_id, created_at, created_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, attempt.ID, attempt.UserID, attempt.Email, attempt.Outcome,
+		attempt.Reason, attempt.IP, attempt.UserAgent, attempt.Country, attempt.City, attempt.SessionID,
+		attempt.CreatedAt, attempt.CreatedAt.UnixMilli())
+	return err
+}
+
+// ListAttempts returns a user's login attempts, newest first. Implements
+// LoginHistoryStore.
+func (store *SQLiteSessionStore) ListAttempts(ctx context.Context, userID string, offset, limit int) ([]*LoginAttempt, error) {
+	query := `SELECT id, user_id, email, outcome, reason, ip, user_agent, country, city, session_id, created_at
+		FROM login_attempts WHERE user_id = ? ORDER BY created_ms DESC, id DESC LIMIT ? OFFSET ?`
+	return db.Query(ctx, sqlite.Conn(ctx, store.db), scanAttempt, query, userID, limit, offset)
+}
+
+// CountAttempts returns the number of a user's login attempts. Implements
+// LoginHistoryStore.
+func (store *SQLiteSessionStore) CountAttempts(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM login_attempts WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
+
+// DeleteAttempts deletes a user's login attempts. Implements
+// LoginHistoryStore.
+func (store *SQLiteSessionStore) DeleteAttempts(ctx context.Context, userID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM login_attempts WHERE user_id = ?`, userID)
+	return err
+}
+
+// PruneAttempts deletes the login attempts made before cutoff. Implements
+// LoginHistoryStore.
+func (store *SQLiteSessionStore) PruneAttempts(ctx context.Context, cutoff time.Time) (int, error) {
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM login_attempts WHERE created_ms < ?`, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+func scanAttempt(row db.Scanner) (*LoginAttempt, error) {
+	var attempt LoginAttempt
+	err := row.Scan(&attempt.ID, &attempt.UserID, &attempt.Email, &attempt.Outcome, &attempt.Reason, &attempt.IP,
+		&attempt.UserAgent, &attempt.Country, &attempt.City, &attempt.SessionID, &attempt.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// SaveRememberToken inserts or replaces a remember-me token by series.
+// Implements RememberStore.
+func (store *SQLiteSessionStore) SaveRememberToken(ctx context.Context, token *RememberToken) error {
+	query := `INSERT OR REPLACE INTO remember_tokens (series, user_id, validator_hash, previous_hash, rotated_at, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, token.Series, token.UserID, token.ValidatorHash, token.PreviousHash,
+		token.RotatedAt, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+// GetRememberToken retrieves a remember-me token by series.
+func (store *SQLiteSessionStore) GetRememberToken(ctx context.Context, series string) (*RememberToken, error) {
+	query := `SELECT series, user_id, validator_hash, previous_hash, rotated_at, expires_at, created_at FROM remember_tokens WHERE series = ?`
+	var token RememberToken
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, series).Scan(&token.Series, &token.UserID, &token.ValidatorHash, &token.PreviousHash,
+		&token.RotatedAt, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidSession
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteRememberToken removes a remember-me token by series.
+func (store *SQLiteSessionStore) DeleteRememberToken(ctx context.Context, series string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM remember_tokens WHERE series = ?`, series)
+	return err
+}
+
+// DeleteRememberTokensByUserID removes all remember-me tokens of a user.
+func (store *SQLiteSessionStore) DeleteRememberTokensByUserID(ctx context.Context, userID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM remember_tokens WHERE user_id = ?`, userID)
+	return err
+}
+
+// ForgetUser deletes the known logins of a user.
+func (store *SQLiteSessionStore) ForgetUser(ctx context.Context, userID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM known_logins WHERE user_id = ?`, userID)
 	return err
 }
 
-// Close closes the database connection.
+// DeleteExpired removes the sessions, remember-me tokens and SSO requests
+// that expired before now.
+func (store *SQLiteSessionStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	for _, table := range []struct{ name, key string }{{"sessions", "id"}, {"remember_tokens", "series"}, {"sso_requests", "id"}} {
+		// Expiry times are compared in Go; they're stored as driver-formatted strings
+		rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, `SELECT `+table.key+`, expires_at FROM `+table.name)
+		if err != nil {
+			return deleted, err
+		}
+		var expired []string
+		for rows.Next() {
+			var key string
+			var expiresAt time.Time
+			if err := rows.Scan(&key, &expiresAt); err != nil {
+				_ = rows.Close()
+				return deleted, err
+			}
+			if !now.Before(expiresAt) {
+				expired = append(expired, key)
+			}
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return deleted, err
+		}
+
+		for _, key := range expired {
+			if _, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM `+table.name+` WHERE `+table.key+` = ?`, key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+const ssoConnectionColumns = `org_id, idp_entity_id, sso_url, certificates, email_attribute, name_attribute,
+	attribute_mapping, domains, role, required, created_at, updated_at`
+
+// SaveSSOConnection inserts or replaces an organization's SSO connection.
+// Implements SSOStore.
+func (store *SQLiteSessionStore) SaveSSOConnection(ctx context.Context, connection *SSOConnection) error {
+	certificates, err := json.Marshal(connection.Certificates)
+	if err != nil {
+		return err
+	}
+	mapping, err := json.Marshal(connection.AttributeMapping)
+	if err != nil {
+		return err
+	}
+	domains, err := json.Marshal(connection.Domains)
+	if err != nil {
+		return err
+	}
+	query := `INSERT OR REPLACE INTO sso_connections (` + ssoConnectionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = sqlite.Conn(ctx, store.db).ExecContext(ctx, query, connection.OrgID, connection.IdPEntityID, connection.SSOURL,
+		string(certificates), connection.EmailAttribute, connection.NameAttribute, string(mapping), string(domains),
+		connection.Role, connection.Required, connection.CreatedAt, connection.UpdatedAt)
+	return err
+}
+
+// GetSSOConnection retrieves an organization's SSO connection. Implements
+// SSOStore.
+func (store *SQLiteSessionStore) GetSSOConnection(ctx context.Context, orgID string) (*SSOConnection, error) {
+	query := `SELECT ` + ssoConnectionColumns + ` FROM sso_connections WHERE org_id = ?`
+	connection, err := scanSSOConnection(sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, orgID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSSONotConfigured
+	}
+	return connection, err
+}
+
+// ListSSOConnections returns every SSO connection. Implements SSOStore.
+func (store *SQLiteSessionStore) ListSSOConnections(ctx context.Context) ([]*SSOConnection, error) {
+	query := `SELECT ` + ssoConnectionColumns + ` FROM sso_connections ORDER BY org_id`
+	return db.Query(ctx, sqlite.Conn(ctx, store.db), scanSSOConnection, query)
+}
+
+// DeleteSSOConnection removes an organization's SSO connection.
+// Implements SSOStore.
+func (store *SQLiteSessionStore) DeleteSSOConnection(ctx context.Context, orgID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM sso_connections WHERE org_id = ?`, orgID)
+	return err
+}
+
+func scanSSOConnection(row db.Scanner) (*SSOConnection, error) {
+	var connection SSOConnection
+	var certificates, mapping, domains string
+	err := row.Scan(&connection.OrgID, &connection.IdPEntityID, &connection.SSOURL, &certificates, &connection.EmailAttribute,
+		&connection.NameAttribute, &mapping, &domains, &connection.Role, &connection.Required, &connection.CreatedAt, &connection.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []struct {
+		data   string
+		target any
+	}{{certificates, &connection.Certificates}, {mapping, &connection.AttributeMapping}, {domains, &connection.Domains}} {
+		if err := json.Unmarshal([]byte(field.data), field.target); err != nil {
+			return nil, fmt.Errorf("failed to decode SSO connection: %w", err)
+		}
+	}
+	return &connection, nil
+}
+
+// SaveSSORequest stores a pending SSO request. Implements SSOStore.
+func (store *SQLiteSessionStore) SaveSSORequest(ctx context.Context, request *SSORequest) error {
+	query := `INSERT INTO sso_requests (id, org_id, return_to, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, request.ID, request.OrgID, request.ReturnTo, request.ExpiresAt, request.CreatedAt)
+	return err
+}
+
+// TakeSSORequest deletes and returns a pending SSO request, atomically, so
+// concurrent calls with the same ID return it to one of them. Implements
+// SSOStore.
+func (store *SQLiteSessionStore) TakeSSORequest(ctx context.Context, id string) (*SSORequest, error) {
+	query := `DELETE FROM sso_requests WHERE id = ? RETURNING id, org_id, return_to, expires_at, created_at`
+	var request SSORequest
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, id).
+		Scan(&request.ID, &request.OrgID, &request.ReturnTo, &request.ExpiresAt, &request.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownSSORequest
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// Close closes the database connection, unless the caller owns it.
 func (store *SQLiteSessionStore) Close() error {
+	if !store.owned {
+		return nil
+	}
 	return store.db.Close()
 }
 
-func scanSession(row *sql.Row) (*Session, error) {
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteSessionStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteSessionStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
 	var session Session
-	err := row.Scan(&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &session.CreatedAt)
+	err := row.Scan(&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &session.CreatedAt,
+		&session.IP, &session.UserAgent, &session.Country, &session.City, &session.ImpersonatorID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrInvalidSession
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSweepInterval is how often Start deletes expired sessions and
+// remember-me tokens unless WithSweepInterval or auth.sweep_interval says
+// otherwise.
+const DefaultSweepInterval = 10 * time.Minute
+
+// expiredDeleter is implemented by stores that can delete what expired
+// before now, returning how many entries went. SQLiteSessionStore,
+// MemoryRememberStore and MemorySSOStore implement it.
+type expiredDeleter interface {
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// WithSweepInterval sets how often Start deletes expired sessions and
+// remember-me tokens.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.SweepInterval = interval
+	}
+}
+
+// Start deletes expired sessions, remember-me tokens and SSO requests, and login
+// attempts older than the history retention, every sweep interval until
+// ctx is cancelled. Implements chassis.Service, so app.Run
+// keeps the session store from growing without bound.
+func (mod *Module) Start(ctx context.Context) error {
+	ticker := time.NewTicker(mod.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			mod.sweep(ctx, now)
+		}
+	}
+}
+
+// sweep deletes what expired before now from the stores that support it.
+func (mod *Module) sweep(ctx context.Context, now time.Time) int {
+	deleted := 0
+	stores := []any{mod.store}
+	for _, store := range []any{mod.remember, mod.sso} {
+		if store != any(mod.store) {
+			stores = append(stores, store)
+		}
+	}
+	for _, store := range stores {
+		deleter, ok := store.(expiredDeleter)
+		if !ok {
+			continue
+		}
+		count, err := deleter.DeleteExpired(ctx, now)
+		if err != nil {
+			mod.app.Logger().Error("failed to delete expired sessions", "error", err)
+			continue
+		}
+		deleted += count
+	}
+	if deleted > 0 {
+		mod.app.Logger().Debug("deleted expired sessions", "count", deleted)
+	}
+
+	if mod.historyRetention > 0 {
+		pruned, err := mod.history.PruneAttempts(ctx, now.Add(-mod.historyRetention))
+		if err != nil {
+			mod.app.Logger().Error("failed to prune login history", "error", err)
+		} else if pruned > 0 {
+			mod.app.Logger().Debug("pruned login history", "count", pruned)
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,61 @@
+// Package builtin lists the factories of the chassis modules, so config
+// can enable any of them with chassis.WithConfiguredModules:
+//
+//	app, err := chassis.Build(
+//	    chassis.WithConfigFile("./config.yaml"),
+//	    chassis.WithModuleFactories(builtin.Factories()),
+//	    chassis.WithConfiguredModules(),
+//	)
+//
+// It imports every module package, so apps that enable only a few modules
+// can set their factories with chassis.WithModuleFactory instead.
+package builtin
+
+import (
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/alerts"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/cache"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/grpcserver"
+	"github.com/talosaether/chassis/i18n"
+	"github.com/talosaether/chassis/keys"
+	"github.com/talosaether/chassis/metrics"
+	"github.com/talosaether/chassis/notifications"
+	"github.com/talosaether/chassis/ops"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/permissions"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/realtime"
+	"github.com/talosaether/chassis/scim"
+	"github.com/talosaether/chassis/storage"
+	"github.com/talosaether/chassis/users"
+	"github.com/talosaether/chassis/webhooks"
+)
+
+// Factories returns a factory for each built-in module, by module name,
+// creating it with its default options.
+func Factories() map[string]chassis.ModuleFactory {
+	return map[string]chassis.ModuleFactory{
+		"alerts":        func() chassis.Module { return alerts.New() },
+		"auth":          func() chassis.Module { return auth.New() },
+		"cache":         func() chassis.Module { return cache.New() },
+		"email":         func() chassis.Module { return email.New() },
+		"events":        func() chassis.Module { return events.New() },
+		"grpc":          func() chassis.Module { return grpcserver.New() },
+		"i18n":          func() chassis.Module { return i18n.New() },
+		"keys":          func() chassis.Module { return keys.New() },
+		"metrics":       func() chassis.Module { return metrics.New() },
+		"notifications": func() chassis.Module { return notifications.New() },
+		"ops":           func() chassis.Module { return ops.New() },
+		"orgs":          func() chassis.Module { return orgs.New() },
+		"permissions":   func() chassis.Module { return permissions.New() },
+		"queue":         func() chassis.Module { return queue.New() },
+		"realtime":      func() chassis.Module { return realtime.New() },
+		"scim":          func() chassis.Module { return scim.New() },
+		"storage":       func() chassis.Module { return storage.New() },
+		"users":         func() chassis.Module { return users.New() },
+		"webhooks":      func() chassis.Module { return webhooks.New() },
+	}
+}
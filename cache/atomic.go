@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrAtomicNotSupported = chassis.NewError(chassis.CodeFailedPrecondition, "cache provider does not support atomic operations")
+	ErrNotCounter         = chassis.NewError(chassis.CodeFailedPrecondition, "cache value is not a counter")
+)
+
+// AtomicProvider is implemented by providers that can update entries
+// atomically, across every process sharing the cache. MemoryProvider
+// implements it; a Redis provider maps the methods to INCRBY, SET NX and a
+// compare-and-set script.
+type AtomicProvider interface {
+	Provider
+
+	// Incr adds delta to the counter at key and returns its new value.
+	// Counters are stored as decimal strings, like Redis. A missing key
+	// starts at zero and expires after ttl; existing counters keep their
+	// expiry. Fails with ErrNotCounter if the value isn't an integer.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+
+	// SetNX stores value at key with ttl unless the key is already set,
+	// and reports whether it did.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// CompareAndSwap replaces the value at key with value, with ttl, if it
+	// is currently old, and reports whether it did. A missing key never
+	// matches; use SetNX to create one.
+	CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error)
+}
+
+// atomicProvider returns the current provider as an AtomicProvider.
+func (mod *Module) atomicProvider() (AtomicProvider, func(), error) {
+	provider, release := mod.provider.Acquire()
+	atomic, ok := provider.(AtomicProvider)
+	if !ok {
+		release()
+		return nil, nil, fmt.Errorf("%w: %T", ErrAtomicNotSupported, provider)
+	}
+	return atomic, release, nil
+}
+
+// Incr adds delta to the counter at key and returns its new value. New
+// counters expire after the default TTL. Keep a request count per window,
+// say:
+//
+//	count, err := app.Cache().Incr(ctx, "ratelimit:"+userID, 1)
+//	if count > 100 { ... }
+func (mod *Module) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	return mod.IncrWithTTL(ctx, key, delta, mod.defaultTTL)
+}
+
+// IncrWithTTL is Incr with the TTL of a new counter, e.g. the length of a
+// rate limit window.
+func (mod *Module) IncrWithTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	provider, release, err := mod.atomicProvider()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return provider.Incr(ctx, key, delta, ttl)
+}
+
+// Decr subtracts delta from the counter at key and returns its new value.
+func (mod *Module) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	return mod.Incr(ctx, key, -delta)
+}
+
+// SetNX stores value at key with ttl unless the key is already set, and
+// reports whether it did. It makes a simple lock, released with Delete or
+// when ttl runs out:
+//
+//	locked, err := app.Cache().SetNX(ctx, "lock:report:"+orgID, []byte(instanceID), time.Minute)
+func (mod *Module) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	provider, release, err := mod.atomicProvider()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return provider.SetNX(ctx, key, value, ttl)
+}
+
+// CompareAndSwap replaces the value at key with value, with ttl, if it is
+// currently old, and reports whether it did.
+func (mod *Module) CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	provider, release, err := mod.atomicProvider()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return provider.CompareAndSwap(ctx, key, old, value, ttl)
+}
+
+// live returns the unexpired entry at key. Callers hold provider.mu.
+func (provider *MemoryProvider) live(key string, now time.Time) (*cacheEntry, bool) {
+	entry, ok := provider.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (provider *MemoryProvider) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	now := time.Now()
+
+	var count int64
+	expiresAt := now.Add(ttl)
+	if entry, ok := provider.live(key, now); ok {
+		parsed, err := strconv.ParseInt(string(entry.value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrNotCounter, key)
+		}
+		count, expiresAt = parsed, entry.expiresAt
+	}
+	count += delta
+	provider.entries[key] = &cacheEntry{value: []byte(strconv.FormatInt(count, 10)), expiresAt: expiresAt}
+	return count, nil
+}
+
+func (provider *MemoryProvider) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	now := time.Now()
+	if _, ok := provider.live(key, now); ok {
+		return false, nil
+	}
+	provider.entries[key] = &cacheEntry{value: value, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (provider *MemoryProvider) CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	now := time.Now()
+	entry, ok := provider.live(key, now)
+	if !ok || !bytes.Equal(entry.value, old) {
+		return false, nil
+	}
+	provider.entries[key] = &cacheEntry{value: value, expiresAt: now.Add(ttl)}
+	return true, nil
+}
@@ -1,7 +1,9 @@
 // Package cache provides key-value caching for the chassis framework.
 //
 // It supports time-based expiration (TTL) and pluggable storage backends.
-// The default implementation uses an in-memory store with automatic cleanup.
+// The default implementation uses an in-memory store; the module implements
+// chassis.Service, so app.Run sweeps expired entries out of it every
+// minute.
 //
 // # Usage
 //
@@ -46,16 +48,63 @@
 // Implement the Provider interface for custom backends (e.g., Redis):
 //
 //	cache.New(cache.WithProvider(myRedisProvider))
+//
+// Providers can be replaced while the app runs, e.g. to move from the
+// in-memory cache to Redis without a restart. SetProvider waits for
+// operations on the old provider to finish, then closes it:
+//
+//	err := app.Cache().SetProvider(ctx, myRedisProvider)
+//
+// # Two-Level Cache
+//
+// NewTieredProvider keeps hot keys in an in-process LRU in front of a remote
+// provider such as Redis. Writes go through to the remote provider and are
+// fanned out to other instances, which drop their local copies; with the
+// events module registered before the cache, invalidations are published as
+// EventInvalidated:
+//
+//	cache.New(cache.WithProvider(cache.NewTieredProvider(redisProvider,
+//	    cache.WithLocalSize(50000),
+//	    cache.WithLocalTTL(10*time.Second),
+//	)))
+//
+// # Introspection
+//
+// Stats reports the entry count, an estimate of the memory used, and hit,
+// miss and eviction counters; TTL reports how long an entry has left.
+// Set cache.stats_interval (or WithStatsLogging) to log the stats
+// periodically:
+//
+//	stats, _ := app.Cache().Stats(ctx)
+//	left, found := app.Cache().TTL(ctx, "session:abc")
+//
+// # Atomic Operations
+//
+// Incr, Decr, SetNX and CompareAndSwap update entries atomically for rate
+// limits, counters and locks. They need a provider implementing
+// AtomicProvider and fail with ErrAtomicNotSupported otherwise:
+//
+//	count, err := app.Cache().Incr(ctx, "ratelimit:"+userID, 1)
+//	locked, err := app.Cache().SetNX(ctx, "lock:nightly", []byte(instanceID), time.Minute)
 package cache
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/internal/swap"
 )
 
+var ErrInvalidProvider = chassis.NewError(chassis.CodeInvalidArgument, "not a cache provider")
+
 // Provider defines the interface for cache implementations.
 type Provider interface {
 	Get(ctx context.Context, key string) ([]byte, bool)
@@ -66,9 +115,13 @@ type Provider interface {
 
 // Module is the cache module implementation.
 type Module struct {
-	provider   Provider
+	provider   swap.Value[Provider]
 	defaultTTL time.Duration
 	app        *chassis.App
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	statsInterval time.Duration
 }
 
 // Option is a function that configures the cache module.
@@ -77,7 +130,7 @@ type Option func(*Module)
 // WithProvider sets a custom cache provider.
 func WithProvider(provider Provider) Option {
 	return func(mod *Module) {
-		mod.provider = provider
+		mod.provider.Store(provider)
 	}
 }
 
@@ -112,17 +165,27 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 
 	// Read config if available
 	if cfg := app.ConfigData(); cfg != nil {
-		if ttlStr := cfg.GetString("cache.default_ttl"); ttlStr != "" {
-			if ttl, err := time.ParseDuration(ttlStr); err == nil {
-				mod.defaultTTL = ttl
+		if cfg.Get("cache.default_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("cache.default_ttl")
+			if err != nil {
+				return err
+			}
+			mod.defaultTTL = ttl
+		}
+		if cfg.Get("cache.stats_interval") != nil {
+			interval, err := cfg.MustGetDuration("cache.stats_interval")
+			if err != nil {
+				return err
 			}
+			mod.statsInterval = interval
 		}
 	}
 
 	// Use default in-memory provider if none provided
-	if mod.provider == nil {
-		mod.provider = NewMemoryProvider()
+	if mod.provider.Load() == nil {
+		mod.provider.Store(newMemoryProvider(false))
 	}
+	mod.bind(mod.provider.Load())
 
 	app.Logger().Info("cache module initialized", "default_ttl", mod.defaultTTL)
 	return nil
@@ -130,38 +193,143 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 
 // Shutdown cleans up the cache module.
 func (mod *Module) Shutdown(ctx context.Context) error {
-	return mod.provider.Clear(ctx)
+	provider, release := mod.provider.Acquire()
+	defer release()
+	return provider.Clear(ctx)
+}
+
+// expiredDeleter is implemented by providers that can sweep expired
+// entries. MemoryProvider implements it.
+type expiredDeleter interface {
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// Start sweeps expired entries out of the provider every minute until ctx
+// is cancelled, and logs the stats with WithStatsLogging. Implements
+// chassis.Service; providers that expire entries themselves, such as
+// Redis, are left alone.
+func (mod *Module) Start(ctx context.Context) error {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	var statsTicks <-chan time.Time
+	if mod.statsInterval > 0 {
+		statsTicker := time.NewTicker(mod.statsInterval)
+		defer statsTicker.Stop()
+		statsTicks = statsTicker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			mod.sweep(ctx, now)
+		case <-statsTicks:
+			mod.logStats(ctx)
+		}
+	}
+}
+
+// sweep deletes what expired before now from the current provider.
+func (mod *Module) sweep(ctx context.Context, now time.Time) {
+	provider, release := mod.provider.Acquire()
+	defer release()
+	deleter, ok := provider.(expiredDeleter)
+	if !ok {
+		return
+	}
+	if _, err := deleter.DeleteExpired(ctx, now); err != nil {
+		mod.app.Logger().Error("failed to delete expired cache entries", "error", err)
+	}
+}
+
+// SetProvider replaces the cache provider at runtime. Operations already
+// running on the old provider finish first: SetProvider waits for them
+// until ctx is done, then closes the old provider if it is an io.Closer.
+// Entries are not copied, so an in-memory replacement starts empty.
+func (mod *Module) SetProvider(ctx context.Context, provider any) error {
+	next, ok := provider.(Provider)
+	if !ok || next == nil {
+		return fmt.Errorf("%w: %T", ErrInvalidProvider, provider)
+	}
+	mod.bind(next)
+	old, err := mod.provider.Swap(ctx, next)
+	if err != nil {
+		return fmt.Errorf("failed to drain the old cache provider: %w", err)
+	}
+	if mod.app != nil {
+		mod.app.Logger().Info("cache provider replaced", "provider", fmt.Sprintf("%T", next))
+	}
+	if closer, ok := old.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Snapshot saves the cache contents into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.provider.Load().(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "cache.json"))
+}
+
+// Restore resets the cache contents to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.provider.Load().(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "cache.json"))
 }
 
 // Get retrieves a value from the cache.
 func (mod *Module) Get(ctx context.Context, key string) ([]byte, bool) {
-	return mod.provider.Get(ctx, key)
+	provider, release := mod.provider.Acquire()
+	defer release()
+	value, found := provider.Get(ctx, key)
+	if found {
+		mod.hits.Add(1)
+	} else {
+		mod.misses.Add(1)
+	}
+	return value, found
 }
 
 // Set stores a value in the cache with the default TTL.
 func (mod *Module) Set(ctx context.Context, key string, value []byte) error {
-	return mod.provider.Set(ctx, key, value, mod.defaultTTL)
+	return mod.SetWithTTL(ctx, key, value, mod.defaultTTL)
 }
 
 // SetWithTTL stores a value in the cache with a custom TTL.
 func (mod *Module) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
-	return mod.provider.Set(ctx, key, value, ttl)
+	provider, release := mod.provider.Acquire()
+	defer release()
+	return provider.Set(ctx, key, value, ttl)
 }
 
 // Delete removes a value from the cache.
 func (mod *Module) Delete(ctx context.Context, key string) error {
-	return mod.provider.Delete(ctx, key)
+	provider, release := mod.provider.Acquire()
+	defer release()
+	return provider.Delete(ctx, key)
 }
 
 // Clear removes all values from the cache.
 func (mod *Module) Clear(ctx context.Context) error {
-	return mod.provider.Clear(ctx)
+	provider, release := mod.provider.Acquire()
+	defer release()
+	return provider.Clear(ctx)
 }
 
 // MemoryProvider is an in-memory cache implementation.
 type MemoryProvider struct {
-	mu      sync.RWMutex
-	entries map[string]*cacheEntry
+	mu        sync.RWMutex
+	entries   map[string]*cacheEntry
+	evictions atomic.Uint64
+
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 type cacheEntry struct {
@@ -169,15 +337,23 @@ type cacheEntry struct {
 	expiresAt time.Time
 }
 
-// NewMemoryProvider creates a new in-memory cache provider.
+// NewMemoryProvider creates a new in-memory cache provider that sweeps
+// expired entries every minute until closed.
 func NewMemoryProvider() *MemoryProvider {
+	return newMemoryProvider(true)
+}
+
+// newMemoryProvider creates a memory provider, with its own cleanup
+// goroutine if sweep is set. The module's default provider is swept by
+// Start instead, under the app's supervision.
+func newMemoryProvider(sweep bool) *MemoryProvider {
 	provider := &MemoryProvider{
 		entries: make(map[string]*cacheEntry),
+		stop:    make(chan struct{}),
+	}
+	if sweep {
+		go provider.cleanup()
 	}
-
-	// Start background cleanup goroutine
-	go provider.cleanup()
-
 	return provider
 }
 
@@ -185,18 +361,37 @@ func (provider *MemoryProvider) cleanup() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		provider.mu.Lock()
-		now := time.Now()
-		for key, entry := range provider.entries {
-			if now.After(entry.expiresAt) {
-				delete(provider.entries, key)
-			}
+	for {
+		select {
+		case <-provider.stop:
+			return
+		case now := <-ticker.C:
+			_, _ = provider.DeleteExpired(context.Background(), now)
 		}
-		provider.mu.Unlock()
 	}
 }
 
+// DeleteExpired removes the entries that expired before now.
+func (provider *MemoryProvider) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	deleted := 0
+	for key, entry := range provider.entries {
+		if now.After(entry.expiresAt) {
+			delete(provider.entries, key)
+			deleted++
+		}
+	}
+	provider.evictions.Add(uint64(deleted))
+	return deleted, nil
+}
+
+// Close stops the background cleanup.
+func (provider *MemoryProvider) Close() error {
+	provider.closeOnce.Do(func() { close(provider.stop) })
+	return nil
+}
+
 func (provider *MemoryProvider) Get(ctx context.Context, key string) ([]byte, bool) {
 	provider.mu.RLock()
 	defer provider.mu.RUnlock()
@@ -239,3 +434,51 @@ func (provider *MemoryProvider) Clear(ctx context.Context) error {
 	provider.entries = make(map[string]*cacheEntry)
 	return nil
 }
+
+// snapshotEntry is the on-disk form of a cache entry.
+type snapshotEntry struct {
+	Value     []byte    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Snapshot writes all live entries to path as JSON.
+func (provider *MemoryProvider) Snapshot(ctx context.Context, path string) error {
+	provider.mu.RLock()
+	entries := make(map[string]snapshotEntry, len(provider.entries))
+	for key, entry := range provider.entries {
+		entries[key] = snapshotEntry{Value: entry.value, ExpiresAt: entry.expiresAt}
+	}
+	provider.mu.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache snapshot: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces all entries with those stored in the snapshot at path.
+func (provider *MemoryProvider) Restore(ctx context.Context, path string) error {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to read cache snapshot: %w", err)
+	}
+
+	var entries map[string]snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to decode cache snapshot: %w", err)
+	}
+
+	restored := make(map[string]*cacheEntry, len(entries))
+	for key, entry := range entries {
+		restored[key] = &cacheEntry{value: entry.Value, expiresAt: entry.ExpiresAt}
+	}
+
+	provider.mu.Lock()
+	provider.entries = restored
+	provider.mu.Unlock()
+	return nil
+}
@@ -2,8 +2,14 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
 )
 
 func TestMemoryProvider_SetAndGet(t *testing.T) {
@@ -130,6 +136,22 @@ func TestMemoryProvider_TTLExpiration(t *testing.T) {
 	}
 }
 
+func TestMemoryProvider_DeleteExpired(t *testing.T) {
+	provider := newMemoryProvider(false)
+	ctx := context.Background()
+
+	_ = provider.Set(ctx, "expired", []byte("a"), time.Millisecond)
+	_ = provider.Set(ctx, "live", []byte("b"), time.Hour)
+
+	deleted, err := provider.DeleteExpired(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("DeleteExpired failed: %v", err)
+	}
+	if deleted != 1 || len(provider.entries) != 1 {
+		t.Errorf("expected only the expired entry deleted, got %d deleted, %d left", deleted, len(provider.entries))
+	}
+}
+
 func TestMemoryProvider_Overwrite(t *testing.T) {
 	provider := NewMemoryProvider()
 	ctx := context.Background()
@@ -211,7 +233,7 @@ func TestModuleNew_WithProvider(t *testing.T) {
 	customProvider := NewMemoryProvider()
 	mod := New(WithProvider(customProvider))
 
-	if mod.provider != customProvider {
+	if mod.provider.Load() != customProvider {
 		t.Error("custom provider should be set")
 	}
 }
@@ -222,3 +244,309 @@ func TestModule_Name(t *testing.T) {
 		t.Errorf("Name() should return 'cache', got %q", mod.Name())
 	}
 }
+
+func TestMemoryProvider_SnapshotRestore(t *testing.T) {
+	provider := NewMemoryProvider()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	provider.Set(ctx, "kept", []byte("v1"), time.Hour)
+	if err := provider.Snapshot(ctx, path); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	provider.Set(ctx, "kept", []byte("v2"), time.Hour)
+	provider.Set(ctx, "added", []byte("x"), time.Hour)
+
+	if err := provider.Restore(ctx, path); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	got, found := provider.Get(ctx, "kept")
+	if !found || string(got) != "v1" {
+		t.Errorf("expected restored value 'v1', got %q (found=%v)", got, found)
+	}
+	if _, found := provider.Get(ctx, "added"); found {
+		t.Error("key added after snapshot should be gone")
+	}
+}
+
+// blockingProvider blocks Get until release is closed.
+type blockingProvider struct {
+	*MemoryProvider
+	started chan struct{}
+	release chan struct{}
+	closed  bool
+}
+
+func (provider *blockingProvider) Get(ctx context.Context, key string) ([]byte, bool) {
+	close(provider.started)
+	<-provider.release
+	return provider.MemoryProvider.Get(ctx, key)
+}
+
+func (provider *blockingProvider) Close() error {
+	provider.closed = true
+	return provider.MemoryProvider.Close()
+}
+
+func TestModule_SetProviderDrainsInFlight(t *testing.T) {
+	old := &blockingProvider{MemoryProvider: NewMemoryProvider(), started: make(chan struct{}), release: make(chan struct{})}
+	mod := New(WithProvider(old))
+	ctx := context.Background()
+
+	go mod.Get(ctx, "key")
+	<-old.started
+
+	next := NewMemoryProvider()
+	swapped := make(chan error, 1)
+	go func() { swapped <- mod.SetProvider(ctx, next) }()
+
+	// New operations use the new provider while the old one drains
+	deadline := time.Now().Add(time.Second)
+	for mod.Set(ctx, "key", []byte("new")) == nil {
+		if _, found := next.Get(ctx, "key"); found || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, found := next.Get(ctx, "key"); !found {
+		t.Fatal("expected writes to reach the new provider during the swap")
+	}
+	select {
+	case err := <-swapped:
+		t.Fatalf("SetProvider returned before the in-flight Get finished: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(old.release)
+	if err := <-swapped; err != nil {
+		t.Fatalf("SetProvider failed: %v", err)
+	}
+	if !old.closed {
+		t.Error("expected the old provider to be closed")
+	}
+}
+
+func TestModule_SetProviderErrors(t *testing.T) {
+	mod := New(WithProvider(NewMemoryProvider()))
+	if err := mod.SetProvider(context.Background(), "redis"); !errors.Is(err, ErrInvalidProvider) {
+		t.Errorf("expected ErrInvalidProvider, got %v", err)
+	}
+
+	old := &blockingProvider{MemoryProvider: NewMemoryProvider(), started: make(chan struct{}), release: make(chan struct{})}
+	defer close(old.release)
+	mod = New(WithProvider(old))
+	go mod.Get(context.Background(), "key")
+	<-old.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := mod.SetProvider(ctx, NewMemoryProvider()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the drain to time out, got %v", err)
+	}
+	if old.closed {
+		t.Error("a provider still in use must not be closed")
+	}
+}
+
+func TestTenantCache(t *testing.T) {
+	mod := New(WithProvider(NewMemoryProvider()))
+	tenant := mod.Tenant()
+	acme := chassis.WithTenant(context.Background(), "acme")
+	globex := chassis.WithTenant(context.Background(), "globex")
+
+	if err := tenant.Set(acme, "plan", []byte("pro")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, found := tenant.Get(acme, "plan"); !found || string(value) != "pro" {
+		t.Errorf("expected acme's value, got %q (%v)", value, found)
+	}
+	if _, found := tenant.Get(globex, "plan"); found {
+		t.Error("expected globex not to see acme's value")
+	}
+	if value, found := mod.Get(context.Background(), "org:acme:plan"); !found || string(value) != "pro" {
+		t.Errorf("expected the value under the org prefix, got %q (%v)", value, found)
+	}
+
+	if err := tenant.Set(context.Background(), "plan", nil); !errors.Is(err, chassis.ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+	if _, found := tenant.Get(context.Background(), "plan"); found {
+		t.Error("expected a miss without a tenant")
+	}
+
+	if err := tenant.Delete(acme, "plan"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, found := tenant.Get(acme, "plan"); found {
+		t.Error("expected the value to be deleted")
+	}
+}
+
+func TestModule_StatsAndTTL(t *testing.T) {
+	mod := New()
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	_ = mod.SetWithTTL(ctx, "a", []byte("12345"), time.Hour)
+	_ = mod.SetWithTTL(ctx, "b", []byte("x"), -time.Second) // already expired
+	mod.Get(ctx, "a")
+	mod.Get(ctx, "a")
+	mod.Get(ctx, "b")
+
+	left, found := mod.TTL(ctx, "a")
+	if !found || left <= 59*time.Minute || left > time.Hour {
+		t.Errorf("expected about an hour left, got %v (%v)", left, found)
+	}
+	if _, found := mod.TTL(ctx, "b"); found {
+		t.Error("expected no TTL for an expired entry")
+	}
+
+	mod.sweep(ctx, time.Now())
+	result, err := mod.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	stats := result.(*Stats)
+	if stats.Entries != 1 || stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.Bytes != int64(len("a")+len("12345")+entryOverhead) {
+		t.Errorf("expected the memory estimate of one entry, got %d", stats.Bytes)
+	}
+	if rate := stats.HitRate(); rate < 0.66 || rate > 0.67 {
+		t.Errorf("expected a hit rate of 2/3, got %v", rate)
+	}
+}
+
+func TestModule_AtomicOperations(t *testing.T) {
+	mod := New()
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = mod.IncrWithTTL(ctx, "hits", 2, time.Hour)
+		}()
+	}
+	wg.Wait()
+	if count, err := mod.Decr(ctx, "hits", 1); err != nil || count != 99 {
+		t.Errorf("expected 99 after concurrent increments, got %d (%v)", count, err)
+	}
+	if left, _ := mod.TTL(ctx, "hits"); left <= 59*time.Minute {
+		t.Errorf("expected the counter to keep the TTL it was created with, got %v", left)
+	}
+	_ = mod.Set(ctx, "name", []byte("alice"))
+	if _, err := mod.Incr(ctx, "name", 1); !errors.Is(err, ErrNotCounter) {
+		t.Errorf("expected ErrNotCounter, got %v", err)
+	}
+
+	if ok, err := mod.SetNX(ctx, "lock", []byte("a"), time.Minute); err != nil || !ok {
+		t.Errorf("expected the first SetNX to set the key, got %v (%v)", ok, err)
+	}
+	if ok, _ := mod.SetNX(ctx, "lock", []byte("b"), time.Minute); ok {
+		t.Error("expected SetNX on a set key to fail")
+	}
+	if ok, _ := mod.CompareAndSwap(ctx, "lock", []byte("b"), []byte("c"), time.Minute); ok {
+		t.Error("expected CompareAndSwap with the wrong old value to fail")
+	}
+	if ok, _ := mod.CompareAndSwap(ctx, "lock", []byte("a"), []byte("c"), time.Minute); !ok {
+		t.Error("expected CompareAndSwap with the current value to succeed")
+	}
+	if value, _ := mod.Get(ctx, "lock"); string(value) != "c" {
+		t.Errorf("expected the swapped value, got %q", value)
+	}
+	if ok, _ := mod.CompareAndSwap(ctx, "missing", nil, []byte("x"), time.Minute); ok {
+		t.Error("expected CompareAndSwap on a missing key to fail")
+	}
+
+	_ = mod.SetProvider(ctx, plainProvider{Provider: NewMemoryProvider()})
+	if _, err := mod.Incr(ctx, "hits", 1); !errors.Is(err, ErrAtomicNotSupported) {
+		t.Errorf("expected ErrAtomicNotSupported, got %v", err)
+	}
+}
+
+// plainProvider hides the optional capabilities of the provider it wraps.
+type plainProvider struct {
+	Provider
+}
+
+func TestTieredProvider(t *testing.T) {
+	app := chassis.New(chassis.WithModules(events.New()))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	remote := NewMemoryProvider()
+	defer func() { _ = remote.Close() }()
+	first := NewTieredProvider(remote, WithInvalidator(EventInvalidator(app)))
+	second := NewTieredProvider(remote, WithInvalidator(EventInvalidator(app)))
+	defer func() { _ = first.Close(); _ = second.Close() }()
+
+	if err := first.Set(ctx, "plan", []byte("free"), time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, ok := second.Get(ctx, "plan"); !ok || string(value) != "free" {
+		t.Fatalf("expected the value from the remote tier, got %q (%v)", value, ok)
+	}
+
+	// Served from the local tier without a network hop
+	_ = remote.Delete(ctx, "plan")
+	if value, ok := second.Get(ctx, "plan"); !ok || string(value) != "free" {
+		t.Errorf("expected the local copy, got %q (%v)", value, ok)
+	}
+
+	// Writes invalidate the other instance's copy
+	if err := first.Set(ctx, "plan", []byte("pro"), time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, ok := second.Get(ctx, "plan"); !ok || string(value) != "pro" {
+		t.Errorf("expected the new value after invalidation, got %q (%v)", value, ok)
+	}
+	if err := first.Delete(ctx, "plan"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := second.Get(ctx, "plan"); ok {
+		t.Error("expected the delete to reach the other instance")
+	}
+
+	if count, err := first.Incr(ctx, "hits", 3, time.Hour); err != nil || count != 3 {
+		t.Errorf("expected Incr on the remote tier, got %d (%v)", count, err)
+	}
+	if count, _ := second.Incr(ctx, "hits", 1, time.Hour); count != 4 {
+		t.Errorf("expected a shared counter, got %d", count)
+	}
+}
+
+func TestTieredProvider_LocalSizeAndModuleBinding(t *testing.T) {
+	remote := NewMemoryProvider()
+	defer func() { _ = remote.Close() }()
+	tiered := NewTieredProvider(remote, WithLocalSize(2))
+	mod := New(WithProvider(tiered))
+	app := chassis.New(chassis.WithModules(events.New(), mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		_ = mod.Set(ctx, key, []byte(key))
+	}
+	stats, _ := tiered.Stats(ctx)
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("expected the local tier capped at 2 entries, got %+v", stats)
+	}
+	if value, ok := mod.Get(ctx, "a"); !ok || string(value) != "a" {
+		t.Errorf("expected an evicted key to be read from the remote tier, got %q (%v)", value, ok)
+	}
+
+	// The module wired the events bus as the invalidator
+	_ = remote.Set(ctx, "b", []byte("changed"), time.Hour)
+	app.PublishEvent(ctx, EventInvalidated, &InvalidationEvent{Key: "b", Origin: "other-instance"})
+	if value, _ := mod.Get(ctx, "b"); string(value) != "changed" {
+		t.Errorf("expected the invalidation to drop the local copy, got %q", value)
+	}
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// entryOverhead is the estimated per-entry cost of the memory provider's
+// map and entry struct, on top of the key and value bytes.
+const entryOverhead = 64
+
+// Stats describes the cache. Hits and misses count the module's Get calls
+// since it was created; the rest is reported by the provider, and is zero
+// for providers that don't implement StatsProvider.
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"` // estimated memory use
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"` // entries removed because they expired
+}
+
+// HitRate returns the share of Get calls that found a value, or zero
+// before the first.
+func (stats *Stats) HitRate() float64 {
+	total := stats.Hits + stats.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(total)
+}
+
+// StatsProvider is implemented by providers that can report their size
+// and evictions. MemoryProvider implements it.
+type StatsProvider interface {
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// TTLProvider is implemented by providers that can report how long an
+// entry has left. MemoryProvider implements it.
+type TTLProvider interface {
+	TTL(ctx context.Context, key string) (time.Duration, bool)
+}
+
+// WithStatsLogging has Start log the cache stats every interval.
+func WithStatsLogging(interval time.Duration) Option {
+	return func(mod *Module) {
+		mod.statsInterval = interval
+	}
+}
+
+// Stats reports the cache's size and counters as a *Stats:
+//
+//	stats, err := app.Cache().Stats(ctx)
+//	fmt.Println(stats.(*cache.Stats).HitRate())
+func (mod *Module) Stats(ctx context.Context) (any, error) {
+	provider, release := mod.provider.Acquire()
+	defer release()
+
+	var stats Stats
+	if reporter, ok := provider.(StatsProvider); ok {
+		reported, err := reporter.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stats = reported
+	}
+	stats.Hits = mod.hits.Load()
+	stats.Misses = mod.misses.Load()
+	return &stats, nil
+}
+
+// TTL returns how long the entry at key has left. It reports false if the
+// key is missing or expired, or the provider doesn't implement
+// TTLProvider.
+func (mod *Module) TTL(ctx context.Context, key string) (time.Duration, bool) {
+	provider, release := mod.provider.Acquire()
+	defer release()
+	inspector, ok := provider.(TTLProvider)
+	if !ok {
+		return 0, false
+	}
+	return inspector.TTL(ctx, key)
+}
+
+// logStats logs the cache stats.
+func (mod *Module) logStats(ctx context.Context) {
+	stats, err := mod.Stats(ctx)
+	if err != nil {
+		mod.app.Logger().Error("failed to read cache stats", "error", err)
+		return
+	}
+	current := stats.(*Stats)
+	mod.app.Logger().Info("cache stats",
+		"entries", current.Entries,
+		"bytes", current.Bytes,
+		"hits", current.Hits,
+		"misses", current.Misses,
+		"hit_rate", current.HitRate(),
+		"evictions", current.Evictions,
+	)
+}
+
+// Stats counts the live entries and estimates their memory use.
+func (provider *MemoryProvider) Stats(ctx context.Context) (Stats, error) {
+	provider.mu.RLock()
+	defer provider.mu.RUnlock()
+	now := time.Now()
+	stats := Stats{Evictions: provider.evictions.Load()}
+	for key, entry := range provider.entries {
+		if now.After(entry.expiresAt) {
+			continue
+		}
+		stats.Entries++
+		stats.Bytes += int64(len(key) + len(entry.value) + entryOverhead)
+	}
+	return stats, nil
+}
+
+// TTL returns how long the entry at key has left.
+func (provider *MemoryProvider) TTL(ctx context.Context, key string) (time.Duration, bool) {
+	provider.mu.RLock()
+	defer provider.mu.RUnlock()
+	entry, ok := provider.entries[key]
+	if !ok {
+		return 0, false
+	}
+	left := time.Until(entry.expiresAt)
+	if left < 0 {
+		return 0, false
+	}
+	return left, true
+}
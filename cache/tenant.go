@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// TenantCache is a view of the module scoped to the tenant of each call's
+// context; see chassis.WithTenant. Keys are prefixed with "org:<org ID>:",
+// so orgs caching the same key don't see each other's values. Writes
+// without a tenant fail with chassis.ErrNoTenant and reads miss.
+type TenantCache struct {
+	mod *Module
+}
+
+// Tenant returns the tenant-scoped view of the module.
+func (mod *Module) Tenant() *TenantCache {
+	return &TenantCache{mod: mod}
+}
+
+// key returns the full key of key for the tenant of ctx.
+func (tenant *TenantCache) key(ctx context.Context, key string) (string, error) {
+	orgID, err := chassis.RequireTenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "org:" + orgID + ":" + key, nil
+}
+
+// Get retrieves the tenant's value of key.
+func (tenant *TenantCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return nil, false
+	}
+	return tenant.mod.Get(ctx, key)
+}
+
+// Set stores the tenant's value of key with the default TTL.
+func (tenant *TenantCache) Set(ctx context.Context, key string, value []byte) error {
+	return tenant.SetWithTTL(ctx, key, value, tenant.mod.defaultTTL)
+}
+
+// SetWithTTL stores the tenant's value of key with a custom TTL.
+func (tenant *TenantCache) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.SetWithTTL(ctx, key, value, ttl)
+}
+
+// Incr adds delta to the tenant's counter at key.
+func (tenant *TenantCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return tenant.mod.Incr(ctx, key, delta)
+}
+
+// SetNX stores the tenant's value of key unless it is already set.
+func (tenant *TenantCache) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return tenant.mod.SetNX(ctx, key, value, ttl)
+}
+
+// Delete removes the tenant's value of key.
+func (tenant *TenantCache) Delete(ctx context.Context, key string) error {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.Delete(ctx, key)
+}
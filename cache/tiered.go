@@ -0,0 +1,397 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/talosaether/chassis"
+)
+
+// EventInvalidated is published by TieredProvider, with an
+// *InvalidationEvent, when a key changes.
+const EventInvalidated = "cache.invalidated"
+
+// Defaults of TieredProvider's local tier.
+const (
+	DefaultLocalSize = 10000
+	DefaultLocalTTL  = 30 * time.Second
+)
+
+// InvalidationEvent tells other instances to drop their local copy of Key,
+// or of every key if Key is empty.
+type InvalidationEvent struct {
+	Key    string `json:"key"`
+	Origin string `json:"origin"` // the publishing TieredProvider
+}
+
+// Invalidator fans key invalidations out to the TieredProviders of other
+// instances. Use EventInvalidator, or implement it with e.g. Redis pub/sub.
+type Invalidator interface {
+	// Invalidate tells the other instances to drop key, or every key if
+	// key is empty.
+	Invalidate(ctx context.Context, event *InvalidationEvent) error
+	// OnInvalidate calls handler for every invalidation, including this
+	// instance's own, until the returned function is called.
+	OnInvalidate(handler func(event *InvalidationEvent)) func()
+}
+
+// TieredProvider is a two-level cache: an in-process LRU in front of a
+// shared remote provider such as Redis. Reads are served locally when they
+// can, so hot keys skip the network; writes go through to the remote
+// provider, and are fanned out to the other instances by the Invalidator
+// so they drop their stale copies. Local copies live at most the local
+// TTL, which bounds staleness when an invalidation is lost.
+type TieredProvider struct {
+	remote   Provider
+	local    *lru
+	localTTL time.Duration
+	origin   string
+
+	mu          sync.Mutex
+	invalidator Invalidator
+	unsubscribe func()
+}
+
+// TieredOption configures a TieredProvider.
+type TieredOption func(*TieredProvider)
+
+// WithLocalSize caps the entries kept in process. Defaults to
+// DefaultLocalSize.
+func WithLocalSize(size int) TieredOption {
+	return func(tiered *TieredProvider) {
+		if size > 0 {
+			tiered.local.size = size
+		}
+	}
+}
+
+// WithLocalTTL caps how long a value is served from process memory.
+// Defaults to DefaultLocalTTL.
+func WithLocalTTL(ttl time.Duration) TieredOption {
+	return func(tiered *TieredProvider) {
+		if ttl > 0 {
+			tiered.localTTL = ttl
+		}
+	}
+}
+
+// WithInvalidator sets how invalidations reach other instances. Without it
+// the cache module uses EventInvalidator when the events module is
+// registered before it.
+func WithInvalidator(invalidator Invalidator) TieredOption {
+	return func(tiered *TieredProvider) {
+		tiered.invalidator = invalidator
+	}
+}
+
+// NewTieredProvider puts an in-process LRU in front of remote:
+//
+//	cache.New(cache.WithProvider(cache.NewTieredProvider(redisProvider,
+//	    cache.WithLocalSize(50000),
+//	    cache.WithLocalTTL(10*time.Second),
+//	)))
+func NewTieredProvider(remote Provider, opts ...TieredOption) *TieredProvider {
+	tiered := &TieredProvider{
+		remote:   remote,
+		local:    newLRU(DefaultLocalSize),
+		localTTL: DefaultLocalTTL,
+		origin:   uuid.NewString(),
+	}
+	for _, opt := range opts {
+		opt(tiered)
+	}
+	tiered.listen()
+	return tiered
+}
+
+// setInvalidator installs invalidator unless one was set.
+func (tiered *TieredProvider) setInvalidator(invalidator Invalidator) {
+	tiered.mu.Lock()
+	if tiered.invalidator != nil {
+		tiered.mu.Unlock()
+		return
+	}
+	tiered.invalidator = invalidator
+	tiered.mu.Unlock()
+	tiered.listen()
+}
+
+// listen drops local copies when other instances invalidate them.
+func (tiered *TieredProvider) listen() {
+	tiered.mu.Lock()
+	defer tiered.mu.Unlock()
+	if tiered.invalidator == nil || tiered.unsubscribe != nil {
+		return
+	}
+	tiered.unsubscribe = tiered.invalidator.OnInvalidate(func(event *InvalidationEvent) {
+		if event.Origin == tiered.origin {
+			return
+		}
+		if event.Key == "" {
+			tiered.local.clear()
+			return
+		}
+		tiered.local.remove(event.Key)
+	})
+}
+
+// invalidate tells the other instances that key changed.
+func (tiered *TieredProvider) invalidate(ctx context.Context, key string) error {
+	tiered.mu.Lock()
+	invalidator := tiered.invalidator
+	tiered.mu.Unlock()
+	if invalidator == nil {
+		return nil
+	}
+	if err := invalidator.Invalidate(ctx, &InvalidationEvent{Key: key, Origin: tiered.origin}); err != nil {
+		return fmt.Errorf("failed to invalidate cache key: %w", err)
+	}
+	return nil
+}
+
+// Get serves key from process memory, or from the remote provider, keeping
+// a local copy.
+func (tiered *TieredProvider) Get(ctx context.Context, key string) ([]byte, bool) {
+	if value, ok := tiered.local.get(key); ok {
+		return value, true
+	}
+	value, ok := tiered.remote.Get(ctx, key)
+	if !ok {
+		return nil, false
+	}
+	ttl := tiered.localTTL
+	if inspector, isInspector := tiered.remote.(TTLProvider); isInspector {
+		if left, found := inspector.TTL(ctx, key); found {
+			ttl = min(ttl, left)
+		}
+	}
+	tiered.local.set(key, value, ttl)
+	return value, true
+}
+
+// Set writes value through to the remote provider and invalidates other
+// instances' copies.
+func (tiered *TieredProvider) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := tiered.remote.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	tiered.local.set(key, value, min(ttl, tiered.localTTL))
+	return tiered.invalidate(ctx, key)
+}
+
+// Delete deletes key everywhere.
+func (tiered *TieredProvider) Delete(ctx context.Context, key string) error {
+	tiered.local.remove(key)
+	if err := tiered.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+	return tiered.invalidate(ctx, key)
+}
+
+// Clear clears the remote provider and every instance's local tier.
+func (tiered *TieredProvider) Clear(ctx context.Context) error {
+	tiered.local.clear()
+	if err := tiered.remote.Clear(ctx); err != nil {
+		return err
+	}
+	return tiered.invalidate(ctx, "")
+}
+
+// Incr runs on the remote provider, so counters are shared by every
+// instance, and isn't cached locally.
+func (tiered *TieredProvider) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	remote, ok := tiered.remote.(AtomicProvider)
+	if !ok {
+		return 0, fmt.Errorf("%w: %T", ErrAtomicNotSupported, tiered.remote)
+	}
+	tiered.local.remove(key)
+	return remote.Incr(ctx, key, delta, ttl)
+}
+
+// SetNX runs on the remote provider.
+func (tiered *TieredProvider) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	remote, ok := tiered.remote.(AtomicProvider)
+	if !ok {
+		return false, fmt.Errorf("%w: %T", ErrAtomicNotSupported, tiered.remote)
+	}
+	return remote.SetNX(ctx, key, value, ttl)
+}
+
+// CompareAndSwap runs on the remote provider and invalidates the key when
+// it swaps.
+func (tiered *TieredProvider) CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	remote, ok := tiered.remote.(AtomicProvider)
+	if !ok {
+		return false, fmt.Errorf("%w: %T", ErrAtomicNotSupported, tiered.remote)
+	}
+	tiered.local.remove(key)
+	swapped, err := remote.CompareAndSwap(ctx, key, old, value, ttl)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	return true, tiered.invalidate(ctx, key)
+}
+
+// TTL delegates to the remote provider.
+func (tiered *TieredProvider) TTL(ctx context.Context, key string) (time.Duration, bool) {
+	if inspector, ok := tiered.remote.(TTLProvider); ok {
+		return inspector.TTL(ctx, key)
+	}
+	return 0, false
+}
+
+// Stats reports the local tier: its entries, their estimated memory use,
+// and the entries evicted to stay within the local size.
+func (tiered *TieredProvider) Stats(ctx context.Context) (Stats, error) {
+	return tiered.local.stats(), nil
+}
+
+// Close stops listening for invalidations and closes the remote provider
+// if it is an io.Closer.
+func (tiered *TieredProvider) Close() error {
+	tiered.mu.Lock()
+	if tiered.unsubscribe != nil {
+		tiered.unsubscribe()
+		tiered.unsubscribe = nil
+	}
+	tiered.mu.Unlock()
+	if closer, ok := tiered.remote.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// bind fans a TieredProvider's invalidations out over the events bus
+// unless it has its own Invalidator.
+func (mod *Module) bind(provider Provider) {
+	if _, hasEvents := mod.app.TryEvents(); hasEvents {
+		if tiered, ok := provider.(*TieredProvider); ok {
+			tiered.setInvalidator(EventInvalidator(mod.app))
+		}
+	}
+}
+
+// EventInvalidator fans invalidations out over the app's events bus as
+// EventInvalidated. The bus only reaches other instances when it is
+// bridged to a broker; otherwise it just keeps several TieredProviders in
+// one process consistent.
+func EventInvalidator(app *chassis.App) Invalidator {
+	return eventInvalidator{app: app}
+}
+
+type eventInvalidator struct {
+	app *chassis.App
+}
+
+func (invalidator eventInvalidator) Invalidate(ctx context.Context, event *InvalidationEvent) error {
+	invalidator.app.PublishEvent(ctx, EventInvalidated, event)
+	return nil
+}
+
+func (invalidator eventInvalidator) OnInvalidate(handler func(event *InvalidationEvent)) func() {
+	eventsMod, ok := invalidator.app.TryEvents()
+	if !ok {
+		return func() {}
+	}
+	return eventsMod.Subscribe(EventInvalidated, func(ctx context.Context, eventType string, payload any) error {
+		event, ok := payload.(*InvalidationEvent)
+		if !ok {
+			return errors.New("cache: invalidation payload is not an *InvalidationEvent")
+		}
+		handler(event)
+		return nil
+	})
+}
+
+// lru is a size-bounded map of entries, evicting the least recently used.
+type lru struct {
+	mu        sync.Mutex
+	size      int
+	order     *list.List // front is most recently used
+	items     map[string]*list.Element
+	evictions atomic.Uint64
+}
+
+type lruEntry struct {
+	key string
+	cacheEntry
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (cache *lru) get(key string) ([]byte, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	element, ok := cache.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		cache.order.Remove(element)
+		delete(cache.items, key)
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (cache *lru) set(key string, value []byte, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entry := &lruEntry{key: key, cacheEntry: cacheEntry{value: value, expiresAt: time.Now().Add(ttl)}}
+	if element, ok := cache.items[key]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.items[key] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*lruEntry).key)
+		cache.evictions.Add(1)
+	}
+}
+
+func (cache *lru) remove(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.items[key]; ok {
+		cache.order.Remove(element)
+		delete(cache.items, key)
+	}
+}
+
+func (cache *lru) clear() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.order.Init()
+	cache.items = make(map[string]*list.Element)
+}
+
+func (cache *lru) stats() Stats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	stats := Stats{Evictions: cache.evictions.Load()}
+	now := time.Now()
+	for key, element := range cache.items {
+		entry := element.Value.(*lruEntry)
+		if now.After(entry.expiresAt) {
+			continue
+		}
+		stats.Entries++
+		stats.Bytes += int64(len(key) + len(entry.value) + entryOverhead)
+	}
+	return stats
+}
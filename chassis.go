@@ -2,10 +2,15 @@ package chassis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
 	"sync"
+	"time"
 )
 
 // App is the central chassis instance that holds all registered modules.
@@ -13,10 +18,22 @@ import (
 type App struct {
 	mu         sync.RWMutex
 	modules    map[string]Module
+	order      []string // module names in registration order
 	config     *Config
+	configMu   sync.RWMutex // guards configData, which RefreshConfig replaces
 	configData ConfigData
+	secretKeys []string // config paths masked in dumps, see WithSecretKeys
+	sources    configSources
+	optionErrs []error // config and registration failures, reported by Build
+	panics     panicCounts
+	databases  databasePools
+	factories  map[string]ModuleFactory // see WithModuleFactory
 	logger     *slog.Logger
 
+	shutdownTimeout time.Duration
+	servicesMu      sync.Mutex
+	services        []*ServiceStatus // set by Run
+
 	// Module accessors (populated during registration)
 	storage     StorageModule
 	users       UsersModule
@@ -27,6 +44,8 @@ type App struct {
 	queue       QueueModule
 	email       EmailModule
 	events      EventsModule
+	realtime    RealtimeModule
+	keys        KeysModule
 }
 
 // StorageModule is the interface exposed by the storage module.
@@ -37,6 +56,13 @@ type StorageModule interface {
 	Get(ctx context.Context, key string) ([]byte, error)
 	Delete(ctx context.Context, key string) error
 	List(ctx context.Context, prefix string) ([]string, error)
+	PutReader(ctx context.Context, key string, reader io.Reader, size int64) error
+	GetReader(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Copy(ctx context.Context, src, dst string) error
+	Move(ctx context.Context, src, dst string) error
+	Usage(ctx context.Context, prefix string) (int64, error)
+	SignedURL(ctx context.Context, key string, ttl time.Duration, method string) (string, error)
 }
 
 // UsersModule is the interface exposed by the users module.
@@ -47,26 +73,41 @@ type UsersModule interface {
 	GetByID(ctx context.Context, id string) (any, error)
 	GetByEmail(ctx context.Context, email string) (any, error)
 	Authenticate(ctx context.Context, email, password string) (any, error)
+	UpdateProfile(ctx context.Context, id string, input any) (any, error)
+	CheckPassword(password string) (score int, err error)
+	LinkIdentity(ctx context.Context, userID string, input any) (any, error)
+	UnlinkIdentity(ctx context.Context, userID, provider, subject string) error
+	ExportData(ctx context.Context, userID string, writer io.Writer) error
+	Erase(ctx context.Context, userID string) (any, error)
 }
 
 // AuthModule is the interface exposed by the auth module.
 type AuthModule interface {
 	Module
 	GetUserID(ctx context.Context, request any) string
+	LoginHistory(ctx context.Context, userID string, page any) (any, error)
 }
 
 // OrgsModule is the interface exposed by the orgs module.
 type OrgsModule interface {
 	Module
 	Create(ctx context.Context, input any) (any, error)
+	CreateChild(ctx context.Context, parentID string, input any) (any, error)
 	GetByID(ctx context.Context, orgID string) (any, error)
 	Update(ctx context.Context, orgID string, input any) (any, error)
 	Delete(ctx context.Context, orgID string) error
+	Undelete(ctx context.Context, orgID string) error
 	AddMember(ctx context.Context, orgID, userID, role string) (any, error)
+	AddMemberUntil(ctx context.Context, orgID, userID, role string, until time.Time) (any, error)
 	RemoveMember(ctx context.Context, orgID, userID string) error
+	TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID string) error
 	GetMembers(ctx context.Context, orgID string) (any, error)
 	GetUserOrgs(ctx context.Context, userID string) (any, error)
 	GetUserRole(ctx context.Context, orgID, userID string) string
+	GetUserRoles(ctx context.Context, orgID, userID string) []string
+	Invite(ctx context.Context, orgID, email, role string) (any, error)
+	AcceptInvite(ctx context.Context, token, userID string) (any, error)
+	Export(ctx context.Context, orgID string, writer io.Writer) error
 }
 
 // PermissionsModule is the interface exposed by the permissions module.
@@ -75,6 +116,10 @@ type PermissionsModule interface {
 	Can(ctx context.Context, userID, permission, resourceID string) bool
 	RoleHasPermission(role, permission string) bool
 	HasRole(ctx context.Context, userID, role, resourceID string) bool
+	Grant(ctx context.Context, userID, resource, permission string) error
+	Revoke(ctx context.Context, userID, resource, permission string) error
+	Explain(ctx context.Context, userID, permission, resourceID string) any
+	Require(permission string, resourceID func(*http.Request) string) func(http.Handler) http.Handler
 }
 
 // CacheModule is the interface exposed by the cache module.
@@ -84,6 +129,13 @@ type CacheModule interface {
 	Set(ctx context.Context, key string, value []byte) error
 	Delete(ctx context.Context, key string) error
 	Clear(ctx context.Context) error
+	SetProvider(ctx context.Context, provider any) error
+	Stats(ctx context.Context) (any, error)
+	TTL(ctx context.Context, key string) (time.Duration, bool)
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+	Decr(ctx context.Context, key string, delta int64) (int64, error)
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error)
 }
 
 // QueueModule is the interface exposed by the queue module.
@@ -104,14 +156,37 @@ type QueueModule interface {
 type EmailModule interface {
 	Module
 	Send(ctx context.Context, to, subject, body string) error
+	SendMessage(ctx context.Context, message any) error
+	SendAsync(ctx context.Context, message any) error
+	SendTemplate(ctx context.Context, to, name string, data any) error
+	SetProvider(ctx context.Context, provider any) error
 }
 
 // EventsModule is the interface exposed by the events module.
 type EventsModule interface {
 	Module
 	Subscribe(eventType string, handler any) func()
+	SubscribeFiltered(eventType string, predicate func(payload any) bool, handler any) func()
 	Publish(ctx context.Context, eventType string, payload any)
 	PublishAsync(ctx context.Context, eventType string, payload any)
+	Recent(eventType string, limit int) any
+}
+
+// RealtimeModule is the interface exposed by the realtime module.
+type RealtimeModule interface {
+	Module
+	Heartbeat(ctx context.Context, orgID, userID string) error
+	Disconnect(ctx context.Context, orgID, userID string) error
+	Presence(ctx context.Context, orgID string) (any, error)
+	Push(ctx context.Context, userID string, payload any) error
+}
+
+// KeysModule is the interface exposed by the keys module.
+type KeysModule interface {
+	Module
+	Encrypt(ctx context.Context, orgID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, orgID string, ciphertext []byte) ([]byte, error)
+	Revoke(ctx context.Context, orgID string) error
 }
 
 // Config holds chassis configuration.
@@ -127,14 +202,19 @@ type Option func(*App)
 // New creates a new chassis App with the given options.
 func New(opts ...Option) *App {
 	app := &App{
-		modules: make(map[string]Module),
+		modules:   make(map[string]Module),
+		factories: make(map[string]ModuleFactory),
+		databases: databasePools{
+			openers: map[string]DatabaseOpener{"sqlite": openSQLite},
+		},
+		secretKeys: slices.Clone(databaseSecrets),
 		config: &Config{
 			Env:      "development",
 			LogLevel: slog.LevelInfo,
 		},
-		logger: slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		logger: slog.New(NewLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 			Level: slog.LevelInfo,
-		})),
+		}))),
 	}
 
 	for _, opt := range opts {
@@ -144,50 +224,90 @@ func New(opts ...Option) *App {
 	return app
 }
 
+// Build is New for apps that must not start half-wired. New logs a config
+// file that fails to load or a module that fails to register and carries
+// on without it; Build applies every option the same way, then, if any
+// failed, shuts down the modules that did register and returns all the
+// failures joined:
+//
+//	app, err := chassis.Build(chassis.WithConfigFile("./config.yaml"), chassis.WithModules(...))
+//	if err != nil {
+//	    log.Fatal(err) // every failed module, not just the first
+//	}
+func Build(opts ...Option) (*App, error) {
+	app := New(opts...)
+	if len(app.optionErrs) == 0 {
+		return app, nil
+	}
+	err := errors.Join(app.optionErrs...)
+	if shutdownErr := app.Shutdown(context.Background()); shutdownErr != nil {
+		err = errors.Join(err, shutdownErr)
+	}
+	return nil, err
+}
+
 // WithConfig sets configuration options.
 func WithConfig(cfg *Config) Option {
 	return func(app *App) {
 		app.config = cfg
 		// Update logger level if config specifies it
-		app.logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		app.logger = slog.New(NewLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 			Level: cfg.LogLevel,
-		}))
+		})))
 	}
 }
 
 // WithConfigFile loads configuration from a YAML file.
 // Environment variables in ${VAR} or ${VAR:-default} format are expanded.
 func WithConfigFile(path string) Option {
+	return WithConfigFiles(path)
+}
+
+// WithConfigFiles loads configuration from YAML files layered with
+// LoadConfigFiles: each file is deep-merged over the ones before it, and
+// files after the first are skipped if they don't exist. Combine it with
+// ConfigPaths to let --config or CHASSIS_CONFIG pick the files.
+func WithConfigFiles(paths ...string) Option {
 	return func(app *App) {
-		data, err := LoadConfig(path)
+		data, err := LoadConfigFiles(paths...)
 		if err != nil {
-			app.logger.Error("failed to load config file", "path", path, "error", err)
+			app.logger.Error("failed to load config file", "paths", paths, "error", err)
+			app.optionErrs = append(app.optionErrs, err)
 			return
 		}
 		app.configData = data
+		app.applyChassisConfig(data)
+		app.logger.Info("config loaded", "paths", paths, "secrets", data.SecretPaths(app.secretKeys...))
+	}
+}
 
-		// Apply chassis-level config if present
-		if chassisSection := data.Section("chassis"); chassisSection != nil {
-			if env := chassisSection.GetString("env"); env != "" {
-				app.config.Env = env
+// applyChassisConfig applies the chassis section of loaded config, if
+// present.
+func (app *App) applyChassisConfig(data ConfigData) {
+	if chassisSection := data.Section("chassis"); chassisSection != nil {
+		if env := chassisSection.GetString("env"); env != "" {
+			app.config.Env = env
+		}
+		if timeout := chassisSection.GetString("shutdown_timeout"); timeout != "" {
+			if parsed, err := time.ParseDuration(timeout); err == nil {
+				app.shutdownTimeout = parsed
 			}
-			if logLevel := chassisSection.GetString("log_level"); logLevel != "" {
-				var level slog.Level
-				if err := level.UnmarshalText([]byte(logLevel)); err == nil {
-					app.config.LogLevel = level
-					app.logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-						Level: level,
-					}))
-				}
+		}
+		if logLevel := chassisSection.GetString("log_level"); logLevel != "" {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(logLevel)); err == nil {
+				app.config.LogLevel = level
+				app.logger = slog.New(NewLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+					Level: level,
+				})))
 			}
 		}
-
-		app.logger.Info("config loaded", "path", path)
 	}
 }
 
 // WithModules registers modules with the chassis.
-// Modules are initialized in the order provided.
+// Modules are initialized in the order provided, so dependencies must
+// come before the modules that need them.
 func WithModules(modules ...Module) Option {
 	return func(app *App) {
 		ctx := context.Background()
@@ -197,6 +317,65 @@ func WithModules(modules ...Module) Option {
 					"module", mod.Name(),
 					"error", err,
 				)
+				app.optionErrs = append(app.optionErrs, err)
+			}
+		}
+	}
+}
+
+// WithModuleFactory sets how WithConfiguredModules creates the module
+// name, so config can list it. Setting a name again replaces its factory,
+// e.g. to create a built-in module with options config can't express. It
+// must come before WithConfiguredModules.
+func WithModuleFactory(name string, factory ModuleFactory) Option {
+	return func(app *App) {
+		app.factories[name] = factory
+	}
+}
+
+// WithModuleFactories sets several module factories at once, such as the
+// built-in modules' from builtin.Factories:
+//
+//	chassis.WithModuleFactories(builtin.Factories())
+func WithModuleFactories(factories map[string]ModuleFactory) Option {
+	return func(app *App) {
+		for name, factory := range factories {
+			app.factories[name] = factory
+		}
+	}
+}
+
+// WithConfiguredModules registers the modules listed under modules in the
+// config loaded by earlier options, in order, creating each with the
+// factory set by an earlier WithModuleFactory or WithModuleFactories:
+//
+//	modules: [storage, users, auth, mymodule]
+//
+// Modules already registered, e.g. by an earlier WithModules, are skipped,
+// so code can register some modules with options and leave the rest to
+// config. A name without a factory fails with ErrUnknownModule. Without a
+// modules list nothing is registered.
+func WithConfiguredModules() Option {
+	return func(app *App) {
+		if app.configData == nil {
+			return
+		}
+		ctx := context.Background()
+		for _, name := range app.configData.GetStringSlice("modules") {
+			if app.HasModule(name) {
+				continue
+			}
+			factory, ok := app.factories[name]
+			if !ok {
+				err := fmt.Errorf("%w: %s", ErrUnknownModule, name)
+				app.logger.Error("failed to register module", "module", name, "error", err)
+				app.optionErrs = append(app.optionErrs, err)
+				continue
+			}
+			mod := factory()
+			if err := app.Register(ctx, mod); err != nil {
+				app.logger.Error("failed to register module", "module", name, "error", err)
+				app.optionErrs = append(app.optionErrs, err)
 			}
 		}
 	}
@@ -204,20 +383,32 @@ func WithModules(modules ...Module) Option {
 
 // Register adds a module to the chassis and initializes it.
 func (app *App) Register(ctx context.Context, mod Module) error {
-	app.mu.Lock()
-	defer app.mu.Unlock()
-
 	name := mod.Name()
-	if _, exists := app.modules[name]; exists {
+	if app.HasModule(name) {
 		return fmt.Errorf("module %q already registered", name)
 	}
 
-	// Initialize the module
-	if err := mod.Init(ctx, app); err != nil {
+	if err := app.checkDependencies(mod); err != nil {
+		return err
+	}
+
+	// Initialize without holding the lock so Init can query the app
+	// (e.g., HasModule) for modules registered before it
+	if err := app.initModule(ctx, mod); err != nil {
 		return fmt.Errorf("failed to initialize module %q: %w", name, err)
 	}
 
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if _, exists := app.modules[name]; exists {
+		return fmt.Errorf("module %q already registered", name)
+	}
 	app.modules[name] = mod
+	app.order = append(app.order, name)
+	if keyer, ok := mod.(SecretKeyer); ok {
+		app.secretKeys = append(app.secretKeys, keyer.SecretKeys()...)
+	}
 	app.logger.Info("module registered", "module", name)
 
 	// Wire up typed accessors for known modules
@@ -248,17 +439,30 @@ func (app *App) Register(ctx context.Context, mod Module) error {
 	if eventsMod, ok := mod.(EventsModule); ok {
 		app.events = eventsMod
 	}
+	if realtimeMod, ok := mod.(RealtimeModule); ok {
+		app.realtime = realtimeMod
+	}
+	if keysMod, ok := mod.(KeysModule); ok {
+		app.keys = keysMod
+	}
 
 	return nil
 }
 
 // Shutdown gracefully stops all modules in reverse registration order.
 func (app *App) Shutdown(ctx context.Context) error {
-	app.mu.Lock()
-	defer app.mu.Unlock()
+	// Shut down without holding the lock: modules may wait for background
+	// goroutines that are themselves calling into the app (e.g., PublishEvent)
+	app.mu.RLock()
+	modules := make([]Module, 0, len(app.order))
+	for i := len(app.order) - 1; i >= 0; i-- {
+		modules = append(modules, app.modules[app.order[i]])
+	}
+	app.mu.RUnlock()
 
 	var errs []error
-	for name, mod := range app.modules {
+	for _, mod := range modules {
+		name := mod.Name()
 		if err := mod.Shutdown(ctx); err != nil {
 			app.logger.Error("failed to shutdown module",
 				"module", name,
@@ -270,6 +474,12 @@ func (app *App) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Modules may flush to their databases on shutdown, so close them last
+	if err := app.closeDatabases(); err != nil {
+		app.logger.Error("failed to close databases", "error", err)
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return fmt.Errorf("shutdown errors: %v", errs)
 	}
@@ -285,6 +495,15 @@ func (app *App) Storage() StorageModule {
 	return app.storage
 }
 
+// TryStorage returns the storage module API and true, or false if the storage
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryStorage() (StorageModule, bool) {
+	if app == nil || app.storage == nil {
+		return nil, false
+	}
+	return app.storage, true
+}
+
 // Users returns the users module API.
 // Panics if users module is not registered.
 func (app *App) Users() UsersModule {
@@ -294,6 +513,15 @@ func (app *App) Users() UsersModule {
 	return app.users
 }
 
+// TryUsers returns the users module API and true, or false if the users
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryUsers() (UsersModule, bool) {
+	if app == nil || app.users == nil {
+		return nil, false
+	}
+	return app.users, true
+}
+
 // Auth returns the auth module API.
 // Panics if auth module is not registered.
 func (app *App) Auth() AuthModule {
@@ -303,6 +531,15 @@ func (app *App) Auth() AuthModule {
 	return app.auth
 }
 
+// TryAuth returns the auth module API and true, or false if the auth
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryAuth() (AuthModule, bool) {
+	if app == nil || app.auth == nil {
+		return nil, false
+	}
+	return app.auth, true
+}
+
 // Orgs returns the orgs module API.
 // Panics if orgs module is not registered.
 func (app *App) Orgs() OrgsModule {
@@ -312,6 +549,15 @@ func (app *App) Orgs() OrgsModule {
 	return app.orgs
 }
 
+// TryOrgs returns the orgs module API and true, or false if the orgs
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryOrgs() (OrgsModule, bool) {
+	if app == nil || app.orgs == nil {
+		return nil, false
+	}
+	return app.orgs, true
+}
+
 // Permissions returns the permissions module API.
 // Panics if permissions module is not registered.
 func (app *App) Permissions() PermissionsModule {
@@ -321,6 +567,15 @@ func (app *App) Permissions() PermissionsModule {
 	return app.permissions
 }
 
+// TryPermissions returns the permissions module API and true, or false if
+// the permissions module is not registered. Safe to call on a nil app.
+func (app *App) TryPermissions() (PermissionsModule, bool) {
+	if app == nil || app.permissions == nil {
+		return nil, false
+	}
+	return app.permissions, true
+}
+
 // Cache returns the cache module API.
 // Panics if cache module is not registered.
 func (app *App) Cache() CacheModule {
@@ -330,6 +585,15 @@ func (app *App) Cache() CacheModule {
 	return app.cache
 }
 
+// TryCache returns the cache module API and true, or false if the cache
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryCache() (CacheModule, bool) {
+	if app == nil || app.cache == nil {
+		return nil, false
+	}
+	return app.cache, true
+}
+
 // Queue returns the queue module API.
 // Panics if queue module is not registered.
 func (app *App) Queue() QueueModule {
@@ -339,6 +603,15 @@ func (app *App) Queue() QueueModule {
 	return app.queue
 }
 
+// TryQueue returns the queue module API and true, or false if the queue
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryQueue() (QueueModule, bool) {
+	if app == nil || app.queue == nil {
+		return nil, false
+	}
+	return app.queue, true
+}
+
 // Email returns the email module API.
 // Panics if email module is not registered.
 func (app *App) Email() EmailModule {
@@ -348,6 +621,15 @@ func (app *App) Email() EmailModule {
 	return app.email
 }
 
+// TryEmail returns the email module API and true, or false if the email
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryEmail() (EmailModule, bool) {
+	if app == nil || app.email == nil {
+		return nil, false
+	}
+	return app.email, true
+}
+
 // Events returns the events module API.
 // Panics if events module is not registered.
 func (app *App) Events() EventsModule {
@@ -357,6 +639,80 @@ func (app *App) Events() EventsModule {
 	return app.events
 }
 
+// TryEvents returns the events module API and true, or false if the events
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryEvents() (EventsModule, bool) {
+	if app == nil || app.events == nil {
+		return nil, false
+	}
+	return app.events, true
+}
+
+// Realtime returns the realtime module API.
+// Panics if realtime module is not registered.
+func (app *App) Realtime() RealtimeModule {
+	if app.realtime == nil {
+		panic("realtime module not registered")
+	}
+	return app.realtime
+}
+
+// TryRealtime returns the realtime module API and true, or false if the
+// realtime module is not registered. Safe to call on a nil app.
+func (app *App) TryRealtime() (RealtimeModule, bool) {
+	if app == nil || app.realtime == nil {
+		return nil, false
+	}
+	return app.realtime, true
+}
+
+// Keys returns the keys module API.
+// Panics if keys module is not registered.
+func (app *App) Keys() KeysModule {
+	if app.keys == nil {
+		panic("keys module not registered")
+	}
+	return app.keys
+}
+
+// TryKeys returns the keys module API and true, or false if the keys
+// module is not registered. Safe to call on a nil app.
+func (app *App) TryKeys() (KeysModule, bool) {
+	if app == nil || app.keys == nil {
+		return nil, false
+	}
+	return app.keys, true
+}
+
+// HasModule reports whether a module with the given name is registered.
+// Use it to make optional integrations between modules, e.g. publishing
+// events only when the events module is present. To call a core module
+// that may be missing, prefer its Try accessor (e.g. TryQueue), which also
+// checks that the module implements the core interface.
+func (app *App) HasModule(name string) bool {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	_, exists := app.modules[name]
+	return exists
+}
+
+// PublishEvent publishes an event if the events module is registered and
+// does nothing otherwise. Modules use it to emit lifecycle events without
+// requiring the events module. It is safe to call on a nil App, which
+// happens for modules used in tests without being registered.
+func (app *App) PublishEvent(ctx context.Context, eventType string, payload any) {
+	if app == nil {
+		return
+	}
+	app.mu.RLock()
+	events := app.events
+	app.mu.RUnlock()
+
+	if events != nil {
+		events.Publish(ctx, eventType, payload)
+	}
+}
+
 // Logger returns the chassis logger for use by modules and application code.
 func (app *App) Logger() *slog.Logger {
 	return app.logger
@@ -370,5 +726,7 @@ func (app *App) Config() *Config {
 // ConfigData returns the raw configuration data loaded from file.
 // Returns nil if no config file was loaded.
 func (app *App) ConfigData() ConfigData {
+	app.configMu.RLock()
+	defer app.configMu.RUnlock()
 	return app.configData
 }
@@ -0,0 +1,93 @@
+package chassis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Issue is a consistency problem found by a module's checker.
+type Issue struct {
+	// Module is the module that owns the inconsistent data.
+	Module string `json:"module"`
+
+	// Kind classifies the problem (e.g., "orphaned_membership").
+	Kind string `json:"kind"`
+
+	// Resource is the ID of the inconsistent record.
+	Resource string `json:"resource"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+
+	// Repair describes what Fix will do. Empty if the issue can't be fixed automatically.
+	Repair string `json:"repair,omitempty"`
+
+	// Fix repairs the issue. Nil if the issue needs manual attention.
+	Fix func(ctx context.Context) error `json:"-"`
+}
+
+// Checker is implemented by modules that can validate references into other
+// modules. Modules use separate databases without foreign keys, so checkers
+// look up referenced records through the App.
+type Checker interface {
+	Check(ctx context.Context) ([]Issue, error)
+}
+
+// CheckReport is the result of App.Check.
+type CheckReport struct {
+	Issues []Issue `json:"issues"`
+}
+
+// OK reports whether no issues were found.
+func (report *CheckReport) OK() bool {
+	return len(report.Issues) == 0
+}
+
+// Plan returns the repair steps Fix would perform, in order.
+func (report *CheckReport) Plan() []string {
+	var plan []string
+	for _, issue := range report.Issues {
+		if issue.Fix != nil {
+			plan = append(plan, fmt.Sprintf("[%s] %s", issue.Module, issue.Repair))
+		}
+	}
+	return plan
+}
+
+// Fix applies every automatic repair and returns the number of issues fixed.
+// It keeps going after a failed repair and returns the joined errors.
+func (report *CheckReport) Fix(ctx context.Context) (int, error) {
+	fixed := 0
+	var errs []error
+	for _, issue := range report.Issues {
+		if issue.Fix == nil {
+			continue
+		}
+		if err := issue.Fix(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s %s: %w", issue.Module, issue.Kind, issue.Resource, err))
+			continue
+		}
+		fixed++
+	}
+	return fixed, errors.Join(errs...)
+}
+
+// Check validates referential integrity across modules, e.g. memberships
+// pointing at deleted users or sessions of deleted users. It reports issues
+// without changing anything; call Fix on the report to repair them.
+func (app *App) Check(ctx context.Context) (*CheckReport, error) {
+	report := &CheckReport{}
+	for _, mod := range app.Modules() {
+		checker, ok := mod.(Checker)
+		if !ok {
+			continue
+		}
+		issues, err := checker.Check(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check module %q: %w", mod.Name(), err)
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	return report, nil
+}
@@ -0,0 +1,97 @@
+package chassis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CleanupAction is one step of removing a deleted user's data from a
+// module.
+type CleanupAction struct {
+	// Module is the module that owns the data.
+	Module string `json:"module"`
+
+	// Kind classifies the data (e.g., "membership", "session").
+	Kind string `json:"kind"`
+
+	// Resource is the ID of the affected record.
+	Resource string `json:"resource"`
+
+	// Description says what Apply will do.
+	Description string `json:"description"`
+
+	// Apply performs the step.
+	Apply func(ctx context.Context) error `json:"-"`
+}
+
+// UserCleaner is implemented by modules that keep data about users.
+// Deleting a user through the users module first applies the actions every
+// registered cleaner plans, so no memberships, sessions or invitations are
+// left pointing at the deleted user. A cleaner that can't let the user go
+// (e.g. an organization that would lose its last owner) returns an error
+// and the user is not deleted.
+type UserCleaner interface {
+	PlanUserCleanup(ctx context.Context, userID string) ([]CleanupAction, error)
+}
+
+// OrgPurger is implemented by modules that keep data about
+// organizations. When the orgs module purges a deleted organization, once
+// its grace period is over, every registered purger removes what it keeps
+// for it first. An error leaves the organization to purge again later, so
+// PurgeOrg must be safe to repeat.
+type OrgPurger interface {
+	PurgeOrg(ctx context.Context, orgID string) error
+}
+
+// CleanupReport is the result of App.PlanUserCleanup.
+type CleanupReport struct {
+	UserID  string          `json:"user_id"`
+	Actions []CleanupAction `json:"actions"`
+}
+
+// Plan returns the steps Apply would perform, in order.
+func (report *CleanupReport) Plan() []string {
+	plan := make([]string, 0, len(report.Actions))
+	for _, action := range report.Actions {
+		plan = append(plan, fmt.Sprintf("[%s] %s", action.Module, action.Description))
+	}
+	return plan
+}
+
+// Apply performs every step and returns the number applied. It keeps going
+// after a failed step and returns the joined errors.
+func (report *CleanupReport) Apply(ctx context.Context) (int, error) {
+	applied := 0
+	var errs []error
+	for _, action := range report.Actions {
+		if err := action.Apply(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s %s: %w", action.Module, action.Kind, action.Resource, err))
+			continue
+		}
+		applied++
+	}
+	return applied, errors.Join(errs...)
+}
+
+// PlanUserCleanup collects what every module would remove or change if
+// userID were deleted, without changing anything. Use it as a dry run
+// before deleting a user; users.Module.Delete applies the same plan.
+func (app *App) PlanUserCleanup(ctx context.Context, userID string) (*CleanupReport, error) {
+	report := &CleanupReport{UserID: userID}
+	if app == nil {
+		return report, nil
+	}
+	for _, mod := range app.Modules() {
+		cleaner, ok := mod.(UserCleaner)
+		if !ok {
+			continue
+		}
+		actions, err := cleaner.PlanUserCleanup(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan cleanup in module %q: %w", mod.Name(), err)
+		}
+		report.Actions = append(report.Actions, actions...)
+	}
+	return report, nil
+}
@@ -0,0 +1,96 @@
+// Command chassis-check validates referential integrity across chassis
+// module databases and optionally repairs what it finds.
+//
+// Usage:
+//
+//	chassis-check [-config ./config.yaml] [-fix] [-json]
+//
+// Without -fix it prints the issues and the repair plan and exits with
+// status 1 if any issues were found. With -fix it applies the plan.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/users"
+)
+
+func main() {
+	configPath := flag.String("config", "./config.yaml", "path to the chassis config file")
+	fix := flag.Bool("fix", false, "apply the repair plan")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	options := []chassis.Option{}
+	if _, err := os.Stat(*configPath); err == nil {
+		options = append(options, chassis.WithConfigFile(*configPath))
+	}
+	options = append(options, chassis.WithModules(
+		users.New(),
+		auth.New(),
+		orgs.New(),
+		queue.New(),
+	))
+	app := chassis.New(options...)
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	report, err := app.Check(ctx)
+	if err != nil {
+		log.Fatalf("check failed: %v", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("failed to encode report: %v", err)
+		}
+	} else {
+		printReport(report)
+	}
+
+	if report.OK() {
+		return
+	}
+	if !*fix {
+		os.Exit(1)
+	}
+
+	fixed, err := report.Fix(ctx)
+	fmt.Printf("\nFixed %d of %d issues\n", fixed, len(report.Issues))
+	if err != nil {
+		log.Fatalf("some repairs failed: %v", err)
+	}
+}
+
+func printReport(report *chassis.CheckReport) {
+	if report.OK() {
+		fmt.Println("No issues found")
+		return
+	}
+
+	fmt.Printf("Found %d issues:\n", len(report.Issues))
+	for _, issue := range report.Issues {
+		fmt.Printf("  [%s] %s: %s\n", issue.Module, issue.Kind, issue.Message)
+	}
+
+	plan := report.Plan()
+	if len(plan) == 0 {
+		return
+	}
+	fmt.Println("\nRepair plan (run with -fix to apply):")
+	for i, step := range plan {
+		fmt.Printf("  %d. %s\n", i+1, step)
+	}
+}
@@ -0,0 +1,340 @@
+// Command chassisctl runs operational tasks against the databases of a
+// chassis app, using the same config file, so admins don't need to write
+// throwaway Go programs.
+//
+// Usage:
+//
+//	chassisctl [-config ./config.yaml] <command> [flags] [args]
+//
+// Commands:
+//
+//	users create [-password p] <email>             create a user
+//	users reset-password [-password p] [-keep-sessions] <email>
+//	                                               set a user's password and sign them out
+//	jobs list [-status failed] [-limit 20]         list jobs, newest first
+//	jobs retry [-all] [job-id...]                  retry failed or dead jobs
+//	migrate                                        create or upgrade the module schemas
+//	events tail -db <path> [-interval 1s]          print events added to a database's outbox
+//	config dump                                    print the config, with secrets masked
+//
+// Without -password the password is read from the first line of stdin.
+//
+// Events are delivered in memory, so only events written to an outbox
+// (see the outbox package) can be seen from outside the app; events tail
+// prints them as they are added and exits on SIGINT. Events relayed as
+// soon as they commit, like those of the users and orgs modules outside
+// app.Tx, may be gone before it polls.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/internal/sqlitedb"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/permissions"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/users"
+)
+
+const usage = `usage: chassisctl [-config ./config.yaml] <command> [flags] [args]
+
+commands:
+  users create [-password p] <email>
+  users reset-password [-password p] [-keep-sessions] <email>
+  jobs list [-status failed] [-limit 20]
+  jobs retry [-all] [job-id...]
+  migrate
+  events tail -db <path> [-interval 1s]
+  config dump
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	configPath := flag.String("config", "./config.yaml", "path to the chassis config file")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	var err error
+	switch command := strings.Join(args[:min(2, len(args))], " "); {
+	case command == "users create":
+		err = createUser(ctx, *configPath, args[2:])
+	case command == "users reset-password":
+		err = resetPassword(ctx, *configPath, args[2:])
+	case command == "jobs list":
+		err = listJobs(ctx, *configPath, args[2:])
+	case command == "jobs retry":
+		err = retryJobs(ctx, *configPath, args[2:])
+	case args[0] == "migrate":
+		err = migrate(ctx, *configPath)
+	case command == "events tail":
+		err = tailEvents(ctx, args[2:])
+	case command == "config dump":
+		err = dumpConfig(*configPath)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openApp registers the modules owning the app's databases. Registering a
+// module runs its migrations.
+func openApp(ctx context.Context, configPath string) (*chassis.App, error) {
+	options := []chassis.Option{}
+	if _, err := os.Stat(configPath); err == nil {
+		options = append(options, chassis.WithConfigFile(configPath))
+	}
+	options = append(options, chassis.WithModules(
+		users.New(),
+		auth.New(),
+		orgs.New(),
+		permissions.New(),
+		queue.New(),
+	))
+	app := chassis.New(options...)
+	for _, name := range []string{"users", "auth", "orgs", "permissions", "queue"} {
+		if !app.HasModule(name) {
+			_ = app.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to open the %s module; see the log above", name)
+		}
+	}
+	return app, nil
+}
+
+func createUser(ctx context.Context, configPath string, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ExitOnError)
+	password := flags.String("password", "", "password; read from stdin if empty")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: chassisctl users create [-password p] <email>")
+	}
+	if err := readPassword(password); err != nil {
+		return err
+	}
+
+	app, err := openApp(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	result, err := app.Users().Create(ctx, flags.Arg(0), *password)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	user := result.(*users.User)
+	fmt.Printf("Created user %s (%s)\n", user.Email, user.ID)
+	return nil
+}
+
+func resetPassword(ctx context.Context, configPath string, args []string) error {
+	flags := flag.NewFlagSet("users reset-password", flag.ExitOnError)
+	password := flags.String("password", "", "new password; read from stdin if empty")
+	keepSessions := flags.Bool("keep-sessions", false, "don't sign the user out of their sessions")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: chassisctl users reset-password [-password p] [-keep-sessions] <email>")
+	}
+	if err := readPassword(password); err != nil {
+		return err
+	}
+
+	app, err := openApp(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	result, err := app.Users().GetByEmail(ctx, flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	user := result.(*users.User)
+	usersMod := app.Users().(*users.Module)
+	if _, err := usersMod.Update(ctx, user.ID, users.UpdateInput{Password: password}); err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+	if !*keepSessions {
+		if err := app.Auth().(*auth.Module).RevokeSessions(ctx, user.ID); err != nil {
+			return fmt.Errorf("password reset, but failed to revoke sessions: %w", err)
+		}
+	}
+	fmt.Printf("Reset the password of %s\n", user.Email)
+	return nil
+}
+
+// readPassword reads the password from stdin unless it was given.
+func readPassword(password *string) error {
+	if *password != "" {
+		return nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	*password = strings.TrimRight(line, "\r\n")
+	if *password == "" {
+		return errors.New("password is empty")
+	}
+	return nil
+}
+
+func listJobs(ctx context.Context, configPath string, args []string) error {
+	flags := flag.NewFlagSet("jobs list", flag.ExitOnError)
+	status := flags.String("status", string(queue.StatusFailed), `job status, or "" for every status`)
+	limit := flags.Int("limit", 20, "number of jobs to list")
+	_ = flags.Parse(args)
+
+	app, err := openApp(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	page, err := app.Queue().(*queue.Module).List(ctx, queue.JobStatus(*status), pagination.Request{Limit: *limit})
+	if err != nil {
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for _, job := range page.Items {
+		fmt.Printf("%s  %-10s  %-20s  %s  %s\n", job.ID, job.Status, job.Type, job.CreatedAt.Format(time.RFC3339), job.Error)
+	}
+	fmt.Printf("%d of %d jobs\n", len(page.Items), page.Total)
+	return nil
+}
+
+func retryJobs(ctx context.Context, configPath string, args []string) error {
+	flags := flag.NewFlagSet("jobs retry", flag.ExitOnError)
+	all := flags.Bool("all", false, "retry every failed job")
+	_ = flags.Parse(args)
+	if *all == (flags.NArg() > 0) {
+		return errors.New("usage: chassisctl jobs retry [-all] [job-id...]")
+	}
+
+	app, err := openApp(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	queueMod := app.Queue().(*queue.Module)
+	jobIDs := flags.Args()
+	if *all {
+		result, err := queueMod.GetFailed(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list failed jobs: %w", err)
+		}
+		for _, job := range result.([]*queue.Job) {
+			jobIDs = append(jobIDs, job.ID)
+		}
+	}
+	var errs []error
+	for _, jobID := range jobIDs {
+		if err := queueMod.Retry(ctx, jobID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to retry job %s: %w", jobID, err))
+		}
+	}
+	fmt.Printf("Retried %d of %d jobs\n", len(jobIDs)-len(errs), len(jobIDs))
+	return errors.Join(errs...)
+}
+
+func migrate(ctx context.Context, configPath string) error {
+	app, err := openApp(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	for _, mod := range app.Modules() {
+		fmt.Printf("Migrated %s\n", mod.Name())
+	}
+	return nil
+}
+
+func tailEvents(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("events tail", flag.ExitOnError)
+	dbPath := flags.String("db", "", "SQLite database with the outbox")
+	interval := flags.Duration("interval", time.Second, "how often to poll")
+	_ = flags.Parse(args)
+	if *dbPath == "" {
+		return errors.New("usage: chassisctl events tail -db <path> [-interval 1s]")
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		return err
+	}
+	// Wait out the app's writes rather than failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite", sqlitedb.DSN(*dbPath))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	var lastID int64
+	// Start at the events already waiting, like tail
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM outbox_events`).Scan(&lastID); err != nil {
+		return fmt.Errorf("failed to read the outbox: %w", err)
+	}
+	for {
+		rows, err := db.QueryContext(ctx, `SELECT id, event_type, payload, created_at FROM outbox_events WHERE id > ? ORDER BY id`, lastID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read the outbox: %w", err)
+		}
+		for rows.Next() {
+			var (
+				eventType string
+				payload   []byte
+				createdAt time.Time
+			)
+			if err := rows.Scan(&lastID, &eventType, &payload, &createdAt); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			fmt.Printf("%s  %s  %s\n", createdAt.Format(time.RFC3339), eventType, payload)
+		}
+		_ = rows.Close()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+func dumpConfig(configPath string) error {
+	cfg, err := chassis.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	out, err := cfg.DumpSafe()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
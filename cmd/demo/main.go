@@ -7,18 +7,16 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
 	"time"
 
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
 	"github.com/talosaether/chassis/auth"
 	"github.com/talosaether/chassis/cache"
 	"github.com/talosaether/chassis/email"
 	"github.com/talosaether/chassis/events"
 	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
 	"github.com/talosaether/chassis/permissions"
 	"github.com/talosaether/chassis/queue"
 	"github.com/talosaether/chassis/storage"
@@ -42,14 +40,17 @@ func writeln(w io.Writer, s string) {
 func main() {
 	ctx := context.Background()
 
-	// Create a log provider for email (prints instead of sending)
-	emailLogger := email.NewLogProvider(func(to, subject, body string) {
-		fmt.Printf("[EMAIL] To: %s, Subject: %s, Body: %s\n", to, subject, body)
+	// Capture email in a dev inbox (prints and stores instead of sending)
+	inbox := email.NewDevInboxProvider(email.DevInboxConfig{
+		Logger: func(to, subject, body string) {
+			fmt.Printf("[EMAIL] To: %s, Subject: %s, Body: %s\n", to, subject, body)
+		},
 	})
 
-	// Initialize chassis with all modules
+	// Initialize chassis with all modules. app.Run starts the queue worker
+	// and the HTTP server, and shuts everything down on Ctrl+C.
 	app := chassis.New(
-		chassis.WithConfigFile("./config.yaml"),
+		chassis.WithConfigFiles(chassis.ConfigPaths("./config.yaml")...),
 		chassis.WithModules(
 			storage.New(),
 			users.New(),
@@ -57,40 +58,32 @@ func main() {
 			orgs.New(),
 			permissions.New(),
 			cache.New(),
-			queue.New(),
-			email.New(email.WithProvider(emailLogger)),
+			queue.New(queue.WithWorkers(1), queue.WithFallbackHandler(func(ctx context.Context, job *queue.Job) error {
+				fmt.Printf("[WORKER] Processing job %s (type: %s)\n", job.ID, job.Type)
+				time.Sleep(500 * time.Millisecond) // Simulate work
+				return nil
+			})),
+			email.New(email.WithProvider(inbox)),
 			events.New(),
+			api.NewServer(http.DefaultServeMux, api.WithAddr(":8080")),
 		),
 	)
 
-	// Ensure graceful shutdown
-	defer func() {
-		if err := app.Shutdown(ctx); err != nil {
-			log.Printf("shutdown error: %v", err)
-		}
-	}()
-
-	// Set up event subscriptions
-	app.Events().Subscribe("user.login", events.Handler(func(ctx context.Context, eventType string, payload any) {
+	// Set up event subscriptions (modules publish these automatically)
+	app.Events().Subscribe(auth.EventLogin, events.Handler(func(ctx context.Context, eventType string, payload any) error {
 		fmt.Printf("[EVENT] %s: %v\n", eventType, payload)
+		return nil
 	}))
-	app.Events().Subscribe("org.created", events.Handler(func(ctx context.Context, eventType string, payload any) {
+	app.Events().Subscribe(orgs.EventOrgCreated, events.Handler(func(ctx context.Context, eventType string, payload any) error {
 		fmt.Printf("[EVENT] %s: %v\n", eventType, payload)
+		return nil
 	}))
-	app.Events().Subscribe("job.completed", events.Handler(func(ctx context.Context, eventType string, payload any) {
+	app.Events().Subscribe(queue.EventJobCompleted, events.Handler(func(ctx context.Context, eventType string, payload any) error {
 		fmt.Printf("[EVENT] %s: %v\n", eventType, payload)
+		return nil
 	}))
 
-	// Start a background worker for the queue
 	queueMod := app.Queue().(*queue.Module)
-	eventsMod := app.Events().(*events.Module)
-	workerCtx, cancelWorker := context.WithCancel(ctx)
-	go queueMod.Worker(workerCtx, func(ctx context.Context, job *queue.Job) error {
-		fmt.Printf("[WORKER] Processing job %s (type: %s)\n", job.ID, job.Type)
-		time.Sleep(500 * time.Millisecond) // Simulate work
-		eventsMod.Publish(ctx, "job.completed", map[string]string{"job_id": job.ID, "type": job.Type})
-		return nil
-	})
 
 	// Create test data
 	fmt.Println("\n=== Setup ===")
@@ -161,39 +154,37 @@ func main() {
 		writeln(writer, "  GET  /jobs          - List pending jobs")
 		writeln(writer, "\n=== Email Endpoints ===")
 		writeln(writer, "  POST /email         - Send email (to=, subject=, body=)")
+		writeln(writer, "  GET  /dev/mail/     - Browse sent emails")
 	})
 
 	// Login endpoint
 	http.HandleFunc("/login", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Method != http.MethodPost {
-			http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+			api.MethodNotAllowed(writer, request)
 			return
 		}
 
 		emailAddr := request.FormValue("email")
 		password := request.FormValue("password")
 
-		session, err := authMod.Login(request.Context(), writer, emailAddr, password)
+		session, err := authMod.LoginRequest(writer, request, emailAddr, password)
 		if err != nil {
-			http.Error(writer, fmt.Sprintf("Login failed: %v", err), http.StatusUnauthorized)
+			api.WriteError(writer, request, err)
 			return
 		}
 
-		// Publish login event
-		eventsMod.Publish(request.Context(), "user.login", map[string]string{"user_id": session.UserID})
-
 		write(writer, "Login successful! Session expires: %s\n", session.ExpiresAt.Format(time.RFC3339))
 	})
 
 	// Logout endpoint
 	http.HandleFunc("/logout", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Method != http.MethodPost {
-			http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+			api.MethodNotAllowed(writer, request)
 			return
 		}
 
 		if err := authMod.Logout(request.Context(), writer, request); err != nil {
-			http.Error(writer, fmt.Sprintf("Logout failed: %v", err), http.StatusInternalServerError)
+			api.WriteError(writer, request, err)
 			return
 		}
 
@@ -216,7 +207,7 @@ func main() {
 			// List user's orgs
 			membershipsResult, err := orgsMod.GetUserOrgs(request.Context(), session.UserID)
 			if err != nil {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				api.WriteError(writer, request, err)
 				return
 			}
 			memberships := membershipsResult.([]*orgs.Membership)
@@ -251,13 +242,13 @@ func main() {
 			// Create org
 			name := request.FormValue("name")
 			if name == "" {
-				http.Error(writer, "name is required", http.StatusBadRequest)
+				api.WriteError(writer, request, orgs.ErrNameRequired)
 				return
 			}
 
 			orgResult, err := orgsMod.Create(request.Context(), orgs.CreateInput{Name: name})
 			if err != nil {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				api.WriteError(writer, request, err)
 				return
 			}
 			org := orgResult.(*orgs.Org)
@@ -267,67 +258,57 @@ func main() {
 				log.Printf("failed to add owner: %v", err)
 			}
 
-			eventsMod.Publish(request.Context(), "org.created", map[string]string{"org_id": org.ID(), "name": name})
-
 			write(writer, "Created org: %s (ID: %s)\n", org.Name, org.ID())
 			return
 		}
 
-		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		api.MethodNotAllowed(writer, request)
 	})))
 
 	// Org members endpoint
-	http.Handle("/orgs/members", authMod.RequireAuth(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		session := auth.SessionFromContext(request.Context())
-		orgID := request.URL.Query().Get("org_id")
-		if orgID == "" {
-			http.Error(writer, "org_id is required", http.StatusBadRequest)
-			return
-		}
+	orgIDFromQuery := func(request *http.Request) string {
+		return request.URL.Query().Get("org_id")
+	}
+	http.Handle("/orgs/members", authMod.RequireAuth(permsMod.Require("org:read", orgIDFromQuery)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		orgID := orgIDFromQuery(request)
 
-		// Check permission
-		if !permsMod.Can(request.Context(), session.UserID, "org:read", orgID) {
-			http.Error(writer, "Permission denied", http.StatusForbidden)
+		req, err := pagination.FromRequest(request)
+		if err != nil {
+			api.WriteError(writer, request, err)
 			return
 		}
-
-		membersResult, err := orgsMod.GetMembers(request.Context(), orgID)
+		members, err := orgsMod.ListMembers(request.Context(), orgID, req)
 		if err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			api.WriteError(writer, request, err)
 			return
 		}
-		members := membersResult.([]*orgs.Membership)
 
 		type memberResponse struct {
 			UserID string `json:"userId"`
 			Role   string `json:"role"`
 		}
-		var response []memberResponse
-		for _, member := range members {
-			response = append(response, memberResponse{
-				UserID: member.UserID,
-				Role:   member.Role,
-			})
-		}
+		response := pagination.Map(members, func(member *orgs.Membership) memberResponse {
+			return memberResponse{UserID: member.UserID, Role: member.Role}
+		})
 
 		writer.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(writer).Encode(response); err != nil {
 			log.Printf("json encode error: %v", err)
 		}
-	})))
+	}))))
 
 	// Cache endpoints
 	http.HandleFunc("/cache", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Method == http.MethodGet {
 			key := request.URL.Query().Get("key")
 			if key == "" {
-				http.Error(writer, "key is required", http.StatusBadRequest)
+				api.Error(writer, request, chassis.CodeInvalidArgument, "key is required")
 				return
 			}
 
 			value, found := cacheMod.Get(request.Context(), key)
 			if !found {
-				http.Error(writer, "Key not found", http.StatusNotFound)
+				api.Error(writer, request, chassis.CodeNotFound, "key not found")
 				return
 			}
 			if _, err := writer.Write(value); err != nil {
@@ -340,56 +321,42 @@ func main() {
 			key := request.FormValue("key")
 			value := request.FormValue("value")
 			if key == "" || value == "" {
-				http.Error(writer, "key and value are required", http.StatusBadRequest)
+				api.Error(writer, request, chassis.CodeInvalidArgument, "key and value are required")
 				return
 			}
 
 			if err := cacheMod.Set(request.Context(), key, []byte(value)); err != nil {
-				http.Error(writer, fmt.Sprintf("failed to set cache: %v", err), http.StatusInternalServerError)
+				api.WriteError(writer, request, err)
 				return
 			}
 			write(writer, "Cached: %s = %s\n", key, value)
 			return
 		}
 
-		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		api.MethodNotAllowed(writer, request)
 	})
 
 	// Queue endpoints
 	http.HandleFunc("/jobs", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Method == http.MethodGet {
-			// Parse pagination params
-			page := 1
-			limit := 20
-			if p := request.URL.Query().Get("page"); p != "" {
-				if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-					page = parsed
-				}
-			}
-			if l := request.URL.Query().Get("limit"); l != "" {
-				if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-					limit = parsed
-				}
+			req, err := pagination.FromRequest(request)
+			if err != nil {
+				api.WriteError(writer, request, err)
+				return
 			}
 
 			// Filter by status: pending, completed, or all (default)
-			statusFilter := request.URL.Query().Get("status")
-
-			var result *queue.PaginatedResult
-			var err error
-
-			switch statusFilter {
+			var status queue.JobStatus
+			switch request.URL.Query().Get("status") {
 			case "pending":
-				result, err = queueMod.GetByStatusPaginated(request.Context(), queue.StatusPending, page, limit)
+				status = queue.StatusPending
 			case "completed":
-				result, err = queueMod.GetByStatusPaginated(request.Context(), queue.StatusCompleted, page, limit)
-			default:
-				// "all" or empty returns all jobs
-				result, err = queueMod.GetAllPaginated(request.Context(), page, limit)
+				status = queue.StatusCompleted
 			}
 
+			result, err := queueMod.List(request.Context(), status, req)
 			if err != nil {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				api.WriteError(writer, request, err)
 				return
 			}
 
@@ -398,29 +365,10 @@ func main() {
 				Type   string `json:"type"`
 				Status string `json:"status"`
 			}
-			type paginatedResponse struct {
-				Jobs       []jobResponse `json:"jobs"`
-				Pagination struct {
-					Page       int `json:"page"`
-					Limit      int `json:"limit"`
-					Total      int `json:"total"`
-					TotalPages int `json:"totalPages"`
-				} `json:"pagination"`
-			}
 
-			response := paginatedResponse{}
-			response.Jobs = make([]jobResponse, 0, len(result.Jobs))
-			for _, job := range result.Jobs {
-				response.Jobs = append(response.Jobs, jobResponse{
-					ID:     job.ID,
-					Type:   job.Type,
-					Status: string(job.Status),
-				})
-			}
-			response.Pagination.Page = result.Page
-			response.Pagination.Limit = result.Limit
-			response.Pagination.Total = result.Total
-			response.Pagination.TotalPages = result.TotalPages
+			response := pagination.Map(result, func(job *queue.Job) jobResponse {
+				return jobResponse{ID: job.ID, Type: job.Type, Status: string(job.Status)}
+			})
 
 			writer.Header().Set("Content-Type", "application/json")
 			if err := json.NewEncoder(writer).Encode(response); err != nil {
@@ -433,13 +381,13 @@ func main() {
 			jobType := request.FormValue("type")
 			data := request.FormValue("data")
 			if jobType == "" {
-				http.Error(writer, "type is required", http.StatusBadRequest)
+				api.Error(writer, request, chassis.CodeInvalidArgument, "type is required")
 				return
 			}
 
 			jobResult, err := queueMod.Enqueue(request.Context(), jobType, map[string]string{"data": data})
 			if err != nil {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				api.WriteError(writer, request, err)
 				return
 			}
 			job := jobResult.(*queue.Job)
@@ -462,30 +410,26 @@ func main() {
 			return
 		}
 
-		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		api.MethodNotAllowed(writer, request)
 	})
 
 	// Single job endpoint: GET /jobs/{id}
 	http.HandleFunc("/jobs/", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Method != http.MethodGet {
-			http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+			api.MethodNotAllowed(writer, request)
 			return
 		}
 
 		// Extract job ID from path: /jobs/{id}
 		jobID := request.URL.Path[len("/jobs/"):]
 		if jobID == "" {
-			writer.Header().Set("Content-Type", "application/json")
-			writer.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(writer).Encode(map[string]string{"error": "Job ID required"})
+			api.Error(writer, request, chassis.CodeInvalidArgument, "job ID is required")
 			return
 		}
 
 		jobResult, err := queueMod.GetByID(request.Context(), jobID)
 		if err != nil {
-			writer.Header().Set("Content-Type", "application/json")
-			writer.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(writer).Encode(map[string]string{"error": "Job not found"})
+			api.WriteError(writer, request, err)
 			return
 		}
 
@@ -511,7 +455,7 @@ func main() {
 	// Email endpoint
 	http.HandleFunc("/email", func(writer http.ResponseWriter, request *http.Request) {
 		if request.Method != http.MethodPost {
-			http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+			api.MethodNotAllowed(writer, request)
 			return
 		}
 
@@ -520,51 +464,40 @@ func main() {
 		body := request.FormValue("body")
 
 		if to == "" || subject == "" {
-			http.Error(writer, "to and subject are required", http.StatusBadRequest)
+			api.Error(writer, request, chassis.CodeInvalidArgument, "to and subject are required")
 			return
 		}
 
 		if err := emailMod.Send(request.Context(), to, subject, body); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			api.WriteError(writer, request, err)
 			return
 		}
 
-		writeln(writer, "Email sent (check server logs)")
+		writeln(writer, "Email sent (see /dev/mail/)")
 	})
 
-	// Start server
-	server := &http.Server{
-		Addr:              ":8080",
-		ReadHeaderTimeout: 10 * time.Second,
-	}
-
-	go func() {
-		fmt.Println("\n=== HTTP Server ===")
-		fmt.Println("Listening on http://localhost:8080")
-		fmt.Println("\nTry these commands:")
-		fmt.Println("  curl http://localhost:8080/")
-		fmt.Println("  curl -X POST -d 'email=demo@example.com&password=password123' http://localhost:8080/login -c cookies.txt")
-		fmt.Println("  curl http://localhost:8080/orgs -b cookies.txt")
-		fmt.Println("  curl -X POST -d 'name=NewOrg' http://localhost:8080/orgs -b cookies.txt")
-		fmt.Println("  curl -X POST -d 'key=foo&value=bar' http://localhost:8080/cache")
-		fmt.Println("  curl 'http://localhost:8080/cache?key=foo'")
-		fmt.Println("  curl -X POST -d 'type=send_email&data=hello' http://localhost:8080/jobs")
-		fmt.Println("  curl -X POST -d 'to=test@example.com&subject=Hello&body=World' http://localhost:8080/email")
-		fmt.Println("\nPress Ctrl+C to stop...")
-
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
-		}
-	}()
-
-	// Wait for interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-
-	fmt.Println("\nShutting down...")
-	cancelWorker()
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("server shutdown error: %v", err)
+	// Dev inbox for browsing sent emails
+	http.Handle("/dev/mail/", http.StripPrefix("/dev/mail", inbox.Handler()))
+
+	// Built-in endpoints (health, ...), controlled by http.expose in config.yaml
+	api.Mount(app, http.DefaultServeMux)
+
+	fmt.Println("\n=== HTTP Server ===")
+	fmt.Println("Listening on http://localhost:8080")
+	fmt.Println("\nTry these commands:")
+	fmt.Println("  curl http://localhost:8080/")
+	fmt.Println("  curl -X POST -d 'email=demo@example.com&password=password123' http://localhost:8080/login -c cookies.txt")
+	fmt.Println("  curl http://localhost:8080/orgs -b cookies.txt")
+	fmt.Println("  curl -X POST -d 'name=NewOrg' http://localhost:8080/orgs -b cookies.txt")
+	fmt.Println("  curl -X POST -d 'key=foo&value=bar' http://localhost:8080/cache")
+	fmt.Println("  curl 'http://localhost:8080/cache?key=foo'")
+	fmt.Println("  curl -X POST -d 'type=send_email&data=hello' http://localhost:8080/jobs")
+	fmt.Println("  curl -X POST -d 'to=test@example.com&subject=Hello&body=World' http://localhost:8080/email")
+	fmt.Println("  open http://localhost:8080/dev/mail/")
+	fmt.Println("\nPress Ctrl+C to stop...")
+
+	if err := app.Run(ctx); err != nil {
+		log.Fatalf("run error: %v", err)
 	}
+	fmt.Println("\nStopped")
 }
@@ -1,15 +1,24 @@
 package chassis
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	ErrMissingConfig = NewError(CodeFailedPrecondition, "missing config value")
+	ErrInvalidConfig = NewError(CodeInvalidArgument, "invalid config value")
+)
+
 // ConfigData holds the parsed configuration as a nested map.
 // Modules access their config sections by name.
 type ConfigData map[string]any
@@ -25,6 +34,12 @@ func LoadConfig(path string) (ConfigData, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	return parseConfig(data)
+}
+
+// parseConfig expands environment variables in YAML (or JSON) config and
+// parses it.
+func parseConfig(data []byte) (ConfigData, error) {
 	// Expand environment variables before parsing
 	expanded := expandEnvVars(string(data))
 
@@ -36,6 +51,100 @@ func LoadConfig(path string) (ConfigData, error) {
 	return config, nil
 }
 
+// LoadConfigFiles loads each YAML file in turn and deep-merges it over the
+// ones before, so later files only need the settings they change. Sections
+// are merged key by key; other values, including lists, are replaced. The
+// first file must exist, later ones are skipped if they don't, so an
+// environment without overrides needs no file:
+//
+//	cfg, err := chassis.LoadConfigFiles("base.yaml", "override."+env+".yaml")
+func LoadConfigFiles(paths ...string) (ConfigData, error) {
+	var merged ConfigData
+	for i, path := range paths {
+		data, err := LoadConfig(path)
+		if err != nil {
+			if i > 0 && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		merged = merged.Merge(data)
+	}
+	return merged, nil
+}
+
+// Merge returns a copy of the config with override deep-merged over it.
+// Neither config is modified.
+func (cfg ConfigData) Merge(override ConfigData) ConfigData {
+	merged := make(ConfigData, len(cfg)+len(override))
+	for key, value := range cfg {
+		merged[key] = value
+	}
+	for key, value := range override {
+		base, overrideSection := toStringMap(merged[key]), toStringMap(value)
+		if base != nil && overrideSection != nil {
+			merged[key] = map[string]any(ConfigData(base).Merge(overrideSection))
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// ConfigEnvVar names the environment variable ConfigPaths reads config
+// file paths from, separated by commas.
+const ConfigEnvVar = "CHASSIS_CONFIG"
+
+// ConfigPaths returns the config files to load: those given with --config
+// (or -config) on the command line, which may be repeated, otherwise those
+// in the CHASSIS_CONFIG environment variable, otherwise defaults. Either
+// way the same binary can be pointed at another environment's files:
+//
+//	chassis.WithConfigFiles(chassis.ConfigPaths("base.yaml", "override."+env+".yaml")...)
+//
+//	./service --config base.yaml --config override.staging.yaml
+//	CHASSIS_CONFIG=base.yaml,override.staging.yaml ./service
+func ConfigPaths(defaults ...string) []string {
+	if paths := configFlags(os.Args[1:]); len(paths) > 0 {
+		return paths
+	}
+	var paths []string
+	for _, path := range strings.Split(os.Getenv(ConfigEnvVar), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) > 0 {
+		return paths
+	}
+	return defaults
+}
+
+// configFlags returns the values of the --config flags in args, stopping at
+// "--".
+func configFlags(args []string) []string {
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				break
+			}
+			i++
+			value = args[i]
+		}
+		paths = append(paths, value)
+	}
+	return paths
+}
+
 // expandEnvVars replaces ${VAR} and ${VAR:-default} patterns with environment values.
 func expandEnvVars(content string) string {
 	return envVarPattern.ReplaceAllStringFunc(content, func(match string) string {
@@ -123,6 +232,108 @@ func (cfg ConfigData) GetBool(path string) bool {
 	return false
 }
 
+// GetFloat retrieves a number, returning 0 if not found or not a number.
+// Integers and numeric strings are converted.
+func (cfg ConfigData) GetFloat(path string) float64 {
+	switch typed := cfg.Get(path).(type) {
+	case float64:
+		return typed
+	case int:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case string:
+		if parsed, err := strconv.ParseFloat(strings.TrimSpace(typed), 64); err == nil {
+			return parsed
+		}
+	}
+	return 0
+}
+
+// GetDuration retrieves a duration, returning 0 if not found or invalid.
+// Strings are parsed with time.ParseDuration ("30s", "1h30m"); plain
+// numbers are seconds.
+func (cfg ConfigData) GetDuration(path string) time.Duration {
+	duration, _ := cfg.MustGetDuration(path)
+	return duration
+}
+
+// MustGetDuration is GetDuration with errors, for modules that should fail
+// Init on a bad setting rather than silently use their default. It returns
+// ErrMissingConfig if the setting isn't set and ErrInvalidConfig if it's
+// not a duration:
+//
+//	if cfg.Get("auth.session_ttl") != nil {
+//	    ttl, err := cfg.MustGetDuration("auth.session_ttl")
+//	    if err != nil {
+//	        return err
+//	    }
+//	    mod.sessionTTL = ttl
+//	}
+func (cfg ConfigData) MustGetDuration(path string) (time.Duration, error) {
+	switch typed := cfg.Get(path).(type) {
+	case nil:
+		return 0, fmt.Errorf("%w: %s", ErrMissingConfig, path)
+	case string:
+		duration, err := time.ParseDuration(strings.TrimSpace(typed))
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s: %q is not a duration", ErrInvalidConfig, path, typed)
+		}
+		return duration, nil
+	case int:
+		return time.Duration(typed) * time.Second, nil
+	case int64:
+		return time.Duration(typed) * time.Second, nil
+	case float64:
+		return time.Duration(typed * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("%w: %s: %v is not a duration", ErrInvalidConfig, path, typed)
+	}
+}
+
+// GetStringSlice retrieves a list of strings, returning nil if not found.
+// A list's scalar items are formatted as strings, and a single string is
+// split on commas, so `${ALLOWED_ORIGINS}` can hold a list.
+func (cfg ConfigData) GetStringSlice(path string) []string {
+	var items []string
+	switch typed := cfg.Get(path).(type) {
+	case string:
+		for _, item := range strings.Split(typed, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	case []any:
+		for _, item := range typed {
+			if item == nil || toStringMap(item) != nil {
+				continue
+			}
+			if _, isList := item.([]any); !isList {
+				items = append(items, fmt.Sprint(item))
+			}
+		}
+	}
+	return items
+}
+
+// GetStringMap retrieves a section of scalar settings as strings, e.g.
+// headers or labels, returning nil if not found. Nested sections and lists
+// are left out.
+func (cfg ConfigData) GetStringMap(path string) map[string]string {
+	section := toStringMap(cfg.Get(path))
+	if section == nil {
+		return nil
+	}
+	values := make(map[string]string, len(section))
+	for key, value := range section {
+		if _, isList := value.([]any); isList || value == nil || toStringMap(value) != nil {
+			continue
+		}
+		values[key] = fmt.Sprint(value)
+	}
+	return values
+}
+
 // Section returns a subsection of the config as ConfigData.
 // Returns nil if the section doesn't exist.
 func (cfg ConfigData) Section(name string) ConfigData {
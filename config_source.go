@@ -0,0 +1,343 @@
+package chassis
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConfigKeyNotFound is returned by the Consul and etcd sources when
+// their key doesn't exist.
+var ErrConfigKeyNotFound = NewError(CodeNotFound, "config key not found")
+
+// maxRemoteConfigSize bounds the config a remote source reads.
+const maxRemoteConfigSize = 10 << 20
+
+// ConfigSource loads configuration from somewhere other than the config
+// files, such as a config service or a KV store. Load returns the whole
+// config it holds; WithConfigSources deep-merges it over the files.
+type ConfigSource interface {
+	Load(ctx context.Context) (ConfigData, error)
+}
+
+// configSources is the state behind WithConfigSources and RefreshConfig.
+type configSources struct {
+	mu       sync.Mutex // serializes loads and refreshes
+	base     ConfigData // config loaded before the sources
+	sources  []ConfigSource
+	loaded   []ConfigData // latest config from each source
+	watchers map[int]func(cfg ConfigData)
+	nextID   int
+}
+
+// merged returns the base config with each source's config merged over it.
+func (state *configSources) merged() ConfigData {
+	merged := state.base
+	for _, data := range state.loaded {
+		merged = merged.Merge(data)
+	}
+	return merged
+}
+
+// WithConfigSources loads configuration from sources, each deep-merged over
+// the config files and the sources before it. Put it after WithConfigFile
+// or WithConfigFiles. A source that fails to load is logged and skipped
+// until the next RefreshConfig:
+//
+//	chassis.New(
+//	    chassis.WithConfigFile("./config.yaml"),
+//	    chassis.WithConfigSources(chassis.ConsulConfigSource("http://consul:8500", "services/api/config")),
+//	    chassis.WithConfigRefresh(time.Minute),
+//	    chassis.WithModules(...),
+//	)
+func WithConfigSources(sources ...ConfigSource) Option {
+	return func(app *App) {
+		state := &app.sources
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		if len(state.sources) == 0 {
+			state.base = app.ConfigData()
+		}
+		for _, source := range sources {
+			data, err := source.Load(context.Background())
+			if err != nil {
+				app.logger.Error("failed to load config source", "source", source, "error", err)
+			}
+			state.sources = append(state.sources, source)
+			state.loaded = append(state.loaded, data)
+		}
+
+		data := state.merged()
+		app.configMu.Lock()
+		app.configData = data
+		app.configMu.Unlock()
+		app.applyChassisConfig(data)
+		app.logger.Info("config loaded", "sources", len(state.sources), "secrets", data.SecretPaths(app.secretKeys...))
+	}
+}
+
+// RefreshConfig reloads the config sources and, if the config changed,
+// replaces ConfigData and calls the OnConfigChange callbacks. A source that
+// fails keeps its previous config, and its error is returned after the
+// rest are applied. Modules read most settings in Init, so a refresh
+// reaches code that reads ConfigData when it runs.
+func (app *App) RefreshConfig(ctx context.Context) error {
+	state := &app.sources
+	state.mu.Lock()
+	if len(state.sources) == 0 {
+		state.mu.Unlock()
+		return nil
+	}
+	var errs []error
+	for i, source := range state.sources {
+		data, err := source.Load(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", source, err))
+			continue
+		}
+		state.loaded[i] = data
+	}
+
+	data := state.merged()
+	app.configMu.Lock()
+	changed := !reflect.DeepEqual(app.configData, data)
+	app.configData = data
+	app.configMu.Unlock()
+	count := len(state.sources)
+	watchers := make([]func(cfg ConfigData), 0, len(state.watchers))
+	for _, watcher := range state.watchers {
+		watchers = append(watchers, watcher)
+	}
+	state.mu.Unlock()
+
+	if changed {
+		app.logger.Info("config refreshed", "sources", count)
+		for _, watcher := range watchers {
+			watcher(data)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// OnConfigChange calls fn with the new config whenever RefreshConfig
+// changes it, and returns a function that stops the calls.
+func (app *App) OnConfigChange(fn func(cfg ConfigData)) func() {
+	state := &app.sources
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.watchers == nil {
+		state.watchers = make(map[int]func(cfg ConfigData))
+	}
+	id := state.nextID
+	state.nextID++
+	state.watchers[id] = fn
+	return func() {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		delete(state.watchers, id)
+	}
+}
+
+// WithConfigRefresh registers a service that calls RefreshConfig every
+// interval while the app runs.
+func WithConfigRefresh(interval time.Duration) Option {
+	return WithModules(&configRefresher{interval: interval})
+}
+
+// configRefresher is the service registered by WithConfigRefresh.
+type configRefresher struct {
+	interval time.Duration
+	app      *App
+}
+
+func (refresher *configRefresher) Name() string {
+	return "config_refresh"
+}
+
+func (refresher *configRefresher) Init(ctx context.Context, app *App) error {
+	if refresher.interval <= 0 {
+		return fmt.Errorf("invalid config refresh interval %s", refresher.interval)
+	}
+	refresher.app = app
+	return nil
+}
+
+func (refresher *configRefresher) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Start refreshes the config every interval until ctx is cancelled.
+func (refresher *configRefresher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(refresher.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := refresher.app.RefreshConfig(ctx); err != nil {
+				refresher.app.Logger().Error("failed to refresh config", "error", err)
+			}
+		}
+	}
+}
+
+// FileConfigSource returns a source reading a YAML config file, so a file
+// can be refreshed along with the remote sources.
+func FileConfigSource(path string) ConfigSource {
+	return fileSource(path)
+}
+
+type fileSource string
+
+func (path fileSource) Load(ctx context.Context) (ConfigData, error) {
+	return LoadConfig(string(path))
+}
+
+func (path fileSource) String() string {
+	return "file:" + string(path)
+}
+
+// ConfigSourceOption configures a remote config source.
+type ConfigSourceOption func(*remoteSource)
+
+// WithSourceHeader sets a header on the source's requests, e.g. a token:
+//
+//	chassis.ConsulConfigSource(addr, key, chassis.WithSourceHeader("X-Consul-Token", token))
+func WithSourceHeader(name, value string) ConfigSourceOption {
+	return func(source *remoteSource) {
+		source.header.Set(name, value)
+	}
+}
+
+// WithSourceClient sets the HTTP client for the source's requests, e.g. one
+// with client certificates. The default has a 10 second timeout.
+func WithSourceClient(client *http.Client) ConfigSourceOption {
+	return func(source *remoteSource) {
+		source.client = client
+	}
+}
+
+// remoteSource loads config over HTTP.
+type remoteSource struct {
+	name    string
+	client  *http.Client
+	header  http.Header
+	request func(ctx context.Context) (*http.Request, error)
+	decode  func(body []byte) ([]byte, error) // extracts the config from the response, if wrapped
+}
+
+func newRemoteSource(name string, request func(ctx context.Context) (*http.Request, error), opts []ConfigSourceOption) *remoteSource {
+	source := &remoteSource{
+		name:    name,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		header:  make(http.Header),
+		request: request,
+	}
+	for _, opt := range opts {
+		opt(source)
+	}
+	return source
+}
+
+func (source *remoteSource) Load(ctx context.Context) (ConfigData, error) {
+	request, err := source.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range source.header {
+		request.Header[name] = values
+	}
+	response, err := source.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrConfigKeyNotFound, source.name)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch config: %s", response.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxRemoteConfigSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if source.decode != nil {
+		if body, err = source.decode(body); err != nil {
+			return nil, err
+		}
+	}
+	return parseConfig(body)
+}
+
+func (source *remoteSource) String() string {
+	return source.name
+}
+
+// HTTPConfigSource returns a source fetching YAML or JSON config from a URL
+// with GET. ${VAR} references are expanded as in config files.
+func HTTPConfigSource(rawURL string, opts ...ConfigSourceOption) ConfigSource {
+	return newRemoteSource(rawURL, func(ctx context.Context) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Accept", "application/yaml, application/json")
+		return request, nil
+	}, opts)
+}
+
+// ConsulConfigSource returns a source reading YAML or JSON config from a
+// Consul KV key through the HTTP API at addr, e.g. "http://consul:8500".
+func ConsulConfigSource(addr, key string, opts ...ConfigSourceOption) ConfigSource {
+	endpoint := strings.TrimRight(addr, "/") + "/v1/kv/" + strings.TrimLeft(key, "/") + "?raw"
+	return newRemoteSource("consul:"+key, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	}, opts)
+}
+
+// EtcdConfigSource returns a source reading YAML or JSON config from an
+// etcd v3 key through the JSON gateway at endpoint, e.g.
+// "http://etcd:2379". Authenticate with
+// WithSourceHeader("Authorization", token).
+func EtcdConfigSource(endpoint, key string, opts ...ConfigSourceOption) ConfigSource {
+	rangeURL, joinErr := url.JoinPath(endpoint, "/v3/kv/range")
+	source := newRemoteSource("etcd:"+key, func(ctx context.Context) (*http.Request, error) {
+		if joinErr != nil {
+			return nil, fmt.Errorf("invalid etcd endpoint: %w", joinErr)
+		}
+		body, _ := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(key))})
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, rangeURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		return request, nil
+	}, opts)
+	source.decode = func(body []byte) ([]byte, error) {
+		var response struct {
+			Kvs []struct {
+				Value string `json:"value"`
+			} `json:"kvs"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to decode etcd response: %w", err)
+		}
+		if len(response.Kvs) == 0 {
+			return nil, fmt.Errorf("%w: etcd:%s", ErrConfigKeyNotFound, key)
+		}
+		return base64.StdEncoding.DecodeString(response.Kvs[0].Value)
+	}
+	return source
+}
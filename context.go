@@ -0,0 +1,101 @@
+package chassis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ErrNoTenant is returned by tenant-scoped operations when the context
+// carries no tenant; see WithTenant.
+var ErrNoTenant = NewError(CodeFailedPrecondition, "no tenant in context")
+
+type appContextKey struct{}
+
+type loggerContextKey struct{}
+
+type tenantContextKey struct{}
+
+// WithApp returns a context carrying app, for code that has a context but
+// no App pointer. The events and queue modules add it to the contexts of
+// handlers they call, and App.Middleware to request contexts.
+func WithApp(ctx context.Context, app *App) context.Context {
+	return context.WithValue(ctx, appContextKey{}, app)
+}
+
+// FromContext returns the app carried by ctx, or nil:
+//
+//	func notifyOwner(ctx context.Context, orgID string) error {
+//	    app := chassis.FromContext(ctx)
+//	    members, err := app.Orgs().GetMembers(ctx, orgID)
+//	    // ...
+//	}
+func FromContext(ctx context.Context) *App {
+	app, _ := ctx.Value(appContextKey{}).(*App)
+	return app
+}
+
+// WithLogger returns a context carrying a request-scoped logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the logger carried by ctx, falling back to the
+// logger of the app in ctx and then to slog.Default. It never returns nil.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	if app := FromContext(ctx); app != nil {
+		return app.Logger()
+	}
+	return slog.Default()
+}
+
+// Middleware returns middleware adding the app, a request ID (see
+// RequestIDMiddleware) and a logger tagged with the request's method, path
+// and ID to request contexts, so handlers and what they call can use
+// FromContext and LoggerFromContext. A handler panic is reported with
+// ReportPanic and answered with a 500 error envelope:
+//
+//	http.ListenAndServe(":8080", app.Middleware(mux))
+func (app *App) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx, requestID := requestContext(request)
+		ctx = WithApp(ctx, app)
+		ctx = WithLogger(ctx, app.Logger().With("method", request.Method, "path", request.URL.Path, "request_id", requestID))
+		writer.Header().Set(RequestIDHeader, requestID)
+		request = request.WithContext(ctx)
+		defer app.recoverHTTP(writer, request)
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// WithTenant returns a context scoped to the org orgID. The tenant views of
+// the storage, cache and queue modules keep the data of each org apart
+// using it; the tenant package's middleware sets it from requests.
+func WithTenant(ctx context.Context, orgID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, orgID)
+}
+
+// TenantFromContext returns the org ID ctx is scoped to, or "".
+func TenantFromContext(ctx context.Context) string {
+	orgID, _ := ctx.Value(tenantContextKey{}).(string)
+	return orgID
+}
+
+// RequireTenant returns the org ID ctx is scoped to, or ErrNoTenant. Org
+// IDs that can't be used safely in keys, because they contain a slash,
+// backslash or colon or are "." or "..", fail with ErrNoTenant too.
+func RequireTenant(ctx context.Context) (string, error) {
+	orgID := TenantFromContext(ctx)
+	if orgID == "" {
+		return "", ErrNoTenant
+	}
+	if strings.ContainsAny(orgID, "/\\:") || orgID == "." || orgID == ".." {
+		return "", fmt.Errorf("%w: invalid org ID %q", ErrNoTenant, orgID)
+	}
+	return orgID, nil
+}
@@ -0,0 +1,276 @@
+package chassis
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis/internal/sqlitedb"
+)
+
+var (
+	ErrUnknownDatabase  = NewError(CodeNotFound, "database not configured")
+	ErrNoDatabaseDriver = NewError(CodeFailedPrecondition, "no database driver for scheme")
+)
+
+// databaseSecrets masks the DSNs under databases, which usually embed
+// credentials.
+var databaseSecrets = []string{"databases.*", "databases.*.dsn"}
+
+// DatabaseOpener opens a connection pool for a DSN, scheme included.
+type DatabaseOpener func(dsn string) (*sql.DB, error)
+
+// WithDatabaseScheme sets how the app opens DSNs with scheme, for drivers
+// that need more than sql.Open. The app opens "sqlite" with the pragmas
+// the SQLite stores share unless this replaces it. Schemes without an
+// opener are opened with the database/sql driver of the same name, so
+// importing a driver is enough:
+//
+//	import _ "github.com/lib/pq" // postgres://...
+func WithDatabaseScheme(scheme string, open DatabaseOpener) Option {
+	return func(app *App) {
+		state := &app.databases
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		state.openers[scheme] = open
+	}
+}
+
+// openSQLite opens "sqlite:path" DSNs like the SQLite stores open their
+// own files.
+func openSQLite(dsn string) (*sql.DB, error) {
+	return sqlitedb.Open(strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite:"), "//"))
+}
+
+// DatabaseConfig is a database the app opens and owns.
+type DatabaseConfig struct {
+	DSN             string
+	MaxOpenConns    int           // 0 keeps the driver's default
+	MaxIdleConns    int           // 0 keeps the driver's default
+	ConnMaxLifetime time.Duration // 0 reuses connections forever
+}
+
+// databasePools is the state behind Database.
+type databasePools struct {
+	mu      sync.Mutex
+	configs map[string]DatabaseConfig // from WithDatabase, over the config
+	openers map[string]DatabaseOpener // by scheme, see WithDatabaseScheme
+	pools   map[string]*sql.DB
+	order   []string // names in the order they were opened
+}
+
+// WithDatabase defines the database name, overriding the same name under
+// databases in config.
+func WithDatabase(name string, cfg DatabaseConfig) Option {
+	return func(app *App) {
+		state := &app.databases
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		if state.configs == nil {
+			state.configs = make(map[string]DatabaseConfig)
+		}
+		state.configs[name] = cfg
+	}
+}
+
+// Database returns the connection pool of the named database, opening it
+// on first use. Databases are defined under databases in config, as a DSN
+// or with pool settings, or with WithDatabase:
+//
+//	databases:
+//	  main: sqlite:./data/app.db
+//	  analytics:
+//	    dsn: postgres://app:${PG_PASSWORD}@db/analytics
+//	    max_open_conns: 20
+//	    conn_max_lifetime: 30m
+//
+// The app owns the pools and closes them after the modules shut down, so
+// modules sharing one database share its pool. A DSN without a scheme is
+// a SQLite path.
+func (app *App) Database(name string) (*sql.DB, error) {
+	state := &app.databases
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if pool, ok := state.pools[name]; ok {
+		return pool, nil
+	}
+
+	cfg, ok := state.configs[name]
+	if !ok {
+		var err error
+		if cfg, ok, err = databaseFromConfig(app.ConfigData(), name); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDatabase, name)
+	}
+
+	pool, err := openDatabase(cfg, state.openers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", name, err)
+	}
+	if state.pools == nil {
+		state.pools = make(map[string]*sql.DB)
+	}
+	state.pools[name] = pool
+	state.order = append(state.order, name)
+	app.logger.Info("database opened", "database", name, "scheme", databaseScheme(cfg.DSN))
+	return pool, nil
+}
+
+// ModuleDatabase returns the database a module's config names in its
+// database setting (users.database for "users"), or nil if it names none
+// and the module opens its own:
+//
+//	users:
+//	  database: main
+func (app *App) ModuleDatabase(module string) (*sql.DB, error) {
+	cfg := app.ConfigData()
+	if cfg == nil {
+		return nil, nil
+	}
+	name := cfg.GetString(module + ".database")
+	if name == "" {
+		return nil, nil
+	}
+	return app.Database(name)
+}
+
+// Databases returns the names of the databases opened so far, sorted.
+func (app *App) Databases() []string {
+	state := &app.databases
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	names := slices.Clone(state.order)
+	sort.Strings(names)
+	return names
+}
+
+// closeDatabases closes the pools in the reverse order they were opened.
+func (app *App) closeDatabases() error {
+	state := &app.databases
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	var errs []error
+	for i := len(state.order) - 1; i >= 0; i-- {
+		name := state.order[i]
+		if err := state.pools[name].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database %s: %w", name, err))
+		}
+	}
+	state.pools = nil
+	state.order = nil
+	return errors.Join(errs...)
+}
+
+// databaseFromConfig reads databases.<name>, a DSN or a map of settings.
+func databaseFromConfig(data ConfigData, name string) (DatabaseConfig, bool, error) {
+	if data == nil {
+		return DatabaseConfig{}, false, nil
+	}
+	key := "databases." + name
+	switch value := data.Get(key).(type) {
+	case nil:
+		return DatabaseConfig{}, false, nil
+	case string:
+		return DatabaseConfig{DSN: value}, true, nil
+	}
+
+	cfg := DatabaseConfig{
+		DSN:          data.GetString(key + ".dsn"),
+		MaxOpenConns: data.GetInt(key + ".max_open_conns"),
+		MaxIdleConns: data.GetInt(key + ".max_idle_conns"),
+	}
+	if cfg.DSN == "" {
+		return cfg, false, fmt.Errorf("%w: %s.dsn", ErrMissingConfig, key)
+	}
+	if data.Get(key+".conn_max_lifetime") != nil {
+		lifetime, err := data.MustGetDuration(key + ".conn_max_lifetime")
+		if err != nil {
+			return cfg, false, err
+		}
+		cfg.ConnMaxLifetime = lifetime
+	}
+	return cfg, true, nil
+}
+
+// openDatabase opens cfg's DSN with the opener of its scheme, or the
+// database/sql driver of that name, and applies the pool settings.
+func openDatabase(cfg DatabaseConfig, openers map[string]DatabaseOpener) (*sql.DB, error) {
+	scheme := databaseScheme(cfg.DSN)
+	dsn := cfg.DSN
+	if !strings.HasPrefix(dsn, scheme+":") {
+		dsn = scheme + ":" + dsn
+	}
+
+	open, ok := openers[scheme]
+	if !ok {
+		driver, found := databaseDriver(scheme)
+		if !found {
+			return nil, fmt.Errorf("%w %q; import its database/sql driver", ErrNoDatabaseDriver, scheme)
+		}
+		open = func(dsn string) (*sql.DB, error) { return sql.Open(driver, dsn) }
+	}
+
+	pool, err := open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if err := pool.PingContext(context.Background()); err != nil {
+		_ = pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// driverAliases lists the database/sql drivers that accept a scheme's
+// URLs under another name.
+var driverAliases = map[string][]string{
+	"postgres":   {"postgres", "pgx"},
+	"postgresql": {"postgres", "pgx"},
+}
+
+// databaseDriver returns the registered database/sql driver for scheme.
+func databaseDriver(scheme string) (string, bool) {
+	candidates, ok := driverAliases[scheme]
+	if !ok {
+		candidates = []string{scheme}
+	}
+	drivers := sql.Drivers()
+	for _, candidate := range candidates {
+		if slices.Contains(drivers, candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// databaseScheme returns the scheme of a DSN, "sqlite" for a bare path or
+// a SQLite file: URI.
+func databaseScheme(dsn string) string {
+	scheme, _, ok := strings.Cut(dsn, ":")
+	if !ok || len(scheme) < 2 || scheme == "file" {
+		return "sqlite" // no scheme, a Windows drive letter or a SQLite URI
+	}
+	if parsed, err := url.Parse(dsn); err != nil || parsed.Scheme != strings.ToLower(scheme) {
+		return "sqlite"
+	}
+	return scheme
+}
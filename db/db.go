@@ -0,0 +1,167 @@
+// Package db provides the query helpers shared by the chassis stores, so
+// each one doesn't hand-roll its scan loops, paging and list options.
+//
+// Query runs a statement and scans every row with a store's scan function:
+//
+//	users, err := db.Query(ctx, conn, scanUser, `SELECT `+userColumns+` FROM users`)
+//
+// Filter and Sort build the WHERE and ORDER BY clauses of a listing from
+// its options, consistently across stores:
+//
+//	var filter db.Filter
+//	filter.Search(opts.Query, "email", "name")
+//	where, args := filter.Clause()
+//	order, ok := userSort.OrderBy(opts.SortBy)
+//
+// Paginate turns a store's list and count into a pagination.Result, the
+// page type every chassis listing returns:
+//
+//	return db.Paginate(ctx, req,
+//	    func(ctx context.Context, offset, limit int) ([]*User, error) {
+//	        return store.List(ctx, opts, offset, limit)
+//	    },
+//	    func(ctx context.Context) (int, error) { return store.Count(ctx, opts) },
+//	)
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/talosaether/chassis/pagination"
+)
+
+// Querier runs queries. *sql.DB, *sql.Tx and *sql.Conn implement it.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Scanner is implemented by *sql.Row and *sql.Rows, so one scan function
+// serves single-row lookups and listings.
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// Query runs query and scans each row with scan. It returns an empty,
+// non-nil slice when there are no rows.
+func Query[T any](ctx context.Context, querier Querier, scan func(Scanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := querier.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	items := make([]T, 0)
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Paginate returns the page of a listing selected by req: list fetches the
+// items at offset and count the total.
+func Paginate[T any](ctx context.Context, req pagination.Request,
+	list func(ctx context.Context, offset, limit int) ([]T, error),
+	count func(ctx context.Context) (int, error),
+) (*pagination.Result[T], error) {
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := list(ctx, offset, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(items, req, offset, total), nil
+}
+
+// Filter collects the conditions of a WHERE clause. The zero value matches
+// everything.
+type Filter struct {
+	conditions []string
+	args       []any
+}
+
+// Where adds a condition with its placeholder arguments.
+func (filter *Filter) Where(condition string, args ...any) {
+	filter.conditions = append(filter.conditions, condition)
+	filter.args = append(filter.args, args...)
+}
+
+// Search adds a case-insensitive match of query anywhere in any of
+// columns. An empty query adds nothing.
+func (filter *Filter) Search(query string, columns ...string) {
+	if query == "" || len(columns) == 0 {
+		return
+	}
+	pattern := "%" + EscapeLike(query) + "%"
+	matches := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		matches[i] = column + ` LIKE ? ESCAPE '\'`
+		args[i] = pattern
+	}
+	condition := strings.Join(matches, ` OR `)
+	if len(columns) > 1 {
+		condition = `(` + condition + `)`
+	}
+	filter.Where(condition, args...)
+}
+
+// Clause returns the WHERE clause, with a leading space, and its
+// arguments, or "" and nil if there are no conditions.
+func (filter *Filter) Clause() (string, []any) {
+	if len(filter.conditions) == 0 {
+		return "", nil
+	}
+	return ` WHERE ` + strings.Join(filter.conditions, ` AND `), filter.args
+}
+
+// EscapeLike escapes the LIKE wildcards in a search query, for use with
+// ESCAPE '\'.
+func EscapeLike(query string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+}
+
+// Sort maps the SortBy values of a listing to columns. SortBy names a
+// field, with a "-" prefix for descending, as in ListOptions across the
+// chassis modules.
+type Sort struct {
+	Columns  map[string]string // field to SQL column or expression
+	Default  string            // SortBy used when it's empty, e.g. "-created_at"
+	Tiebreak string            // unique column ordering equal rows, so pages are stable
+}
+
+// OrderBy returns the ORDER BY clause, without the keywords, for sortBy.
+// It reports false for a field not in Columns.
+func (sort Sort) OrderBy(sortBy string) (string, bool) {
+	if sortBy == "" {
+		sortBy = sort.Default
+	}
+	field, descending := strings.CutPrefix(sortBy, "-")
+	column, ok := sort.Columns[field]
+	if !ok {
+		return "", false
+	}
+	if descending {
+		column += ` DESC`
+	}
+	if sort.Tiebreak != "" {
+		if descending {
+			return column + `, ` + sort.Tiebreak + ` DESC`, true
+		}
+		return column + `, ` + sort.Tiebreak, true
+	}
+	return column, true
+}
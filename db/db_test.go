@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/talosaether/chassis/internal/sqlite"
+	"github.com/talosaether/chassis/pagination"
+)
+
+func TestQueryScansRows(t *testing.T) {
+	ctx := context.Background()
+	conn, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, `INSERT INTO items (name) VALUES ('a_1'), ('b%2'), ('c3')`); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+
+	scanName := func(row Scanner) (string, error) {
+		var name string
+		err := row.Scan(&name)
+		return name, err
+	}
+
+	names, err := Query(ctx, conn, scanName, `SELECT name FROM items WHERE name = ?`, "none")
+	if err != nil || names == nil || len(names) != 0 {
+		t.Errorf("expected an empty, non-nil slice, got %#v, %v", names, err)
+	}
+
+	var filter Filter
+	filter.Search("_", "name")
+	where, args := filter.Clause()
+	names, err = Query(ctx, conn, scanName, `SELECT name FROM items`+where, args...)
+	if err != nil || len(names) != 1 || names[0] != "a_1" {
+		t.Errorf("expected the wildcard to match literally, got %v, %v", names, err)
+	}
+
+	failing := func(row Scanner) (string, error) { return "", errors.New("bad row") }
+	if _, err := Query(ctx, conn, failing, `SELECT name FROM items`); err == nil {
+		t.Error("expected the scan error")
+	}
+}
+
+func TestFilterClause(t *testing.T) {
+	var filter Filter
+	if where, args := filter.Clause(); where != "" || args != nil {
+		t.Errorf("expected no clause, got %q %v", where, args)
+	}
+
+	filter.Search("", "email")
+	filter.Search("acme", "email", "name")
+	filter.Where(`created_ms > ?`, 10)
+	where, args := filter.Clause()
+	want := ` WHERE (email LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\') AND created_ms > ?`
+	if where != want || len(args) != 3 || args[0] != "%acme%" || args[2] != 10 {
+		t.Errorf("unexpected clause %q %v", where, args)
+	}
+}
+
+func TestSortOrderBy(t *testing.T) {
+	sort := Sort{
+		Columns:  map[string]string{"created_at": "created_ms", "name": "name"},
+		Default:  "-created_at",
+		Tiebreak: "id",
+	}
+	tests := map[string]string{
+		"":            "created_ms DESC, id DESC",
+		"name":        "name, id",
+		"-name":       "name DESC, id DESC",
+		"created_at":  "created_ms, id",
+		"-created_at": "created_ms DESC, id DESC",
+	}
+	for sortBy, want := range tests {
+		if got, ok := sort.OrderBy(sortBy); !ok || got != want {
+			t.Errorf("OrderBy(%q) = %q, %v, want %q", sortBy, got, ok, want)
+		}
+	}
+	if _, ok := sort.OrderBy("password_hash"); ok {
+		t.Error("expected an unknown field to be rejected")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	ctx := context.Background()
+	items := []int{1, 2, 3, 4, 5}
+	list := func(ctx context.Context, offset, limit int) ([]int, error) {
+		return items[offset:min(offset+limit, len(items))], nil
+	}
+	count := func(ctx context.Context) (int, error) { return len(items), nil }
+
+	page, err := Paginate(ctx, pagination.Request{Limit: 2}, list, count)
+	if err != nil || len(page.Items) != 2 || page.Total != 5 || !page.HasMore {
+		t.Fatalf("unexpected first page %+v, %v", page, err)
+	}
+	page, err = Paginate(ctx, pagination.Request{Limit: 2, Cursor: page.NextCursor}, list, count)
+	if err != nil || page.Items[0] != 3 || page.Page != 2 {
+		t.Errorf("unexpected second page %+v, %v", page, err)
+	}
+
+	if _, err := Paginate(ctx, pagination.Request{Cursor: "bogus"}, list, count); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
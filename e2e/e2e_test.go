@@ -1,16 +1,31 @@
 package e2e
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/alerts"
+	"github.com/talosaether/chassis/api"
 	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/builtin"
 	"github.com/talosaether/chassis/cache"
 	"github.com/talosaether/chassis/email"
 	"github.com/talosaether/chassis/events"
@@ -44,7 +59,7 @@ func setupTestApp(t *testing.T) (*chassis.App, func()) {
 			users.New(users.WithDBPath(filepath.Join(tmpDir, "users.db"))),
 			auth.New(auth.WithDBPath(filepath.Join(tmpDir, "sessions.db"))),
 			orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db"))),
-			permissions.New(),
+			permissions.New(permissions.WithDBPath(filepath.Join(tmpDir, "permissions.db"))),
 			cache.New(),
 			queue.New(queue.WithDBPath(filepath.Join(tmpDir, "queue.db"))),
 			email.New(email.WithProvider(emailProvider)),
@@ -492,7 +507,7 @@ func TestIntegratedUserOrgWorkflow(t *testing.T) {
 			users.New(users.WithDBPath(filepath.Join(tmpDir, "users.db"))),
 			auth.New(auth.WithDBPath(filepath.Join(tmpDir, "sessions.db"))),
 			orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db"))),
-			permissions.New(),
+			permissions.New(permissions.WithDBPath(filepath.Join(tmpDir, "permissions.db"))),
 			cache.New(),
 			queue.New(queue.WithDBPath(filepath.Join(tmpDir, "queue.db"))),
 			email.New(email.WithProvider(emailProvider)),
@@ -523,9 +538,6 @@ func TestIntegratedUserOrgWorkflow(t *testing.T) {
 	}
 	user := userResult.(*users.User)
 
-	// Publish user created event
-	app.Events().Publish(ctx, "user.created", map[string]string{"user_id": user.GetID()})
-
 	// Step 2: Create an organization
 	orgResult, err := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Alice's Company"})
 	if err != nil {
@@ -533,9 +545,6 @@ func TestIntegratedUserOrgWorkflow(t *testing.T) {
 	}
 	org := orgResult.(*orgs.Org)
 
-	// Publish org created event
-	app.Events().Publish(ctx, "org.created", map[string]string{"org_id": org.ID()})
-
 	// Step 3: Add user as owner
 	app.Orgs().AddMember(ctx, org.ID(), user.GetID(), "owner")
 
@@ -577,7 +586,7 @@ func TestIntegratedUserOrgWorkflow(t *testing.T) {
 	}
 
 	// Verify all operations
-	// Check events were logged
+	// Check lifecycle events were published by the modules
 	eventMu.Lock()
 	if len(eventLog) != 2 {
 		t.Errorf("expected 2 events, got %d", len(eventLog))
@@ -604,31 +613,71 @@ func TestIntegratedUserOrgWorkflow(t *testing.T) {
 	}
 }
 
-// TestConcurrentOperations tests thread safety across modules.
-// Note: SQLite has limited concurrent write support, so this test focuses on
-// concurrent reads and in-memory operations (cache, events) while doing
-// sequential database writes.
+// TestConcurrentOperations tests thread safety across modules, including
+// concurrent writes to the SQLite stores, which wait on each other with
+// WAL and a busy timeout instead of failing with SQLITE_BUSY.
 func TestConcurrentOperations(t *testing.T) {
 	app, cleanup := setupTestApp(t)
 	defer cleanup()
 
 	ctx := context.Background()
 
-	// First, create users sequentially (SQLite limitation)
-	for i := 0; i < 5; i++ {
-		email := fmt.Sprintf("user%d@example.com", i)
-		_, err := app.Users().Create(ctx, email, "password123")
-		if err != nil {
-			t.Fatalf("failed to create user %d: %v", i, err)
-		}
+	var writes sync.WaitGroup
+	writeErrs := make(chan error, 40)
+	for i := 0; i < 10; i++ {
+		writes.Add(2)
+		go func(n int) {
+			defer writes.Done()
+			if _, err := app.Users().Create(ctx, fmt.Sprintf("user%d@example.com", n), "password123"); err != nil {
+				writeErrs <- fmt.Errorf("create user %d: %w", n, err)
+			}
+		}(i)
+		go func(n int) {
+			defer writes.Done()
+			if _, err := app.Queue().Enqueue(ctx, "job_type", map[string]int{"n": n}); err != nil {
+				writeErrs <- fmt.Errorf("enqueue job %d: %w", n, err)
+			}
+		}(i)
 	}
-
-	// Enqueue jobs sequentially (SQLite limitation)
-	for i := 0; i < 5; i++ {
-		_, err := app.Queue().Enqueue(ctx, "job_type", map[string]int{"n": i})
-		if err != nil {
-			t.Fatalf("failed to enqueue job %d: %v", i, err)
+	writes.Wait()
+
+	// Concurrent workers claim and complete every job exactly once
+	claimed := make(chan string, 10)
+	for i := 0; i < 4; i++ {
+		writes.Add(1)
+		go func() {
+			defer writes.Done()
+			for {
+				result, err := app.Queue().Dequeue(ctx)
+				if err != nil {
+					if !errors.Is(err, queue.ErrNoJobs) {
+						writeErrs <- fmt.Errorf("dequeue: %w", err)
+					}
+					return
+				}
+				job := result.(*queue.Job)
+				if err := app.Queue().Complete(ctx, job.ID); err != nil {
+					writeErrs <- fmt.Errorf("complete job: %w", err)
+				}
+				claimed <- job.ID
+			}
+		}()
+	}
+	writes.Wait()
+	close(writeErrs)
+	close(claimed)
+	for err := range writeErrs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+	seen := map[string]bool{}
+	for id := range claimed {
+		if seen[id] {
+			t.Errorf("job %s claimed twice", id)
 		}
+		seen[id] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("expected 10 jobs claimed, got %d", len(seen))
 	}
 
 	var wg sync.WaitGroup
@@ -671,7 +720,7 @@ func TestConcurrentOperations(t *testing.T) {
 		wg.Add(1)
 		go func(n int) {
 			defer wg.Done()
-			email := fmt.Sprintf("user%d@example.com", n%5)
+			email := fmt.Sprintf("user%d@example.com", n%10)
 			_, err := app.Users().GetByEmail(ctx, email)
 			if err != nil {
 				errChan <- err
@@ -682,13 +731,13 @@ func TestConcurrentOperations(t *testing.T) {
 	wg.Wait()
 	close(errChan)
 
-	var errors []error
+	var errs []error
 	for err := range errChan {
-		errors = append(errors, err)
+		errs = append(errs, err)
 	}
 
-	if len(errors) > 0 {
-		t.Errorf("concurrent operations had errors: %v", errors)
+	if len(errs) > 0 {
+		t.Errorf("concurrent operations had errors: %v", errs)
 	}
 }
 
@@ -783,6 +832,75 @@ func TestMultipleOrgsPerUser(t *testing.T) {
 	}
 }
 
+// TestTeamPermissions tests that permissions granted to a team apply to its members.
+func TestTeamPermissions(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	orgsMod := app.Orgs().(*orgs.Module)
+
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Team Org"})
+	org := orgResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, org.ID(), "user-1", "member")
+
+	if app.Permissions().Can(ctx, "user-1", "org:manage_members", org.ID()) {
+		t.Fatal("member should NOT be able to manage members")
+	}
+
+	team, err := orgsMod.CreateTeam(ctx, org.ID(), "Admins", "admin")
+	if err != nil {
+		t.Fatalf("CreateTeam failed: %v", err)
+	}
+	if _, err := orgsMod.AddTeamMember(ctx, team.ID, "user-1"); err != nil {
+		t.Fatalf("AddTeamMember failed: %v", err)
+	}
+	if !app.Permissions().Can(ctx, "user-1", "org:manage_members", org.ID()) {
+		t.Error("admin team member should be able to manage members")
+	}
+	if !app.Permissions().HasRole(ctx, "user-1", "admin", org.ID()) {
+		t.Error("admin team member should have the admin role")
+	}
+
+	orgsMod.RemoveTeamMember(ctx, team.ID, "user-1")
+	if app.Permissions().Can(ctx, "user-1", "org:manage_members", org.ID()) {
+		t.Error("permissions should end with team membership")
+	}
+}
+
+// TestResourceGrants tests that resource grants apply before org roles.
+func TestResourceGrants(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Grant Org"})
+	org := orgResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, org.ID(), "user-1", "member")
+
+	if err := app.Permissions().Grant(ctx, "user-1", "document:42", "edit"); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if !app.Permissions().Can(ctx, "user-1", "edit", "document:42") {
+		t.Error("grant should allow editing document:42")
+	}
+	if !app.Permissions().Can(ctx, "user-1", "org:read", org.ID()) || app.Permissions().Can(ctx, "user-1", "org:delete", org.ID()) {
+		t.Error("org roles should still apply to the org")
+	}
+
+	// Deleting the user drops their grants
+	result, _ := app.Users().Create(ctx, "shared@example.com", "password123")
+	user := result.(*users.User)
+	app.Permissions().Grant(ctx, user.ID, "document:42", "view")
+	if err := app.Users().(*users.Module).Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	grants, _ := app.Permissions().(*permissions.Module).UserGrants(ctx, user.ID)
+	if len(grants) != 0 {
+		t.Errorf("expected grants of deleted user to be gone, got %d", len(grants))
+	}
+}
+
 // TestQueueJobFiltering tests job filtering by status and single job lookup.
 func TestQueueJobFiltering(t *testing.T) {
 	app, cleanup := setupTestApp(t)
@@ -961,3 +1079,1545 @@ func TestEventsAsyncPublish(t *testing.T) {
 		mu.Unlock()
 	}
 }
+
+// TestSnapshotRestore verifies that module state can be captured once and
+// restored between tests.
+func TestSnapshotRestore(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Expensive setup: user, org, membership, cached value, stored file
+	userResult, _ := app.Users().Create(ctx, "snapshot@example.com", "password123")
+	user := userResult.(*users.User)
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Snapshot Org"})
+	org := orgResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, org.ID(), user.GetID(), "owner")
+	app.Cache().Set(ctx, "greeting", []byte("hello"))
+	app.Storage().Put(ctx, "docs/readme.txt", []byte("original"))
+
+	snap, err := app.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	defer snap.Close()
+
+	if len(snap.Modules()) == 0 {
+		t.Fatal("snapshot should include modules")
+	}
+
+	// Mutate state as a test would
+	app.Users().Create(ctx, "extra@example.com", "password123")
+	app.Orgs().Delete(ctx, org.ID())
+	app.Cache().Delete(ctx, "greeting")
+	app.Storage().Put(ctx, "docs/readme.txt", []byte("modified"))
+	app.Storage().Put(ctx, "docs/new.txt", []byte("new"))
+	app.Queue().Enqueue(ctx, "task", nil)
+
+	if err := app.Restore(ctx, snap); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if _, err := app.Users().GetByEmail(ctx, "extra@example.com"); err == nil {
+		t.Error("user created after snapshot should be gone")
+	}
+	if _, err := app.Users().GetByEmail(ctx, "snapshot@example.com"); err != nil {
+		t.Errorf("user from setup should exist: %v", err)
+	}
+	if role := app.Orgs().GetUserRole(ctx, org.ID(), user.GetID()); role != "owner" {
+		t.Errorf("membership should be restored, got role %q", role)
+	}
+	if value, found := app.Cache().Get(ctx, "greeting"); !found || string(value) != "hello" {
+		t.Error("cache entry should be restored")
+	}
+	data, err := app.Storage().Get(ctx, "docs/readme.txt")
+	if err != nil || string(data) != "original" {
+		t.Errorf("stored file should be restored, got %q (%v)", data, err)
+	}
+	if _, err := app.Storage().Get(ctx, "docs/new.txt"); !os.IsNotExist(err) {
+		t.Error("file created after snapshot should be gone")
+	}
+	pendingResult, _ := app.Queue().GetPending(ctx)
+	if pending := pendingResult.([]*queue.Job); len(pending) != 0 {
+		t.Errorf("expected no pending jobs after restore, got %d", len(pending))
+	}
+
+	// Restoring twice must be safe
+	if err := app.Restore(ctx, snap); err != nil {
+		t.Fatalf("second Restore failed: %v", err)
+	}
+}
+
+// TestLifecycleEvents tests that modules publish lifecycle events automatically.
+func TestLifecycleEvents(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var received []string
+	record := events.Handler(func(ctx context.Context, eventType string, payload any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, eventType)
+		return nil
+	})
+	for _, eventType := range []string{
+		users.EventUserCreated, users.EventUserUpdated, users.EventUserDeleted,
+		orgs.EventOrgCreated, orgs.EventMemberAdded, orgs.EventMemberRemoved,
+		auth.EventLogin, auth.EventLogout,
+		queue.EventJobCompleted, queue.EventJobFailed,
+	} {
+		app.Events().Subscribe(eventType, record)
+	}
+
+	var created *users.UserEvent
+	app.Events().Subscribe(users.EventUserCreated, events.Handler(func(ctx context.Context, eventType string, payload any) error {
+		created = payload.(*users.UserEvent)
+		return nil
+	}))
+
+	usersMod := app.Users().(*users.Module)
+	userResult, err := usersMod.Create(ctx, "lifecycle@example.com", "password123")
+	if err != nil {
+		t.Fatalf("create user failed: %v", err)
+	}
+	user := userResult.(*users.User)
+	newEmail := "renamed@example.com"
+	if _, err := usersMod.Update(ctx, user.ID, users.UpdateInput{Email: &newEmail}); err != nil {
+		t.Fatalf("update user failed: %v", err)
+	}
+
+	orgResult, err := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Lifecycle Inc"})
+	if err != nil {
+		t.Fatalf("create org failed: %v", err)
+	}
+	org := orgResult.(*orgs.Org)
+	if _, err := app.Orgs().AddMember(ctx, org.ID(), user.ID, "member"); err != nil {
+		t.Fatalf("add member failed: %v", err)
+	}
+	if err := app.Orgs().RemoveMember(ctx, org.ID(), user.ID); err != nil {
+		t.Fatalf("remove member failed: %v", err)
+	}
+
+	authMod := app.Auth().(*auth.Module)
+	loginRecorder := httptest.NewRecorder()
+	if _, err := authMod.Login(ctx, loginRecorder, newEmail, "password123"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	logoutRequest := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	for _, cookie := range loginRecorder.Result().Cookies() {
+		logoutRequest.AddCookie(cookie)
+	}
+	if err := authMod.Logout(ctx, httptest.NewRecorder(), logoutRequest); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+
+	for _, fail := range []bool{false, true} {
+		jobResult, err := app.Queue().Enqueue(ctx, "lifecycle", nil)
+		if err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+		job := jobResult.(*queue.Job)
+		if fail {
+			err = app.Queue().Fail(ctx, job.ID, errors.New("boom"))
+		} else {
+			err = app.Queue().Complete(ctx, job.ID)
+		}
+		if err != nil {
+			t.Fatalf("finishing job failed: %v", err)
+		}
+	}
+
+	if err := usersMod.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("delete user failed: %v", err)
+	}
+
+	want := []string{
+		"user.created", "user.updated",
+		"org.created", "org.member_added", "org.member_removed",
+		"auth.login", "auth.logout",
+		"job.completed", "job.failed",
+		"user.deleted",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(received) != fmt.Sprint(want) {
+		t.Errorf("expected events %v, got %v", want, received)
+	}
+	if created == nil || created.UserID != user.ID || created.Email != "lifecycle@example.com" {
+		t.Errorf("unexpected user.created payload: %+v", created)
+	}
+}
+
+// TestCheckConsistency tests cross-module consistency checks and repairs.
+func TestCheckConsistency(t *testing.T) {
+	tmpDir := t.TempDir()
+	usersStore, err := users.NewSQLiteStore(filepath.Join(tmpDir, "users.db"))
+	if err != nil {
+		t.Fatalf("failed to create users store: %v", err)
+	}
+	orgsStore, err := orgs.NewSQLiteStore(filepath.Join(tmpDir, "orgs.db"))
+	if err != nil {
+		t.Fatalf("failed to create orgs store: %v", err)
+	}
+	app := chassis.New(
+		chassis.WithModules(
+			users.New(users.WithStore(usersStore)),
+			auth.New(auth.WithDBPath(filepath.Join(tmpDir, "sessions.db"))),
+			orgs.New(orgs.WithStore(orgsStore)),
+			queue.New(queue.WithDBPath(filepath.Join(tmpDir, "queue.db"))),
+		),
+	)
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	report, err := app.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("fresh app should be consistent, got %+v", report.Issues)
+	}
+
+	usersMod := app.Users().(*users.Module)
+	userResult, _ := usersMod.Create(ctx, "gone@example.com", "password123")
+	user := userResult.(*users.User)
+
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Kept Org"})
+	keptOrg := orgResult.(*orgs.Org)
+	if _, err := app.Orgs().AddMember(ctx, keptOrg.ID(), user.ID, "member"); err != nil {
+		t.Fatalf("add member failed: %v", err)
+	}
+
+	authMod := app.Auth().(*auth.Module)
+	if _, err := authMod.Login(ctx, httptest.NewRecorder(), "gone@example.com", "password123"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	orgResult, _ = app.Orgs().Create(ctx, orgs.CreateInput{Name: "Deleted Org"})
+	deletedOrg := orgResult.(*orgs.Org)
+	if _, err := app.Queue().Enqueue(ctx, "report", map[string]string{"org_id": deletedOrg.ID()}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	// An org in its deletion grace period can be restored, so its jobs stay
+	orgResult, _ = app.Orgs().Create(ctx, orgs.CreateInput{Name: "Scheduled Org"})
+	scheduledOrg := orgResult.(*orgs.Org)
+	if _, err := app.Queue().Enqueue(ctx, "report", map[string]string{"org_id": scheduledOrg.ID()}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if err := app.Orgs().Delete(ctx, scheduledOrg.ID()); err != nil {
+		t.Fatalf("delete org failed: %v", err)
+	}
+
+	// Deleting behind the module's back leaves dangling references
+	if err := usersStore.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("delete user failed: %v", err)
+	}
+	if err := orgsStore.Delete(ctx, deletedOrg.ID()); err != nil {
+		t.Fatalf("delete org failed: %v", err)
+	}
+
+	report, err = app.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	kinds := make(map[string]int)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+	}
+	for _, kind := range []string{"orphaned_membership", "orphaned_session", "orphaned_job"} {
+		if kinds[kind] != 1 {
+			t.Errorf("expected one %s issue, got %d (%+v)", kind, kinds[kind], report.Issues)
+		}
+	}
+	if len(report.Plan()) != len(report.Issues) {
+		t.Errorf("expected a repair step per issue, got %v", report.Plan())
+	}
+
+	fixed, err := report.Fix(ctx)
+	if err != nil {
+		t.Fatalf("Fix failed: %v", err)
+	}
+	if fixed != len(report.Issues) {
+		t.Errorf("expected %d fixes, got %d", len(report.Issues), fixed)
+	}
+
+	report, err = app.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected no issues after Fix, got %+v", report.Issues)
+	}
+}
+
+// TestDeleteUserCascades tests that deleting a user removes their data in other modules.
+func TestDeleteUserCascades(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	usersMod := app.Users().(*users.Module)
+	orgsMod := app.Orgs().(*orgs.Module)
+	userResult, _ := usersMod.Create(ctx, "leaving@example.com", "password123")
+	user := userResult.(*users.User)
+	stayingResult, _ := usersMod.Create(ctx, "staying@example.com", "password123")
+	staying := stayingResult.(*users.User)
+
+	// Solely owned with another admin: ownership passes on
+	sharedResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Shared Org"})
+	shared := sharedResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, shared.ID(), user.ID, "owner")
+	app.Orgs().AddMember(ctx, shared.ID(), staying.ID, "admin")
+
+	// Solely owned and alone: deleted
+	soloResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Solo Org"})
+	solo := soloResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, solo.ID(), user.ID, "owner")
+
+	otherResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Other Org"})
+	other := otherResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, other.ID(), staying.ID, "owner")
+	app.Orgs().Invite(ctx, other.ID(), user.Email, "member")
+
+	authMod := app.Auth().(*auth.Module)
+	recorder := httptest.NewRecorder()
+	if _, err := authMod.Login(ctx, recorder, user.Email, "password123"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	plan, err := usersMod.PlanDelete(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("PlanDelete failed: %v", err)
+	}
+	kinds := make(map[string]int)
+	for _, action := range plan.Actions {
+		kinds[action.Kind]++
+	}
+	for _, kind := range []string{"ownership", "org", "invitation", "sessions"} {
+		if kinds[kind] != 1 {
+			t.Errorf("expected one %s action, got %d (%v)", kind, kinds[kind], plan.Plan())
+		}
+	}
+	if role := app.Orgs().GetUserRole(ctx, shared.ID(), user.ID); role != "owner" {
+		t.Fatal("PlanDelete should not change anything")
+	}
+
+	if err := usersMod.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if role := app.Orgs().GetUserRole(ctx, shared.ID(), staying.ID); role != "owner" {
+		t.Errorf("admin should inherit ownership, got %q", role)
+	}
+	if role := app.Orgs().GetUserRole(ctx, shared.ID(), user.ID); role != "" {
+		t.Errorf("deleted user should have no membership, got %q", role)
+	}
+	if _, err := app.Orgs().GetByID(ctx, solo.ID()); !errors.Is(err, orgs.ErrNotFound) {
+		t.Errorf("solely owned org without members should be deleted, got %v", err)
+	}
+	if pending, _ := orgsMod.ListInvitations(ctx, other.ID()); len(pending) != 0 {
+		t.Errorf("invitations to the deleted user should be revoked, got %d", len(pending))
+	}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	if _, err := authMod.GetSession(ctx, request); err == nil {
+		t.Error("sessions of the deleted user should be gone")
+	}
+
+	report, err := app.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("expected no dangling references, got %+v", report.Issues)
+	}
+}
+
+// TestRequireMiddleware tests that Permissions().Require composes with auth.RequireAuth.
+func TestRequireMiddleware(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	authMod := app.Auth().(*auth.Module)
+	userResult, _ := app.Users().Create(ctx, "member@example.com", "password123")
+	member := userResult.(*users.User)
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Middleware Org"})
+	org := orgResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, org.ID(), member.ID, "member")
+
+	recorder := httptest.NewRecorder()
+	if _, err := authMod.Login(ctx, recorder, member.Email, "password123"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	cookies := recorder.Result().Cookies()
+
+	orgIDFromQuery := func(request *http.Request) string {
+		return request.URL.Query().Get("org_id")
+	}
+	ok := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(permission string, signedIn bool) *httptest.ResponseRecorder {
+		handler := authMod.RequireAuth(app.Permissions().Require(permission, orgIDFromQuery)(ok))
+		request := httptest.NewRequest(http.MethodGet, "/?org_id="+org.ID(), nil)
+		if signedIn {
+			for _, cookie := range cookies {
+				request.AddCookie(cookie)
+			}
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := serve("org:read", true); response.Code != http.StatusNoContent {
+		t.Errorf("members can read the org, got %d", response.Code)
+	}
+	if response := serve("org:read", false); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a session, got %d", response.Code)
+	}
+
+	response := serve("org:manage_members", true)
+	if response.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a member managing members, got %d", response.Code)
+	}
+	var body struct {
+		Code    string                    `json:"code"`
+		Details permissions.DeniedDetails `json:"details"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error response: %v", err)
+	}
+	if body.Code != "permission_denied" || body.Details.Permission != "org:manage_members" || body.Details.Resource != org.ID() {
+		t.Errorf("unexpected error response: %+v", body)
+	}
+}
+
+// TestAppFromContext tests that requests, event handlers and job handlers can reach the app through their context.
+func TestAppFromContext(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	handler := app.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if chassis.FromContext(request.Context()) != app {
+			t.Error("expected the app in the request context")
+		}
+		if chassis.LoggerFromContext(request.Context()) == nil {
+			t.Error("expected a request logger")
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", response.Code)
+	}
+
+	ctx := context.Background()
+	if chassis.FromContext(ctx) != nil {
+		t.Fatal("expected no app in a bare context")
+	}
+
+	var fromEvent atomic.Pointer[chassis.App]
+	app.Events().Subscribe("context.checked", func(ctx context.Context, eventType string, payload any) {
+		fromEvent.Store(chassis.FromContext(ctx))
+	})
+	app.PublishEvent(ctx, "context.checked", nil)
+	if fromEvent.Load() != app {
+		t.Error("expected the app in the event handler context")
+	}
+
+	queueMod := app.Queue().(*queue.Module)
+	fromJob := make(chan *chassis.App, 1)
+	queueMod.Handle("context_check", func(ctx context.Context, job *queue.Job) error {
+		fromJob <- chassis.FromContext(ctx)
+		return nil
+	})
+	if _, err := queueMod.Enqueue(ctx, "context_check", nil); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	workerCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go queueMod.Worker(workerCtx, nil)
+	select {
+	case got := <-fromJob:
+		if got != app {
+			t.Error("expected the app in the job handler context")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not processed")
+	}
+}
+
+// TestRequestIDPropagation tests that a request's ID is returned, logged, and carried to the events and jobs it causes.
+func TestRequestIDPropagation(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	queueMod := app.Queue().(*queue.Module)
+
+	var fromEvent atomic.Value
+	app.Events().Subscribe("request.traced", func(ctx context.Context, eventType string, payload any) {
+		fromEvent.Store(chassis.RequestIDFromContext(ctx))
+	})
+	var logs bytes.Buffer
+	logger := slog.New(chassis.NewLogHandler(slog.NewJSONHandler(&logs, nil)))
+	handler := app.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		logger.InfoContext(ctx, "handling")
+		app.PublishEvent(ctx, "request.traced", nil)
+		if _, err := queueMod.Enqueue(ctx, "request_traced", nil); err != nil {
+			t.Errorf("enqueue failed: %v", err)
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("X-Request-ID", "trace-123")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if got := response.Header().Get("X-Request-ID"); got != "trace-123" {
+		t.Errorf("expected the client's request ID echoed, got %q", got)
+	}
+	if fromEvent.Load() != "trace-123" {
+		t.Errorf("expected the request ID in the event handler context, got %v", fromEvent.Load())
+	}
+	if !strings.Contains(logs.String(), `"request_id":"trace-123"`) {
+		t.Errorf("expected the request ID in the log, got %s", logs.String())
+	}
+
+	fromJob := make(chan string, 1)
+	queueMod.Handle("request_traced", func(ctx context.Context, job *queue.Job) error {
+		fromJob <- chassis.RequestIDFromContext(ctx)
+		return nil
+	})
+	workerCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go queueMod.Worker(workerCtx, nil)
+	select {
+	case got := <-fromJob:
+		if got != "trace-123" {
+			t.Errorf("expected the request ID in the job handler context, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not processed")
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("X-Request-ID", "bad id\nInjected: header")
+	response = httptest.NewRecorder()
+	app.Middleware(http.NotFoundHandler()).ServeHTTP(response, request)
+	if got := response.Header().Get("X-Request-ID"); got == "" || strings.ContainsAny(got, " \n") {
+		t.Errorf("expected an unusable request ID replaced, got %q", got)
+	}
+}
+
+// TestUserDataExportAndErasure tests exporting a user's data from every
+// module and erasing it with an audit trail.
+func TestUserDataExportAndErasure(t *testing.T) {
+	tmpDir := t.TempDir()
+	storageMod := storage.New(storage.WithBasePath(filepath.Join(tmpDir, "storage")))
+	usersMod := users.New(users.WithDBPath(filepath.Join(tmpDir, "users.db")), users.WithErasureDelay(0))
+	authMod := auth.New(auth.WithDBPath(filepath.Join(tmpDir, "sessions.db")))
+	app := chassis.New(chassis.WithModules(
+		storageMod, usersMod, authMod,
+		orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db"))),
+		events.New(),
+	))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	userResult, _ := usersMod.Create(ctx, "leaving@example.com", "password123")
+	user := userResult.(*users.User)
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Acme"})
+	org := orgResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, org.ID(), user.ID, "member")
+	if _, err := authMod.Login(ctx, httptest.NewRecorder(), user.Email, "password123"); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if err := storageMod.ForUser(user.ID).Put(ctx, "avatar.png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := app.Users().ExportData(ctx, user.ID, &buf); err != nil {
+		t.Fatalf("ExportData failed: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid bundle: %v", err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		files[file.Name] = string(data)
+	}
+	for _, name := range []string{"users/profile.json", "auth/sessions.json", "auth/login_history.json", "orgs/memberships.json", "storage/files/avatar.png", "manifest.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the bundle", name)
+		}
+	}
+	if !strings.Contains(files["orgs/memberships.json"], org.ID()) || strings.Contains(files["auth/sessions.json"], "token") {
+		t.Errorf("unexpected memberships or sessions: %s %s", files["orgs/memberships.json"], files["auth/sessions.json"])
+	}
+
+	var erased *users.ErasureEvent
+	app.Events().Subscribe(users.EventUserErased, func(ctx context.Context, eventType string, payload any) {
+		erased = payload.(*users.ErasureEvent)
+	})
+	result, err := app.Users().Erase(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Erase failed: %v", err)
+	}
+	if erasure := result.(*users.Erasure); erasure.Status != users.ErasureCompleted {
+		t.Fatalf("expected a completed erasure, got %+v", erasure)
+	}
+	if _, err := app.Users().GetByID(ctx, user.ID); !errors.Is(err, users.ErrNotFound) {
+		t.Errorf("expected the user to be erased, got %v", err)
+	}
+	if role := app.Orgs().GetUserRole(ctx, org.ID(), user.ID); role != "" {
+		t.Errorf("expected the membership to be removed, got %q", role)
+	}
+	if ok, _ := storageMod.Exists(ctx, "users/"+user.ID+"/avatar.png"); ok {
+		t.Error("expected the user's files to be deleted")
+	}
+	if erased == nil || len(erased.Actions) < 3 || erased.Email != "" {
+		t.Errorf("expected an erased event with the applied plan, got %+v", erased)
+	}
+	if erasures, err := usersMod.Erasures(ctx, user.ID); err != nil || len(erasures) != 1 || len(erasures[0].Actions) != len(erased.Actions) {
+		t.Errorf("expected the audit trail to be kept, got %v, %v", erasures, err)
+	}
+}
+
+// TestDeleteUserBlockedBySoleOwnership tests that SoleOwnerBlock keeps sole owners from being deleted.
+func TestDeleteUserBlockedBySoleOwnership(t *testing.T) {
+	tmpDir := t.TempDir()
+	app := chassis.New(
+		chassis.WithModules(
+			users.New(users.WithDBPath(filepath.Join(tmpDir, "users.db"))),
+			orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db")), orgs.WithSoleOwnerPolicy(orgs.SoleOwnerBlock)),
+		),
+	)
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	userResult, _ := app.Users().Create(ctx, "owner@example.com", "password123")
+	user := userResult.(*users.User)
+	orgResult, _ := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Blocked Org"})
+	org := orgResult.(*orgs.Org)
+	app.Orgs().AddMember(ctx, org.ID(), user.ID, "owner")
+
+	usersMod := app.Users().(*users.Module)
+	if err := usersMod.Delete(ctx, user.ID); !errors.Is(err, orgs.ErrLastOwner) {
+		t.Fatalf("expected ErrLastOwner, got %v", err)
+	}
+	if _, err := app.Users().GetByID(ctx, user.ID); err != nil {
+		t.Errorf("user should not be deleted: %v", err)
+	}
+}
+
+// TestRun tests that app.Run starts the HTTP server and queue workers and stops them on cancel.
+func TestRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	queueMod := queue.New(queue.WithDBPath(filepath.Join(tmpDir, "queue.db")), queue.WithWorkers(2))
+	server := api.NewServer(mux, api.WithAddr("127.0.0.1:0"))
+	app := chassis.New(chassis.WithModules(queueMod, server), chassis.WithShutdownTimeout(5*time.Second))
+
+	processed := make(chan string, 1)
+	queueMod.Handle("ping", func(ctx context.Context, job *queue.Job) error {
+		processed <- job.ID
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx) }()
+
+	job, err := queueMod.Enqueue(ctx, "ping", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	select {
+	case id := <-processed:
+		if id != job.(*queue.Job).ID {
+			t.Errorf("unexpected job %s processed", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers started by Run did not process the job")
+	}
+
+	var addr string
+	for deadline := time.Now().Add(5 * time.Second); addr == "" && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		addr = server.Addr()
+	}
+	response, err := http.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatalf("server started by Run not reachable: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", response.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run should stop cleanly on cancel, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if _, err := http.Get("http://" + addr + "/ping"); err == nil {
+		t.Error("server should be shut down")
+	}
+}
+
+// failingService is a module whose Start fails.
+type failingService struct{}
+
+func (failingService) Name() string                                     { return "failing" }
+func (failingService) Init(ctx context.Context, app *chassis.App) error { return nil }
+func (failingService) Shutdown(ctx context.Context) error               { return nil }
+func (failingService) Start(ctx context.Context) error                  { return errors.New("port in use") }
+
+// TestRunServiceFailure tests that Run stops and reports a failing service.
+func TestRunServiceFailure(t *testing.T) {
+	app := chassis.New(chassis.WithModules(failingService{}))
+	err := app.Run(context.Background())
+	if err == nil || err.Error() != `module "failing" failed: port in use` {
+		t.Errorf("expected the service's error, got %v", err)
+	}
+	if services := app.Services(); len(services) != 1 || services[0].State != chassis.ServiceFailed {
+		t.Errorf("expected a failed service, got %+v", services)
+	}
+}
+
+// panickingService is a module whose Start panics the first few times.
+type panickingService struct {
+	panics  atomic.Int32
+	running chan struct{}
+}
+
+func (*panickingService) Name() string                                     { return "flaky" }
+func (*panickingService) Init(ctx context.Context, app *chassis.App) error { return nil }
+func (*panickingService) Shutdown(ctx context.Context) error               { return nil }
+
+func (service *panickingService) Start(ctx context.Context) error {
+	if service.panics.Add(1) <= 2 {
+		panic("lost connection")
+	}
+	close(service.running)
+	<-ctx.Done()
+	return nil
+}
+
+// TestRunRestartsPanickingService tests that Run restarts a service that
+// panics and reports its restarts.
+func TestRunRestartsPanickingService(t *testing.T) {
+	service := &panickingService{running: make(chan struct{})}
+	app := chassis.New(chassis.WithModules(service))
+	mux := http.NewServeMux()
+	api.Mount(app, mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx) }()
+
+	select {
+	case <-service.running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("service was not restarted")
+	}
+	services := app.Services()
+	if len(services) != 1 || services[0].Name != "flaky" || services[0].State != chassis.ServiceRunning {
+		t.Fatalf("expected the service running, got %+v", services)
+	}
+	if services[0].Restarts != 2 || services[0].LastError != "panic: lost connection" {
+		t.Errorf("expected 2 restarts after panics, got %+v", services[0])
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var health struct {
+		Status   string `json:"status"`
+		Services []chassis.ServiceStatus
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+		t.Fatalf("failed to decode health: %v", err)
+	}
+	if health.Status != "ok" || len(health.Services) != 1 || health.Services[0].Restarts != 2 {
+		t.Errorf("expected service status in health, got %s", recorder.Body.String())
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run should stop cleanly after restarts, got %v", err)
+	}
+	if services := app.Services(); services[0].State != chassis.ServiceStopped {
+		t.Errorf("expected the service stopped, got %+v", services[0])
+	}
+}
+
+func TestConfigSecretsMasked(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+email:
+  smtp_host: smtp.example.com
+  smtp_password: hunter2
+billing:
+  stripe:
+    api_url: https://billing.example.com/?token=abc
+  providers:
+    - name: primary
+      secret: s3cr3t
+alerts:
+  channels:
+    ops:
+      type: webhook
+      url: https://hooks.example.com/T000/B000/XXXX
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	app := chassis.New(
+		chassis.WithSecretKeys("billing.*.api_url"),
+		chassis.WithConfigFile(configPath),
+		chassis.WithModules(alerts.New()),
+	)
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	cfg := app.ConfigData()
+	if cfg.GetString("email.smtp_password") != "hunter2" {
+		t.Errorf("expected the config itself unmasked, got %q", cfg.GetString("email.smtp_password"))
+	}
+
+	out, err := app.DumpConfig()
+	if err != nil {
+		t.Fatalf("DumpConfig failed: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "token=abc", "s3cr3t", "XXXX"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("expected %q masked in dump:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(string(out), "smtp.example.com") || !strings.Contains(string(out), chassis.MaskedValue) {
+		t.Errorf("expected other settings kept and secrets masked:\n%s", out)
+	}
+
+	safe, err := cfg.DumpSafe()
+	if err != nil {
+		t.Fatalf("DumpSafe failed: %v", err)
+	}
+	if strings.Contains(string(safe), "hunter2") || !strings.Contains(string(safe), "token=abc") {
+		t.Errorf("expected DumpSafe to mask secret names only without patterns:\n%s", safe)
+	}
+
+	var logs bytes.Buffer
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("effective config", "config", cfg)
+	if strings.Contains(logs.String(), "hunter2") || strings.Contains(logs.String(), "s3cr3t") || !strings.Contains(logs.String(), "smtp.example.com") {
+		t.Errorf("expected secrets masked in logs:\n%s", logs.String())
+	}
+
+	paths := cfg.SecretPaths(app.SecretKeys()...)
+	want := []string{"alerts.channels.ops.url", "billing.providers.secret", "billing.stripe.api_url", "email.smtp_password"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("expected secret paths %v, got %v", want, paths)
+	}
+
+	if !chassis.IsSecret("alerts.channels.ops.url", app.SecretKeys()...) || chassis.IsSecret("email.smtp_host", app.SecretKeys()...) {
+		t.Error("expected IsSecret to apply names and patterns")
+	}
+}
+
+func TestLayeredConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.staging.yaml")
+	files := map[string]string{
+		base: `
+chassis:
+  env: development
+cache:
+  default_ttl: 5m
+  max_entries: 100
+email:
+  provider: smtp
+  to: [dev@example.com]
+`,
+		override: `
+chassis:
+  env: staging
+cache:
+  default_ttl: 1m
+email:
+  to: [ops@example.com, oncall@example.com]
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+
+	app := chassis.New(chassis.WithConfigFiles(base, override, filepath.Join(dir, "override.local.yaml")))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	cfg := app.ConfigData()
+	if app.Config().Env != "staging" {
+		t.Errorf("expected the override's env, got %q", app.Config().Env)
+	}
+	if cfg.GetString("cache.default_ttl") != "1m" || cfg.GetInt("cache.max_entries") != 100 {
+		t.Errorf("expected sections merged key by key, got %v", cfg.Get("cache"))
+	}
+	if to, _ := cfg.Get("email.to").([]any); len(to) != 2 || cfg.GetString("email.provider") != "smtp" {
+		t.Errorf("expected lists replaced and other keys kept, got %v", cfg.Get("email"))
+	}
+
+	if _, err := chassis.LoadConfigFiles(filepath.Join(dir, "missing.yaml"), override); err == nil {
+		t.Error("expected a missing first file to fail")
+	}
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"service", "--config", base, "-config=" + override, "--", "--config", "ignored.yaml"}
+	if paths := chassis.ConfigPaths("config.yaml"); strings.Join(paths, ",") != base+","+override {
+		t.Errorf("expected the --config paths, got %v", paths)
+	}
+	os.Args = []string{"service"}
+	t.Setenv(chassis.ConfigEnvVar, base+", "+override)
+	if paths := chassis.ConfigPaths("config.yaml"); strings.Join(paths, ",") != base+","+override {
+		t.Errorf("expected the CHASSIS_CONFIG paths, got %v", paths)
+	}
+	t.Setenv(chassis.ConfigEnvVar, "")
+	if paths := chassis.ConfigPaths("config.yaml"); strings.Join(paths, ",") != "config.yaml" {
+		t.Errorf("expected the defaults, got %v", paths)
+	}
+}
+
+func TestRemoteConfigSources(t *testing.T) {
+	t.Setenv("REGION", "eu-west-1")
+	var (
+		mu      sync.Mutex
+		feature = "false"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case request.URL.Path == "/config.json":
+			fmt.Fprint(writer, `{"http": {"region": "${REGION}", "timeout": "5s"}}`)
+		case request.URL.Path == "/v1/kv/services/api" && request.URL.Query().Has("raw"):
+			if request.Header.Get("X-Consul-Token") != "consul-token" {
+				writer.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(writer, "features:\n  beta: %s\n", feature)
+		case request.URL.Path == "/v3/kv/range" && request.Method == http.MethodPost:
+			var body struct {
+				Key string `json:"key"`
+			}
+			_ = json.NewDecoder(request.Body).Decode(&body)
+			if body.Key != "c2VydmljZXMvYXBp" { // services/api
+				fmt.Fprint(writer, `{}`)
+				return
+			}
+			fmt.Fprint(writer, `{"kvs": [{"value": "aHR0cDoKICB0aW1lb3V0OiAxMHMK"}]}`) // http:\n  timeout: 10s\n
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("http:\n  addr: \":8080\"\n  timeout: 1s\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	app := chassis.New(
+		chassis.WithConfigFile(configPath),
+		chassis.WithConfigSources(
+			chassis.HTTPConfigSource(server.URL+"/config.json"),
+			chassis.ConsulConfigSource(server.URL, "services/api", chassis.WithSourceHeader("X-Consul-Token", "consul-token")),
+			chassis.EtcdConfigSource(server.URL, "services/api"),
+		),
+	)
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	cfg := app.ConfigData()
+	if cfg.GetString("http.addr") != ":8080" || cfg.GetString("http.region") != "eu-west-1" {
+		t.Errorf("expected the file and expanded HTTP source merged, got %v", cfg.Get("http"))
+	}
+	if cfg.GetString("http.timeout") != "10s" || cfg.GetBool("features.beta") {
+		t.Errorf("expected later sources to win, got %v", cfg)
+	}
+
+	var changes atomic.Int32
+	stop := app.OnConfigChange(func(cfg chassis.ConfigData) {
+		if cfg.GetBool("features.beta") {
+			changes.Add(1)
+		}
+	})
+	if err := app.RefreshConfig(context.Background()); err != nil {
+		t.Fatalf("RefreshConfig failed: %v", err)
+	}
+	if changes.Load() != 0 {
+		t.Error("expected no callback without a change")
+	}
+	mu.Lock()
+	feature = "true"
+	mu.Unlock()
+	if err := app.RefreshConfig(context.Background()); err != nil {
+		t.Fatalf("RefreshConfig failed: %v", err)
+	}
+	if changes.Load() != 1 || !app.ConfigData().GetBool("features.beta") {
+		t.Errorf("expected the refreshed config, got %v", app.ConfigData().Get("features"))
+	}
+	stop()
+
+	_, err := chassis.EtcdConfigSource(server.URL, "missing").Load(context.Background())
+	if !errors.Is(err, chassis.ErrConfigKeyNotFound) {
+		t.Errorf("expected ErrConfigKeyNotFound, got %v", err)
+	}
+	_, err = chassis.ConsulConfigSource(server.URL, "missing").Load(context.Background())
+	if !errors.Is(err, chassis.ErrConfigKeyNotFound) {
+		t.Errorf("expected ErrConfigKeyNotFound, got %v", err)
+	}
+}
+
+func TestTypedConfigGetters(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+service:
+  timeout: 1m30s
+  retry_after: 5
+  backoff: 0.5
+  ratio: 0.25
+  workers: 4
+  threshold: "2.5"
+  origins: [https://a.example.com, https://b.example.com]
+  hosts: "a.example.com, b.example.com"
+  labels:
+    team: growth
+    tier: 2
+    nested:
+      ignored: true
+  broken: soon
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := chassis.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if got := cfg.GetDuration("service.timeout"); got != 90*time.Second {
+		t.Errorf("expected 1m30s, got %s", got)
+	}
+	if got := cfg.GetDuration("service.retry_after"); got != 5*time.Second {
+		t.Errorf("expected plain numbers as seconds, got %s", got)
+	}
+	if got := cfg.GetDuration("service.backoff"); got != 500*time.Millisecond {
+		t.Errorf("expected 500ms, got %s", got)
+	}
+	if got := cfg.GetDuration("service.broken"); got != 0 {
+		t.Errorf("expected 0 for an invalid duration, got %s", got)
+	}
+	if _, err := cfg.MustGetDuration("service.broken"); !errors.Is(err, chassis.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
+	if _, err := cfg.MustGetDuration("service.missing"); !errors.Is(err, chassis.ErrMissingConfig) {
+		t.Errorf("expected ErrMissingConfig, got %v", err)
+	}
+
+	if cfg.GetFloat("service.ratio") != 0.25 || cfg.GetFloat("service.workers") != 4 || cfg.GetFloat("service.threshold") != 2.5 {
+		t.Error("expected floats from floats, ints and numeric strings")
+	}
+	if got := cfg.GetStringSlice("service.origins"); strings.Join(got, ",") != "https://a.example.com,https://b.example.com" {
+		t.Errorf("expected the list, got %v", got)
+	}
+	if got := cfg.GetStringSlice("service.hosts"); strings.Join(got, ",") != "a.example.com,b.example.com" {
+		t.Errorf("expected a comma-separated string split, got %v", got)
+	}
+	labels := cfg.GetStringMap("service.labels")
+	if len(labels) != 2 || labels["team"] != "growth" || labels["tier"] != "2" {
+		t.Errorf("expected scalar labels as strings, got %v", labels)
+	}
+	if cfg.GetStringSlice("service.missing") != nil || cfg.GetStringMap("service.missing") != nil {
+		t.Error("expected nil for missing settings")
+	}
+
+	badPath := filepath.Join(t.TempDir(), "bad.yaml")
+	if err := os.WriteFile(badPath, []byte("cache:\n  default_ttl: forever\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	app := chassis.New(chassis.WithConfigFile(badPath))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	if err := app.Register(context.Background(), cache.New()); !errors.Is(err, chassis.ErrInvalidConfig) {
+		t.Errorf("expected Init to fail on an invalid TTL, got %v", err)
+	}
+
+	for setting, mod := range map[string]chassis.Module{
+		"queue:\n  limits:\n    report:\n      per: hourly\n": queue.New(queue.WithDBPath(filepath.Join(t.TempDir(), "queue.db"))),
+		"orgs:\n  invite_ttl: weekly\n":                       orgs.New(orgs.WithDBPath(filepath.Join(t.TempDir(), "orgs.db"))),
+		"alerts:\n  interval: often\n":                        alerts.New(),
+	} {
+		if err := os.WriteFile(badPath, []byte(setting), 0600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		app := chassis.New(chassis.WithConfigFile(badPath))
+		if err := app.Register(context.Background(), mod); !errors.Is(err, chassis.ErrInvalidConfig) {
+			t.Errorf("expected %s Init to fail on %q, got %v", mod.Name(), setting, err)
+		}
+		_ = app.Shutdown(context.Background())
+	}
+}
+
+func TestBuildReportsEveryFailure(t *testing.T) {
+	dir := t.TempDir()
+	app, err := chassis.Build(
+		chassis.WithConfigFile(filepath.Join(dir, "missing.yaml")),
+		chassis.WithModules(
+			auth.New(auth.WithDBPath(filepath.Join(dir, "auth.db"))),
+			permissions.New(),
+			cache.New(),
+		),
+	)
+	if app != nil {
+		t.Error("expected no app when modules fail")
+	}
+	if !errors.Is(err, chassis.ErrMissingDependency) || !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the config and dependency failures joined, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "auth requires users") || !strings.Contains(err.Error(), "permissions requires orgs") {
+		t.Errorf("expected every failed module reported, got %v", err)
+	}
+
+	app, err = chassis.Build(chassis.WithModules(cache.New()))
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	if !app.HasModule("cache") {
+		t.Error("expected the cache module registered")
+	}
+}
+
+type panickingModule struct{}
+
+func (panickingModule) Name() string                                     { return "flaky_init" }
+func (panickingModule) Init(ctx context.Context, app *chassis.App) error { panic("bad config") }
+func (panickingModule) Shutdown(ctx context.Context) error               { return nil }
+
+func TestPanicsAreContained(t *testing.T) {
+	app := chassis.New(chassis.WithModules(events.New(), panickingModule{}, cache.New()))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	if app.HasModule("flaky_init") || !app.HasModule("cache") {
+		t.Fatal("expected the panicking module skipped and the rest registered")
+	}
+
+	var (
+		mu      sync.Mutex
+		reports []*chassis.ModulePanic
+	)
+	app.Events().Subscribe(chassis.EventModulePanic, func(ctx context.Context, eventType string, payload any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, payload.(*chassis.ModulePanic))
+		return nil
+	})
+	app.Events().Subscribe("order.placed", func(ctx context.Context, eventType string, payload any) error {
+		panic("nil order")
+	})
+	app.PublishEvent(context.Background(), "order.placed", nil)
+
+	handler := app.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		panic("boom")
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), `"code":"internal"`) {
+		t.Errorf("expected a 500 envelope, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	panics := app.Panics()
+	if panics["flaky_init"] != 1 || panics["events"] != 1 || panics["http"] != 1 {
+		t.Errorf("expected a panic counted per module, got %v", panics)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	boundaries := map[string]string{}
+	for _, report := range reports {
+		boundaries[report.Module] = report.Boundary
+		if report.Stack == "" {
+			t.Errorf("expected a stack in %+v", report)
+		}
+	}
+	if boundaries["events"] != chassis.PanicInEventHandler || boundaries["http"] != chassis.PanicInHTTPHandler {
+		t.Errorf("expected event and HTTP panic events, got %v", boundaries)
+	}
+}
+
+func TestTxSharedAcrossModules(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("users:\n  database: main\norgs:\n  database: main\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	authMod := auth.New(auth.WithDBPath(filepath.Join(dir, "sessions.db")))
+	app := chassis.New(
+		chassis.WithConfigFile(configPath),
+		chassis.WithDatabase("main", chassis.DatabaseConfig{DSN: filepath.Join(dir, "app.db")}),
+		chassis.WithModules(users.New(), authMod, orgs.New()),
+	)
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	org, err := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("failed to create org: %v", err)
+	}
+	orgID := org.(*orgs.Org).ID()
+
+	var userID string
+	join := func(email string, fail error) error {
+		return app.Tx(ctx, func(ctx context.Context) error {
+			user, err := app.Users().Create(ctx, email, "password123")
+			if err != nil {
+				return err
+			}
+			userID = user.(*users.User).ID
+			if _, err := app.Orgs().AddMember(ctx, orgID, userID, "member"); err != nil {
+				return err
+			}
+			// Reads inside the transaction see its writes, and auth's
+			// separate database enlists too
+			if _, err := authMod.LoginToken(ctx, email, "password123"); err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	errAbort := errors.New("audit failed")
+	if err := join("rolled-back@example.com", errAbort); !errors.Is(err, errAbort) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if _, err := app.Users().GetByEmail(ctx, "rolled-back@example.com"); !errors.Is(err, users.ErrNotFound) {
+		t.Errorf("expected the user rolled back, got %v", err)
+	}
+	if role := app.Orgs().GetUserRole(ctx, orgID, userID); role != "" {
+		t.Errorf("expected the membership rolled back, got role %q", role)
+	}
+
+	if err := join("joined@example.com", nil); err != nil {
+		t.Fatalf("Tx failed: %v", err)
+	}
+	if _, err := app.Users().GetByEmail(ctx, "joined@example.com"); err != nil {
+		t.Errorf("expected the user committed, got %v", err)
+	}
+	if role := app.Orgs().GetUserRole(ctx, orgID, userID); role != "member" {
+		t.Errorf("expected the membership committed, got role %q", role)
+	}
+
+	func() {
+		defer func() { _ = recover() }()
+		_ = app.Tx(ctx, func(ctx context.Context) error {
+			if _, err := app.Users().Create(ctx, "panicked@example.com", "password123"); err != nil {
+				return err
+			}
+			panic("lost connection")
+		})
+	}()
+	if _, err := app.Users().GetByEmail(ctx, "panicked@example.com"); !errors.Is(err, users.ErrNotFound) {
+		t.Errorf("expected a panic to roll back, got %v", err)
+	}
+}
+
+func TestTxLifecycleEventsFollowCommit(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("users:\n  database: main\norgs:\n  database: main\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	eventsMod := events.New()
+	app := chassis.New(
+		chassis.WithConfigFile(configPath),
+		chassis.WithDatabase("main", chassis.DatabaseConfig{DSN: filepath.Join(dir, "app.db")}),
+		chassis.WithModules(eventsMod, users.New(), orgs.New()),
+	)
+
+	created := make(chan string, 10)
+	eventsMod.Subscribe(users.EventUserCreated, func(ctx context.Context, eventType string, payload any) {
+		created <- payload.(*users.UserEvent).Email
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if _, err := app.Users().Create(ctx, "direct@example.com", "password123"); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	select {
+	case email := <-created:
+		if email != "direct@example.com" {
+			t.Errorf("unexpected user.created for %s", email)
+		}
+	default:
+		t.Fatal("expected user.created published when Create returns")
+	}
+
+	errAbort := errors.New("audit failed")
+	err := app.Tx(ctx, func(ctx context.Context) error {
+		if _, err := app.Users().Create(ctx, "rolled-back@example.com", "password123"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	err = app.Tx(ctx, func(ctx context.Context) error {
+		if _, err := app.Users().Create(ctx, "committed@example.com", "password123"); err != nil {
+			return err
+		}
+		if len(created) != 0 {
+			t.Error("expected user.created held until the commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Tx failed: %v", err)
+	}
+	select {
+	case email := <-created:
+		if email != "committed@example.com" {
+			t.Errorf("expected only the committed user's event, got one for %s", email)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the relay did not publish the committed event")
+	}
+}
+
+func TestNamedDatabases(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "app.db")
+	configPath := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf(`
+databases:
+  main: sqlite:%s
+  reporting:
+    dsn: mysql://reporter@db/reports
+users:
+  database: main
+orgs:
+  database: main
+`, mainPath)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	app, err := chassis.Build(
+		chassis.WithConfigFile(configPath),
+		chassis.WithModules(
+			users.New(users.WithDBPath(filepath.Join(dir, "users.db"))),
+			orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db"))),
+		),
+	)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if names := app.Databases(); len(names) != 1 || names[0] != "main" {
+		t.Errorf("expected users and orgs to share main, got %v", names)
+	}
+	if _, err := app.Users().Create(ctx, "shared@example.com", "password123"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Shared"}); err != nil {
+		t.Fatalf("failed to create org: %v", err)
+	}
+	for _, path := range []string{"users.db", "orgs.db"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s unused, got %v", path, err)
+		}
+	}
+	if dump, err := app.DumpConfig(); err != nil || strings.Contains(string(dump), mainPath) {
+		t.Errorf("expected database DSNs masked in config dumps, got %s, %v", dump, err)
+	}
+
+	if _, err := app.Database("missing"); !errors.Is(err, chassis.ErrUnknownDatabase) {
+		t.Errorf("expected ErrUnknownDatabase, got %v", err)
+	}
+	if _, err := app.Database("reporting"); !errors.Is(err, chassis.ErrNoDatabaseDriver) {
+		t.Errorf("expected ErrNoDatabaseDriver without a mysql driver, got %v", err)
+	}
+
+	main, err := app.Database("main")
+	if err != nil {
+		t.Fatalf("Database failed: %v", err)
+	}
+	var count int
+	if err := main.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM orgs)`).Scan(&count); err != nil || count != 2 {
+		t.Errorf("expected both modules' rows in main, got %d, %v", count, err)
+	}
+
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := main.PingContext(ctx); err == nil {
+		t.Error("expected the app to close main on shutdown")
+	}
+
+	// Scheme openers belong to the app that sets them
+	var opened string
+	mysql := chassis.New(
+		chassis.WithDatabase("reporting", chassis.DatabaseConfig{DSN: "mysql://reporter@db/reports"}),
+		chassis.WithDatabaseScheme("mysql", func(dsn string) (*sql.DB, error) {
+			opened = dsn
+			return sql.Open("sqlite", ":memory:")
+		}),
+	)
+	defer func() { _ = mysql.Shutdown(ctx) }()
+	if _, err := mysql.Database("reporting"); err != nil || opened != "mysql://reporter@db/reports" {
+		t.Errorf("expected the mysql opener to open reporting, got %q, %v", opened, err)
+	}
+	other := chassis.New(chassis.WithDatabase("reporting", chassis.DatabaseConfig{DSN: "mysql://reporter@db/reports"}))
+	if _, err := other.Database("reporting"); !errors.Is(err, chassis.ErrNoDatabaseDriver) {
+		t.Errorf("expected another app to lack the mysql opener, got %v", err)
+	}
+}
+
+// TestOptionalDependencies tests that modules degrade without their optional dependencies.
+func TestOptionalDependencies(t *testing.T) {
+	dir := t.TempDir()
+	eventsMod := events.New(events.WithDeadLetterQueue("dead_events"))
+	app, err := chassis.Build(chassis.WithModules(
+		users.New(users.WithDBPath(filepath.Join(dir, "users.db"))),
+		orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db"))),
+		eventsMod,
+	))
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if _, ok := app.TryOrgs(); !ok {
+		t.Error("expected TryOrgs to find the orgs module")
+	}
+	if queueMod, ok := app.TryQueue(); ok || queueMod != nil {
+		t.Error("expected TryQueue to report the queue module missing")
+	}
+	var nilApp *chassis.App
+	if _, ok := nilApp.TryEmail(); ok {
+		t.Error("expected TryEmail on a nil app to report false")
+	}
+
+	// Without email, invitations are created but not sent
+	org, err := app.Orgs().Create(ctx, orgs.CreateInput{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("failed to create org: %v", err)
+	}
+	orgID := org.(*orgs.Org).ID()
+	if _, err := app.Orgs().Invite(ctx, orgID, "invitee@example.com", "member"); err != nil {
+		t.Errorf("expected the invitation without the email module, got %v", err)
+	}
+
+	// Without queue and storage, exports are refused
+	if _, err := app.Orgs().(*orgs.Module).StartExport(ctx, orgID, ""); !errors.Is(err, orgs.ErrExportUnavailable) {
+		t.Errorf("expected ErrExportUnavailable, got %v", err)
+	}
+
+	// Without queue, the dead-letter sink fails instead of panicking
+	app.Events().Subscribe("doomed", func(ctx context.Context, eventType string, payload any) error {
+		return errors.New("always fails")
+	})
+	app.Events().Publish(ctx, "doomed", nil)
+	if stats := eventsMod.Stats(); stats.DeadLettered != 0 {
+		t.Errorf("expected nothing dead-lettered without the queue, got %d", stats.DeadLettered)
+	}
+}
+
+type greeterModule struct{ greeting string }
+
+func (mod *greeterModule) Name() string { return "greeter" }
+func (mod *greeterModule) Init(ctx context.Context, app *chassis.App) error {
+	mod.greeting = app.ConfigData().GetString("greeter.greeting")
+	return nil
+}
+func (mod *greeterModule) Shutdown(ctx context.Context) error { return nil }
+
+// TestConfiguredModules tests registering the modules listed in config with their factories.
+func TestConfiguredModules(t *testing.T) {
+	greeter := &greeterModule{}
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(`
+modules: [cache, events, greeter]
+greeter:
+  greeting: hello
+`), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cacheMod := cache.New()
+	app, err := chassis.Build(
+		chassis.WithConfigFile(configPath),
+		chassis.WithModules(cacheMod),
+		chassis.WithModuleFactories(builtin.Factories()),
+		chassis.WithModuleFactory("greeter", func() chassis.Module { return greeter }),
+		chassis.WithConfiguredModules(),
+	)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	var names []string
+	for _, mod := range app.Modules() {
+		names = append(names, mod.Name())
+	}
+	if strings.Join(names, ",") != "cache,events,greeter" {
+		t.Errorf("expected the configured modules in order, got %v", names)
+	}
+	if app.Cache() != cacheMod {
+		t.Error("expected the cache registered in code to be kept")
+	}
+	if greeter.greeting != "hello" {
+		t.Errorf("expected the factory's module to read its config, got %q", greeter.greeting)
+	}
+	if factories := app.ModuleFactories(); !slices.Contains(factories, "cache") || !slices.Contains(factories, "greeter") {
+		t.Errorf("expected the built-in and custom factories, got %v", factories)
+	}
+	if factories := chassis.New().ModuleFactories(); len(factories) != 0 {
+		t.Errorf("expected factories to be per app, got %v", factories)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`modules: [cache, nope, permissions]`), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	_, err = chassis.Build(
+		chassis.WithConfigFile(configPath),
+		chassis.WithModuleFactories(builtin.Factories()),
+		chassis.WithConfiguredModules(),
+	)
+	if !errors.Is(err, chassis.ErrUnknownModule) || !errors.Is(err, chassis.ErrMissingDependency) {
+		t.Errorf("expected the unknown module and missing dependency reported, got %v", err)
+	}
+}
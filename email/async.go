@@ -0,0 +1,231 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/queue"
+)
+
+// JobType is the queue job type used by SendAsync.
+const JobType = "email.send"
+
+// Event types published by the email module.
+const (
+	EventEmailSent    = "email.sent"
+	EventEmailFailed  = "email.failed"
+	EventEmailBounced = "email.bounced"
+)
+
+// Providers wrap these to classify their failures, e.g.
+// fmt.Errorf("%w: connection reset", email.ErrTransient). SMTP reply codes are
+// classified without wrapping.
+var (
+	ErrTransient  = chassis.NewError(chassis.CodeUnavailable, "temporary email delivery failure")
+	ErrHardBounce = chassis.NewError(chassis.CodeFailedPrecondition, "email address rejected by the receiving server")
+)
+
+// SendEvent is the payload of EventEmailSent, EventEmailFailed and
+// EventEmailBounced.
+type SendEvent struct {
+	To        []string
+	Subject   string
+	MessageID string // set by a TrackedProvider
+	Attempts  int
+	Error     string
+}
+
+// RetryPolicy controls how transient failures of SendAsync are retried.
+// Backoff doubles after each attempt, starting at InitialBackoff and capped at MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy tries a send three times over roughly six seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// backoff returns the delay after the given failed attempt (1-based).
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxBackoff > 0 && delay >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// delay returns how long to wait after a failed attempt: the backoff, or
+// the provider's Retry-After when longer, up to MaxBackoff.
+func (policy RetryPolicy) delay(attempt int, err error) time.Duration {
+	delay := policy.backoff(attempt)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+		if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// IsTransient reports whether a send failure is worth retrying: errors
+// wrapping ErrTransient or ErrRateLimited, SMTP 4xx replies and network
+// errors.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrTransient) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsHardBounce reports whether a send failure means the recipient address
+// does not accept mail: errors wrapping ErrHardBounce and SMTP 550, 551 and
+// 553 replies.
+func IsHardBounce(err error) bool {
+	if errors.Is(err, ErrHardBounce) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		switch smtpErr.Code {
+		case 550, 551, 553:
+			return true
+		}
+	}
+	return false
+}
+
+// SendAsync validates a message like SendMessage and sends it in the
+// background, retrying transient failures. With the queue module registered
+// the send is a JobType job handled by the queue worker; otherwise it runs
+// in a goroutine that Shutdown waits for. Delivery outcomes are reported by
+// EventEmailSent and EventEmailFailed.
+func (mod *Module) SendAsync(ctx context.Context, message any) error {
+	msg, err := toMessage(message)
+	if err != nil {
+		return err
+	}
+	if msg, err = mod.withoutSuppressed(ctx, msg); err != nil {
+		return err
+	}
+
+	if mod.queue != nil {
+		if _, err := mod.queue.Enqueue(ctx, JobType, msg); err != nil {
+			return fmt.Errorf("failed to enqueue email: %w", err)
+		}
+		return nil
+	}
+
+	// The request context may end before the send does
+	background := context.WithoutCancel(ctx)
+	mod.pending.Add(1)
+	go func() {
+		defer mod.pending.Done()
+		_ = mod.sendWithRetry(background, msg)
+	}()
+	return nil
+}
+
+// handleJob is the queue handler for JobType jobs.
+func (mod *Module) handleJob(ctx context.Context, job *queue.Job) error {
+	var msg Message
+	if err := json.Unmarshal(job.Payload, &msg); err != nil {
+		return fmt.Errorf("invalid email job payload: %w", err)
+	}
+	return mod.sendWithRetry(ctx, &msg)
+}
+
+// sendWithRetry sends msg, retrying transient failures with backoff, and
+// publishes the outcome of the last attempt.
+func (mod *Module) sendWithRetry(ctx context.Context, msg *Message) error {
+	// Recipients may have been suppressed since the message was queued
+	filtered, err := mod.withoutSuppressed(ctx, msg)
+	if err != nil {
+		mod.settle(ctx, msg, 0, "", err)
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		messageID, err := mod.attempt(ctx, filtered, mod.transmit)
+		if err == nil || attempt >= mod.retry.MaxAttempts || !IsTransient(err) {
+			mod.settle(ctx, filtered, attempt, messageID, err)
+			return err
+		}
+
+		timer := time.NewTimer(mod.retry.delay(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			mod.settle(ctx, filtered, attempt, "", err)
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// deliver sends msg once, skipping suppressed recipients, and publishes
+// the outcome.
+func (mod *Module) deliver(ctx context.Context, msg *Message, send sendFunc) error {
+	filtered, err := mod.withoutSuppressed(ctx, msg)
+	if err != nil {
+		mod.settle(ctx, msg, 0, "", err)
+		return err
+	}
+	messageID, err := mod.attempt(ctx, filtered, send)
+	mod.settle(ctx, filtered, 1, messageID, err)
+	return err
+}
+
+// sendFunc sends msg with provider.
+type sendFunc func(ctx context.Context, provider Provider, msg *Message) error
+
+// attempt sends msg once with the current provider: through SendTracked
+// when it is a TrackedProvider, and with send otherwise. SetProvider waits
+// for the attempt to finish before closing the provider.
+func (mod *Module) attempt(ctx context.Context, msg *Message, send sendFunc) (string, error) {
+	provider, release := mod.provider.Acquire()
+	defer release()
+	if tracked, ok := provider.(TrackedProvider); ok {
+		return tracked.SendTracked(ctx, msg)
+	}
+	return "", send(ctx, provider, msg)
+}
+
+// settle publishes the outcome of sending msg. A hard bounce to a single
+// recipient also suppresses the address; with several recipients the
+// rejected one is unknown.
+func (mod *Module) settle(ctx context.Context, msg *Message, attempts int, messageID string, err error) {
+	event := &SendEvent{To: msg.To, Subject: msg.Subject, MessageID: messageID, Attempts: attempts}
+	if err == nil {
+		mod.app.PublishEvent(ctx, EventEmailSent, event)
+		return
+	}
+
+	event.Error = err.Error()
+	if recipients := msg.Recipients(); IsHardBounce(err) && len(recipients) == 1 {
+		if suppressErr := mod.Suppress(ctx, recipients[0], err.Error()); suppressErr != nil {
+			mod.app.Logger().Error("failed to suppress bounced address", "address", recipients[0], "error", suppressErr)
+		}
+		mod.app.PublishEvent(ctx, EventEmailBounced, event)
+	}
+	mod.app.PublishEvent(ctx, EventEmailFailed, event)
+}
@@ -0,0 +1,311 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/internal/sqlite"
+)
+
+var ErrInboxMessageNotFound = chassis.NewError(chassis.CodeNotFound, "inbox message not found")
+
+// InboxMessage is an email captured by a DevInboxProvider.
+type InboxMessage struct {
+	ID     string
+	From   string
+	SentAt time.Time
+	Message
+}
+
+// SentTo reports whether address is one of the message's To, Cc or Bcc
+// recipients. Addresses are compared case-insensitively.
+func (msg *InboxMessage) SentTo(address string) bool {
+	address = normalizeAddress(address)
+	for _, recipient := range msg.Recipients() {
+		if normalizeAddress(recipient) == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the subject, text or HTML body contains text.
+func (msg *InboxMessage) Contains(text string) bool {
+	return strings.Contains(msg.Subject, text) ||
+		strings.Contains(msg.Text, text) ||
+		strings.Contains(msg.HTML, text)
+}
+
+// InboxStore persists the messages captured by a DevInboxProvider.
+type InboxStore interface {
+	Add(ctx context.Context, msg *InboxMessage) error
+	Get(ctx context.Context, id string) (*InboxMessage, error)
+	// List returns all messages, most recent first.
+	List(ctx context.Context) ([]*InboxMessage, error)
+	Clear(ctx context.Context) error
+	Close() error
+}
+
+// DevInboxConfig configures a DevInboxProvider.
+type DevInboxConfig struct {
+	Store  InboxStore                     // defaults to an in-memory store
+	From   string                         // recorded as the sender
+	Logger func(to, subject, body string) // optional, called like LogProvider's
+}
+
+// DevInboxProvider captures emails instead of sending them, for local
+// development and tests. Browse them with Handler, or query them with
+// Messages and Find.
+type DevInboxProvider struct {
+	config DevInboxConfig
+	log    *LogProvider
+	now    func() time.Time
+}
+
+// NewDevInboxProvider creates a provider that captures emails in an inbox.
+func NewDevInboxProvider(config DevInboxConfig) *DevInboxProvider {
+	if config.Store == nil {
+		config.Store = NewMemoryInboxStore()
+	}
+	return &DevInboxProvider{config: config, log: NewLogProvider(config.Logger), now: time.Now}
+}
+
+func (inbox *DevInboxProvider) Send(ctx context.Context, to, subject, body string) error {
+	return inbox.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, Text: body})
+}
+
+func (inbox *DevInboxProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
+	return inbox.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, HTML: htmlBody})
+}
+
+func (inbox *DevInboxProvider) SendMessage(ctx context.Context, msg *Message) error {
+	_, err := inbox.SendTracked(ctx, msg)
+	return err
+}
+
+// SendTracked captures msg and returns its inbox ID.
+func (inbox *DevInboxProvider) SendTracked(ctx context.Context, msg *Message) (string, error) {
+	captured := &InboxMessage{
+		ID:      uuid.New().String(),
+		From:    inbox.config.From,
+		SentAt:  inbox.now(),
+		Message: *msg,
+	}
+	if err := inbox.config.Store.Add(ctx, captured); err != nil {
+		return "", fmt.Errorf("failed to store inbox message: %w", err)
+	}
+	if err := inbox.log.SendMessage(ctx, msg); err != nil {
+		return "", err
+	}
+	return captured.ID, nil
+}
+
+// Messages returns the captured messages, most recent first.
+func (inbox *DevInboxProvider) Messages(ctx context.Context) ([]*InboxMessage, error) {
+	return inbox.config.Store.List(ctx)
+}
+
+// Message returns a captured message by ID.
+func (inbox *DevInboxProvider) Message(ctx context.Context, id string) (*InboxMessage, error) {
+	return inbox.config.Store.Get(ctx, id)
+}
+
+// Find returns the captured messages sent to address that contain text,
+// most recent first. An empty address or text matches every message.
+func (inbox *DevInboxProvider) Find(ctx context.Context, address, text string) ([]*InboxMessage, error) {
+	messages, err := inbox.Messages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []*InboxMessage
+	for _, msg := range messages {
+		if (address == "" || msg.SentTo(address)) && msg.Contains(text) {
+			found = append(found, msg)
+		}
+	}
+	return found, nil
+}
+
+// Clear deletes all captured messages.
+func (inbox *DevInboxProvider) Clear(ctx context.Context) error {
+	return inbox.config.Store.Clear(ctx)
+}
+
+// Close closes the inbox store.
+func (inbox *DevInboxProvider) Close() error {
+	return inbox.config.Store.Close()
+}
+
+// MemoryInboxStore keeps captured messages in memory.
+type MemoryInboxStore struct {
+	mu       sync.RWMutex
+	messages []*InboxMessage
+}
+
+// NewMemoryInboxStore creates an empty in-memory inbox store.
+func NewMemoryInboxStore() *MemoryInboxStore {
+	return &MemoryInboxStore{}
+}
+
+func (store *MemoryInboxStore) Add(ctx context.Context, msg *InboxMessage) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	copied := *msg
+	store.messages = append(store.messages, &copied)
+	return nil
+}
+
+func (store *MemoryInboxStore) Get(ctx context.Context, id string) (*InboxMessage, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, msg := range store.messages {
+		if msg.ID == id {
+			copied := *msg
+			return &copied, nil
+		}
+	}
+	return nil, ErrInboxMessageNotFound
+}
+
+func (store *MemoryInboxStore) List(ctx context.Context) ([]*InboxMessage, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	messages := make([]*InboxMessage, 0, len(store.messages))
+	for i := len(store.messages) - 1; i >= 0; i-- {
+		copied := *store.messages[i]
+		messages = append(messages, &copied)
+	}
+	return messages, nil
+}
+
+func (store *MemoryInboxStore) Clear(ctx context.Context) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.messages = nil
+	return nil
+}
+
+func (store *MemoryInboxStore) Close() error {
+	return nil
+}
+
+// SQLiteInboxStore implements InboxStore using SQLite, so captured
+// messages survive restarts.
+type SQLiteInboxStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteInboxStore creates a new SQLite-backed inbox store.
+func NewSQLiteInboxStore(dbPath string) (*SQLiteInboxStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLiteInboxStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteInboxStoreFromDB creates an inbox store on a database the caller
+// owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteInboxStoreFromDB(db *sql.DB) (*SQLiteInboxStore, error) {
+	if err := initInboxSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteInboxStore{db: db}, nil
+}
+
+func initInboxSchema(db *sql.DB) error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS email_inbox (
+			id TEXT PRIMARY KEY,
+			sender TEXT NOT NULL,
+			message TEXT NOT NULL,
+			sent_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_inbox_sent_at ON email_inbox(sent_at);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func (store *SQLiteInboxStore) Add(ctx context.Context, msg *InboxMessage) error {
+	data, err := json.Marshal(msg.Message)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO email_inbox (id, sender, message, sent_at) VALUES (?, ?, ?, ?)`
+	_, err = store.db.ExecContext(ctx, query, msg.ID, msg.From, string(data), msg.SentAt)
+	return err
+}
+
+func (store *SQLiteInboxStore) Get(ctx context.Context, id string) (*InboxMessage, error) {
+	query := `SELECT id, sender, message, sent_at FROM email_inbox WHERE id = ?`
+	msg, err := scanInboxMessage(store.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInboxMessageNotFound
+	}
+	return msg, err
+}
+
+func (store *SQLiteInboxStore) List(ctx context.Context) ([]*InboxMessage, error) {
+	query := `SELECT id, sender, message, sent_at FROM email_inbox ORDER BY sent_at DESC, rowid DESC`
+	rows, err := store.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	messages := make([]*InboxMessage, 0)
+	for rows.Next() {
+		msg, err := scanInboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (store *SQLiteInboxStore) Clear(ctx context.Context) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM email_inbox`)
+	return err
+}
+
+func (store *SQLiteInboxStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInboxMessage(row rowScanner) (*InboxMessage, error) {
+	msg := &InboxMessage{}
+	var data string
+	if err := row.Scan(&msg.ID, &msg.From, &data, &msg.SentAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &msg.Message); err != nil {
+		return nil, fmt.Errorf("invalid inbox message %s: %w", msg.ID, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,182 @@
+package email
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/talosaether/chassis/api"
+)
+
+// Handler returns an HTTP handler for browsing the inbox. Mount it under a
+// prefix with a trailing slash:
+//
+//	http.Handle("/dev/mail/", http.StripPrefix("/dev/mail", inbox.Handler()))
+//
+// Routes (relative to the prefix):
+//
+//	GET    /                                  message list
+//	GET    /messages/{id}                     message page
+//	GET    /messages/{id}/html                HTML body, sandboxed
+//	GET    /messages/{id}/attachments/{index} attachment download
+//	POST   /clear                             delete all messages
+//	GET    /api/messages                      messages as JSON
+//	GET    /api/messages/{id}                 one message as JSON
+//	DELETE /api/messages                      delete all messages
+//
+// The inbox is for development only; don't expose it in production.
+func (inbox *DevInboxProvider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", inbox.serveIndex)
+	mux.HandleFunc("GET /messages/{id}", inbox.serveMessage)
+	mux.HandleFunc("GET /messages/{id}/html", inbox.serveHTML)
+	mux.HandleFunc("GET /messages/{id}/attachments/{index}", inbox.serveAttachment)
+	mux.HandleFunc("POST /clear", func(writer http.ResponseWriter, request *http.Request) {
+		if err := inbox.Clear(request.Context()); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(writer, request, "./", http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /api/messages", func(writer http.ResponseWriter, request *http.Request) {
+		messages, err := inbox.Messages(request.Context())
+		if err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		api.WriteJSON(writer, http.StatusOK, messages)
+	})
+	mux.HandleFunc("GET /api/messages/{id}", func(writer http.ResponseWriter, request *http.Request) {
+		msg, err := inbox.Message(request.Context(), request.PathValue("id"))
+		if err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		api.WriteJSON(writer, http.StatusOK, msg)
+	})
+	mux.HandleFunc("DELETE /api/messages", func(writer http.ResponseWriter, request *http.Request) {
+		if err := inbox.Clear(request.Context()); err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func (inbox *DevInboxProvider) serveIndex(writer http.ResponseWriter, request *http.Request) {
+	messages, err := inbox.Messages(request.Context())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	inbox.render(writer, indexTemplate, messages)
+}
+
+func (inbox *DevInboxProvider) serveMessage(writer http.ResponseWriter, request *http.Request) {
+	msg, ok := inbox.lookup(writer, request)
+	if !ok {
+		return
+	}
+	inbox.render(writer, messageTemplate, msg)
+}
+
+func (inbox *DevInboxProvider) serveHTML(writer http.ResponseWriter, request *http.Request) {
+	msg, ok := inbox.lookup(writer, request)
+	if !ok {
+		return
+	}
+	// Captured HTML is untrusted: no scripts, no same-origin access
+	writer.Header().Set("Content-Security-Policy", "sandbox")
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = writer.Write([]byte(msg.HTML))
+}
+
+func (inbox *DevInboxProvider) serveAttachment(writer http.ResponseWriter, request *http.Request) {
+	msg, ok := inbox.lookup(writer, request)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(request.PathValue("index"))
+	if err != nil || index < 0 || index >= len(msg.Attachments) {
+		http.NotFound(writer, request)
+		return
+	}
+	attachment := msg.Attachments[index]
+	writer.Header().Set("Content-Type", attachment.contentType())
+	writer.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(attachment.Filename))
+	_, _ = writer.Write(attachment.Data)
+}
+
+// lookup returns the message named by the {id} path value, writing a 404
+// if there is none.
+func (inbox *DevInboxProvider) lookup(writer http.ResponseWriter, request *http.Request) (*InboxMessage, bool) {
+	msg, err := inbox.Message(request.Context(), request.PathValue("id"))
+	if errors.Is(err, ErrInboxMessageNotFound) {
+		http.NotFound(writer, request)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return msg, true
+}
+
+func (inbox *DevInboxProvider) render(writer http.ResponseWriter, tmpl *template.Template, data any) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(writer, data); err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+const inboxStyle = `<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4rem .6rem; border-bottom: 1px solid #ddd; }
+pre { background: #f6f6f6; padding: 1rem; white-space: pre-wrap; }
+iframe { width: 100%; height: 32rem; border: 1px solid #ddd; }
+.muted { color: #777; }
+</style>`
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Dev inbox</title>` + inboxStyle + `</head>
+<body>
+<h1>Dev inbox</h1>
+<form method="post" action="clear"><button>Clear all</button></form>
+{{if .}}
+<table>
+<tr><th>Sent</th><th>To</th><th>Subject</th></tr>
+{{range .}}<tr>
+<td class="muted">{{.SentAt.Format "2006-01-02 15:04:05"}}</td>
+<td>{{range $i, $to := .To}}{{if $i}}, {{end}}{{$to}}{{end}}</td>
+<td><a href="messages/{{.ID}}">{{.Subject}}</a></td>
+</tr>{{end}}
+</table>
+{{else}}
+<p class="muted">No emails yet.</p>
+{{end}}
+</body></html>`))
+
+var messageTemplate = template.Must(template.New("message").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Subject}}</title>` + inboxStyle + `</head>
+<body>
+<p><a href="../">&larr; Inbox</a></p>
+<h1>{{.Subject}}</h1>
+<table>
+{{if .From}}<tr><th>From</th><td>{{.From}}</td></tr>{{end}}
+<tr><th>To</th><td>{{range $i, $to := .To}}{{if $i}}, {{end}}{{$to}}{{end}}</td></tr>
+{{if .Cc}}<tr><th>Cc</th><td>{{range $i, $cc := .Cc}}{{if $i}}, {{end}}{{$cc}}{{end}}</td></tr>{{end}}
+{{if .Bcc}}<tr><th>Bcc</th><td>{{range $i, $bcc := .Bcc}}{{if $i}}, {{end}}{{$bcc}}{{end}}</td></tr>{{end}}
+<tr><th>Sent</th><td>{{.SentAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+</table>
+{{if .HTML}}<h2>HTML</h2>
+<iframe sandbox src="{{.ID}}/html"></iframe>{{end}}
+{{if .Text}}<h2>Text</h2>
+<pre>{{.Text}}</pre>{{end}}
+{{if .Attachments}}<h2>Attachments</h2>
+<ul>{{$id := .ID}}{{range $i, $attachment := .Attachments}}
+<li><a href="{{$id}}/attachments/{{$i}}">{{$attachment.Filename}}</a> <span class="muted">({{len $attachment.Data}} bytes)</span></li>{{end}}
+</ul>{{end}}
+</body></html>`))
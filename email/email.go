@@ -21,6 +21,62 @@
 //	// HTML
 //	err := app.Email().SendHTML(ctx, "user@example.com", "Welcome!", "<h1>Hello!</h1>")
 //
+//	// Full message with Cc, Bcc and attachments
+//	err := app.Email().SendMessage(ctx, email.Message{
+//	    To:          []string{"user@example.com"},
+//	    Cc:          []string{"billing@example.com"},
+//	    Subject:     "Your invoice",
+//	    HTML:        "<p>Invoice attached.</p>",
+//	    Text:        "Invoice attached.",
+//	    Attachments: []email.Attachment{{Filename: "invoice.pdf", Data: pdf}},
+//	})
+//
+// SMTPProvider encodes messages as multipart MIME. Custom providers receive
+// messages unchanged by implementing MessageProvider.
+//
+// # Background sending
+//
+// SendAsync returns as soon as the message is accepted. With the queue
+// module registered it is enqueued as a JobType job; otherwise it is sent
+// from a goroutine. Transient failures are retried per the RetryPolicy:
+//
+//	err := app.Email().SendAsync(ctx, email.Message{
+//	    To:      []string{"user@example.com"},
+//	    Subject: "Welcome!",
+//	    Text:    "Hello and welcome...",
+//	})
+//
+// Every send publishes EventEmailSent or EventEmailFailed. A hard bounce
+// also publishes EventEmailBounced and adds the address to the suppression
+// list; sends to suppressed addresses fail with ErrSuppressed.
+//
+// # Templates
+//
+// Register named templates from an embedded FS (see LoadTemplates for the
+// file layout) or the storage module, then send them by name:
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	files, _ := fs.Sub(templates, "templates")
+//	email.New(email.WithTemplates(files))
+//
+//	err := app.Email().SendTemplate(ctx, user.Email, "welcome", map[string]string{"Name": name})
+//
+// Templates see the data as .Data and branding variables as .Brand. Bodies
+// are wrapped in the "default" layout when one is registered; layouts place
+// the body with {{template "content" .}}. Branding comes from the
+// email.branding config section, overridden per org by SetBranding or
+// WithBrandingFunc for emails sent with a context from WithOrgID:
+//
+//	ctx = email.WithOrgID(ctx, orgID)
+//	err := app.Email().SendTemplate(ctx, to, "invite", invite)
+//
+// With a Localizer (the i18n module, when registered), templates are
+// rendered in the recipient's locale: a "<name>.<locale>" template is used
+// when registered, .Locale holds the locale, and {{t "key"}} translates.
+// email.WithLocale overrides the recipient's locale.
+//
 // # Configuration
 //
 // Configure via config.yaml:
@@ -30,7 +86,30 @@
 //	  smtp_port: 587
 //	  smtp_username: ${SMTP_USER}
 //	  smtp_password: ${SMTP_PASS}
+//	  smtp_tls: starttls          # opportunistic (default), starttls, tls or none
+//	  smtp_dial_timeout: 10s
+//	  smtp_send_timeout: 30s      # per message
+//	  smtp_pool_size: 2           # idle connections kept for reuse; -1 disables
+//	  smtp_idle_timeout: 30s
 //	  from: noreply@example.com
+//	  templates_prefix: email-templates/   # load templates from the storage module
+//	  db_path: ./data/email.db             # persist the suppression list
+//	  max_attempts: 3                      # SendAsync attempts per message
+//	  branding:
+//	    product_name: Acme
+//	    logo_url: https://example.com/logo.png
+//
+// SendGrid, Mailgun and Amazon SES are selected with email.provider. Their
+// credentials are read from the provider's section, falling back to
+// SENDGRID_API_KEY, MAILGUN_API_KEY and MAILGUN_DOMAIN, or AWS_REGION,
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN:
+//
+//	email:
+//	  provider: mailgun   # smtp (default), sendgrid, mailgun or ses
+//	  from: noreply@mg.example.com
+//	  mailgun:
+//	    domain: mg.example.com
+//	    base_url: https://api.eu.mailgun.net
 //
 // Or programmatically:
 //
@@ -40,6 +119,7 @@
 //	    Username: "user",
 //	    Password: "pass",
 //	    From:     "noreply@example.com",
+//	    TLS:      email.TLSStartTLS,
 //	}))
 //
 // # Testing
@@ -49,14 +129,31 @@
 //	email.New(email.WithProvider(email.NewLogProvider(func(to, subject, body string) {
 //	    log.Printf("Email to %s: %s", to, subject)
 //	})))
+//
+// DevInboxProvider captures emails in memory (or SQLite) and serves a
+// browsable inbox; select it with email.provider: devinbox or:
+//
+//	inbox := email.NewDevInboxProvider(email.DevInboxConfig{})
+//	email.New(email.WithProvider(inbox))
+//	http.Handle("/dev/mail/", http.StripPrefix("/dev/mail", inbox.Handler()))
+//
+// The emailtest package asserts on captured emails in tests.
 package email
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/smtp"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/internal/swap"
+	"github.com/talosaether/chassis/queue"
 )
 
 // Provider defines the interface for email sending implementations.
@@ -64,20 +161,26 @@ type Provider interface {
 	Send(ctx context.Context, to, subject, body string) error
 }
 
-// SMTPConfig holds SMTP server configuration.
-type SMTPConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
-	From     string
-}
-
 // Module is the email module implementation.
 type Module struct {
-	provider   Provider
+	provider   swap.Value[Provider]
 	smtpConfig SMTPConfig
 	app        *chassis.App
+
+	suppressions SuppressionStore
+	dbPath       string
+	retry        RetryPolicy
+	queue        *queue.Module
+	pending      sync.WaitGroup
+
+	templatesMu  sync.RWMutex
+	templates    map[string]Template
+	layouts      map[string]Layout
+	templateFS   []fs.FS
+	branding     Branding
+	orgBranding  map[string]Branding
+	brandingFunc BrandingFunc
+	localizer    Localizer
 }
 
 // Option is a function that configures the email module.
@@ -86,7 +189,7 @@ type Option func(*Module)
 // WithProvider sets a custom email provider.
 func WithProvider(provider Provider) Option {
 	return func(mod *Module) {
-		mod.provider = provider
+		mod.provider.Store(provider)
 	}
 }
 
@@ -97,6 +200,28 @@ func WithSMTPConfig(config SMTPConfig) Option {
 	}
 }
 
+// WithSuppressionStore sets a custom suppression list store.
+func WithSuppressionStore(store SuppressionStore) Option {
+	return func(mod *Module) {
+		mod.suppressions = store
+	}
+}
+
+// WithDBPath keeps the suppression list in a SQLite database at path
+// instead of in memory. It has no effect with WithSuppressionStore.
+func WithDBPath(path string) Option {
+	return func(mod *Module) {
+		mod.dbPath = path
+	}
+}
+
+// WithRetryPolicy sets how SendAsync retries transient failures.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(mod *Module) {
+		mod.retry = policy
+	}
+}
+
 // New creates a new email module with the given options.
 func New(opts ...Option) *Module {
 	mod := &Module{
@@ -104,6 +229,12 @@ func New(opts ...Option) *Module {
 			Host: "localhost",
 			Port: 25,
 		},
+		templates:    make(map[string]Template),
+		layouts:      make(map[string]Layout),
+		branding:     make(Branding),
+		orgBranding:  make(map[string]Branding),
+		retry:        DefaultRetryPolicy,
+		suppressions: NewMemorySuppressionStore(),
 	}
 
 	for _, opt := range opts {
@@ -139,34 +270,178 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		if from := cfg.GetString("email.from"); from != "" {
 			mod.smtpConfig.From = from
 		}
+		if tlsMode := cfg.GetString("email.smtp_tls"); tlsMode != "" {
+			mod.smtpConfig.TLS = TLSMode(tlsMode)
+		}
+		for key, timeout := range map[string]*time.Duration{
+			"email.smtp_dial_timeout": &mod.smtpConfig.DialTimeout,
+			"email.smtp_send_timeout": &mod.smtpConfig.SendTimeout,
+			"email.smtp_idle_timeout": &mod.smtpConfig.IdleTimeout,
+		} {
+			if cfg.Get(key) != nil {
+				parsed, err := cfg.MustGetDuration(key)
+				if err != nil {
+					return err
+				}
+				*timeout = parsed
+			}
+		}
+		if poolSize := cfg.GetString("email.smtp_pool_size"); poolSize != "" {
+			if size, err := strconv.Atoi(poolSize); err == nil {
+				mod.smtpConfig.PoolSize = size
+			}
+		}
+		for key, value := range cfg.Section("email.branding") {
+			mod.branding[key] = fmt.Sprint(value)
+		}
+		if dbPath := cfg.GetString("email.db_path"); dbPath != "" {
+			mod.dbPath = dbPath
+		}
+		if maxAttempts := cfg.GetString("email.max_attempts"); maxAttempts != "" {
+			if attempts, err := strconv.Atoi(maxAttempts); err == nil {
+				mod.retry.MaxAttempts = attempts
+			}
+		}
+	}
+	if mod.retry.MaxAttempts < 1 {
+		mod.retry.MaxAttempts = 1
+	}
+
+	// Use the configured provider (SMTP by default) if none provided
+	if mod.provider.Load() == nil {
+		provider, err := mod.providerFromConfig(app.ConfigData(), app.ConfigData().GetString("email.provider"))
+		if err != nil {
+			return err
+		}
+		mod.provider.Store(provider)
 	}
 
-	// Use default SMTP provider if none provided
-	if mod.provider == nil {
-		mod.provider = NewSMTPProvider(mod.smtpConfig)
+	// Replace the in-memory suppression list when a database is configured
+	if _, inMemory := mod.suppressions.(*MemorySuppressionStore); inMemory {
+		db, err := app.ModuleDatabase("email")
+		if err != nil {
+			return err
+		}
+		var sqliteStore *SQLiteSuppressionStore
+		switch {
+		case db != nil:
+			sqliteStore, err = NewSQLiteSuppressionStoreFromDB(db)
+		case mod.dbPath != "":
+			sqliteStore, err = NewSQLiteSuppressionStore(mod.dbPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create suppression store: %w", err)
+		}
+		if sqliteStore != nil {
+			mod.suppressions = sqliteStore
+		}
 	}
 
-	app.Logger().Info("email module initialized", "smtp_host", mod.smtpConfig.Host, "smtp_port", mod.smtpConfig.Port)
+	if queueAPI, ok := app.TryQueue(); ok {
+		if queueMod, ok := queueAPI.(*queue.Module); ok {
+			mod.queue = queueMod
+			queueMod.Handle(JobType, mod.handleJob)
+		}
+	}
+
+	for _, fsys := range mod.templateFS {
+		if err := mod.LoadTemplates(fsys); err != nil {
+			return err
+		}
+	}
+	if prefix := app.ConfigData().GetString("email.templates_prefix"); prefix != "" {
+		if err := mod.LoadTemplatesFromStorage(ctx, prefix); err != nil {
+			return err
+		}
+	}
+
+	app.Logger().Info("email module initialized",
+		"smtp_host", mod.smtpConfig.Host,
+		"smtp_port", mod.smtpConfig.Port,
+		"queue", mod.queue != nil,
+	)
 	return nil
 }
 
-// Shutdown cleans up the email module.
+// Shutdown waits for in-flight SendAsync goroutines and closes the
+// suppression store and the provider, if it is an io.Closer.
 func (mod *Module) Shutdown(ctx context.Context) error {
+	mod.pending.Wait()
+	var errs []error
+	if closer, ok := mod.provider.Load().(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	if mod.suppressions != nil {
+		errs = append(errs, mod.suppressions.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// SetProvider replaces the provider at runtime, e.g. to move from SMTP to
+// SES without a restart. Sends already running on the old provider finish
+// first: SetProvider waits for them until ctx is done, then closes the old
+// provider if it is an io.Closer. Queued SendAsync messages use the new
+// provider.
+func (mod *Module) SetProvider(ctx context.Context, provider any) error {
+	next, ok := provider.(Provider)
+	if !ok || next == nil {
+		return fmt.Errorf("%w: %T", ErrInvalidProvider, provider)
+	}
+	old, err := mod.provider.Swap(ctx, next)
+	if err != nil {
+		return fmt.Errorf("failed to drain the old email provider: %w", err)
+	}
+	if mod.app != nil {
+		mod.app.Logger().Info("email provider replaced", "provider", fmt.Sprintf("%T", next))
+	}
+	if closer, ok := old.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
 
+// DevInbox returns the provider if it is a DevInboxProvider, or nil.
+func (mod *Module) DevInbox() *DevInboxProvider {
+	inbox, _ := mod.provider.Load().(*DevInboxProvider)
+	return inbox
+}
+
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.suppressions.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "email.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.suppressions.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "email.db"))
+}
+
 // Send sends an email using the configured provider.
 func (mod *Module) Send(ctx context.Context, to, subject, body string) error {
-	return mod.provider.Send(ctx, to, subject, body)
+	msg := &Message{To: []string{to}, Subject: subject, Text: body}
+	return mod.deliver(ctx, msg, func(ctx context.Context, provider Provider, msg *Message) error {
+		return provider.Send(ctx, to, subject, body)
+	})
 }
 
 // SendHTML sends an HTML email.
 func (mod *Module) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
-	if htmlProvider, ok := mod.provider.(HTMLProvider); ok {
-		return htmlProvider.SendHTML(ctx, to, subject, htmlBody)
-	}
-	// Fall back to plain text
-	return mod.provider.Send(ctx, to, subject, htmlBody)
+	msg := &Message{To: []string{to}, Subject: subject, HTML: htmlBody}
+	return mod.deliver(ctx, msg, func(ctx context.Context, provider Provider, msg *Message) error {
+		if htmlProvider, ok := provider.(HTMLProvider); ok {
+			return htmlProvider.SendHTML(ctx, to, subject, htmlBody)
+		}
+		// Fall back to plain text
+		return provider.Send(ctx, to, subject, htmlBody)
+	})
 }
 
 // HTMLProvider is an optional interface for providers that support HTML emails.
@@ -175,54 +450,6 @@ type HTMLProvider interface {
 	SendHTML(ctx context.Context, to, subject, htmlBody string) error
 }
 
-// SMTPProvider sends emails via SMTP.
-type SMTPProvider struct {
-	config SMTPConfig
-}
-
-// NewSMTPProvider creates a new SMTP email provider.
-func NewSMTPProvider(config SMTPConfig) *SMTPProvider {
-	return &SMTPProvider{config: config}
-}
-
-func (provider *SMTPProvider) Send(ctx context.Context, to, subject, body string) error {
-	from := provider.config.From
-	if from == "" {
-		from = provider.config.Username
-	}
-
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
-		from, to, subject, body)
-
-	addr := fmt.Sprintf("%s:%d", provider.config.Host, provider.config.Port)
-
-	var auth smtp.Auth
-	if provider.config.Username != "" {
-		auth = smtp.PlainAuth("", provider.config.Username, provider.config.Password, provider.config.Host)
-	}
-
-	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
-}
-
-func (provider *SMTPProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
-	from := provider.config.From
-	if from == "" {
-		from = provider.config.Username
-	}
-
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=\"UTF-8\"\r\n\r\n%s",
-		from, to, subject, htmlBody)
-
-	addr := fmt.Sprintf("%s:%d", provider.config.Host, provider.config.Port)
-
-	var auth smtp.Auth
-	if provider.config.Username != "" {
-		auth = smtp.PlainAuth("", provider.config.Username, provider.config.Password, provider.config.Host)
-	}
-
-	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
-}
-
 // LogProvider is a provider that logs emails instead of sending them.
 // Useful for development and testing.
 type LogProvider struct {
@@ -244,3 +471,18 @@ func (provider *LogProvider) Send(ctx context.Context, to, subject, body string)
 func (provider *LogProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
 	return provider.Send(ctx, to, subject, htmlBody)
 }
+
+// SendMessage logs the message once per To recipient, with the HTML body if
+// set and the text body otherwise. Attachments are not logged.
+func (provider *LogProvider) SendMessage(ctx context.Context, msg *Message) error {
+	body := msg.HTML
+	if body == "" {
+		body = msg.Text
+	}
+	for _, to := range msg.To {
+		if err := provider.Send(ctx, to, msg.Subject, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
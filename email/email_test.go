@@ -1,8 +1,40 @@
 package email
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/storage"
 )
 
 func TestModule_Name(t *testing.T) {
@@ -52,7 +84,7 @@ func TestModuleNew_WithProvider(t *testing.T) {
 	provider := NewLogProvider(nil)
 	mod := New(WithProvider(provider))
 
-	if mod.provider != provider {
+	if mod.provider.Load() != provider {
 		t.Error("custom provider should be set")
 	}
 }
@@ -211,3 +243,1218 @@ func TestSMTPConfig_Defaults(t *testing.T) {
 		t.Errorf("default port should be 0, got %d", config.Port)
 	}
 }
+
+// Template tests
+
+// textOnlyProvider records plain text sends and doesn't support HTML.
+type textOnlyProvider struct {
+	subject string
+	body    string
+}
+
+func (provider *textOnlyProvider) Send(ctx context.Context, to, subject, body string) error {
+	provider.subject = subject
+	provider.body = body
+	return nil
+}
+
+var testTemplates = fstest.MapFS{
+	"welcome.subject.tmpl":      {Data: []byte("Welcome to {{.Brand.product_name}}, {{.Data.Name}}")},
+	"welcome.html.tmpl":         {Data: []byte("<p>Hi {{.Data.Name}}</p>")},
+	"welcome.txt.tmpl":          {Data: []byte("Hi {{.Data.Name}}")},
+	"auth/reset.subject.tmpl":   {Data: []byte("Reset your password")},
+	"auth/reset.txt.tmpl":       {Data: []byte("Reset link: {{.Data.Link}}")},
+	"layouts/default.html.tmpl": {Data: []byte(`<div style="color:{{.Brand.color}}">{{template "content" .}}</div>`)},
+	"layouts/default.txt.tmpl":  {Data: []byte("{{template \"content\" .}}\n-- {{.Brand.product_name}}")},
+	"README.md":                 {Data: []byte("ignored")},
+}
+
+func newTemplateModule(t *testing.T, opts ...Option) *Module {
+	t.Helper()
+	opts = append([]Option{
+		WithProvider(NewLogProvider(nil)),
+		WithTemplates(testTemplates),
+		WithBranding(Branding{"product_name": "Chassis", "color": "black"}),
+	}, opts...)
+	mod := New(opts...)
+	app := chassis.New(chassis.WithModules(mod))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return mod
+}
+
+func TestRender_LayoutAndBranding(t *testing.T) {
+	mod := newTemplateModule(t)
+	ctx := context.Background()
+
+	rendered, err := mod.Render(ctx, "user@example.com", "welcome", map[string]string{"Name": "<Ann>"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered.Subject != "Welcome to Chassis, <Ann>" {
+		t.Errorf("unexpected subject: %q", rendered.Subject)
+	}
+	if rendered.HTML != `<div style="color:black"><p>Hi &lt;Ann&gt;</p></div>` {
+		t.Errorf("HTML should be escaped and wrapped in layout, got %q", rendered.HTML)
+	}
+	if rendered.Text != "Hi <Ann>\n-- Chassis" {
+		t.Errorf("unexpected text: %q", rendered.Text)
+	}
+}
+
+func TestRender_OrgBranding(t *testing.T) {
+	mod := newTemplateModule(t, WithBrandingFunc(func(ctx context.Context, orgID string) (Branding, error) {
+		if orgID == "org-2" {
+			return Branding{"product_name": "Globex"}, nil
+		}
+		return nil, nil
+	}))
+	mod.SetBranding("org-1", Branding{"product_name": "Acme", "color": "red"})
+
+	rendered, err := mod.Render(WithOrgID(context.Background(), "org-1"), "", "welcome", map[string]string{"Name": "Ann"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered.Subject != "Welcome to Acme, Ann" || !strings.Contains(rendered.HTML, "color:red") {
+		t.Errorf("org-1 branding not applied: %+v", rendered)
+	}
+
+	rendered, err = mod.Render(WithOrgID(context.Background(), "org-2"), "", "welcome", map[string]string{"Name": "Ann"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered.Subject != "Welcome to Globex, Ann" || !strings.Contains(rendered.HTML, "color:black") {
+		t.Errorf("branding func should override defaults: %+v", rendered)
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	mod := newTemplateModule(t)
+	ctx := context.Background()
+
+	if _, err := mod.Render(ctx, "", "missing", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+	if err := mod.RegisterTemplate("custom", Template{Subject: "Hi", Text: "Body", Layout: "fancy"}); err != nil {
+		t.Fatalf("RegisterTemplate failed: %v", err)
+	}
+	if _, err := mod.Render(ctx, "", "custom", nil); !errors.Is(err, ErrLayoutNotFound) {
+		t.Errorf("expected ErrLayoutNotFound, got %v", err)
+	}
+	if err := mod.RegisterTemplate("empty", Template{Subject: "Hi"}); !errors.Is(err, ErrTemplateEmpty) {
+		t.Errorf("expected ErrTemplateEmpty, got %v", err)
+	}
+	if err := mod.RegisterTemplate("broken", Template{Subject: "{{.Data", Text: "x"}); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestRender_NoLayoutAndSubjectNewlines(t *testing.T) {
+	mod := newTemplateModule(t)
+	err := mod.RegisterTemplate("plain", Template{
+		Subject: "Hello {{.Data}}",
+		Text:    "Just text",
+		Layout:  NoLayout,
+	})
+	if err != nil {
+		t.Fatalf("RegisterTemplate failed: %v", err)
+	}
+
+	rendered, err := mod.Render(context.Background(), "", "plain", "Ann\r\nBcc: victim@example.com")
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if strings.ContainsAny(rendered.Subject, "\r\n") {
+		t.Errorf("subject must not contain newlines: %q", rendered.Subject)
+	}
+	if rendered.Text != "Just text" {
+		t.Errorf("NoLayout should skip the default layout, got %q", rendered.Text)
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	var gotSubject, gotBody string
+	mod := newTemplateModule(t, WithProvider(NewLogProvider(func(to, subject, body string) {
+		gotSubject, gotBody = subject, body
+	})))
+
+	if err := mod.SendTemplate(context.Background(), "user@example.com", "welcome", map[string]string{"Name": "Ann"}); err != nil {
+		t.Fatalf("SendTemplate failed: %v", err)
+	}
+	if gotSubject != "Welcome to Chassis, Ann" || !strings.Contains(gotBody, "<p>Hi Ann</p>") {
+		t.Errorf("HTML provider should receive the HTML body, got %q / %q", gotSubject, gotBody)
+	}
+
+	textOnly := &textOnlyProvider{}
+	mod = newTemplateModule(t, WithProvider(textOnly))
+	if err := mod.SendTemplate(context.Background(), "user@example.com", "welcome", map[string]string{"Name": "Ann"}); err != nil {
+		t.Fatalf("SendTemplate failed: %v", err)
+	}
+	if textOnly.body != "Hi Ann\n-- Chassis" {
+		t.Errorf("text-only provider should receive the text body, got %q", textOnly.body)
+	}
+}
+
+func TestLoadTemplatesFromStorage(t *testing.T) {
+	store := storage.New(storage.WithBasePath(t.TempDir()))
+	mod := New(WithProvider(NewLogProvider(nil)))
+	app := chassis.New(chassis.WithModules(store, mod))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	ctx := context.Background()
+
+	_ = store.Put(ctx, "email-templates/invite.subject.tmpl", []byte("Join {{.Data}}"))
+	_ = store.Put(ctx, "email-templates/invite.txt.tmpl", []byte("You're invited to {{.Data}}"))
+
+	if err := mod.LoadTemplatesFromStorage(ctx, "email-templates/"); err != nil {
+		t.Fatalf("LoadTemplatesFromStorage failed: %v", err)
+	}
+	rendered, err := mod.Render(ctx, "", "invite", "Acme")
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered.Subject != "Join Acme" || rendered.Text != "You're invited to Acme" {
+		t.Errorf("unexpected rendering: %+v", rendered)
+	}
+}
+
+type recordingProvider struct {
+	messages []*Message
+	sent     []string
+}
+
+func (provider *recordingProvider) Send(ctx context.Context, to, subject, body string) error {
+	provider.sent = append(provider.sent, to+": "+body)
+	return nil
+}
+
+type messageRecorder struct {
+	recordingProvider
+}
+
+func (provider *messageRecorder) SendMessage(ctx context.Context, msg *Message) error {
+	provider.messages = append(provider.messages, msg)
+	return nil
+}
+
+func TestMessage_MIME(t *testing.T) {
+	msg := &Message{
+		To:      []string{"ann@example.com"},
+		Cc:      []string{"bob@example.com"},
+		Bcc:     []string{"audit@example.com"},
+		Subject: "Your invoice – März",
+		HTML:    "<p>Invoice attached.</p>",
+		Text:    "Invoice attached.",
+		Attachments: []Attachment{
+			{Filename: "invoice.pdf", Data: bytes.Repeat([]byte{0xde, 0xad}, 100)},
+		},
+	}
+
+	data, err := msg.MIME("billing@example.com")
+	if err != nil {
+		t.Fatalf("MIME failed: %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("generated message does not parse: %v", err)
+	}
+	if parsed.Header.Get("Bcc") != "" || bytes.Contains(data, []byte("audit@example.com")) {
+		t.Error("Bcc recipients must not appear in the message")
+	}
+	if parsed.Header.Get("Cc") != "bob@example.com" {
+		t.Errorf("Cc = %q", parsed.Header.Get("Cc"))
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != msg.Subject {
+		t.Errorf("Subject = %q", subject)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, want multipart/mixed", mediaType)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+
+	bodyPart, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("missing body part: %v", err)
+	}
+	if bodyType, _, _ := mime.ParseMediaType(bodyPart.Header.Get("Content-Type")); bodyType != "multipart/alternative" {
+		t.Errorf("body Content-Type = %q, want multipart/alternative", bodyType)
+	}
+
+	attachmentPart, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("missing attachment part: %v", err)
+	}
+	if attachmentPart.FileName() != "invoice.pdf" || attachmentPart.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("attachment headers = %v", attachmentPart.Header)
+	}
+	encoded, _ := io.ReadAll(attachmentPart)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || !bytes.Equal(decoded, msg.Attachments[0].Data) {
+		t.Errorf("attachment did not round-trip: %v", err)
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("expected exactly two parts, got %v", err)
+	}
+}
+
+func TestMessage_MIMEWithoutAttachments(t *testing.T) {
+	msg := &Message{To: []string{"ann@example.com"}, Subject: "Hi", Text: "plain body"}
+	data, err := msg.MIME("from@example.com")
+	if err != nil {
+		t.Fatalf("MIME failed: %v", err)
+	}
+	parsed, _ := mail.ReadMessage(bytes.NewReader(data))
+	if !strings.HasPrefix(parsed.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", parsed.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if string(body) != "plain body" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestModule_SendMessage(t *testing.T) {
+	ctx := context.Background()
+	msg := Message{
+		To:          []string{"ann@example.com"},
+		Subject:     "Report",
+		Text:        "See attached",
+		Attachments: []Attachment{{Filename: "report.csv", Data: []byte("a,b\n")}},
+	}
+
+	recorder := &messageRecorder{}
+	mod := New(WithProvider(recorder))
+	if err := mod.SendMessage(ctx, msg); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if len(recorder.messages) != 1 || recorder.messages[0].Attachments[0].Filename != "report.csv" {
+		t.Errorf("message should pass through to a MessageProvider, got %+v", recorder.messages)
+	}
+
+	// Providers without SendMessage can't carry attachments
+	plain := &recordingProvider{}
+	mod = New(WithProvider(plain))
+	if err := mod.SendMessage(ctx, &msg); !errors.Is(err, ErrMessageUnsupported) {
+		t.Errorf("expected ErrMessageUnsupported, got %v", err)
+	}
+	msg.Attachments = nil
+	msg.To = append(msg.To, "bob@example.com")
+	if err := mod.SendMessage(ctx, &msg); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if len(plain.sent) != 2 || plain.sent[1] != "bob@example.com: See attached" {
+		t.Errorf("expected one Send per recipient, got %v", plain.sent)
+	}
+}
+
+func TestModule_SendMessageValidation(t *testing.T) {
+	mod := New(WithProvider(&messageRecorder{}))
+	ctx := context.Background()
+
+	tests := []struct {
+		message any
+		want    error
+	}{
+		{Message{Subject: "Hi", Text: "body"}, ErrNoRecipients},
+		{Message{To: []string{"not-an-address"}, Subject: "Hi", Text: "body"}, ErrInvalidAddress},
+		{Message{To: []string{"ann@example.com"}, Bcc: []string{"@"}, Subject: "Hi", Text: "body"}, ErrInvalidAddress},
+		{Message{To: []string{"ann@example.com"}, Subject: "Hi"}, ErrEmptyMessage},
+		{"not a message", ErrInvalidMessage},
+		{(*Message)(nil), ErrInvalidMessage},
+	}
+	for _, test := range tests {
+		if err := mod.SendMessage(ctx, test.message); !errors.Is(err, test.want) {
+			t.Errorf("SendMessage(%+v) = %v, want %v", test.message, err, test.want)
+		}
+	}
+}
+
+// flakyProvider fails the first len(errs) sends with the given errors.
+type flakyProvider struct {
+	mu       sync.Mutex
+	errs     []error
+	attempts int
+	sent     []string
+}
+
+func (provider *flakyProvider) Send(ctx context.Context, to, subject, body string) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.attempts++
+	if provider.attempts <= len(provider.errs) {
+		return provider.errs[provider.attempts-1]
+	}
+	provider.sent = append(provider.sent, to)
+	return nil
+}
+
+func (provider *flakyProvider) sentTo() []string {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	return append([]string(nil), provider.sent...)
+}
+
+// sendEvents records the email events published by app.
+func sendEvents(app *chassis.App) func() map[string][]*SendEvent {
+	var mu sync.Mutex
+	received := make(map[string][]*SendEvent)
+	for _, eventType := range []string{EventEmailSent, EventEmailFailed, EventEmailBounced} {
+		app.Events().Subscribe(eventType, func(ctx context.Context, eventType string, payload any) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[eventType] = append(received[eventType], payload.(*SendEvent))
+		})
+	}
+	return func() map[string][]*SendEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestModule_SendAsyncRetriesTransientFailures(t *testing.T) {
+	provider := &flakyProvider{errs: []error{&textproto.Error{Code: 421, Msg: "try again later"}}}
+	mod := New(WithProvider(provider), WithRetryPolicy(fastRetry))
+	app := chassis.New(chassis.WithModules(events.New(), mod))
+	received := sendEvents(app)
+
+	msg := Message{To: []string{"ann@example.com"}, Subject: "Hi", Text: "body"}
+	if err := mod.SendAsync(context.Background(), msg); err != nil {
+		t.Fatalf("SendAsync failed: %v", err)
+	}
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	mod.pending.Wait()
+
+	if got := provider.sentTo(); len(got) != 1 || got[0] != "ann@example.com" {
+		t.Errorf("expected the retry to succeed, sent %v", got)
+	}
+	sent := received()[EventEmailSent]
+	if len(sent) != 1 || sent[0].Attempts != 2 {
+		t.Errorf("expected one %s event after 2 attempts, got %+v", EventEmailSent, sent)
+	}
+	if failed := received()[EventEmailFailed]; len(failed) != 0 {
+		t.Errorf("retried failures should not publish %s, got %+v", EventEmailFailed, failed)
+	}
+}
+
+func TestModule_SendAsyncGivesUp(t *testing.T) {
+	permanent := errors.New("relay denied")
+	tests := map[string]struct {
+		errs         []error
+		wantAttempts int
+	}{
+		"transient": {errs: []error{ErrTransient, ErrTransient, ErrTransient}, wantAttempts: 3},
+		"permanent": {errs: []error{permanent}, wantAttempts: 1},
+	}
+	for name, test := range tests {
+		provider := &flakyProvider{errs: test.errs}
+		mod := New(WithProvider(provider), WithRetryPolicy(fastRetry))
+		app := chassis.New(chassis.WithModules(events.New(), mod))
+		received := sendEvents(app)
+
+		_ = mod.SendAsync(context.Background(), &Message{To: []string{"ann@example.com"}, Subject: "Hi", Text: "body"})
+		mod.pending.Wait()
+		_ = app.Shutdown(context.Background())
+
+		failed := received()[EventEmailFailed]
+		if len(failed) != 1 || failed[0].Attempts != test.wantAttempts {
+			t.Errorf("%s: expected one %s event after %d attempts, got %+v", name, EventEmailFailed, test.wantAttempts, failed)
+		}
+	}
+}
+
+func TestModule_SendAsyncQueue(t *testing.T) {
+	ctx := context.Background()
+	provider := &flakyProvider{}
+	queueMod := queue.New(queue.WithDBPath(filepath.Join(t.TempDir(), "queue.db")))
+	mod := New(WithProvider(provider))
+	app := chassis.New(chassis.WithModules(events.New(), queueMod, mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	if err := mod.SendAsync(ctx, Message{To: []string{"ann@example.com"}, Subject: "Hi", Text: "body"}); err != nil {
+		t.Fatalf("SendAsync failed: %v", err)
+	}
+	if got := provider.sentTo(); len(got) != 0 {
+		t.Fatalf("SendAsync should only enqueue, sent %v", got)
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go queueMod.Worker(workerCtx, func(ctx context.Context, job *queue.Job) error {
+		t.Errorf("unexpected job type %q", job.Type)
+		return nil
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(provider.sentTo()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := provider.sentTo(); len(got) != 1 || got[0] != "ann@example.com" {
+		t.Errorf("expected the queue worker to send the email, sent %v", got)
+	}
+}
+
+func TestModule_HardBounceSuppresses(t *testing.T) {
+	ctx := context.Background()
+	provider := &flakyProvider{errs: []error{&textproto.Error{Code: 550, Msg: "no such user"}}}
+	mod := New(WithProvider(provider))
+	app := chassis.New(chassis.WithModules(events.New(), mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+	received := sendEvents(app)
+
+	if err := mod.Send(ctx, "Gone@Example.com", "Hi", "body"); err == nil {
+		t.Fatal("expected the bounce to be returned")
+	}
+	if suppressed, _ := mod.IsSuppressed(ctx, "gone@example.com"); !suppressed {
+		t.Error("a hard bounce should suppress the address")
+	}
+	if bounced := received()[EventEmailBounced]; len(bounced) != 1 {
+		t.Errorf("expected one %s event, got %+v", EventEmailBounced, bounced)
+	}
+
+	if err := mod.Send(ctx, "gone@example.com", "Hi", "body"); !errors.Is(err, ErrSuppressed) {
+		t.Errorf("expected ErrSuppressed, got %v", err)
+	}
+	if err := mod.SendAsync(ctx, Message{To: []string{"gone@example.com"}, Subject: "Hi", Text: "body"}); !errors.Is(err, ErrSuppressed) {
+		t.Errorf("SendAsync: expected ErrSuppressed, got %v", err)
+	}
+	if provider.attempts != 1 {
+		t.Errorf("suppressed sends should not reach the provider, got %d attempts", provider.attempts)
+	}
+
+	// Suppressed Cc recipients are dropped without failing the send
+	_ = mod.Suppress(ctx, "cc@example.com", "manual")
+	recorder := &messageRecorder{}
+	mod.provider.Store(recorder)
+	if err := mod.SendMessage(ctx, Message{To: []string{"ann@example.com"}, Cc: []string{"cc@example.com"}, Subject: "Hi", Text: "body"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if len(recorder.messages) != 1 || len(recorder.messages[0].Cc) != 0 {
+		t.Errorf("expected the suppressed Cc to be dropped, got %+v", recorder.messages)
+	}
+
+	if err := mod.Unsuppress(ctx, "gone@example.com"); err != nil {
+		t.Fatalf("Unsuppress failed: %v", err)
+	}
+	if err := mod.Unsuppress(ctx, "gone@example.com"); !errors.Is(err, ErrSuppressionNotFound) {
+		t.Errorf("expected ErrSuppressionNotFound, got %v", err)
+	}
+	if err := mod.Send(ctx, "gone@example.com", "Hi", "body"); err != nil {
+		t.Errorf("Send after Unsuppress failed: %v", err)
+	}
+}
+
+func TestSQLiteSuppressionStore(t *testing.T) {
+	ctx := context.Background()
+	mod := New(WithProvider(&recordingProvider{}), WithDBPath(filepath.Join(t.TempDir(), "email.db")))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	if _, ok := mod.suppressions.(*SQLiteSuppressionStore); !ok {
+		t.Fatalf("expected a SQLite store, got %T", mod.suppressions)
+	}
+	for _, address := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := mod.Suppress(ctx, address, "bounced"); err != nil {
+			t.Fatalf("Suppress failed: %v", err)
+		}
+	}
+
+	page, err := mod.ListSuppressions(ctx, pagination.Request{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListSuppressions failed: %v", err)
+	}
+	if page.Total != 3 || len(page.Items) != 2 || !page.HasMore {
+		t.Errorf("unexpected first page: %+v", page)
+	}
+	page, err = mod.ListSuppressions(ctx, pagination.Request{Cursor: page.NextCursor, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListSuppressions failed: %v", err)
+	}
+	if len(page.Items) != 1 || page.HasMore {
+		t.Errorf("unexpected last page: %+v", page)
+	}
+}
+
+func TestSendGridProvider(t *testing.T) {
+	var payload sendGridRequest
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/v3/mail/send" || request.Header.Get("Authorization") != "Bearer sg-key" {
+			t.Errorf("unexpected request %s with %q", request.URL.Path, request.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(request.Body).Decode(&payload)
+		writer.Header().Set("X-Message-Id", "sg-123")
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	provider := NewSendGridProvider(SendGridConfig{APIKey: "sg-key", From: "noreply@example.com", BaseURL: server.URL})
+	messageID, err := provider.SendTracked(context.Background(), &Message{
+		To:          []string{"ann@example.com"},
+		Bcc:         []string{"audit@example.com"},
+		Subject:     "Report",
+		HTML:        "<p>See attached</p>",
+		Text:        "See attached",
+		Attachments: []Attachment{{Filename: "report.csv", Data: []byte("a,b\n")}},
+	})
+	if err != nil {
+		t.Fatalf("SendTracked failed: %v", err)
+	}
+	if messageID != "sg-123" {
+		t.Errorf("messageID = %q, want sg-123", messageID)
+	}
+	personalization := payload.Personalizations[0]
+	if personalization.To[0].Email != "ann@example.com" || personalization.Bcc[0].Email != "audit@example.com" {
+		t.Errorf("unexpected recipients %+v", personalization)
+	}
+	if len(payload.Content) != 2 || payload.Content[0].Type != "text/plain" {
+		t.Errorf("text/plain should come first, got %+v", payload.Content)
+	}
+	if len(payload.Attachments) != 1 || payload.Attachments[0].Content != base64.StdEncoding.EncodeToString([]byte("a,b\n")) {
+		t.Errorf("unexpected attachments %+v", payload.Attachments)
+	}
+}
+
+func TestAPIErrorMapping(t *testing.T) {
+	status := http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Retry-After", "7")
+		writer.WriteHeader(status)
+		_, _ = writer.Write([]byte(`{"errors":[{"message":"too many requests"}]}`))
+	}))
+	defer server.Close()
+
+	provider := NewSendGridProvider(SendGridConfig{APIKey: "key", From: "noreply@example.com", BaseURL: server.URL})
+	err := provider.Send(context.Background(), "ann@example.com", "Hi", "body")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 7*time.Second || apiErr.Message != "too many requests" {
+		t.Fatalf("expected an APIError with Retry-After, got %v", err)
+	}
+	if !errors.Is(err, ErrRateLimited) || !IsTransient(err) {
+		t.Errorf("429 should be a transient rate limit, got %v", err)
+	}
+	if got := (RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}).delay(1, err); got != 5*time.Second {
+		t.Errorf("Retry-After should extend the backoff up to MaxBackoff, got %v", got)
+	}
+
+	status = http.StatusBadRequest
+	err = provider.Send(context.Background(), "ann@example.com", "Hi", "body")
+	if !errors.Is(err, ErrProviderRejected) || IsTransient(err) {
+		t.Errorf("400 should be a permanent rejection, got %v", err)
+	}
+}
+
+func TestMailgunProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if user, key, _ := request.BasicAuth(); user != "api" || key != "mg-key" {
+			t.Errorf("unexpected credentials %q/%q", user, key)
+		}
+		if request.URL.Path != "/v3/mg.example.com/messages" {
+			t.Errorf("unexpected path %s", request.URL.Path)
+		}
+		if err := request.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("invalid form: %v", err)
+		}
+		form := request.MultipartForm
+		if strings.Join(form.Value["to"], ",") != "ann@example.com,bob@example.com" || form.Value["text"][0] != "body" {
+			t.Errorf("unexpected fields %v", form.Value)
+		}
+		if files := form.File["attachment"]; len(files) != 1 || files[0].Filename != "notes.txt" {
+			t.Errorf("unexpected attachments %v", files)
+		}
+		_, _ = writer.Write([]byte(`{"id":"<mg-456@mg.example.com>","message":"Queued. Thank you."}`))
+	}))
+	defer server.Close()
+
+	provider := NewMailgunProvider(MailgunConfig{APIKey: "mg-key", Domain: "mg.example.com", From: "noreply@example.com", BaseURL: server.URL})
+	messageID, err := provider.SendTracked(context.Background(), &Message{
+		To:          []string{"ann@example.com", "bob@example.com"},
+		Subject:     "Notes",
+		Text:        "body",
+		Attachments: []Attachment{{Filename: "notes.txt", Data: []byte("notes")}},
+	})
+	if err != nil {
+		t.Fatalf("SendTracked failed: %v", err)
+	}
+	if messageID != "<mg-456@mg.example.com>" {
+		t.Errorf("messageID = %q", messageID)
+	}
+}
+
+func TestSESProvider(t *testing.T) {
+	var raw []byte
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		authorization := request.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/20260102/eu-west-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature=") {
+			t.Errorf("unexpected Authorization %q", authorization)
+		}
+		if request.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Error("session token should be sent")
+		}
+		var payload struct {
+			Destination struct{ BccAddresses []string }
+			Content     struct{ Raw struct{ Data []byte } }
+		}
+		_ = json.NewDecoder(request.Body).Decode(&payload)
+		if len(payload.Destination.BccAddresses) != 1 {
+			t.Errorf("Bcc recipients should be in the destination, got %+v", payload.Destination)
+		}
+		raw = payload.Content.Raw.Data
+		_, _ = writer.Write([]byte(`{"MessageId":"ses-789"}`))
+	}))
+	defer server.Close()
+
+	provider := NewSESProvider(SESConfig{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		From:            "noreply@example.com",
+		Endpoint:        server.URL,
+	})
+	provider.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	messageID, err := provider.SendTracked(context.Background(), &Message{
+		To:      []string{"ann@example.com"},
+		Bcc:     []string{"audit@example.com"},
+		Subject: "Hi",
+		Text:    "body",
+	})
+	if err != nil {
+		t.Fatalf("SendTracked failed: %v", err)
+	}
+	if messageID != "ses-789" {
+		t.Errorf("messageID = %q", messageID)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil || parsed.Header.Get("Subject") != "Hi" || parsed.Header.Get("Bcc") != "" {
+		t.Errorf("expected raw MIME without a Bcc header, got %q (%v)", raw, err)
+	}
+}
+
+func TestModule_ProviderFromConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer from-env" {
+			t.Errorf("API key should come from the environment, got %q", request.Header.Get("Authorization"))
+		}
+		writer.Header().Set("X-Message-Id", "sg-1")
+		writer.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	t.Setenv("SENDGRID_API_KEY", "from-env")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configYAML := "email:\n  provider: sendgrid\n  from: noreply@example.com\n  sendgrid:\n    base_url: " + server.URL + "\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := New()
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(events.New(), mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	received := sendEvents(app)
+
+	if _, ok := mod.provider.Load().(*SendGridProvider); !ok {
+		t.Fatalf("expected a SendGrid provider, got %T", mod.provider.Load())
+	}
+	if err := mod.Send(context.Background(), "ann@example.com", "Hi", "body"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if sent := received()[EventEmailSent]; len(sent) != 1 || sent[0].MessageID != "sg-1" {
+		t.Errorf("expected the message ID in %s, got %+v", EventEmailSent, sent)
+	}
+
+	for configYAML, want := range map[string]error{
+		"email:\n  provider: pigeon\n":  ErrUnknownProvider,
+		"email:\n  provider: mailgun\n": ErrProviderConfig,
+	} {
+		if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+			t.Fatal(err)
+		}
+		app := chassis.New(chassis.WithConfigFile(configPath))
+		if err := New().Init(context.Background(), app); !errors.Is(err, want) {
+			t.Errorf("%q: expected %v, got %v", configYAML, want, err)
+		}
+	}
+}
+
+func TestDevInboxProvider(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) InboxStore{
+		"memory": func(t *testing.T) InboxStore { return NewMemoryInboxStore() },
+		"sqlite": func(t *testing.T) InboxStore {
+			store, err := NewSQLiteInboxStore(filepath.Join(t.TempDir(), "inbox.db"))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			return store
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var logged []string
+			inbox := NewDevInboxProvider(DevInboxConfig{
+				Store:  newStore(t),
+				From:   "noreply@example.com",
+				Logger: func(to, subject, body string) { logged = append(logged, to) },
+			})
+			defer func() { _ = inbox.Close() }()
+			ctx := context.Background()
+
+			id, err := inbox.SendTracked(ctx, &Message{
+				To:          []string{"ann@example.com"},
+				Bcc:         []string{"audit@example.com"},
+				Subject:     "Invoice",
+				Text:        "Your invoice is attached",
+				Attachments: []Attachment{{Filename: "invoice.txt", Data: []byte("total: 10")}},
+			})
+			if err != nil {
+				t.Fatalf("SendTracked failed: %v", err)
+			}
+			if err := inbox.Send(ctx, "bob@example.com", "Welcome", "Hello Bob"); err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+			if len(logged) != 2 {
+				t.Errorf("expected each email to be logged, got %v", logged)
+			}
+
+			messages, err := inbox.Messages(ctx)
+			if err != nil || len(messages) != 2 || messages[0].Subject != "Welcome" {
+				t.Fatalf("expected 2 messages, most recent first, got %+v (%v)", messages, err)
+			}
+			msg, err := inbox.Message(ctx, id)
+			if err != nil {
+				t.Fatalf("Message failed: %v", err)
+			}
+			if msg.From != "noreply@example.com" || len(msg.Attachments) != 1 || string(msg.Attachments[0].Data) != "total: 10" {
+				t.Errorf("message not captured intact: %+v", msg)
+			}
+			if !msg.SentTo("AUDIT@example.com") || msg.SentTo("bob@example.com") {
+				t.Error("SentTo should match every recipient case-insensitively")
+			}
+			if found, _ := inbox.Find(ctx, "ann@example.com", "invoice"); len(found) != 1 || found[0].ID != id {
+				t.Errorf("expected Find to match the invoice, got %+v", found)
+			}
+			if found, _ := inbox.Find(ctx, "ann@example.com", "Hello"); len(found) != 0 {
+				t.Errorf("expected no match, got %+v", found)
+			}
+
+			if err := inbox.Clear(ctx); err != nil {
+				t.Fatalf("Clear failed: %v", err)
+			}
+			if _, err := inbox.Message(ctx, id); !errors.Is(err, ErrInboxMessageNotFound) {
+				t.Errorf("expected ErrInboxMessageNotFound after Clear, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDevInboxHandler(t *testing.T) {
+	inbox := NewDevInboxProvider(DevInboxConfig{})
+	ctx := context.Background()
+	id, err := inbox.SendTracked(ctx, &Message{
+		To:          []string{"ann@example.com"},
+		Subject:     "Reset <password>",
+		HTML:        "<script>alert(1)</script><p>Reset</p>",
+		Attachments: []Attachment{{Filename: "notes.txt", Data: []byte("notes")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/dev/mail/", http.StripPrefix("/dev/mail", inbox.Handler()))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = response.Body.Close() }()
+		body, _ := io.ReadAll(response.Body)
+		return response, string(body)
+	}
+
+	if _, body := get("/dev/mail/"); !strings.Contains(body, "Reset &lt;password&gt;") || !strings.Contains(body, "messages/"+id) {
+		t.Errorf("index should link the escaped subject, got %s", body)
+	}
+	if response, body := get("/dev/mail/messages/" + id + "/html"); response.Header.Get("Content-Security-Policy") != "sandbox" || !strings.Contains(body, "<p>Reset</p>") {
+		t.Errorf("HTML body should be served sandboxed, got %v %s", response.Header, body)
+	}
+	if response, body := get("/dev/mail/messages/" + id + "/attachments/0"); body != "notes" || !strings.Contains(response.Header.Get("Content-Disposition"), "notes.txt") {
+		t.Errorf("unexpected attachment response %v %q", response.Header, body)
+	}
+	if response, _ := get("/dev/mail/messages/missing"); response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown message, got %d", response.StatusCode)
+	}
+
+	response, body := get("/dev/mail/api/messages")
+	var listed []InboxMessage
+	if err := json.Unmarshal([]byte(body), &listed); err != nil || response.StatusCode != http.StatusOK || len(listed) != 1 || listed[0].ID != id {
+		t.Fatalf("unexpected API listing %d %s (%v)", response.StatusCode, body, err)
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, server.URL+"/dev/mail/api/messages", nil)
+	deleted, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 from DELETE, got %d", deleted.StatusCode)
+	}
+	if messages, _ := inbox.Messages(ctx); len(messages) != 0 {
+		t.Errorf("expected an empty inbox, got %d messages", len(messages))
+	}
+}
+
+func TestModule_DevInboxFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	configYAML := "email:\n  provider: devinbox\n  from: noreply@example.com\n  devinbox:\n    db_path: " + filepath.Join(dir, "inbox.db") + "\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := New()
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	inbox := mod.DevInbox()
+	if inbox == nil {
+		t.Fatalf("expected a dev inbox, got %T", mod.provider.Load())
+	}
+	if err := mod.Send(context.Background(), "ann@example.com", "Hi", "body"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if found, _ := inbox.Find(context.Background(), "ann@example.com", "body"); len(found) != 1 || found[0].From != "noreply@example.com" {
+		t.Errorf("expected the email in the inbox, got %+v", found)
+	}
+}
+
+// fakeSMTP is a minimal SMTP server that records connections and messages.
+type fakeSMTP struct {
+	listener  net.Listener
+	startTLS  *tls.Config // offered with STARTTLS when set
+	silent    bool        // accept connections but never greet
+	mu        sync.Mutex
+	conns     int
+	resets    int
+	encrypted []bool
+	auth      []string
+	messages  []string
+}
+
+func newFakeSMTP(t *testing.T, listener net.Listener, configure func(*fakeSMTP)) *fakeSMTP {
+	t.Helper()
+	server := &fakeSMTP{listener: listener}
+	if configure != nil {
+		configure(server)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns++
+			server.mu.Unlock()
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeSMTP) port() int {
+	return server.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (server *fakeSMTP) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	if server.silent {
+		_, _ = io.Copy(io.Discard, conn)
+		return
+	}
+	_, encrypted := conn.(*tls.Conn)
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"fake"}
+			if server.startTLS != nil && !encrypted {
+				lines = append(lines, "STARTTLS")
+			}
+			lines = append(lines, "AUTH PLAIN")
+			for i, ext := range lines {
+				separator := "-"
+				if i == len(lines)-1 {
+					separator = " "
+				}
+				_ = text.PrintfLine("250%s%s", separator, ext)
+			}
+		case "STARTTLS":
+			_ = text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, server.startTLS)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, encrypted = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			server.mu.Lock()
+			server.auth = append(server.auth, arg)
+			server.mu.Unlock()
+			_ = text.PrintfLine("235 ok")
+		case "RCPT":
+			if strings.Contains(arg, "bounce") {
+				_ = text.PrintfLine("550 no such user")
+				continue
+			}
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.messages = append(server.messages, string(data))
+			server.encrypted = append(server.encrypted, encrypted)
+			server.mu.Unlock()
+			_ = text.PrintfLine("250 queued")
+		case "RSET":
+			server.mu.Lock()
+			server.resets++
+			server.mu.Unlock()
+			_ = text.PrintfLine("250 ok")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("250 ok")
+		}
+	}
+}
+
+// testTLSConfigs returns a server config with a self-signed certificate for
+// 127.0.0.1 and a client config that trusts it.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func listenTCP(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func TestSMTPProvider_StartTLSAndConnectionReuse(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	server := newFakeSMTP(t, listenTCP(t), func(server *fakeSMTP) { server.startTLS = serverTLS })
+	provider := NewSMTPProvider(SMTPConfig{
+		Host:      "127.0.0.1",
+		Port:      server.port(),
+		Username:  "user",
+		Password:  "pass",
+		From:      "noreply@example.com",
+		TLS:       TLSStartTLS,
+		TLSConfig: clientTLS,
+	})
+	defer func() { _ = provider.Close() }()
+	ctx := context.Background()
+
+	for i := range 3 {
+		if err := provider.Send(ctx, "ann@example.com", fmt.Sprintf("Message %d", i), "body"); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+	}
+	// A rejected recipient leaves the connection usable
+	err := provider.Send(ctx, "bounce@example.com", "Bounce", "body")
+	if !IsHardBounce(err) {
+		t.Fatalf("expected a hard bounce, got %v", err)
+	}
+	if err := provider.Send(ctx, "ann@example.com", "After bounce", "body"); err != nil {
+		t.Fatalf("Send after bounce failed: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.conns != 1 {
+		t.Errorf("expected one reused connection, got %d", server.conns)
+	}
+	if len(server.messages) != 4 || server.resets != 4 {
+		t.Errorf("expected 4 messages and 4 resets, got %d and %d", len(server.messages), server.resets)
+	}
+	for i, encrypted := range server.encrypted {
+		if !encrypted {
+			t.Errorf("message %d was sent before STARTTLS", i)
+		}
+	}
+	if len(server.auth) != 1 || !strings.HasPrefix(server.auth[0], "PLAIN ") {
+		t.Errorf("expected one PLAIN authentication, got %v", server.auth)
+	}
+}
+
+func TestSMTPProvider_TLSModes(t *testing.T) {
+	plain := newFakeSMTP(t, listenTCP(t), nil)
+	ctx := context.Background()
+
+	required := NewSMTPProvider(SMTPConfig{Host: "127.0.0.1", Port: plain.port(), TLS: TLSStartTLS})
+	if err := required.Send(ctx, "ann@example.com", "Hi", "body"); !errors.Is(err, ErrStartTLSUnsupported) {
+		t.Errorf("expected ErrStartTLSUnsupported, got %v", err)
+	}
+	opportunistic := NewSMTPProvider(SMTPConfig{Host: "127.0.0.1", Port: plain.port()})
+	if err := opportunistic.Send(ctx, "ann@example.com", "Hi", "body"); err != nil {
+		t.Errorf("opportunistic TLS should fall back to plain text, got %v", err)
+	}
+	_ = opportunistic.Close()
+
+	serverTLS, clientTLS := testTLSConfigs(t)
+	implicit := newFakeSMTP(t, tls.NewListener(listenTCP(t), serverTLS), nil)
+	provider := NewSMTPProvider(SMTPConfig{Host: "127.0.0.1", Port: implicit.port(), TLS: TLSImplicit, TLSConfig: clientTLS})
+	defer func() { _ = provider.Close() }()
+	if err := provider.Send(ctx, "ann@example.com", "Hi", "body"); err != nil {
+		t.Fatalf("implicit TLS send failed: %v", err)
+	}
+	implicit.mu.Lock()
+	defer implicit.mu.Unlock()
+	if len(implicit.encrypted) != 1 || !implicit.encrypted[0] {
+		t.Errorf("expected an encrypted message, got %v", implicit.encrypted)
+	}
+
+	if _, err := parseTLSMode("ssl"); !errors.Is(err, ErrProviderConfig) {
+		t.Errorf("expected ErrProviderConfig for an unknown mode, got %v", err)
+	}
+}
+
+func TestSMTPProvider_Timeouts(t *testing.T) {
+	server := newFakeSMTP(t, listenTCP(t), func(server *fakeSMTP) { server.silent = true })
+	provider := NewSMTPProvider(SMTPConfig{Host: "127.0.0.1", Port: server.port(), SendTimeout: 50 * time.Millisecond})
+
+	started := time.Now()
+	err := provider.Send(context.Background(), "ann@example.com", "Hi", "body")
+	if !errors.Is(err, context.DeadlineExceeded) || !IsTransient(err) {
+		t.Errorf("expected a transient timeout, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("send timeout not enforced, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	slow := NewSMTPProvider(SMTPConfig{Host: "127.0.0.1", Port: server.port()})
+	if err := slow.Send(ctx, "ann@example.com", "Hi", "body"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the send to stop when ctx is cancelled, got %v", err)
+	}
+}
+
+func TestSMTPProvider_PoolDisabled(t *testing.T) {
+	server := newFakeSMTP(t, listenTCP(t), nil)
+	provider := NewSMTPProvider(SMTPConfig{Host: "127.0.0.1", Port: server.port(), PoolSize: -1})
+	for range 2 {
+		if err := provider.Send(context.Background(), "ann@example.com", "Hi", "body"); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.conns != 2 {
+		t.Errorf("expected a connection per message, got %d", server.conns)
+	}
+}
+
+// blockingProvider holds Send until release is closed.
+type blockingProvider struct {
+	recordingProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func (provider *blockingProvider) Send(ctx context.Context, to, subject, body string) error {
+	close(provider.started)
+	<-provider.release
+	return provider.recordingProvider.Send(ctx, to, subject, body)
+}
+
+func TestModule_SetProvider(t *testing.T) {
+	old := &blockingProvider{started: make(chan struct{}), release: make(chan struct{})}
+	mod := New(WithProvider(old))
+	ctx := context.Background()
+
+	sent := make(chan error, 1)
+	go func() { sent <- mod.Send(ctx, "ann@example.com", "Hi", "first") }()
+	<-old.started
+
+	inbox := NewDevInboxProvider(DevInboxConfig{})
+	swapped := make(chan error, 1)
+	go func() { swapped <- mod.SetProvider(ctx, inbox) }()
+
+	deadline := time.Now().Add(time.Second)
+	for mod.DevInbox() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := mod.Send(ctx, "bob@example.com", "Hi", "second"); err != nil {
+		t.Fatalf("Send on the new provider failed: %v", err)
+	}
+	messages, err := inbox.Messages(ctx)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("expected the new provider to get one message, got %d (%v)", len(messages), err)
+	}
+	select {
+	case err := <-swapped:
+		t.Fatalf("SetProvider returned before the in-flight send finished: %v", err)
+	default:
+	}
+
+	close(old.release)
+	if err := <-sent; err != nil {
+		t.Fatalf("in-flight Send failed: %v", err)
+	}
+	if err := <-swapped; err != nil {
+		t.Fatalf("SetProvider failed: %v", err)
+	}
+	if len(old.sent) != 1 {
+		t.Errorf("expected the in-flight send on the old provider, got %v", old.sent)
+	}
+
+	if err := mod.SetProvider(ctx, "ses"); !errors.Is(err, ErrInvalidProvider) {
+		t.Errorf("expected ErrInvalidProvider, got %v", err)
+	}
+}
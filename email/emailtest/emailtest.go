@@ -0,0 +1,99 @@
+// Package emailtest provides assertions over emails captured by an
+// email.DevInboxProvider.
+//
+//	inbox := emailtest.NewInbox()
+//	app := chassis.New(chassis.WithModules(email.New(email.WithProvider(inbox))))
+//
+//	// ... exercise code that sends email ...
+//
+//	msg := emailtest.AssertSent(t, inbox, "user@example.com", "Reset your password")
+//	emailtest.AssertNotSent(t, inbox, "admin@example.com", "")
+//
+// For emails sent with SendAsync, WaitForSent polls until a match arrives.
+package emailtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis/email"
+)
+
+// pollInterval is how often WaitForSent checks the inbox.
+const pollInterval = 10 * time.Millisecond
+
+// NewInbox returns an in-memory dev inbox.
+func NewInbox() *email.DevInboxProvider {
+	return email.NewDevInboxProvider(email.DevInboxConfig{})
+}
+
+// AssertSent fails the test unless an email containing text (in its
+// subject or either body) was sent to address, and returns the most
+// recent match. An empty address or text matches any.
+func AssertSent(t testing.TB, inbox *email.DevInboxProvider, address, text string) *email.InboxMessage {
+	t.Helper()
+	found := find(t, inbox, address, text)
+	if len(found) == 0 {
+		t.Fatalf("no email to %q containing %q was sent; inbox has:\n%s", address, text, summary(t, inbox))
+		return nil
+	}
+	return found[0]
+}
+
+// AssertNotSent fails the test if an email containing text was sent to address.
+func AssertNotSent(t testing.TB, inbox *email.DevInboxProvider, address, text string) {
+	t.Helper()
+	if found := find(t, inbox, address, text); len(found) > 0 {
+		t.Fatalf("unexpected email to %q containing %q: %q", address, text, found[0].Subject)
+	}
+}
+
+// AssertCount fails the test unless exactly count emails were sent to address.
+func AssertCount(t testing.TB, inbox *email.DevInboxProvider, address string, count int) {
+	t.Helper()
+	if found := find(t, inbox, address, ""); len(found) != count {
+		t.Fatalf("expected %d emails to %q, got %d; inbox has:\n%s", count, address, len(found), summary(t, inbox))
+	}
+}
+
+// WaitForSent is AssertSent for emails sent in the background: it polls
+// the inbox until a match arrives or timeout passes.
+func WaitForSent(t testing.TB, inbox *email.DevInboxProvider, address, text string, timeout time.Duration) *email.InboxMessage {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if found := find(t, inbox, address, text); len(found) > 0 {
+			return found[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no email to %q containing %q was sent within %s; inbox has:\n%s", address, text, timeout, summary(t, inbox))
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func find(t testing.TB, inbox *email.DevInboxProvider, address, text string) []*email.InboxMessage {
+	t.Helper()
+	found, err := inbox.Find(context.Background(), address, text)
+	if err != nil {
+		t.Fatalf("failed to read inbox: %v", err)
+	}
+	return found
+}
+
+// summary lists the inbox for failure messages.
+func summary(t testing.TB, inbox *email.DevInboxProvider) string {
+	t.Helper()
+	messages := find(t, inbox, "", "")
+	if len(messages) == 0 {
+		return "  (empty)"
+	}
+	lines := make([]string, len(messages))
+	for i, msg := range messages {
+		lines[i] = "  " + strings.Join(msg.To, ", ") + ": " + msg.Subject
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,33 @@
+package emailtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/email"
+)
+
+func TestAssertions(t *testing.T) {
+	inbox := NewInbox()
+	mod := email.New(email.WithProvider(inbox))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := mod.SendHTML(ctx, "Ann@Example.com", "Reset your password", "<a href='/reset?token=abc'>Reset</a>"); err != nil {
+		t.Fatalf("SendHTML failed: %v", err)
+	}
+	if err := mod.SendAsync(ctx, email.Message{To: []string{"bob@example.com"}, Subject: "Welcome", Text: "Hello Bob"}); err != nil {
+		t.Fatalf("SendAsync failed: %v", err)
+	}
+
+	msg := AssertSent(t, inbox, "ann@example.com", "token=abc")
+	if msg.Subject != "Reset your password" {
+		t.Errorf("unexpected match %q", msg.Subject)
+	}
+	WaitForSent(t, inbox, "bob@example.com", "Hello Bob", time.Second)
+	AssertNotSent(t, inbox, "ann@example.com", "Welcome")
+	AssertCount(t, inbox, "", 2)
+}
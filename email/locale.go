@@ -0,0 +1,87 @@
+package email
+
+import (
+	"context"
+	"strings"
+)
+
+// Localizer renders templated emails in the recipient's language. The i18n
+// module implements it and is used automatically when registered.
+type Localizer interface {
+	// RecipientLocale returns the locale to email an address in.
+	RecipientLocale(ctx context.Context, to string) string
+
+	// Translate returns the message for key in locale, with args filled in.
+	Translate(locale, key string, args ...any) string
+}
+
+type localeKey struct{}
+
+// WithLocale returns a context whose templated emails are rendered in
+// locale, whatever the recipient's preference.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the locale set with WithLocale.
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+	return locale
+}
+
+// WithLocalizer sets the Localizer used for templated emails, instead of
+// a registered module implementing it.
+func WithLocalizer(localizer Localizer) Option {
+	return func(mod *Module) {
+		mod.localizer = localizer
+	}
+}
+
+// localizerFor returns the configured Localizer or the first registered
+// module implementing it, or nil.
+func (mod *Module) localizerFor() Localizer {
+	if mod.localizer != nil || mod.app == nil {
+		return mod.localizer
+	}
+	for _, registered := range mod.app.Modules() {
+		if localizer, ok := registered.(Localizer); ok {
+			return localizer
+		}
+	}
+	return nil
+}
+
+// recipientLocale returns the locale to render a template for to in, or
+// "" if there is no Localizer.
+func recipientLocale(ctx context.Context, localizer Localizer, to string) string {
+	if locale := LocaleFromContext(ctx); locale != "" || localizer == nil {
+		return locale
+	}
+	return localizer.RecipientLocale(ctx, to)
+}
+
+// localizedName returns the name of the template to render in locale:
+// "<name>.<locale>" or "<name>.<language>" when registered, or name.
+// Callers hold templatesMu.
+func (mod *Module) localizedName(name, locale string) string {
+	if locale == "" {
+		return name
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{name + "." + locale, name + "." + language} {
+		if _, ok := mod.templates[candidate]; ok {
+			return candidate
+		}
+	}
+	return name
+}
+
+// translateFunc returns the template function "t" for locale.
+func translateFunc(localizer Localizer, locale string) func(key string, args ...any) string {
+	return func(key string, args ...any) string {
+		if localizer == nil {
+			return key
+		}
+		return localizer.Translate(locale, key, args...)
+	}
+}
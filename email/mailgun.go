@@ -0,0 +1,113 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Mailgun API base URLs.
+const (
+	DefaultMailgunURL = "https://api.mailgun.net"
+	MailgunEUURL      = "https://api.eu.mailgun.net"
+)
+
+// MailgunConfig holds Mailgun API configuration.
+type MailgunConfig struct {
+	APIKey  string
+	Domain  string
+	From    string
+	BaseURL string       // defaults to DefaultMailgunURL; use MailgunEUURL for EU domains
+	Client  *http.Client // defaults to http.DefaultClient
+}
+
+// MailgunProvider sends emails through the Mailgun messages API.
+type MailgunProvider struct {
+	config MailgunConfig
+}
+
+// NewMailgunProvider creates a new Mailgun email provider.
+func NewMailgunProvider(config MailgunConfig) *MailgunProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultMailgunURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &MailgunProvider{config: config}
+}
+
+func (provider *MailgunProvider) Send(ctx context.Context, to, subject, body string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, Text: body})
+}
+
+func (provider *MailgunProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, HTML: htmlBody})
+}
+
+func (provider *MailgunProvider) SendMessage(ctx context.Context, msg *Message) error {
+	_, err := provider.SendTracked(ctx, msg)
+	return err
+}
+
+// SendTracked sends msg and returns the Mailgun message ID.
+func (provider *MailgunProvider) SendTracked(ctx context.Context, msg *Message) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	fields := [][2]string{{"from", provider.config.From}, {"subject", msg.Subject}}
+	for _, to := range msg.To {
+		fields = append(fields, [2]string{"to", to})
+	}
+	for _, cc := range msg.Cc {
+		fields = append(fields, [2]string{"cc", cc})
+	}
+	for _, bcc := range msg.Bcc {
+		fields = append(fields, [2]string{"bcc", bcc})
+	}
+	if msg.Text != "" {
+		fields = append(fields, [2]string{"text", msg.Text})
+	}
+	if msg.HTML != "" {
+		fields = append(fields, [2]string{"html", msg.HTML})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return "", err
+		}
+	}
+
+	for _, attachment := range msg.Attachments {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachment"; filename=%q`, attachment.Filename))
+		header.Set("Content-Type", attachment.contentType())
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := part.Write(attachment.Data); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/v3/%s/messages", provider.config.BaseURL, provider.config.Domain)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth("api", provider.config.APIKey)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if _, err := doAPIRequest(provider.config.Client, "mailgun", request, &result, jsonErrorMessage); err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
@@ -0,0 +1,290 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrNoRecipients       = chassis.NewError(chassis.CodeInvalidArgument, "email message has no recipients")
+	ErrInvalidAddress     = chassis.NewError(chassis.CodeInvalidArgument, "invalid email address")
+	ErrEmptyMessage       = chassis.NewError(chassis.CodeInvalidArgument, "email message needs a subject and an HTML or text body")
+	ErrInvalidMessage     = chassis.NewError(chassis.CodeInvalidArgument, "SendMessage expects an email.Message or *email.Message")
+	ErrMessageUnsupported = chassis.NewError(chassis.CodeFailedPrecondition, "email provider does not support attachments or cc/bcc")
+)
+
+// Message is an email with any combination of recipients, bodies and attachments.
+// When both HTML and Text are set, they are sent as alternatives and the
+// recipient's client picks one.
+type Message struct {
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	HTML        string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Message.
+type Attachment struct {
+	Filename string
+
+	// ContentType defaults to the type implied by Filename's extension.
+	ContentType string
+
+	Data []byte
+}
+
+// MessageProvider is an optional interface for providers that send full
+// messages. Messages are passed through as-is; providers without it can only
+// send messages that have no attachments, Cc or Bcc.
+type MessageProvider interface {
+	Provider
+	SendMessage(ctx context.Context, msg *Message) error
+}
+
+// Recipients returns all envelope recipients: To, Cc and Bcc.
+func (msg *Message) Recipients() []string {
+	recipients := make([]string, 0, len(msg.To)+len(msg.Cc)+len(msg.Bcc))
+	recipients = append(recipients, msg.To...)
+	recipients = append(recipients, msg.Cc...)
+	return append(recipients, msg.Bcc...)
+}
+
+// Validate checks that the message has recipients with valid addresses,
+// a subject and a body.
+func (msg *Message) Validate() error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+	for _, address := range msg.Recipients() {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+		}
+	}
+	if strings.TrimSpace(msg.Subject) == "" || (msg.HTML == "" && msg.Text == "") {
+		return ErrEmptyMessage
+	}
+	return nil
+}
+
+// SendMessage sends a Message (or *Message). Providers implementing
+// MessageProvider receive it unchanged; others get it through Send or
+// SendHTML, once per recipient, if it has no attachments, Cc or Bcc.
+// Suppressed recipients are skipped.
+func (mod *Module) SendMessage(ctx context.Context, message any) error {
+	msg, err := toMessage(message)
+	if err != nil {
+		return err
+	}
+	return mod.deliver(ctx, msg, mod.transmit)
+}
+
+// toMessage returns the validated *Message passed to SendMessage or SendAsync.
+func toMessage(message any) (*Message, error) {
+	var msg *Message
+	switch typed := message.(type) {
+	case Message:
+		msg = &typed
+	case *Message:
+		msg = typed
+	default:
+		return nil, ErrInvalidMessage
+	}
+	if msg == nil {
+		return nil, ErrInvalidMessage
+	}
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// transmit hands msg to the provider in the richest form it supports.
+func (mod *Module) transmit(ctx context.Context, provider Provider, msg *Message) error {
+	if messageProvider, ok := provider.(MessageProvider); ok {
+		return messageProvider.SendMessage(ctx, msg)
+	}
+
+	if len(msg.Attachments) > 0 || len(msg.Cc) > 0 || len(msg.Bcc) > 0 {
+		return ErrMessageUnsupported
+	}
+	htmlProvider, supportsHTML := provider.(HTMLProvider)
+	for _, to := range msg.To {
+		var err error
+		switch {
+		case msg.HTML != "" && supportsHTML:
+			err = htmlProvider.SendHTML(ctx, to, msg.Subject, msg.HTML)
+		case msg.Text != "":
+			err = provider.Send(ctx, to, msg.Subject, msg.Text)
+		default:
+			// Fall back to plain text
+			err = provider.Send(ctx, to, msg.Subject, msg.HTML)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MIME encodes the message as a MIME document from the given sender, ready
+// to hand to an SMTP server or a raw-message API. Bcc recipients are not
+// included in the headers.
+func (msg *Message) MIME(from string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writeHeader(&buf, "From", from)
+	writeHeader(&buf, "To", strings.Join(msg.To, ", "))
+	if len(msg.Cc) > 0 {
+		writeHeader(&buf, "Cc", strings.Join(msg.Cc, ", "))
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	bodyHeader, body, err := msg.body()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if value := bodyHeader.Get(name); value != "" {
+				writeHeader(&buf, name, value)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}))
+	buf.WriteString("\r\n")
+
+	part, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, err
+	}
+	for _, attachment := range msg.Attachments {
+		if err := writeAttachment(mixed, attachment); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	// A CR or LF in a value would start a new header
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// body returns the headers and encoded content of the message body: a
+// single text part, or multipart/alternative when both HTML and Text are set.
+func (msg *Message) body() (textproto.MIMEHeader, []byte, error) {
+	var buf bytes.Buffer
+
+	if msg.HTML != "" && msg.Text != "" {
+		alternative := multipart.NewWriter(&buf)
+		if err := writeTextPart(alternative, "text/plain", msg.Text); err != nil {
+			return nil, nil, err
+		}
+		if err := writeTextPart(alternative, "text/html", msg.HTML); err != nil {
+			return nil, nil, err
+		}
+		if err := alternative.Close(); err != nil {
+			return nil, nil, err
+		}
+		header := textproto.MIMEHeader{
+			"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()})},
+		}
+		return header, buf.Bytes(), nil
+	}
+
+	contentType, content := "text/plain", msg.Text
+	if msg.HTML != "" {
+		contentType, content = "text/html", msg.HTML
+	}
+	if err := writeQuotedPrintable(&buf, content); err != nil {
+		return nil, nil, err
+	}
+	return textHeader(contentType), buf.Bytes(), nil
+}
+
+func textHeader(contentType string) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":              {contentType + `; charset="UTF-8"`},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+}
+
+func writeTextPart(writer *multipart.Writer, contentType, content string) error {
+	part, err := writer.CreatePart(textHeader(contentType))
+	if err != nil {
+		return err
+	}
+	return writeQuotedPrintable(part, content)
+}
+
+func writeQuotedPrintable(writer io.Writer, content string) error {
+	encoder := quotedprintable.NewWriter(writer)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func writeAttachment(writer *multipart.Writer, attachment Attachment) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {attachment.contentType()},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+	})
+	if err != nil {
+		return err
+	}
+
+	// RFC 2045 limits encoded lines to 76 characters
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// contentType returns ContentType, or the type implied by the filename.
+func (attachment Attachment) contentType() string {
+	if attachment.ContentType != "" {
+		return attachment.ContentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(attachment.Filename)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,191 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrRateLimited      = chassis.NewError(chassis.CodeResourceExhausted, "email provider rate limit exceeded")
+	ErrUnknownProvider  = chassis.NewError(chassis.CodeInvalidArgument, "unknown email provider")
+	ErrProviderConfig   = chassis.NewError(chassis.CodeInvalidArgument, "email provider is missing required configuration")
+	ErrProviderRejected = chassis.NewError(chassis.CodeFailedPrecondition, "email provider rejected the message")
+	ErrInvalidProvider  = chassis.NewError(chassis.CodeInvalidArgument, "not an email provider")
+)
+
+// TrackedProvider is an optional interface for providers that return the
+// ID they assigned to a message, e.g. to match delivery webhooks. The ID is
+// reported in SendEvent.MessageID.
+type TrackedProvider interface {
+	Provider
+	SendTracked(ctx context.Context, msg *Message) (messageID string, err error)
+}
+
+// APIError is a failed request to an email provider's HTTP API. It wraps
+// ErrRateLimited for 429 responses and ErrTransient for 5xx responses, so
+// SendAsync retries them; RetryAfter is taken from the Retry-After header.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: HTTP %d", e.Provider, e.StatusCode)
+	}
+	return fmt.Sprintf("%s: HTTP %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Unwrap returns the sentinel error for the status code.
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrTransient
+	default:
+		return ErrProviderRejected
+	}
+}
+
+// maxErrorBytes is how much of an error response body is read.
+const maxErrorBytes = 64 << 10
+
+// doAPIRequest sends an API request and decodes a successful JSON response
+// into out, if non-nil. Failed responses become an *APIError whose message
+// is extracted by errorMessage.
+func doAPIRequest(client *http.Client, provider string, request *http.Request, out any, errorMessage func([]byte) string) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", provider, err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBytes))
+		apiErr := &APIError{
+			Provider:   provider,
+			StatusCode: response.StatusCode,
+			Message:    errorMessage(body),
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+		return nil, apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: failed to decode response: %w", provider, err)
+		}
+	}
+	return response, nil
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// jsonErrorMessage extracts a "message" field from a JSON error body, or
+// returns the body itself.
+func jsonErrorMessage(body []byte) string {
+	var parsed struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Message != "" {
+		return parsed.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// configOrEnv returns the config value at path, or the environment variable
+// when it is unset.
+func configOrEnv(cfg chassis.ConfigData, path, envVar string) string {
+	if value := cfg.GetString(path); value != "" {
+		return value
+	}
+	return os.Getenv(envVar)
+}
+
+// providerFromConfig builds the provider named by email.provider. API keys
+// are read from the provider's config section, falling back to the usual
+// environment variables.
+func (mod *Module) providerFromConfig(cfg chassis.ConfigData, name string) (Provider, error) {
+	from := mod.smtpConfig.From
+	switch name {
+	case "", "smtp":
+		if _, err := parseTLSMode(string(mod.smtpConfig.TLS)); err != nil {
+			return nil, err
+		}
+		return NewSMTPProvider(mod.smtpConfig), nil
+	case "sendgrid":
+		config := SendGridConfig{
+			APIKey:  configOrEnv(cfg, "email.sendgrid.api_key", "SENDGRID_API_KEY"),
+			From:    from,
+			BaseURL: cfg.GetString("email.sendgrid.base_url"),
+		}
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("%w: sendgrid needs an API key", ErrProviderConfig)
+		}
+		return NewSendGridProvider(config), nil
+	case "mailgun":
+		config := MailgunConfig{
+			APIKey:  configOrEnv(cfg, "email.mailgun.api_key", "MAILGUN_API_KEY"),
+			Domain:  configOrEnv(cfg, "email.mailgun.domain", "MAILGUN_DOMAIN"),
+			From:    from,
+			BaseURL: cfg.GetString("email.mailgun.base_url"),
+		}
+		if config.APIKey == "" || config.Domain == "" {
+			return nil, fmt.Errorf("%w: mailgun needs an API key and domain", ErrProviderConfig)
+		}
+		return NewMailgunProvider(config), nil
+	case "ses":
+		config := SESConfig{
+			Region:          configOrEnv(cfg, "email.ses.region", "AWS_REGION"),
+			AccessKeyID:     configOrEnv(cfg, "email.ses.access_key_id", "AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: configOrEnv(cfg, "email.ses.secret_access_key", "AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    configOrEnv(cfg, "email.ses.session_token", "AWS_SESSION_TOKEN"),
+			From:            from,
+			Endpoint:        cfg.GetString("email.ses.endpoint"),
+		}
+		if config.Region == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+			return nil, fmt.Errorf("%w: ses needs a region and AWS credentials", ErrProviderConfig)
+		}
+		return NewSESProvider(config), nil
+	case "devinbox":
+		config := DevInboxConfig{From: from}
+		if dbPath := cfg.GetString("email.devinbox.db_path"); dbPath != "" {
+			store, err := NewSQLiteInboxStore(dbPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create dev inbox store: %w", err)
+			}
+			config.Store = store
+		}
+		return NewDevInboxProvider(config), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+}
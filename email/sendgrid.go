@@ -0,0 +1,149 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultSendGridURL is the SendGrid v3 API base URL.
+const DefaultSendGridURL = "https://api.sendgrid.com"
+
+// SendGridConfig holds SendGrid API configuration.
+type SendGridConfig struct {
+	APIKey  string
+	From    string
+	BaseURL string       // defaults to DefaultSendGridURL
+	Client  *http.Client // defaults to http.DefaultClient
+}
+
+// SendGridProvider sends emails through the SendGrid v3 mail send API.
+type SendGridProvider struct {
+	config SendGridConfig
+}
+
+// NewSendGridProvider creates a new SendGrid email provider.
+func NewSendGridProvider(config SendGridConfig) *SendGridProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultSendGridURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &SendGridProvider{config: config}
+}
+
+func (provider *SendGridProvider) Send(ctx context.Context, to, subject, body string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, Text: body})
+}
+
+func (provider *SendGridProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, HTML: htmlBody})
+}
+
+func (provider *SendGridProvider) SendMessage(ctx context.Context, msg *Message) error {
+	_, err := provider.SendTracked(ctx, msg)
+	return err
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	Cc  []sendGridAddress `json:"cc,omitempty"`
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type"`
+	Disposition string `json:"disposition"`
+}
+
+// SendTracked sends msg and returns SendGrid's X-Message-Id.
+func (provider *SendGridProvider) SendTracked(ctx context.Context, msg *Message) (string, error) {
+	payload := sendGridRequest{
+		Personalizations: []sendGridPersonalization{{
+			To:  sendGridAddresses(msg.To),
+			Cc:  sendGridAddresses(msg.Cc),
+			Bcc: sendGridAddresses(msg.Bcc),
+		}},
+		From:    sendGridAddress{Email: provider.config.From},
+		Subject: msg.Subject,
+	}
+	// SendGrid requires text/plain before text/html
+	if msg.Text != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/plain", Value: msg.Text})
+	}
+	if msg.HTML != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+	for _, attachment := range msg.Attachments {
+		payload.Attachments = append(payload.Attachments, sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(attachment.Data),
+			Filename:    attachment.Filename,
+			Type:        attachment.contentType(),
+			Disposition: "attachment",
+		})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sendgrid request: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.config.BaseURL+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+provider.config.APIKey)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := doAPIRequest(provider.config.Client, "sendgrid", request, nil, sendGridErrorMessage)
+	if err != nil {
+		return "", err
+	}
+	return response.Header.Get("X-Message-Id"), nil
+}
+
+func sendGridAddresses(addresses []string) []sendGridAddress {
+	var converted []sendGridAddress
+	for _, address := range addresses {
+		converted = append(converted, sendGridAddress{Email: address})
+	}
+	return converted
+}
+
+// sendGridErrorMessage joins the messages of a SendGrid error response.
+func sendGridErrorMessage(body []byte) string {
+	var parsed struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &parsed) != nil || len(parsed.Errors) == 0 {
+		return jsonErrorMessage(body)
+	}
+	messages := make([]string, len(parsed.Errors))
+	for i, apiErr := range parsed.Errors {
+		messages[i] = apiErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,153 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SESConfig holds Amazon SES configuration.
+type SESConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // for temporary credentials
+	From            string
+	Endpoint        string       // defaults to https://email.<region>.amazonaws.com
+	Client          *http.Client // defaults to http.DefaultClient
+}
+
+// SESProvider sends emails through the Amazon SES v2 API. Messages are sent
+// as raw MIME, so Cc, Bcc and attachments are supported.
+type SESProvider struct {
+	config SESConfig
+	now    func() time.Time
+}
+
+// NewSESProvider creates a new Amazon SES email provider.
+func NewSESProvider(config SESConfig) *SESProvider {
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://email.%s.amazonaws.com", config.Region)
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	return &SESProvider{config: config, now: time.Now}
+}
+
+func (provider *SESProvider) Send(ctx context.Context, to, subject, body string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, Text: body})
+}
+
+func (provider *SESProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, HTML: htmlBody})
+}
+
+func (provider *SESProvider) SendMessage(ctx context.Context, msg *Message) error {
+	_, err := provider.SendTracked(ctx, msg)
+	return err
+}
+
+// SendTracked sends msg and returns the SES message ID.
+func (provider *SESProvider) SendTracked(ctx context.Context, msg *Message) (string, error) {
+	data, err := msg.MIME(provider.config.From)
+	if err != nil {
+		return "", err
+	}
+
+	payload := map[string]any{
+		"FromEmailAddress": provider.config.From,
+		"Destination": map[string][]string{
+			"ToAddresses":  msg.To,
+			"CcAddresses":  msg.Cc,
+			"BccAddresses": msg.Bcc,
+		},
+		// []byte marshals as base64, as SES expects
+		"Content": map[string]any{"Raw": map[string][]byte{"Data": data}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ses request: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.config.Endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	provider.sign(request, body)
+
+	var result struct {
+		MessageID string `json:"MessageId"`
+	}
+	if _, err := doAPIRequest(provider.config.Client, "ses", request, &result, jsonErrorMessage); err != nil {
+		return "", err
+	}
+	return result.MessageID, nil
+}
+
+// sign adds AWS Signature Version 4 headers to request.
+func (provider *SESProvider) sign(request *http.Request, body []byte) {
+	now := provider.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if provider.config.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", provider.config.SessionToken)
+	}
+
+	names := make([]string, 0, len(request.Header))
+	for name := range request.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(request.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + provider.config.Region + "/ses/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+provider.config.SecretAccessKey), date)
+	for _, part := range []string{provider.config.Region, "ses", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		provider.config.AccessKeyID, scope, signedHeaders, signature))
+	// net/http sends Host from request.Host
+	request.Header.Del("Host")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
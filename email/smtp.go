@@ -0,0 +1,344 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrStartTLSUnsupported = chassis.NewError(chassis.CodeFailedPrecondition, "SMTP server does not support STARTTLS")
+
+// TLSMode selects how an SMTPProvider encrypts its connections.
+type TLSMode string
+
+const (
+	// TLSOpportunistic upgrades with STARTTLS when the server offers it,
+	// like smtp.SendMail. It is the default.
+	TLSOpportunistic TLSMode = "opportunistic"
+	// TLSStartTLS requires STARTTLS and fails with ErrStartTLSUnsupported
+	// when the server doesn't offer it. Use it for port 587.
+	TLSStartTLS TLSMode = "starttls"
+	// TLSImplicit connects with TLS from the start. Use it for port 465.
+	TLSImplicit TLSMode = "tls"
+	// TLSNone never encrypts. Only for local relays and test servers.
+	TLSNone TLSMode = "none"
+)
+
+// Defaults for SMTPConfig's zero values.
+const (
+	DefaultSMTPDialTimeout = 10 * time.Second
+	DefaultSMTPSendTimeout = 30 * time.Second
+	DefaultSMTPPoolSize    = 2
+	DefaultSMTPIdleTimeout = 30 * time.Second
+)
+
+// SMTPConfig holds SMTP server configuration.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	TLS       TLSMode     // defaults to TLSOpportunistic
+	TLSConfig *tls.Config // optional; ServerName defaults to Host
+
+	DialTimeout time.Duration // connecting, TLS and authentication
+	SendTimeout time.Duration // each message, including reconnecting
+	PoolSize    int           // idle connections kept for reuse; negative disables reuse
+	IdleTimeout time.Duration // idle connections older than this are closed
+}
+
+func (config SMTPConfig) dialTimeout() time.Duration {
+	if config.DialTimeout > 0 {
+		return config.DialTimeout
+	}
+	return DefaultSMTPDialTimeout
+}
+
+func (config SMTPConfig) sendTimeout() time.Duration {
+	if config.SendTimeout > 0 {
+		return config.SendTimeout
+	}
+	return DefaultSMTPSendTimeout
+}
+
+func (config SMTPConfig) poolSize() int {
+	if config.PoolSize == 0 {
+		return DefaultSMTPPoolSize
+	}
+	return max(config.PoolSize, 0)
+}
+
+func (config SMTPConfig) idleTimeout() time.Duration {
+	if config.IdleTimeout > 0 {
+		return config.IdleTimeout
+	}
+	return DefaultSMTPIdleTimeout
+}
+
+func (config SMTPConfig) tlsConfig() *tls.Config {
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = config.Host
+	}
+	return tlsConfig
+}
+
+// parseTLSMode validates a TLS mode from config.
+func parseTLSMode(value string) (TLSMode, error) {
+	switch mode := TLSMode(value); mode {
+	case "", TLSOpportunistic, TLSStartTLS, TLSImplicit, TLSNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: unknown smtp_tls mode %q", ErrProviderConfig, value)
+	}
+}
+
+// SMTPProvider sends emails via SMTP. Connections are reused between
+// messages (reset with RSET) until they have been idle for IdleTimeout;
+// Close closes the idle ones.
+type SMTPProvider struct {
+	config SMTPConfig
+
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+}
+
+// smtpConn is an authenticated connection ready for the next message.
+type smtpConn struct {
+	conn      net.Conn
+	client    *smtp.Client
+	idleSince time.Time
+}
+
+// NewSMTPProvider creates a new SMTP email provider.
+func NewSMTPProvider(config SMTPConfig) *SMTPProvider {
+	return &SMTPProvider{config: config}
+}
+
+func (provider *SMTPProvider) Send(ctx context.Context, to, subject, body string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, Text: body})
+}
+
+func (provider *SMTPProvider) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
+	return provider.SendMessage(ctx, &Message{To: []string{to}, Subject: subject, HTML: htmlBody})
+}
+
+// SendMessage sends msg as a MIME message to all of its To, Cc and Bcc
+// recipients. The send is bounded by SendTimeout and aborted when ctx is
+// done.
+func (provider *SMTPProvider) SendMessage(ctx context.Context, msg *Message) error {
+	from := provider.config.From
+	if from == "" {
+		from = provider.config.Username
+	}
+
+	data, err := msg.MIME(from)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, provider.config.sendTimeout())
+	defer cancel()
+
+	conn, err := provider.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = conn.send(ctx, from, msg.Recipients(), data)
+	if err == nil || isSMTPReply(err) {
+		// The server answered, so the connection is still in sync
+		provider.put(conn)
+	} else {
+		conn.close()
+	}
+	return err
+}
+
+// Close closes the idle connections. Later sends open new ones.
+func (provider *SMTPProvider) Close() error {
+	provider.mu.Lock()
+	idle := provider.idle
+	provider.idle = nil
+	provider.closed = true
+	provider.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.quit()
+	}
+	return nil
+}
+
+// get returns a pooled connection that still answers RSET, or dials a new one.
+func (provider *SMTPProvider) get(ctx context.Context) (*smtpConn, error) {
+	for {
+		provider.mu.Lock()
+		if len(provider.idle) == 0 {
+			provider.mu.Unlock()
+			return provider.dial(ctx)
+		}
+		conn := provider.idle[len(provider.idle)-1]
+		provider.idle = provider.idle[:len(provider.idle)-1]
+		provider.mu.Unlock()
+
+		if time.Since(conn.idleSince) > provider.config.idleTimeout() {
+			conn.quit()
+			continue
+		}
+		if err := conn.watch(ctx, func() error { return conn.client.Reset() }); err != nil {
+			conn.close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// put returns conn to the pool, or closes it when the pool is full.
+func (provider *SMTPProvider) put(conn *smtpConn) {
+	provider.mu.Lock()
+	if !provider.closed && len(provider.idle) < provider.config.poolSize() {
+		conn.idleSince = time.Now()
+		provider.idle = append(provider.idle, conn)
+		provider.mu.Unlock()
+		return
+	}
+	provider.mu.Unlock()
+	conn.quit()
+}
+
+// dial connects, negotiates TLS and authenticates.
+func (provider *SMTPProvider) dial(ctx context.Context) (*smtpConn, error) {
+	config := provider.config
+	mode, err := parseTLSMode(string(config.TLS))
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, config.dialTimeout())
+	defer cancel()
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	dialer := &net.Dialer{}
+	var netConn net.Conn
+	if mode == TLSImplicit {
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: config.tlsConfig()}).DialContext(dialCtx, "tcp", addr)
+	} else {
+		netConn, err = dialer.DialContext(dialCtx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smtp: failed to connect to %s: %w", addr, err)
+	}
+
+	conn := &smtpConn{conn: netConn}
+	err = conn.watch(dialCtx, func() error {
+		client, err := smtp.NewClient(netConn, config.Host)
+		if err != nil {
+			return err
+		}
+		conn.client = client
+
+		if mode == TLSOpportunistic || mode == TLSStartTLS || mode == "" {
+			supported, _ := client.Extension("STARTTLS")
+			if supported {
+				if err := client.StartTLS(config.tlsConfig()); err != nil {
+					return fmt.Errorf("smtp: STARTTLS failed: %w", err)
+				}
+			} else if mode == TLSStartTLS {
+				return ErrStartTLSUnsupported
+			}
+		}
+
+		if config.Username != "" {
+			if supported, _ := client.Extension("AUTH"); !supported {
+				return errors.New("smtp: server doesn't support AUTH")
+			}
+			auth := smtp.PlainAuth("", config.Username, config.Password, config.Host)
+			if err := client.Auth(auth); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// send runs one mail transaction.
+func (conn *smtpConn) send(ctx context.Context, from string, recipients []string, data []byte) error {
+	return conn.watch(ctx, func() error {
+		if err := conn.client.Mail(from); err != nil {
+			return err
+		}
+		for _, recipient := range recipients {
+			if err := conn.client.Rcpt(recipient); err != nil {
+				return err
+			}
+		}
+		writer, err := conn.client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+}
+
+// watch runs fn, aborting its I/O when ctx is done.
+func (conn *smtpConn) watch(ctx context.Context, fn func() error) error {
+	_ = conn.conn.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.conn.SetDeadline(time.Unix(1, 0))
+	})
+	err := fn()
+	stop()
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("smtp: %w", ctx.Err())
+	}
+	return err
+}
+
+// quit ends the session politely, then closes the connection.
+func (conn *smtpConn) quit() {
+	_ = conn.conn.SetDeadline(time.Now().Add(time.Second))
+	if conn.client != nil {
+		_ = conn.client.Quit()
+	}
+	conn.close()
+}
+
+func (conn *smtpConn) close() {
+	if conn.client != nil {
+		_ = conn.client.Close()
+		return
+	}
+	_ = conn.conn.Close()
+}
+
+// isSMTPReply reports whether err is the server's reply rather than an
+// I/O failure.
+func isSMTPReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply)
+}
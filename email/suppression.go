@@ -0,0 +1,314 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/internal/sqlite"
+	"github.com/talosaether/chassis/pagination"
+)
+
+var (
+	ErrSuppressed          = chassis.NewError(chassis.CodeFailedPrecondition, "email address is on the suppression list")
+	ErrSuppressionNotFound = chassis.NewError(chassis.CodeNotFound, "email address is not suppressed")
+)
+
+// Suppression is an address that emails are no longer sent to, usually
+// because it hard bounced.
+type Suppression struct {
+	Address   string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// SuppressionStore persists the suppression list. Addresses are stored
+// normalized (trimmed and lowercased).
+type SuppressionStore interface {
+	Add(ctx context.Context, suppression *Suppression) error
+	Get(ctx context.Context, address string) (*Suppression, error)
+	Remove(ctx context.Context, address string) error
+	List(ctx context.Context, offset, limit int) ([]*Suppression, error)
+	Count(ctx context.Context) (int, error)
+	Close() error
+}
+
+// normalizeAddress is the form addresses are suppressed and looked up in.
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// Suppress adds an address to the suppression list. Sends to it fail with
+// ErrSuppressed until it is removed with Unsuppress.
+func (mod *Module) Suppress(ctx context.Context, address, reason string) error {
+	return mod.suppressions.Add(ctx, &Suppression{
+		Address:   normalizeAddress(address),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+}
+
+// Unsuppress removes an address from the suppression list.
+func (mod *Module) Unsuppress(ctx context.Context, address string) error {
+	return mod.suppressions.Remove(ctx, normalizeAddress(address))
+}
+
+// IsSuppressed reports whether an address is on the suppression list.
+func (mod *Module) IsSuppressed(ctx context.Context, address string) (bool, error) {
+	_, err := mod.suppressions.Get(ctx, normalizeAddress(address))
+	if errors.Is(err, ErrSuppressionNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ListSuppressions returns a page of the suppression list, newest first.
+func (mod *Module) ListSuppressions(ctx context.Context, req pagination.Request) (*pagination.Result[*Suppression], error) {
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	suppressions, err := mod.suppressions.List(ctx, offset, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := mod.suppressions.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(suppressions, req, offset, total), nil
+}
+
+// withoutSuppressed returns msg without its suppressed recipients, or
+// ErrSuppressed if none of its To recipients remain.
+func (mod *Module) withoutSuppressed(ctx context.Context, msg *Message) (*Message, error) {
+	filter := func(addresses []string) ([]string, error) {
+		var kept []string
+		for _, address := range addresses {
+			suppressed, err := mod.IsSuppressed(ctx, address)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check suppression list: %w", err)
+			}
+			if !suppressed {
+				kept = append(kept, address)
+			}
+		}
+		return kept, nil
+	}
+
+	filtered := *msg
+	var err error
+	if filtered.To, err = filter(msg.To); err != nil {
+		return nil, err
+	}
+	if len(filtered.To) == 0 {
+		return nil, ErrSuppressed
+	}
+	if filtered.Cc, err = filter(msg.Cc); err != nil {
+		return nil, err
+	}
+	if filtered.Bcc, err = filter(msg.Bcc); err != nil {
+		return nil, err
+	}
+	return &filtered, nil
+}
+
+// MemorySuppressionStore keeps the suppression list in memory. It is the
+// default when no database path is configured; the list is lost on restart.
+type MemorySuppressionStore struct {
+	mu           sync.RWMutex
+	suppressions map[string]*Suppression
+}
+
+// NewMemorySuppressionStore creates an empty in-memory suppression store.
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{suppressions: make(map[string]*Suppression)}
+}
+
+func (store *MemorySuppressionStore) Add(ctx context.Context, suppression *Suppression) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	copied := *suppression
+	store.suppressions[suppression.Address] = &copied
+	return nil
+}
+
+func (store *MemorySuppressionStore) Get(ctx context.Context, address string) (*Suppression, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	suppression, ok := store.suppressions[address]
+	if !ok {
+		return nil, ErrSuppressionNotFound
+	}
+	copied := *suppression
+	return &copied, nil
+}
+
+func (store *MemorySuppressionStore) Remove(ctx context.Context, address string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.suppressions[address]; !ok {
+		return ErrSuppressionNotFound
+	}
+	delete(store.suppressions, address)
+	return nil
+}
+
+func (store *MemorySuppressionStore) List(ctx context.Context, offset, limit int) ([]*Suppression, error) {
+	store.mu.RLock()
+	all := make([]*Suppression, 0, len(store.suppressions))
+	for _, suppression := range store.suppressions {
+		copied := *suppression
+		all = append(all, &copied)
+	}
+	store.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].Address < all[j].Address
+		}
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+	start := min(offset, len(all))
+	end := min(start+limit, len(all))
+	return all[start:end], nil
+}
+
+func (store *MemorySuppressionStore) Count(ctx context.Context) (int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return len(store.suppressions), nil
+}
+
+func (store *MemorySuppressionStore) Close() error {
+	return nil
+}
+
+// SQLiteSuppressionStore implements SuppressionStore using SQLite.
+type SQLiteSuppressionStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteSuppressionStore creates a new SQLite-backed suppression store.
+func NewSQLiteSuppressionStore(dbPath string) (*SQLiteSuppressionStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLiteSuppressionStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteSuppressionStoreFromDB creates a suppression store on a database
+// the caller owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteSuppressionStoreFromDB(db *sql.DB) (*SQLiteSuppressionStore, error) {
+	if err := initSuppressionSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteSuppressionStore{db: db}, nil
+}
+
+func initSuppressionSchema(db *sql.DB) error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS email_suppressions (
+			address TEXT PRIMARY KEY,
+			reason TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func (store *SQLiteSuppressionStore) Add(ctx context.Context, suppression *Suppression) error {
+	query := `INSERT INTO email_suppressions (address, reason, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(address) DO UPDATE SET reason = excluded.reason`
+	_, err := store.db.ExecContext(ctx, query, suppression.Address, suppression.Reason, suppression.CreatedAt)
+	return err
+}
+
+func (store *SQLiteSuppressionStore) Get(ctx context.Context, address string) (*Suppression, error) {
+	query := `SELECT address, reason, created_at FROM email_suppressions WHERE address = ?`
+	var suppression Suppression
+	err := store.db.QueryRowContext(ctx, query, address).Scan(&suppression.Address, &suppression.Reason, &suppression.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSuppressionNotFound
+		}
+		return nil, err
+	}
+	return &suppression, nil
+}
+
+func (store *SQLiteSuppressionStore) Remove(ctx context.Context, address string) error {
+	result, err := store.db.ExecContext(ctx, `DELETE FROM email_suppressions WHERE address = ?`, address)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSuppressionNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteSuppressionStore) List(ctx context.Context, offset, limit int) ([]*Suppression, error) {
+	query := `SELECT address, reason, created_at FROM email_suppressions
+		ORDER BY created_at DESC, address LIMIT ? OFFSET ?`
+	rows, err := store.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	suppressions := make([]*Suppression, 0)
+	for rows.Next() {
+		suppression := &Suppression{}
+		if err := rows.Scan(&suppression.Address, &suppression.Reason, &suppression.CreatedAt); err != nil {
+			return nil, err
+		}
+		suppressions = append(suppressions, suppression)
+	}
+	return suppressions, rows.Err()
+}
+
+func (store *SQLiteSuppressionStore) Count(ctx context.Context) (int, error) {
+	var count int
+	err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_suppressions`).Scan(&count)
+	return count, err
+}
+
+func (store *SQLiteSuppressionStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteSuppressionStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteSuppressionStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
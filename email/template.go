@@ -0,0 +1,433 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrTemplateNotFound = chassis.NewError(chassis.CodeNotFound, "email template not found")
+	ErrLayoutNotFound   = chassis.NewError(chassis.CodeNotFound, "email layout not found")
+	ErrTemplateEmpty    = chassis.NewError(chassis.CodeInvalidArgument, "email template needs a subject and an HTML or text body")
+)
+
+// DefaultLayout is the layout used by templates that don't name one.
+// Templates render without a layout if no layout with this name is registered.
+const DefaultLayout = "default"
+
+// NoLayout opts a template out of the default layout.
+const NoLayout = "none"
+
+// Template is a named email template. Subject and Text use text/template
+// syntax; HTML uses html/template, so data is escaped for HTML.
+type Template struct {
+	Subject string
+	HTML    string
+	Text    string
+
+	// Layout names the layout to wrap the body in. Empty uses DefaultLayout.
+	Layout string
+}
+
+// Layout wraps template bodies. It renders the body with {{template "content" .}}.
+type Layout struct {
+	HTML string
+	Text string
+}
+
+// Branding holds per-org variables available to templates as .Brand,
+// e.g. {{.Brand.product_name}} or {{.Brand.logo_url}}.
+type Branding map[string]string
+
+// BrandingFunc looks up the branding of an org. It is called for each
+// templated email sent on behalf of an org; keys it returns override the
+// default branding.
+type BrandingFunc func(ctx context.Context, orgID string) (Branding, error)
+
+// TemplateData is the value templates are executed with.
+type TemplateData struct {
+	// Data is the value passed to SendTemplate or Render.
+	Data any
+
+	// Brand is the default branding merged with the org's branding.
+	Brand Branding
+
+	// To is the recipient address.
+	To string
+
+	// Locale is the locale the template is rendered in, if a Localizer
+	// is set (see the i18n module).
+	Locale string
+}
+
+// Rendered is a rendered email template.
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type orgIDKey struct{}
+
+// WithOrgID returns a context whose templated emails use the org's branding.
+func WithOrgID(ctx context.Context, orgID string) context.Context {
+	return context.WithValue(ctx, orgIDKey{}, orgID)
+}
+
+// OrgIDFromContext returns the org set with WithOrgID.
+func OrgIDFromContext(ctx context.Context) string {
+	orgID, _ := ctx.Value(orgIDKey{}).(string)
+	return orgID
+}
+
+// WithTemplates loads templates from fsys at Init. See LoadTemplates for the layout.
+func WithTemplates(fsys fs.FS) Option {
+	return func(mod *Module) {
+		mod.templateFS = append(mod.templateFS, fsys)
+	}
+}
+
+// WithBranding sets the default branding used by all templates.
+func WithBranding(branding Branding) Option {
+	return func(mod *Module) {
+		for key, value := range branding {
+			mod.branding[key] = value
+		}
+	}
+}
+
+// WithBrandingFunc sets how per-org branding is looked up.
+func WithBrandingFunc(fn BrandingFunc) Option {
+	return func(mod *Module) {
+		mod.brandingFunc = fn
+	}
+}
+
+// RegisterTemplate adds or replaces a named template.
+func (mod *Module) RegisterTemplate(name string, tmpl Template) error {
+	if strings.TrimSpace(tmpl.Subject) == "" || (tmpl.HTML == "" && tmpl.Text == "") {
+		return fmt.Errorf("template %q: %w", name, ErrTemplateEmpty)
+	}
+	// Parse now so syntax errors surface at registration, not at send time
+	funcs := templateFuncs(translateFunc(nil, ""))
+	if _, err := texttemplate.New("subject").Funcs(funcs).Parse(tmpl.Subject); err != nil {
+		return fmt.Errorf("template %q subject: %w", name, err)
+	}
+	if _, err := htmltemplate.New("content").Funcs(funcs).Parse(tmpl.HTML); err != nil {
+		return fmt.Errorf("template %q html: %w", name, err)
+	}
+	if _, err := texttemplate.New("content").Funcs(funcs).Parse(tmpl.Text); err != nil {
+		return fmt.Errorf("template %q text: %w", name, err)
+	}
+
+	mod.templatesMu.Lock()
+	defer mod.templatesMu.Unlock()
+	mod.templates[name] = tmpl
+	return nil
+}
+
+// RegisterLayout adds or replaces a named layout.
+func (mod *Module) RegisterLayout(name string, layout Layout) error {
+	funcs := templateFuncs(translateFunc(nil, ""))
+	if _, err := htmltemplate.New("layout").Funcs(funcs).Parse(layout.HTML); err != nil {
+		return fmt.Errorf("layout %q html: %w", name, err)
+	}
+	if _, err := texttemplate.New("layout").Funcs(funcs).Parse(layout.Text); err != nil {
+		return fmt.Errorf("layout %q text: %w", name, err)
+	}
+
+	mod.templatesMu.Lock()
+	defer mod.templatesMu.Unlock()
+	mod.layouts[name] = layout
+	return nil
+}
+
+// SetBranding sets the branding of an org, overriding the default branding.
+// Keys from a BrandingFunc take precedence over these.
+func (mod *Module) SetBranding(orgID string, branding Branding) {
+	mod.templatesMu.Lock()
+	defer mod.templatesMu.Unlock()
+	mod.orgBranding[orgID] = branding
+}
+
+// LoadTemplates registers every template and layout in fsys (e.g., an
+// embed.FS). Files are named by template and part:
+//
+//	welcome.subject.tmpl        subject line (required)
+//	welcome.html.tmpl           HTML body
+//	welcome.txt.tmpl            plain text body
+//	auth/reset.subject.tmpl     templates may live in directories ("auth/reset")
+//	layouts/default.html.tmpl   layouts live under layouts/
+//	layouts/default.txt.tmpl
+//
+// Other files are ignored.
+func (mod *Module) LoadTemplates(fsys fs.FS) error {
+	files := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return err
+		}
+		files[filePath] = string(content)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read templates: %w", err)
+	}
+	return mod.loadTemplateFiles(files)
+}
+
+// LoadTemplatesFromStorage registers the templates stored under prefix in the
+// storage module, using the same file names as LoadTemplates. This lets
+// templates be edited without redeploying.
+func (mod *Module) LoadTemplatesFromStorage(ctx context.Context, prefix string) error {
+	store, ok := mod.app.TryStorage()
+	if !ok {
+		return fmt.Errorf("loading templates from storage requires the storage module")
+	}
+
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+	files := make(map[string]string, len(keys))
+	for _, key := range keys {
+		content, err := store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to read template %q: %w", key, err)
+		}
+		files[strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")] = string(content)
+	}
+	return mod.loadTemplateFiles(files)
+}
+
+// templateParts maps file suffixes to the template part they hold.
+var templateParts = []string{".subject.tmpl", ".html.tmpl", ".txt.tmpl"}
+
+func (mod *Module) loadTemplateFiles(files map[string]string) error {
+	templates := make(map[string]*Template)
+	layouts := make(map[string]*Layout)
+
+	for filePath, content := range files {
+		for _, suffix := range templateParts {
+			if !strings.HasSuffix(filePath, suffix) {
+				continue
+			}
+			name := strings.TrimSuffix(filePath, suffix)
+
+			if dir, layoutName := path.Split(name); dir == "layouts/" {
+				layout := layouts[layoutName]
+				if layout == nil {
+					layout = &Layout{}
+					layouts[layoutName] = layout
+				}
+				switch suffix {
+				case ".html.tmpl":
+					layout.HTML = content
+				case ".txt.tmpl":
+					layout.Text = content
+				}
+				break
+			}
+
+			tmpl := templates[name]
+			if tmpl == nil {
+				tmpl = &Template{}
+				templates[name] = tmpl
+			}
+			switch suffix {
+			case ".subject.tmpl":
+				tmpl.Subject = content
+			case ".html.tmpl":
+				tmpl.HTML = content
+			case ".txt.tmpl":
+				tmpl.Text = content
+			}
+			break
+		}
+	}
+
+	for name, layout := range layouts {
+		if err := mod.RegisterLayout(name, *layout); err != nil {
+			return err
+		}
+	}
+	for name, tmpl := range templates {
+		if err := mod.RegisterTemplate(name, *tmpl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render renders a template for a recipient without sending it. The org set
+// with WithOrgID selects the branding. With a Localizer, the template is
+// rendered in the recipient's locale (or the one set with WithLocale),
+// using the "<name>.<locale>" template if one is registered.
+func (mod *Module) Render(ctx context.Context, to, name string, data any) (*Rendered, error) {
+	localizer := mod.localizerFor()
+	locale := recipientLocale(ctx, localizer, to)
+
+	mod.templatesMu.RLock()
+	tmpl, ok := mod.templates[mod.localizedName(name, locale)]
+	layoutName := tmpl.Layout
+	if layoutName == "" {
+		layoutName = DefaultLayout
+	}
+	layout, hasLayout := mod.layouts[layoutName]
+	mod.templatesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if !hasLayout && tmpl.Layout != "" && tmpl.Layout != NoLayout {
+		return nil, fmt.Errorf("%w: %s", ErrLayoutNotFound, tmpl.Layout)
+	}
+	if layoutName == NoLayout {
+		hasLayout = false
+	}
+
+	brand, err := mod.brandingFor(ctx, OrgIDFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	root := TemplateData{Data: data, Brand: brand, To: to, Locale: locale}
+	funcs := templateFuncs(translateFunc(localizer, locale))
+
+	rendered := &Rendered{}
+	subject, err := executeText("subject", "", tmpl.Subject, root, funcs)
+	if err != nil {
+		return nil, fmt.Errorf("template %q subject: %w", name, err)
+	}
+	// Subjects become a header; a newline in data must not start a new one
+	rendered.Subject = strings.Join(strings.Fields(subject), " ")
+
+	if tmpl.HTML != "" {
+		layoutHTML := ""
+		if hasLayout {
+			layoutHTML = layout.HTML
+		}
+		if rendered.HTML, err = executeHTML(layoutHTML, tmpl.HTML, root, funcs); err != nil {
+			return nil, fmt.Errorf("template %q html: %w", name, err)
+		}
+	}
+	if tmpl.Text != "" {
+		layoutText := ""
+		if hasLayout {
+			layoutText = layout.Text
+		}
+		if rendered.Text, err = executeText("content", layoutText, tmpl.Text, root, funcs); err != nil {
+			return nil, fmt.Errorf("template %q text: %w", name, err)
+		}
+	}
+	return rendered, nil
+}
+
+// SendTemplate renders a named template and sends it. A MessageProvider
+// receives both bodies; otherwise HTML is sent when the template has an HTML
+// body and the provider supports it, and the text body is sent if not.
+func (mod *Module) SendTemplate(ctx context.Context, to, name string, data any) error {
+	rendered, err := mod.Render(ctx, to, name, data)
+	if err != nil {
+		return err
+	}
+
+	return mod.deliver(ctx, &Message{
+		To:      []string{to},
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	}, mod.transmit)
+}
+
+// brandingFor merges the default branding with the org's branding.
+func (mod *Module) brandingFor(ctx context.Context, orgID string) (Branding, error) {
+	brand := make(Branding)
+
+	mod.templatesMu.RLock()
+	for key, value := range mod.branding {
+		brand[key] = value
+	}
+	if orgID != "" {
+		for key, value := range mod.orgBranding[orgID] {
+			brand[key] = value
+		}
+	}
+	mod.templatesMu.RUnlock()
+
+	if orgID != "" && mod.brandingFunc != nil {
+		orgBrand, err := mod.brandingFunc(ctx, orgID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load branding for org %q: %w", orgID, err)
+		}
+		for key, value := range orgBrand {
+			brand[key] = value
+		}
+	}
+	return brand, nil
+}
+
+// templateFuncs returns the functions available to templates: t translates
+// a key into the template's locale.
+func templateFuncs(translate func(key string, args ...any) string) map[string]any {
+	return map[string]any{"t": translate}
+}
+
+// executeHTML renders body, wrapped in layout if one is given.
+func executeHTML(layout, body string, data TemplateData, funcs map[string]any) (string, error) {
+	root := htmltemplate.New("content").Option("missingkey=zero").Funcs(funcs)
+	entry := "content"
+	if layout != "" {
+		root = htmltemplate.New("layout").Option("missingkey=zero").Funcs(funcs)
+		if _, err := root.Parse(layout); err != nil {
+			return "", err
+		}
+		if _, err := root.New("content").Parse(body); err != nil {
+			return "", err
+		}
+		entry = "layout"
+	} else if _, err := root.Parse(body); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := root.ExecuteTemplate(&buf, entry, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// executeText renders body as a text template, wrapped in layout if one is given.
+func executeText(name, layout, body string, data TemplateData, funcs map[string]any) (string, error) {
+	root := texttemplate.New(name).Option("missingkey=zero").Funcs(funcs)
+	entry := name
+	if layout != "" {
+		root = texttemplate.New("layout").Option("missingkey=zero").Funcs(funcs)
+		if _, err := root.Parse(layout); err != nil {
+			return "", err
+		}
+		if _, err := root.New(name).Parse(body); err != nil {
+			return "", err
+		}
+		entry = "layout"
+	} else if _, err := root.Parse(body); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := root.ExecuteTemplate(&buf, entry, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
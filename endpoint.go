@@ -0,0 +1,66 @@
+package chassis
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Endpoint is a built-in HTTP handler contributed by a module, such as a
+// health check or a dashboard. Endpoints are not served automatically; the
+// application mounts them (see api.Mount), and the http.expose config section
+// decides which are enabled, where they live, and who may call them.
+type Endpoint struct {
+	// Name identifies the endpoint in http.expose config (e.g., "health").
+	// Use underscores rather than dots, since config keys use dot notation.
+	Name string
+
+	// Path is the default mount path.
+	Path string
+
+	// Handler serves the endpoint.
+	Handler http.Handler
+
+	// Permission is the default permission required to call the endpoint.
+	// Empty means public; "authenticated" means any logged-in user.
+	Permission string
+
+	// Resource is the org ID the permission is checked against. A
+	// permission other than "authenticated" needs one; api.Mount skips
+	// endpoints without.
+	Resource string
+
+	// Enabled reports whether the endpoint is mounted when config doesn't say.
+	Enabled bool
+
+	// DevOnly endpoints are enabled by default only in the development env.
+	DevOnly bool
+}
+
+// EndpointProvider is implemented by modules that contribute built-in endpoints.
+type EndpointProvider interface {
+	Endpoints() []Endpoint
+}
+
+// Modules returns the registered modules sorted by name.
+func (app *App) Modules() []Module {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	modules := make([]Module, 0, len(app.modules))
+	for _, mod := range app.modules {
+		modules = append(modules, mod)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Name() < modules[j].Name() })
+	return modules
+}
+
+// Endpoints returns the built-in endpoints contributed by registered modules.
+func (app *App) Endpoints() []Endpoint {
+	var endpoints []Endpoint
+	for _, mod := range app.Modules() {
+		if provider, ok := mod.(EndpointProvider); ok {
+			endpoints = append(endpoints, provider.Endpoints()...)
+		}
+	}
+	return endpoints
+}
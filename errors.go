@@ -0,0 +1,83 @@
+package chassis
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorCode is a stable, machine-readable error category.
+// Modules tag their sentinel errors with a code so transports (HTTP, CLI)
+// can map them to status codes without knowing every module's errors.
+type ErrorCode string
+
+const (
+	CodeInvalidArgument    ErrorCode = "invalid_argument"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeAlreadyExists      ErrorCode = "already_exists"
+	CodeUnauthenticated    ErrorCode = "unauthenticated"
+	CodePermissionDenied   ErrorCode = "permission_denied"
+	CodeFailedPrecondition ErrorCode = "failed_precondition"
+	CodeResourceExhausted  ErrorCode = "resource_exhausted"
+	CodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	CodeUnavailable        ErrorCode = "unavailable"
+	CodeInternal           ErrorCode = "internal"
+)
+
+// Error is an error with a code from the chassis error taxonomy.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Details any
+	Err     error
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	if e.Err != nil && e.Message == "" {
+		return e.Err.Error()
+	}
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the wrapped error, if any.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates an error with the given code and message.
+// Modules use it to declare sentinel errors:
+//
+//	var ErrNotFound = chassis.NewError(chassis.CodeNotFound, "user not found")
+func NewError(code ErrorCode, message string) error {
+	return &Error{Code: code, Message: message}
+}
+
+// WrapError attaches a code and message to an underlying error.
+func WrapError(code ErrorCode, message string, err error) error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// ErrorWithDetails creates a coded error carrying structured details for clients.
+func ErrorWithDetails(code ErrorCode, message string, details any) error {
+	return &Error{Code: code, Message: message, Details: details}
+}
+
+// ErrorCodeOf returns the code of the first chassis Error in err's chain.
+// Context cancellation and deadline errors map to CodeUnavailable;
+// anything else uncategorized is CodeInternal.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var chassisErr *Error
+	if errors.As(err, &chassisErr) {
+		return chassisErr.Code
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
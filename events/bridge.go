@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+var ErrUnknownBridge = chassis.NewError(chassis.CodeInvalidArgument, "unknown events bridge provider")
+
+// BridgeMessage is an event crossing a bridge, encoded as JSON on the
+// broker.
+type BridgeMessage struct {
+	ID          string          `json:"id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Source      string          `json:"source"` // instance ID of the publishing process
+	PublishedAt time.Time       `json:"published_at"`
+	RequestID   string          `json:"request_id,omitempty"` // see chassis.WithRequestID
+	TenantID    string          `json:"tenant_id,omitempty"`  // see chassis.WithTenant
+}
+
+// Bridge connects the event bus to an external broker, so several
+// processes share it. NATSBridge and KafkaBridge implement it.
+type Bridge interface {
+	// Publish sends a message to the broker.
+	Publish(ctx context.Context, msg *BridgeMessage) error
+
+	// Receive passes the broker's messages, including this process's own,
+	// to handle until ctx is cancelled or the connection fails.
+	Receive(ctx context.Context, handle func(ctx context.Context, msg *BridgeMessage)) error
+
+	// Close releases the bridge's connections.
+	Close() error
+}
+
+// Reconnection backoff of Start when a bridge's Receive fails.
+const (
+	bridgeMinBackoff = time.Second
+	bridgeMaxBackoff = 30 * time.Second
+)
+
+// WithBridge forwards local events of the given types to a broker and
+// publishes the broker's events locally. A type ending in ".*" matches
+// every type with that prefix, and no types forwards every event. Events
+// from the broker reach local subscribers with a json.RawMessage payload
+// (see Decode) and aren't forwarded back. They are received by Start, so
+// run the app with app.Run.
+func WithBridge(bridge Bridge, eventTypes ...string) Option {
+	return func(mod *Module) {
+		mod.bridge = bridge
+		mod.bridgeEvents = eventTypes
+	}
+}
+
+// Decode returns an event payload as a T, decoding the JSON of events
+// received from a bridge:
+//
+//	event, err := events.Decode[*users.UserEvent](payload)
+func Decode[T any](payload any) (T, error) {
+	if typed, ok := payload.(T); ok {
+		return typed, nil
+	}
+	var decoded T
+	raw, ok := payload.(json.RawMessage)
+	if !ok {
+		return decoded, fmt.Errorf("unexpected payload type %T", payload)
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return decoded, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return decoded, nil
+}
+
+// bridgeFromConfig builds the bridge named by events.bridge.provider.
+func bridgeFromConfig(cfg chassis.ConfigData) (Bridge, error) {
+	switch provider := cfg.GetString("events.bridge.provider"); provider {
+	case "nats":
+		return NewNATSBridge(NATSConfig{
+			URL:      cfg.GetString("events.bridge.nats.url"),
+			Subject:  cfg.GetString("events.bridge.nats.subject"),
+			Token:    cfg.GetString("events.bridge.nats.token"),
+			User:     cfg.GetString("events.bridge.nats.user"),
+			Password: cfg.GetString("events.bridge.nats.password"),
+		}), nil
+	case "kafka":
+		return NewKafkaBridge(KafkaConfig{
+			URL:   cfg.GetString("events.bridge.kafka.url"),
+			Topic: cfg.GetString("events.bridge.kafka.topic"),
+			Group: cfg.GetString("events.bridge.kafka.group"),
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBridge, provider)
+	}
+}
+
+// forwards reports whether local events of the type go to the bridge.
+func (mod *Module) forwards(eventType string) bool {
+	if mod.bridge == nil {
+		return false
+	}
+	if len(mod.bridgeEvents) == 0 {
+		return true
+	}
+	for _, pattern := range mod.bridgeEvents {
+		if pattern == eventType || (strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward sends a local event to the bridge in the background, so a slow
+// broker doesn't hold up publishers. Shutdown waits for it.
+func (mod *Module) forward(ctx context.Context, eventType string, payload any) {
+	if !mod.forwards(eventType) {
+		return
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		mod.logger().ErrorContext(ctx, "failed to encode bridged event", "event", eventType, "error", err)
+		return
+	}
+	msg := &BridgeMessage{
+		ID:          uuid.New().String(),
+		EventType:   eventType,
+		Payload:     encoded,
+		Source:      mod.instanceID,
+		PublishedAt: time.Now().UTC(),
+		RequestID:   chassis.RequestIDFromContext(ctx),
+		TenantID:    chassis.TenantFromContext(ctx),
+	}
+
+	mod.inFlight.Add(1)
+	go func() {
+		defer mod.inFlight.Done()
+		if err := mod.bridge.Publish(context.WithoutCancel(ctx), msg); err != nil {
+			mod.bridgeFailed.Add(1)
+			mod.logger().ErrorContext(ctx, "failed to bridge event", "event", eventType, "error", err)
+			return
+		}
+		mod.bridged.Add(1)
+	}()
+}
+
+// receive publishes an event from the bridge to local subscribers,
+// skipping this process's own.
+func (mod *Module) receive(ctx context.Context, msg *BridgeMessage) {
+	if msg.Source == mod.instanceID {
+		return
+	}
+	if msg.RequestID != "" {
+		ctx = chassis.WithRequestID(ctx, msg.RequestID)
+	}
+	if msg.TenantID != "" {
+		ctx = chassis.WithTenant(ctx, msg.TenantID)
+	}
+	mod.received.Add(1)
+	event := newRecord(ctx, msg.EventType, msg.Payload)
+	event.Remote = true
+	mod.deliver(ctx, event)
+}
+
+// Start receives the bridge's events until ctx is cancelled, reconnecting
+// with backoff when the connection fails. Without a bridge it just waits.
+// Implements chassis.Service.
+func (mod *Module) Start(ctx context.Context) error {
+	if mod.bridge == nil {
+		<-ctx.Done()
+		return nil
+	}
+	backoff := bridgeMinBackoff
+	for {
+		startedAt := time.Now()
+		err := mod.bridge.Receive(ctx, mod.receive)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(startedAt) > bridgeMaxBackoff {
+			backoff = bridgeMinBackoff
+		}
+		mod.logger().Error("events bridge disconnected", "error", err, "retry_in", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, bridgeMaxBackoff)
+	}
+}
@@ -16,13 +16,20 @@
 // Subscribe to events:
 //
 //	unsubscribe := app.Events().Subscribe("user.created", events.Handler(
-//	    func(ctx context.Context, eventType string, payload any) {
-//	        user := payload.(*users.User)
-//	        log.Printf("New user: %s", user.GetEmail())
+//	    func(ctx context.Context, eventType string, payload any) error {
+//	        user := payload.(*users.UserEvent)
+//	        log.Printf("New user: %s", user.Email)
+//	        return nil
 //	    },
 //	))
 //	defer unsubscribe()  // Clean up when done
 //
+// Subscribe to only the events whose payload matches a predicate:
+//
+//	app.Events().SubscribeFiltered("org.member_added", func(payload any) bool {
+//	    return payload.(*orgs.MemberEvent).Role == "admin"
+//	}, handler)
+//
 // Publish events:
 //
 //	// Synchronous - handlers run in sequence
@@ -31,6 +38,64 @@
 //	// Asynchronous - handlers run in goroutines
 //	app.Events().PublishAsync(ctx, "user.created", user)
 //
+// # Error Handling
+//
+// Handlers return an error to report failure. Failures are logged and counted
+// (see Stats). Asynchronous deliveries can be retried with backoff:
+//
+//	mod.SubscribeWithRetry("user.created", handler, events.RetryPolicy{
+//	    MaxAttempts:    5,
+//	    InitialBackoff: 100 * time.Millisecond,
+//	    MaxBackoff:     5 * time.Second,
+//	})
+//
+// Events whose handler still fails after the last attempt are sent to the
+// dead-letter sink, if one is configured:
+//
+//	events.New(events.WithDeadLetterQueue("events.dead_letter"))  // queue job
+//	events.New(events.WithDeadLetterStorage("events/dead-letter/")) // storage key
+//
+// # Schemas
+//
+// Event types can declare versioned JSON Schemas for their payloads.
+// Payloads are validated on publish in development and test, subscribers
+// can ask for an older version, and a lock file catches breaking changes
+// made without a new version:
+//
+//	mod.RegisterSchema(events.EventSchema{Type: "order.placed", Version: 2, Schema: orderV2, Downgrade: orderV2ToV1})
+//	unsubscribe, err := mod.SubscribeVersion("order.placed", 1, handler)
+//
+// # Bridges
+//
+// A Bridge shares the bus between processes through a broker, such as
+// NATS or Kafka. Selected local events are forwarded to it, and its events
+// are published locally by Start, with json.RawMessage payloads:
+//
+//	events.New(events.WithBridge(events.NewNATSBridge(events.NATSConfig{URL: natsURL}), "order.*"))
+//	order, err := events.Decode[*Order](payload)
+//
+// # History
+//
+// In the development and test envs the module keeps the latest published
+// events with each subscriber's outcome (see WithHistory). Recent returns
+// them, and the events_recent endpoint serves them at /debug/events:
+//
+//	records := mod.Recent("order.placed", 10).([]events.Record)
+//
+// # Lifecycle Events
+//
+// When this module is registered, the core modules publish their own events:
+//
+//	users:  user.created, user.updated, user.deleted     (*users.UserEvent)
+//	orgs:   org.created                                  (*orgs.OrgEvent)
+//	        org.member_added, org.member_removed         (*orgs.MemberEvent)
+//	auth:   auth.login, auth.logout                      (*auth.SessionEvent)
+//	queue:  job.completed, job.failed                    (*queue.JobEvent)
+//
+// The users and orgs events go through an outbox in the module's database
+// (see the outbox package), so they are published only once the change
+// commits.
+//
 // # Event Naming
 //
 // Use dot-separated names following a resource.action pattern:
@@ -47,34 +112,198 @@ package events
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/talosaether/chassis"
 )
 
 // Handler is a function that handles an event.
-type Handler func(ctx context.Context, eventType string, payload any)
+// Returning an error marks the delivery as failed.
+type Handler func(ctx context.Context, eventType string, payload any) error
+
+// RetryPolicy controls how failed asynchronous deliveries are retried.
+// Backoff doubles after each attempt, starting at InitialBackoff and capped at MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy delivers once without retrying.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// backoff returns the delay before the given retry attempt (1-based).
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxBackoff > 0 && delay >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// DeadLetter describes an event that could not be delivered to a handler.
+type DeadLetter struct {
+	EventType string    `json:"event_type"`
+	Payload   any       `json:"payload"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	FailedAt  time.Time `json:"failed_at"`
+	RequestID string    `json:"request_id,omitempty"` // see chassis.WithRequestID
+}
+
+// DeadLetterSink receives events whose handlers failed on every attempt.
+type DeadLetterSink interface {
+	DeadLetter(ctx context.Context, letter *DeadLetter) error
+}
+
+// DeadLetterFunc adapts a function to the DeadLetterSink interface.
+type DeadLetterFunc func(ctx context.Context, letter *DeadLetter) error
+
+// DeadLetter calls the function.
+func (fn DeadLetterFunc) DeadLetter(ctx context.Context, letter *DeadLetter) error {
+	return fn(ctx, letter)
+}
+
+// Stats reports delivery counters since the module was created.
+type Stats struct {
+	Delivered    uint64
+	Failed       uint64
+	Retried      uint64
+	DeadLettered uint64
+	Rejected     uint64 // payloads that failed schema validation
+	Bridged      uint64 // events forwarded to the bridge
+	BridgeFailed uint64 // events the bridge failed to forward
+	Received     uint64 // events received from the bridge
+	Filtered     uint64 // deliveries skipped by a SubscribeFiltered predicate
+}
+
+// subscription is a registered handler and its delivery policy.
+type subscription struct {
+	handler Handler
+	retry   RetryPolicy
+	name    string                 // of the handler function, for the history
+	filter  func(payload any) bool // nil delivers every event
+
+	id        uint64 // stable for the unsubscribe function
+	eventType string
+	removed   bool // unsubscribed, guarded by Module.mu
+}
 
 // Module is the events module implementation.
 // It provides a simple in-memory pub/sub system.
 type Module struct {
-	mu       sync.RWMutex
-	handlers map[string][]Handler
-	app      *chassis.App
+	mu             sync.RWMutex
+	handlers       map[string][]*subscription // in subscription order, with removed ones until compacted
+	subscriptions  map[uint64]*subscription   // live ones by ID
+	removed        map[string]int             // removed ones left in handlers, by event type
+	nextID         uint64
+	defaultRetry   RetryPolicy
+	deadLetterSink DeadLetterSink
+	inFlight       sync.WaitGroup
+	app            *chassis.App
+
+	schemas         map[string][]*registeredSchema
+	pendingSchemas  []EventSchema
+	validateSchemas *bool
+	schemaLock      string
+
+	bridge       Bridge
+	bridgeEvents []string
+	instanceID   string
+
+	historySize *int
+	history     *history
+
+	delivered    atomic.Uint64
+	failed       atomic.Uint64
+	retried      atomic.Uint64
+	deadLettered atomic.Uint64
+	rejected     atomic.Uint64
+	filtered     atomic.Uint64
+	bridged      atomic.Uint64
+	bridgeFailed atomic.Uint64
+	received     atomic.Uint64
 }
 
 // Option is a function that configures the events module.
 type Option func(*Module)
 
+// WithDefaultRetry sets the retry policy used by Subscribe for async deliveries.
+func WithDefaultRetry(policy RetryPolicy) Option {
+	return func(mod *Module) {
+		mod.defaultRetry = policy
+	}
+}
+
+// WithDeadLetterSink sets where repeatedly failing events are sent.
+func WithDeadLetterSink(sink DeadLetterSink) Option {
+	return func(mod *Module) {
+		mod.deadLetterSink = sink
+	}
+}
+
+// WithDeadLetterQueue sends dead letters to the queue module as jobs of the given type.
+// Without the queue module the sink fails and dead letters are logged.
+func WithDeadLetterQueue(jobType string) Option {
+	return func(mod *Module) {
+		mod.deadLetterSink = DeadLetterFunc(func(ctx context.Context, letter *DeadLetter) error {
+			queueMod, ok := mod.app.TryQueue()
+			if !ok {
+				return errors.New("dead letter queue requires the queue module")
+			}
+			_, err := queueMod.Enqueue(ctx, jobType, letter)
+			return err
+		})
+	}
+}
+
+// WithDeadLetterStorage writes dead letters as JSON to the storage module under prefix.
+// Without the storage module the sink fails and dead letters are logged.
+func WithDeadLetterStorage(prefix string) Option {
+	return func(mod *Module) {
+		mod.deadLetterSink = DeadLetterFunc(func(ctx context.Context, letter *DeadLetter) error {
+			storage, ok := mod.app.TryStorage()
+			if !ok {
+				return errors.New("dead letter storage requires the storage module")
+			}
+			data, err := json.Marshal(letter)
+			if err != nil {
+				return fmt.Errorf("failed to encode dead letter: %w", err)
+			}
+			key := fmt.Sprintf("%s%s-%s.json", prefix, letter.FailedAt.UTC().Format("20060102T150405.000000000"), uuid.New().String())
+			return storage.Put(ctx, key, data)
+		})
+	}
+}
+
 // New creates a new events module with the given options.
 func New(opts ...Option) *Module {
 	mod := &Module{
-		handlers: make(map[string][]Handler),
+		handlers:      make(map[string][]*subscription),
+		subscriptions: make(map[uint64]*subscription),
+		removed:       make(map[string]int),
+		defaultRetry:  DefaultRetryPolicy,
+		schemas:       make(map[string][]*registeredSchema),
+		instanceID:    uuid.New().String(),
 	}
 
 	for _, opt := range opts {
 		opt(mod)
 	}
+	if mod.historySize != nil && *mod.historySize > 0 {
+		mod.history = newHistory(*mod.historySize)
+	}
 
 	return mod
 }
@@ -87,119 +316,391 @@ func (mod *Module) Name() string {
 // Init initializes the events module.
 func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 	mod.app = app
-	app.Logger().Info("events module initialized")
+
+	if cfg := app.ConfigData(); cfg != nil {
+		if cfg.Get("events.validate_schemas") != nil {
+			enabled := cfg.GetBool("events.validate_schemas")
+			mod.validateSchemas = &enabled
+		}
+		if lock := cfg.GetString("events.schema_lock"); lock != "" {
+			mod.schemaLock = lock
+		}
+		if mod.historySize == nil && cfg.Get("events.history_size") != nil {
+			size := cfg.GetInt("events.history_size")
+			mod.historySize = &size
+		}
+		if mod.bridge == nil && cfg.GetString("events.bridge.provider") != "" {
+			bridge, err := bridgeFromConfig(cfg)
+			if err != nil {
+				return err
+			}
+			mod.bridge = bridge
+			mod.bridgeEvents = cfg.GetStringSlice("events.bridge.events")
+		}
+	}
+
+	if mod.historySize == nil && (app.Config().Env == "development" || app.Config().Env == "test") {
+		size := DefaultHistorySize
+		mod.historySize = &size
+	}
+	if mod.history == nil && mod.historySize != nil && *mod.historySize > 0 {
+		mod.history = newHistory(*mod.historySize)
+	}
+
+	for _, schema := range mod.pendingSchemas {
+		if err := mod.RegisterSchema(schema); err != nil {
+			return err
+		}
+	}
+	mod.pendingSchemas = nil
+	if mod.schemaLock != "" {
+		if err := mod.checkSchemaLock(); err != nil {
+			return err
+		}
+	}
+
+	app.Logger().Info("events module initialized", "validate_schemas", mod.validating(), "bridge", mod.bridge != nil)
 	return nil
 }
 
-// Shutdown cleans up the events module.
+// Shutdown waits for in-flight async deliveries and bridged events
+// (bounded by ctx), closes the bridge and removes all handlers.
 func (mod *Module) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		mod.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		mod.logger().Warn("events shutdown timed out waiting for async deliveries")
+	}
+	if mod.bridge != nil {
+		if err := mod.bridge.Close(); err != nil {
+			mod.logger().Warn("failed to close events bridge", "error", err)
+		}
+	}
+
 	mod.mu.Lock()
 	defer mod.mu.Unlock()
-	mod.handlers = make(map[string][]Handler)
+	mod.handlers = make(map[string][]*subscription)
+	mod.subscriptions = make(map[uint64]*subscription)
+	mod.removed = make(map[string]int)
 	return nil
 }
 
+// Stats returns delivery counters.
+func (mod *Module) Stats() Stats {
+	return Stats{
+		Delivered:    mod.delivered.Load(),
+		Failed:       mod.failed.Load(),
+		Retried:      mod.retried.Load(),
+		DeadLettered: mod.deadLettered.Load(),
+		Rejected:     mod.rejected.Load(),
+		Bridged:      mod.bridged.Load(),
+		BridgeFailed: mod.bridgeFailed.Load(),
+		Received:     mod.received.Load(),
+		Filtered:     mod.filtered.Load(),
+	}
+}
+
 // Subscribe registers a handler for an event type.
-// Returns an unsubscribe function.
+// The handler may be a Handler, a func(context.Context, string, any) error,
+// or a func(context.Context, string, any) for handlers that cannot fail.
+// Returns an unsubscribe function, safe to call more than once and from
+// any goroutine.
 func (mod *Module) Subscribe(eventType string, handler any) func() {
-	// Type assert to Handler
-	handlerFunc, ok := handler.(Handler)
-	if !ok {
-		// Try function signature
-		if fn, ok := handler.(func(context.Context, string, any)); ok {
-			handlerFunc = fn
-		} else {
-			return func() {} // Invalid handler, return no-op unsubscribe
+	handlerFunc := toHandler(handler)
+	if handlerFunc == nil {
+		return func() {} // Invalid handler, return no-op unsubscribe
+	}
+	return mod.subscribe(eventType, &subscription{handler: handlerFunc, retry: mod.defaultRetry, name: handlerName(handler)})
+}
+
+// SubscribeWithRetry registers a handler whose async deliveries are retried per policy.
+func (mod *Module) SubscribeWithRetry(eventType string, handler Handler, policy RetryPolicy) func() {
+	return mod.subscribe(eventType, &subscription{handler: handler, retry: policy, name: handlerName(handler)})
+}
+
+// SubscribeFiltered registers a handler that only receives the events
+// whose payload matches predicate, such as new members of one role only:
+//
+//	mod.SubscribeFiltered(orgs.EventMemberAdded, func(payload any) bool {
+//		return payload.(*orgs.MemberEvent).Role == "admin"
+//	}, handler)
+//
+// The predicate runs on every published event of the type, before the
+// handler is scheduled, so it should be quick. A predicate that panics
+// counts as not matching.
+func (mod *Module) SubscribeFiltered(eventType string, predicate func(payload any) bool, handler any) func() {
+	handlerFunc := toHandler(handler)
+	if handlerFunc == nil || predicate == nil {
+		return func() {} // Invalid handler, return no-op unsubscribe
+	}
+	return mod.subscribe(eventType, &subscription{handler: handlerFunc, retry: mod.defaultRetry, name: handlerName(handler), filter: predicate})
+}
+
+// toHandler converts the supported handler signatures to a Handler.
+func toHandler(handler any) Handler {
+	switch typed := handler.(type) {
+	case Handler:
+		return typed
+	case func(context.Context, string, any) error:
+		return typed
+	case func(context.Context, string, any):
+		return func(ctx context.Context, eventType string, payload any) error {
+			typed(ctx, eventType, payload)
+			return nil
 		}
+	default:
+		return nil
 	}
-	return mod.subscribe(eventType, handlerFunc)
 }
 
 // subscribe is the internal implementation.
-func (mod *Module) subscribe(eventType string, handler Handler) func() {
+func (mod *Module) subscribe(eventType string, sub *subscription) func() {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+
+	if sub.retry.MaxAttempts < 1 {
+		sub.retry.MaxAttempts = 1
+	}
+	mod.nextID++
+	sub.id, sub.eventType = mod.nextID, eventType
+	mod.handlers[eventType] = append(mod.handlers[eventType], sub)
+	mod.subscriptions[sub.id] = sub
+
+	// The unsubscribe function looks the subscription up by ID, so calling
+	// it again, or after Shutdown, does nothing
+	return func() { mod.unsubscribe(sub.id) }
+}
+
+// unsubscribe removes a subscription. It is marked removed and left in
+// place for snapshots to skip, and the event type's subscriptions are
+// compacted once more than half of them are removed.
+func (mod *Module) unsubscribe(id uint64) {
 	mod.mu.Lock()
 	defer mod.mu.Unlock()
 
-	mod.handlers[eventType] = append(mod.handlers[eventType], handler)
+	sub, ok := mod.subscriptions[id]
+	if !ok {
+		return
+	}
+	delete(mod.subscriptions, id)
+	sub.removed = true
+	mod.removed[sub.eventType]++
 
-	// Return unsubscribe function
-	handlerIndex := len(mod.handlers[eventType]) - 1
-	return func() {
-		mod.mu.Lock()
-		defer mod.mu.Unlock()
+	subs := mod.handlers[sub.eventType]
+	if mod.removed[sub.eventType]*2 <= len(subs) {
+		return
+	}
+	// Compact into a new slice, leaving the old one to any readers
+	live := make([]*subscription, 0, len(subs)-mod.removed[sub.eventType])
+	for _, candidate := range subs {
+		if !candidate.removed {
+			live = append(live, candidate)
+		}
+	}
+	delete(mod.removed, sub.eventType)
+	if len(live) == 0 {
+		delete(mod.handlers, sub.eventType)
+		return
+	}
+	mod.handlers[sub.eventType] = live
+}
 
-		handlers := mod.handlers[eventType]
-		if handlerIndex < len(handlers) {
-			// Remove handler by setting to nil (preserves indices for other unsubscribes)
-			mod.handlers[eventType][handlerIndex] = nil
+// snapshot returns a copy of the active subscriptions for an event type.
+func (mod *Module) snapshot(eventType string) []*subscription {
+	mod.mu.RLock()
+	defer mod.mu.RUnlock()
+
+	subs := make([]*subscription, 0, len(mod.handlers[eventType]))
+	for _, sub := range mod.handlers[eventType] {
+		if !sub.removed {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// matching returns the subscriptions of an event whose filters accept its
+// payload.
+func (mod *Module) matching(ctx context.Context, eventType string, payload any) []*subscription {
+	subs := mod.snapshot(eventType)
+	matched := subs[:0]
+	for _, sub := range subs {
+		if sub.filter == nil || mod.accepts(ctx, sub, eventType, payload) {
+			matched = append(matched, sub)
+		} else {
+			mod.filtered.Add(1)
 		}
 	}
+	return matched
+}
+
+// accepts runs a subscription's filter, recovering from panics.
+func (mod *Module) accepts(ctx context.Context, sub *subscription, eventType string, payload any) (ok bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			mod.logger().ErrorContext(ctx, "event filter panicked", "event", eventType, "handler", sub.name, "panic", recovered)
+			ok = false
+		}
+	}()
+	return sub.filter(payload)
 }
 
 // Publish sends an event to all registered handlers.
 // Handlers are called synchronously in the order they were registered.
+// A failing handler is not retried, so the publisher is never blocked on backoff;
+// its event goes straight to the dead-letter sink. When schema validation
+// is on, payloads that don't match their schema are logged and dropped.
+// Events selected by WithBridge are also forwarded to the broker.
 func (mod *Module) Publish(ctx context.Context, eventType string, payload any) {
-	mod.mu.RLock()
-	handlers := make([]Handler, len(mod.handlers[eventType]))
-	copy(handlers, mod.handlers[eventType])
-	mod.mu.RUnlock()
+	if !mod.checkPublished(ctx, eventType, payload) {
+		return
+	}
+	mod.deliver(ctx, newRecord(ctx, eventType, payload))
+	mod.forward(ctx, eventType, payload)
+}
 
-	for _, handler := range handlers {
-		if handler != nil {
-			handler(ctx, eventType, payload)
+// deliver calls the handlers of an event synchronously, recording their
+// outcomes.
+func (mod *Module) deliver(ctx context.Context, event *Record) {
+	subs := mod.matching(ctx, event.EventType, event.Payload)
+	record := mod.record(event, subs)
+	for i, sub := range subs {
+		started := time.Now()
+		err := mod.invoke(ctx, sub, event.EventType, event.Payload, 1)
+		mod.finish(record, i, 1, err, started)
+		if err != nil {
+			mod.sendToDeadLetter(ctx, event.EventType, event.Payload, err, 1)
 		}
 	}
 }
 
 // PublishAsync sends an event to all registered handlers asynchronously.
-// Each handler is called in its own goroutine.
+// Each handler is called in its own goroutine and retried according to its RetryPolicy.
+// Payloads are validated as they are by Publish.
 func (mod *Module) PublishAsync(ctx context.Context, eventType string, payload any) {
-	mod.mu.RLock()
-	handlers := make([]Handler, len(mod.handlers[eventType]))
-	copy(handlers, mod.handlers[eventType])
-	mod.mu.RUnlock()
+	if !mod.checkPublished(ctx, eventType, payload) {
+		return
+	}
+	mod.forward(ctx, eventType, payload)
+	event := newRecord(ctx, eventType, payload)
+	event.Async = true
+	subs := mod.matching(ctx, eventType, payload)
+	record := mod.record(event, subs)
+	for i, sub := range subs {
+		mod.inFlight.Add(1)
+		go func(sub *subscription) {
+			defer mod.inFlight.Done()
+			started := time.Now()
+			attempts, err := mod.deliverWithRetry(ctx, sub, eventType, payload)
+			mod.finish(record, i, attempts, err, started)
+		}(sub)
+	}
+}
 
-	for _, handler := range handlers {
-		if handler != nil {
-			go handler(ctx, eventType, payload)
+// deliverWithRetry calls the handler until it succeeds or the policy is
+// exhausted, and returns the attempts made and the last error.
+func (mod *Module) deliverWithRetry(ctx context.Context, sub *subscription, eventType string, payload any) (int, error) {
+	var err error
+	for attempt := 1; attempt <= sub.retry.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			mod.retried.Add(1)
+			timer := time.NewTimer(sub.retry.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				err = fmt.Errorf("%w (retry aborted: %w)", err, ctx.Err())
+				mod.sendToDeadLetter(ctx, eventType, payload, err, attempt-1)
+				return attempt - 1, err
+			case <-timer.C:
+			}
+		}
+
+		if err = mod.invoke(ctx, sub, eventType, payload, attempt); err == nil {
+			return attempt, nil
 		}
 	}
+	mod.sendToDeadLetter(ctx, eventType, payload, err, sub.retry.MaxAttempts)
+	return sub.retry.MaxAttempts, err
 }
 
-// HasSubscribers returns true if there are any subscribers for the event type.
-func (mod *Module) HasSubscribers(eventType string) bool {
-	mod.mu.RLock()
-	defer mod.mu.RUnlock()
-
-	handlers, exists := mod.handlers[eventType]
-	if !exists {
-		return false
+// invoke calls a handler once, recording the outcome.
+func (mod *Module) invoke(ctx context.Context, sub *subscription, eventType string, payload any, attempt int) error {
+	if mod.app != nil && chassis.FromContext(ctx) == nil {
+		ctx = chassis.WithApp(ctx, mod.app)
 	}
+	if err := mod.call(ctx, sub, eventType, payload); err != nil {
+		mod.failed.Add(1)
+		mod.logger().ErrorContext(ctx, "event handler failed",
+			"event", eventType,
+			"attempt", attempt,
+			"max_attempts", sub.retry.MaxAttempts,
+			"error", err,
+		)
+		return err
+	}
+	mod.delivered.Add(1)
+	return nil
+}
 
-	// Check if any non-nil handlers exist
-	for _, handler := range handlers {
-		if handler != nil {
-			return true
+// call runs a handler, turning a panic into an error wrapping
+// chassis.ErrPanicked so it is retried and dead-lettered like a failure.
+func (mod *Module) call(ctx context.Context, sub *subscription, eventType string, payload any) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if mod.app == nil {
+				mod.logger().ErrorContext(ctx, "event handler panicked", "event", eventType, "panic", recovered, "stack", string(debug.Stack()))
+				err = fmt.Errorf("%w: %v", chassis.ErrPanicked, recovered)
+				return
+			}
+			err = mod.app.ReportPanic(ctx, mod.Name(), chassis.PanicInEventHandler, eventType, recovered)
 		}
-	}
-	return false
+	}()
+	return sub.handler(ctx, eventType, payload)
 }
 
-// SubscriberCount returns the number of active subscribers for an event type.
-func (mod *Module) SubscriberCount(eventType string) int {
-	mod.mu.RLock()
-	defer mod.mu.RUnlock()
+// sendToDeadLetter hands a failed event to the dead-letter sink, if configured.
+func (mod *Module) sendToDeadLetter(ctx context.Context, eventType string, payload any, cause error, attempts int) {
+	if mod.deadLetterSink == nil {
+		return
+	}
 
-	handlers, exists := mod.handlers[eventType]
-	if !exists {
-		return 0
+	letter := &DeadLetter{
+		EventType: eventType,
+		Payload:   payload,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+		RequestID: chassis.RequestIDFromContext(ctx),
 	}
+	// The original context may already be cancelled; dead-lettering must still happen
+	if err := mod.deadLetterSink.DeadLetter(context.WithoutCancel(ctx), letter); err != nil {
+		mod.logger().Error("failed to dead-letter event", "event", eventType, "error", err)
+		return
+	}
+	mod.deadLettered.Add(1)
+	mod.logger().Warn("event dead-lettered", "event", eventType, "attempts", attempts)
+}
 
-	count := 0
-	for _, handler := range handlers {
-		if handler != nil {
-			count++
-		}
+// logger returns the app logger, falling back to the default logger before Init.
+func (mod *Module) logger() *slog.Logger {
+	if mod.app != nil {
+		return mod.app.Logger()
 	}
-	return count
+	return slog.Default()
+}
+
+// HasSubscribers returns true if there are any subscribers for the event type.
+func (mod *Module) HasSubscribers(eventType string) bool {
+	return mod.SubscriberCount(eventType) > 0
+}
+
+// SubscriberCount returns the number of active subscribers for an event type.
+func (mod *Module) SubscriberCount(eventType string) int {
+	return len(mod.snapshot(eventType))
 }
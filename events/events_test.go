@@ -1,10 +1,25 @@
 package events
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/talosaether/chassis"
 )
 
 func TestModule_Name(t *testing.T) {
@@ -20,8 +35,9 @@ func TestModule_SubscribeAndPublish(t *testing.T) {
 
 	received := make(chan string, 1)
 
-	mod.Subscribe("test.event", Handler(func(ctx context.Context, eventType string, payload any) {
+	mod.Subscribe("test.event", Handler(func(ctx context.Context, eventType string, payload any) error {
 		received <- payload.(string)
+		return nil
 	}))
 
 	mod.Publish(ctx, "test.event", "hello")
@@ -43,16 +59,18 @@ func TestModule_MultipleHandlers(t *testing.T) {
 	var mu sync.Mutex
 	var calls []string
 
-	mod.Subscribe("multi.event", Handler(func(ctx context.Context, eventType string, payload any) {
+	mod.Subscribe("multi.event", Handler(func(ctx context.Context, eventType string, payload any) error {
 		mu.Lock()
 		calls = append(calls, "handler1")
 		mu.Unlock()
+		return nil
 	}))
 
-	mod.Subscribe("multi.event", Handler(func(ctx context.Context, eventType string, payload any) {
+	mod.Subscribe("multi.event", Handler(func(ctx context.Context, eventType string, payload any) error {
 		mu.Lock()
 		calls = append(calls, "handler2")
 		mu.Unlock()
+		return nil
 	}))
 
 	mod.Publish(ctx, "multi.event", nil)
@@ -70,8 +88,9 @@ func TestModule_Unsubscribe(t *testing.T) {
 
 	callCount := 0
 
-	unsubscribe := mod.Subscribe("unsub.event", Handler(func(ctx context.Context, eventType string, payload any) {
+	unsubscribe := mod.Subscribe("unsub.event", Handler(func(ctx context.Context, eventType string, payload any) error {
 		callCount++
+		return nil
 	}))
 
 	// First publish should trigger handler
@@ -90,6 +109,72 @@ func TestModule_Unsubscribe(t *testing.T) {
 	}
 }
 
+func TestModule_UnsubscribeIdempotent(t *testing.T) {
+	mod := New()
+	ctx := context.Background()
+
+	var calls []string
+	handler := func(name string) func(context.Context, string, any) {
+		return func(ctx context.Context, eventType string, payload any) { calls = append(calls, name) }
+	}
+	unsubscribeA := mod.Subscribe("unsub.event", handler("a"))
+	unsubscribeB := mod.Subscribe("unsub.event", handler("b"))
+	mod.Subscribe("unsub.event", handler("c"))
+
+	unsubscribeA()
+	unsubscribeA()
+	unsubscribeB() // compacts: two of three removed
+	mod.Publish(ctx, "unsub.event", nil)
+	if strings.Join(calls, ",") != "c" {
+		t.Errorf("expected only c, got %v", calls)
+	}
+
+	// Unsubscribing after Shutdown leaves later subscriptions alone
+	_ = mod.Shutdown(ctx)
+	mod.Subscribe("unsub.event", handler("d"))
+	unsubscribeB()
+	calls = nil
+	mod.Publish(ctx, "unsub.event", nil)
+	if strings.Join(calls, ",") != "d" {
+		t.Errorf("expected d, got %v", calls)
+	}
+}
+
+func TestModule_SubscriptionChurn(t *testing.T) {
+	mod := New()
+	ctx := context.Background()
+
+	var stable atomic.Int64
+	mod.Subscribe("churn.event", func(ctx context.Context, eventType string, payload any) { stable.Add(1) })
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				unsubscribe := mod.Subscribe("churn.event", func(ctx context.Context, eventType string, payload any) {})
+				mod.Publish(ctx, "churn.event", nil)
+				unsubscribe()
+				unsubscribe()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stable.Load() != 8000 {
+		t.Errorf("expected the stable handler on every publish, got %d", stable.Load())
+	}
+	if count := mod.SubscriberCount("churn.event"); count != 1 {
+		t.Errorf("expected 1 subscriber left, got %d", count)
+	}
+	mod.mu.RLock()
+	defer mod.mu.RUnlock()
+	if held := len(mod.handlers["churn.event"]); held > 2 {
+		t.Errorf("expected removed subscriptions to be compacted, %d held", held)
+	}
+}
+
 func TestModule_PublishNoSubscribers(t *testing.T) {
 	mod := New()
 	ctx := context.Background()
@@ -104,10 +189,11 @@ func TestModule_PublishAsync(t *testing.T) {
 
 	done := make(chan bool, 1)
 
-	mod.Subscribe("async.event", Handler(func(ctx context.Context, eventType string, payload any) {
+	mod.Subscribe("async.event", Handler(func(ctx context.Context, eventType string, payload any) error {
 		// Simulate some work
 		time.Sleep(10 * time.Millisecond)
 		done <- true
+		return nil
 	}))
 
 	mod.PublishAsync(ctx, "async.event", nil)
@@ -128,7 +214,7 @@ func TestModule_HasSubscribers(t *testing.T) {
 		t.Error("should have no subscribers initially")
 	}
 
-	unsubscribe := mod.Subscribe("test.event", Handler(func(ctx context.Context, eventType string, payload any) {}))
+	unsubscribe := mod.Subscribe("test.event", Handler(func(ctx context.Context, eventType string, payload any) error { return nil }))
 
 	if !mod.HasSubscribers("test.event") {
 		t.Error("should have subscribers after Subscribe")
@@ -148,12 +234,12 @@ func TestModule_SubscriberCount(t *testing.T) {
 		t.Error("initial count should be 0")
 	}
 
-	unsub1 := mod.Subscribe("count.event", Handler(func(ctx context.Context, eventType string, payload any) {}))
+	unsub1 := mod.Subscribe("count.event", Handler(func(ctx context.Context, eventType string, payload any) error { return nil }))
 	if mod.SubscriberCount("count.event") != 1 {
 		t.Errorf("count should be 1, got %d", mod.SubscriberCount("count.event"))
 	}
 
-	unsub2 := mod.Subscribe("count.event", Handler(func(ctx context.Context, eventType string, payload any) {}))
+	unsub2 := mod.Subscribe("count.event", Handler(func(ctx context.Context, eventType string, payload any) error { return nil }))
 	if mod.SubscriberCount("count.event") != 2 {
 		t.Errorf("count should be 2, got %d", mod.SubscriberCount("count.event"))
 	}
@@ -175,12 +261,14 @@ func TestModule_DifferentEventTypes(t *testing.T) {
 
 	var received1, received2 bool
 
-	mod.Subscribe("event.type1", Handler(func(ctx context.Context, eventType string, payload any) {
+	mod.Subscribe("event.type1", Handler(func(ctx context.Context, eventType string, payload any) error {
 		received1 = true
+		return nil
 	}))
 
-	mod.Subscribe("event.type2", Handler(func(ctx context.Context, eventType string, payload any) {
+	mod.Subscribe("event.type2", Handler(func(ctx context.Context, eventType string, payload any) error {
 		received2 = true
+		return nil
 	}))
 
 	mod.Publish(ctx, "event.type1", nil)
@@ -215,7 +303,7 @@ func TestModule_Shutdown(t *testing.T) {
 	mod := New()
 	ctx := context.Background()
 
-	mod.Subscribe("shutdown.event", Handler(func(ctx context.Context, eventType string, payload any) {}))
+	mod.Subscribe("shutdown.event", Handler(func(ctx context.Context, eventType string, payload any) error { return nil }))
 
 	err := mod.Shutdown(ctx)
 	if err != nil {
@@ -226,3 +314,599 @@ func TestModule_Shutdown(t *testing.T) {
 		t.Error("should have no subscribers after Shutdown")
 	}
 }
+
+func TestModule_SubscribeErrorSignature(t *testing.T) {
+	mod := New()
+	ctx := context.Background()
+
+	mod.Subscribe("err.event", func(ctx context.Context, eventType string, payload any) error {
+		return errors.New("boom")
+	})
+
+	mod.Publish(ctx, "err.event", nil)
+
+	stats := mod.Stats()
+	if stats.Failed != 1 {
+		t.Errorf("expected 1 failure, got %d", stats.Failed)
+	}
+	if stats.Delivered != 0 {
+		t.Errorf("expected 0 deliveries, got %d", stats.Delivered)
+	}
+}
+
+func TestModule_PublishAsyncRetries(t *testing.T) {
+	mod := New()
+	ctx := context.Background()
+
+	var attempts atomic.Int32
+	done := make(chan struct{})
+
+	mod.SubscribeWithRetry("retry.event", func(ctx context.Context, eventType string, payload any) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("transient")
+		}
+		close(done)
+		return nil
+	}, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+
+	mod.PublishAsync(ctx, "retry.event", nil)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not succeed after retries")
+	}
+
+	if err := mod.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	stats := mod.Stats()
+	if stats.Retried != 2 {
+		t.Errorf("expected 2 retries, got %d", stats.Retried)
+	}
+	if stats.Delivered != 1 {
+		t.Errorf("expected 1 delivery, got %d", stats.Delivered)
+	}
+}
+
+func TestModule_DeadLetterAfterRetries(t *testing.T) {
+	letters := make(chan *DeadLetter, 1)
+	mod := New(WithDeadLetterSink(DeadLetterFunc(func(ctx context.Context, letter *DeadLetter) error {
+		letters <- letter
+		return nil
+	})))
+	ctx := context.Background()
+
+	mod.SubscribeWithRetry("dead.event", func(ctx context.Context, eventType string, payload any) error {
+		return errors.New("permanent")
+	}, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	mod.PublishAsync(ctx, "dead.event", "payload")
+
+	select {
+	case letter := <-letters:
+		if letter.EventType != "dead.event" {
+			t.Errorf("event type mismatch: got %q", letter.EventType)
+		}
+		if letter.Attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", letter.Attempts)
+		}
+		if letter.Error != "permanent" {
+			t.Errorf("error mismatch: got %q", letter.Error)
+		}
+		if letter.Payload != "payload" {
+			t.Errorf("payload mismatch: got %v", letter.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event was not dead-lettered")
+	}
+}
+
+func TestModule_PublishSyncDeadLetters(t *testing.T) {
+	var letters []*DeadLetter
+	mod := New(WithDeadLetterSink(DeadLetterFunc(func(ctx context.Context, letter *DeadLetter) error {
+		letters = append(letters, letter)
+		return nil
+	})))
+
+	mod.SubscribeWithRetry("sync.event", func(ctx context.Context, eventType string, payload any) error {
+		return errors.New("fail")
+	}, RetryPolicy{MaxAttempts: 5})
+
+	mod.Publish(context.Background(), "sync.event", nil)
+
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(letters))
+	}
+	if letters[0].Attempts != 1 {
+		t.Errorf("sync publish should not retry, got %d attempts", letters[0].Attempts)
+	}
+	if mod.Stats().DeadLettered != 1 {
+		t.Errorf("expected DeadLettered=1, got %d", mod.Stats().DeadLettered)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+const orderPlacedV1 = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"total": {"type": "number"},
+		"status": {"enum": ["placed", "paid"]}
+	},
+	"required": ["id", "total"]
+}`
+
+const orderPlacedV2 = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"amount": {"type": "object", "properties": {"value": {"type": "integer"}, "currency": {"type": "string"}}, "required": ["value", "currency"]},
+		"status": {"enum": ["placed", "paid"]}
+	},
+	"required": ["id", "amount"]
+}`
+
+func TestSchemaValidation(t *testing.T) {
+	schema, err := ParseSchema(orderPlacedV1)
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+	if problems := schema.Validate(map[string]any{"id": "o-1", "total": 9.5, "status": "paid"}); len(problems) != 0 {
+		t.Errorf("expected a valid payload, got %v", problems)
+	}
+	problems := schema.Validate(map[string]any{"id": 1.0, "status": "lost"})
+	if len(problems) != 3 {
+		t.Errorf("expected a missing total, a wrong id type and a bad status, got %v", problems)
+	}
+	if _, err := ParseSchema(`{"type": "map"}`); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected ErrInvalidSchema for an unknown type, got %v", err)
+	}
+
+	mod := New(WithSchemaValidation(true))
+	if err := mod.RegisterSchema(EventSchema{Type: "order.placed", Version: 1, Schema: orderPlacedV1}); err != nil {
+		t.Fatalf("RegisterSchema failed: %v", err)
+	}
+	if err := mod.RegisterSchema(EventSchema{Type: "order.placed", Version: 1, Schema: orderPlacedV1}); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("expected registering a version twice to fail, got %v", err)
+	}
+
+	var delivered atomic.Int32
+	mod.Subscribe("order.placed", func(ctx context.Context, eventType string, payload any) { delivered.Add(1) })
+	mod.Publish(context.Background(), "order.placed", struct {
+		ID    string  `json:"id"`
+		Total float64 `json:"total"`
+	}{"o-1", 9.5})
+	mod.Publish(context.Background(), "order.placed", map[string]any{"id": "o-2"})
+	if delivered.Load() != 1 || mod.Stats().Rejected != 1 {
+		t.Errorf("expected the invalid payload to be rejected, got %d delivered, %d rejected", delivered.Load(), mod.Stats().Rejected)
+	}
+	if err := mod.Validate("order.placed", map[string]any{"id": "o-2"}); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload, got %v", err)
+	}
+	if err := mod.Validate("order.unknown", 42); err != nil {
+		t.Errorf("expected event types without a schema to pass, got %v", err)
+	}
+}
+
+func TestSubscribeVersion(t *testing.T) {
+	mod := New()
+	mod.RegisterSchema(EventSchema{Type: "order.placed", Version: 1, Schema: orderPlacedV1})
+	mod.RegisterSchema(EventSchema{Type: "order.placed", Version: 2, Schema: orderPlacedV2, Downgrade: func(payload any) (any, error) {
+		order := payload.(map[string]any)
+		amount := order["amount"].(map[string]any)
+		return map[string]any{"id": order["id"], "total": float64(amount["value"].(int)) / 100}, nil
+	}})
+
+	var latest, legacy any
+	mod.Subscribe("order.placed", func(ctx context.Context, eventType string, payload any) { latest = payload })
+	if _, err := mod.SubscribeVersion("order.placed", 1, func(ctx context.Context, eventType string, payload any) { legacy = payload }); err != nil {
+		t.Fatalf("SubscribeVersion failed: %v", err)
+	}
+	if _, err := mod.SubscribeVersion("order.placed", 3, func(ctx context.Context, eventType string, payload any) {}); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+
+	mod.Publish(context.Background(), "order.placed", map[string]any{"id": "o-1", "amount": map[string]any{"value": 950, "currency": "EUR"}})
+	if _, ok := latest.(map[string]any)["amount"]; !ok {
+		t.Errorf("expected the latest version, got %v", latest)
+	}
+	if total := legacy.(map[string]any)["total"]; total != 9.5 {
+		t.Errorf("expected the downgraded payload, got %v", legacy)
+	}
+}
+
+func TestSchemaCompatibility(t *testing.T) {
+	v1, _ := ParseSchema(orderPlacedV1)
+	v2, _ := ParseSchema(orderPlacedV2)
+	changes := CheckCompatibility(v1, v2)
+	if len(changes) != 2 {
+		t.Errorf("expected total to be removed and no longer required, got %v", changes)
+	}
+	widened, _ := ParseSchema(`{"type": "object", "properties": {"id": {"type": "string"}, "total": {"type": "number"}, "status": {"enum": ["placed", "paid", "refunded"]}, "note": {"type": "string"}}, "required": ["id", "total"]}`)
+	if changes := CheckCompatibility(v1, widened); len(changes) != 1 || !strings.Contains(changes[0], "refunded") {
+		t.Errorf("expected only the new enum value to break, got %v", changes)
+	}
+
+	lock := filepath.Join(t.TempDir(), "schemas.lock.json")
+	first, err := chassis.Build(chassis.WithModules(New(WithSchemaLock(lock), WithSchemas(EventSchema{Type: "order.placed", Version: 1, Schema: orderPlacedV1}))))
+	if err != nil {
+		t.Fatalf("expected the lock to be written, got %v", err)
+	}
+	_ = first.Shutdown(context.Background())
+	if data, err := os.ReadFile(lock); err != nil || !strings.Contains(string(data), `"order.placed"`) {
+		t.Fatalf("expected the lock file to list the schema, got %s (%v)", data, err)
+	}
+
+	if _, err := chassis.Build(chassis.WithModules(New(WithSchemaLock(lock), WithSchemas(EventSchema{Type: "order.placed", Version: 1, Schema: orderPlacedV2})))); !errors.Is(err, ErrBreakingChange) {
+		t.Errorf("expected ErrBreakingChange changing v1 in place, got %v", err)
+	}
+
+	bumped, err := chassis.Build(chassis.WithModules(New(WithSchemaLock(lock), WithSchemas(
+		EventSchema{Type: "order.placed", Version: 1, Schema: orderPlacedV1},
+		EventSchema{Type: "order.placed", Version: 2, Schema: orderPlacedV2},
+	))))
+	if err != nil {
+		t.Fatalf("expected a new version to be accepted, got %v", err)
+	}
+	_ = bumped.Shutdown(context.Background())
+}
+
+// memoryBroker fans bridged messages out to every receiving bridge.
+type memoryBroker struct {
+	mu        sync.Mutex
+	receivers []chan *BridgeMessage
+}
+
+type memoryBridge struct {
+	broker *memoryBroker
+}
+
+func (bridge *memoryBridge) Publish(ctx context.Context, msg *BridgeMessage) error {
+	bridge.broker.mu.Lock()
+	defer bridge.broker.mu.Unlock()
+	for _, receiver := range bridge.broker.receivers {
+		receiver <- msg
+	}
+	return nil
+}
+
+func (bridge *memoryBridge) Receive(ctx context.Context, handle func(ctx context.Context, msg *BridgeMessage)) error {
+	messages := make(chan *BridgeMessage, 16)
+	bridge.broker.mu.Lock()
+	bridge.broker.receivers = append(bridge.broker.receivers, messages)
+	bridge.broker.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-messages:
+			handle(ctx, msg)
+		}
+	}
+}
+
+func (bridge *memoryBridge) Close() error { return nil }
+
+type orderEvent struct {
+	ID string `json:"id"`
+}
+
+func TestBridge(t *testing.T) {
+	broker := &memoryBroker{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	local := New(WithBridge(&memoryBridge{broker}, "order.*"))
+	remote := New(WithBridge(&memoryBridge{broker}, "order.*"))
+	for _, mod := range []*Module{local, remote} {
+		go mod.Start(ctx)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		broker.mu.Lock()
+		ready := len(broker.receivers) == 2
+		broker.mu.Unlock()
+		if ready || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	received := make(chan orderEvent, 4)
+	remote.Subscribe("order.placed", func(ctx context.Context, eventType string, payload any) error {
+		order, err := Decode[orderEvent](payload)
+		received <- order
+		return err
+	})
+	var localCalls atomic.Int32
+	local.Subscribe("order.placed", func(ctx context.Context, eventType string, payload any) {
+		if _, ok := payload.(orderEvent); ok {
+			localCalls.Add(1)
+		}
+	})
+
+	local.Publish(ctx, "order.placed", orderEvent{ID: "o-1"})
+	local.Publish(ctx, "user.created", orderEvent{ID: "not bridged"})
+	select {
+	case order := <-received:
+		if order.ID != "o-1" {
+			t.Errorf("expected the bridged order, got %+v", order)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event was not bridged")
+	}
+	_ = local.Shutdown(context.Background())
+
+	if localCalls.Load() != 1 {
+		t.Errorf("expected the publisher's own echo to be skipped, got %d local deliveries", localCalls.Load())
+	}
+	if stats := local.Stats(); stats.Bridged != 1 || stats.Received != 0 {
+		t.Errorf("expected only the order event to be bridged, got %+v", stats)
+	}
+	if stats := remote.Stats(); stats.Received != 1 || stats.Bridged != 0 {
+		t.Errorf("expected received events not to be forwarded back, got %+v", stats)
+	}
+	if order, err := Decode[orderEvent](orderEvent{ID: "o-2"}); err != nil || order.ID != "o-2" {
+		t.Errorf("expected Decode to pass typed payloads through, got %+v, %v", order, err)
+	}
+}
+
+// fakeNATSServer speaks enough of the NATS protocol to route PUBs to
+// SUBs.
+func fakeNATSServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var mu sync.Mutex
+	subscribers := make(map[net.Conn]string)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				reader := bufio.NewReader(conn)
+				_, _ = conn.Write([]byte("INFO {\"server_id\":\"fake\"}\r\n"))
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 0:
+					case fields[0] == "CONNECT" && !strings.Contains(line, `"auth_token":"secret"`):
+						_, _ = conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+						return
+					case fields[0] == "PING":
+						_, _ = conn.Write([]byte("PONG\r\n"))
+					case fields[0] == "SUB":
+						mu.Lock()
+						subscribers[conn] = fields[len(fields)-1]
+						mu.Unlock()
+					case fields[0] == "PUB":
+						size, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(reader, payload); err != nil {
+							return
+						}
+						mu.Lock()
+						for subscriber, sid := range subscribers {
+							fmt.Fprintf(subscriber, "MSG %s %s %d\r\n%s", fields[1], sid, size, payload)
+						}
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+	}()
+	return "nats://" + listener.Addr().String()
+}
+
+func TestNATSBridge(t *testing.T) {
+	url := fakeNATSServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := NewNATSBridge(NATSConfig{URL: url}).Publish(ctx, &BridgeMessage{EventType: "order.placed"}); err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("expected a bad token to fail, got %v", err)
+	}
+
+	bridge := NewNATSBridge(NATSConfig{URL: url, Token: "secret"})
+	defer bridge.Close()
+	received := make(chan *BridgeMessage, 1)
+	go bridge.Receive(ctx, func(ctx context.Context, msg *BridgeMessage) { received <- msg })
+
+	deadline := time.After(time.Second)
+	for {
+		if err := bridge.Publish(ctx, &BridgeMessage{ID: "m-1", EventType: "order.placed", Payload: json.RawMessage(`{"id":"o-1"}`)}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		select {
+		case msg := <-received:
+			if msg.ID != "m-1" || msg.EventType != "order.placed" || string(msg.Payload) != `{"id":"o-1"}` {
+				t.Errorf("unexpected message %+v", msg)
+			}
+			return
+		case <-deadline:
+			t.Fatal("message was not received")
+		case <-time.After(20 * time.Millisecond): // the subscription may not be registered yet
+		}
+	}
+}
+
+func TestKafkaBridge(t *testing.T) {
+	var mu sync.Mutex
+	var published []json.RawMessage
+	var deleted bool
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case request.Method == http.MethodPost && request.URL.Path == "/topics/orders":
+			var body struct {
+				Records []struct {
+					Key   string          `json:"key"`
+					Value json.RawMessage `json:"value"`
+				} `json:"records"`
+			}
+			json.NewDecoder(request.Body).Decode(&body)
+			if request.Header.Get("Content-Type") != kafkaContentType || len(body.Records) != 1 || body.Records[0].Key != "order.placed" {
+				t.Errorf("unexpected produce request %+v", body)
+			}
+			published = append(published, body.Records[0].Value)
+			writer.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+		case request.Method == http.MethodPost && request.URL.Path == "/consumers/web":
+			fmt.Fprintf(writer, `{"instance_id":"c-1","base_uri":"%s/consumers/web/instances/c-1"}`, server.URL)
+		case request.Method == http.MethodPost && request.URL.Path == "/consumers/web/instances/c-1/subscription":
+			writer.WriteHeader(http.StatusNoContent)
+		case request.Method == http.MethodGet && request.URL.Path == "/consumers/web/instances/c-1/records":
+			records := make([]map[string]json.RawMessage, len(published))
+			for i, value := range published {
+				records[i] = map[string]json.RawMessage{"value": value}
+			}
+			published = nil
+			json.NewEncoder(writer).Encode(records)
+		case request.Method == http.MethodDelete && request.URL.Path == "/consumers/web/instances/c-1":
+			deleted = true
+			writer.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", request.Method, request.URL.Path)
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	bridge := NewKafkaBridge(KafkaConfig{URL: server.URL, Topic: "orders", Group: "web", PollInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan *BridgeMessage, 1)
+	done := make(chan error, 1)
+	go func() { done <- bridge.Receive(ctx, func(ctx context.Context, msg *BridgeMessage) { received <- msg }) }()
+
+	if err := bridge.Publish(ctx, &BridgeMessage{ID: "m-1", EventType: "order.placed", Payload: json.RawMessage(`{"id":"o-1"}`)}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	select {
+	case msg := <-received:
+		if msg.ID != "m-1" || string(msg.Payload) != `{"id":"o-1"}` {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not received")
+	}
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if !deleted {
+		t.Error("expected the consumer to be deleted when Receive returns")
+	}
+}
+
+func recordedOK(ctx context.Context, eventType string, payload any) error { return nil }
+
+func TestHistory(t *testing.T) {
+	mod := New(WithHistory(2))
+	mod.Subscribe("order.placed", recordedOK)
+	mod.Subscribe("order.placed", func(ctx context.Context, eventType string, payload any) error { return errors.New("out of stock") })
+
+	mod.Publish(context.Background(), "order.placed", map[string]any{"id": "o-1"})
+	mod.Publish(chassis.WithRequestID(context.Background(), "req-1"), "order.placed", map[string]any{"id": "o-2"})
+	mod.Publish(context.Background(), "order.shipped", map[string]any{"id": "o-1"})
+
+	records := mod.Recent("", 0).([]Record)
+	if len(records) != 2 || records[0].EventType != "order.shipped" || records[1].RequestID != "req-1" {
+		t.Fatalf("expected the last two events, newest first, got %+v", records)
+	}
+	outcomes := records[1].Outcomes
+	if len(outcomes) != 2 || !strings.HasSuffix(outcomes[0].Handler, ".recordedOK") || !outcomes[0].Done || outcomes[0].Error != "" {
+		t.Errorf("expected the first handler to succeed, got %+v", outcomes)
+	}
+	if outcomes[1].Error != "out of stock" || outcomes[1].Attempts != 1 {
+		t.Errorf("expected the second handler's error, got %+v", outcomes[1])
+	}
+	if placed := mod.Recent("order.placed", 10).([]Record); len(placed) != 1 || placed[0].Payload.(map[string]any)["id"] != "o-2" {
+		t.Errorf("expected one order.placed event, got %+v", placed)
+	}
+
+	recorder := httptest.NewRecorder()
+	mod.RecentHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/events?request_id=req-1", nil))
+	var body struct {
+		Events []Record `json:"events"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || len(body.Events) != 1 || body.Events[0].RequestID != "req-1" {
+		t.Errorf("expected the request's event, got %d %s", recorder.Code, recorder.Body)
+	}
+	if endpoint := mod.Endpoints()[0]; endpoint.Enabled || endpoint.DevOnly || endpoint.Permission == "" {
+		t.Errorf("expected the history endpoint off and guarded by default, got %+v", endpoint)
+	}
+
+	mod.PublishAsync(context.Background(), "order.placed", map[string]any{"id": "o-3"})
+	_ = mod.Shutdown(context.Background())
+	if async := mod.Recent("order.placed", 1).([]Record)[0]; !async.Async || !async.Outcomes[1].Done || async.Outcomes[1].Error == "" {
+		t.Errorf("expected the async outcomes once delivered, got %+v", async)
+	}
+
+	if records := New(WithHistory(0)).Recent("", 0).([]Record); len(records) != 0 {
+		t.Errorf("expected no history when off, got %+v", records)
+	}
+}
+
+func TestModule_SubscribeFiltered(t *testing.T) {
+	mod := New()
+	var received []any
+	var mu sync.Mutex
+	mod.SubscribeFiltered("org.created", func(payload any) bool {
+		return payload.(map[string]string)["plan"] == "trial"
+	}, func(ctx context.Context, eventType string, payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, payload)
+	})
+	mod.SubscribeFiltered("org.created", func(payload any) bool { panic("bad predicate") }, func(ctx context.Context, eventType string, payload any) {
+		t.Error("expected a panicking predicate not to match")
+	})
+
+	if count := mod.SubscriberCount("org.created"); count != 2 {
+		t.Errorf("expected filtered subscribers to count, got %d", count)
+	}
+
+	mod.Publish(context.Background(), "org.created", map[string]string{"plan": "trial"})
+	mod.Publish(context.Background(), "org.created", map[string]string{"plan": "pro"})
+	mod.PublishAsync(context.Background(), "org.created", map[string]string{"plan": "trial"})
+	_ = mod.Shutdown(context.Background())
+
+	if len(received) != 2 {
+		t.Errorf("expected the two trial events, got %v", received)
+	}
+	if stats := mod.Stats(); stats.Delivered != 2 || stats.Filtered != 4 {
+		t.Errorf("expected 2 delivered and 4 filtered, got %+v", stats)
+	}
+}
@@ -0,0 +1,226 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+// DefaultHistorySize is how many events the history keeps in the
+// development and test envs, unless WithHistory or events.history_size
+// says otherwise. Elsewhere the history is off by default.
+const DefaultHistorySize = 200
+
+// Record is a published event in the history, with what each subscriber
+// made of it.
+type Record struct {
+	ID          string    `json:"id"`
+	EventType   string    `json:"event_type"`
+	Payload     any       `json:"payload"`
+	PublishedAt time.Time `json:"published_at"`
+	RequestID   string    `json:"request_id,omitempty"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	Async       bool      `json:"async"`
+	Remote      bool      `json:"remote"`             // received from the bridge
+	Rejected    string    `json:"rejected,omitempty"` // why schema validation dropped it
+	Outcomes    []Outcome `json:"outcomes"`
+}
+
+// Outcome is one subscriber's handling of a recorded event. Async
+// outcomes are filled in when the last attempt finishes.
+type Outcome struct {
+	Handler  string        `json:"handler"` // the handler function's name
+	Done     bool          `json:"done"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"` // from the first attempt to the end of the last
+}
+
+// history is a ring buffer of the latest records.
+type history struct {
+	mu      sync.Mutex
+	records []*Record
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{records: make([]*Record, size)}
+}
+
+// add records an event, with an outcome per subscription, and returns the
+// record to fill in.
+func (history *history) add(record *Record, subs []*subscription) *Record {
+	record.Outcomes = make([]Outcome, len(subs))
+	for i, sub := range subs {
+		record.Outcomes[i].Handler = sub.name
+	}
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	history.records[history.next] = record
+	history.next = (history.next + 1) % len(history.records)
+	if history.next == 0 {
+		history.full = true
+	}
+	return record
+}
+
+// finish records the outcome of a record's subscriber.
+func (history *history) finish(record *Record, index, attempts int, err error, duration time.Duration) {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	outcome := &record.Outcomes[index]
+	outcome.Done = true
+	outcome.Attempts = attempts
+	outcome.Duration = duration
+	outcome.Error = ""
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+}
+
+// recent returns copies of the newest records matching keep, newest
+// first, up to limit (0 for all).
+func (history *history) recent(keep func(*Record) bool, limit int) []Record {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	count := history.next
+	if history.full {
+		count = len(history.records)
+	}
+	records := make([]Record, 0)
+	for i := 1; i <= count && (limit <= 0 || len(records) < limit); i++ {
+		record := history.records[(history.next-i+len(history.records))%len(history.records)]
+		if keep(record) {
+			copied := *record
+			copied.Outcomes = slices.Clone(record.Outcomes)
+			records = append(records, copied)
+		}
+	}
+	return records
+}
+
+// WithHistory keeps the last size published events, with their
+// subscribers' outcomes, for Recent and the events_recent endpoint. Zero
+// turns the history off.
+func WithHistory(size int) Option {
+	return func(mod *Module) {
+		mod.historySize = &size
+	}
+}
+
+// Recent returns up to limit of the latest recorded events of the type,
+// or of every type for "", newest first. The result is a []Record, empty
+// when the history is off.
+func (mod *Module) Recent(eventType string, limit int) any {
+	return mod.recent(func(record *Record) bool { return eventType == "" || record.EventType == eventType }, limit)
+}
+
+// recent is the internal implementation.
+func (mod *Module) recent(keep func(*Record) bool, limit int) []Record {
+	if mod.history == nil {
+		return []Record{}
+	}
+	return mod.history.recent(keep, limit)
+}
+
+// newRecord starts a history record of an event.
+func newRecord(ctx context.Context, eventType string, payload any) *Record {
+	return &Record{
+		ID:          uuid.New().String(),
+		EventType:   eventType,
+		Payload:     payload,
+		PublishedAt: time.Now(),
+		RequestID:   chassis.RequestIDFromContext(ctx),
+		TenantID:    chassis.TenantFromContext(ctx),
+	}
+}
+
+// record adds an event to the history, returning nil when it is off.
+func (mod *Module) record(record *Record, subs []*subscription) *Record {
+	if mod.history == nil {
+		return nil
+	}
+	return mod.history.add(record, subs)
+}
+
+// finish records a subscriber's outcome, if the event was recorded.
+func (mod *Module) finish(record *Record, index, attempts int, err error, started time.Time) {
+	if record != nil {
+		mod.history.finish(record, index, attempts, err, time.Since(started))
+	}
+}
+
+// handlerName returns the name of a handler's function.
+func handlerName(handler any) string {
+	value := reflect.ValueOf(handler)
+	if value.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", handler)
+	}
+	if fn := runtime.FuncForPC(value.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return "unknown"
+}
+
+// maxRecentLimit caps the limit of the events_recent endpoint.
+const maxRecentLimit = 1000
+
+// RecentHandler serves the history as JSON, newest first. The type and
+// request_id query parameters filter it, such as to see what fired during
+// one request (see chassis.RequestIDMiddleware), and limit caps it
+// (default 50).
+func (mod *Module) RecentHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			api.MethodNotAllowed(writer, request)
+			return
+		}
+		query := request.URL.Query()
+		limit := 50
+		if value := query.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				api.Error(writer, request, chassis.CodeInvalidArgument, "limit must be a positive integer")
+				return
+			}
+			limit = min(parsed, maxRecentLimit)
+		}
+		eventType, requestID := query.Get("type"), query.Get("request_id")
+		records := mod.recent(func(record *Record) bool {
+			return (eventType == "" || record.EventType == eventType) && (requestID == "" || record.RequestID == requestID)
+		}, limit)
+
+		// Payloads that don't encode are shown as Go values
+		for i := range records {
+			if _, err := json.Marshal(records[i].Payload); err != nil {
+				records[i].Payload = fmt.Sprintf("%+v", records[i].Payload)
+			}
+		}
+		api.WriteJSON(writer, http.StatusOK, map[string]any{"events": records})
+	})
+}
+
+// Endpoints serves the history at /debug/events. Payloads may hold
+// personal data, so it is mounted only when http.expose.events_recent
+// enables it, and only to logged-in users unless that says otherwise.
+// Implements chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{{
+		Name:       "events_recent",
+		Path:       "/debug/events",
+		Handler:    mod.RecentHandler(),
+		Permission: api.PermissionAuthenticated,
+	}}
+}
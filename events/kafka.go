@@ -0,0 +1,149 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KafkaConfig holds Kafka REST Proxy settings.
+type KafkaConfig struct {
+	URL   string // REST Proxy base URL, defaults to http://localhost:8082
+	Topic string // defaults to DefaultBridgeSubject
+
+	// Group is the consumer group. Processes in one group share the
+	// events; by default each process gets a group of its own, so all of
+	// them receive every event.
+	Group string
+
+	PollInterval time.Duration // wait between empty polls, defaults to 1s
+	Client       *http.Client  // defaults to http.DefaultClient
+}
+
+// KafkaBridge bridges events over a Kafka topic through the Kafka REST
+// Proxy v2 API, so no Kafka client library is needed. Events are keyed by
+// type, keeping each type's events in order.
+type KafkaBridge struct {
+	config KafkaConfig
+}
+
+// kafkaContentType is the REST Proxy's JSON embedded format.
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// NewKafkaBridge creates a Kafka bridge.
+func NewKafkaBridge(config KafkaConfig) *KafkaBridge {
+	if config.URL == "" {
+		config.URL = "http://localhost:8082"
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	if config.Topic == "" {
+		config.Topic = DefaultBridgeSubject
+	}
+	if config.Group == "" {
+		config.Group = "chassis-events-" + uuid.New().String()
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &KafkaBridge{config: config}
+}
+
+func (bridge *KafkaBridge) Publish(ctx context.Context, msg *BridgeMessage) error {
+	body := map[string]any{"records": []map[string]any{{"key": msg.EventType, "value": msg}}}
+	return bridge.do(ctx, http.MethodPost, bridge.config.URL+"/topics/"+url.PathEscape(bridge.config.Topic), body, nil)
+}
+
+func (bridge *KafkaBridge) Receive(ctx context.Context, handle func(ctx context.Context, msg *BridgeMessage)) error {
+	var consumer struct {
+		BaseURI string `json:"base_uri"`
+	}
+	create := map[string]any{"name": uuid.New().String(), "format": "json", "auto.offset.reset": "latest"}
+	if err := bridge.do(ctx, http.MethodPost, bridge.config.URL+"/consumers/"+url.PathEscape(bridge.config.Group), create, &consumer); err != nil {
+		return err
+	}
+	defer func() {
+		_ = bridge.do(context.WithoutCancel(ctx), http.MethodDelete, consumer.BaseURI, nil, nil)
+	}()
+	if err := bridge.do(ctx, http.MethodPost, consumer.BaseURI+"/subscription", map[string]any{"topics": []string{bridge.config.Topic}}, nil); err != nil {
+		return err
+	}
+
+	for {
+		var records []struct {
+			Value BridgeMessage `json:"value"`
+		}
+		if err := bridge.do(ctx, http.MethodGet, consumer.BaseURI+"/records", nil, &records); err != nil {
+			return err
+		}
+		for _, record := range records {
+			handle(ctx, &record.Value)
+		}
+		if len(records) > 0 {
+			continue
+		}
+		timer := time.NewTimer(bridge.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Close does nothing; consumers are deleted when Receive returns.
+func (bridge *KafkaBridge) Close() error {
+	return nil
+}
+
+// do sends a REST Proxy request and decodes the JSON response into out,
+// if non-nil.
+func (bridge *KafkaBridge) do(ctx context.Context, method, target string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", kafkaContentType)
+	}
+	request.Header.Set("Accept", kafkaContentType)
+
+	response, err := bridge.config.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(response.Body, 64<<10)).Decode(&failure)
+		return fmt.Errorf("kafka: %s %s: HTTP %d %s", method, target, response.StatusCode, failure.Message)
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("kafka: failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBridgeSubject is the NATS subject prefix and Kafka topic bridges
+// use by default.
+const DefaultBridgeSubject = "chassis.events"
+
+// NATSConfig holds NATS connection settings.
+type NATSConfig struct {
+	URL      string // defaults to nats://localhost:4222
+	Subject  string // subject prefix, events go to <Subject>.<event type>; defaults to DefaultBridgeSubject
+	Token    string
+	User     string
+	Password string
+
+	// QueueGroup, if set, shares each event among the group's processes
+	// instead of delivering it to all of them.
+	QueueGroup string
+}
+
+// NATSBridge bridges events over NATS core pub/sub, speaking the NATS
+// text protocol directly. Publishing and receiving use separate
+// connections; the publishing one is redialled after a failure.
+type NATSBridge struct {
+	config NATSConfig
+
+	mu   sync.Mutex
+	conn *natsConn // publishing connection, nil until first use
+}
+
+// NewNATSBridge creates a NATS bridge. It connects on first use.
+func NewNATSBridge(config NATSConfig) *NATSBridge {
+	if config.URL == "" {
+		config.URL = "nats://localhost:4222"
+	}
+	if config.Subject == "" {
+		config.Subject = DefaultBridgeSubject
+	}
+	config.Subject = strings.TrimSuffix(config.Subject, ".")
+	return &NATSBridge{config: config}
+}
+
+func (bridge *NATSBridge) Publish(ctx context.Context, msg *BridgeMessage) error {
+	if msg.EventType == "" || strings.ContainsAny(msg.EventType, " \t\r\n") {
+		return fmt.Errorf("nats: event type %q is not a valid subject", msg.EventType)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	if bridge.conn == nil {
+		conn, err := dialNATS(ctx, bridge.config)
+		if err != nil {
+			return err
+		}
+		go conn.discard()
+		bridge.conn = conn
+	}
+	if err := bridge.conn.write(ctx, fmt.Sprintf("PUB %s.%s %d\r\n%s\r\n", bridge.config.Subject, msg.EventType, len(data), data)); err != nil {
+		_ = bridge.conn.Close()
+		bridge.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (bridge *NATSBridge) Receive(ctx context.Context, handle func(ctx context.Context, msg *BridgeMessage)) error {
+	conn, err := dialNATS(ctx, bridge.config)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	subscribe := "SUB " + bridge.config.Subject + ".> "
+	if bridge.config.QueueGroup != "" {
+		subscribe += bridge.config.QueueGroup + " "
+	}
+	if err := conn.write(ctx, subscribe+"1\r\n"); err != nil {
+		return err
+	}
+	for {
+		payload, err := conn.next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var msg BridgeMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			continue // not from a bridge
+		}
+		handle(ctx, &msg)
+	}
+}
+
+func (bridge *NATSBridge) Close() error {
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	if bridge.conn == nil {
+		return nil
+	}
+	err := bridge.conn.Close()
+	bridge.conn = nil
+	return err
+}
+
+// natsConn is a NATS protocol connection.
+type natsConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// natsTimeout bounds dialling and each write.
+const natsTimeout = 10 * time.Second
+
+// dialNATS connects and authenticates, waiting for the server's PONG so
+// bad credentials fail here.
+func dialNATS(ctx context.Context, config NATSConfig) (*natsConn, error) {
+	parsed, err := url.Parse(config.URL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", config.URL)
+	}
+	host := parsed.Host
+	if parsed.Port() == "" {
+		host = net.JoinHostPort(parsed.Hostname(), "4222")
+	}
+	dialer := net.Dialer{Timeout: natsTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	conn := &natsConn{Conn: raw, reader: bufio.NewReader(raw)}
+
+	_ = conn.SetReadDeadline(time.Now().Add(natsTimeout))
+	line, err := conn.readLine()
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("nats: expected INFO, got %q (%v)", line, err)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "chassis-events", "lang": "go", "protocol": 1}
+	user, password := config.User, config.Password
+	if parsed.User != nil && user == "" {
+		user = parsed.User.Username()
+		password, _ = parsed.User.Password()
+	}
+	if user != "" {
+		options["user"], options["pass"] = user, password
+	}
+	if config.Token != "" {
+		options["auth_token"] = config.Token
+	}
+	connect, _ := json.Marshal(options)
+	if err := conn.write(ctx, "CONNECT "+string(connect)+"\r\nPING\r\n"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	for {
+		line, err := conn.readLine()
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			_ = conn.Close()
+			return nil, fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+func (conn *natsConn) readLine() (string, error) {
+	line, err := conn.reader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (conn *natsConn) write(ctx context.Context, data string) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	deadline := time.Now().Add(natsTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetWriteDeadline(deadline)
+	if _, err := conn.Conn.Write([]byte(data)); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+// next returns the payload of the next MSG, answering the server's PINGs.
+func (conn *natsConn) next(ctx context.Context) ([]byte, error) {
+	for {
+		line, err := conn.readLine()
+		if err != nil {
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+		switch {
+		case line == "PING":
+			if err := conn.write(ctx, "PONG\r\n"); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return nil, fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <size>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || len(fields) < 4 {
+				return nil, fmt.Errorf("nats: malformed %q", line)
+			}
+			payload := make([]byte, size+2) // with the trailing CRLF
+			if _, err := io.ReadFull(conn.reader, payload); err != nil {
+				return nil, fmt.Errorf("nats: %w", err)
+			}
+			return payload[:size], nil
+		}
+	}
+}
+
+// discard reads and drops everything a publishing connection receives,
+// answering PINGs so the server keeps it open, until it fails or is
+// closed. Publish redials after the next failed write.
+func (conn *natsConn) discard() {
+	for {
+		if _, err := conn.next(context.Background()); err != nil {
+			_ = conn.Close()
+			return
+		}
+	}
+}
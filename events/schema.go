@@ -0,0 +1,512 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrInvalidSchema  = chassis.NewError(chassis.CodeInvalidArgument, "invalid event schema")
+	ErrInvalidPayload = chassis.NewError(chassis.CodeInvalidArgument, "event payload does not match its schema")
+	ErrUnknownVersion = chassis.NewError(chassis.CodeNotFound, "event schema version not registered")
+	ErrBreakingChange = chassis.NewError(chassis.CodeFailedPrecondition, "event schema changed incompatibly without a new version")
+)
+
+// EventSchema declares a version of an event type's payload.
+type EventSchema struct {
+	Type    string
+	Version int    // from 1; publishers publish the highest registered version
+	Schema  string // JSON Schema of the payload, see Schema
+
+	// Downgrade converts a payload of this version into one of the
+	// previous version, for subscribers that asked for it with
+	// SubscribeVersion. Without it they can't receive this version.
+	Downgrade func(payload any) (any, error)
+}
+
+// Schema is the subset of JSON Schema that payloads are checked against:
+// type, properties, required, additionalProperties, items and enum. Other
+// keywords are accepted and ignored. Payloads are checked as they encode
+// to JSON, so struct payloads without json tags have their Go field names.
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+}
+
+// schemaTypes is the "type" keyword, a name or a list of names.
+type schemaTypes []string
+
+func (types *schemaTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*types = schemaTypes{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("type must be a name or a list of names")
+	}
+	*types = names
+	return nil
+}
+
+// ParseSchema parses a JSON Schema document, failing with ErrInvalidSchema
+// on malformed JSON or unknown types.
+func ParseSchema(document string) (*Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal([]byte(document), &schema); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	if err := schema.check(""); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// check rejects unknown type names anywhere in the schema.
+func (schema *Schema) check(path string) error {
+	for _, name := range schema.Type {
+		switch name {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%w: unknown type %q at %s", ErrInvalidSchema, name, displayPath(path))
+		}
+	}
+	for name, property := range schema.Properties {
+		if property == nil {
+			return fmt.Errorf("%w: empty property %q at %s", ErrInvalidSchema, name, displayPath(path))
+		}
+		if err := property.check(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if schema.Items != nil {
+		return schema.Items.check(path + "[]")
+	}
+	return nil
+}
+
+// Validate checks a payload decoded from JSON against the schema and
+// returns a description of each mismatch.
+func (schema *Schema) Validate(value any) []string {
+	var problems []string
+	schema.validate("", value, &problems)
+	return problems
+}
+
+func (schema *Schema) validate(path string, value any, problems *[]string) {
+	if len(schema.Type) > 0 && !slices.ContainsFunc(schema.Type, func(name string) bool { return isType(value, name) }) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", displayPath(path), strings.Join(schema.Type, " or "), typeOf(value)))
+		return
+	}
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(allowed any) bool { return jsonEqual(allowed, value) }) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not one of the allowed values", displayPath(path), value))
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := typed[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required property %q", displayPath(path), name))
+			}
+		}
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					*problems = append(*problems, fmt.Sprintf("%s: unexpected property %q", displayPath(path), name))
+				}
+				continue
+			}
+			property.validate(path+"."+name, typed[name], problems)
+		}
+	case []any:
+		if schema.Items != nil {
+			for i, item := range typed {
+				schema.Items.validate(path+"["+strconv.Itoa(i)+"]", item, problems)
+			}
+		}
+	}
+}
+
+// isType reports whether a JSON-decoded value has the named type.
+func isType(value any, name string) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// typeOf names the JSON type of a decoded value.
+func typeOf(value any) string {
+	for _, name := range []string{"object", "array", "string", "integer", "number", "boolean", "null"} {
+		if isType(value, name) {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares two values as JSON.
+func jsonEqual(a, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "payload"
+	}
+	return "payload" + path
+}
+
+// CheckCompatibility returns the changes from old to next that break
+// subscribers written against old: removed properties, properties no
+// longer required, changed types, and added enum values. Adding optional
+// properties, requiring more, or loosening additionalProperties doesn't
+// break them.
+func CheckCompatibility(old, next *Schema) []string {
+	var changes []string
+	compareSchemas("", old, next, &changes)
+	return changes
+}
+
+func compareSchemas(path string, old, next *Schema, changes *[]string) {
+	if len(old.Type) > 0 {
+		for _, name := range next.Type {
+			if !slices.Contains(old.Type, name) && !(name == "integer" && slices.Contains(old.Type, "number")) {
+				*changes = append(*changes, fmt.Sprintf("%s: type %s added to %s", displayPath(path), name, strings.Join(old.Type, " or ")))
+			}
+		}
+		if len(next.Type) == 0 {
+			*changes = append(*changes, fmt.Sprintf("%s: type constraint %s removed", displayPath(path), strings.Join(old.Type, " or ")))
+		}
+	}
+	if len(old.Enum) > 0 {
+		for _, value := range next.Enum {
+			if !slices.ContainsFunc(old.Enum, func(allowed any) bool { return jsonEqual(allowed, value) }) {
+				*changes = append(*changes, fmt.Sprintf("%s: enum value %v added", displayPath(path), value))
+			}
+		}
+		if len(next.Enum) == 0 {
+			*changes = append(*changes, fmt.Sprintf("%s: enum removed", displayPath(path)))
+		}
+	}
+	for _, name := range old.Required {
+		if !slices.Contains(next.Required, name) {
+			*changes = append(*changes, fmt.Sprintf("%s: property %q no longer required", displayPath(path), name))
+		}
+	}
+
+	names := make([]string, 0, len(old.Properties))
+	for name := range old.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := next.Properties[name]
+		if !ok {
+			*changes = append(*changes, fmt.Sprintf("%s: property %q removed", displayPath(path), name))
+			continue
+		}
+		compareSchemas(path+"."+name, old.Properties[name], property, changes)
+	}
+	if old.Items != nil {
+		if next.Items == nil {
+			*changes = append(*changes, fmt.Sprintf("%s: items schema removed", displayPath(path)))
+		} else {
+			compareSchemas(path+"[]", old.Items, next.Items, changes)
+		}
+	}
+}
+
+// registeredSchema is a parsed EventSchema.
+type registeredSchema struct {
+	EventSchema
+	parsed *Schema
+}
+
+// WithSchemas registers payload schemas, as RegisterSchema does.
+func WithSchemas(schemas ...EventSchema) Option {
+	return func(mod *Module) {
+		mod.pendingSchemas = append(mod.pendingSchemas, schemas...)
+	}
+}
+
+// WithSchemaValidation turns payload validation on or off. By default
+// payloads are validated when chassis.env is "development" or "test";
+// events.validate_schemas overrides both.
+func WithSchemaValidation(enabled bool) Option {
+	return func(mod *Module) {
+		mod.validateSchemas = &enabled
+	}
+}
+
+// WithSchemaLock keeps the registered schemas in a JSON file at path,
+// checked in next to the code. At startup every registered version is
+// compared with the locked one: a breaking change (see
+// CheckCompatibility) without a new version fails Init with
+// ErrBreakingChange; anything else updates the file.
+func WithSchemaLock(path string) Option {
+	return func(mod *Module) {
+		mod.schemaLock = path
+	}
+}
+
+// RegisterSchema declares a version of an event type's payload. Versions
+// of a type may be registered in any order; each may be registered once.
+func (mod *Module) RegisterSchema(schema EventSchema) error {
+	if schema.Type == "" || schema.Version < 1 {
+		return fmt.Errorf("%w: schemas need an event type and a version from 1", ErrInvalidSchema)
+	}
+	parsed, err := ParseSchema(schema.Schema)
+	if err != nil {
+		return fmt.Errorf("%s v%d: %w", schema.Type, schema.Version, err)
+	}
+
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	versions := mod.schemas[schema.Type]
+	if slices.ContainsFunc(versions, func(registered *registeredSchema) bool { return registered.Version == schema.Version }) {
+		return fmt.Errorf("%w: %s v%d is already registered", ErrInvalidSchema, schema.Type, schema.Version)
+	}
+	versions = append(versions, &registeredSchema{EventSchema: schema, parsed: parsed})
+	slices.SortFunc(versions, func(a, b *registeredSchema) int { return a.Version - b.Version })
+	mod.schemas[schema.Type] = versions
+	return nil
+}
+
+// Schemas returns the registered schemas of an event type, oldest version
+// first.
+func (mod *Module) Schemas(eventType string) []EventSchema {
+	mod.mu.RLock()
+	defer mod.mu.RUnlock()
+	schemas := make([]EventSchema, len(mod.schemas[eventType]))
+	for i, registered := range mod.schemas[eventType] {
+		schemas[i] = registered.EventSchema
+	}
+	return schemas
+}
+
+// Validate checks a payload against the latest registered schema of its
+// event type, failing with ErrInvalidPayload, with the mismatches as
+// details. Event types without a schema always pass.
+func (mod *Module) Validate(eventType string, payload any) error {
+	mod.mu.RLock()
+	versions := mod.schemas[eventType]
+	mod.mu.RUnlock()
+	if len(versions) == 0 {
+		return nil
+	}
+	latest := versions[len(versions)-1]
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+	if problems := latest.parsed.Validate(decoded); len(problems) > 0 {
+		return &chassis.Error{
+			Code:    chassis.CodeInvalidArgument,
+			Message: fmt.Sprintf("%s v%d", eventType, latest.Version),
+			Details: map[string]any{"problems": problems},
+			Err:     ErrInvalidPayload,
+		}
+	}
+	return nil
+}
+
+// SubscribeVersion registers a handler that receives payloads of the
+// given schema version of an event type. Payloads are published at the
+// latest version and converted down with each newer version's Downgrade,
+// so subscribers keep working while publishers move on. It fails with
+// ErrUnknownVersion for versions that aren't registered.
+func (mod *Module) SubscribeVersion(eventType string, version int, handler any) (func(), error) {
+	handlerFunc := toHandler(handler)
+	if handlerFunc == nil {
+		return nil, fmt.Errorf("unsupported handler type %T", handler)
+	}
+	mod.mu.RLock()
+	registered := slices.ContainsFunc(mod.schemas[eventType], func(schema *registeredSchema) bool { return schema.Version == version })
+	mod.mu.RUnlock()
+	if !registered {
+		return nil, fmt.Errorf("%s v%d: %w", eventType, version, ErrUnknownVersion)
+	}
+
+	downgraded := func(ctx context.Context, eventType string, payload any) error {
+		converted, err := mod.downgrade(eventType, version, payload)
+		if err != nil {
+			return err
+		}
+		return handlerFunc(ctx, eventType, converted)
+	}
+	return mod.subscribe(eventType, &subscription{handler: downgraded, retry: mod.defaultRetry, name: handlerName(handler)}), nil
+}
+
+// downgrade converts a payload of the latest version of an event type to
+// the given version.
+func (mod *Module) downgrade(eventType string, version int, payload any) (any, error) {
+	mod.mu.RLock()
+	versions := mod.schemas[eventType]
+	mod.mu.RUnlock()
+	for i := len(versions) - 1; i >= 0 && versions[i].Version > version; i-- {
+		if versions[i].Downgrade == nil {
+			return nil, fmt.Errorf("%s v%d has no downgrade to an older version", eventType, versions[i].Version)
+		}
+		var err error
+		if payload, err = versions[i].Downgrade(payload); err != nil {
+			return nil, fmt.Errorf("failed to downgrade %s v%d: %w", eventType, versions[i].Version, err)
+		}
+	}
+	return payload, nil
+}
+
+// checkPublished validates a payload before it is published, when
+// validation is on, and reports whether to deliver it.
+func (mod *Module) checkPublished(ctx context.Context, eventType string, payload any) bool {
+	if !mod.validating() {
+		return true
+	}
+	if err := mod.Validate(eventType, payload); err != nil {
+		mod.rejected.Add(1)
+		var problems any
+		var chassisErr *chassis.Error
+		if errors.As(err, &chassisErr) {
+			problems = chassisErr.Details
+		}
+		mod.logger().ErrorContext(ctx, "event payload rejected", "event", eventType, "error", err, "details", problems)
+		event := newRecord(ctx, eventType, payload)
+		event.Rejected = err.Error()
+		mod.record(event, nil)
+		return false
+	}
+	return true
+}
+
+// validating reports whether published payloads are validated.
+func (mod *Module) validating() bool {
+	if mod.validateSchemas != nil {
+		return *mod.validateSchemas
+	}
+	if mod.app == nil {
+		return false
+	}
+	env := mod.app.Config().Env
+	return env == "development" || env == "test"
+}
+
+// lockedSchema is an entry of the schema lock file.
+type lockedSchema struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// checkSchemaLock compares the registered schemas with the lock file and
+// rewrites it, failing with ErrBreakingChange on breaking changes.
+func (mod *Module) checkSchemaLock() error {
+	locked := make(map[string]lockedSchema)
+	data, err := os.ReadFile(mod.schemaLock)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read schema lock: %w", err)
+	default:
+		var entries []lockedSchema
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("failed to parse schema lock %s: %w", mod.schemaLock, err)
+		}
+		for _, entry := range entries {
+			locked[entry.Type+"@"+strconv.Itoa(entry.Version)] = entry
+		}
+	}
+
+	mod.mu.RLock()
+	types := make([]string, 0, len(mod.schemas))
+	for eventType := range mod.schemas {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	var breaking []string
+	entries := make([]lockedSchema, 0)
+	for _, eventType := range types {
+		for _, registered := range mod.schemas[eventType] {
+			entry := lockedSchema{Type: eventType, Version: registered.Version, Schema: json.RawMessage(registered.Schema)}
+			if previous, ok := locked[eventType+"@"+strconv.Itoa(registered.Version)]; ok {
+				old, err := ParseSchema(string(previous.Schema))
+				if err != nil {
+					mod.mu.RUnlock()
+					return fmt.Errorf("schema lock %s: %s v%d: %w", mod.schemaLock, eventType, registered.Version, err)
+				}
+				for _, change := range CheckCompatibility(old, registered.parsed) {
+					breaking = append(breaking, fmt.Sprintf("%s v%d: %s", eventType, registered.Version, change))
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	mod.mu.RUnlock()
+
+	if len(breaking) > 0 {
+		return &chassis.Error{
+			Code:    chassis.CodeFailedPrecondition,
+			Message: strings.Join(breaking, "; "),
+			Details: map[string]any{"changes": breaking},
+			Err:     ErrBreakingChange,
+		}
+	}
+
+	data, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema lock: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(mod.schemaLock), 0755); err != nil {
+		return fmt.Errorf("failed to write schema lock: %w", err)
+	}
+	if err := os.WriteFile(mod.schemaLock, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write schema lock: %w", err)
+	}
+	return nil
+}
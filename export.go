@@ -0,0 +1,115 @@
+package chassis
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"time"
+)
+
+var ErrInvalidExportPath = NewError(CodeInvalidArgument, "invalid export file name")
+
+// ExportWriter receives the files of a data export, such as the zip
+// bundles written by the orgs module's Export and the users module's
+// ExportData.
+type ExportWriter interface {
+	// WriteJSON adds a file holding value as indented JSON.
+	WriteJSON(name string, value any) error
+
+	// Create adds a file and returns a writer for its content, valid until
+	// the next call.
+	Create(name string) (io.Writer, error)
+}
+
+// OrgExporter is implemented by modules that keep data about
+// organizations. Exporting an organization writes the files of every
+// registered exporter under a directory named after its module, so an
+// org's bundle holds its storage objects, notifications and so on next to
+// its members.
+type OrgExporter interface {
+	ExportOrg(ctx context.Context, orgID string, export ExportWriter) error
+}
+
+// UserExporter is implemented by modules that keep data about users.
+// Exporting a user's data writes the files of every registered exporter
+// under a directory named after its module, like OrgExporter.
+type UserExporter interface {
+	ExportUser(ctx context.Context, userID string, export ExportWriter) error
+}
+
+// ZipExport is an ExportWriter that writes a zip archive. Dir returns
+// views that write under a directory, one per module.
+type ZipExport struct {
+	zip      *zip.Writer
+	modified time.Time
+	files    []string
+}
+
+// NewZipExport creates an export writing a zip archive to writer. Close
+// it to finish the archive.
+func NewZipExport(writer io.Writer) *ZipExport {
+	return &ZipExport{zip: zip.NewWriter(writer), modified: time.Now().UTC(), files: make([]string, 0)}
+}
+
+// Dir returns a view of the export that adds files under dir.
+func (export *ZipExport) Dir(dir string) ExportWriter {
+	return &zipDir{export: export, prefix: path.Clean(dir) + "/"}
+}
+
+// Files returns the names of the files added so far.
+func (export *ZipExport) Files() []string {
+	return export.files
+}
+
+// Create adds a file. Names are rooted at the archive, so ".." can't
+// climb out of it.
+func (export *ZipExport) Create(name string) (io.Writer, error) {
+	return export.create("", name)
+}
+
+// WriteJSON adds a file holding value as indented JSON.
+func (export *ZipExport) WriteJSON(name string, value any) error {
+	return writeJSON(export, name, value)
+}
+
+// Close finishes the archive. It doesn't close the underlying writer.
+func (export *ZipExport) Close() error {
+	return export.zip.Close()
+}
+
+func (export *ZipExport) create(prefix, name string) (io.Writer, error) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return nil, ErrInvalidExportPath
+	}
+	name = prefix + name
+	export.files = append(export.files, name)
+	return export.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: export.modified})
+}
+
+// zipDir is a directory of a ZipExport.
+type zipDir struct {
+	export *ZipExport
+	prefix string
+}
+
+func (dir *zipDir) Create(name string) (io.Writer, error) {
+	return dir.export.create(dir.prefix, name)
+}
+
+func (dir *zipDir) WriteJSON(name string, value any) error {
+	return writeJSON(dir, name, value)
+}
+
+// writeJSON adds a file holding value as indented JSON to export.
+func writeJSON(export ExportWriter, name string, value any) error {
+	writer, err := export.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
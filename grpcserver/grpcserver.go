@@ -0,0 +1,414 @@
+// Package grpcserver serves gRPC while a chassis app runs, the counterpart
+// of api.Server for internal services that talk to the app without HTTP.
+//
+// # Usage
+//
+// Register the module after the modules its services use. Modules
+// implementing ServiceRegistrant register their services when the server
+// starts; others can be added with Register:
+//
+//	grpcMod := grpcserver.New(grpcserver.WithAddr(":9090"))
+//	grpcMod.Register(&billingpb.BillingService_ServiceDesc, billingService)
+//
+//	app := chassis.New(chassis.WithModules(users.New(), auth.New(), orgs.New(), permissions.New(), grpcMod))
+//	err := app.Run(ctx)
+//
+// The module implements chassis.Service: app.Run listens, and shutdown
+// stops gracefully, letting in-flight calls finish within the shutdown
+// timeout.
+//
+// # Authentication
+//
+// Clients authenticate with a session token, sent as
+// "authorization: Bearer <token>" metadata. AuthService.Login issues one.
+// Valid tokens put the session in the handler's context, so
+// auth.UserIDFromContext works as it does behind auth.RequireAuth; invalid
+// ones are rejected with Unauthenticated. Handlers also get the app in
+// their context (chassis.FromContext), and errors carrying a chassis error
+// code are returned with the matching gRPC status.
+//
+// # Built-in services
+//
+// The chassispb package defines UsersService, AuthService and OrgsService.
+// They are off by default; enable them in the grpc.services config section,
+// optionally setting the permission (and the org it is checked on) that
+// UsersService requires for anything but reading the caller:
+//
+//	grpc:
+//	  addr: ":9090"
+//	  tls_cert: ./certs/server.crt
+//	  tls_key: ./certs/server.key
+//	  services:
+//	    auth: true
+//	    orgs: true
+//	    users:
+//	      permission: users:manage
+//	      resource: ${OPS_ORG_ID}
+//
+// Or programmatically with WithService. Without TLS the server listens in
+// plaintext, so only do that behind a trusted network or proxy.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+)
+
+// Names of the built-in services, for WithService and grpc.services.
+const (
+	ServiceUsers = "users"
+	ServiceAuth  = "auth"
+	ServiceOrgs  = "orgs"
+)
+
+// ServiceRegistrant is implemented by modules that serve gRPC services.
+// The server calls RegisterGRPC once, when it starts.
+type ServiceRegistrant interface {
+	RegisterGRPC(registrar grpc.ServiceRegistrar)
+}
+
+// ServiceConfig enables a built-in service. Permission and Resource only
+// apply to UsersService; see the package docs.
+type ServiceConfig struct {
+	Permission string
+	Resource   string
+}
+
+// Server is the gRPC server module.
+type Server struct {
+	app      *chassis.App
+	addr     string
+	tls      *tls.Config
+	certFile string
+	keyFile  string
+	options  []grpc.ServerOption
+	builtins map[string]ServiceConfig
+
+	mu            sync.Mutex
+	registrations []registration
+	server        *grpc.Server
+	listener      net.Listener
+}
+
+type registration struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAddr sets the address to listen on; ":9090" by default.
+func WithAddr(addr string) Option {
+	return func(srv *Server) {
+		srv.addr = addr
+	}
+}
+
+// WithTLS serves with the given TLS config.
+func WithTLS(config *tls.Config) Option {
+	return func(srv *Server) {
+		srv.tls = config
+	}
+}
+
+// WithTLSFiles serves with the certificate and key in the given PEM
+// files, loaded when the server starts.
+func WithTLSFiles(certFile, keyFile string) Option {
+	return func(srv *Server) {
+		srv.certFile, srv.keyFile = certFile, keyFile
+	}
+}
+
+// WithServerOptions adds options to the underlying grpc.Server, such as
+// extra interceptors or message size limits.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(srv *Server) {
+		srv.options = append(srv.options, opts...)
+	}
+}
+
+// WithService enables a built-in service: ServiceUsers, ServiceAuth or
+// ServiceOrgs.
+func WithService(name string, config ServiceConfig) Option {
+	return func(srv *Server) {
+		srv.builtins[name] = config
+	}
+}
+
+// New creates a gRPC server module.
+func New(opts ...Option) *Server {
+	srv := &Server{addr: ":9090", builtins: make(map[string]ServiceConfig)}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
+
+// Name returns the module identifier.
+func (srv *Server) Name() string {
+	return "grpc"
+}
+
+// Init reads the grpc config section.
+func (srv *Server) Init(ctx context.Context, app *chassis.App) error {
+	srv.app = app
+	cfg := app.ConfigData()
+	if cfg == nil {
+		return nil
+	}
+	if addr := cfg.GetString("grpc.addr"); addr != "" {
+		srv.addr = addr
+	}
+	if certFile := cfg.GetString("grpc.tls_cert"); certFile != "" {
+		srv.certFile, srv.keyFile = certFile, cfg.GetString("grpc.tls_key")
+	}
+	for _, name := range []string{ServiceUsers, ServiceAuth, ServiceOrgs} {
+		setting := cfg.Get("grpc.services." + name)
+		if enabled, ok := setting.(bool); ok {
+			if _, configured := srv.builtins[name]; enabled && !configured {
+				srv.builtins[name] = ServiceConfig{}
+			} else if !enabled {
+				delete(srv.builtins, name)
+			}
+			continue
+		}
+		if section := cfg.Section("grpc.services." + name); section != nil {
+			if enabled, ok := section["enabled"].(bool); ok && !enabled {
+				delete(srv.builtins, name)
+				continue
+			}
+			srv.builtins[name] = ServiceConfig{
+				Permission: section.GetString("permission"),
+				Resource:   section.GetString("resource"),
+			}
+		}
+	}
+	return nil
+}
+
+// Register adds a service to serve. Call it before the server starts.
+func (srv *Server) Register(desc *grpc.ServiceDesc, impl any) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.registrations = append(srv.registrations, registration{desc: desc, impl: impl})
+}
+
+// Start listens and serves until ctx is cancelled. Implements
+// chassis.Service.
+func (srv *Server) Start(ctx context.Context) error {
+	server, err := srv.newServer()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", srv.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", srv.addr, err)
+	}
+	srv.mu.Lock()
+	srv.server, srv.listener = server, listener
+	srv.mu.Unlock()
+	srv.app.Logger().Info("grpc server listening", "addr", listener.Addr().String(), "tls", srv.tls != nil || srv.certFile != "")
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		// Shutdown stops gracefully within the app's shutdown timeout
+		return nil
+	}
+}
+
+// newServer builds the grpc.Server with every service registered.
+func (srv *Server) newServer() (*grpc.Server, error) {
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(srv.unaryInterceptor),
+		grpc.ChainStreamInterceptor(srv.streamInterceptor),
+	}
+	tlsConfig := srv.tls
+	if tlsConfig == nil && srv.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(srv.certFile, srv.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(append(options, srv.options...)...)
+
+	if err := srv.registerBuiltins(server); err != nil {
+		return nil, err
+	}
+	for _, mod := range srv.app.Modules() {
+		if registrant, ok := mod.(ServiceRegistrant); ok {
+			registrant.RegisterGRPC(server)
+		}
+	}
+	srv.mu.Lock()
+	for _, reg := range srv.registrations {
+		server.RegisterService(reg.desc, reg.impl)
+	}
+	srv.mu.Unlock()
+	return server, nil
+}
+
+// Addr returns the address the server listens on once started, e.g. to
+// find the port chosen for ":0".
+func (srv *Server) Addr() string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.listener == nil {
+		return ""
+	}
+	return srv.listener.Addr().String()
+}
+
+// Shutdown stops accepting calls and waits for in-flight ones until ctx is
+// done, then closes the remaining connections.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	server := srv.server
+	srv.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+func (srv *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := srv.callContext(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	return resp, srv.statusError(ctx, info.FullMethod, err)
+}
+
+func (srv *Server) streamInterceptor(service any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := srv.callContext(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	err = handler(service, &contextStream{ServerStream: stream, ctx: ctx})
+	return srv.statusError(ctx, info.FullMethod, err)
+}
+
+// callContext adds the app, a logger tagged with the method and, for calls
+// with a bearer token, the caller's session to ctx.
+func (srv *Server) callContext(ctx context.Context, method string) (context.Context, error) {
+	ctx = chassis.WithApp(ctx, srv.app)
+	ctx = chassis.WithLogger(ctx, srv.app.Logger().With("grpc_method", method))
+
+	token := bearerToken(ctx)
+	if token == "" {
+		return ctx, nil
+	}
+	authAPI, ok := srv.app.TryAuth()
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "token authentication requires the auth module")
+	}
+	session, err := authAPI.(*auth.Module).SessionByToken(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	ctx = auth.WithSession(ctx, session)
+	return chassis.WithLogger(ctx, chassis.LoggerFromContext(ctx).With("user_id", session.UserID)), nil
+}
+
+// bearerToken returns the token of the call's authorization metadata.
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
+// statusError converts handler errors to gRPC statuses by their chassis
+// error code. Internal errors are logged and returned without details.
+func (srv *Server) statusError(ctx context.Context, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := grpcCode(chassis.ErrorCodeOf(err))
+	if code == codes.Internal {
+		chassis.LoggerFromContext(ctx).Error("grpc call failed", "error", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
+
+// grpcCode maps a chassis error code to a gRPC status code.
+func grpcCode(code chassis.ErrorCode) codes.Code {
+	switch code {
+	case chassis.CodeInvalidArgument:
+		return codes.InvalidArgument
+	case chassis.CodeNotFound:
+		return codes.NotFound
+	case chassis.CodeAlreadyExists:
+		return codes.AlreadyExists
+	case chassis.CodeUnauthenticated:
+		return codes.Unauthenticated
+	case chassis.CodePermissionDenied:
+		return codes.PermissionDenied
+	case chassis.CodeFailedPrecondition:
+		return codes.FailedPrecondition
+	case chassis.CodeResourceExhausted:
+		return codes.ResourceExhausted
+	case chassis.CodeMethodNotAllowed:
+		return codes.Unimplemented
+	case chassis.CodeUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// contextStream is a server stream with a replaced context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *contextStream) Context() context.Context {
+	return stream.ctx
+}
@@ -0,0 +1,334 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/grpcserver/chassispb"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/permissions"
+	"github.com/talosaether/chassis/users"
+)
+
+// healthModule serves the standard health service through
+// ServiceRegistrant.
+type healthModule struct{}
+
+func (healthModule) Name() string                                     { return "health" }
+func (healthModule) Init(ctx context.Context, app *chassis.App) error { return nil }
+func (healthModule) Shutdown(ctx context.Context) error               { return nil }
+func (healthModule) RegisterGRPC(registrar grpc.ServiceRegistrar) {
+	healthpb.RegisterHealthServer(registrar, health.NewServer())
+}
+
+// startServer starts srv in an app with the users, auth, orgs and
+// permissions modules and returns a client connection to it.
+func startServer(t *testing.T, srv *Server, extra ...chassis.Module) (*chassis.App, *grpc.ClientConn) {
+	t.Helper()
+	dir := t.TempDir()
+	modules := []chassis.Module{
+		users.New(users.WithDBPath(filepath.Join(dir, "users.db"))),
+		auth.New(auth.WithDBPath(filepath.Join(dir, "sessions.db"))),
+		orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db"))),
+		permissions.New(permissions.WithDBPath(filepath.Join(dir, "permissions.db"))),
+	}
+	app := chassis.New(chassis.WithModules(append(append(modules, extra...), srv)...))
+	if !app.HasModule("grpc") {
+		t.Fatal("grpc module not registered")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error, 1)
+	go func() { started <- srv.Start(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Addr() == "" {
+		select {
+		case err := <-started:
+			cancel()
+			t.Fatalf("server failed to start: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err := grpc.NewClient(srv.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		cancel()
+		_ = app.Shutdown(context.Background())
+	})
+	return app, conn
+}
+
+// login creates a user and returns a context carrying their token.
+func login(t *testing.T, app *chassis.App, conn *grpc.ClientConn, email string) (context.Context, string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := app.Users().Create(ctx, email, "password123"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	resp, err := chassispb.NewAuthServiceClient(conn).Login(ctx, &chassispb.LoginRequest{Email: email, Password: "password123"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if resp.GetToken() == "" || resp.GetExpiresAt().AsTime().Before(time.Now()) {
+		t.Fatalf("unexpected login response: %v", resp)
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+resp.GetToken()), resp.GetUserId()
+}
+
+func TestAuthService(t *testing.T) {
+	app, conn := startServer(t, New(WithAddr("127.0.0.1:0"), WithService(ServiceAuth, ServiceConfig{})))
+	client := chassispb.NewAuthServiceClient(conn)
+
+	_, err := client.Login(context.Background(), &chassispb.LoginRequest{Email: "nobody@example.com", Password: "wrong"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated for bad credentials, got %v", err)
+	}
+
+	ctx, userID := login(t, app, conn, "alice@example.com")
+	user, err := client.WhoAmI(ctx, &chassispb.WhoAmIRequest{})
+	if err != nil {
+		t.Fatalf("WhoAmI failed: %v", err)
+	}
+	if user.GetId() != userID || user.GetEmail() != "alice@example.com" {
+		t.Errorf("unexpected user: %v", user)
+	}
+
+	if _, err := client.WhoAmI(context.Background(), &chassispb.WhoAmIRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a token, got %v", err)
+	}
+	badCtx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid")
+	if _, err := client.WhoAmI(badCtx, &chassispb.WhoAmIRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated for an invalid token, got %v", err)
+	}
+
+	if _, err := client.Logout(ctx, &chassispb.LogoutRequest{}); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, err := client.WhoAmI(ctx, &chassispb.WhoAmIRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated after logout, got %v", err)
+	}
+}
+
+func TestUsersService(t *testing.T) {
+	srv := New(WithAddr("127.0.0.1:0"), WithService(ServiceAuth, ServiceConfig{}), WithService(ServiceUsers, ServiceConfig{}))
+	app, conn := startServer(t, srv)
+	client := chassispb.NewUsersServiceClient(conn)
+
+	ctx, userID := login(t, app, conn, "alice@example.com")
+	user, err := client.GetUser(ctx, &chassispb.GetUserRequest{Id: userID})
+	if err != nil || user.GetEmail() != "alice@example.com" {
+		t.Fatalf("expected to read themselves, got %v, %v", user, err)
+	}
+	if _, err := client.GetUserByEmail(ctx, &chassispb.GetUserByEmailRequest{Email: "alice@example.com"}); err != nil {
+		t.Errorf("expected to read themselves by email, got %v", err)
+	}
+
+	other, err := app.Users().Create(context.Background(), "bob@example.com", "password123")
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := client.GetUser(ctx, &chassispb.GetUserRequest{Id: other.(*users.User).ID}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied reading another user, got %v", err)
+	}
+	if _, err := client.GetUserByEmail(ctx, &chassispb.GetUserByEmailRequest{Email: "nobody@example.com"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for an unknown email, got %v", err)
+	}
+	if _, err := client.CreateUser(ctx, &chassispb.CreateUserRequest{Email: "carol@example.com", Password: "password123"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied creating a user, got %v", err)
+	}
+}
+
+func TestOrgsService(t *testing.T) {
+	srv := New(WithAddr("127.0.0.1:0"), WithService(ServiceAuth, ServiceConfig{}), WithService(ServiceOrgs, ServiceConfig{}))
+	app, conn := startServer(t, srv)
+	client := chassispb.NewOrgsServiceClient(conn)
+
+	ctx, userID := login(t, app, conn, "alice@example.com")
+	org, err := client.CreateOrg(ctx, &chassispb.CreateOrgRequest{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateOrg failed: %v", err)
+	}
+	if _, err := client.CreateOrg(ctx, &chassispb.CreateOrgRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without a name, got %v", err)
+	}
+
+	bob, err := app.Users().Create(context.Background(), "bob@example.com", "password123")
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	bobID := bob.(*users.User).ID
+	if _, err := client.AddMember(ctx, &chassispb.AddMemberRequest{OrgId: org.GetId(), UserId: bobID, Role: "member"}); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	members, err := client.ListMembers(ctx, &chassispb.ListMembersRequest{OrgId: org.GetId()})
+	if err != nil {
+		t.Fatalf("ListMembers failed: %v", err)
+	}
+	roles := map[string]string{}
+	for _, member := range members.GetMembers() {
+		roles[member.GetUserId()] = member.GetRole()
+	}
+	if roles[userID] != "owner" || roles[bobID] != "member" {
+		t.Errorf("unexpected members: %v", roles)
+	}
+
+	bobResp, err := chassispb.NewAuthServiceClient(conn).Login(context.Background(), &chassispb.LoginRequest{Email: "bob@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	bobCtx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+bobResp.GetToken())
+	if _, err := client.GetOrg(bobCtx, &chassispb.GetOrgRequest{Id: org.GetId()}); err != nil {
+		t.Errorf("expected members to read the org, got %v", err)
+	}
+	if _, err := client.RemoveMember(bobCtx, &chassispb.RemoveMemberRequest{OrgId: org.GetId(), UserId: userID}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for a member removing the owner, got %v", err)
+	}
+	if _, err := client.RemoveMember(ctx, &chassispb.RemoveMemberRequest{OrgId: org.GetId(), UserId: bobID}); err != nil {
+		t.Errorf("RemoveMember failed: %v", err)
+	}
+	if _, err := client.GetOrg(bobCtx, &chassispb.GetOrgRequest{Id: org.GetId()}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied after removal, got %v", err)
+	}
+}
+
+func TestRegisteredServices(t *testing.T) {
+	srv := New(WithAddr("127.0.0.1:0"))
+	custom := health.NewServer()
+	custom.SetServingStatus("billing", healthpb.HealthCheckResponse_NOT_SERVING)
+	srv.Register(&healthpb.Health_ServiceDesc, custom)
+	_, conn := startServer(t, srv)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "billing"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected the registered service, got %v", resp.GetStatus())
+	}
+	// Built-in services are off by default
+	if _, err := chassispb.NewAuthServiceClient(conn).WhoAmI(context.Background(), &chassispb.WhoAmIRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented for a disabled service, got %v", err)
+	}
+}
+
+func TestServiceRegistrant(t *testing.T) {
+	_, conn := startServer(t, New(WithAddr("127.0.0.1:0")), healthModule{})
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unexpected status: %v", resp.GetStatus())
+	}
+}
+
+func TestMissingModule(t *testing.T) {
+	srv := New(WithAddr("127.0.0.1:0"), WithService(ServiceOrgs, ServiceConfig{}))
+	app := chassis.New(chassis.WithModules(srv))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	err := srv.Start(context.Background())
+	if !errors.Is(err, ErrServiceModuleMissing) {
+		t.Errorf("expected ErrServiceModuleMissing, got %v", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := `grpc:
+  addr: "127.0.0.1:9191"
+  services:
+    auth: true
+    users:
+      permission: users:manage
+      resource: ops
+    orgs:
+      enabled: false
+`
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	app := chassis.New(chassis.WithConfigFile(configPath))
+	srv := New(WithService(ServiceOrgs, ServiceConfig{}))
+	if err := srv.Init(context.Background(), app); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if srv.addr != "127.0.0.1:9191" {
+		t.Errorf("expected the configured addr, got %q", srv.addr)
+	}
+	if _, ok := srv.builtins[ServiceAuth]; !ok {
+		t.Error("expected the auth service enabled")
+	}
+	if _, ok := srv.builtins[ServiceOrgs]; ok {
+		t.Error("expected the orgs service disabled by config")
+	}
+	if got := srv.builtins[ServiceUsers]; got.Permission != "users:manage" || got.Resource != "ops" {
+		t.Errorf("unexpected users config: %+v", got)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	srv := New()
+	srv.app = chassis.New()
+	ctx := context.Background()
+	cases := []struct {
+		err  error
+		want codes.Code
+	}{
+		{chassis.NewError(chassis.CodeNotFound, "user not found"), codes.NotFound},
+		{chassis.WrapError(chassis.CodeInvalidArgument, "bad input", errors.New("cause")), codes.InvalidArgument},
+		{status.Error(codes.Aborted, "aborted"), codes.Aborted},
+		{errors.New("database on fire"), codes.Internal},
+	}
+	for _, tc := range cases {
+		got := srv.statusError(ctx, "/test/Method", tc.err)
+		if status.Code(got) != tc.want {
+			t.Errorf("%v: expected %v, got %v", tc.err, tc.want, got)
+		}
+	}
+	if got := srv.statusError(ctx, "/test/Method", errors.New("database on fire")); status.Convert(got).Message() != "internal error" {
+		t.Errorf("expected internal details hidden, got %q", status.Convert(got).Message())
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	srv := New(WithAddr("127.0.0.1:0"))
+	app, conn := startServer(t, srv, healthModule{})
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	checkCtx, checkCancel := context.WithTimeout(context.Background(), time.Second)
+	defer checkCancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(checkCtx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Error("expected calls to fail after shutdown")
+	}
+}
@@ -0,0 +1,288 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/grpcserver/chassispb"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/users"
+)
+
+// ErrServiceModuleMissing is returned by Start when a built-in service is
+// enabled without the modules it needs.
+var ErrServiceModuleMissing = chassis.NewError(chassis.CodeFailedPrecondition, "built-in gRPC service needs a missing module")
+
+// builtinModules are the modules each built-in service needs.
+var builtinModules = map[string][]string{
+	ServiceUsers: {"users", "auth"},
+	ServiceAuth:  {"users", "auth"},
+	ServiceOrgs:  {"users", "auth", "orgs", "permissions"},
+}
+
+// registerBuiltins registers the enabled built-in services.
+func (srv *Server) registerBuiltins(registrar grpc.ServiceRegistrar) error {
+	for name, config := range srv.builtins {
+		required, known := builtinModules[name]
+		if !known {
+			return fmt.Errorf("unknown built-in gRPC service %q", name)
+		}
+		for _, module := range required {
+			if !srv.app.HasModule(module) {
+				return fmt.Errorf("%w: %s needs %s", ErrServiceModuleMissing, name, module)
+			}
+		}
+		if name == ServiceUsers && config.Permission != "" && config.Permission != api.PermissionAuthenticated && !srv.app.HasModule("permissions") {
+			return fmt.Errorf("%w: %s needs permissions for %s", ErrServiceModuleMissing, name, config.Permission)
+		}
+
+		switch name {
+		case ServiceUsers:
+			chassispb.RegisterUsersServiceServer(registrar, &usersService{app: srv.app, config: config})
+		case ServiceAuth:
+			chassispb.RegisterAuthServiceServer(registrar, &authService{app: srv.app})
+		case ServiceOrgs:
+			chassispb.RegisterOrgsServiceServer(registrar, &orgsService{app: srv.app})
+		}
+		srv.app.Logger().Info("grpc service registered", "service", name)
+	}
+	return nil
+}
+
+// callerID returns the user ID of the call's session, or
+// auth.ErrNotAuthenticated.
+func callerID(ctx context.Context) (string, error) {
+	userID := auth.UserIDFromContext(ctx)
+	if userID == "" {
+		return "", auth.ErrNotAuthenticated
+	}
+	return userID, nil
+}
+
+// denied returns the error of a permission check that failed.
+func denied(permission, resource string) error {
+	return chassis.ErrorWithDetails(chassis.CodePermissionDenied, "permission denied",
+		map[string]string{"permission": permission, "resource": resource})
+}
+
+func userMessage(user *users.User) *chassispb.User {
+	return &chassispb.User{
+		Id:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		AvatarUrl: user.AvatarURL,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}
+}
+
+func orgMessage(org *orgs.Org) *chassispb.Org {
+	return &chassispb.Org{Id: org.ID(), Name: org.Name, CreatedAt: timestamppb.New(org.CreatedAt)}
+}
+
+func memberMessage(membership *orgs.Membership) *chassispb.Member {
+	return &chassispb.Member{
+		OrgId:     membership.OrgID,
+		UserId:    membership.UserID,
+		Role:      membership.Role,
+		CreatedAt: timestamppb.New(membership.CreatedAt),
+	}
+}
+
+// usersService implements UsersService. Callers can read themselves;
+// other reads and creating users need config.Permission on
+// config.Resource, and are refused if no permission is configured.
+type usersService struct {
+	chassispb.UnimplementedUsersServiceServer
+	app    *chassis.App
+	config ServiceConfig
+}
+
+// authorize checks that the caller may act on users other than
+// themselves. self is the user being read, if any.
+func (service *usersService) authorize(ctx context.Context, self string) error {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	if self != "" && self == userID {
+		return nil
+	}
+	permission := service.config.Permission
+	switch {
+	case permission == api.PermissionAuthenticated:
+		return nil
+	case permission == "" || !service.app.Permissions().Can(ctx, userID, permission, service.config.Resource):
+		return denied(permission, service.config.Resource)
+	}
+	return nil
+}
+
+func (service *usersService) GetUser(ctx context.Context, req *chassispb.GetUserRequest) (*chassispb.User, error) {
+	if err := service.authorize(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	result, err := service.app.Users().GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return userMessage(result.(*users.User)), nil
+}
+
+func (service *usersService) GetUserByEmail(ctx context.Context, req *chassispb.GetUserByEmailRequest) (*chassispb.User, error) {
+	if _, err := callerID(ctx); err != nil {
+		return nil, err
+	}
+	result, err := service.app.Users().GetByEmail(ctx, req.GetEmail())
+	if err != nil {
+		// Don't reveal to unauthorized callers whether the email exists
+		if authErr := service.authorize(ctx, ""); authErr != nil {
+			return nil, authErr
+		}
+		return nil, err
+	}
+	user := result.(*users.User)
+	if err := service.authorize(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return userMessage(user), nil
+}
+
+func (service *usersService) CreateUser(ctx context.Context, req *chassispb.CreateUserRequest) (*chassispb.User, error) {
+	if err := service.authorize(ctx, ""); err != nil {
+		return nil, err
+	}
+	result, err := service.app.Users().Create(ctx, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	return userMessage(result.(*users.User)), nil
+}
+
+// authService implements AuthService with session tokens.
+type authService struct {
+	chassispb.UnimplementedAuthServiceServer
+	app *chassis.App
+}
+
+func (service *authService) Login(ctx context.Context, req *chassispb.LoginRequest) (*chassispb.LoginResponse, error) {
+	session, err := service.app.Auth().(*auth.Module).LoginToken(ctx, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	return &chassispb.LoginResponse{
+		Token:     session.Token,
+		UserId:    session.UserID,
+		ExpiresAt: timestamppb.New(session.ExpiresAt),
+	}, nil
+}
+
+func (service *authService) Logout(ctx context.Context, req *chassispb.LogoutRequest) (*chassispb.LogoutResponse, error) {
+	session := auth.SessionFromContext(ctx)
+	if session == nil {
+		return nil, auth.ErrNotAuthenticated
+	}
+	if err := service.app.Auth().(*auth.Module).LogoutToken(ctx, session.Token); err != nil {
+		return nil, err
+	}
+	return &chassispb.LogoutResponse{}, nil
+}
+
+func (service *authService) WhoAmI(ctx context.Context, req *chassispb.WhoAmIRequest) (*chassispb.User, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := service.app.Users().GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userMessage(result.(*users.User)), nil
+}
+
+// orgsService implements OrgsService, checking the caller's permissions
+// on each org like the HTTP handlers would.
+type orgsService struct {
+	chassispb.UnimplementedOrgsServiceServer
+	app *chassis.App
+}
+
+// authorize returns the caller's ID if they have permission on orgID.
+func (service *orgsService) authorize(ctx context.Context, permission, orgID string) (string, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !service.app.Permissions().Can(ctx, userID, permission, orgID) {
+		return "", denied(permission, orgID)
+	}
+	return userID, nil
+}
+
+func (service *orgsService) CreateOrg(ctx context.Context, req *chassispb.CreateOrgRequest) (*chassispb.Org, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := service.app.Orgs().Create(ctx, orgs.CreateInput{Name: req.GetName()})
+	if err != nil {
+		return nil, err
+	}
+	org := result.(*orgs.Org)
+	if _, err := service.app.Orgs().AddMember(ctx, org.ID(), userID, "owner"); err != nil {
+		return nil, fmt.Errorf("failed to add the owner: %w", err)
+	}
+	return orgMessage(org), nil
+}
+
+func (service *orgsService) GetOrg(ctx context.Context, req *chassispb.GetOrgRequest) (*chassispb.Org, error) {
+	if _, err := service.authorize(ctx, "org:read", req.GetId()); err != nil {
+		return nil, err
+	}
+	result, err := service.app.Orgs().GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return orgMessage(result.(*orgs.Org)), nil
+}
+
+func (service *orgsService) ListMembers(ctx context.Context, req *chassispb.ListMembersRequest) (*chassispb.ListMembersResponse, error) {
+	if _, err := service.authorize(ctx, "org:read", req.GetOrgId()); err != nil {
+		return nil, err
+	}
+	result, err := service.app.Orgs().GetMembers(ctx, req.GetOrgId())
+	if err != nil {
+		return nil, err
+	}
+	resp := &chassispb.ListMembersResponse{}
+	for _, membership := range result.([]*orgs.Membership) {
+		resp.Members = append(resp.Members, memberMessage(membership))
+	}
+	return resp, nil
+}
+
+func (service *orgsService) AddMember(ctx context.Context, req *chassispb.AddMemberRequest) (*chassispb.Member, error) {
+	if _, err := service.authorize(ctx, "org:manage_members", req.GetOrgId()); err != nil {
+		return nil, err
+	}
+	result, err := service.app.Orgs().AddMember(ctx, req.GetOrgId(), req.GetUserId(), req.GetRole())
+	if err != nil {
+		return nil, err
+	}
+	return memberMessage(result.(*orgs.Membership)), nil
+}
+
+func (service *orgsService) RemoveMember(ctx context.Context, req *chassispb.RemoveMemberRequest) (*chassispb.RemoveMemberResponse, error) {
+	if _, err := service.authorize(ctx, "org:manage_members", req.GetOrgId()); err != nil {
+		return nil, err
+	}
+	if err := service.app.Orgs().RemoveMember(ctx, req.GetOrgId(), req.GetUserId()); err != nil {
+		return nil, err
+	}
+	return &chassispb.RemoveMemberResponse{}, nil
+}
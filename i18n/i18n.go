@@ -0,0 +1,438 @@
+// Package i18n translates messages into the user's language.
+//
+// Message catalogs are YAML or JSON files, one per locale, named by the
+// locale ("en.yaml", "pt-BR.json"). Nested keys are joined with dots:
+//
+//	# fr.yaml
+//	greeting: "Bonjour {name}"
+//	inbox:
+//	  unread:
+//	    one: "{count} message non lu"
+//	    other: "{count} messages non lus"
+//
+// # Usage
+//
+//	//go:embed locales
+//	var locales embed.FS
+//
+//	files, _ := fs.Sub(locales, "locales")
+//	app := chassis.New(chassis.WithModules(users.New(), i18n.New(i18n.WithCatalogs(files))))
+//
+// Resolve each request's locale with the middleware, then translate with T:
+//
+//	handler = i18nMod.Middleware(handler)
+//
+//	i18n.T(ctx, "greeting", "name", user.Name)          // Bonjour Ann
+//	i18n.T(ctx, "inbox.unread", "count", 3)              // 3 messages non lus
+//	i18n.T(ctx, "greeting", map[string]any{"name": "Ann"})
+//
+// Arguments are name/value pairs or a single map, and replace {name}
+// placeholders. A "count" argument selects the key's one or other form.
+// Missing messages fall back from the locale ("pt-BR") to its language
+// ("pt"), then to the default locale, then to the key itself.
+//
+// # Locale Resolution
+//
+// The middleware uses the logged-in user's preference when the request has
+// a session (mount it inside auth.RequireAuth), then the Accept-Language
+// header, then the default locale. A user's preference is the "locale" key
+// of their users.User metadata, or whatever WithUserLocale returns.
+//
+// # Email
+//
+// The module implements email.Localizer: templated emails are rendered in
+// the recipient's locale, using a "<template>.<locale>" template when one
+// is registered (e.g., welcome.fr.subject.tmpl), and templates can
+// translate with {{t "key" "name" .Data.Name}}.
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	i18n:
+//	  default_locale: en
+//	  dir: ./locales      # catalogs loaded from this directory
+//
+// Or programmatically:
+//
+//	i18n.New(
+//	    i18n.WithDefaultLocale("en"),
+//	    i18n.WithMessages("de", map[string]string{"greeting": "Hallo {name}"}),
+//	)
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/users"
+)
+
+// UserLocaleFunc returns a user's preferred locale, or "" for none.
+type UserLocaleFunc func(ctx context.Context, userID string) (string, error)
+
+// Module is the i18n module implementation.
+type Module struct {
+	app           *chassis.App
+	defaultLocale string
+	catalogFS     []fs.FS
+	userLocale    UserLocaleFunc
+
+	mu       sync.RWMutex
+	catalogs map[string]map[string]string
+}
+
+// Option is a function that configures the i18n module.
+type Option func(*Module)
+
+// WithDefaultLocale sets the locale used when no other matches; "en" by
+// default.
+func WithDefaultLocale(locale string) Option {
+	return func(mod *Module) {
+		mod.defaultLocale = Canonical(locale)
+	}
+}
+
+// WithCatalogs loads catalogs from fsys at Init. See LoadCatalogs.
+func WithCatalogs(fsys fs.FS) Option {
+	return func(mod *Module) {
+		mod.catalogFS = append(mod.catalogFS, fsys)
+	}
+}
+
+// WithMessages adds messages for a locale.
+func WithMessages(locale string, messages map[string]string) Option {
+	return func(mod *Module) {
+		mod.AddMessages(locale, messages)
+	}
+}
+
+// WithUserLocale sets how users' preferred locales are looked up. By
+// default it is the "locale" key of the user's metadata.
+func WithUserLocale(fn UserLocaleFunc) Option {
+	return func(mod *Module) {
+		mod.userLocale = fn
+	}
+}
+
+// New creates a new i18n module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		defaultLocale: "en",
+		catalogs:      make(map[string]map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "i18n"
+}
+
+// Init loads the configured catalogs.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	catalogFS := mod.catalogFS
+	if cfg := app.ConfigData(); cfg != nil {
+		if locale := cfg.GetString("i18n.default_locale"); locale != "" {
+			mod.defaultLocale = Canonical(locale)
+		}
+		if dir := cfg.GetString("i18n.dir"); dir != "" {
+			catalogFS = append(catalogFS, os.DirFS(dir))
+		}
+	}
+	for _, fsys := range catalogFS {
+		if err := mod.LoadCatalogs(fsys); err != nil {
+			return err
+		}
+	}
+
+	app.Logger().Info("i18n module initialized",
+		"default_locale", mod.defaultLocale,
+		"locales", mod.Locales(),
+	)
+	return nil
+}
+
+// Shutdown is a no-op; catalogs are in memory.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// DefaultLocale returns the locale used when no other matches.
+func (mod *Module) DefaultLocale() string {
+	return mod.defaultLocale
+}
+
+// AddMessages adds or replaces messages for a locale.
+func (mod *Module) AddMessages(locale string, messages map[string]string) {
+	locale = Canonical(locale)
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	catalog := mod.catalogs[locale]
+	if catalog == nil {
+		catalog = make(map[string]string, len(messages))
+		mod.catalogs[locale] = catalog
+	}
+	for key, message := range messages {
+		catalog[key] = message
+	}
+}
+
+// LoadCatalogs adds the catalogs in fsys: every .yaml, .yml and .json file
+// at its root, named by locale. Other files are ignored.
+func (mod *Module) LoadCatalogs(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read catalogs: %w", err)
+	}
+	for _, entry := range entries {
+		extension := path.Ext(entry.Name())
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml" && extension != ".json") {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read catalog %s: %w", entry.Name(), err)
+		}
+		var tree map[string]any
+		if extension == ".json" {
+			err = json.Unmarshal(content, &tree)
+		} else {
+			err = yaml.Unmarshal(content, &tree)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse catalog %s: %w", entry.Name(), err)
+		}
+		messages := make(map[string]string)
+		flatten("", tree, messages)
+		mod.AddMessages(strings.TrimSuffix(entry.Name(), extension), messages)
+	}
+	return nil
+}
+
+// flatten adds the messages of a catalog tree to messages, joining nested
+// keys with dots.
+func flatten(prefix string, tree map[string]any, messages map[string]string) {
+	for key, value := range tree {
+		switch value := value.(type) {
+		case map[string]any:
+			flatten(prefix+key+".", value, messages)
+		case nil:
+		default:
+			messages[prefix+key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// Locales returns the locales that have messages, sorted.
+func (mod *Module) Locales() []string {
+	mod.mu.RLock()
+	defer mod.mu.RUnlock()
+	locales := make([]string, 0, len(mod.catalogs))
+	for locale := range mod.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported returns the supported locale closest to locale: the locale
+// itself, its language, or another region of its language. It returns ""
+// if none matches.
+func (mod *Module) Supported(locale string) string {
+	locale = Canonical(locale)
+	if locale == "" {
+		return ""
+	}
+	mod.mu.RLock()
+	defer mod.mu.RUnlock()
+	if _, ok := mod.catalogs[locale]; ok {
+		return locale
+	}
+	language := Language(locale)
+	if _, ok := mod.catalogs[language]; ok {
+		return language
+	}
+	var regional []string
+	for supported := range mod.catalogs {
+		if Language(supported) == language {
+			regional = append(regional, supported)
+		}
+	}
+	if len(regional) == 0 {
+		return ""
+	}
+	sort.Strings(regional)
+	return regional[0]
+}
+
+// Translate returns the message for key in locale, with args filled in.
+// See the package docs for arguments and fallbacks.
+func (mod *Module) Translate(locale, key string, args ...any) string {
+	values := argMap(args)
+	message, ok := mod.lookup(Canonical(locale), key, values)
+	if !ok {
+		message = key
+	}
+	return format(message, values)
+}
+
+// T translates key into the context's locale (see WithLocale), or the
+// default locale.
+func (mod *Module) T(ctx context.Context, key string, args ...any) string {
+	locale := LocaleFromContext(ctx)
+	if locale == "" {
+		locale = mod.defaultLocale
+	}
+	return mod.Translate(locale, key, args...)
+}
+
+// lookup finds the message for key, trying locale, its language and the
+// default locale in turn.
+func (mod *Module) lookup(locale, key string, values map[string]any) (string, bool) {
+	keys := []string{key}
+	if count, ok := values["count"]; ok {
+		form := key + ".other"
+		if fmt.Sprint(count) == "1" {
+			form = key + ".one"
+		}
+		keys = []string{form, key}
+	}
+
+	mod.mu.RLock()
+	defer mod.mu.RUnlock()
+	for _, candidate := range []string{locale, Language(locale), mod.defaultLocale} {
+		catalog := mod.catalogs[candidate]
+		for _, key := range keys {
+			if message, ok := catalog[key]; ok {
+				return message, true
+			}
+		}
+	}
+	return "", false
+}
+
+// UserLocale returns the supported locale closest to the user's
+// preference, or "" if they have none or it isn't supported.
+func (mod *Module) UserLocale(ctx context.Context, userID string) string {
+	lookup := mod.userLocale
+	if lookup == nil {
+		lookup = mod.metadataLocale
+	}
+	preferred, err := lookup(ctx, userID)
+	if err != nil {
+		chassis.LoggerFromContext(ctx).Warn("failed to look up user locale", "user_id", userID, "error", err)
+		return ""
+	}
+	return mod.Supported(preferred)
+}
+
+// metadataLocale is the default UserLocaleFunc: the "locale" key of the
+// user's metadata.
+func (mod *Module) metadataLocale(ctx context.Context, userID string) (string, error) {
+	usersMod, ok := mod.app.TryUsers()
+	if !ok {
+		return "", nil
+	}
+	result, err := usersMod.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	locale, _ := result.(*users.User).Metadata["locale"].(string)
+	return locale, nil
+}
+
+// RecipientLocale returns the locale to email an address in: the
+// preference of the user with that email, or the default locale.
+// Implements email.Localizer.
+func (mod *Module) RecipientLocale(ctx context.Context, to string) string {
+	if usersMod, ok := mod.app.TryUsers(); ok {
+		if result, err := usersMod.GetByEmail(ctx, to); err == nil {
+			if locale := mod.UserLocale(ctx, result.(*users.User).ID); locale != "" {
+				return locale
+			}
+		}
+	}
+	return mod.defaultLocale
+}
+
+// argMap converts T's arguments to a map of placeholder values.
+func argMap(args []any) map[string]any {
+	if len(args) == 1 {
+		if values, ok := args[0].(map[string]any); ok {
+			return values
+		}
+	}
+	values := make(map[string]any, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		values[fmt.Sprint(args[i])] = args[i+1]
+	}
+	return values
+}
+
+// format replaces {name} placeholders with their values. Unknown
+// placeholders are left as they are.
+func format(message string, values map[string]any) string {
+	if len(values) == 0 || !strings.Contains(message, "{") {
+		return message
+	}
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(message, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(message[start:], '}')
+		if end < 0 {
+			break
+		}
+		name := message[start+1 : start+end]
+		out.WriteString(message[:start])
+		if value, ok := values[name]; ok {
+			out.WriteString(fmt.Sprint(value))
+		} else {
+			out.WriteString(message[start : start+end+1])
+		}
+		message = message[start+end+1:]
+	}
+	out.WriteString(message)
+	return out.String()
+}
+
+// Canonical returns a locale in canonical form: "pt_br" and "PT-BR" become
+// "pt-BR".
+func Canonical(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else {
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Language returns the language of a locale: "pt" for "pt-BR".
+func Language(locale string) string {
+	language, _, _ := strings.Cut(locale, "-")
+	return language
+}
@@ -0,0 +1,197 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/users"
+)
+
+var catalogs = fstest.MapFS{
+	"en.yaml": {Data: []byte(`
+greeting: "Hello {name}"
+farewell: Goodbye
+inbox:
+  unread:
+    one: "{count} unread message"
+    other: "{count} unread messages"
+`)},
+	"fr.json":   {Data: []byte(`{"greeting": "Bonjour {name}", "inbox": {"unread": {"one": "{count} message non lu", "other": "{count} messages non lus"}}}`)},
+	"pt-BR.yml": {Data: []byte(`greeting: "Olá {name}"`)},
+	"README.md": {Data: []byte(`not a catalog`)},
+}
+
+func newTestModule(t *testing.T, opts ...Option) *Module {
+	t.Helper()
+	mod := New(append([]Option{WithCatalogs(catalogs)}, opts...)...)
+	app := chassis.New(chassis.WithModules(mod))
+	if !app.HasModule("i18n") {
+		t.Fatal("i18n module not registered")
+	}
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return mod
+}
+
+func TestTranslate(t *testing.T) {
+	mod := newTestModule(t, WithMessages("de", map[string]string{"greeting": "Hallo {name}"}))
+
+	if got := mod.Locales(); !reflect.DeepEqual(got, []string{"de", "en", "fr", "pt-BR"}) {
+		t.Errorf("unexpected locales: %v", got)
+	}
+	cases := []struct {
+		locale, key string
+		args        []any
+		want        string
+	}{
+		{"fr", "greeting", []any{"name", "Ann"}, "Bonjour Ann"},
+		{"fr-CA", "greeting", []any{"name", "Ann"}, "Bonjour Ann"},
+		{"pt_br", "greeting", []any{map[string]any{"name": "Ann"}}, "Olá Ann"},
+		{"de", "greeting", []any{"name", "Ann"}, "Hallo Ann"},
+		{"fr", "farewell", nil, "Goodbye"},
+		{"fr", "inbox.unread", []any{"count", 1}, "1 message non lu"},
+		{"en", "inbox.unread", []any{"count", 3}, "3 unread messages"},
+		{"en", "greeting", nil, "Hello {name}"},
+		{"en", "missing {name}", []any{"name", "Ann"}, "missing Ann"},
+	}
+	for _, tc := range cases {
+		if got := mod.Translate(tc.locale, tc.key, tc.args...); got != tc.want {
+			t.Errorf("Translate(%q, %q): expected %q, got %q", tc.locale, tc.key, tc.want, got)
+		}
+	}
+
+	ctx := WithLocale(context.Background(), "fr")
+	if got := mod.T(ctx, "greeting", "name", "Ann"); got != "Bonjour Ann" {
+		t.Errorf("expected the context locale, got %q", got)
+	}
+	if got := T(context.Background(), "greeting", "name", "Ann"); got != "greeting" {
+		t.Errorf("expected the key without a module, got %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	mod := newTestModule(t)
+	cases := map[string]string{
+		"fr-CH, fr;q=0.9, en;q=0.8": "fr",
+		"de, pt;q=0.5":              "pt-BR",
+		"de;q=1, en;q=0.1":          "en",
+		"fr;q=0, en":                "en",
+		"*":                         "en",
+		"":                          "en",
+	}
+	for header, want := range cases {
+		if got := mod.Match(header); got != want {
+			t.Errorf("Match(%q): expected %q, got %q", header, want, got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(WithCatalogs(catalogs))
+	app := chassis.New(chassis.WithModules(usersMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	result, err := usersMod.Create(ctx, "ann@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	user := result.(*users.User)
+	if _, err := usersMod.UpdateProfile(ctx, user.ID, users.ProfileInput{Metadata: map[string]any{"locale": "pt-BR"}}); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+
+	var greeting string
+	handler := mod.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		greeting = T(request.Context(), "greeting", "name", "Ann")
+	}))
+	serve := func(acceptLanguage, userID string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Accept-Language", acceptLanguage)
+		if userID != "" {
+			request = request.WithContext(auth.WithSession(request.Context(), &auth.Session{UserID: userID}))
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	response := serve("fr-FR,fr;q=0.9", "")
+	if greeting != "Bonjour Ann" || response.Header().Get("Content-Language") != "fr" {
+		t.Errorf("expected French from Accept-Language, got %q (%s)", greeting, response.Header().Get("Content-Language"))
+	}
+	serve("fr", user.ID)
+	if greeting != "Olá Ann" {
+		t.Errorf("expected the user's preference to win, got %q", greeting)
+	}
+	serve("ja", "")
+	if greeting != "Hello Ann" {
+		t.Errorf("expected the default locale, got %q", greeting)
+	}
+}
+
+func TestEmailTemplates(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var subjects []string
+	emailMod := email.New(email.WithProvider(email.NewLogProvider(func(to, subject, body string) {
+		mu.Lock()
+		defer mu.Unlock()
+		subjects = append(subjects, subject)
+	})))
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	app := chassis.New(chassis.WithModules(usersMod, emailMod, New(WithCatalogs(catalogs))))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	for _, tmpl := range []struct {
+		name    string
+		subject string
+	}{
+		{"welcome", `{{t "greeting" "name" .Data}}`},
+		{"receipt", "Your receipt"},
+		{"receipt.fr", "Votre reçu"},
+	} {
+		if err := emailMod.RegisterTemplate(tmpl.name, email.Template{Subject: tmpl.subject, Text: "{{.Locale}}"}); err != nil {
+			t.Fatalf("RegisterTemplate(%s) failed: %v", tmpl.name, err)
+		}
+	}
+	result, err := usersMod.Create(ctx, "marie@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := usersMod.UpdateProfile(ctx, result.(*users.User).ID, users.ProfileInput{Metadata: map[string]any{"locale": "fr"}}); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+
+	for _, send := range []struct{ to, template string }{
+		{"marie@example.com", "welcome"},
+		{"marie@example.com", "receipt"},
+		{"guest@example.com", "welcome"},
+		{"guest@example.com", "receipt"},
+	} {
+		if err := app.Email().SendTemplate(ctx, send.to, send.template, "Marie"); err != nil {
+			t.Fatalf("SendTemplate failed: %v", err)
+		}
+	}
+	if err := app.Email().SendTemplate(email.WithLocale(ctx, "fr"), "guest@example.com", "receipt", nil); err != nil {
+		t.Fatalf("SendTemplate failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"Bonjour Marie", "Votre reçu", "Hello Marie", "Your receipt", "Votre reçu"}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("expected subjects %v, got %v", want, subjects)
+	}
+}
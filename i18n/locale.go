@@ -0,0 +1,125 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+)
+
+type contextKey int
+
+const (
+	localeKey contextKey = iota
+	moduleKey
+)
+
+// WithLocale returns a context that T translates into locale.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, Canonical(locale))
+}
+
+// LocaleFromContext returns the locale set with WithLocale or by the
+// middleware, or "".
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey).(string)
+	return locale
+}
+
+// T translates key into the context's locale with the i18n module of the
+// request (see Middleware) or of the app in ctx. Without one it returns
+// the key with args filled in.
+func T(ctx context.Context, key string, args ...any) string {
+	if mod := fromContext(ctx); mod != nil {
+		return mod.T(ctx, key, args...)
+	}
+	return format(key, argMap(args))
+}
+
+func fromContext(ctx context.Context) *Module {
+	if mod, ok := ctx.Value(moduleKey).(*Module); ok {
+		return mod
+	}
+	if app := chassis.FromContext(ctx); app != nil {
+		for _, registered := range app.Modules() {
+			if mod, ok := registered.(*Module); ok {
+				return mod
+			}
+		}
+	}
+	return nil
+}
+
+// Middleware resolves each request's locale (see the package docs), puts
+// it in the request context for T, and sets the Content-Language header.
+func (mod *Module) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		locale := mod.RequestLocale(request)
+		ctx := context.WithValue(request.Context(), moduleKey, mod)
+		ctx = context.WithValue(ctx, localeKey, locale)
+		writer.Header().Set("Content-Language", locale)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// RequestLocale returns the locale of a request: the logged-in user's
+// preference, the best match of Accept-Language, or the default locale.
+func (mod *Module) RequestLocale(request *http.Request) string {
+	if userID := auth.UserIDFromContext(request.Context()); userID != "" {
+		if locale := mod.UserLocale(request.Context(), userID); locale != "" {
+			return locale
+		}
+	}
+	return mod.Match(request.Header.Get("Accept-Language"))
+}
+
+// Match returns the supported locale that best matches an Accept-Language
+// header, or the default locale.
+func (mod *Module) Match(acceptLanguage string) string {
+	for _, locale := range ParseAcceptLanguage(acceptLanguage) {
+		if supported := mod.Supported(locale); supported != "" {
+			return supported
+		}
+	}
+	return mod.defaultLocale
+}
+
+// ParseAcceptLanguage returns the locales of an Accept-Language header,
+// most preferred first. Wildcards and locales with q=0 are skipped.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		locale = strings.TrimSpace(locale)
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		entries = append(entries, weighted{locale: Canonical(locale), q: q})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+
+	locales := make([]string, len(entries))
+	for i, entry := range entries {
+		locales[i] = entry.locale
+	}
+	return locales
+}
@@ -0,0 +1,101 @@
+// Package sqlite contains helpers shared by the chassis SQLite stores.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/talosaether/chassis/internal/sqlitedb"
+)
+
+// Open opens the SQLite database at path with the settings every chassis
+// store shares; see sqlitedb.Open.
+func Open(path string) (*sql.DB, error) {
+	return sqlitedb.Open(path)
+}
+
+// Snapshot writes a consistent copy of the database to path using VACUUM INTO.
+// Any existing file at path is replaced.
+func Snapshot(ctx context.Context, db *sql.DB, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old snapshot: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the contents of every table in db with the rows stored in
+// the snapshot at path. The schema of db must match the snapshot.
+// Restoring happens in place, so open connections stay valid.
+func Restore(ctx context.Context, db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+
+	// ATTACH is per-connection, so pin one for the whole restore
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS snapshot`, path); err != nil {
+		return fmt.Errorf("failed to attach snapshot: %w", err)
+	}
+	defer func() { _, _ = conn.ExecContext(context.Background(), `DETACH DATABASE snapshot`) }()
+
+	tables, err := snapshotTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, table := range tables {
+		quoted := quoteIdent(table)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM main.`+quoted); err != nil {
+			return fmt.Errorf("failed to clear table %s: %w", table, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO main.`+quoted+` SELECT * FROM snapshot.`+quoted); err != nil {
+			return fmt.Errorf("failed to restore table %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func snapshotTables(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT name FROM snapshot.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot tables: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
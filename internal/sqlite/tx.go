@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/talosaether/chassis"
+)
+
+// Querier runs statements on a database or a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Conn returns where a store runs its statements for ctx: inside app.Tx,
+// the transaction shared by every store on db, begun on first use;
+// otherwise db itself. If the transaction can't begin, the statements fail
+// and so does the app.Tx.
+func Conn(ctx context.Context, db *sql.DB) Querier {
+	tx, err := enlist(ctx, db)
+	if err != nil {
+		return failedQuerier{db: db, err: err}
+	}
+	if tx == nil {
+		return db
+	}
+	return tx
+}
+
+// Tx is a store's own transaction. Inside app.Tx it is the shared
+// transaction, and Commit and Rollback are left to app.Tx.
+type Tx struct {
+	*sql.Tx
+	shared bool
+}
+
+// Begin starts a store transaction, or joins ctx's app.Tx.
+func Begin(ctx context.Context, db *sql.DB) (*Tx, error) {
+	tx, err := enlist(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		return &Tx{Tx: tx, shared: true}, nil
+	}
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx}, nil
+}
+
+// Commit commits a store's own transaction. A shared one commits with its
+// app.Tx.
+func (tx *Tx) Commit() error {
+	if tx.shared {
+		return nil
+	}
+	return tx.Tx.Commit()
+}
+
+// Rollback rolls back a store's own transaction. A shared one rolls back
+// when its app.Tx fails, which the store's error makes it do.
+func (tx *Tx) Rollback() error {
+	if tx.shared {
+		return nil
+	}
+	return tx.Tx.Rollback()
+}
+
+// enlist returns the *sql.Tx of db in ctx's app.Tx, which keeps it under
+// db, or nil outside one.
+func enlist(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	tx, err := chassis.EnlistTx(ctx, db, func() (chassis.Transaction, error) {
+		// The transaction outlives the store call that begins it
+		return db.BeginTx(context.WithoutCancel(ctx), nil)
+	})
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	return tx.(*sql.Tx), nil
+}
+
+// failedQuerier fails every statement with the error that kept a store
+// from joining its app.Tx.
+type failedQuerier struct {
+	db  *sql.DB
+	err error
+}
+
+func (querier failedQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, querier.err
+}
+
+func (querier failedQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, querier.err
+}
+
+// QueryRowContext can't build a *sql.Row holding the error, so it returns
+// one from a cancelled context, which fails on Scan without running query.
+func (querier failedQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	return querier.db.QueryRowContext(cancelled, query, args...)
+}
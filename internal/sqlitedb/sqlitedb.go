@@ -0,0 +1,70 @@
+// Package sqlitedb opens SQLite databases with the settings every chassis
+// store shares. It imports nothing from the chassis, so the app can open
+// the SQLite databases named in config with it.
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// BusyTimeout is how long a connection waits for another connection's
+// write lock before failing with SQLITE_BUSY.
+const BusyTimeout = 5 * time.Second
+
+// MaxOpenConns bounds the connection pool of each database. WAL lets
+// readers run alongside the single writer; more connections would only
+// queue for the write lock.
+const MaxOpenConns = 8
+
+// Open opens the SQLite database at path, creating its directory, with the
+// settings every chassis store shares:
+//
+//   - WAL journaling, so reads don't block on writes and vice versa
+//   - a busy timeout, so concurrent writers wait for each other instead of
+//     failing with SQLITE_BUSY
+//   - immediate transactions, which take the write lock up front rather
+//     than failing when a read transaction tries to upgrade
+//   - foreign key enforcement and NORMAL synchronization, which is
+//     durable in WAL mode
+//   - a bounded connection pool
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", DSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(MaxOpenConns)
+	db.SetMaxIdleConns(MaxOpenConns)
+
+	// Connections are opened lazily; check the settings apply now
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// DSN returns the data source name Open uses for path.
+func DSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + strings.Join([]string{
+		fmt.Sprintf("_pragma=busy_timeout(%d)", BusyTimeout.Milliseconds()),
+		"_pragma=journal_mode(WAL)",
+		"_pragma=synchronous(NORMAL)",
+		"_pragma=foreign_keys(1)",
+		"_txlock=immediate",
+	}, "&")
+}
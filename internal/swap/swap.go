@@ -0,0 +1,83 @@
+// Package swap holds module providers that can be replaced at runtime.
+//
+// Operations Acquire the current provider and release it when done. Swap
+// installs a new provider for later operations, then waits for those still
+// using the old one to finish, so the old provider can be closed safely.
+package swap
+
+import (
+	"context"
+	"sync"
+)
+
+// Value holds a swappable provider. The zero value holds the zero T.
+type Value[T any] struct {
+	mu      sync.RWMutex
+	current *generation[T]
+}
+
+// generation is one installed provider and its in-flight operations.
+type generation[T any] struct {
+	value    T
+	inflight sync.WaitGroup
+}
+
+// Store installs value without waiting for in-flight operations. Use it
+// while configuring a module.
+func (holder *Value[T]) Store(value T) {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	holder.current = &generation[T]{value: value}
+}
+
+// Load returns the current provider without registering an operation.
+func (holder *Value[T]) Load() T {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+	if holder.current == nil {
+		var zero T
+		return zero
+	}
+	return holder.current.value
+}
+
+// Acquire returns the current provider and a function that must be called
+// when the operation using it is done.
+func (holder *Value[T]) Acquire() (T, func()) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+	if holder.current == nil {
+		var zero T
+		return zero, func() {}
+	}
+	current := holder.current
+	current.inflight.Add(1)
+	return current.value, current.inflight.Done
+}
+
+// Swap installs value and waits until operations that acquired the old
+// provider have released it, or ctx is done. The old provider is returned
+// either way; on error it may still be in use.
+func (holder *Value[T]) Swap(ctx context.Context, value T) (T, error) {
+	holder.mu.Lock()
+	old := holder.current
+	holder.current = &generation[T]{value: value}
+	holder.mu.Unlock()
+
+	if old == nil {
+		var zero T
+		return zero, nil
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		old.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return old.value, nil
+	case <-ctx.Done():
+		return old.value, ctx.Err()
+	}
+}
@@ -0,0 +1,535 @@
+// Package keys provides per-org encryption keys for the chassis framework.
+//
+// Each org gets its own data-encryption key (DEK). DEKs are stored wrapped
+// (encrypted) by a master key, so the database alone can't decrypt anything.
+// Data encrypted for an org can only be read while its DEK exists: revoking
+// an org's keys crypto-shreds everything encrypted for it, including copies
+// in backups, without having to find and delete every copy. (Backups of the
+// keys database itself must be expired for this to hold.)
+//
+// # Usage
+//
+// Register the module with chassis:
+//
+//	app := chassis.New(
+//	    chassis.WithModules(
+//	        keys.New(),
+//	    ),
+//	)
+//
+// Encrypt and decrypt data for an org:
+//
+//	ciphertext, err := app.Keys().Encrypt(ctx, orgID, []byte("secret"))
+//	plaintext, err := app.Keys().Decrypt(ctx, orgID, ciphertext)
+//
+// For PII in database columns, use the string helpers, which produce base64:
+//
+//	keysMod := app.Keys().(*keys.Module)
+//	encrypted, err := keysMod.EncryptString(ctx, orgID, customer.Phone)
+//
+// Encrypt storage objects under orgs/<org ID>/ by wrapping the storage provider:
+//
+//	keysMod := keys.New()
+//	app := chassis.New(chassis.WithModules(
+//	    keysMod,
+//	    storage.New(storage.WithWrapper(keysMod.WrapStorage)),
+//	))
+//	app.Storage().Put(ctx, keys.OrgPrefix(orgID)+"contracts/1.pdf", data)
+//
+// # Offboarding
+//
+// Revoke deletes an org's DEKs. Afterwards Decrypt returns ErrKeyRevoked for
+// all of the org's data and Encrypt refuses to create a new key:
+//
+//	err := app.Keys().Revoke(ctx, orgID)
+//
+// # Rotation
+//
+// Rotate creates a new DEK version for an org. New data uses the newest
+// version; data encrypted with older versions stays readable.
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	keys:
+//	  db_path: ./data/keys.db
+//	  master_key: ${KEYS_MASTER_KEY}  # base64-encoded 32-byte key
+//
+// Or programmatically, e.g. to unwrap DEKs with a KMS:
+//
+//	keys.New(keys.WithMasterKey(myKMSMasterKey))
+package keys
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrOrgIDRequired     = chassis.NewError(chassis.CodeInvalidArgument, "org ID is required")
+	ErrKeyRevoked        = chassis.NewError(chassis.CodeFailedPrecondition, "encryption key has been revoked")
+	ErrKeyNotFound       = chassis.NewError(chassis.CodeNotFound, "encryption key not found")
+	ErrInvalidCiphertext = chassis.NewError(chassis.CodeInvalidArgument, "invalid ciphertext")
+	ErrMasterKeyRequired = chassis.NewError(chassis.CodeFailedPrecondition, "keys module requires a master key (keys.master_key)")
+	ErrInvalidMasterKey  = chassis.NewError(chassis.CodeInvalidArgument, "master key must be 32 bytes")
+)
+
+// EventKeysRevoked is published after an org's keys are revoked.
+// The payload is a *KeyEvent.
+const EventKeysRevoked = "keys.revoked"
+
+// KeyEvent is the payload of key events.
+type KeyEvent struct {
+	OrgID string
+}
+
+// MasterKey wraps and unwraps data-encryption keys. Implement it to keep the
+// master key in a KMS or secrets manager.
+type MasterKey interface {
+	Wrap(ctx context.Context, orgID string, dek []byte) ([]byte, error)
+	Unwrap(ctx context.Context, orgID string, wrapped []byte) ([]byte, error)
+}
+
+// OrgKey is a stored, wrapped data-encryption key.
+type OrgKey struct {
+	OrgID      string
+	Version    int
+	WrappedKey []byte
+	CreatedAt  time.Time
+}
+
+// dekSize is the size of data-encryption keys (AES-256).
+const dekSize = 32
+
+// ciphertextMagic prefixes everything Encrypt produces so foreign data is
+// rejected early and the format can change later.
+var ciphertextMagic = []byte("CHK1")
+
+// Module is the keys module implementation.
+type Module struct {
+	store     Store
+	dbPath    string
+	masterKey MasterKey
+	app       *chassis.App
+
+	mu   sync.RWMutex
+	deks map[string]map[int][]byte // unwrapped DEKs by org and version
+}
+
+// Option is a function that configures the keys module.
+type Option func(*Module)
+
+// WithStore sets a custom store implementation.
+func WithStore(store Store) Option {
+	return func(mod *Module) {
+		mod.store = store
+	}
+}
+
+// WithDBPath sets the SQLite database path.
+func WithDBPath(path string) Option {
+	return func(mod *Module) {
+		mod.dbPath = path
+	}
+}
+
+// WithMasterKey sets the master key used to wrap DEKs.
+func WithMasterKey(masterKey MasterKey) Option {
+	return func(mod *Module) {
+		mod.masterKey = masterKey
+	}
+}
+
+// New creates a new keys module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		dbPath: "./data/keys.db",
+		deks:   make(map[string]map[int][]byte),
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "keys"
+}
+
+// Init initializes the keys module.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	// Read config if available
+	if cfg := app.ConfigData(); cfg != nil {
+		if dbPath := cfg.GetString("keys.db_path"); dbPath != "" {
+			mod.dbPath = dbPath
+		}
+		if encoded := cfg.GetString("keys.master_key"); encoded != "" && mod.masterKey == nil {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return fmt.Errorf("failed to decode keys.master_key: %w", err)
+			}
+			masterKey, err := NewAESMasterKey(key)
+			if err != nil {
+				return err
+			}
+			mod.masterKey = masterKey
+		}
+	}
+	if mod.masterKey == nil {
+		return ErrMasterKeyRequired
+	}
+
+	// Use default SQLite store if none provided
+	if mod.store == nil {
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to create keys store: %w", err)
+		}
+		mod.store = sqliteStore
+		app.Logger().Info("keys module initialized", "db_path", mod.dbPath)
+	} else {
+		app.Logger().Info("keys module initialized with custom store")
+	}
+
+	return nil
+}
+
+// openSQLiteStore creates the store on the database named by
+// keys.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("keys")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
+// Shutdown cleans up the keys module.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	mod.mu.Lock()
+	mod.deks = make(map[string]map[int][]byte)
+	mod.mu.Unlock()
+
+	if mod.store != nil {
+		return mod.store.Close()
+	}
+	return nil
+}
+
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "keys.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	mod.mu.Lock()
+	mod.deks = make(map[string]map[int][]byte)
+	mod.mu.Unlock()
+	return snapshotter.Restore(ctx, filepath.Join(dir, "keys.db"))
+}
+
+// Encrypt encrypts plaintext with the org's current DEK, creating the org's
+// first DEK if needed. The ciphertext is bound to the org: decrypting it as
+// another org fails.
+func (mod *Module) Encrypt(ctx context.Context, orgID string, plaintext []byte) ([]byte, error) {
+	if orgID == "" {
+		return nil, ErrOrgIDRequired
+	}
+
+	version, dek, err := mod.currentKey(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(ciphertextMagic)+4, len(ciphertextMagic)+4+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(header, ciphertextMagic)
+	binary.BigEndian.PutUint32(header[len(ciphertextMagic):], uint32(version))
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, plaintext, []byte(orgID)), nil
+}
+
+// Decrypt decrypts data produced by Encrypt for the same org.
+func (mod *Module) Decrypt(ctx context.Context, orgID string, ciphertext []byte) ([]byte, error) {
+	if orgID == "" {
+		return nil, ErrOrgIDRequired
+	}
+
+	headerSize := len(ciphertextMagic) + 4
+	if len(ciphertext) < headerSize || string(ciphertext[:len(ciphertextMagic)]) != string(ciphertextMagic) {
+		return nil, ErrInvalidCiphertext
+	}
+	version := int(binary.BigEndian.Uint32(ciphertext[len(ciphertextMagic):headerSize]))
+
+	dek, err := mod.key(ctx, orgID, version)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	body := ciphertext[headerSize:]
+	if len(body) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], []byte(orgID))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// EncryptString encrypts a value for storage in a text column.
+// The result is base64-encoded.
+func (mod *Module) EncryptString(ctx context.Context, orgID, value string) (string, error) {
+	ciphertext, err := mod.Encrypt(ctx, orgID, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptString decrypts a value produced by EncryptString.
+func (mod *Module) DecryptString(ctx context.Context, orgID, value string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	plaintext, err := mod.Decrypt(ctx, orgID, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rotate creates a new DEK version for the org and returns it. Data encrypted
+// with earlier versions remains readable.
+func (mod *Module) Rotate(ctx context.Context, orgID string) (int, error) {
+	if orgID == "" {
+		return 0, ErrOrgIDRequired
+	}
+	if err := mod.checkRevoked(ctx, orgID); err != nil {
+		return 0, err
+	}
+
+	latest, err := mod.store.Latest(ctx, orgID)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+	if _, err := mod.createKey(ctx, orgID, version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Revoke deletes all of the org's DEKs, making data encrypted for the org
+// permanently unreadable. It cannot be undone.
+func (mod *Module) Revoke(ctx context.Context, orgID string) error {
+	if orgID == "" {
+		return ErrOrgIDRequired
+	}
+	if err := mod.store.Revoke(ctx, orgID, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke keys: %w", err)
+	}
+
+	mod.mu.Lock()
+	delete(mod.deks, orgID)
+	mod.mu.Unlock()
+
+	mod.app.Logger().Info("org keys revoked", "org_id", orgID)
+	mod.app.PublishEvent(ctx, EventKeysRevoked, &KeyEvent{OrgID: orgID})
+	return nil
+}
+
+// IsRevoked reports whether the org's keys have been revoked.
+func (mod *Module) IsRevoked(ctx context.Context, orgID string) (bool, error) {
+	return mod.store.IsRevoked(ctx, orgID)
+}
+
+func (mod *Module) checkRevoked(ctx context.Context, orgID string) error {
+	revoked, err := mod.store.IsRevoked(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrKeyRevoked
+	}
+	return nil
+}
+
+// currentKey returns the org's newest DEK, creating version 1 if the org has none.
+func (mod *Module) currentKey(ctx context.Context, orgID string) (int, []byte, error) {
+	latest, err := mod.store.Latest(ctx, orgID)
+	if errors.Is(err, ErrKeyNotFound) {
+		if err := mod.checkRevoked(ctx, orgID); err != nil {
+			return 0, nil, err
+		}
+		dek, err := mod.createKey(ctx, orgID, 1)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 1, dek, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dek, err := mod.key(ctx, orgID, latest.Version)
+	if err != nil {
+		return 0, nil, err
+	}
+	return latest.Version, dek, nil
+}
+
+// key returns an unwrapped DEK, loading it from the store if not cached.
+func (mod *Module) key(ctx context.Context, orgID string, version int) ([]byte, error) {
+	mod.mu.RLock()
+	dek, ok := mod.deks[orgID][version]
+	mod.mu.RUnlock()
+	if ok {
+		return dek, nil
+	}
+
+	stored, err := mod.store.Get(ctx, orgID, version)
+	if errors.Is(err, ErrKeyNotFound) {
+		if revokedErr := mod.checkRevoked(ctx, orgID); revokedErr != nil {
+			return nil, revokedErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err = mod.masterKey.Unwrap(ctx, orgID, stored.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key: %w", err)
+	}
+	mod.cache(orgID, version, dek)
+	return dek, nil
+}
+
+// createKey generates, wraps and stores a DEK version. If another caller
+// created the same version first, that key is used instead.
+func (mod *Module) createKey(ctx context.Context, orgID string, version int) ([]byte, error) {
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	wrapped, err := mod.masterKey.Wrap(ctx, orgID, dek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key: %w", err)
+	}
+
+	created, err := mod.store.Create(ctx, &OrgKey{
+		OrgID:      orgID,
+		Version:    version,
+		WrappedKey: wrapped,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store key: %w", err)
+	}
+	if !created {
+		return mod.key(ctx, orgID, version)
+	}
+
+	mod.cache(orgID, version, dek)
+	return dek, nil
+}
+
+func (mod *Module) cache(orgID string, version int, dek []byte) {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	if mod.deks[orgID] == nil {
+		mod.deks[orgID] = make(map[int][]byte)
+	}
+	mod.deks[orgID][version] = dek
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AESMasterKey wraps DEKs with a local AES-256-GCM key.
+type AESMasterKey struct {
+	aead cipher.AEAD
+}
+
+// NewAESMasterKey creates a master key from 32 bytes of key material.
+func NewAESMasterKey(key []byte) (*AESMasterKey, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidMasterKey
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AESMasterKey{aead: aead}, nil
+}
+
+// Wrap encrypts a DEK, binding it to the org.
+func (masterKey *AESMasterKey) Wrap(ctx context.Context, orgID string, dek []byte) ([]byte, error) {
+	nonce := make([]byte, masterKey.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return masterKey.aead.Seal(nonce, nonce, dek, []byte(orgID)), nil
+}
+
+// Unwrap decrypts a DEK wrapped for the org.
+func (masterKey *AESMasterKey) Unwrap(ctx context.Context, orgID string, wrapped []byte) ([]byte, error) {
+	nonceSize := masterKey.aead.NonceSize()
+	if len(wrapped) < nonceSize {
+		return nil, ErrInvalidCiphertext
+	}
+	return masterKey.aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(orgID))
+}
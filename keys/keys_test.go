@@ -0,0 +1,253 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/storage"
+)
+
+func testMasterKey(t *testing.T) *AESMasterKey {
+	t.Helper()
+	material := make([]byte, 32)
+	if _, err := rand.Read(material); err != nil {
+		t.Fatalf("failed to generate master key: %v", err)
+	}
+	masterKey, err := NewAESMasterKey(material)
+	if err != nil {
+		t.Fatalf("NewAESMasterKey failed: %v", err)
+	}
+	return masterKey
+}
+
+func setupKeys(t *testing.T, extra ...chassis.Module) (*Module, *chassis.App) {
+	t.Helper()
+	mod := New(
+		WithDBPath(filepath.Join(t.TempDir(), "keys.db")),
+		WithMasterKey(testMasterKey(t)),
+	)
+	app := chassis.New(chassis.WithModules(append([]chassis.Module{events.New(), mod}, extra...)...))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return mod, app
+}
+
+func TestInit_RequiresMasterKey(t *testing.T) {
+	mod := New(WithDBPath(filepath.Join(t.TempDir(), "keys.db")))
+	if err := mod.Init(context.Background(), chassis.New()); !errors.Is(err, ErrMasterKeyRequired) {
+		t.Errorf("expected ErrMasterKeyRequired, got %v", err)
+	}
+	if _, err := NewAESMasterKey([]byte("short")); !errors.Is(err, ErrInvalidMasterKey) {
+		t.Errorf("expected ErrInvalidMasterKey, got %v", err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	mod, _ := setupKeys(t)
+	ctx := context.Background()
+
+	ciphertext, err := mod.Encrypt(ctx, "org-1", []byte("hello"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if bytes.Contains(ciphertext, []byte("hello")) {
+		t.Error("ciphertext should not contain the plaintext")
+	}
+
+	plaintext, err := mod.Decrypt(ctx, "org-1", ciphertext)
+	if err != nil || string(plaintext) != "hello" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	// Ciphertext is bound to its org
+	if _, err := mod.Decrypt(ctx, "org-2", ciphertext); err == nil {
+		t.Error("decrypting as another org should fail")
+	}
+	if _, err := mod.Decrypt(ctx, "org-1", []byte("garbage")); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("expected ErrInvalidCiphertext, got %v", err)
+	}
+	if _, err := mod.Encrypt(ctx, "", []byte("x")); !errors.Is(err, ErrOrgIDRequired) {
+		t.Errorf("expected ErrOrgIDRequired, got %v", err)
+	}
+}
+
+func TestEncryptString(t *testing.T) {
+	mod, _ := setupKeys(t)
+	ctx := context.Background()
+
+	encrypted, err := mod.EncryptString(ctx, "org-1", "+1 555 0100")
+	if err != nil {
+		t.Fatalf("EncryptString failed: %v", err)
+	}
+	decrypted, err := mod.DecryptString(ctx, "org-1", encrypted)
+	if err != nil || decrypted != "+1 555 0100" {
+		t.Errorf("DecryptString = %q, %v", decrypted, err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	mod, _ := setupKeys(t)
+	ctx := context.Background()
+
+	before, _ := mod.Encrypt(ctx, "org-1", []byte("v1 data"))
+	version, err := mod.Rotate(ctx, "org-1")
+	if err != nil || version != 2 {
+		t.Fatalf("Rotate = %d, %v", version, err)
+	}
+	after, _ := mod.Encrypt(ctx, "org-1", []byte("v2 data"))
+
+	for _, ciphertext := range [][]byte{before, after} {
+		if _, err := mod.Decrypt(ctx, "org-1", ciphertext); err != nil {
+			t.Errorf("all versions should stay readable: %v", err)
+		}
+	}
+}
+
+func TestRevoke_CryptoShreds(t *testing.T) {
+	mod, app := setupKeys(t)
+	ctx := context.Background()
+
+	revoked := make(chan string, 1)
+	app.Events().Subscribe(EventKeysRevoked, func(ctx context.Context, eventType string, payload any) {
+		revoked <- payload.(*KeyEvent).OrgID
+	})
+
+	ciphertext, _ := mod.Encrypt(ctx, "org-1", []byte("customer data"))
+	other, _ := mod.Encrypt(ctx, "org-2", []byte("other tenant"))
+
+	if err := mod.Revoke(ctx, "org-1"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if orgID := <-revoked; orgID != "org-1" {
+		t.Errorf("expected keys.revoked for org-1, got %q", orgID)
+	}
+
+	if _, err := mod.Decrypt(ctx, "org-1", ciphertext); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("expected ErrKeyRevoked, got %v", err)
+	}
+	if _, err := mod.Encrypt(ctx, "org-1", []byte("new")); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("revoked org should not get a new key, got %v", err)
+	}
+	if _, err := mod.Decrypt(ctx, "org-2", other); err != nil {
+		t.Errorf("other orgs should be unaffected: %v", err)
+	}
+	if isRevoked, _ := mod.IsRevoked(ctx, "org-1"); !isRevoked {
+		t.Error("IsRevoked should report true")
+	}
+}
+
+func TestKeysSurviveRestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "keys.db")
+	masterKey := testMasterKey(t)
+	ctx := context.Background()
+
+	first := New(WithDBPath(dbPath), WithMasterKey(masterKey))
+	app := chassis.New(chassis.WithModules(first))
+	ciphertext, err := first.Encrypt(ctx, "org-1", []byte("durable"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	_ = app.Shutdown(ctx)
+
+	second := New(WithDBPath(dbPath), WithMasterKey(masterKey))
+	app = chassis.New(chassis.WithModules(second))
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	plaintext, err := second.Decrypt(ctx, "org-1", ciphertext)
+	if err != nil || string(plaintext) != "durable" {
+		t.Errorf("Decrypt after restart = %q, %v", plaintext, err)
+	}
+}
+
+func TestWrapStorage(t *testing.T) {
+	basePath := t.TempDir()
+	mod := New(
+		WithDBPath(filepath.Join(t.TempDir(), "keys.db")),
+		WithMasterKey(testMasterKey(t)),
+	)
+	storageMod := storage.New(storage.WithBasePath(basePath), storage.WithWrapper(mod.WrapStorage))
+	app := chassis.New(chassis.WithModules(mod, storageMod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	orgKey := OrgPrefix("org-1") + "docs/contract.txt"
+	if err := app.Storage().Put(ctx, orgKey, []byte("confidential")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := app.Storage().Put(ctx, "public/readme.txt", []byte("public")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Read the underlying files directly
+	raw := storage.New(storage.WithBasePath(basePath))
+	_ = raw.Init(ctx, chassis.New())
+	if data, _ := raw.Get(ctx, orgKey); bytes.Contains(data, []byte("confidential")) {
+		t.Error("org objects should be encrypted at rest")
+	}
+	if data, _ := raw.Get(ctx, "public/readme.txt"); string(data) != "public" {
+		t.Errorf("objects outside org prefixes should pass through, got %q", data)
+	}
+
+	data, err := app.Storage().Get(ctx, orgKey)
+	if err != nil || string(data) != "confidential" {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+
+	// Metadata is kept, and Stat describes the plaintext
+	err = storageMod.PutWithMetadata(ctx, orgKey, strings.NewReader("signed"), 6, storage.Metadata{Values: map[string]string{"status": "signed"}})
+	if err != nil {
+		t.Fatalf("PutWithMetadata failed: %v", err)
+	}
+	info, err := storageMod.Stat(ctx, orgKey)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != 6 || info.Checksum != storage.Checksum([]byte("signed")) || info.ContentType != "text/plain; charset=utf-8" || info.Values["status"] != "signed" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	// Copies to another org are re-encrypted with its key
+	otherKey := OrgPrefix("org-2") + "docs/contract.txt"
+	if err := app.Storage().Copy(ctx, orgKey, otherKey); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if data, err := app.Storage().Get(ctx, otherKey); err != nil || string(data) != "signed" {
+		t.Errorf("Get of copy = %q, %v", data, err)
+	}
+	if info, err := storageMod.Stat(ctx, otherKey); err != nil || info.Values["status"] != "signed" {
+		t.Errorf("expected the copy to keep its metadata, got %+v (%v)", info, err)
+	}
+	movedKey := OrgPrefix("org-2") + "archive/contract.txt"
+	if err := app.Storage().Move(ctx, otherKey, movedKey); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if data, err := app.Storage().Get(ctx, movedKey); err != nil || string(data) != "signed" {
+		t.Errorf("Get of moved object = %q, %v", data, err)
+	}
+
+	_ = mod.Revoke(ctx, "org-1")
+	if _, err := app.Storage().Get(ctx, orgKey); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("expected ErrKeyRevoked after revoke, got %v", err)
+	}
+}
+
+func TestOrgOfKey(t *testing.T) {
+	tests := map[string]string{
+		"orgs/org-1/file.txt": "org-1",
+		"orgs/org-1/a/b":      "org-1",
+		"orgs/org-1":          "",
+		"public/file.txt":     "",
+		"orgsx/org-1/file":    "",
+	}
+	for key, want := range tests {
+		if got := orgOfKey(key); got != want {
+			t.Errorf("orgOfKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/storage"
+)
+
+// orgPrefix is the storage key prefix of org-owned objects.
+const orgPrefix = "orgs/"
+
+// OrgPrefix returns the storage key prefix for objects owned by an org.
+// Objects under it are encrypted by a provider wrapped with WrapStorage.
+func OrgPrefix(orgID string) string {
+	return orgPrefix + orgID + "/"
+}
+
+// orgOfKey returns the org that owns a storage key, or "" if none does.
+func orgOfKey(key string) string {
+	rest, ok := strings.CutPrefix(key, orgPrefix)
+	if !ok {
+		return ""
+	}
+	orgID, _, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ""
+	}
+	return orgID
+}
+
+// WrapStorage returns a storage provider that encrypts objects under
+// OrgPrefix(orgID) with the org's DEK. Other objects pass through
+// unchanged. Use it with storage.WithWrapper.
+func (mod *Module) WrapStorage(provider storage.Provider) storage.Provider {
+	return &encryptedStorage{Provider: provider, keys: mod}
+}
+
+// encryptedStorage encrypts org-owned objects before delegating.
+type encryptedStorage struct {
+	storage.Provider
+	keys *Module
+}
+
+func (encrypted *encryptedStorage) Put(ctx context.Context, key string, data []byte) error {
+	if orgID := orgOfKey(key); orgID != "" {
+		ciphertext, err := encrypted.keys.Encrypt(ctx, orgID, data)
+		if err != nil {
+			return err
+		}
+		data = ciphertext
+	}
+	return encrypted.Provider.Put(ctx, key, data)
+}
+
+func (encrypted *encryptedStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := encrypted.Provider.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if orgID := orgOfKey(key); orgID != "" {
+		return encrypted.keys.Decrypt(ctx, orgID, data)
+	}
+	return data, nil
+}
+
+// PutWithMetadata encrypts org-owned objects, which means reading them
+// into memory, and stores them with meta.
+func (encrypted *encryptedStorage) PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta storage.Metadata) error {
+	described, ok := encrypted.Provider.(storage.MetadataProvider)
+	if !ok {
+		return storage.ErrMetadataNotSupported
+	}
+	orgID := orgOfKey(key)
+	if orgID == "" {
+		return described.PutWithMetadata(ctx, key, reader, size, meta)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("%w: read %d of %d bytes", storage.ErrSizeMismatch, len(data), size)
+	}
+	ciphertext, err := encrypted.keys.Encrypt(ctx, orgID, data)
+	if err != nil {
+		return err
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = storage.DetectContentType(key, data)
+	}
+	return described.PutWithMetadata(ctx, key, bytes.NewReader(ciphertext), int64(len(ciphertext)), meta)
+}
+
+// Stat reports the size and checksum of the plaintext of org-owned objects.
+func (encrypted *encryptedStorage) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	info := &storage.ObjectInfo{Key: key}
+	if described, ok := encrypted.Provider.(storage.MetadataProvider); ok {
+		stored, err := described.Stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if orgOfKey(key) == "" {
+			return stored, nil
+		}
+		info = stored
+	}
+
+	data, err := encrypted.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = int64(len(data))
+	info.Checksum = storage.Checksum(data)
+	if info.ContentType == "" {
+		info.ContentType = storage.DetectContentType(key, data)
+	}
+	return info, nil
+}
+
+// Exists delegates to the wrapped provider.
+func (encrypted *encryptedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return storage.Copying(encrypted.Provider).Exists(ctx, key)
+}
+
+// Copy copies the ciphertext within an org, and re-encrypts the object for
+// dst's org when it changes owner.
+func (encrypted *encryptedStorage) Copy(ctx context.Context, src, dst string) error {
+	if orgOfKey(src) == orgOfKey(dst) {
+		return storage.Copying(encrypted.Provider).Copy(ctx, src, dst)
+	}
+	return encrypted.reencrypt(ctx, src, dst)
+}
+
+// Move is Copy, then deleting src.
+func (encrypted *encryptedStorage) Move(ctx context.Context, src, dst string) error {
+	if orgOfKey(src) == orgOfKey(dst) {
+		return storage.Copying(encrypted.Provider).Move(ctx, src, dst)
+	}
+	if err := encrypted.reencrypt(ctx, src, dst); err != nil {
+		return err
+	}
+	return encrypted.Provider.Delete(ctx, src)
+}
+
+// reencrypt stores the plaintext of src, with its metadata, at dst.
+func (encrypted *encryptedStorage) reencrypt(ctx context.Context, src, dst string) error {
+	data, err := encrypted.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	described, ok := encrypted.Provider.(storage.MetadataProvider)
+	if !ok {
+		return encrypted.Put(ctx, dst, data)
+	}
+	info, err := described.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	return encrypted.PutWithMetadata(ctx, dst, bytes.NewReader(data), int64(len(data)), info.Metadata)
+}
+
+// ListPage delegates to the wrapped provider.
+func (encrypted *encryptedStorage) ListPage(ctx context.Context, prefix string, opts storage.ListOptions) (*storage.Page, error) {
+	return storage.Paging(encrypted.Provider).ListPage(ctx, prefix, opts)
+}
+
+// Snapshot delegates to the wrapped provider. Snapshots hold ciphertext.
+func (encrypted *encryptedStorage) Snapshot(ctx context.Context, path string) error {
+	snapshotter, ok := encrypted.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, path)
+}
+
+// Restore delegates to the wrapped provider.
+func (encrypted *encryptedStorage) Restore(ctx context.Context, path string) error {
+	snapshotter, ok := encrypted.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, path)
+}
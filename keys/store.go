@@ -0,0 +1,152 @@
+package keys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/talosaether/chassis/internal/sqlite"
+)
+
+// Store defines the interface for wrapped key persistence.
+type Store interface {
+	// Create stores a key version. It returns false if the version already
+	// exists or the org's keys have been revoked.
+	Create(ctx context.Context, key *OrgKey) (bool, error)
+	Get(ctx context.Context, orgID string, version int) (*OrgKey, error)
+	Latest(ctx context.Context, orgID string) (*OrgKey, error)
+
+	// Revoke deletes all of the org's keys and records the revocation.
+	Revoke(ctx context.Context, orgID string, revokedAt time.Time) error
+	IsRevoked(ctx context.Context, orgID string) (bool, error)
+
+	Close() error
+}
+
+// SQLiteStore implements Store using SQLite.
+type SQLiteStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteStore creates a new SQLite-backed key store.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLiteStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteStoreFromDB creates a key store on a database the caller owns,
+// such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
+	if err := initKeySchema(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func initKeySchema(db *sql.DB) error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS org_keys (
+			org_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			wrapped_key BLOB NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (org_id, version)
+		);
+
+		CREATE TABLE IF NOT EXISTS revoked_orgs (
+			org_id TEXT PRIMARY KEY,
+			revoked_at DATETIME NOT NULL
+		);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func (store *SQLiteStore) Create(ctx context.Context, key *OrgKey) (bool, error) {
+	query := `INSERT OR IGNORE INTO org_keys (org_id, version, wrapped_key, created_at)
+		SELECT ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM revoked_orgs WHERE org_id = ?)`
+	result, err := store.db.ExecContext(ctx, query, key.OrgID, key.Version, key.WrappedKey, key.CreatedAt, key.OrgID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (store *SQLiteStore) Get(ctx context.Context, orgID string, version int) (*OrgKey, error) {
+	query := `SELECT org_id, version, wrapped_key, created_at FROM org_keys WHERE org_id = ? AND version = ?`
+	return scanKey(store.db.QueryRowContext(ctx, query, orgID, version))
+}
+
+func (store *SQLiteStore) Latest(ctx context.Context, orgID string) (*OrgKey, error) {
+	query := `SELECT org_id, version, wrapped_key, created_at FROM org_keys
+		WHERE org_id = ? ORDER BY version DESC LIMIT 1`
+	return scanKey(store.db.QueryRowContext(ctx, query, orgID))
+}
+
+func scanKey(row *sql.Row) (*OrgKey, error) {
+	var key OrgKey
+	err := row.Scan(&key.OrgID, &key.Version, &key.WrappedKey, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (store *SQLiteStore) Revoke(ctx context.Context, orgID string, revokedAt time.Time) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO revoked_orgs (org_id, revoked_at) VALUES (?, ?)`, orgID, revokedAt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM org_keys WHERE org_id = ?`, orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (store *SQLiteStore) IsRevoked(ctx context.Context, orgID string) (bool, error) {
+	var count int
+	err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM revoked_orgs WHERE org_id = ?`, orgID).Scan(&count)
+	return count > 0, err
+}
+
+func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
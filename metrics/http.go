@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels requests that matched no ServeMux pattern.
+const unmatchedRoute = "unmatched"
+
+// Middleware records the HTTP metrics of the requests next serves. Wrap
+// the ServeMux itself: the route label is the pattern it matched, which
+// middleware in between that copies the request (such as with
+// WithContext) hides.
+func (mod *Module) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mod.httpInFlight.Inc()
+		defer mod.httpInFlight.Dec()
+
+		started := time.Now()
+		recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+		defer func() {
+			route := request.Pattern
+			if route == "" {
+				route = unmatchedRoute
+			}
+			status := strconv.Itoa(recorder.status)
+			mod.httpRequests.Inc(request.Method, route, status)
+			mod.httpDuration.Observe(time.Since(started).Seconds(), request.Method, route, status)
+			mod.httpSize.Observe(float64(recorder.size), request.Method, route, status)
+		}()
+		next.ServeHTTP(recorder, request)
+	})
+}
+
+// responseRecorder captures the status and body size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status, recorder.wroteHeader = status, true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.wroteHeader = true
+	written, err := recorder.ResponseWriter.Write(data)
+	recorder.size += int64(written)
+	return written, err
+}
+
+// Flush keeps streaming responses, such as server-sent events, working.
+func (recorder *responseRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (recorder *responseRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
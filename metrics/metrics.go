@@ -0,0 +1,475 @@
+// Package metrics provides Prometheus metrics for the chassis framework.
+//
+// The module keeps counters, gauges and histograms in memory and serves
+// them in the Prometheus text format, without a client library. It
+// instruments HTTP handlers with Middleware and, when the queue module is
+// registered before it, the jobs queue workers run.
+//
+// # Usage
+//
+// Register the module with chassis, after queue to instrument jobs:
+//
+//	metricsMod := metrics.New()
+//	app := chassis.New(
+//	    chassis.WithModules(
+//	        queue.New(),
+//	        metricsMod,
+//	    ),
+//	)
+//
+// Wrap the mux, so requests are labelled by the pattern they matched:
+//
+//	mux := http.NewServeMux()
+//	api.Mount(app, mux)
+//	http.ListenAndServe(":8080", chassis.RequestIDMiddleware(metricsMod.Middleware(mux)))
+//
+// The metrics endpoint serves /metrics for Prometheus to scrape. It is
+// off by default; enable it in config, behind a permission or on a path
+// the load balancer doesn't route:
+//
+//	http:
+//	  expose:
+//	    metrics: true
+//
+// # Built-in Metrics
+//
+//	http_requests_total              counter    method, route, status
+//	http_request_duration_seconds    histogram  method, route, status
+//	http_response_size_bytes         histogram  method, route, status
+//	http_requests_in_flight          gauge
+//	queue_job_duration_seconds       histogram  type, outcome
+//	queue_job_failures_total         counter    type
+//
+// The route is the ServeMux pattern, such as "GET /users/{id}", or
+// "unmatched", which keeps paths with IDs from creating a series each.
+// Job outcomes are completed, failed, panicked and abandoned (at shutdown).
+//
+// # Custom Metrics
+//
+// Register an application's own metrics by name, help text and label
+// names, and pass label values in the same order:
+//
+//	signups, err := metricsMod.Counter("app_signups_total", "Completed signups.", "plan")
+//	signups.Inc("trial")
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+var (
+	ErrInvalidMetric  = chassis.NewError(chassis.CodeInvalidArgument, "invalid metric")
+	ErrMetricConflict = chassis.NewError(chassis.CodeAlreadyExists, "metric already registered with a different type or labels")
+)
+
+// DefaultDurationBuckets are the histogram buckets, in seconds, of the
+// built-in duration metrics.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the histogram buckets, in bytes, of
+// http_response_size_bytes.
+var DefaultSizeBuckets = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
+
+// Kinds of metric, as named in the exposition format.
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// Module is the metrics module implementation.
+type Module struct {
+	mu       sync.RWMutex
+	families map[string]*family
+
+	durationBuckets []float64
+	app             *chassis.App
+
+	httpRequests *Counter
+	httpDuration *Histogram
+	httpSize     *Histogram
+	httpInFlight *Gauge
+	jobDuration  *Histogram
+	jobFailures  *Counter
+}
+
+// Option is a function that configures the metrics module.
+type Option func(*Module)
+
+// WithDurationBuckets sets the histogram buckets, in seconds, of the
+// built-in duration metrics. The default is DefaultDurationBuckets.
+func WithDurationBuckets(buckets ...float64) Option {
+	return func(mod *Module) {
+		mod.durationBuckets = buckets
+	}
+}
+
+// New creates a new metrics module with the given options. The built-in
+// metrics are registered right away, so Middleware works before Init.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		families:        make(map[string]*family),
+		durationBuckets: DefaultDurationBuckets,
+	}
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	mod.httpRequests = mod.mustCounter("http_requests_total", "HTTP requests served.", "method", "route", "status")
+	mod.httpDuration = mod.mustHistogram("http_request_duration_seconds", "Time taken to serve HTTP requests, in seconds.", mod.durationBuckets, "method", "route", "status")
+	mod.httpSize = mod.mustHistogram("http_response_size_bytes", "Size of HTTP response bodies, in bytes.", DefaultSizeBuckets, "method", "route", "status")
+	mod.httpInFlight = mod.mustGauge("http_requests_in_flight", "HTTP requests being served.")
+	mod.jobDuration = mod.mustHistogram("queue_job_duration_seconds", "Time taken by queue job handlers, in seconds.", mod.durationBuckets, "type", "outcome")
+	mod.jobFailures = mod.mustCounter("queue_job_failures_total", "Queue jobs that failed, panicked or were abandoned.", "type")
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "metrics"
+}
+
+// Init instruments the queue module's workers, if it is registered.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+	if queueAPI, ok := app.TryQueue(); ok {
+		if observable, ok := queueAPI.(jobObservable); ok {
+			observable.Observe(mod.observeJob)
+		}
+	}
+	return nil
+}
+
+// Shutdown does nothing; metrics live in memory.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Counter registers a counter, or returns the one registered under the
+// name with the same labels.
+func (mod *Module) Counter(name, help string, labels ...string) (*Counter, error) {
+	family, err := mod.register(name, help, kindCounter, nil, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &Counter{family: family}, nil
+}
+
+// Gauge registers a gauge, or returns the one registered under the name
+// with the same labels.
+func (mod *Module) Gauge(name, help string, labels ...string) (*Gauge, error) {
+	family, err := mod.register(name, help, kindGauge, nil, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &Gauge{family: family}, nil
+}
+
+// Histogram registers a histogram with the given upper bucket bounds, or
+// returns the one registered under the name with the same labels. A
+// +Inf bucket is always added.
+func (mod *Module) Histogram(name, help string, buckets []float64, labels ...string) (*Histogram, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	family, err := mod.register(name, help, kindHistogram, buckets, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &Histogram{family: family}, nil
+}
+
+func (mod *Module) mustCounter(name, help string, labels ...string) *Counter {
+	counter, err := mod.Counter(name, help, labels...)
+	if err != nil {
+		panic(err)
+	}
+	return counter
+}
+
+func (mod *Module) mustGauge(name, help string, labels ...string) *Gauge {
+	gauge, err := mod.Gauge(name, help, labels...)
+	if err != nil {
+		panic(err)
+	}
+	return gauge
+}
+
+func (mod *Module) mustHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	histogram, err := mod.Histogram(name, help, buckets, labels...)
+	if err != nil {
+		panic(err)
+	}
+	return histogram
+}
+
+// metricName matches valid metric and label names.
+var metricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// register is the internal implementation of Counter, Gauge and Histogram.
+func (mod *Module) register(name, help, kind string, buckets []float64, labels []string) (*family, error) {
+	if !metricName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name %q", ErrInvalidMetric, name)
+	}
+	for _, label := range labels {
+		if !metricName.MatchString(label) || strings.HasPrefix(label, "__") || label == "le" {
+			return nil, fmt.Errorf("%w: %s label %q", ErrInvalidMetric, name, label)
+		}
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+	if len(buckets) > 0 && math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	if existing, ok := mod.families[name]; ok {
+		if existing.kind != kind || !slices.Equal(existing.labels, labels) || !slices.Equal(existing.buckets, buckets) {
+			return nil, fmt.Errorf("%w: %s", ErrMetricConflict, name)
+		}
+		return existing, nil
+	}
+	family := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  slices.Clone(labels),
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	mod.families[name] = family
+	return family, nil
+}
+
+// family is a metric and its series, one per combination of label values.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64 // upper bounds without +Inf, for histograms
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is one combination of label values.
+type series struct {
+	labels []string
+	value  float64  // counters and gauges
+	counts []uint64 // histogram observations per bucket, the last for +Inf
+	sum    float64
+	count  uint64
+}
+
+// with returns the series of the label values, creating it. The caller
+// holds family.mu.
+func (family *family) with(values []string) *series {
+	if len(values) != len(family.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", family.name, len(family.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	found, ok := family.series[key]
+	if !ok {
+		found = &series{labels: slices.Clone(values)}
+		if family.kind == kindHistogram {
+			found.counts = make([]uint64, len(family.buckets)+1)
+		}
+		family.series[key] = found
+	}
+	return found
+}
+
+// Counter is a value that only goes up, such as requests served.
+type Counter struct {
+	family *family
+}
+
+// Inc adds one to the series of the label values.
+func (counter *Counter) Inc(labels ...string) {
+	counter.Add(1, labels...)
+}
+
+// Add adds a non-negative value to the series of the label values.
+func (counter *Counter) Add(value float64, labels ...string) {
+	if value < 0 {
+		return
+	}
+	counter.family.mu.Lock()
+	defer counter.family.mu.Unlock()
+	counter.family.with(labels).value += value
+}
+
+// Gauge is a value that goes up and down, such as requests in flight.
+type Gauge struct {
+	family *family
+}
+
+// Set sets the series of the label values.
+func (gauge *Gauge) Set(value float64, labels ...string) {
+	gauge.family.mu.Lock()
+	defer gauge.family.mu.Unlock()
+	gauge.family.with(labels).value = value
+}
+
+// Add adds a value, possibly negative, to the series of the label values.
+func (gauge *Gauge) Add(value float64, labels ...string) {
+	gauge.family.mu.Lock()
+	defer gauge.family.mu.Unlock()
+	gauge.family.with(labels).value += value
+}
+
+// Inc adds one to the series of the label values.
+func (gauge *Gauge) Inc(labels ...string) {
+	gauge.Add(1, labels...)
+}
+
+// Dec subtracts one from the series of the label values.
+func (gauge *Gauge) Dec(labels ...string) {
+	gauge.Add(-1, labels...)
+}
+
+// Histogram counts observations, such as durations, in buckets.
+type Histogram struct {
+	family *family
+}
+
+// Observe records a value in the series of the label values.
+func (histogram *Histogram) Observe(value float64, labels ...string) {
+	histogram.family.mu.Lock()
+	defer histogram.family.mu.Unlock()
+	found := histogram.family.with(labels)
+	bucket, _ := slices.BinarySearch(histogram.family.buckets, value)
+	found.counts[bucket]++
+	found.sum += value
+	found.count++
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (mod *Module) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			api.MethodNotAllowed(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = writer.Write([]byte(mod.Exposition()))
+	})
+}
+
+// Exposition returns the metrics in the Prometheus text exposition
+// format, sorted by name and labels.
+func (mod *Module) Exposition() string {
+	mod.mu.RLock()
+	families := make([]*family, 0, len(mod.families))
+	for _, family := range mod.families {
+		families = append(families, family)
+	}
+	mod.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var out strings.Builder
+	for _, family := range families {
+		family.write(&out)
+	}
+	return out.String()
+}
+
+// write appends the family in the exposition format.
+func (family *family) write(out *strings.Builder) {
+	family.mu.Lock()
+	defer family.mu.Unlock()
+	if len(family.series) == 0 && len(family.labels) > 0 {
+		return
+	}
+	fmt.Fprintf(out, "# HELP %s %s\n", family.name, escapeHelp(family.help))
+	fmt.Fprintf(out, "# TYPE %s %s\n", family.name, family.kind)
+	if len(family.series) == 0 {
+		// A metric without labels has a series from the start
+		family.with(nil)
+	}
+
+	keys := make([]string, 0, len(family.series))
+	for key := range family.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		found := family.series[key]
+		if family.kind != kindHistogram {
+			fmt.Fprintf(out, "%s%s %s\n", family.name, family.labelSet(found.labels, ""), formatFloat(found.value))
+			continue
+		}
+		var cumulative uint64
+		for i, count := range found.counts {
+			cumulative += count
+			bound := math.Inf(1)
+			if i < len(family.buckets) {
+				bound = family.buckets[i]
+			}
+			fmt.Fprintf(out, "%s_bucket%s %d\n", family.name, family.labelSet(found.labels, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(out, "%s_sum%s %s\n", family.name, family.labelSet(found.labels, ""), formatFloat(found.sum))
+		fmt.Fprintf(out, "%s_count%s %d\n", family.name, family.labelSet(found.labels, ""), found.count)
+	}
+}
+
+// labelSet formats label values as {name="value",...}, with an le label
+// for histogram buckets.
+func (family *family) labelSet(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, family.labels[i]+`="`+escapeLabel(value)+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string   { return helpEscaper.Replace(help) }
+func escapeLabel(value string) string { return labelEscaper.Replace(value) }
+
+// Endpoints serves the metrics at /metrics, off by default. Implements
+// chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{{
+		Name:    "metrics",
+		Path:    "/metrics",
+		Handler: mod.Handler(),
+	}}
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/queue"
+)
+
+func TestModule_Name(t *testing.T) {
+	if name := New().Name(); name != "metrics" {
+		t.Errorf("expected metrics, got %s", name)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	mod := New()
+	signups, err := mod.Counter("app_signups_total", "Completed signups.", "plan")
+	if err != nil {
+		t.Fatalf("Counter failed: %v", err)
+	}
+	signups.Inc("trial")
+	signups.Add(2, "trial")
+	signups.Inc(`pro "annual"`)
+
+	again, err := mod.Counter("app_signups_total", "Completed signups.", "plan")
+	if err != nil {
+		t.Fatalf("expected the existing counter, got %v", err)
+	}
+	again.Inc("trial")
+	if _, err := mod.Gauge("app_signups_total", "Completed signups.", "plan"); !errors.Is(err, ErrMetricConflict) {
+		t.Errorf("expected ErrMetricConflict, got %v", err)
+	}
+	if _, err := mod.Counter("app-signups", "Bad name."); !errors.Is(err, ErrInvalidMetric) {
+		t.Errorf("expected ErrInvalidMetric, got %v", err)
+	}
+
+	latency, _ := mod.Histogram("app_latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	exposition := mod.Exposition()
+	for _, line := range []string{
+		"# TYPE app_signups_total counter",
+		`app_signups_total{plan="trial"} 4`,
+		`app_signups_total{plan="pro \"annual\""} 1`,
+		`app_latency_seconds_bucket{le="0.1"} 1`,
+		`app_latency_seconds_bucket{le="1"} 2`,
+		`app_latency_seconds_bucket{le="+Inf"} 3`,
+		"app_latency_seconds_sum 5.55",
+		"app_latency_seconds_count 3",
+		"http_requests_in_flight 0",
+	} {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, exposition)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	mod := New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("hello"))
+	})
+	handler := mod.Middleware(mux)
+
+	for _, path := range []string{"/users/1", "/users/2", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	recorder := httptest.NewRecorder()
+	mod.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("expected the Prometheus text format, got %q", contentType)
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="GET /users/{id}",status="200"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="GET /users/{id}",status="200"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="GET /users/{id}",status="200"} 10`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestQueueInstrumentation(t *testing.T) {
+	queueMod := queue.New(queue.WithStore(queue.NewMemoryStore()))
+	mod := New()
+	app := chassis.New(chassis.WithModules(queueMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{}, 3)
+	queueMod.Handle("report", func(ctx context.Context, job *queue.Job) error {
+		defer func() { done <- struct{}{} }()
+		if string(job.Payload) == `"bad"` {
+			return errors.New("bad report")
+		}
+		return nil
+	})
+	for _, payload := range []string{"good", "good", "bad"} {
+		if _, err := queueMod.Enqueue(ctx, "report", payload); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+	go queueMod.Worker(ctx, nil)
+	for range 3 {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the jobs to run")
+		}
+	}
+
+	// The observers run once the job's status is saved
+	expected := []string{
+		`queue_job_duration_seconds_count{type="report",outcome="completed"} 2`,
+		`queue_job_duration_seconds_count{type="report",outcome="failed"} 1`,
+		`queue_job_failures_total{type="report"} 1`,
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exposition, missing := mod.Exposition(), ""
+		for _, line := range expected {
+			if !strings.Contains(exposition, line+"\n") {
+				missing = line
+			}
+		}
+		if missing == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q in:\n%s", missing, exposition)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/talosaether/chassis/queue"
+)
+
+// jobObservable is implemented by the queue module.
+type jobObservable interface {
+	Observe(observer queue.JobObserver)
+}
+
+// Outcomes of queue jobs, as labelled in queue_job_duration_seconds.
+const (
+	outcomeCompleted = "completed"
+	outcomeFailed    = "failed"
+	outcomePanicked  = "panicked"
+	outcomeAbandoned = "abandoned"
+)
+
+// observeJob records the metrics of a job a worker ran.
+func (mod *Module) observeJob(ctx context.Context, job *queue.Job, duration time.Duration, err error) {
+	outcome := outcomeCompleted
+	switch {
+	case err == nil:
+	case errors.Is(err, queue.ErrJobPanicked):
+		outcome = outcomePanicked
+	case errors.Is(err, queue.ErrDrainTimeout):
+		outcome = outcomeAbandoned
+	default:
+		outcome = outcomeFailed
+	}
+	mod.jobDuration.Observe(duration.Seconds(), job.Type, outcome)
+	if outcome != outcomeCompleted {
+		mod.jobFailures.Inc(job.Type)
+	}
+}
@@ -1,6 +1,10 @@
 package chassis
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sort"
+)
 
 // Module is the interface that all chassis modules must implement.
 // It provides lifecycle hooks and identification.
@@ -17,6 +21,51 @@ type Module interface {
 	Shutdown(ctx context.Context) error
 }
 
+// Dependent is implemented by modules that need other modules to work.
+// Register fails with ErrMissingDependency unless every module named by
+// Dependencies was registered first, so a missing dependency is reported
+// at startup rather than as a panic inside a request.
+type Dependent interface {
+	Dependencies() []string
+}
+
+// ErrMissingDependency is returned by Register for a Dependent module whose
+// dependencies aren't registered.
+var ErrMissingDependency = NewError(CodeFailedPrecondition, "missing module dependency")
+
+// checkDependencies returns ErrMissingDependency, naming the first
+// missing module, if mod depends on a module app doesn't have.
+func (app *App) checkDependencies(mod Module) error {
+	dependent, ok := mod.(Dependent)
+	if !ok {
+		return nil
+	}
+	for _, dependency := range dependent.Dependencies() {
+		if !app.HasModule(dependency) {
+			return fmt.Errorf("%w: %s requires %s module", ErrMissingDependency, mod.Name(), dependency)
+		}
+	}
+	return nil
+}
+
+// ErrUnknownModule is returned for a module named in config that has no
+// factory set with WithModuleFactory.
+var ErrUnknownModule = NewError(CodeNotFound, "no factory registered for module")
+
+// ModuleFactory creates a module with its default options. The module
+// reads the rest of its settings from config at Init.
+type ModuleFactory func() Module
+
+// ModuleFactories returns the names of the app's module factories, sorted.
+func (app *App) ModuleFactories() []string {
+	names := make([]string, 0, len(app.factories))
+	for name := range app.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ModuleOption is a function that configures a module during creation.
 // Each module defines its own option functions.
 type ModuleOption func(interface{})
@@ -0,0 +1,84 @@
+package notifications
+
+import (
+	"net/http"
+
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// Handler returns an HTTP handler for the logged-in user's notifications.
+// Mount it behind auth.RequireAuth under a prefix:
+//
+//	mux.Handle("/notifications/", http.StripPrefix("/notifications", authMod.RequireAuth(notifier.Handler())))
+//
+// Routes (relative to the prefix):
+//
+//	GET    /                 page of notifications; ?unread=true, page, limit, cursor
+//	GET    /unread-count     {"unread": n}
+//	POST   /{id}/read        mark one read
+//	POST   /read-all         mark all read; {"marked": n}
+//	DELETE /{id}             delete one
+func (mod *Module) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", mod.serveList)
+	mux.HandleFunc("GET /unread-count", func(writer http.ResponseWriter, request *http.Request) {
+		unread, err := mod.UnreadCount(request.Context(), auth.UserIDFromContext(request.Context()))
+		if err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		api.WriteJSON(writer, http.StatusOK, map[string]int{"unread": unread})
+	})
+	mux.HandleFunc("POST /{id}/read", func(writer http.ResponseWriter, request *http.Request) {
+		if err := mod.MarkRead(request.Context(), auth.UserIDFromContext(request.Context()), request.PathValue("id")); err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /read-all", func(writer http.ResponseWriter, request *http.Request) {
+		marked, err := mod.MarkAllRead(request.Context(), auth.UserIDFromContext(request.Context()))
+		if err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		api.WriteJSON(writer, http.StatusOK, map[string]int{"marked": marked})
+	})
+	mux.HandleFunc("DELETE /{id}", func(writer http.ResponseWriter, request *http.Request) {
+		if err := mod.Delete(request.Context(), auth.UserIDFromContext(request.Context()), request.PathValue("id")); err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	return requireUser(mux)
+}
+
+func (mod *Module) serveList(writer http.ResponseWriter, request *http.Request) {
+	req, err := pagination.FromRequest(request)
+	if err != nil {
+		api.WriteError(writer, request, err)
+		return
+	}
+	opts := ListOptions{UnreadOnly: request.URL.Query().Get("unread") == "true"}
+	page, err := mod.List(request.Context(), auth.UserIDFromContext(request.Context()), opts, req)
+	if err != nil {
+		api.WriteError(writer, request, err)
+		return
+	}
+	api.WriteJSON(writer, http.StatusOK, page)
+}
+
+// requireUser rejects requests without a logged-in user, in case the
+// handler is mounted without auth.RequireAuth.
+func requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if auth.UserIDFromContext(request.Context()) == "" {
+			api.WriteError(writer, request, auth.ErrNotAuthenticated)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,559 @@
+// Package notifications provides an in-app notification center: per-user
+// notifications with a title, body and link that users list and mark read.
+//
+// # Usage
+//
+// Register the module after the modules it uses (users and email for email
+// fan-out, events for rules):
+//
+//	notifier := notifications.New(
+//	    notifications.WithRule(orgs.EventMemberAdded, notifications.MemberAdded),
+//	)
+//	app := chassis.New(chassis.WithModules(users.New(), orgs.New(), events.New(), email.New(), notifier))
+//
+// Notify a user directly:
+//
+//	n, err := notifier.Notify(ctx, notifications.Input{
+//	    UserID: userID,
+//	    OrgID:  orgID,
+//	    Type:   "invoice.paid",
+//	    Title:  "Invoice paid",
+//	    Link:   "/billing/invoices/" + invoiceID,
+//	})
+//
+// List and mark notifications read:
+//
+//	page, _ := notifier.List(ctx, userID, notifications.ListOptions{UnreadOnly: true}, pagination.Request{Limit: 20})
+//	unread, _ := notifier.UnreadCount(ctx, userID)
+//	err = notifier.MarkRead(ctx, userID, n.ID)
+//	marked, _ := notifier.MarkAllRead(ctx, userID)
+//
+// Handler serves the same operations for the logged-in user over HTTP.
+//
+// # Rules
+//
+// A Rule turns an event into notifications. Rules run in the event handler,
+// so the app is in their context (chassis.FromContext). MemberAdded
+// notifies users added to an org, and DeletionScheduled warns an org's
+// members when it is deleted, while it can still be restored.
+//
+// # Email
+//
+// Notifications can also be emailed with an email template, executed with
+// the *Notification as .Data:
+//
+//	notifications.New(notifications.WithEmail("notification", orgs.EventMemberAdded))
+//
+// Input.EmailTemplate emails a single notification with another template.
+// Email needs the users and email modules; sending failures are logged and
+// don't fail the notification.
+//
+// # Events
+//
+// Each notification publishes notification.created (*Notification), so
+// other modules (e.g., realtime) can push it to connected clients.
+//
+// An org's notifications are deleted when the orgs module purges the org
+// (chassis.OrgPurger).
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	notifications:
+//	  db_path: ./data/notifications.db
+//	  email:
+//	    template: notification
+//	    types: [org.member_added]   # all types if empty
+//
+// Or programmatically:
+//
+//	notifications.New(notifications.WithDBPath("/custom/notifications.db"))
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/users"
+)
+
+var (
+	ErrNotificationNotFound = chassis.NewError(chassis.CodeNotFound, "notification not found")
+	ErrUserRequired         = chassis.NewError(chassis.CodeInvalidArgument, "notification needs a user ID")
+	ErrTitleRequired        = chassis.NewError(chassis.CodeInvalidArgument, "notification needs a title")
+)
+
+// EventCreated is published for each new notification.
+const EventCreated = "notification.created" // payload: *Notification
+
+// Notification is a message shown to one user.
+type Notification struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	OrgID     string     `json:"org_id,omitempty"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body,omitempty"`
+	Link      string     `json:"link,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Read reports whether the user has read the notification.
+func (notification *Notification) Read() bool {
+	return notification.ReadAt != nil
+}
+
+// Input contains the data needed to create a notification.
+type Input struct {
+	UserID string
+	OrgID  string
+	Type   string
+	Title  string
+	Body   string
+	Link   string
+
+	// EmailTemplate also emails the notification with this template,
+	// whether or not its type is emailed by WithEmail.
+	EmailTemplate string
+}
+
+// ListOptions filters List.
+type ListOptions struct {
+	UnreadOnly bool
+}
+
+// Rule turns an event into notifications. Return none to skip the event.
+type Rule func(ctx context.Context, eventType string, payload any) ([]Input, error)
+
+type rule struct {
+	eventType string
+	rule      Rule
+}
+
+// Module is the notifications module implementation.
+type Module struct {
+	store  Store
+	dbPath string
+	app    *chassis.App
+	now    func() time.Time
+
+	emailTemplate string
+	emailTypes    []string
+
+	mu           sync.Mutex
+	rules        []rule
+	unsubscribes []func()
+}
+
+// Option is a function that configures the notifications module.
+type Option func(*Module)
+
+// WithStore sets a custom store implementation.
+func WithStore(store Store) Option {
+	return func(mod *Module) {
+		mod.store = store
+	}
+}
+
+// WithDBPath sets the SQLite database path.
+func WithDBPath(path string) Option {
+	return func(mod *Module) {
+		mod.dbPath = path
+	}
+}
+
+// WithRule creates notifications from events of the given type.
+func WithRule(eventType string, fn Rule) Option {
+	return func(mod *Module) {
+		mod.rules = append(mod.rules, rule{eventType: eventType, rule: fn})
+	}
+}
+
+// WithEmail emails notifications of the given types (all types if none)
+// with the named email template.
+func WithEmail(template string, types ...string) Option {
+	return func(mod *Module) {
+		mod.emailTemplate = template
+		mod.emailTypes = types
+	}
+}
+
+// WithClock sets the time source. Intended for tests.
+func WithClock(now func() time.Time) Option {
+	return func(mod *Module) {
+		mod.now = now
+	}
+}
+
+// New creates a new notifications module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		dbPath: "./data/notifications.db",
+		now:    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "notifications"
+}
+
+// Init initializes the notifications module and subscribes its rules.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	// Read config if available
+	if cfg := app.ConfigData(); cfg != nil {
+		if dbPath := cfg.GetString("notifications.db_path"); dbPath != "" {
+			mod.dbPath = dbPath
+		}
+		if template := cfg.GetString("notifications.email.template"); template != "" {
+			mod.emailTemplate = template
+			mod.emailTypes = nil
+			if types, ok := cfg.Get("notifications.email.types").([]any); ok {
+				for _, eventType := range types {
+					mod.emailTypes = append(mod.emailTypes, fmt.Sprint(eventType))
+				}
+			}
+		}
+	}
+
+	// Use default SQLite store if none provided
+	if mod.store == nil {
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to create notifications store: %w", err)
+		}
+		mod.store = sqliteStore
+	}
+
+	mod.mu.Lock()
+	for _, rule := range mod.rules {
+		mod.subscribe(rule)
+	}
+	mod.mu.Unlock()
+
+	app.Logger().Info("notifications module initialized",
+		"db_path", mod.dbPath,
+		"rules", len(mod.rules),
+		"email_template", mod.emailTemplate,
+	)
+	return nil
+}
+
+// openSQLiteStore creates the store on the database named by
+// notifications.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("notifications")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
+// Shutdown unsubscribes the rules and closes the store.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	mod.mu.Lock()
+	for _, unsubscribe := range mod.unsubscribes {
+		unsubscribe()
+	}
+	mod.unsubscribes = nil
+	mod.mu.Unlock()
+
+	if mod.store != nil {
+		return mod.store.Close()
+	}
+	return nil
+}
+
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "notifications.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "notifications.db"))
+}
+
+// PlanUserCleanup plans deleting the user's notifications. Implements
+// chassis.UserCleaner.
+func (mod *Module) PlanUserCleanup(ctx context.Context, userID string) ([]chassis.CleanupAction, error) {
+	return []chassis.CleanupAction{{
+		Module:      mod.Name(),
+		Kind:        "notifications",
+		Resource:    userID,
+		Description: "delete notifications of user " + userID,
+		Apply: func(ctx context.Context) error {
+			return mod.store.DeleteByUser(ctx, userID)
+		},
+	}}, nil
+}
+
+// ExportOrg writes the notifications sent in the organization to
+// notifications.json. Implements chassis.OrgExporter.
+func (mod *Module) ExportOrg(ctx context.Context, orgID string, export chassis.ExportWriter) error {
+	notifications, err := mod.store.ListByOrg(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to list notifications: %w", err)
+	}
+	if notifications == nil {
+		notifications = []*Notification{}
+	}
+	return export.WriteJSON("notifications.json", notifications)
+}
+
+// PurgeOrg deletes the notifications sent in the organization. Implements
+// chassis.OrgPurger.
+func (mod *Module) PurgeOrg(ctx context.Context, orgID string) error {
+	notifications, err := mod.store.ListByOrg(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to list notifications: %w", err)
+	}
+	for _, notification := range notifications {
+		if err := mod.store.Delete(ctx, notification.UserID, notification.ID); err != nil {
+			return fmt.Errorf("failed to delete notification %s: %w", notification.ID, err)
+		}
+	}
+	return nil
+}
+
+// ExportUser writes the user's notifications to notifications.json.
+// Implements chassis.UserExporter.
+func (mod *Module) ExportUser(ctx context.Context, userID string, export chassis.ExportWriter) error {
+	notifications := make([]*Notification, 0)
+	req := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		page, err := mod.List(ctx, userID, ListOptions{}, req)
+		if err != nil {
+			return fmt.Errorf("failed to list notifications: %w", err)
+		}
+		notifications = append(notifications, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	return export.WriteJSON("notifications.json", notifications)
+}
+
+// On creates notifications from events of the given type, like WithRule.
+func (mod *Module) On(eventType string, fn Rule) {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	rule := rule{eventType: eventType, rule: fn}
+	mod.rules = append(mod.rules, rule)
+	if mod.app != nil {
+		mod.subscribe(rule)
+	}
+}
+
+// subscribe registers a rule's event handler. It is a no-op without the
+// events module. Callers hold mod.mu.
+func (mod *Module) subscribe(rule rule) {
+	eventsMod, ok := mod.app.TryEvents()
+	if !ok {
+		mod.app.Logger().Warn("notification rule ignored without the events module", "event", rule.eventType)
+		return
+	}
+	unsubscribe := eventsMod.Subscribe(rule.eventType, func(ctx context.Context, eventType string, payload any) error {
+		inputs, err := rule.rule(ctx, eventType, payload)
+		if err != nil {
+			return fmt.Errorf("notification rule for %s failed: %w", eventType, err)
+		}
+		for _, input := range inputs {
+			if input.Type == "" {
+				input.Type = eventType
+			}
+			if _, err := mod.Notify(ctx, input); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	mod.unsubscribes = append(mod.unsubscribes, unsubscribe)
+}
+
+// Notify creates a notification, emailing it if configured.
+func (mod *Module) Notify(ctx context.Context, input Input) (*Notification, error) {
+	if input.UserID == "" {
+		return nil, ErrUserRequired
+	}
+	if input.Title == "" {
+		return nil, ErrTitleRequired
+	}
+
+	notification := &Notification{
+		ID:        uuid.New().String(),
+		UserID:    input.UserID,
+		OrgID:     input.OrgID,
+		Type:      input.Type,
+		Title:     input.Title,
+		Body:      input.Body,
+		Link:      input.Link,
+		CreatedAt: mod.now(),
+	}
+	if err := mod.store.Create(ctx, notification); err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+	mod.app.PublishEvent(ctx, EventCreated, notification)
+
+	if template := mod.emailTemplateFor(input); template != "" {
+		if err := mod.email(ctx, notification, template); err != nil {
+			chassis.LoggerFromContext(ctx).Error("failed to email notification",
+				"notification_id", notification.ID, "template", template, "error", err)
+		}
+	}
+	return notification, nil
+}
+
+// emailTemplateFor returns the template to email a notification with, or
+// "" not to email it.
+func (mod *Module) emailTemplateFor(input Input) string {
+	if input.EmailTemplate != "" {
+		return input.EmailTemplate
+	}
+	if mod.emailTemplate != "" && (len(mod.emailTypes) == 0 || slices.Contains(mod.emailTypes, input.Type)) {
+		return mod.emailTemplate
+	}
+	return ""
+}
+
+func (mod *Module) email(ctx context.Context, notification *Notification, template string) error {
+	usersMod, hasUsers := mod.app.TryUsers()
+	emailMod, hasEmail := mod.app.TryEmail()
+	if !hasUsers || !hasEmail {
+		return fmt.Errorf("emailing notifications needs the users and email modules")
+	}
+	result, err := usersMod.GetByID(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	if notification.OrgID != "" {
+		ctx = email.WithOrgID(ctx, notification.OrgID)
+	}
+	return emailMod.SendTemplate(ctx, result.(*users.User).Email, template, notification)
+}
+
+// Get retrieves one of a user's notifications.
+func (mod *Module) Get(ctx context.Context, userID, id string) (*Notification, error) {
+	notification, err := mod.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Other users' notifications don't exist as far as the caller knows
+	if notification.UserID != userID {
+		return nil, ErrNotificationNotFound
+	}
+	return notification, nil
+}
+
+// List returns a page of a user's notifications, newest first.
+func (mod *Module) List(ctx context.Context, userID string, opts ListOptions, req pagination.Request) (*pagination.Result[*Notification], error) {
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, err := mod.store.List(ctx, userID, opts.UnreadOnly, offset, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := mod.store.Count(ctx, userID, opts.UnreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(notifications, req, offset, total), nil
+}
+
+// UnreadCount returns the number of notifications the user hasn't read.
+func (mod *Module) UnreadCount(ctx context.Context, userID string) (int, error) {
+	return mod.store.Count(ctx, userID, true)
+}
+
+// MarkRead marks one of a user's notifications read. Marking a read
+// notification again keeps its original read time.
+func (mod *Module) MarkRead(ctx context.Context, userID, id string) error {
+	return mod.store.MarkRead(ctx, userID, id, mod.now())
+}
+
+// MarkAllRead marks all of a user's notifications read and returns how
+// many were unread.
+func (mod *Module) MarkAllRead(ctx context.Context, userID string) (int, error) {
+	return mod.store.MarkAllRead(ctx, userID, mod.now())
+}
+
+// Delete removes one of a user's notifications.
+func (mod *Module) Delete(ctx context.Context, userID, id string) error {
+	return mod.store.Delete(ctx, userID, id)
+}
+
+// MemberAdded is a Rule for orgs.EventMemberAdded that tells users they
+// were added to an org.
+func MemberAdded(ctx context.Context, eventType string, payload any) ([]Input, error) {
+	event, ok := payload.(*orgs.MemberEvent)
+	if !ok {
+		return nil, nil
+	}
+	title := "You were added to an organization"
+	if orgsMod, ok := chassis.FromContext(ctx).TryOrgs(); ok {
+		if result, err := orgsMod.GetByID(ctx, event.OrgID); err == nil {
+			title = "You were added to " + result.(*orgs.Org).Name
+		}
+	}
+	return []Input{{
+		UserID: event.UserID,
+		OrgID:  event.OrgID,
+		Title:  title,
+		Body:   "Your role is " + event.Role + ".",
+	}}, nil
+}
+
+// DeletionScheduled is a Rule for orgs.EventDeletionScheduled that warns
+// an org's members before it is purged.
+func DeletionScheduled(ctx context.Context, eventType string, payload any) ([]Input, error) {
+	event, ok := payload.(*orgs.DeletionEvent)
+	if !ok {
+		return nil, nil
+	}
+	inputs := make([]Input, 0, len(event.MemberIDs))
+	for _, userID := range event.MemberIDs {
+		inputs = append(inputs, Input{
+			UserID: userID,
+			OrgID:  event.OrgID,
+			Title:  event.Name + " is scheduled for deletion",
+			Body:   "It will be deleted for good on " + event.PurgeAt.UTC().Format("2 January 2006") + " unless it is restored.",
+		})
+	}
+	return inputs, nil
+}
@@ -0,0 +1,336 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/users"
+)
+
+func newTestModule(t *testing.T, opts ...Option) (*Module, *chassis.App) {
+	t.Helper()
+	mod := New(append([]Option{WithDBPath(filepath.Join(t.TempDir(), "notifications.db"))}, opts...)...)
+	app := chassis.New(chassis.WithModules(mod))
+	if !app.HasModule("notifications") {
+		t.Fatal("notifications module not registered")
+	}
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return mod, app
+}
+
+func TestNotify(t *testing.T) {
+	mod, _ := newTestModule(t)
+	ctx := context.Background()
+
+	if _, err := mod.Notify(ctx, Input{Title: "Hello"}); !errors.Is(err, ErrUserRequired) {
+		t.Errorf("expected ErrUserRequired, got %v", err)
+	}
+	if _, err := mod.Notify(ctx, Input{UserID: "user-1"}); !errors.Is(err, ErrTitleRequired) {
+		t.Errorf("expected ErrTitleRequired, got %v", err)
+	}
+
+	created, err := mod.Notify(ctx, Input{UserID: "user-1", OrgID: "org-1", Type: "invoice.paid", Title: "Invoice paid", Link: "/invoices/1"})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	got, err := mod.Get(ctx, "user-1", created.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Title != "Invoice paid" || got.Link != "/invoices/1" || got.OrgID != "org-1" || got.Read() {
+		t.Errorf("unexpected notification: %+v", got)
+	}
+	if _, err := mod.Get(ctx, "user-2", created.ID); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("expected other users' notifications to be hidden, got %v", err)
+	}
+}
+
+func TestListAndMarkRead(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mod, _ := newTestModule(t, WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	var ids []string
+	for _, title := range []string{"first", "second", "third"} {
+		now = now.Add(time.Minute)
+		created, err := mod.Notify(ctx, Input{UserID: "user-1", Title: title})
+		if err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+	if _, err := mod.Notify(ctx, Input{UserID: "user-2", Title: "other"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	page, err := mod.List(ctx, "user-1", ListOptions{}, pagination.Request{Limit: 2})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if page.Total != 3 || len(page.Items) != 2 || !page.HasMore || page.Items[0].Title != "third" {
+		t.Errorf("expected the newest 2 of 3, got %d of %d, first %q", len(page.Items), page.Total, page.Items[0].Title)
+	}
+
+	if err := mod.MarkRead(ctx, "user-1", ids[0]); err != nil {
+		t.Fatalf("MarkRead failed: %v", err)
+	}
+	if err := mod.MarkRead(ctx, "user-2", ids[1]); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("expected ErrNotificationNotFound marking another user's notification, got %v", err)
+	}
+	if unread, _ := mod.UnreadCount(ctx, "user-1"); unread != 2 {
+		t.Errorf("expected 2 unread, got %d", unread)
+	}
+	unread, err := mod.List(ctx, "user-1", ListOptions{UnreadOnly: true}, pagination.Request{})
+	if err != nil || unread.Total != 2 {
+		t.Fatalf("expected 2 unread notifications, got %v, %v", unread, err)
+	}
+
+	readAt := now
+	now = now.Add(time.Hour)
+	marked, err := mod.MarkAllRead(ctx, "user-1")
+	if err != nil || marked != 2 {
+		t.Errorf("expected 2 marked read, got %d, %v", marked, err)
+	}
+	first, _ := mod.Get(ctx, "user-1", ids[0])
+	if first.ReadAt == nil || !first.ReadAt.Equal(readAt) {
+		t.Errorf("expected the first read time kept, got %v", first.ReadAt)
+	}
+	if unread, _ := mod.UnreadCount(ctx, "user-2"); unread != 1 {
+		t.Errorf("expected other users unaffected, got %d unread", unread)
+	}
+
+	if err := mod.Delete(ctx, "user-1", ids[2]); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := mod.Get(ctx, "user-1", ids[2]); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("expected the notification deleted, got %v", err)
+	}
+}
+
+func TestRules(t *testing.T) {
+	dir := t.TempDir()
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "notifications.db")), WithRule(orgs.EventMemberAdded, MemberAdded),
+		WithRule(orgs.EventDeletionScheduled, DeletionScheduled))
+	app := chassis.New(chassis.WithModules(events.New(), orgsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	var created []*Notification
+	app.Events().Subscribe(EventCreated, func(ctx context.Context, eventType string, payload any) error {
+		created = append(created, payload.(*Notification))
+		return nil
+	})
+
+	result, err := orgsMod.Create(ctx, orgs.CreateInput{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	org := result.(*orgs.Org)
+	if _, err := orgsMod.AddMember(ctx, org.ID(), "user-1", "admin"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+
+	page, err := mod.List(ctx, "user-1", ListOptions{}, pagination.Request{})
+	if err != nil || len(page.Items) != 1 {
+		t.Fatalf("expected one notification, got %v, %v", page, err)
+	}
+	notification := page.Items[0]
+	if notification.Title != "You were added to Acme" || notification.Type != orgs.EventMemberAdded || notification.OrgID != org.ID() {
+		t.Errorf("unexpected notification: %+v", notification)
+	}
+	if len(created) != 1 || created[0].ID != notification.ID {
+		t.Errorf("expected %s published, got %v", EventCreated, created)
+	}
+
+	if err := orgsMod.Delete(ctx, org.ID()); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	page, _ = mod.List(ctx, "user-1", ListOptions{}, pagination.Request{})
+	if len(page.Items) != 2 || page.Items[0].Title != "Acme is scheduled for deletion" {
+		t.Errorf("expected a deletion warning, got %+v", page.Items)
+	}
+
+	mod.On("invoice.paid", func(ctx context.Context, eventType string, payload any) ([]Input, error) {
+		return []Input{{UserID: payload.(string), Title: "Invoice paid"}}, nil
+	})
+	app.Events().Publish(ctx, "invoice.paid", "user-2")
+	if unread, _ := mod.UnreadCount(ctx, "user-2"); unread != 1 {
+		t.Errorf("expected a notification from a rule added with On, got %d", unread)
+	}
+}
+
+func TestPurgeOrg(t *testing.T) {
+	mod, _ := newTestModule(t)
+	ctx := context.Background()
+	mod.Notify(ctx, Input{UserID: "user-1", OrgID: "org-1", Title: "Invoice paid"})
+	mod.Notify(ctx, Input{UserID: "user-2", OrgID: "org-1", Title: "Invoice overdue"})
+	mod.Notify(ctx, Input{UserID: "user-1", Title: "Welcome"})
+
+	if err := mod.PurgeOrg(ctx, "org-1"); err != nil {
+		t.Fatalf("PurgeOrg failed: %v", err)
+	}
+	if unread, _ := mod.UnreadCount(ctx, "user-1"); unread != 1 {
+		t.Errorf("expected only the notification outside the org kept, got %d", unread)
+	}
+	if unread, _ := mod.UnreadCount(ctx, "user-2"); unread != 0 {
+		t.Errorf("expected the org's notifications deleted, got %d", unread)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var sent []string
+	emailMod := email.New(email.WithProvider(email.NewLogProvider(func(to, subject, body string) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, to+": "+subject)
+	})))
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	mod := New(WithDBPath(filepath.Join(dir, "notifications.db")), WithEmail("notification", "invoice.paid"))
+	app := chassis.New(chassis.WithModules(usersMod, emailMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := emailMod.RegisterTemplate("notification", email.Template{Subject: "{{.Data.Title}}", Text: "{{.Data.Body}}"}); err != nil {
+		t.Fatalf("RegisterTemplate failed: %v", err)
+	}
+	result, err := usersMod.Create(ctx, "ann@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	userID := result.(*users.User).ID
+
+	if _, err := mod.Notify(ctx, Input{UserID: userID, Type: "invoice.paid", Title: "Invoice paid"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if _, err := mod.Notify(ctx, Input{UserID: userID, Type: "comment.added", Title: "New comment"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if _, err := mod.Notify(ctx, Input{UserID: userID, Type: "comment.added", Title: "Mentioned", EmailTemplate: "notification"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"ann@example.com: Invoice paid", "ann@example.com: Mentioned"}
+	if len(sent) != len(want) || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("expected emails %v, got %v", want, sent)
+	}
+}
+
+func TestUserCleanup(t *testing.T) {
+	mod, _ := newTestModule(t)
+	ctx := context.Background()
+	if _, err := mod.Notify(ctx, Input{UserID: "user-1", Title: "Hello"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	actions, err := mod.PlanUserCleanup(ctx, "user-1")
+	if err != nil || len(actions) != 1 {
+		t.Fatalf("expected one cleanup action, got %v, %v", actions, err)
+	}
+	if err := actions[0].Apply(ctx); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if count, _ := mod.UnreadCount(ctx, "user-1"); count != 0 {
+		t.Errorf("expected notifications deleted, got %d", count)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	mod, _ := newTestModule(t)
+	ctx := context.Background()
+	created, err := mod.Notify(ctx, Input{UserID: "user-1", Title: "Hello"})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	handler := mod.Handler()
+	serve := func(method, path, userID string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, nil)
+		if userID != "" {
+			request = request.WithContext(auth.WithSession(request.Context(), &auth.Session{UserID: userID}))
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	if response := serve(http.MethodGet, "/", ""); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a user, got %d", response.Code)
+	}
+
+	response := serve(http.MethodGet, "/?unread=true", "user-1")
+	var page pagination.Result[*Notification]
+	if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil || page.Total != 1 || page.Items[0].ID != created.ID {
+		t.Fatalf("unexpected list response %d: %s", response.Code, response.Body)
+	}
+
+	if response := serve(http.MethodPost, "/"+created.ID+"/read", "user-2"); response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's notification, got %d", response.Code)
+	}
+	if response := serve(http.MethodPost, "/"+created.ID+"/read", "user-1"); response.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", response.Code)
+	}
+	response = serve(http.MethodGet, "/unread-count", "user-1")
+	if response.Code != http.StatusOK || response.Body.String() == "" {
+		t.Fatalf("unexpected unread count response %d", response.Code)
+	}
+	var count map[string]int
+	if err := json.Unmarshal(response.Body.Bytes(), &count); err != nil || count["unread"] != 0 {
+		t.Errorf("expected 0 unread, got %s", response.Body)
+	}
+}
+
+// exportFiles is a chassis.ExportWriter collecting JSON files.
+type exportFiles map[string]*bytes.Buffer
+
+func (files exportFiles) Create(name string) (io.Writer, error) {
+	files[name] = &bytes.Buffer{}
+	return files[name], nil
+}
+
+func (files exportFiles) WriteJSON(name string, value any) error {
+	writer, _ := files.Create(name)
+	return json.NewEncoder(writer).Encode(value)
+}
+
+func TestExportOrg(t *testing.T) {
+	mod, _ := newTestModule(t)
+	ctx := context.Background()
+	mod.Notify(ctx, Input{UserID: "user-1", OrgID: "org-1", Title: "Invoice paid"})
+	mod.Notify(ctx, Input{UserID: "user-2", OrgID: "org-1", Title: "Invoice overdue"})
+	mod.Notify(ctx, Input{UserID: "user-1", OrgID: "org-2", Title: "Elsewhere"})
+
+	files := exportFiles{}
+	if err := mod.ExportOrg(ctx, "org-1", files); err != nil {
+		t.Fatalf("ExportOrg failed: %v", err)
+	}
+	var exported []*Notification
+	json.Unmarshal(files["notifications.json"].Bytes(), &exported)
+	if len(exported) != 2 || exported[0].Title != "Invoice paid" || exported[1].UserID != "user-2" {
+		t.Errorf("expected the org's notifications oldest first, got %s", files["notifications.json"])
+	}
+
+	files = exportFiles{}
+	mod.ExportOrg(ctx, "org-3", files)
+	if got := files["notifications.json"].String(); got != "[]\n" {
+		t.Errorf("expected an empty list, got %q", got)
+	}
+}
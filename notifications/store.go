@@ -0,0 +1,223 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/talosaether/chassis/internal/sqlite"
+)
+
+// Store defines the interface for notification persistence.
+type Store interface {
+	Create(ctx context.Context, notification *Notification) error
+	Get(ctx context.Context, id string) (*Notification, error)
+	List(ctx context.Context, userID string, unreadOnly bool, offset, limit int) ([]*Notification, error)
+	Count(ctx context.Context, userID string, unreadOnly bool) (int, error)
+	MarkRead(ctx context.Context, userID, id string, at time.Time) error
+	MarkAllRead(ctx context.Context, userID string, at time.Time) (int, error)
+	Delete(ctx context.Context, userID, id string) error
+	DeleteByUser(ctx context.Context, userID string) error
+	ListByOrg(ctx context.Context, orgID string) ([]*Notification, error) // oldest first
+	Close() error
+}
+
+// SQLiteStore implements Store using SQLite.
+type SQLiteStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteStore creates a new SQLite-backed notification store.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLiteStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteStoreFromDB creates a notification store on a database the caller
+// owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
+	if err := initNotificationSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func initNotificationSchema(db *sql.DB) error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS notifications (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			title TEXT NOT NULL,
+			body TEXT NOT NULL,
+			link TEXT NOT NULL,
+			read_at DATETIME,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at);
+		CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id, read_at);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+const notificationColumns = `id, user_id, org_id, type, title, body, link, read_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanNotification(row rowScanner) (*Notification, error) {
+	var notification Notification
+	var readAt sql.NullTime
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.OrgID, &notification.Type,
+		&notification.Title, &notification.Body, &notification.Link, &readAt, &notification.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if readAt.Valid {
+		notification.ReadAt = &readAt.Time
+	}
+	return &notification, nil
+}
+
+func (store *SQLiteStore) Create(ctx context.Context, notification *Notification) error {
+	query := `INSERT INTO notifications (` + notificationColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := store.db.ExecContext(ctx, query,
+		notification.ID, notification.UserID, notification.OrgID, notification.Type,
+		notification.Title, notification.Body, notification.Link, notification.ReadAt, notification.CreatedAt)
+	return err
+}
+
+func (store *SQLiteStore) Get(ctx context.Context, id string) (*Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE id = ?`
+	notification, err := scanNotification(store.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotificationNotFound
+		}
+		return nil, err
+	}
+	return notification, nil
+}
+
+// userFilter is the WHERE clause selecting a user's notifications.
+func userFilter(unreadOnly bool) string {
+	if unreadOnly {
+		return `user_id = ? AND read_at IS NULL`
+	}
+	return `user_id = ?`
+}
+
+func (store *SQLiteStore) List(ctx context.Context, userID string, unreadOnly bool, offset, limit int) ([]*Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE ` + userFilter(unreadOnly) +
+		` ORDER BY created_at DESC, id LIMIT ? OFFSET ?`
+	return store.query(ctx, query, userID, limit, offset)
+}
+
+func (store *SQLiteStore) ListByOrg(ctx context.Context, orgID string) ([]*Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE org_id = ? ORDER BY created_at, id`
+	return store.query(ctx, query, orgID)
+}
+
+// query returns the notifications selected by query.
+func (store *SQLiteStore) query(ctx context.Context, query string, args ...any) ([]*Notification, error) {
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var notifications []*Notification
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (store *SQLiteStore) Count(ctx context.Context, userID string, unreadOnly bool) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM notifications WHERE ` + userFilter(unreadOnly)
+	err := store.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (store *SQLiteStore) MarkRead(ctx context.Context, userID, id string, at time.Time) error {
+	query := `UPDATE notifications SET read_at = COALESCE(read_at, ?) WHERE id = ? AND user_id = ?`
+	result, err := store.db.ExecContext(ctx, query, at, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (store *SQLiteStore) MarkAllRead(ctx context.Context, userID string, at time.Time) (int, error) {
+	query := `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	result, err := store.db.ExecContext(ctx, query, at, userID)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), err
+}
+
+func (store *SQLiteStore) Delete(ctx context.Context, userID, id string) error {
+	query := `DELETE FROM notifications WHERE id = ? AND user_id = ?`
+	result, err := store.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (store *SQLiteStore) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM notifications WHERE user_id = ?`, userID)
+	return err
+}
+
+// requireRow returns ErrNotificationNotFound if the statement changed no rows.
+func requireRow(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
@@ -0,0 +1,290 @@
+package ops
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+// Limits of the seconds parameter of CPU profiles and traces.
+const (
+	defaultProfileSeconds = 30
+	defaultTraceSeconds   = 1
+	maxSeconds            = 300
+)
+
+// servePprof serves the profile index, or the profile named by the last
+// path element, so the endpoint works at any path ending in a slash.
+func (mod *Module) servePprof(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		api.MethodNotAllowed(writer, request)
+		return
+	}
+	name := ""
+	if !strings.HasSuffix(request.URL.Path, "/") {
+		name = path.Base(request.URL.Path)
+	}
+	switch name {
+	case "":
+		mod.serveIndex(writer, request)
+	case "profile":
+		mod.serveCPUProfile(writer, request)
+	case "trace":
+		mod.serveTrace(writer, request)
+	case "cmdline":
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprint(writer, strings.Join(os.Args, "\x00"))
+	default:
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			api.Error(writer, request, chassis.CodeNotFound, "unknown profile "+name)
+			return
+		}
+		if name == "heap" && request.URL.Query().Get("gc") == "1" {
+			runtime.GC()
+		}
+		debugLevel, _ := strconv.Atoi(request.URL.Query().Get("debug"))
+		if debugLevel > 0 {
+			writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			writer.Header().Set("Content-Type", "application/octet-stream")
+			writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+		}
+		_ = profile.WriteTo(writer, debugLevel)
+	}
+}
+
+// serveIndex lists the profiles, linking relative to the index so it
+// works wherever it is mounted.
+func (mod *Module) serveIndex(writer http.ResponseWriter, request *http.Request) {
+	profiles := pprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+	token := ""
+	if value := request.URL.Query().Get("token"); value != "" {
+		token = html.EscapeString("&token=" + url.QueryEscape(value))
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var body strings.Builder
+	body.WriteString("<html><head><title>pprof</title></head><body><h1>Profiles</h1><table>\n")
+	for _, profile := range profiles {
+		fmt.Fprintf(&body, "<tr><td>%d</td><td><a href=\"%s?debug=1%s\">%s</a></td></tr>\n", profile.Count(), profile.Name(), token, profile.Name())
+	}
+	fmt.Fprintf(&body, "<tr><td></td><td><a href=\"profile?seconds=%d%s\">profile</a> (CPU)</td></tr>\n", defaultProfileSeconds, token)
+	fmt.Fprintf(&body, "<tr><td></td><td><a href=\"trace?seconds=%d%s\">trace</a></td></tr>\n", defaultTraceSeconds, token)
+	body.WriteString("</table></body></html>\n")
+	_, _ = writer.Write([]byte(body.String()))
+}
+
+// seconds returns the seconds query parameter, or fallback.
+func seconds(request *http.Request, fallback int) (time.Duration, bool) {
+	value := request.URL.Query().Get("seconds")
+	if value == "" {
+		return time.Duration(fallback) * time.Second, true
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed <= 0 || parsed > maxSeconds {
+		return 0, false
+	}
+	return time.Duration(parsed * float64(time.Second)), true
+}
+
+func (mod *Module) serveCPUProfile(writer http.ResponseWriter, request *http.Request) {
+	duration, ok := seconds(request, defaultProfileSeconds)
+	if !ok {
+		api.Error(writer, request, chassis.CodeInvalidArgument, fmt.Sprintf("seconds must be between 0 and %d", maxSeconds))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(writer); err != nil {
+		// Only one CPU profile can run at a time
+		writer.Header().Del("Content-Disposition")
+		api.Error(writer, request, chassis.CodeFailedPrecondition, "could not start CPU profile: "+err.Error())
+		return
+	}
+	waitFor(request, duration)
+	pprof.StopCPUProfile()
+}
+
+func (mod *Module) serveTrace(writer http.ResponseWriter, request *http.Request) {
+	duration, ok := seconds(request, defaultTraceSeconds)
+	if !ok {
+		api.Error(writer, request, chassis.CodeInvalidArgument, fmt.Sprintf("seconds must be between 0 and %d", maxSeconds))
+		return
+	}
+	writer.Header().Set("Content-Type", "application/octet-stream")
+	writer.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(writer); err != nil {
+		writer.Header().Del("Content-Disposition")
+		api.Error(writer, request, chassis.CodeFailedPrecondition, "could not start trace: "+err.Error())
+		return
+	}
+	waitFor(request, duration)
+	trace.Stop()
+}
+
+// waitFor waits for the duration, or until the client goes away.
+func waitFor(request *http.Request, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-request.Context().Done():
+	}
+}
+
+// serveGoroutines dumps every goroutine's stack as text.
+func (mod *Module) serveGoroutines(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		api.MethodNotAllowed(writer, request)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = pprof.Lookup("goroutine").WriteTo(writer, 2)
+}
+
+// GCStats are the memory and GC statistics served at /debug/gc.
+type GCStats struct {
+	Goroutines    int             `json:"goroutines"`
+	HeapAlloc     uint64          `json:"heap_alloc_bytes"`
+	HeapInuse     uint64          `json:"heap_inuse_bytes"`
+	HeapObjects   uint64          `json:"heap_objects"`
+	TotalAlloc    uint64          `json:"total_alloc_bytes"`
+	Sys           uint64          `json:"sys_bytes"`
+	NextGC        uint64          `json:"next_gc_bytes"`
+	NumGC         uint32          `json:"num_gc"`
+	LastGC        *time.Time      `json:"last_gc,omitempty"`
+	PauseTotal    time.Duration   `json:"pause_total_ns"`
+	RecentPauses  []time.Duration `json:"recent_pauses_ns"` // newest first
+	GCCPUFraction float64         `json:"gc_cpu_fraction"`
+	GOGC          int             `json:"gogc"` // 0 when off
+	MemoryLimit   int64           `json:"memory_limit_bytes"`
+}
+
+// recentPauses is how many GC pauses GCStats lists.
+const recentPauses = 10
+
+// ReadGCStats returns the current memory and GC statistics.
+func ReadGCStats() *GCStats {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+
+	settings := []metrics.Sample{{Name: "/gc/gogc:percent"}, {Name: "/gc/gomemlimit:bytes"}}
+	metrics.Read(settings)
+	stats := &GCStats{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     memory.HeapAlloc,
+		HeapInuse:     memory.HeapInuse,
+		HeapObjects:   memory.HeapObjects,
+		TotalAlloc:    memory.TotalAlloc,
+		Sys:           memory.Sys,
+		NextGC:        memory.NextGC,
+		NumGC:         memory.NumGC,
+		PauseTotal:    gc.PauseTotal,
+		RecentPauses:  gc.Pause[:min(len(gc.Pause), recentPauses)],
+		GCCPUFraction: memory.GCCPUFraction,
+		GOGC:          int(settings[0].Value.Uint64()),
+		MemoryLimit:   int64(settings[1].Value.Uint64()),
+	}
+	if !gc.LastGC.IsZero() {
+		stats.LastGC = &gc.LastGC
+	}
+	return stats
+}
+
+func (mod *Module) serveGC(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		api.MethodNotAllowed(writer, request)
+		return
+	}
+	api.WriteJSON(writer, http.StatusOK, ReadGCStats())
+}
+
+// BuildInfo is the build and version information served at /debug/build.
+type BuildInfo struct {
+	GoVersion  string            `json:"go_version"`
+	Path       string            `json:"path"`    // main package
+	Version    string            `json:"version"` // of the main module
+	Revision   string            `json:"vcs_revision,omitempty"`
+	RevisionAt string            `json:"vcs_time,omitempty"`
+	Modified   bool              `json:"vcs_modified"`
+	Env        string            `json:"env"`
+	StartedAt  time.Time         `json:"started_at"`
+	Uptime     string            `json:"uptime"`
+	GOOS       string            `json:"goos"`
+	GOARCH     string            `json:"goarch"`
+	NumCPU     int               `json:"num_cpu"`
+	GOMAXPROCS int               `json:"gomaxprocs"`
+	Modules    map[string]string `json:"modules"` // dependency versions
+	Settings   map[string]string `json:"settings"`
+	Registered []string          `json:"chassis_modules"` // names of the registered modules
+}
+
+// BuildInfo returns the build and version information of the running
+// binary.
+func (mod *Module) BuildInfo() *BuildInfo {
+	info := &BuildInfo{
+		GoVersion:  runtime.Version(),
+		StartedAt:  mod.startedAt,
+		Uptime:     time.Since(mod.startedAt).Round(time.Second).String(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Modules:    map[string]string{},
+		Settings:   map[string]string{},
+	}
+	if mod.app != nil {
+		info.Env = mod.app.Config().Env
+		for _, registered := range mod.app.Modules() {
+			info.Registered = append(info.Registered, registered.Name())
+		}
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path, info.Version = build.Path, build.Main.Version
+	for _, dep := range build.Deps {
+		info.Modules[dep.Path] = dep.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionAt = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		default:
+			info.Settings[setting.Key] = setting.Value
+		}
+	}
+	return info
+}
+
+func (mod *Module) serveBuild(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		api.MethodNotAllowed(writer, request)
+		return
+	}
+	api.WriteJSON(writer, http.StatusOK, mod.BuildInfo())
+}
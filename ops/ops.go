@@ -0,0 +1,246 @@
+// Package ops provides runtime debugging endpoints for the chassis
+// framework: pprof profiles, goroutine dumps, GC statistics and build
+// information, for diagnosing production performance issues without
+// redeploying.
+//
+// # Usage
+//
+// Register the module with a token, or an admin address only reachable
+// from inside the network:
+//
+//	app := chassis.New(
+//	    chassis.WithModules(
+//	        ops.New(ops.WithToken(os.Getenv("OPS_TOKEN"))),
+//	    ),
+//	)
+//
+// With a token the endpoints are mounted by api.Mount, and every request
+// must carry it as "Authorization: Bearer <token>" or a token query
+// parameter, which go tool pprof can send:
+//
+//	go tool pprof "https://app.example.com/debug/pprof/profile?seconds=30&token=$OPS_TOKEN"
+//
+// With an admin address, app.Run serves them on that address instead,
+// apart from the application's routes; a token, if also set, is still
+// required there:
+//
+//	ops.New(ops.WithAdminAddr("127.0.0.1:6060"))
+//
+// Without either, the endpoints aren't served at all.
+//
+// # Endpoints
+//
+//	/debug/pprof/        profile index, with heap, allocs, goroutine, block, mutex, threadcreate
+//	/debug/pprof/profile CPU profile (seconds, default 30)
+//	/debug/pprof/trace   execution trace (seconds, default 1)
+//	/debug/goroutines    stack dump of every goroutine, as text
+//	/debug/gc            memory and GC statistics, as JSON
+//	/debug/build         Go version, module versions and VCS revision, as JSON
+//
+// The package doesn't import net/http/pprof, which would register its
+// handlers on http.DefaultServeMux unguarded.
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	ops:
+//	  token: ${OPS_TOKEN}
+//	  addr: 127.0.0.1:6060  # admin address, optional
+package ops
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+// Module is the ops module implementation.
+type Module struct {
+	app       *chassis.App
+	token     string
+	addr      string
+	startedAt time.Time
+
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+}
+
+// Option is a function that configures the ops module.
+type Option func(*Module)
+
+// WithToken requires the token on every request, and mounts the endpoints
+// on the application's mux with api.Mount.
+func WithToken(token string) Option {
+	return func(mod *Module) {
+		mod.token = token
+	}
+}
+
+// WithAdminAddr serves the endpoints on their own address while the app
+// runs, instead of on the application's mux.
+func WithAdminAddr(addr string) Option {
+	return func(mod *Module) {
+		mod.addr = addr
+	}
+}
+
+// New creates a new ops module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{startedAt: time.Now()}
+	for _, opt := range opts {
+		opt(mod)
+	}
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "ops"
+}
+
+// Init reads the ops config section.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+	if cfg := app.ConfigData(); cfg != nil {
+		if token := cfg.GetString("ops.token"); token != "" {
+			mod.token = token
+		}
+		if addr := cfg.GetString("ops.addr"); addr != "" {
+			mod.addr = addr
+		}
+	}
+	if mod.token == "" && mod.addr == "" {
+		app.Logger().Warn("ops endpoints disabled: set ops.token or ops.addr")
+	}
+	return nil
+}
+
+// Shutdown stops the admin server, waiting for in-flight requests until
+// ctx is done.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	mod.mu.Lock()
+	server := mod.server
+	mod.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// Start serves the endpoints on the admin address until ctx is cancelled.
+// Without one it just waits. Implements chassis.Service.
+func (mod *Module) Start(ctx context.Context) error {
+	if mod.addr == "" {
+		<-ctx.Done()
+		return nil
+	}
+	listener, err := net.Listen("tcp", mod.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", mod.addr, err)
+	}
+	mux := http.NewServeMux()
+	for _, endpoint := range mod.endpoints() {
+		mux.Handle(endpoint.Path, endpoint.Handler)
+	}
+	admin := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), adminServerKey{}, true)))
+	})
+	server := &http.Server{Handler: mod.app.Middleware(admin), ReadHeaderTimeout: 10 * time.Second}
+	mod.mu.Lock()
+	mod.server, mod.listener = server, listener
+	mod.mu.Unlock()
+	mod.app.Logger().Info("ops server listening", "addr", listener.Addr().String())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		// Shutdown drains the connections within the app's shutdown timeout
+		return nil
+	}
+}
+
+// Addr returns the address the admin server listens on once started, e.g.
+// to find the port chosen for ":0".
+func (mod *Module) Addr() string {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	if mod.listener == nil {
+		return ""
+	}
+	return mod.listener.Addr().String()
+}
+
+// Endpoints mounts the debug endpoints when a token is set and no admin
+// address is. Implements chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	endpoints := mod.endpoints()
+	for i := range endpoints {
+		endpoints[i].Enabled = mod.token != "" && mod.addr == ""
+	}
+	return endpoints
+}
+
+func (mod *Module) endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{
+		{Name: "pprof", Path: "/debug/pprof/", Handler: mod.guard(http.HandlerFunc(mod.servePprof))},
+		{Name: "debug_goroutines", Path: "/debug/goroutines", Handler: mod.guard(http.HandlerFunc(mod.serveGoroutines))},
+		{Name: "debug_gc", Path: "/debug/gc", Handler: mod.guard(http.HandlerFunc(mod.serveGC))},
+		{Name: "debug_build", Path: "/debug/build", Handler: mod.guard(http.HandlerFunc(mod.serveBuild))},
+	}
+}
+
+// guard rejects requests without the token. Without a token only the
+// admin server serves them, and anything else mounting the handlers gets
+// refused.
+func (mod *Module) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if mod.token == "" {
+			if !mod.onAdminServer(request) {
+				api.Error(writer, request, chassis.CodePermissionDenied, "ops endpoints need ops.token or the admin address")
+				return
+			}
+		} else if !mod.authorized(request) {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="ops"`)
+			api.Error(writer, request, chassis.CodeUnauthenticated, "ops token required")
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// authorized reports whether the request carries the token.
+func (mod *Module) authorized(request *http.Request) bool {
+	token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = request.URL.Query().Get("token")
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(mod.token)) == 1
+}
+
+// adminServerKey marks the context of requests to the admin server.
+type adminServerKey struct{}
+
+// onAdminServer reports whether the request came in on the admin address.
+func (mod *Module) onAdminServer(request *http.Request) bool {
+	admin, _ := request.Context().Value(adminServerKey{}).(bool)
+	return admin
+}
@@ -0,0 +1,130 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+func TestModule_Name(t *testing.T) {
+	if name := New().Name(); name != "ops" {
+		t.Errorf("expected ops, got %s", name)
+	}
+}
+
+func TestToken(t *testing.T) {
+	app := chassis.New(chassis.WithModules(New(WithToken("s3cret"))))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	mux := http.NewServeMux()
+	api.Mount(app, mux)
+
+	get := func(target string, header ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		if len(header) > 0 {
+			request.Header.Set("Authorization", header[0])
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := get("/debug/build"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the token, got %d", recorder.Code)
+	}
+	if recorder := get("/debug/build", "Bearer wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", recorder.Code)
+	}
+
+	recorder := get("/debug/build", "Bearer s3cret")
+	var info BuildInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil || recorder.Code != http.StatusOK || !strings.HasPrefix(info.GoVersion, "go") {
+		t.Errorf("expected build info, got %d %s", recorder.Code, recorder.Body)
+	}
+	if len(info.Registered) != 1 || info.Registered[0] != "ops" {
+		t.Errorf("expected the registered modules, got %v", info.Registered)
+	}
+
+	recorder = get("/debug/gc?token=s3cret")
+	var stats GCStats
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil || stats.Goroutines == 0 || stats.HeapAlloc == 0 {
+		t.Errorf("expected GC stats, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	if recorder := get("/debug/goroutines?token=s3cret"); !strings.Contains(recorder.Body.String(), "goroutine ") {
+		t.Errorf("expected a goroutine dump, got %s", recorder.Body)
+	}
+	if recorder := get("/debug/pprof/?token=s3cret"); !strings.Contains(recorder.Body.String(), `href="heap?debug=1&amp;token=s3cret"`) {
+		t.Errorf("expected the profile index, got %s", recorder.Body)
+	}
+	if recorder := get("/debug/pprof/heap?debug=1", "Bearer s3cret"); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "heap profile") {
+		t.Errorf("expected the heap profile, got %d", recorder.Code)
+	}
+	if recorder := get("/debug/pprof/profile?seconds=0.05", "Bearer s3cret"); recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+		t.Errorf("expected a CPU profile, got %d", recorder.Code)
+	}
+	if recorder := get("/debug/pprof/profile?seconds=3600", "Bearer s3cret"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a long profile, got %d", recorder.Code)
+	}
+	if recorder := get("/debug/pprof/nope", "Bearer s3cret"); recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown profile, got %d", recorder.Code)
+	}
+}
+
+func TestDisabledWithoutTokenOrAddr(t *testing.T) {
+	mod := New()
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	mux := http.NewServeMux()
+	api.Mount(app, mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/build", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected the endpoints not to be mounted, got %d", recorder.Code)
+	}
+
+	// Mounted anyway, they refuse
+	recorder = httptest.NewRecorder()
+	mod.endpoints()[3].Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/build", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", recorder.Code)
+	}
+}
+
+func TestAdminAddr(t *testing.T) {
+	mod := New(WithAdminAddr("127.0.0.1:0"))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	mux := http.NewServeMux()
+	if mounted := api.Mount(app, mux); len(mounted) != 1 {
+		t.Errorf("expected only the health endpoint on the app's mux, got %d", len(mounted))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = mod.Start(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for mod.Addr() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the admin server to listen")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	response, err := http.Get("http://" + mod.Addr() + "/debug/build")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected the admin server to serve without a token, got %d", response.StatusCode)
+	}
+}
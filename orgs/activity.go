@@ -0,0 +1,241 @@
+package orgs
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// Activity types recorded by the module. Applications record their own
+// with RecordActivity.
+const (
+	ActivityOrgCreated           = "org_created"
+	ActivitySettingsUpdated      = "settings_updated"      // details: name
+	ActivityMemberInvited        = "member_invited"        // details: email, role
+	ActivityMemberJoined         = "member_joined"         // details: role
+	ActivityMemberRemoved        = "member_removed"        // details: role
+	ActivityRoleChanged          = "role_changed"          // details: role, previous_role
+	ActivityOwnershipTransferred = "ownership_transferred" // user is the new owner; details: from_user_id
+	ActivityFileUploaded         = "file_uploaded"         // details: key, name, size
+	ActivityChildCreated         = "child_created"         // details: org_id, name
+)
+
+// storageFileUploaded is storage.EventFileUploaded, which orgs can't
+// import.
+const storageFileUploaded = "storage.file_uploaded"
+
+// Activity is an entry of an organization's activity feed.
+type Activity struct {
+	ID        string
+	OrgID     string
+	Type      string
+	ActorID   string            // user who acted, empty for the system
+	UserID    string            // member the activity concerns, if any
+	Details   map[string]string // per type, see the Activity constants
+	CreatedAt time.Time
+
+	// Resolved by Activity when the users module is registered
+	Actor *ActivityUser
+	User  *ActivityUser
+}
+
+// ActivityUser is a user named in the activity feed.
+type ActivityUser struct {
+	ID    string
+	Email string
+	Name  string
+}
+
+// ActivityStore persists activity. SQLiteStore implements it; with other
+// stores activity is kept in memory.
+type ActivityStore interface {
+	RecordActivity(ctx context.Context, activity *Activity) error
+	ListActivity(ctx context.Context, orgID string, offset, limit int) ([]*Activity, error) // newest first
+	CountActivity(ctx context.Context, orgID string) (int, error)
+	DeleteActivityByOrgID(ctx context.Context, orgID string) error
+}
+
+// MemoryActivityStore keeps activity in process memory.
+type MemoryActivityStore struct {
+	mu       sync.Mutex
+	activity map[string][]Activity // by org, oldest first
+}
+
+// NewMemoryActivityStore creates an in-memory activity store.
+func NewMemoryActivityStore() *MemoryActivityStore {
+	return &MemoryActivityStore{activity: make(map[string][]Activity)}
+}
+
+func (store *MemoryActivityStore) RecordActivity(ctx context.Context, activity *Activity) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.activity[activity.OrgID] = append(store.activity[activity.OrgID], *activity)
+	return nil
+}
+
+func (store *MemoryActivityStore) ListActivity(ctx context.Context, orgID string, offset, limit int) ([]*Activity, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entries := store.activity[orgID]
+	page := make([]*Activity, 0, limit)
+	for i := len(entries) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		entry := entries[i]
+		page = append(page, &entry)
+	}
+	return page, nil
+}
+
+func (store *MemoryActivityStore) CountActivity(ctx context.Context, orgID string) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.activity[orgID]), nil
+}
+
+func (store *MemoryActivityStore) DeleteActivityByOrgID(ctx context.Context, orgID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.activity, orgID)
+	return nil
+}
+
+// activityStore returns the store Init picked, picking it for a module
+// used without Init.
+func (mod *Module) activityStore() ActivityStore {
+	if mod.activity == nil {
+		if activity, ok := mod.store.(ActivityStore); ok {
+			mod.activity = activity
+		} else {
+			mod.activity = NewMemoryActivityStore()
+		}
+	}
+	return mod.activity
+}
+
+// sessionUser is implemented by the auth module.
+type sessionUser interface {
+	SessionUserID(ctx context.Context) string
+}
+
+// RecordActivity adds an entry to the organization's activity feed. The ID
+// and time are filled in if empty, and the actor is the user of the
+// session in ctx unless set.
+func (mod *Module) RecordActivity(ctx context.Context, activity *Activity) error {
+	if activity.ID == "" {
+		activity.ID = uuid.New().String()
+	}
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+	if activity.ActorID == "" {
+		if authMod, ok := mod.app.TryAuth(); ok {
+			if sessions, ok := authMod.(sessionUser); ok {
+				activity.ActorID = sessions.SessionUserID(ctx)
+			}
+		}
+	}
+	return mod.activityStore().RecordActivity(ctx, activity)
+}
+
+// recordActivity records activity of the module's own operations. Failing
+// to record doesn't fail the operation.
+func (mod *Module) recordActivity(ctx context.Context, orgID, activityType, userID string, details map[string]string) {
+	activity := &Activity{OrgID: orgID, Type: activityType, UserID: userID, Details: details}
+	if err := mod.RecordActivity(ctx, activity); err != nil {
+		mod.logger().Error("failed to record org activity", "org_id", orgID, "type", activityType, "error", err)
+	}
+}
+
+// recordUpload records the storage module's uploads to organizations.
+func (mod *Module) recordUpload(ctx context.Context, eventType string, payload any) error {
+	// Decoded by its JSON form, like a bridged event
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var upload struct {
+		Key        string `json:"key"`
+		Name       string `json:"name"`
+		Size       int64  `json:"size"`
+		UploadedBy string `json:"uploaded_by"`
+		OrgID      string `json:"org_id"`
+	}
+	if err := json.Unmarshal(data, &upload); err != nil || upload.OrgID == "" {
+		return nil
+	}
+	return mod.RecordActivity(ctx, &Activity{
+		OrgID:   upload.OrgID,
+		Type:    ActivityFileUploaded,
+		ActorID: upload.UploadedBy,
+		Details: map[string]string{"key": upload.Key, "name": upload.Name, "size": strconv.FormatInt(upload.Size, 10)},
+	})
+}
+
+// Activity returns a page of the organization's activity feed, newest
+// first, for an "Activity" tab. With the users module registered, the
+// actor and member of each entry are resolved to their email and name:
+//
+//	page, err := orgsMod.Activity(ctx, orgID, pagination.Request{Limit: 20})
+//	for _, entry := range page.Items {
+//	    fmt.Println(entry.CreatedAt, entry.Actor, entry.Type, entry.User)
+//	}
+func (mod *Module) Activity(ctx context.Context, orgID string, req pagination.Request) (*pagination.Result[*Activity], error) {
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+	result, err := db.Paginate(ctx, req,
+		func(ctx context.Context, offset, limit int) ([]*Activity, error) {
+			return mod.activityStore().ListActivity(ctx, orgID, offset, limit)
+		},
+		func(ctx context.Context) (int, error) { return mod.activityStore().CountActivity(ctx, orgID) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	mod.resolveActivityUsers(ctx, result.Items)
+	return result, nil
+}
+
+// activityUser is implemented by users module users.
+type activityUser interface {
+	GetEmail() string
+	GetName() string
+}
+
+// resolveActivityUsers fills in Actor and User, looking each user up once.
+// Deleted users keep just their ID.
+func (mod *Module) resolveActivityUsers(ctx context.Context, entries []*Activity) {
+	usersMod, ok := mod.app.TryUsers()
+	if !ok {
+		return
+	}
+	resolved := make(map[string]*ActivityUser)
+	resolve := func(userID string) *ActivityUser {
+		if userID == "" {
+			return nil
+		}
+		if user, seen := resolved[userID]; seen {
+			return user
+		}
+		user := &ActivityUser{ID: userID}
+		if result, err := usersMod.GetByID(ctx, userID); err == nil {
+			if found, ok := result.(activityUser); ok {
+				user.Email, user.Name = found.GetEmail(), found.GetName()
+			}
+		} else if chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+			mod.logger().Warn("failed to resolve activity user", "user_id", userID, "error", err)
+		}
+		resolved[userID] = user
+		return user
+	}
+	for _, entry := range entries {
+		entry.Actor = resolve(entry.ActorID)
+		entry.User = resolve(entry.UserID)
+	}
+}
@@ -0,0 +1,80 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/talosaether/chassis"
+)
+
+// membershipLister is implemented by stores that can list every membership.
+// The SQLite store implements it; custom stores without it are not checked.
+type membershipLister interface {
+	ListMemberships(ctx context.Context) ([]*Membership, error)
+}
+
+// Check finds memberships that point at a missing organization, or at a
+// missing user when the users module is registered. Implements chassis.Checker.
+func (mod *Module) Check(ctx context.Context) ([]chassis.Issue, error) {
+	lister, ok := mod.store.(membershipLister)
+	if !ok {
+		return nil, nil
+	}
+	memberships, err := lister.ListMemberships(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	usersMod, checkUsers := mod.app.TryUsers()
+	orgExists := make(map[string]bool)
+	userExists := make(map[string]bool)
+
+	var issues []chassis.Issue
+	for _, membership := range memberships {
+		exists, seen := orgExists[membership.OrgID]
+		if !seen {
+			_, err := mod.store.GetByID(ctx, membership.OrgID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			exists = err == nil
+			orgExists[membership.OrgID] = exists
+		}
+		if !exists {
+			issues = append(issues, mod.orphanedMembership(membership, "organization "+membership.OrgID+" does not exist"))
+			continue
+		}
+
+		if !checkUsers {
+			continue
+		}
+		exists, seen = userExists[membership.UserID]
+		if !seen {
+			_, err := usersMod.GetByID(ctx, membership.UserID)
+			if err != nil && chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+				return nil, err
+			}
+			exists = err == nil
+			userExists[membership.UserID] = exists
+		}
+		if !exists {
+			issues = append(issues, mod.orphanedMembership(membership, "user "+membership.UserID+" does not exist"))
+		}
+	}
+	return issues, nil
+}
+
+func (mod *Module) orphanedMembership(membership *Membership, reason string) chassis.Issue {
+	orgID, userID := membership.OrgID, membership.UserID
+	return chassis.Issue{
+		Module:   mod.Name(),
+		Kind:     "orphaned_membership",
+		Resource: membership.ID,
+		Message:  fmt.Sprintf("membership %s: %s", membership.ID, reason),
+		Repair:   fmt.Sprintf("delete membership of user %s in org %s", userID, orgID),
+		Fix: func(ctx context.Context) error {
+			return mod.store.DeleteMembership(ctx, orgID, userID)
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package orgs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// SoleOwnerPolicy decides what happens to organizations whose only owner
+// is deleted.
+type SoleOwnerPolicy string
+
+const (
+	// SoleOwnerReassign promotes the longest-standing admin, or failing
+	// that the longest-standing member, to owner. Organizations with no
+	// other members are deleted.
+	SoleOwnerReassign SoleOwnerPolicy = "reassign"
+	// SoleOwnerDelete deletes the organization.
+	SoleOwnerDelete SoleOwnerPolicy = "delete"
+	// SoleOwnerBlock refuses to delete the user (ErrLastOwner) until
+	// ownership is transferred.
+	SoleOwnerBlock SoleOwnerPolicy = "block"
+)
+
+// WithSoleOwnerPolicy sets what happens to organizations whose only owner
+// is deleted. The default is SoleOwnerReassign.
+func WithSoleOwnerPolicy(policy SoleOwnerPolicy) Option {
+	return func(mod *Module) {
+		mod.soleOwnerPolicy = policy
+	}
+}
+
+// emailer is implemented by users module users.
+type emailer interface {
+	GetEmail() string
+}
+
+// PlanUserCleanup plans removing a user's memberships, with their teams,
+// and pending invitations to their email, and handling organizations they
+// solely own per the SoleOwnerPolicy. Implements chassis.UserCleaner.
+func (mod *Module) PlanUserCleanup(ctx context.Context, userID string) ([]chassis.CleanupAction, error) {
+	memberships, err := mod.store.GetMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	var actions []chassis.CleanupAction
+	for _, membership := range memberships {
+		orgID := membership.OrgID
+		if membership.Role == "owner" {
+			owners, err := mod.store.CountMembersWithRole(ctx, orgID, "owner")
+			if err != nil {
+				return nil, fmt.Errorf("failed to count owners: %w", err)
+			}
+			if owners <= 1 {
+				action, err := mod.planSoleOwner(ctx, orgID, userID)
+				if err != nil {
+					return nil, err
+				}
+				actions = append(actions, action)
+				continue
+			}
+		}
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "membership",
+			Resource:    membership.ID,
+			Description: fmt.Sprintf("remove user %s from organization %s", userID, orgID),
+			Apply: func(ctx context.Context) error {
+				return mod.RemoveMember(ctx, orgID, userID)
+			},
+		})
+	}
+
+	invitations, err := mod.invitationsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, invitation := range invitations {
+		invitationID, orgID := invitation.ID, invitation.OrgID
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "invitation",
+			Resource:    invitationID,
+			Description: fmt.Sprintf("revoke invitation of %s to organization %s", invitation.Email, orgID),
+			Apply: func(ctx context.Context) error {
+				return mod.RevokeInvitation(ctx, orgID, invitationID)
+			},
+		})
+	}
+	return actions, nil
+}
+
+// planSoleOwner plans what happens to an organization userID solely owns.
+// One deleted this way is purged at once, with no grace period, since it
+// could only come back without an owner.
+func (mod *Module) planSoleOwner(ctx context.Context, orgID, userID string) (chassis.CleanupAction, error) {
+	org, err := mod.store.GetByID(ctx, orgID)
+	if err != nil {
+		return chassis.CleanupAction{}, err
+	}
+	deleteOrg := chassis.CleanupAction{
+		Module:      mod.Name(),
+		Kind:        "org",
+		Resource:    orgID,
+		Description: fmt.Sprintf("delete organization %s, solely owned by user %s", orgID, userID),
+		Apply: func(ctx context.Context) error {
+			return mod.purge(ctx, org)
+		},
+	}
+	if org.DeletedAt != nil {
+		// Already on its way out
+		return deleteOrg, nil
+	}
+
+	if mod.soleOwnerPolicy == SoleOwnerBlock {
+		return chassis.CleanupAction{}, fmt.Errorf("user %s solely owns organization %s: %w", userID, orgID, ErrLastOwner)
+	}
+	if mod.soleOwnerPolicy == SoleOwnerDelete {
+		return deleteOrg, nil
+	}
+
+	successor, err := mod.successor(ctx, orgID, userID)
+	if err != nil {
+		return chassis.CleanupAction{}, err
+	}
+	if successor == "" {
+		return deleteOrg, nil
+	}
+	return chassis.CleanupAction{
+		Module:      mod.Name(),
+		Kind:        "ownership",
+		Resource:    orgID,
+		Description: fmt.Sprintf("transfer ownership of organization %s from user %s to %s and remove %s", orgID, userID, successor, userID),
+		Apply: func(ctx context.Context) error {
+			if err := mod.TransferOwnership(ctx, orgID, userID, successor); err != nil {
+				return err
+			}
+			return mod.RemoveMember(ctx, orgID, userID)
+		},
+	}, nil
+}
+
+// successor returns the member to take over an organization from userID:
+// the longest-standing admin, else the longest-standing member, or "" if
+// there is no one else.
+func (mod *Module) successor(ctx context.Context, orgID, userID string) (string, error) {
+	members, err := mod.store.GetMembersByOrgID(ctx, orgID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list members: %w", err)
+	}
+	members = activeMemberships(members, time.Now())
+	sort.SliceStable(members, func(i, j int) bool {
+		if (members[i].Role == "admin") != (members[j].Role == "admin") {
+			return members[i].Role == "admin"
+		}
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+	for _, member := range members {
+		if member.UserID != userID {
+			return member.UserID, nil
+		}
+	}
+	return "", nil
+}
+
+// invitationsForUser returns the pending invitations to the user's email,
+// when the users module is registered.
+func (mod *Module) invitationsForUser(ctx context.Context, userID string) ([]*Invitation, error) {
+	usersMod, ok := mod.app.TryUsers()
+	if !ok {
+		return nil, nil
+	}
+	user, err := usersMod.GetByID(ctx, userID)
+	if err != nil {
+		if chassis.ErrorCodeOf(err) == chassis.CodeNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	withEmail, ok := user.(emailer)
+	if !ok {
+		return nil, nil
+	}
+	invitations, err := mod.store.ListInvitationsByEmail(ctx, strings.ToLower(withEmail.GetEmail()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
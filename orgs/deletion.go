@@ -0,0 +1,249 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// DefaultDeletionGracePeriod is how long a deleted organization can be
+// brought back with Undelete before Start purges it, unless
+// WithDeletionGracePeriod or orgs.deletion_grace_period says otherwise.
+const DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+var ErrNotDeleted = chassis.NewError(chassis.CodeFailedPrecondition, "organization is not scheduled for deletion")
+
+// Deletion events published when the events module is registered.
+const (
+	EventDeletionScheduled = "org.deletion_scheduled" // payload: *DeletionEvent
+	EventOrgRestored       = "org.restored"           // payload: *DeletionEvent
+	EventOrgPurged         = "org.purged"             // payload: *DeletionEvent
+)
+
+// Activity recorded while an organization is scheduled for deletion. Its
+// feed is purged with it.
+const (
+	ActivityDeletionScheduled = "deletion_scheduled" // details: purge_at
+	ActivityOrgRestored       = "org_restored"
+)
+
+// DeletionEvent is the payload of deletion events. MemberIDs are the
+// users losing access, so EventDeletionScheduled subscribers can warn them
+// before their data is gone.
+type DeletionEvent struct {
+	OrgID     string
+	Name      string
+	PurgeAt   time.Time
+	MemberIDs []string
+}
+
+// WithDeletionGracePeriod sets how long a deleted organization can be
+// brought back before it is purged. Zero purges it at once.
+func WithDeletionGracePeriod(grace time.Duration) Option {
+	return func(mod *Module) {
+		mod.deletionGrace = grace
+	}
+}
+
+// getOrg returns an organization, or ErrNotFound if it doesn't exist or
+// is scheduled for deletion.
+func (mod *Module) getOrg(ctx context.Context, orgID string) (*Org, error) {
+	org, err := mod.store.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return org, nil
+}
+
+// Exists reports whether an organization exists, counting one scheduled
+// for deletion, which Undelete can still bring back.
+func (mod *Module) Exists(ctx context.Context, orgID string) (bool, error) {
+	_, err := mod.store.GetByID(ctx, orgID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// liveChildren returns the children of parentID not scheduled for
+// deletion, by name.
+func (mod *Module) liveChildren(ctx context.Context, parentID string) ([]*Org, error) {
+	children, err := mod.store.ListChildren(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	live := make([]*Org, 0, len(children))
+	for _, child := range children {
+		if child.DeletedAt == nil {
+			live = append(live, child)
+		}
+	}
+	return live, nil
+}
+
+// liveMemberships returns the memberships of organizations not scheduled
+// for deletion.
+func (mod *Module) liveMemberships(ctx context.Context, memberships []*Membership) []*Membership {
+	live := make([]*Membership, 0, len(memberships))
+	for _, membership := range memberships {
+		if _, err := mod.getOrg(ctx, membership.OrgID); err == nil {
+			live = append(live, membership)
+		}
+	}
+	return live
+}
+
+// Delete schedules an organization's deletion. It is hidden at once, as if
+// deleted, and purged once the deletion grace period is over: its
+// memberships, invitations, teams and activity, and its data in every
+// module implementing chassis.OrgPurger, such as storage objects, queue
+// jobs and notifications. Until then Undelete brings it back, and
+// EventDeletionScheduled lets its members know. With no grace period it is
+// purged at once. An organization with children fails with
+// ErrHasChildren; delete them first.
+func (mod *Module) Delete(ctx context.Context, orgID string) error {
+	org, err := mod.getOrg(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	children, err := mod.liveChildren(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to check child organizations: %w", err)
+	}
+	if len(children) > 0 {
+		return ErrHasChildren
+	}
+	if mod.deletionGrace <= 0 {
+		return mod.purge(ctx, org)
+	}
+
+	now := time.Now()
+	org.DeletedAt, org.UpdatedAt = &now, now
+	if err := mod.store.Update(ctx, org); err != nil {
+		return fmt.Errorf("failed to schedule organization deletion: %w", err)
+	}
+
+	event := mod.deletionEvent(ctx, org)
+	mod.recordActivity(ctx, orgID, ActivityDeletionScheduled, "", map[string]string{"purge_at": event.PurgeAt.UTC().Format(time.RFC3339)})
+	mod.app.PublishEvent(ctx, EventDeletionScheduled, event)
+	return nil
+}
+
+// Undelete brings back an organization scheduled for deletion, with its
+// members and data as they were, failing with ErrNotDeleted if it isn't
+// scheduled. A child can't be brought back while its parent is still
+// scheduled for deletion; undelete the parent first. (Restore, by
+// contrast, restores a snapshot.)
+func (mod *Module) Undelete(ctx context.Context, orgID string) error {
+	org, err := mod.store.GetByID(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if org.DeletedAt == nil {
+		return ErrNotDeleted
+	}
+	if org.ParentID != "" {
+		if _, err := mod.getOrg(ctx, org.ParentID); err != nil {
+			return fmt.Errorf("failed to check parent organization: %w", err)
+		}
+	}
+
+	event := mod.deletionEvent(ctx, org)
+	org.DeletedAt, org.UpdatedAt = nil, time.Now()
+	if err := mod.store.Update(ctx, org); err != nil {
+		return fmt.Errorf("failed to restore organization: %w", err)
+	}
+
+	mod.recordActivity(ctx, orgID, ActivityOrgRestored, "", nil)
+	mod.app.PublishEvent(ctx, EventOrgRestored, event)
+	return nil
+}
+
+// PurgeDeleted purges the organizations whose deletion grace period is
+// over and returns how many it purged. Start calls it every sweep
+// interval; an organization that fails to purge is retried on the next.
+func (mod *Module) PurgeDeleted(ctx context.Context) (int, error) {
+	due, err := mod.store.ListDeletedOrgs(ctx, time.Now().Add(-max(mod.deletionGrace, 0)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deleted organizations: %w", err)
+	}
+	purged := 0
+	for _, org := range due {
+		if err := mod.purge(ctx, org); err != nil {
+			mod.logger().Error("failed to purge deleted organization", "org_id", org.id, "error", err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purge removes an organization and everything kept about it. Other
+// modules' data goes first, so an organization whose purge fails is still
+// there to retry. Children are purged before their parent, having been
+// deleted first.
+func (mod *Module) purge(ctx context.Context, org *Org) error {
+	children, err := mod.store.ListChildren(ctx, org.id)
+	if err != nil {
+		return fmt.Errorf("failed to check child organizations: %w", err)
+	}
+	if len(children) > 0 {
+		return ErrHasChildren
+	}
+
+	event := mod.deletionEvent(ctx, org)
+	if mod.app != nil {
+		for _, module := range mod.app.Modules() {
+			purger, ok := module.(chassis.OrgPurger)
+			if !ok {
+				continue
+			}
+			if err := purger.PurgeOrg(ctx, org.id); err != nil {
+				return fmt.Errorf("failed to purge module %q: %w", module.Name(), err)
+			}
+		}
+	}
+
+	if err := mod.store.DeleteMembershipsByOrgID(ctx, org.id); err != nil {
+		return fmt.Errorf("failed to delete organization memberships: %w", err)
+	}
+	if err := mod.store.DeleteInvitationsByOrgID(ctx, org.id); err != nil {
+		return fmt.Errorf("failed to delete organization invitations: %w", err)
+	}
+	if err := mod.store.DeleteTeamsByOrgID(ctx, org.id); err != nil {
+		return fmt.Errorf("failed to delete organization teams: %w", err)
+	}
+	if err := mod.activityStore().DeleteActivityByOrgID(ctx, org.id); err != nil {
+		return fmt.Errorf("failed to delete organization activity: %w", err)
+	}
+	if err := mod.store.Delete(ctx, org.id); err != nil {
+		return err
+	}
+
+	mod.app.PublishEvent(ctx, EventOrgPurged, event)
+	return nil
+}
+
+// deletionEvent describes an organization's deletion, purged at once if
+// it isn't scheduled.
+func (mod *Module) deletionEvent(ctx context.Context, org *Org) *DeletionEvent {
+	event := &DeletionEvent{OrgID: org.id, Name: org.Name, PurgeAt: time.Now(), MemberIDs: make([]string, 0)}
+	if org.DeletedAt != nil {
+		event.PurgeAt = org.DeletedAt.Add(max(mod.deletionGrace, 0))
+	}
+	members, err := mod.store.GetMembersByOrgID(ctx, org.id)
+	if err != nil {
+		mod.logger().Warn("failed to list members of deleted organization", "org_id", org.id, "error", err)
+		return event
+	}
+	for _, member := range activeMemberships(members, time.Now()) {
+		event.MemberIDs = append(event.MemberIDs, member.UserID)
+	}
+	return event
+}
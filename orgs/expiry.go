@@ -0,0 +1,253 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// DefaultExpirySweepInterval is how often Start revokes expired
+// memberships unless WithExpirySweepInterval or orgs.expiry_sweep_interval
+// says otherwise.
+const DefaultExpirySweepInterval = 5 * time.Minute
+
+// DefaultExpiryWarning is how long before a membership expires its member
+// is warned unless WithExpiryWarning or orgs.expiry_warning says
+// otherwise.
+const DefaultExpiryWarning = 72 * time.Hour
+
+var (
+	ErrInvalidExpiry = chassis.NewError(chassis.CodeInvalidArgument, "membership expiry must be in the future")
+	ErrExpiringOwner = chassis.NewError(chassis.CodeFailedPrecondition, "owner memberships can't expire")
+)
+
+// Expiry events published when the events module is registered. A revoked
+// membership also publishes EventMemberRemoved.
+const (
+	EventMembershipExpiring = "org.membership_expiring" // payload: *ExpiryEvent
+	EventMembershipExpired  = "org.membership_expired"  // payload: *ExpiryEvent
+)
+
+// ActivityMembershipExpired is recorded when the sweep revokes a
+// membership; details: role.
+const ActivityMembershipExpired = "membership_expired"
+
+// ExpiryEvent is the payload of expiry events.
+type ExpiryEvent struct {
+	OrgID     string
+	UserID    string
+	Role      string
+	ExpiresAt time.Time
+}
+
+// WithExpirySweepInterval sets how often Start warns expiring members and
+// revokes expired memberships.
+func WithExpirySweepInterval(interval time.Duration) Option {
+	return func(mod *Module) {
+		mod.expiryInterval = interval
+	}
+}
+
+// WithExpiryWarning sets how long before a membership expires its member
+// is warned. Zero turns warnings off.
+func WithExpiryWarning(warning time.Duration) Option {
+	return func(mod *Module) {
+		mod.expiryWarning = warning
+	}
+}
+
+// Expired reports whether the membership had expired by now.
+func (membership *Membership) Expired(now time.Time) bool {
+	return membership.ExpiresAt != nil && !membership.ExpiresAt.After(now)
+}
+
+// activeMemberships returns the memberships not expired by now.
+func activeMemberships(memberships []*Membership, now time.Time) []*Membership {
+	active := make([]*Membership, 0, len(memberships))
+	for _, membership := range memberships {
+		if !membership.Expired(now) {
+			active = append(active, membership)
+		}
+	}
+	return active
+}
+
+// activeMembership returns the user's membership, or ErrMemberNotFound if
+// they aren't a member, it has expired or the organization is scheduled
+// for deletion.
+func (mod *Module) activeMembership(ctx context.Context, orgID, userID string) (*Membership, error) {
+	membership, err := mod.store.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership.Expired(time.Now()) {
+		return nil, ErrMemberNotFound
+	}
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, ErrMemberNotFound
+	}
+	return membership, nil
+}
+
+// AddMemberUntil adds a user to an organization with role until the given
+// time, for contractors and trials. Once it passes, the membership no
+// longer counts for GetMembers, GetUserRoles or permission checks, and
+// Start revokes it. Owners can't be added this way (ErrExpiringOwner).
+func (mod *Module) AddMemberUntil(ctx context.Context, orgID, userID, role string, until time.Time) (any, error) {
+	membership, err := mod.addMemberUntil(ctx, orgID, userID, role, until)
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// addMemberUntil is the internal implementation.
+func (mod *Module) addMemberUntil(ctx context.Context, orgID, userID, role string, until time.Time) (*Membership, error) {
+	if role == "owner" {
+		return nil, ErrExpiringOwner
+	}
+	if !until.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+	return mod.addMember(ctx, orgID, userID, role, &until)
+}
+
+// SetMemberExpiry changes when a membership expires, to extend a trial or,
+// with a zero until, to make it permanent. The expiry warning goes out
+// again for the new time.
+func (mod *Module) SetMemberExpiry(ctx context.Context, orgID, userID string, until time.Time) (*Membership, error) {
+	membership, err := mod.activeMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if until.IsZero() {
+		membership.ExpiresAt = nil
+	} else {
+		if membership.Role == "owner" {
+			return nil, ErrExpiringOwner
+		}
+		if !until.After(time.Now()) {
+			return nil, ErrInvalidExpiry
+		}
+		membership.ExpiresAt = &until
+	}
+	membership.ExpiryWarned = false
+	membership.UpdatedAt = time.Now()
+	if err := mod.store.UpdateMembership(ctx, membership); err != nil {
+		return nil, fmt.Errorf("failed to update membership expiry: %w", err)
+	}
+	return membership, nil
+}
+
+// Start warns expiring members, revokes expired memberships and purges
+// organizations whose deletion grace period is over every sweep interval
+// until ctx is cancelled, and relays the lifecycle events written inside an
+// app.Tx. Implements chassis.Service, so app.Run enforces AddMemberUntil and
+// Delete.
+func (mod *Module) Start(ctx context.Context) error {
+	mod.runRelay(ctx)
+	ticker := time.NewTicker(mod.expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := mod.ExpireMemberships(ctx); err != nil {
+				mod.logger().Error("failed to expire memberships", "error", err)
+			}
+			if _, err := mod.PurgeDeleted(ctx); err != nil {
+				mod.logger().Error("failed to purge deleted organizations", "error", err)
+			}
+		}
+	}
+}
+
+// ExpireMemberships warns the members whose memberships expire within the
+// warning period, publishing EventMembershipExpiring and emailing them
+// when the email and users modules are registered, and revokes the
+// memberships that have expired. It returns how many it revoked.
+func (mod *Module) ExpireMemberships(ctx context.Context) (int, error) {
+	now := time.Now()
+	expiring, err := mod.store.ListExpiringMemberships(ctx, now.Add(max(mod.expiryWarning, 0)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expiring memberships: %w", err)
+	}
+	revoked := 0
+	for _, membership := range expiring {
+		if membership.Expired(now) {
+			if err := mod.expire(ctx, membership); err != nil {
+				mod.logger().Error("failed to revoke expired membership", "org_id", membership.OrgID, "user_id", membership.UserID, "error", err)
+				continue
+			}
+			revoked++
+		} else if mod.expiryWarning > 0 && !membership.ExpiryWarned {
+			mod.warnExpiry(ctx, membership)
+		}
+	}
+	return revoked, nil
+}
+
+// expire revokes an expired membership like RemoveMember.
+func (mod *Module) expire(ctx context.Context, membership *Membership) error {
+	removed := &MemberEvent{OrgID: membership.OrgID, UserID: membership.UserID, Role: membership.Role}
+	err := mod.write(ctx, EventMemberRemoved, removed, func(ctx context.Context) error {
+		if err := mod.store.DeleteMembership(ctx, membership.OrgID, membership.UserID); err != nil && !errors.Is(err, ErrMemberNotFound) {
+			return err
+		}
+		if err := mod.store.DeleteTeamMembershipsByUserID(ctx, membership.OrgID, membership.UserID); err != nil {
+			return fmt.Errorf("failed to remove team memberships: %w", err)
+		}
+		mod.recordActivity(ctx, membership.OrgID, ActivityMembershipExpired, membership.UserID, map[string]string{"role": membership.Role})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	mod.app.PublishEvent(ctx, EventMembershipExpired, expiryEvent(membership))
+	return nil
+}
+
+// warnExpiry tells the member their membership is about to expire, once.
+func (mod *Module) warnExpiry(ctx context.Context, membership *Membership) {
+	membership.ExpiryWarned = true
+	if err := mod.store.UpdateMembership(ctx, membership); err != nil {
+		mod.logger().Error("failed to mark expiry warning", "org_id", membership.OrgID, "user_id", membership.UserID, "error", err)
+		return
+	}
+	mod.app.PublishEvent(ctx, EventMembershipExpiring, expiryEvent(membership))
+
+	emailMod, ok := mod.app.TryEmail()
+	if !ok {
+		return
+	}
+	usersMod, ok := mod.app.TryUsers()
+	if !ok {
+		return
+	}
+	user, err := usersMod.GetByID(ctx, membership.UserID)
+	if err != nil {
+		return
+	}
+	withEmail, ok := user.(emailer)
+	if !ok {
+		return
+	}
+	org, err := mod.store.GetByID(ctx, membership.OrgID)
+	if err != nil {
+		return
+	}
+	subject := fmt.Sprintf("Your access to %s expires soon", org.Name)
+	body := fmt.Sprintf("Your %s membership of %s expires on %s.\n\nAsk an admin of %s to extend it if you still need access.\n",
+		membership.Role, org.Name, membership.ExpiresAt.UTC().Format("2 January 2006 15:04 MST"), org.Name)
+	if err := emailMod.Send(ctx, withEmail.GetEmail(), subject, body); err != nil {
+		mod.logger().Error("failed to send expiry warning email", "org_id", membership.OrgID, "user_id", membership.UserID, "error", err)
+	}
+}
+
+func expiryEvent(membership *Membership) *ExpiryEvent {
+	return &ExpiryEvent{OrgID: membership.OrgID, UserID: membership.UserID, Role: membership.Role, ExpiresAt: *membership.ExpiresAt}
+}
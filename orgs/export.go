@@ -0,0 +1,446 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+// ExportJobType is the queue job type used by StartExport.
+const ExportJobType = "orgs.export"
+
+// DefaultExportURLTTL is how long the download link of a completed export
+// stays valid unless WithExportURLTTL or orgs.export_url_ttl says
+// otherwise.
+const DefaultExportURLTTL = 24 * time.Hour
+
+// ExportPrefix is the storage prefix under which StartExport keeps
+// bundles: exports/<org ID>/<export ID>.zip. It lies outside the org's own
+// prefix, so one export isn't bundled into the next.
+const ExportPrefix = "exports/"
+
+var (
+	ErrExportNotFound    = chassis.NewError(chassis.CodeNotFound, "export not found")
+	ErrExportUnavailable = chassis.NewError(chassis.CodeFailedPrecondition, "exports need the queue and storage modules")
+)
+
+// Export events published when the events module is registered.
+const (
+	EventExportCompleted = "org.export_completed" // payload: *ExportEvent
+	EventExportFailed    = "org.export_failed"    // payload: *ExportEvent
+)
+
+// ExportEvent is the payload of export events.
+type ExportEvent struct {
+	ExportID    string
+	OrgID       string
+	RequestedBy string
+	URL         string // signed download link, on completion
+	Error       string
+}
+
+// ExportStatus is the state of an export started with StartExport.
+type ExportStatus string
+
+const (
+	ExportPending   ExportStatus = "pending"
+	ExportRunning   ExportStatus = "running"
+	ExportCompleted ExportStatus = "completed"
+	ExportFailed    ExportStatus = "failed"
+)
+
+// Export tracks a bundle built in the background by StartExport.
+type Export struct {
+	ID          string
+	OrgID       string
+	RequestedBy string // user ID, if any
+	Status      ExportStatus
+	Progress    int    // percent of the modules exported
+	Key         string // storage key of the bundle, once completed
+	URL         string // signed download link, once completed
+	Error       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// ExportStore persists exports. SQLiteStore implements it; with other
+// stores exports are kept in memory.
+type ExportStore interface {
+	SaveExport(ctx context.Context, export *Export) error
+	GetExport(ctx context.Context, id string) (*Export, error)
+	ListExports(ctx context.Context, orgID string) ([]*Export, error) // newest first
+}
+
+// MemoryExportStore keeps exports in process memory.
+type MemoryExportStore struct {
+	mu      sync.Mutex
+	exports map[string]Export
+}
+
+// NewMemoryExportStore creates an in-memory export store.
+func NewMemoryExportStore() *MemoryExportStore {
+	return &MemoryExportStore{exports: make(map[string]Export)}
+}
+
+func (store *MemoryExportStore) SaveExport(ctx context.Context, export *Export) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.exports[export.ID] = *export
+	return nil
+}
+
+func (store *MemoryExportStore) GetExport(ctx context.Context, id string) (*Export, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	export, ok := store.exports[id]
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+	return &export, nil
+}
+
+func (store *MemoryExportStore) ListExports(ctx context.Context, orgID string) ([]*Export, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	exports := make([]*Export, 0)
+	for _, export := range store.exports {
+		if export.OrgID == orgID {
+			exports = append(exports, &export)
+		}
+	}
+	slices.SortFunc(exports, func(a, b *Export) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return exports, nil
+}
+
+// WithExportURLTTL sets how long the download link of a completed export
+// stays valid.
+func WithExportURLTTL(ttl time.Duration) Option {
+	return func(mod *Module) {
+		mod.exportURLTTL = ttl
+	}
+}
+
+// exportManifest is manifest.json, at the root of a bundle.
+type exportManifest struct {
+	OrgID      string    `json:"org_id"`
+	Name       string    `json:"name"`
+	ExportedAt time.Time `json:"exported_at"`
+	Modules    []string  `json:"modules"`
+	Files      []string  `json:"files"`
+}
+
+// Export writes a zip bundle of the organization to writer: its record,
+// members, teams and pending invitations under orgs/, and the files of
+// every other module implementing chassis.OrgExporter under a directory
+// named after it, such as the org's storage objects and notifications. A
+// manifest.json at the root lists the modules and files.
+func (mod *Module) Export(ctx context.Context, orgID string, writer io.Writer) error {
+	return mod.export(ctx, orgID, writer, nil)
+}
+
+// export is Export, calling progress with the percent of the modules
+// exported after each.
+func (mod *Module) export(ctx context.Context, orgID string, writer io.Writer, progress func(percent int)) error {
+	org, err := mod.store.GetByID(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	var exporters []chassis.Module
+	for _, module := range mod.app.Modules() {
+		if _, ok := module.(chassis.OrgExporter); ok {
+			exporters = append(exporters, module)
+		}
+	}
+
+	bundle := chassis.NewZipExport(writer)
+	manifest := exportManifest{OrgID: orgID, Name: org.Name, ExportedAt: time.Now().UTC(), Modules: make([]string, 0)}
+	for i, module := range exporters {
+		if err := module.(chassis.OrgExporter).ExportOrg(ctx, orgID, bundle.Dir(module.Name())); err != nil {
+			return fmt.Errorf("failed to export module %q: %w", module.Name(), err)
+		}
+		manifest.Modules = append(manifest.Modules, module.Name())
+		if progress != nil {
+			progress((i + 1) * 100 / len(exporters))
+		}
+	}
+
+	manifest.Files = bundle.Files()
+	if err := bundle.WriteJSON("manifest.json", manifest); err != nil {
+		return err
+	}
+	return bundle.Close()
+}
+
+// Exported records, with the snake_case keys of the other modules' files.
+type (
+	exportedOrg struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		ParentID  string    `json:"parent_id,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	exportedMember struct {
+		ID        string     `json:"id"`
+		UserID    string     `json:"user_id"`
+		Role      string     `json:"role"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		CreatedAt time.Time  `json:"created_at"`
+		UpdatedAt time.Time  `json:"updated_at"`
+	}
+	exportedTeam struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Role      string    `json:"role,omitempty"`
+		Members   []string  `json:"members"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	exportedMembership struct {
+		ID        string    `json:"id"`
+		OrgID     string    `json:"org_id"`
+		Role      string    `json:"role"`
+		Teams     []string  `json:"teams"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	exportedInvitation struct {
+		ID        string    `json:"id"`
+		OrgID     string    `json:"org_id,omitempty"`
+		Email     string    `json:"email"`
+		Role      string    `json:"role"`
+		CreatedAt time.Time `json:"created_at"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+)
+
+// ExportOrg writes org.json, members.json, teams.json and the pending
+// invitations, without their tokens, to invitations.json. Implements
+// chassis.OrgExporter.
+func (mod *Module) ExportOrg(ctx context.Context, orgID string, export chassis.ExportWriter) error {
+	org, err := mod.store.GetByID(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if err := export.WriteJSON("org.json", exportedOrg{ID: org.id, Name: org.Name, ParentID: org.ParentID, CreatedAt: org.CreatedAt, UpdatedAt: org.UpdatedAt}); err != nil {
+		return err
+	}
+
+	memberships, err := mod.store.GetMembersByOrgID(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to list members: %w", err)
+	}
+	members := make([]exportedMember, len(memberships))
+	for i, membership := range memberships {
+		members[i] = exportedMember{ID: membership.ID, UserID: membership.UserID, Role: membership.Role, ExpiresAt: membership.ExpiresAt, CreatedAt: membership.CreatedAt, UpdatedAt: membership.UpdatedAt}
+	}
+	if err := export.WriteJSON("members.json", members); err != nil {
+		return err
+	}
+
+	teams, err := mod.store.ListTeamsByOrgID(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to list teams: %w", err)
+	}
+	exportedTeams := make([]exportedTeam, len(teams))
+	for i, team := range teams {
+		teamMembers, err := mod.store.ListTeamMembers(ctx, team.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list team members: %w", err)
+		}
+		exportedTeams[i] = exportedTeam{ID: team.ID, Name: team.Name, Role: team.Role, Members: make([]string, len(teamMembers)), CreatedAt: team.CreatedAt, UpdatedAt: team.UpdatedAt}
+		for j, member := range teamMembers {
+			exportedTeams[i].Members[j] = member.UserID
+		}
+	}
+	if err := export.WriteJSON("teams.json", exportedTeams); err != nil {
+		return err
+	}
+
+	invitations, err := mod.ListInvitations(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	pending := make([]exportedInvitation, len(invitations))
+	for i, invitation := range invitations {
+		pending[i] = exportedInvitation{ID: invitation.ID, Email: invitation.Email, Role: invitation.Role, CreatedAt: invitation.CreatedAt, ExpiresAt: invitation.ExpiresAt}
+	}
+	return export.WriteJSON("invitations.json", pending)
+}
+
+// ExportUser writes the user's memberships, with the names of their teams,
+// to memberships.json and the pending invitations to their email to
+// invitations.json. Implements chassis.UserExporter.
+func (mod *Module) ExportUser(ctx context.Context, userID string, export chassis.ExportWriter) error {
+	memberships, err := mod.store.GetMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list memberships: %w", err)
+	}
+	exported := make([]exportedMembership, len(memberships))
+	for i, membership := range memberships {
+		teams, err := mod.store.GetTeamsByUserID(ctx, membership.OrgID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to list teams: %w", err)
+		}
+		exported[i] = exportedMembership{ID: membership.ID, OrgID: membership.OrgID, Role: membership.Role, Teams: make([]string, len(teams)), CreatedAt: membership.CreatedAt, UpdatedAt: membership.UpdatedAt}
+		for j, team := range teams {
+			exported[i].Teams[j] = team.Name
+		}
+	}
+	if err := export.WriteJSON("memberships.json", exported); err != nil {
+		return err
+	}
+
+	invitations, err := mod.invitationsForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	pending := make([]exportedInvitation, len(invitations))
+	for i, invitation := range invitations {
+		pending[i] = exportedInvitation{ID: invitation.ID, OrgID: invitation.OrgID, Email: invitation.Email, Role: invitation.Role, CreatedAt: invitation.CreatedAt, ExpiresAt: invitation.ExpiresAt}
+	}
+	return export.WriteJSON("invitations.json", pending)
+}
+
+// exportJob is the payload of ExportJobType jobs.
+type exportJob struct {
+	ExportID string `json:"export_id"`
+}
+
+// StartExport queues building the organization's bundle, as Export does,
+// and returns the export to poll with GetExport. The job stores the
+// bundle under ExportPrefix and records a signed download link valid for
+// the export URL TTL, then publishes EventExportCompleted with it.
+// requestedBy is the ID of the user asking, or "". It fails with
+// ErrExportUnavailable unless the queue module was registered before this
+// one and the storage module is registered.
+func (mod *Module) StartExport(ctx context.Context, orgID, requestedBy string) (*Export, error) {
+	if _, ok := mod.app.TryStorage(); mod.queue == nil || !ok {
+		return nil, ErrExportUnavailable
+	}
+	if _, err := mod.store.GetByID(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	export := &Export{
+		ID:          uuid.New().String(),
+		OrgID:       orgID,
+		RequestedBy: requestedBy,
+		Status:      ExportPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := mod.exports.SaveExport(ctx, export); err != nil {
+		return nil, fmt.Errorf("failed to save export: %w", err)
+	}
+	if _, err := mod.queue.Enqueue(chassis.WithTenant(ctx, orgID), ExportJobType, exportJob{ExportID: export.ID}); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetExport returns an export started with StartExport.
+func (mod *Module) GetExport(ctx context.Context, exportID string) (*Export, error) {
+	return mod.exports.GetExport(ctx, exportID)
+}
+
+// ListExports returns the organization's exports, newest first.
+func (mod *Module) ListExports(ctx context.Context, orgID string) ([]*Export, error) {
+	return mod.exports.ListExports(ctx, orgID)
+}
+
+// handleExportJob builds and stores the bundle of an ExportJobType job.
+func (mod *Module) handleExportJob(ctx context.Context, payload exportJob) error {
+	export, err := mod.exports.GetExport(ctx, payload.ExportID)
+	if err != nil {
+		return err
+	}
+
+	err = mod.runExport(ctx, export)
+	now := time.Now()
+	export.UpdatedAt = now
+	if err != nil {
+		export.Status = ExportFailed
+		export.Error = err.Error()
+	} else {
+		export.Status = ExportCompleted
+		export.Progress = 100
+		export.CompletedAt = &now
+	}
+	if saveErr := mod.exports.SaveExport(ctx, export); saveErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to save export: %w", saveErr))
+	}
+
+	event := &ExportEvent{ExportID: export.ID, OrgID: export.OrgID, RequestedBy: export.RequestedBy, URL: export.URL, Error: export.Error}
+	if err != nil {
+		mod.app.PublishEvent(ctx, EventExportFailed, event)
+		return err
+	}
+	mod.app.PublishEvent(ctx, EventExportCompleted, event)
+	return nil
+}
+
+// runExport writes the bundle to a temporary file, so its size is known,
+// stores it and signs its download link, recording progress on export.
+func (mod *Module) runExport(ctx context.Context, export *Export) error {
+	export.Status = ExportRunning
+	export.UpdatedAt = time.Now()
+	if err := mod.exports.SaveExport(ctx, export); err != nil {
+		return fmt.Errorf("failed to save export: %w", err)
+	}
+
+	file, err := os.CreateTemp("", "org-export-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	err = mod.export(ctx, export.OrgID, file, func(percent int) {
+		// Stop short of 100 until the bundle is stored
+		export.Progress = min(percent, 99)
+		export.UpdatedAt = time.Now()
+		if err := mod.exports.SaveExport(ctx, export); err != nil {
+			mod.logger().Warn("failed to save export progress", "export_id", export.ID, "error", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	storage, ok := mod.app.TryStorage()
+	if !ok {
+		return ErrExportUnavailable
+	}
+	key := ExportPrefix + export.OrgID + "/" + export.ID + ".zip"
+	if err := storage.PutReader(ctx, key, file, size); err != nil {
+		return fmt.Errorf("failed to store export: %w", err)
+	}
+	export.Key = key
+	export.URL, err = storage.SignedURL(ctx, key, mod.exportURLTTL, http.MethodGet)
+	if err != nil {
+		return fmt.Errorf("failed to sign export download link: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package orgs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/talosaether/chassis/pagination"
+)
+
+// CreateChild creates an organization under parentID, for reseller and
+// enterprise accounts. With the permissions module, roles in the parent
+// carry the inherited permissions over the child (see
+// permissions.WithInheritedPermissions).
+func (mod *Module) CreateChild(ctx context.Context, parentID string, input any) (any, error) {
+	createInput, ok := input.(CreateInput)
+	if !ok {
+		return nil, fmt.Errorf("invalid input type: expected CreateInput")
+	}
+	return mod.createChild(ctx, parentID, createInput)
+}
+
+// createChild is the internal implementation.
+func (mod *Module) createChild(ctx context.Context, parentID string, input CreateInput) (*Org, error) {
+	if _, err := mod.getOrg(ctx, parentID); err != nil {
+		return nil, err
+	}
+	return mod.createUnder(ctx, parentID, input)
+}
+
+// Children returns the organizations directly under orgID, by name,
+// leaving out those scheduled for deletion.
+func (mod *Module) Children(ctx context.Context, orgID string) ([]*Org, error) {
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+	return mod.liveChildren(ctx, orgID)
+}
+
+// AncestorIDs returns the IDs of the organization's parent, its parent's
+// parent and so on up to the top-level organization. It is empty for a
+// top-level or unknown organization.
+func (mod *Module) AncestorIDs(ctx context.Context, orgID string) []string {
+	var ancestors []string
+	seen := map[string]bool{orgID: true}
+	for {
+		org, err := mod.store.GetByID(ctx, orgID)
+		if err != nil || org.ParentID == "" || seen[org.ParentID] {
+			return ancestors
+		}
+		orgID = org.ParentID
+		seen[orgID] = true
+		ancestors = append(ancestors, orgID)
+	}
+}
+
+// DescendantIDs returns the IDs of every organization under orgID,
+// breadth first: its children by name, then their children. Those
+// scheduled for deletion are left out.
+func (mod *Module) DescendantIDs(ctx context.Context, orgID string) ([]string, error) {
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+	var descendants []string
+	seen := map[string]bool{orgID: true}
+	for level := []string{orgID}; len(level) > 0; {
+		var next []string
+		for _, parentID := range level {
+			children, err := mod.liveChildren(ctx, parentID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list child organizations: %w", err)
+			}
+			for _, child := range children {
+				if !seen[child.id] {
+					seen[child.id] = true
+					next = append(next, child.id)
+				}
+			}
+		}
+		descendants = append(descendants, next...)
+		level = next
+	}
+	return descendants, nil
+}
+
+// ListRollupMembers returns a page of the memberships of an organization
+// and every organization under it: its own members first, then each
+// descendant's in DescendantIDs order, oldest first within an
+// organization. A user in several of them is listed once per membership,
+// with its OrgID.
+func (mod *Module) ListRollupMembers(ctx context.Context, orgID string, req pagination.Request) (*pagination.Result[*Membership], error) {
+	descendants, err := mod.DescendantIDs(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	var memberships []*Membership
+	for _, id := range append([]string{orgID}, descendants...) {
+		count, err := mod.store.CountMembersByOrgID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count organization members: %w", err)
+		}
+		members, err := mod.store.ListMembersByOrgID(ctx, id, 0, count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organization members: %w", err)
+		}
+		memberships = append(memberships, members...)
+	}
+	return pagination.Slice(memberships, req)
+}
@@ -0,0 +1,237 @@
+package orgs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrInvitationNotFound = chassis.NewError(chassis.CodeNotFound, "invitation not found")
+	ErrInvitationExpired  = chassis.NewError(chassis.CodeFailedPrecondition, "invitation has expired")
+	ErrInvalidEmail       = chassis.NewError(chassis.CodeInvalidArgument, "invalid email")
+)
+
+// Invitation events published when the events module is registered.
+const (
+	EventInvitationCreated  = "org.invitation_created"  // payload: *InvitationEvent
+	EventInvitationAccepted = "org.invitation_accepted" // payload: *InvitationEvent
+	EventInvitationRevoked  = "org.invitation_revoked"  // payload: *InvitationEvent
+)
+
+// DefaultInviteTTL is how long invitations stay valid unless
+// WithInviteTTL or orgs.invite_ttl says otherwise.
+const DefaultInviteTTL = 7 * 24 * time.Hour
+
+// InvitationEvent is the payload of invitation events. UserID is set once
+// the invitation is accepted.
+type InvitationEvent struct {
+	InvitationID string
+	OrgID        string
+	Email        string
+	Role         string
+	UserID       string
+}
+
+// Invitation is a pending offer of membership to an email address.
+type Invitation struct {
+	ID        string
+	OrgID     string
+	Email     string
+	Role      string
+	Token     string // only set on the invitation returned by Invite; stored hashed
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the invitation can no longer be accepted.
+func (invitation *Invitation) Expired() bool {
+	return !time.Now().Before(invitation.ExpiresAt)
+}
+
+// WithInviteTTL sets how long invitations stay valid.
+func WithInviteTTL(ttl time.Duration) Option {
+	return func(mod *Module) {
+		mod.inviteTTL = ttl
+	}
+}
+
+// WithInviteURL sets the page invitation emails link to. The token is
+// added as the "token" query parameter, for the page to pass to
+// AcceptInvite once the invitee has signed in.
+func WithInviteURL(inviteURL string) Option {
+	return func(mod *Module) {
+		mod.inviteURL = inviteURL
+	}
+}
+
+// Invite creates an invitation for email to join the organization with
+// role and emails the invitee when the email module is registered.
+// Inviting an address again replaces its pending invitation, with a new
+// token and expiry, so it doubles as "resend".
+func (mod *Module) Invite(ctx context.Context, orgID, email, role string) (any, error) {
+	return mod.invite(ctx, orgID, email, role)
+}
+
+// invite is the internal implementation.
+func (mod *Module) invite(ctx context.Context, orgID, email, role string) (*Invitation, error) {
+	if !ValidRoles[role] {
+		return nil, ErrInvalidRole
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if parsed, err := mail.ParseAddress(email); err != nil || parsed.Address != email {
+		return nil, ErrInvalidEmail
+	}
+	org, err := mod.getOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateInviteToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	now := time.Now()
+	invitation := &Invitation{
+		ID:        uuid.New().String(),
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		CreatedAt: now,
+		ExpiresAt: now.Add(mod.inviteTTL),
+	}
+	if err := mod.store.DeleteInvitationByEmail(ctx, orgID, email); err != nil && !errors.Is(err, ErrInvitationNotFound) {
+		return nil, fmt.Errorf("failed to replace invitation: %w", err)
+	}
+	if err := mod.store.CreateInvitation(ctx, invitation, hashInviteToken(token)); err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+	invitation.Token = token
+
+	if emailMod, ok := mod.app.TryEmail(); ok {
+		subject, body := mod.inviteEmail(org, invitation)
+		if err := emailMod.Send(ctx, email, subject, body); err != nil {
+			mod.logger().Error("failed to send invitation email", "org_id", orgID, "invitation_id", invitation.ID, "error", err)
+		}
+	}
+
+	mod.recordActivity(ctx, orgID, ActivityMemberInvited, "", map[string]string{"email": invitation.Email, "role": invitation.Role})
+	mod.app.PublishEvent(ctx, EventInvitationCreated, invitationEvent(invitation, ""))
+	return invitation, nil
+}
+
+// inviteEmail returns the subject and body of an invitation email.
+func (mod *Module) inviteEmail(org *Org, invitation *Invitation) (string, string) {
+	subject := fmt.Sprintf("You're invited to join %s", org.Name)
+	body := fmt.Sprintf("You have been invited to join %s as %s.\n\n", org.Name, invitation.Role)
+	if mod.inviteURL != "" {
+		link := mod.inviteURL
+		separator := "?"
+		if strings.Contains(link, "?") {
+			separator = "&"
+		}
+		link += separator + "token=" + url.QueryEscape(invitation.Token)
+		body += fmt.Sprintf("Accept the invitation: %s\n\n", link)
+	} else {
+		body += fmt.Sprintf("Your invitation code: %s\n\n", invitation.Token)
+	}
+	body += fmt.Sprintf("The invitation expires on %s.\n", invitation.ExpiresAt.UTC().Format("2 January 2006 15:04 MST"))
+	return subject, body
+}
+
+// AcceptInvite redeems an invitation token for userID, adding them to the
+// organization with the invited role. The invitation is used up; expired
+// tokens fail with ErrInvitationExpired.
+func (mod *Module) AcceptInvite(ctx context.Context, token, userID string) (any, error) {
+	return mod.acceptInvite(ctx, token, userID)
+}
+
+// acceptInvite is the internal implementation.
+func (mod *Module) acceptInvite(ctx context.Context, token, userID string) (*Membership, error) {
+	invitation, err := mod.store.GetInvitationByToken(ctx, hashInviteToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Expired() {
+		return nil, ErrInvitationExpired
+	}
+
+	result, err := mod.AddMember(ctx, invitation.OrgID, userID, invitation.Role)
+	if err != nil && !errors.Is(err, ErrMemberExists) {
+		return nil, err
+	}
+	if err := mod.store.DeleteInvitation(ctx, invitation.ID); err != nil && !errors.Is(err, ErrInvitationNotFound) {
+		return nil, fmt.Errorf("failed to delete invitation: %w", err)
+	}
+	if result == nil {
+		// Already a member; the invitation is spent all the same
+		return nil, ErrMemberExists
+	}
+
+	mod.app.PublishEvent(ctx, EventInvitationAccepted, invitationEvent(invitation, userID))
+	return result.(*Membership), nil
+}
+
+// ListInvitations returns an organization's pending invitations, oldest
+// first, including expired ones not yet revoked.
+func (mod *Module) ListInvitations(ctx context.Context, orgID string) ([]*Invitation, error) {
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+	return mod.store.ListInvitationsByOrgID(ctx, orgID)
+}
+
+// RevokeInvitation deletes a pending invitation, so its token no longer
+// works.
+func (mod *Module) RevokeInvitation(ctx context.Context, orgID, invitationID string) error {
+	invitations, err := mod.ListInvitations(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	for _, invitation := range invitations {
+		if invitation.ID != invitationID {
+			continue
+		}
+		if err := mod.store.DeleteInvitation(ctx, invitationID); err != nil {
+			return err
+		}
+		mod.app.PublishEvent(ctx, EventInvitationRevoked, invitationEvent(invitation, ""))
+		return nil
+	}
+	return ErrInvitationNotFound
+}
+
+func invitationEvent(invitation *Invitation, userID string) *InvitationEvent {
+	return &InvitationEvent{
+		InvitationID: invitation.ID,
+		OrgID:        invitation.OrgID,
+		Email:        invitation.Email,
+		Role:         invitation.Role,
+		UserID:       userID,
+	}
+}
+
+func generateInviteToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashInviteToken is how tokens are stored, so a leaked database can't be
+// used to join organizations.
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package orgs
+
+import (
+	"context"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/pagination"
+)
+
+var ErrInvalidSort = chassis.NewError(chassis.CodeInvalidArgument, "organizations can be sorted by name, created_at or members")
+
+// ListOptions selects and orders the organizations returned by List.
+type ListOptions struct {
+	Page   int
+	Limit  int
+	Cursor string // NextCursor of a previous page; takes precedence over Page
+
+	Query  string // case-insensitive match anywhere in the name
+	SortBy string // name, created_at or members, "-" prefix for descending; default name
+
+	Deleted bool // list the organizations scheduled for deletion instead, for an undelete page
+}
+
+// OrgSummary is an organization with its member count, as listed by List.
+// Expired memberships aren't counted.
+type OrgSummary struct {
+	*Org
+	MemberCount int
+}
+
+// List returns a page of organizations matching opts, with member counts
+// and the total, for admin dashboards and org pickers:
+//
+//	result, err := orgsMod.List(ctx, orgs.ListOptions{Query: "acme", SortBy: "-members", Limit: 50})
+func (mod *Module) List(ctx context.Context, opts ListOptions) (*pagination.Result[*OrgSummary], error) {
+	req := pagination.Request{Page: opts.Page, Limit: opts.Limit, Cursor: opts.Cursor}
+	return db.Paginate(ctx, req,
+		func(ctx context.Context, offset, limit int) ([]*OrgSummary, error) {
+			return mod.store.List(ctx, opts, offset, limit)
+		},
+		func(ctx context.Context) (int, error) { return mod.store.Count(ctx, opts) },
+	)
+}
+
+// GetOrgsWithRole returns the organizations, by name, in which a user holds
+// role, directly or through a team, leaving out those scheduled for
+// deletion.
+func (mod *Module) GetOrgsWithRole(ctx context.Context, userID, role string) ([]*Org, error) {
+	if !ValidRoles[role] {
+		return nil, ErrInvalidRole
+	}
+	return mod.store.GetOrgsWithRole(ctx, userID, role)
+}
@@ -26,10 +26,101 @@
 //	// Get user's role
 //	role := app.Orgs().GetUserRole(ctx, orgID, userID)
 //
+// # Invitations
+//
+// Invite someone by email before they have an account. The invitee is
+// emailed a link to the page set by WithInviteURL, with the token as its
+// "token" query parameter, when the email module is registered. Once they
+// sign in, redeem the token for a membership:
+//
+//	invitation, err := app.Orgs().Invite(ctx, orgID, "ann@example.com", "member")
+//
+//	membership, err := app.Orgs().AcceptInvite(ctx, token, userID)
+//
+// Invitations expire after a week by default (WithInviteTTL); admins see
+// and cancel pending ones with ListInvitations and RevokeInvitation.
+//
+// # Teams
+//
+// Teams group an organization's members. A team can carry a role, which its
+// members hold on top of their own, so the permissions module grants the
+// role's permissions to the whole team:
+//
+//	team, err := orgsMod.CreateTeam(ctx, orgID, "Billing", "admin")
+//	_, err = orgsMod.AddTeamMember(ctx, team.ID, userID)
+//
+//	roles := app.Orgs().GetUserRoles(ctx, orgID, userID) // ["member", "admin"]
+//
+// # Export
+//
+// Export writes a zip bundle of an organization, with the files of every
+// module implementing chassis.OrgExporter, for data portability requests.
+// StartExport builds it in a queue job, stores it and signs a download
+// link, publishing EventExportCompleted:
+//
+//	err := app.Orgs().Export(ctx, orgID, writer)
+//
+//	export, err := orgsMod.StartExport(ctx, orgID, userID)
+//	export, err = orgsMod.GetExport(ctx, export.ID) // Status, Progress, URL
+//
+// # Activity
+//
+// The module keeps an activity feed per organization: creation, settings
+// updates, invitations, members joining and leaving, role changes,
+// ownership transfers, and uploads through storage.Uploads when the events
+// module is registered first. The actor is the user of the auth session in
+// ctx. Activity pages through it, newest first, resolving users with the
+// users module, and RecordActivity adds an application's own entries:
+//
+//	page, err := orgsMod.Activity(ctx, orgID, pagination.Request{Limit: 20})
+//	err = orgsMod.RecordActivity(ctx, &orgs.Activity{OrgID: orgID, Type: "plan_upgraded"})
+//
+// # Temporary Access
+//
+// AddMemberUntil adds a member whose access ends at a given time, for
+// contractors and trials. Expired memberships are left out of GetMembers,
+// GetUserRoles and so permission checks at once; Start, run by app.Run,
+// warns members ahead of expiry with EventMembershipExpiring and an email,
+// and revokes their memberships once expired:
+//
+//	_, err := app.Orgs().AddMemberUntil(ctx, orgID, userID, "member", time.Now().AddDate(0, 0, 14))
+//	_, err = orgsMod.SetMemberExpiry(ctx, orgID, userID, time.Time{}) // permanent after all
+//
+// # Hierarchy
+//
+// Organizations can have child organizations, for reseller and enterprise
+// accounts. AncestorIDs and DescendantIDs walk the tree, and
+// ListRollupMembers pages through the members of an organization and
+// everything under it. With the permissions module, roles in a parent
+// carry inherited permissions over its children:
+//
+//	child, err := app.Orgs().CreateChild(ctx, parentID, orgs.CreateInput{Name: "Acme EU"})
+//
+//	children, err := orgsMod.Children(ctx, parentID)
+//	page, err := orgsMod.ListRollupMembers(ctx, parentID, pagination.Request{Limit: 50})
+//
+// Delete refuses an organization that still has children with
+// ErrHasChildren.
+//
+// # Deletion
+//
+// Delete schedules an organization's deletion: it is hidden at once and
+// EventDeletionScheduled lists the members to warn. Undelete brings it
+// back within the grace period (30 days by default,
+// WithDeletionGracePeriod); after that Start purges it with its data in
+// every module implementing chassis.OrgPurger, publishing EventOrgPurged:
+//
+//	err := app.Orgs().Delete(ctx, orgID)
+//	err = app.Orgs().Undelete(ctx, orgID)
+//
+//	pending, err := orgsMod.List(ctx, orgs.ListOptions{Deleted: true})
+//
 // # Roles
 //
 // The module supports three built-in roles: "owner", "admin", and "member".
-// These integrate with the permissions module for access control.
+// These integrate with the permissions module for access control. An
+// organization always keeps an owner: removing or demoting the last one
+// fails with ErrLastOwner, so hand over with TransferOwnership first.
 //
 // # Configuration
 //
@@ -37,6 +128,12 @@
 //
 //	orgs:
 //	  db_path: ./data/orgs.db
+//	  invite_ttl: 168h
+//	  invite_url: https://app.example.com/invite
+//	  export_url_ttl: 24h
+//	  expiry_sweep_interval: 5m
+//	  expiry_warning: 72h
+//	  deletion_grace_period: 720h
 //
 // Or programmatically:
 //
@@ -45,21 +142,31 @@ package orgs
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/outbox"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/queue"
 )
 
 var (
-	ErrNotFound       = errors.New("organization not found")
-	ErrNameRequired   = errors.New("organization name is required")
-	ErrNameExists     = errors.New("organization name already exists")
-	ErrMemberNotFound = errors.New("member not found")
-	ErrMemberExists   = errors.New("user is already a member of this organization")
-	ErrInvalidRole    = errors.New("invalid role")
+	ErrNotFound       = chassis.NewError(chassis.CodeNotFound, "organization not found")
+	ErrNameRequired   = chassis.NewError(chassis.CodeInvalidArgument, "organization name is required")
+	ErrNameExists     = chassis.NewError(chassis.CodeAlreadyExists, "organization name already exists")
+	ErrMemberNotFound = chassis.NewError(chassis.CodeNotFound, "member not found")
+	ErrMemberExists   = chassis.NewError(chassis.CodeAlreadyExists, "user is already a member of this organization")
+	ErrInvalidRole    = chassis.NewError(chassis.CodeInvalidArgument, "invalid role")
+	ErrLastOwner      = chassis.NewError(chassis.CodeFailedPrecondition, "organization must keep at least one owner")
+	ErrNotOwner       = chassis.NewError(chassis.CodeFailedPrecondition, "user is not an owner of this organization")
+	ErrHasChildren    = chassis.NewError(chassis.CodeFailedPrecondition, "organization has child organizations")
 )
 
 // ValidRoles defines the allowed membership roles.
@@ -69,10 +176,41 @@ var ValidRoles = map[string]bool{
 	"member": true,
 }
 
+// Lifecycle events published when the events module is registered.
+const (
+	EventOrgCreated    = "org.created"        // payload: *OrgEvent
+	EventMemberAdded   = "org.member_added"   // payload: *MemberEvent
+	EventMemberRemoved = "org.member_removed" // payload: *MemberEvent
+
+	EventOwnershipTransferred = "org.ownership_transferred" // payload: *OwnershipEvent
+)
+
+// OrgEvent is the payload of organization lifecycle events.
+type OrgEvent struct {
+	OrgID string
+	Name  string
+}
+
+// MemberEvent is the payload of membership events.
+type MemberEvent struct {
+	OrgID  string
+	UserID string
+	Role   string
+}
+
+// OwnershipEvent is the payload of EventOwnershipTransferred.
+type OwnershipEvent struct {
+	OrgID      string
+	FromUserID string
+	ToUserID   string
+}
+
 // Org represents an organization in the system.
 type Org struct {
 	id        string
 	Name      string
+	ParentID  string     // empty for a top-level organization
+	DeletedAt *time.Time // when Delete scheduled its deletion, nil for a live organization
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -90,6 +228,9 @@ type Membership struct {
 	Role      string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	ExpiresAt    *time.Time // nil for permanent access, see AddMemberUntil
+	ExpiryWarned bool       // the expiry warning went out
 }
 
 // CreateInput contains the data needed to create an organization.
@@ -104,9 +245,23 @@ type UpdateInput struct {
 
 // Module is the orgs module implementation.
 type Module struct {
-	store  Store
-	dbPath string
-	app    *chassis.App
+	store           Store
+	dbPath          string
+	inviteTTL       time.Duration
+	inviteURL       string
+	soleOwnerPolicy SoleOwnerPolicy
+	exportURLTTL    time.Duration
+	expiryInterval  time.Duration
+	expiryWarning   time.Duration
+	deletionGrace   time.Duration
+	exports         ExportStore
+	activity        ActivityStore
+	queue           *queue.Module
+	stopUploads     func()         // unsubscribes from storage uploads
+	outbox          *outbox.Outbox // lifecycle events, see openOutbox
+	outboxDB        *sql.DB
+	relay           *outbox.Relay
+	app             *chassis.App
 }
 
 // Option is a function that configures the orgs module.
@@ -129,7 +284,13 @@ func WithDBPath(path string) Option {
 // New creates a new orgs module with the given options.
 func New(opts ...Option) *Module {
 	mod := &Module{
-		dbPath: "./data/orgs.db",
+		dbPath:          "./data/orgs.db",
+		inviteTTL:       DefaultInviteTTL,
+		soleOwnerPolicy: SoleOwnerReassign,
+		exportURLTTL:    DefaultExportURLTTL,
+		expiryInterval:  DefaultExpirySweepInterval,
+		expiryWarning:   DefaultExpiryWarning,
+		deletionGrace:   DefaultDeletionGracePeriod,
 	}
 
 	for _, opt := range opts {
@@ -153,31 +314,146 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		if dbPath := cfg.GetString("orgs.db_path"); dbPath != "" {
 			mod.dbPath = dbPath
 		}
+		if cfg.Get("orgs.invite_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("orgs.invite_ttl")
+			if err != nil {
+				return err
+			}
+			mod.inviteTTL = ttl
+		}
+		if inviteURL := cfg.GetString("orgs.invite_url"); inviteURL != "" {
+			mod.inviteURL = inviteURL
+		}
+		if cfg.Get("orgs.export_url_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("orgs.export_url_ttl")
+			if err != nil {
+				return err
+			}
+			mod.exportURLTTL = ttl
+		}
+		if cfg.Get("orgs.expiry_sweep_interval") != nil {
+			interval, err := cfg.MustGetDuration("orgs.expiry_sweep_interval")
+			if err != nil {
+				return err
+			}
+			if interval <= 0 {
+				return fmt.Errorf("%w: orgs.expiry_sweep_interval: %s is not positive", chassis.ErrInvalidConfig, interval)
+			}
+			mod.expiryInterval = interval
+		}
+		if cfg.Get("orgs.expiry_warning") != nil {
+			warning, err := cfg.MustGetDuration("orgs.expiry_warning")
+			if err != nil {
+				return err
+			}
+			mod.expiryWarning = warning
+		}
+		if cfg.Get("orgs.deletion_grace_period") != nil {
+			grace, err := cfg.MustGetDuration("orgs.deletion_grace_period")
+			if err != nil {
+				return err
+			}
+			mod.deletionGrace = grace
+		}
+		if policy := cfg.GetString("orgs.sole_owner_policy"); policy != "" {
+			switch SoleOwnerPolicy(policy) {
+			case SoleOwnerReassign, SoleOwnerDelete, SoleOwnerBlock:
+				mod.soleOwnerPolicy = SoleOwnerPolicy(policy)
+			default:
+				return fmt.Errorf("orgs.sole_owner_policy must be reassign, delete or block, got %q", policy)
+			}
+		}
+	}
+
+	if mod.expiryInterval <= 0 {
+		mod.expiryInterval = DefaultExpirySweepInterval
 	}
 
 	// Use custom store if provided, otherwise create SQLite store
 	if mod.store == nil {
-		sqliteStore, err := NewSQLiteStore(mod.dbPath)
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
 		if err != nil {
 			return fmt.Errorf("failed to create orgs store: %w", err)
 		}
 		mod.store = sqliteStore
+		if err := mod.openOutbox(ctx, sqliteStore.db); err != nil {
+			return err
+		}
 		app.Logger().Info("orgs module initialized", "db_path", mod.dbPath)
 	} else {
 		app.Logger().Info("orgs module initialized with custom store")
 	}
+	if exports, ok := mod.store.(ExportStore); ok {
+		mod.exports = exports
+	} else {
+		mod.exports = NewMemoryExportStore()
+	}
+	mod.activityStore() // picked before the module is used concurrently
+	if eventsMod, ok := app.TryEvents(); ok {
+		mod.stopUploads = eventsMod.Subscribe(storageFileUploaded, mod.recordUpload)
+	}
+
+	if queueAPI, ok := app.TryQueue(); ok {
+		if queueMod, ok := queueAPI.(*queue.Module); ok {
+			mod.queue = queueMod
+			queue.RegisterTyped(queueMod, ExportJobType, mod.handleExportJob)
+		}
+	}
 
 	return nil
 }
 
+// openSQLiteStore creates the store on the database named by
+// orgs.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("orgs")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
 // Shutdown cleans up the orgs module.
 func (mod *Module) Shutdown(ctx context.Context) error {
+	if mod.stopUploads != nil {
+		mod.stopUploads()
+	}
 	if mod.store != nil {
 		return mod.store.Close()
 	}
 	return nil
 }
 
+// logger returns the app logger, falling back to the default logger before Init.
+func (mod *Module) logger() *slog.Logger {
+	if mod.app != nil {
+		return mod.app.Logger()
+	}
+	return slog.Default()
+}
+
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "orgs.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "orgs.db"))
+}
+
 // Create creates a new organization.
 func (mod *Module) Create(ctx context.Context, input any) (any, error) {
 	createInput, ok := input.(CreateInput)
@@ -192,6 +468,12 @@ func (mod *Module) Create(ctx context.Context, input any) (any, error) {
 
 // create is the internal implementation.
 func (mod *Module) create(ctx context.Context, input CreateInput) (*Org, error) {
+	return mod.createUnder(ctx, "", input)
+}
+
+// createUnder creates an organization, a child of parentID unless it is
+// empty.
+func (mod *Module) createUnder(ctx context.Context, parentID string, input CreateInput) (*Org, error) {
 	if input.Name == "" {
 		return nil, ErrNameRequired
 	}
@@ -209,20 +491,31 @@ func (mod *Module) create(ctx context.Context, input CreateInput) (*Org, error)
 	org := &Org{
 		id:        uuid.New().String(),
 		Name:      input.Name,
+		ParentID:  parentID,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	if err := mod.store.Create(ctx, org); err != nil {
-		return nil, fmt.Errorf("failed to create organization: %w", err)
+	err = mod.write(ctx, EventOrgCreated, &OrgEvent{OrgID: org.id, Name: org.Name}, func(ctx context.Context) error {
+		if err := mod.store.Create(ctx, org); err != nil {
+			return fmt.Errorf("failed to create organization: %w", err)
+		}
+		mod.recordActivity(ctx, org.id, ActivityOrgCreated, "", nil)
+		if parentID != "" {
+			mod.recordActivity(ctx, parentID, ActivityChildCreated, "", map[string]string{"org_id": org.id, "name": org.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return org, nil
 }
 
-// GetByID retrieves an organization by its ID.
+// GetByID retrieves an organization by its ID. One scheduled for deletion
+// is ErrNotFound.
 func (mod *Module) GetByID(ctx context.Context, orgID string) (any, error) {
-	return mod.store.GetByID(ctx, orgID)
+	return mod.getOrg(ctx, orgID)
 }
 
 // Update updates an existing organization.
@@ -236,7 +529,7 @@ func (mod *Module) Update(ctx context.Context, orgID string, input any) (any, er
 
 // update is the internal implementation.
 func (mod *Module) update(ctx context.Context, orgID string, input UpdateInput) (*Org, error) {
-	org, err := mod.store.GetByID(ctx, orgID)
+	org, err := mod.getOrg(ctx, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -254,25 +547,28 @@ func (mod *Module) update(ctx context.Context, orgID string, input UpdateInput)
 		return nil, fmt.Errorf("failed to update organization: %w", err)
 	}
 
+	mod.recordActivity(ctx, orgID, ActivitySettingsUpdated, "", map[string]string{"name": org.Name})
 	return org, nil
 }
 
-// Delete removes an organization and all its memberships.
-func (mod *Module) Delete(ctx context.Context, orgID string) error {
-	if err := mod.store.DeleteMembershipsByOrgID(ctx, orgID); err != nil {
-		return fmt.Errorf("failed to delete organization memberships: %w", err)
+// AddMember adds a user to an organization with the specified role.
+func (mod *Module) AddMember(ctx context.Context, orgID, userID, role string) (any, error) {
+	membership, err := mod.addMember(ctx, orgID, userID, role, nil)
+	if err != nil {
+		return nil, err
 	}
-	return mod.store.Delete(ctx, orgID)
+	return membership, nil
 }
 
-// AddMember adds a user to an organization with the specified role.
-func (mod *Module) AddMember(ctx context.Context, orgID, userID, role string) (any, error) {
+// addMember is the internal implementation, adding a membership expiring
+// at expiresAt unless it is nil.
+func (mod *Module) addMember(ctx context.Context, orgID, userID, role string, expiresAt *time.Time) (*Membership, error) {
 	if !ValidRoles[role] {
 		return nil, ErrInvalidRole
 	}
 
 	// Check if org exists
-	_, err := mod.store.GetByID(ctx, orgID)
+	_, err := mod.getOrg(ctx, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -282,11 +578,17 @@ func (mod *Module) AddMember(ctx context.Context, orgID, userID, role string) (a
 	if err != nil && !errors.Is(err, ErrMemberNotFound) {
 		return nil, fmt.Errorf("failed to check existing membership: %w", err)
 	}
+	now := time.Now()
 	if existing != nil {
-		return nil, ErrMemberExists
+		if !existing.Expired(now) {
+			return nil, ErrMemberExists
+		}
+		// Expired but not swept yet
+		if err := mod.expire(ctx, existing); err != nil {
+			return nil, err
+		}
 	}
 
-	now := time.Now()
 	membership := &Membership{
 		ID:        uuid.New().String(),
 		OrgID:     orgID,
@@ -294,21 +596,50 @@ func (mod *Module) AddMember(ctx context.Context, orgID, userID, role string) (a
 		Role:      role,
 		CreatedAt: now,
 		UpdatedAt: now,
+		ExpiresAt: expiresAt,
 	}
 
-	if err := mod.store.CreateMembership(ctx, membership); err != nil {
-		return nil, fmt.Errorf("failed to add member: %w", err)
+	err = mod.write(ctx, EventMemberAdded, &MemberEvent{OrgID: orgID, UserID: userID, Role: role}, func(ctx context.Context) error {
+		if err := mod.store.CreateMembership(ctx, membership); err != nil {
+			return fmt.Errorf("failed to add member: %w", err)
+		}
+		details := map[string]string{"role": role}
+		if expiresAt != nil {
+			details["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+		}
+		mod.recordActivity(ctx, orgID, ActivityMemberJoined, userID, details)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return membership, nil
 }
 
-// RemoveMember removes a user from an organization.
+// RemoveMember removes a user from an organization and its teams. The
+// last owner can't be removed (ErrLastOwner); transfer ownership first.
 func (mod *Module) RemoveMember(ctx context.Context, orgID, userID string) error {
-	return mod.store.DeleteMembership(ctx, orgID, userID)
+	membership, err := mod.store.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := mod.checkNotLastOwner(ctx, membership); err != nil {
+		return err
+	}
+	return mod.write(ctx, EventMemberRemoved, &MemberEvent{OrgID: orgID, UserID: userID, Role: membership.Role}, func(ctx context.Context) error {
+		if err := mod.store.DeleteMembership(ctx, orgID, userID); err != nil {
+			return err
+		}
+		if err := mod.store.DeleteTeamMembershipsByUserID(ctx, orgID, userID); err != nil {
+			return fmt.Errorf("failed to remove team memberships: %w", err)
+		}
+		mod.recordActivity(ctx, orgID, ActivityMemberRemoved, userID, map[string]string{"role": membership.Role})
+		return nil
+	})
 }
 
-// UpdateMemberRole updates a member's role in an organization.
+// UpdateMemberRole updates a member's role in an organization. The last
+// owner can't be demoted (ErrLastOwner).
 func (mod *Module) UpdateMemberRole(ctx context.Context, orgID, userID, role string) (any, error) {
 	if !ValidRoles[role] {
 		return nil, ErrInvalidRole
@@ -318,39 +649,124 @@ func (mod *Module) UpdateMemberRole(ctx context.Context, orgID, userID, role str
 	if err != nil {
 		return nil, err
 	}
+	if role != "owner" {
+		if err := mod.checkNotLastOwner(ctx, membership); err != nil {
+			return nil, err
+		}
+	}
 
+	previous := membership.Role
 	membership.Role = role
 	membership.UpdatedAt = time.Now()
+	if role == "owner" {
+		// Owners are permanent, so an organization never loses its last one
+		membership.ExpiresAt, membership.ExpiryWarned = nil, false
+	}
 
 	if err := mod.store.UpdateMembership(ctx, membership); err != nil {
 		return nil, fmt.Errorf("failed to update member role: %w", err)
 	}
 
+	if role != previous {
+		mod.recordActivity(ctx, orgID, ActivityRoleChanged, userID, map[string]string{"role": role, "previous_role": previous})
+	}
+
 	return membership, nil
 }
 
-// GetMembers retrieves all members of an organization.
+// checkNotLastOwner fails with ErrLastOwner if membership is the
+// organization's only owner.
+func (mod *Module) checkNotLastOwner(ctx context.Context, membership *Membership) error {
+	if membership.Role != "owner" {
+		return nil
+	}
+	owners, err := mod.store.CountMembersWithRole(ctx, membership.OrgID, "owner")
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// TransferOwnership makes toUserID, who must already be a member, an owner
+// of the organization and demotes fromUserID, who must be an owner, to
+// admin, in one transaction.
+func (mod *Module) TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID string) error {
+	from, err := mod.store.GetMembership(ctx, orgID, fromUserID)
+	if err != nil {
+		return err
+	}
+	if from.Role != "owner" {
+		return ErrNotOwner
+	}
+	if _, err := mod.activeMembership(ctx, orgID, toUserID); err != nil {
+		return err
+	}
+	if fromUserID == toUserID {
+		return nil
+	}
+
+	now := time.Now()
+	if err := mod.store.TransferOwnership(ctx, orgID, fromUserID, toUserID, now); err != nil {
+		return fmt.Errorf("failed to transfer ownership: %w", err)
+	}
+
+	mod.recordActivity(ctx, orgID, ActivityOwnershipTransferred, toUserID, map[string]string{"from_user_id": fromUserID})
+	mod.app.PublishEvent(ctx, EventOwnershipTransferred, &OwnershipEvent{OrgID: orgID, FromUserID: fromUserID, ToUserID: toUserID})
+	return nil
+}
+
+// GetMembers retrieves all members of an organization, leaving out
+// expired memberships.
 func (mod *Module) GetMembers(ctx context.Context, orgID string) (any, error) {
-	_, err := mod.store.GetByID(ctx, orgID)
+	_, err := mod.getOrg(ctx, orgID)
 	if err != nil {
 		return nil, err
 	}
-	return mod.store.GetMembersByOrgID(ctx, orgID)
+	members, err := mod.store.GetMembersByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return activeMemberships(members, time.Now()), nil
 }
 
-// GetUserOrgs retrieves all organizations a user belongs to.
+// ListMembers returns a page of an organization's members, oldest first,
+// leaving out expired memberships.
+func (mod *Module) ListMembers(ctx context.Context, orgID string, req pagination.Request) (*pagination.Result[*Membership], error) {
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	return db.Paginate(ctx, req,
+		func(ctx context.Context, offset, limit int) ([]*Membership, error) {
+			return mod.store.ListMembersByOrgID(ctx, orgID, offset, limit)
+		},
+		func(ctx context.Context) (int, error) { return mod.store.CountMembersByOrgID(ctx, orgID) },
+	)
+}
+
+// GetUserOrgs retrieves the memberships of all organizations a user
+// belongs to, leaving out expired ones and those of organizations
+// scheduled for deletion.
 func (mod *Module) GetUserOrgs(ctx context.Context, userID string) (any, error) {
-	return mod.store.GetMembershipsByUserID(ctx, userID)
+	memberships, err := mod.store.GetMembershipsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return mod.liveMemberships(ctx, activeMemberships(memberships, time.Now())), nil
 }
 
-// GetMembership retrieves a specific membership.
+// GetMembership retrieves a specific membership. An expired one, or one of
+// an organization scheduled for deletion, is ErrMemberNotFound.
 func (mod *Module) GetMembership(ctx context.Context, orgID, userID string) (any, error) {
-	return mod.store.GetMembership(ctx, orgID, userID)
+	return mod.activeMembership(ctx, orgID, userID)
 }
 
 // GetUserRole returns the user's role in an organization, or empty string if not a member.
 func (mod *Module) GetUserRole(ctx context.Context, orgID, userID string) string {
-	membership, err := mod.store.GetMembership(ctx, orgID, userID)
+	membership, err := mod.activeMembership(ctx, orgID, userID)
 	if err != nil {
 		return ""
 	}
@@ -1,11 +1,30 @@
 package orgs
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/email/emailtest"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/storage"
+	"github.com/talosaether/chassis/users"
 )
 
 func setupTestStore(t *testing.T) (*SQLiteStore, func()) {
@@ -411,3 +430,728 @@ func TestValidRoles(t *testing.T) {
 		t.Error("'invalid-role' should not be valid")
 	}
 }
+
+func TestModule_ListMembers(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mod := New(WithStore(store))
+
+	store.Create(ctx, &Org{id: "org-id", Name: "Org"})
+	for i := range 5 {
+		store.CreateMembership(ctx, &Membership{ID: fmt.Sprintf("m%d", i), OrgID: "org-id", UserID: fmt.Sprintf("user%d", i), Role: "member"})
+	}
+
+	first, err := mod.ListMembers(ctx, "org-id", pagination.Request{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListMembers failed: %v", err)
+	}
+	if len(first.Items) != 2 || first.Total != 5 || first.TotalPages != 3 || !first.HasMore {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	// Follow cursors to the end without repeating anyone
+	seen := map[string]bool{}
+	for page := first; ; {
+		for _, member := range page.Items {
+			if seen[member.UserID] {
+				t.Errorf("member %s listed twice", member.UserID)
+			}
+			seen[member.UserID] = true
+		}
+		if !page.HasMore {
+			break
+		}
+		page, err = mod.ListMembers(ctx, "org-id", pagination.Request{Cursor: page.NextCursor, Limit: 2})
+		if err != nil {
+			t.Fatalf("ListMembers with cursor failed: %v", err)
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected to see 5 members, saw %d", len(seen))
+	}
+
+	if _, err := mod.ListMembers(ctx, "missing", pagination.Request{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestModule_Invitations(t *testing.T) {
+	inbox := emailtest.NewInbox()
+	store, _ := setupTestStore(t)
+	mod := New(WithStore(store), WithInviteURL("https://app.example.com/invite"))
+	app := chassis.New(chassis.WithModules(email.New(email.WithProvider(inbox)), mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	store.Create(ctx, &Org{id: "org-id", Name: "Acme"})
+
+	if _, err := mod.Invite(ctx, "org-id", "ann@example.com", "boss"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+	if _, err := mod.Invite(ctx, "org-id", "not an email", "member"); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail, got %v", err)
+	}
+
+	first, err := mod.invite(ctx, "org-id", "Ann@Example.com", "member")
+	if err != nil {
+		t.Fatalf("Invite failed: %v", err)
+	}
+	emailtest.AssertSent(t, inbox, "ann@example.com", "https://app.example.com/invite?token="+first.Token)
+
+	// Inviting again replaces the pending invitation
+	second, err := mod.invite(ctx, "org-id", "ann@example.com", "admin")
+	if err != nil {
+		t.Fatalf("second Invite failed: %v", err)
+	}
+	pending, _ := mod.ListInvitations(ctx, "org-id")
+	if len(pending) != 1 || pending[0].ID != second.ID || pending[0].Token != "" {
+		t.Fatalf("expected only the second invitation, without its token: %+v", pending)
+	}
+	if _, err := mod.AcceptInvite(ctx, first.Token, "ann-id"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("replaced token should not work, got %v", err)
+	}
+
+	result, err := mod.AcceptInvite(ctx, second.Token, "ann-id")
+	if err != nil {
+		t.Fatalf("AcceptInvite failed: %v", err)
+	}
+	if membership := result.(*Membership); membership.UserID != "ann-id" || membership.Role != "admin" {
+		t.Errorf("unexpected membership: %+v", membership)
+	}
+	if _, err := mod.AcceptInvite(ctx, second.Token, "bob-id"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("accepted token should be used up, got %v", err)
+	}
+
+	bob, _ := mod.invite(ctx, "org-id", "bob@example.com", "member")
+	if err := mod.RevokeInvitation(ctx, "org-id", bob.ID); err != nil {
+		t.Fatalf("RevokeInvitation failed: %v", err)
+	}
+	if _, err := mod.AcceptInvite(ctx, bob.Token, "bob-id"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("revoked token should not work, got %v", err)
+	}
+	if err := mod.RevokeInvitation(ctx, "org-id", bob.ID); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("expected ErrInvitationNotFound, got %v", err)
+	}
+
+	mod.inviteTTL = -time.Minute
+	expired, _ := mod.invite(ctx, "org-id", "carol@example.com", "member")
+	if _, err := mod.AcceptInvite(ctx, expired.Token, "carol-id"); !errors.Is(err, ErrInvitationExpired) {
+		t.Errorf("expected ErrInvitationExpired, got %v", err)
+	}
+}
+
+func TestModule_Teams(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mod := New(WithStore(store))
+
+	store.Create(ctx, &Org{id: "org-id", Name: "Org"})
+	mod.AddMember(ctx, "org-id", "ann", "member")
+	mod.AddMember(ctx, "org-id", "bob", "member")
+
+	if _, err := mod.CreateTeam(ctx, "org-id", "Billing", "boss"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+	team, err := mod.CreateTeam(ctx, "org-id", "Billing", "admin")
+	if err != nil {
+		t.Fatalf("CreateTeam failed: %v", err)
+	}
+	if _, err := mod.CreateTeam(ctx, "org-id", "Billing", ""); !errors.Is(err, ErrTeamExists) {
+		t.Errorf("expected ErrTeamExists, got %v", err)
+	}
+
+	if _, err := mod.AddTeamMember(ctx, team.ID, "ann"); err != nil {
+		t.Fatalf("AddTeamMember failed: %v", err)
+	}
+	if _, err := mod.AddTeamMember(ctx, team.ID, "ann"); !errors.Is(err, ErrTeamMemberExists) {
+		t.Errorf("expected ErrTeamMemberExists, got %v", err)
+	}
+	if _, err := mod.AddTeamMember(ctx, team.ID, "stranger"); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("expected ErrMemberNotFound for non-members, got %v", err)
+	}
+
+	if roles := mod.GetUserRoles(ctx, "org-id", "ann"); len(roles) != 2 || roles[0] != "member" || roles[1] != "admin" {
+		t.Errorf("expected ann to be member and admin, got %v", roles)
+	}
+	if roles := mod.GetUserRoles(ctx, "org-id", "bob"); len(roles) != 1 || roles[0] != "member" {
+		t.Errorf("expected bob to be member, got %v", roles)
+	}
+	if roles := mod.GetUserRoles(ctx, "org-id", "stranger"); roles != nil {
+		t.Errorf("expected no roles for non-members, got %v", roles)
+	}
+
+	if _, err := mod.SetTeamRole(ctx, team.ID, ""); err != nil {
+		t.Fatalf("SetTeamRole failed: %v", err)
+	}
+	if roles := mod.GetUserRoles(ctx, "org-id", "ann"); len(roles) != 1 {
+		t.Errorf("team without a role should grant none, got %v", roles)
+	}
+
+	// Leaving the org leaves its teams
+	mod.RemoveMember(ctx, "org-id", "ann")
+	if members, _ := mod.ListTeamMembers(ctx, team.ID); len(members) != 0 {
+		t.Errorf("expected no team members after ann left, got %d", len(members))
+	}
+
+	if err := mod.DeleteTeam(ctx, team.ID); err != nil {
+		t.Fatalf("DeleteTeam failed: %v", err)
+	}
+	if _, err := mod.GetTeam(ctx, team.ID); !errors.Is(err, ErrTeamNotFound) {
+		t.Errorf("expected ErrTeamNotFound, got %v", err)
+	}
+}
+
+func TestModule_List(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mod := New(WithStore(store))
+
+	for i, name := range []string{"Acme", "Acme_Labs", "Globex", "Initech"} {
+		org, _ := mod.create(ctx, CreateInput{Name: name})
+		for j := range i {
+			mod.AddMember(ctx, org.ID(), fmt.Sprintf("user%d", j), "member")
+		}
+		if name == "Initech" {
+			// Expired members aren't counted
+			past := time.Now().Add(-time.Minute)
+			for _, userID := range []string{"lapsed1", "lapsed2"} {
+				membership, _ := mod.addMemberUntil(ctx, org.ID(), userID, "member", time.Now().Add(time.Hour))
+				membership.ExpiresAt = &past
+				store.UpdateMembership(ctx, membership)
+			}
+		}
+	}
+
+	result, err := mod.List(ctx, ListOptions{Limit: 3})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if result.Total != 4 || len(result.Items) != 3 || !result.HasMore || result.Items[0].Name != "Acme" {
+		t.Fatalf("unexpected first page: %+v", result)
+	}
+	next, _ := mod.List(ctx, ListOptions{Cursor: result.NextCursor, Limit: 3})
+	if len(next.Items) != 1 || next.Items[0].Name != "Initech" || next.Items[0].MemberCount != 3 {
+		t.Errorf("unexpected second page: %+v", next.Items)
+	}
+
+	// LIKE wildcards in the query are literal
+	search, _ := mod.List(ctx, ListOptions{Query: "acme_"})
+	if search.Total != 1 || search.Items[0].Name != "Acme_Labs" {
+		t.Errorf("expected only Acme_Labs, got %+v", search.Items)
+	}
+
+	byMembers, _ := mod.List(ctx, ListOptions{SortBy: "-members"})
+	if byMembers.Items[0].Name != "Initech" || byMembers.Items[0].MemberCount != 3 {
+		t.Errorf("expected Initech first, got %+v", byMembers.Items[0])
+	}
+	if newest, err := mod.List(ctx, ListOptions{SortBy: "-created_at"}); err != nil || newest.Total != 4 {
+		t.Errorf("sorting by creation failed: %v", err)
+	}
+	if _, err := mod.List(ctx, ListOptions{SortBy: "id"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+}
+
+func TestModule_GetOrgsWithRole(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mod := New(WithStore(store))
+
+	globex, _ := mod.create(ctx, CreateInput{Name: "Globex"})
+	acme, _ := mod.create(ctx, CreateInput{Name: "Acme"})
+	initech, _ := mod.create(ctx, CreateInput{Name: "Initech"})
+	hooli, _ := mod.create(ctx, CreateInput{Name: "Hooli"})
+	mod.AddMember(ctx, globex.ID(), "ann", "admin")
+	mod.AddMember(ctx, acme.ID(), "ann", "member")
+	team, _ := mod.CreateTeam(ctx, acme.ID(), "Admins", "admin")
+	mod.AddTeamMember(ctx, team.ID, "ann")
+
+	// Expired memberships grant no role, directly or through a team
+	lapsedAdmin, _ := mod.addMemberUntil(ctx, hooli.ID(), "ann", "admin", time.Now().Add(time.Hour))
+	lapsedMember, _ := mod.addMemberUntil(ctx, initech.ID(), "ann", "member", time.Now().Add(time.Hour))
+	initechAdmins, _ := mod.CreateTeam(ctx, initech.ID(), "Admins", "admin")
+	mod.AddTeamMember(ctx, initechAdmins.ID, "ann")
+	past := time.Now().Add(-time.Minute)
+	for _, membership := range []*Membership{lapsedAdmin, lapsedMember} {
+		membership.ExpiresAt = &past
+		store.UpdateMembership(ctx, membership)
+	}
+
+	orgs, err := mod.GetOrgsWithRole(ctx, "ann", "admin")
+	if err != nil {
+		t.Fatalf("GetOrgsWithRole failed: %v", err)
+	}
+	if len(orgs) != 2 || orgs[0].Name != "Acme" || orgs[1].Name != "Globex" {
+		t.Errorf("expected Acme and Globex, got %+v", orgs)
+	}
+	if _, err := mod.GetOrgsWithRole(ctx, "ann", "boss"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+}
+
+func TestModule_Hierarchy(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mod := New(WithStore(store))
+
+	reseller, _ := mod.create(ctx, CreateInput{Name: "Reseller"})
+	result, err := mod.CreateChild(ctx, reseller.ID(), CreateInput{Name: "Globex"})
+	if err != nil {
+		t.Fatalf("CreateChild failed: %v", err)
+	}
+	globex := result.(*Org)
+	acme, _ := mod.createChild(ctx, reseller.ID(), CreateInput{Name: "Acme"})
+	labs, _ := mod.createChild(ctx, acme.ID(), CreateInput{Name: "Acme Labs"})
+	if _, err := mod.CreateChild(ctx, "missing", CreateInput{Name: "Orphan"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing parent, got %v", err)
+	}
+
+	fetched, _ := store.GetByID(ctx, labs.ID())
+	if fetched.ParentID != acme.ID() {
+		t.Errorf("expected the parent to be stored, got %q", fetched.ParentID)
+	}
+	children, _ := mod.Children(ctx, reseller.ID())
+	if len(children) != 2 || children[0].Name != "Acme" || children[1].Name != "Globex" {
+		t.Errorf("expected Acme and Globex, got %+v", children)
+	}
+	if ancestors := mod.AncestorIDs(ctx, labs.ID()); len(ancestors) != 2 || ancestors[0] != acme.ID() || ancestors[1] != reseller.ID() {
+		t.Errorf("expected Acme then Reseller, got %v", ancestors)
+	}
+	if ancestors := mod.AncestorIDs(ctx, reseller.ID()); len(ancestors) != 0 {
+		t.Errorf("expected no ancestors for a top-level org, got %v", ancestors)
+	}
+	descendants, _ := mod.DescendantIDs(ctx, reseller.ID())
+	if len(descendants) != 3 || descendants[0] != acme.ID() || descendants[1] != globex.ID() || descendants[2] != labs.ID() {
+		t.Errorf("expected Acme, Globex, Acme Labs, got %v", descendants)
+	}
+
+	mod.AddMember(ctx, reseller.ID(), "ann", "owner")
+	mod.AddMember(ctx, acme.ID(), "bob", "owner")
+	mod.AddMember(ctx, labs.ID(), "cid", "member")
+	mod.AddMember(ctx, globex.ID(), "ann", "admin")
+	page, err := mod.ListRollupMembers(ctx, reseller.ID(), pagination.Request{Limit: 3})
+	if err != nil {
+		t.Fatalf("ListRollupMembers failed: %v", err)
+	}
+	if page.Total != 4 || len(page.Items) != 3 || page.Items[0].UserID != "ann" || page.Items[1].UserID != "bob" || page.Items[2].OrgID != globex.ID() {
+		t.Errorf("unexpected roll-up page: %+v", page.Items)
+	}
+
+	if err := mod.Delete(ctx, acme.ID()); !errors.Is(err, ErrHasChildren) {
+		t.Errorf("expected ErrHasChildren, got %v", err)
+	}
+	if err := mod.Delete(ctx, labs.ID()); err != nil {
+		t.Errorf("deleting a leaf org failed: %v", err)
+	}
+	if err := mod.Delete(ctx, acme.ID()); err != nil {
+		t.Errorf("deleting an org without children failed: %v", err)
+	}
+
+	feed, _ := mod.Activity(ctx, reseller.ID(), pagination.Request{})
+	if feed.Total != 4 || feed.Items[len(feed.Items)-1].Type != ActivityOrgCreated || feed.Items[1].Type != ActivityChildCreated {
+		t.Errorf("expected the children's creation in the parent's feed, got %+v", feed.Items)
+	}
+}
+
+func TestModule_MembershipExpiry(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	inbox := emailtest.NewInbox()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	store, _ := setupTestStore(t)
+	mod := New(WithStore(store), WithExpiryWarning(time.Hour))
+	app := chassis.New(chassis.WithModules(events.New(), usersMod, email.New(email.WithProvider(inbox)), mod))
+	defer app.Shutdown(ctx)
+
+	var expiring, expired []*ExpiryEvent
+	app.Events().Subscribe(EventMembershipExpiring, func(ctx context.Context, eventType string, payload any) error {
+		expiring = append(expiring, payload.(*ExpiryEvent))
+		return nil
+	})
+	app.Events().Subscribe(EventMembershipExpired, func(ctx context.Context, eventType string, payload any) error {
+		expired = append(expired, payload.(*ExpiryEvent))
+		return nil
+	})
+
+	created, _ := usersMod.Create(ctx, "ann@example.com", "password123")
+	ann := created.(*users.User)
+	org, _ := mod.create(ctx, CreateInput{Name: "Acme"})
+	mod.AddMember(ctx, org.ID(), "olga", "owner")
+
+	if _, err := mod.AddMemberUntil(ctx, org.ID(), "bob", "owner", time.Now().Add(time.Hour)); !errors.Is(err, ErrExpiringOwner) {
+		t.Errorf("expected ErrExpiringOwner, got %v", err)
+	}
+	if _, err := mod.AddMemberUntil(ctx, org.ID(), "bob", "member", time.Now().Add(-time.Minute)); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("expected ErrInvalidExpiry, got %v", err)
+	}
+	if _, err := app.Orgs().AddMemberUntil(ctx, org.ID(), ann.ID, "admin", time.Now().Add(30*time.Minute)); err != nil {
+		t.Fatalf("AddMemberUntil failed: %v", err)
+	}
+	trial, _ := mod.addMemberUntil(ctx, org.ID(), "bob", "member", time.Now().Add(48*time.Hour))
+	if trial.ExpiresAt == nil || mod.GetUserRole(ctx, org.ID(), "bob") != "member" {
+		t.Fatalf("expected an active expiring membership, got %+v", trial)
+	}
+
+	// Ann expires within the warning period and is warned once
+	for range 2 {
+		if revoked, err := mod.ExpireMemberships(ctx); err != nil || revoked != 0 {
+			t.Fatalf("expected nothing revoked, got %d, %v", revoked, err)
+		}
+	}
+	if len(expiring) != 1 || expiring[0].UserID != ann.ID || expiring[0].Role != "admin" {
+		t.Errorf("expected one warning for Ann, got %+v", expiring)
+	}
+	emailtest.AssertSent(t, inbox, "ann@example.com", "Your admin membership of Acme expires")
+
+	// Bob's access ends before the sweep gets to it
+	past := time.Now().Add(-time.Minute)
+	trial.ExpiresAt = &past
+	store.UpdateMembership(ctx, trial)
+	if roles := mod.GetUserRoles(ctx, org.ID(), "bob"); roles != nil {
+		t.Errorf("expected no roles for an expired membership, got %v", roles)
+	}
+	if _, err := mod.GetMembership(ctx, org.ID(), "bob"); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("expected ErrMemberNotFound, got %v", err)
+	}
+	members, _ := mod.GetMembers(ctx, org.ID())
+	page, _ := mod.ListMembers(ctx, org.ID(), pagination.Request{})
+	if len(members.([]*Membership)) != 2 || page.Total != 2 || len(page.Items) != 2 {
+		t.Errorf("expected the expired membership left out, got %d and %d", len(members.([]*Membership)), page.Total)
+	}
+
+	if revoked, err := mod.ExpireMemberships(ctx); err != nil || revoked != 1 {
+		t.Fatalf("expected Bob revoked, got %d, %v", revoked, err)
+	}
+	if _, err := store.GetMembership(ctx, org.ID(), "bob"); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("expected the membership deleted, got %v", err)
+	}
+	if len(expired) != 1 || expired[0].UserID != "bob" {
+		t.Errorf("expected Bob's expiry event, got %+v", expired)
+	}
+
+	// Extending resets the warning; promoting to owner makes it permanent
+	membership, err := mod.SetMemberExpiry(ctx, org.ID(), ann.ID, time.Now().Add(20*time.Minute))
+	if err != nil || membership.ExpiryWarned {
+		t.Fatalf("SetMemberExpiry failed: %v, %+v", err, membership)
+	}
+	mod.UpdateMemberRole(ctx, org.ID(), ann.ID, "owner")
+	if remaining, _ := store.ListExpiringMemberships(ctx, time.Now().Add(time.Hour)); len(remaining) != 0 {
+		t.Errorf("expected no expiring memberships left, got %+v", remaining)
+	}
+}
+
+func TestModule_Deletion(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storageMod := storage.New(storage.WithBasePath(filepath.Join(dir, "files")))
+	store, _ := setupTestStore(t)
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(events.New(), storageMod, mod))
+	defer app.Shutdown(ctx)
+
+	var scheduled, restored, purged []*DeletionEvent
+	for eventType, received := range map[string]*[]*DeletionEvent{EventDeletionScheduled: &scheduled, EventOrgRestored: &restored, EventOrgPurged: &purged} {
+		app.Events().Subscribe(eventType, func(ctx context.Context, eventType string, payload any) error {
+			*received = append(*received, payload.(*DeletionEvent))
+			return nil
+		})
+	}
+
+	org, _ := mod.create(ctx, CreateInput{Name: "Acme"})
+	mod.AddMember(ctx, org.ID(), "ann", "owner")
+	mod.AddMember(ctx, org.ID(), "bob", "member")
+	storageMod.ForOrg(org.ID()).Put(ctx, "reports/q1.csv", []byte("revenue"))
+
+	if err := app.Orgs().Undelete(ctx, org.ID()); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("expected ErrNotDeleted, got %v", err)
+	}
+	if err := app.Orgs().Delete(ctx, org.ID()); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if len(scheduled) != 1 || len(scheduled[0].MemberIDs) != 2 || scheduled[0].PurgeAt.Sub(time.Now()) < DefaultDeletionGracePeriod-time.Minute {
+		t.Errorf("expected the deletion scheduled with both members, got %+v", scheduled)
+	}
+
+	// Hidden while scheduled
+	if _, err := mod.GetByID(ctx, org.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if roles := mod.GetUserRoles(ctx, org.ID(), "ann"); roles != nil {
+		t.Errorf("expected no roles in a deleted org, got %v", roles)
+	}
+	if memberships, _ := mod.GetUserOrgs(ctx, "bob"); len(memberships.([]*Membership)) != 0 {
+		t.Errorf("expected the deleted org left out, got %+v", memberships)
+	}
+	if err := mod.Delete(ctx, org.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	live, _ := mod.List(ctx, ListOptions{})
+	deleted, _ := mod.List(ctx, ListOptions{Deleted: true})
+	if live.Total != 0 || deleted.Total != 1 || deleted.Items[0].DeletedAt == nil {
+		t.Errorf("expected the org listed as deleted only, got %d live and %+v", live.Total, deleted.Items)
+	}
+	if purgedCount, err := mod.PurgeDeleted(ctx); err != nil || purgedCount != 0 {
+		t.Errorf("expected nothing purged within the grace period, got %d, %v", purgedCount, err)
+	}
+
+	if err := app.Orgs().Undelete(ctx, org.ID()); err != nil {
+		t.Fatalf("Undelete failed: %v", err)
+	}
+	if role := mod.GetUserRole(ctx, org.ID(), "ann"); role != "owner" || len(restored) != 1 {
+		t.Errorf("expected ann's ownership back, got %q and %d events", role, len(restored))
+	}
+
+	// Purged once the grace period is over
+	mod.Delete(ctx, org.ID())
+	WithDeletionGracePeriod(time.Millisecond)(mod)
+	time.Sleep(5 * time.Millisecond)
+	if purgedCount, err := mod.PurgeDeleted(ctx); err != nil || purgedCount != 1 {
+		t.Fatalf("expected the org purged, got %d, %v", purgedCount, err)
+	}
+	if _, err := store.GetByID(ctx, org.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the org gone, got %v", err)
+	}
+	if _, err := store.GetMembership(ctx, org.ID(), "ann"); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("expected the memberships gone, got %v", err)
+	}
+	if keys, _ := storageMod.ForOrg(org.ID()).List(ctx, ""); len(keys) != 0 {
+		t.Errorf("expected the org's files purged, got %v", keys)
+	}
+	if len(purged) != 1 || purged[0].Name != "Acme" {
+		t.Errorf("expected one purge event, got %+v", purged)
+	}
+	if err := mod.Undelete(ctx, org.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound undeleting a purged org, got %v", err)
+	}
+}
+
+func TestModule_TransferOwnership(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	mod := New(WithStore(store))
+
+	org, _ := mod.create(ctx, CreateInput{Name: "Org"})
+	mod.AddMember(ctx, org.ID(), "ann", "owner")
+	mod.AddMemberUntil(ctx, org.ID(), "bob", "member", time.Now().Add(time.Hour))
+
+	if err := mod.RemoveMember(ctx, org.ID(), "ann"); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("expected ErrLastOwner removing the last owner, got %v", err)
+	}
+	if _, err := mod.UpdateMemberRole(ctx, org.ID(), "ann", "admin"); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("expected ErrLastOwner demoting the last owner, got %v", err)
+	}
+	if _, err := mod.UpdateMemberRole(ctx, org.ID(), "ann", "owner"); err != nil {
+		t.Errorf("keeping the last owner an owner should work: %v", err)
+	}
+
+	if err := mod.TransferOwnership(ctx, org.ID(), "bob", "ann"); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("expected ErrNotOwner, got %v", err)
+	}
+	if err := mod.TransferOwnership(ctx, org.ID(), "ann", "stranger"); !errors.Is(err, ErrMemberNotFound) {
+		t.Errorf("expected ErrMemberNotFound, got %v", err)
+	}
+	if err := mod.TransferOwnership(ctx, org.ID(), "ann", "bob"); err != nil {
+		t.Fatalf("TransferOwnership failed: %v", err)
+	}
+	if bob, _ := store.GetMembership(ctx, org.ID(), "bob"); bob.Role != "owner" || bob.ExpiresAt != nil {
+		t.Errorf("expected bob to be a permanent owner, got %+v", bob)
+	}
+	if role := mod.GetUserRole(ctx, org.ID(), "ann"); role != "admin" {
+		t.Errorf("expected ann to be admin, got %q", role)
+	}
+
+	// With two owners either can go
+	mod.UpdateMemberRole(ctx, org.ID(), "ann", "owner")
+	if err := mod.RemoveMember(ctx, org.ID(), "ann"); err != nil {
+		t.Errorf("removing one of two owners should work: %v", err)
+	}
+}
+
+// readBundle returns the files of a zip bundle by name.
+func readBundle(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	bundle, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip bundle: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range bundle.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		files[file.Name], _ = io.ReadAll(reader)
+		_ = reader.Close()
+	}
+	return files
+}
+
+func TestModule_Export(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storageMod := storage.New(storage.WithBasePath(filepath.Join(dir, "files")), storage.WithURLSigning([]byte("secret"), "/files/"))
+	queueMod := queue.New(queue.WithStore(queue.NewMemoryStore()))
+	mod := New(WithDBPath(filepath.Join(dir, "orgs.db")), WithExportURLTTL(time.Hour))
+	app := chassis.New(chassis.WithModules(events.New(), storageMod, queueMod, mod))
+	defer app.Shutdown(ctx)
+
+	org, _ := mod.create(ctx, CreateInput{Name: "Acme"})
+	other, _ := mod.create(ctx, CreateInput{Name: "Other"})
+	mod.AddMember(ctx, org.ID(), "ann", "owner")
+	team, _ := mod.CreateTeam(ctx, org.ID(), "Billing", "admin")
+	mod.AddTeamMember(ctx, team.ID, "ann")
+	mod.Invite(ctx, org.ID(), "bob@example.com", "member")
+	storageMod.ForOrg(org.ID()).Put(ctx, "reports/q1.csv", []byte("a,b\n"))
+	storageMod.ForOrg(other.ID()).Put(ctx, "secret.txt", []byte("not yours"))
+
+	var buf bytes.Buffer
+	if err := app.Orgs().Export(ctx, org.ID(), &buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+	if string(files["storage/files/reports/q1.csv"]) != "a,b\n" || len(files["storage/files/secret.txt"]) != 0 {
+		t.Errorf("expected only the org's storage objects, got %v", slices.Sorted(maps.Keys(files)))
+	}
+	var manifest struct {
+		OrgID   string   `json:"org_id"`
+		Modules []string `json:"modules"`
+		Files   []string `json:"files"`
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil || manifest.OrgID != org.ID() ||
+		!slices.Equal(manifest.Modules, []string{"orgs", "queue", "storage"}) || len(manifest.Files) != len(files)-1 {
+		t.Errorf("unexpected manifest %+v (%v)", manifest, err)
+	}
+	var teams []struct {
+		Name    string   `json:"name"`
+		Members []string `json:"members"`
+	}
+	json.Unmarshal(files["orgs/teams.json"], &teams)
+	if len(teams) != 1 || teams[0].Name != "Billing" || !slices.Equal(teams[0].Members, []string{"ann"}) {
+		t.Errorf("unexpected teams %s", files["orgs/teams.json"])
+	}
+	if !bytes.Contains(files["orgs/members.json"], []byte(`"user_id": "ann"`)) ||
+		!bytes.Contains(files["orgs/invitations.json"], []byte("bob@example.com")) || bytes.Contains(files["orgs/invitations.json"], []byte("token")) {
+		t.Errorf("unexpected members or invitations: %s %s", files["orgs/members.json"], files["orgs/invitations.json"])
+	}
+	if err := mod.Export(ctx, "missing", io.Discard); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	completed := make(chan *ExportEvent, 1)
+	app.Events().Subscribe(EventExportCompleted, func(ctx context.Context, eventType string, payload any) error {
+		completed <- payload.(*ExportEvent)
+		return nil
+	})
+	export, err := mod.StartExport(ctx, org.ID(), "ann")
+	if err != nil || export.Status != ExportPending {
+		t.Fatalf("StartExport failed: %v, %+v", err, export)
+	}
+	workerCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go queueMod.Worker(workerCtx, nil)
+
+	var event *ExportEvent
+	select {
+	case event = <-completed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the export")
+	}
+	export, _ = mod.GetExport(ctx, export.ID)
+	if export.Status != ExportCompleted || export.Progress != 100 || export.CompletedAt == nil ||
+		export.URL == "" || event.URL != export.URL || event.RequestedBy != "ann" {
+		t.Fatalf("unexpected export %+v, event %+v", export, event)
+	}
+	if !strings.HasPrefix(export.URL, "/files/"+export.Key+"?") || export.Key != ExportPrefix+org.ID()+"/"+export.ID+".zip" {
+		t.Errorf("expected a signed link to the stored bundle, got %q for %q", export.URL, export.Key)
+	}
+	stored, err := storageMod.Get(ctx, export.Key)
+	if err != nil {
+		t.Fatalf("expected the bundle in storage: %v", err)
+	}
+	if files := readBundle(t, stored); files["orgs/org.json"] == nil || files["storage/files/reports/q1.csv"] == nil {
+		t.Errorf("unexpected stored bundle %v", slices.Sorted(maps.Keys(files)))
+	}
+	if exports, _ := mod.ListExports(ctx, org.ID()); len(exports) != 1 || exports[0].ID != export.ID {
+		t.Errorf("expected the export to be listed, got %v", exports)
+	}
+
+	if _, err := New().StartExport(ctx, org.ID(), ""); !errors.Is(err, ErrExportUnavailable) {
+		t.Errorf("expected ErrExportUnavailable without the queue, got %v", err)
+	}
+}
+
+func TestModule_Activity(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	storageMod := storage.New(storage.WithBasePath(filepath.Join(dir, "files")))
+	mod := New(WithDBPath(filepath.Join(dir, "orgs.db")))
+	app := chassis.New(chassis.WithModules(events.New(), usersMod, auth.New(auth.WithDBPath(filepath.Join(dir, "sessions.db"))), storageMod, mod))
+	defer app.Shutdown(ctx)
+
+	created, _ := usersMod.Create(ctx, "ann@example.com", "password123")
+	ann := created.(*users.User)
+	asAnn := auth.WithSession(ctx, &auth.Session{UserID: ann.ID})
+
+	org, _ := mod.create(asAnn, CreateInput{Name: "Acme"})
+	mod.AddMember(asAnn, org.ID(), ann.ID, "owner")
+	mod.AddMember(asAnn, org.ID(), "bob", "member")
+	mod.UpdateMemberRole(asAnn, org.ID(), "bob", "admin")
+	name := "Acme Inc"
+	mod.update(asAnn, org.ID(), UpdateInput{Name: &name})
+	if _, err := storageMod.Uploads().Upload(chassis.WithTenant(asAnn, org.ID()), "notes.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if err := mod.RecordActivity(ctx, &Activity{OrgID: org.ID(), Type: "plan_upgraded", Details: map[string]string{"plan": "pro"}}); err != nil {
+		t.Fatalf("RecordActivity failed: %v", err)
+	}
+
+	page, err := mod.Activity(ctx, org.ID(), pagination.Request{Limit: 3})
+	if err != nil {
+		t.Fatalf("Activity failed: %v", err)
+	}
+	if page.Total != 7 || !page.HasMore || len(page.Items) != 3 {
+		t.Fatalf("expected 3 of 7 entries, got %d of %d", len(page.Items), page.Total)
+	}
+	var types []string
+	for _, entry := range page.Items {
+		types = append(types, entry.Type)
+	}
+	if !slices.Equal(types, []string{"plan_upgraded", ActivityFileUploaded, ActivitySettingsUpdated}) {
+		t.Errorf("expected the newest entries first, got %v", types)
+	}
+	if page.Items[0].Actor != nil {
+		t.Errorf("expected no actor without a session, got %+v", page.Items[0].Actor)
+	}
+	upload := page.Items[1]
+	if upload.Actor == nil || upload.Actor.Email != "ann@example.com" || upload.Details["name"] != "notes.txt" {
+		t.Errorf("expected ann's upload, got %+v %+v", upload, upload.Actor)
+	}
+
+	page, _ = mod.Activity(ctx, org.ID(), pagination.Request{Cursor: page.NextCursor, Limit: 3})
+	changed := page.Items[0]
+	if changed.Type != ActivityRoleChanged || changed.Details["previous_role"] != "member" || changed.User == nil || changed.User.ID != "bob" || changed.Actor.ID != ann.ID {
+		t.Errorf("expected bob's role change by ann, got %+v", changed)
+	}
+
+	if _, err := mod.Activity(ctx, "missing", pagination.Request{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	WithDeletionGracePeriod(0)(mod)
+	mod.Delete(ctx, org.ID())
+	if count, _ := mod.activity.CountActivity(ctx, org.ID()); count != 0 {
+		t.Errorf("expected the activity deleted with the org, got %d entries", count)
+	}
+}
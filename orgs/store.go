@@ -3,12 +3,13 @@ package orgs
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/internal/sqlite"
 )
 
 // Store defines the interface for organization persistence.
@@ -16,42 +17,78 @@ type Store interface {
 	Create(ctx context.Context, org *Org) error
 	GetByID(ctx context.Context, id string) (*Org, error)
 	GetByName(ctx context.Context, name string) (*Org, error)
-	Update(ctx context.Context, org *Org) error
+	Update(ctx context.Context, org *Org) error // name, DeletedAt and UpdatedAt
 	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, opts ListOptions, offset, limit int) ([]*OrgSummary, error) // filtered by Query and Deleted, ordered by SortBy
+	Count(ctx context.Context, opts ListOptions) (int, error)
+	GetOrgsWithRole(ctx context.Context, userID, role string) ([]*Org, error)
+	ListChildren(ctx context.Context, parentID string) ([]*Org, error)     // ordered by name
+	ListDeletedOrgs(ctx context.Context, before time.Time) ([]*Org, error) // deletion scheduled by then, oldest first
 
 	CreateMembership(ctx context.Context, membership *Membership) error
 	GetMembership(ctx context.Context, orgID, userID string) (*Membership, error)
 	GetMembersByOrgID(ctx context.Context, orgID string) ([]*Membership, error)
+	ListMembersByOrgID(ctx context.Context, orgID string, offset, limit int) ([]*Membership, error) // unexpired, oldest first
+	CountMembersByOrgID(ctx context.Context, orgID string) (int, error)                             // unexpired
+	CountMembersWithRole(ctx context.Context, orgID, role string) (int, error)
 	GetMembershipsByUserID(ctx context.Context, userID string) ([]*Membership, error)
-	UpdateMembership(ctx context.Context, membership *Membership) error
+	UpdateMembership(ctx context.Context, membership *Membership) error                   // role, expiry and UpdatedAt
+	ListExpiringMemberships(ctx context.Context, before time.Time) ([]*Membership, error) // expiring by then, soonest first
 	DeleteMembership(ctx context.Context, orgID, userID string) error
 	DeleteMembershipsByOrgID(ctx context.Context, orgID string) error
+	TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID string, now time.Time) error // to permanent owner, from admin, atomically
+
+	CreateInvitation(ctx context.Context, invitation *Invitation, tokenHash string) error
+	GetInvitationByToken(ctx context.Context, tokenHash string) (*Invitation, error)
+	ListInvitationsByOrgID(ctx context.Context, orgID string) ([]*Invitation, error)
+	ListInvitationsByEmail(ctx context.Context, email string) ([]*Invitation, error)
+	DeleteInvitation(ctx context.Context, id string) error
+	DeleteInvitationByEmail(ctx context.Context, orgID, email string) error
+	DeleteInvitationsByOrgID(ctx context.Context, orgID string) error
+
+	CreateTeam(ctx context.Context, team *Team) error
+	GetTeam(ctx context.Context, id string) (*Team, error)
+	ListTeamsByOrgID(ctx context.Context, orgID string) ([]*Team, error)
+	UpdateTeam(ctx context.Context, team *Team) error
+	DeleteTeam(ctx context.Context, id string) error // with its members
+	DeleteTeamsByOrgID(ctx context.Context, orgID string) error
+	CreateTeamMember(ctx context.Context, member *TeamMember) error
+	ListTeamMembers(ctx context.Context, teamID string) ([]*TeamMember, error)
+	GetTeamsByUserID(ctx context.Context, orgID, userID string) ([]*Team, error)
+	DeleteTeamMember(ctx context.Context, teamID, userID string) error
+	DeleteTeamMembershipsByUserID(ctx context.Context, orgID, userID string) error
 
 	Close() error
 }
 
 // SQLiteStore implements Store using SQLite.
 type SQLiteStore struct {
-	db *sql.DB
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
 }
 
 // NewSQLiteStore creates a new SQLite-backed organization store.
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	store, err := NewSQLiteStoreFromDB(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		_ = db.Close()
+		return nil, err
 	}
+	store.owned = true
+	return store, nil
+}
 
+// NewSQLiteStoreFromDB creates an organization store on a database the caller
+// owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
 	if err := initOrgSchema(db); err != nil {
-		_ = db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
-
 	return &SQLiteStore{db: db}, nil
 }
 
@@ -75,50 +112,190 @@ func initOrgSchema(db *sql.DB) error {
 		);
 		CREATE INDEX IF NOT EXISTS idx_memberships_org_id ON memberships(org_id);
 		CREATE INDEX IF NOT EXISTS idx_memberships_user_id ON memberships(user_id);
+
+		CREATE TABLE IF NOT EXISTS invitations (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			role TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			UNIQUE(org_id, email)
+		);
+
+		CREATE TABLE IF NOT EXISTS teams (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			UNIQUE(org_id, name)
+		);
+
+		CREATE TABLE IF NOT EXISTS team_members (
+			team_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY(team_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_team_members_user_id ON team_members(user_id);
+
+		CREATE TABLE IF NOT EXISTS org_exports (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			requested_by TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			progress INTEGER NOT NULL DEFAULT 0,
+			storage_key TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			completed_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_org_exports_org_id ON org_exports(org_id);
+
+		CREATE TABLE IF NOT EXISTS org_activity (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			actor_id TEXT NOT NULL DEFAULT '',
+			user_id TEXT NOT NULL DEFAULT '',
+			details TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME NOT NULL,
+			created_ms INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_org_activity_org_id ON org_activity(org_id, created_ms);
 	`
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := addCreatedMs(db); err != nil {
+		return err
+	}
+	// Columns added since the tables were first released; existing
+	// organizations stay top-level and live, and existing memberships
+	// permanent
+	for _, column := range []struct{ table, name, definition string }{
+		{"orgs", "parent_id", `TEXT NOT NULL DEFAULT ''`},
+		{"orgs", "deleted_ms", `INTEGER`},
+		{"memberships", "expires_ms", `INTEGER`},
+		{"memberships", "expiry_warned", `INTEGER NOT NULL DEFAULT 0`},
+	} {
+		if err := addColumn(db, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_orgs_parent_id ON orgs(parent_id);
+		CREATE INDEX IF NOT EXISTS idx_orgs_deleted_ms ON orgs(deleted_ms) WHERE deleted_ms IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_memberships_expires_ms ON memberships(expires_ms) WHERE expires_ms IS NOT NULL;
+	`)
 	return err
 }
 
+// addColumn adds a column to a table created before it existed.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// addCreatedMs adds created_ms, created_at as Unix milliseconds so
+// listings can sort by it whatever time zone rows were written in, to orgs
+// tables created before it existed.
+func addCreatedMs(db *sql.DB) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('orgs') WHERE name = 'created_ms'`).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	if _, err := db.Exec(`ALTER TABLE orgs ADD COLUMN created_ms INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT id, created_at FROM orgs`)
+	if err != nil {
+		return err
+	}
+	created := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		created[id] = createdAt
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, createdAt := range created {
+		if _, err := db.Exec(`UPDATE orgs SET created_ms = ? WHERE id = ?`, createdAt.UnixMilli(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orgColumns are scanned by scanOrg. deleted_ms is when the deletion was
+// scheduled, as Unix milliseconds, and NULL for a live organization.
+const orgColumns = `id, name, parent_id, created_at, updated_at, deleted_ms`
+
 func (store *SQLiteStore) Create(ctx context.Context, org *Org) error {
-	query := `INSERT INTO orgs (id, name, created_at, updated_at) VALUES (?, ?, ?, ?)`
-	_, err := store.db.ExecContext(ctx, query, org.id, org.Name, org.CreatedAt, org.UpdatedAt)
+	query := `INSERT INTO orgs (` + orgColumns + `, created_ms) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, org.id, org.Name, org.ParentID, org.CreatedAt, org.UpdatedAt,
+		unixMs(org.DeletedAt), org.CreatedAt.UnixMilli())
 	return err
 }
 
-func (store *SQLiteStore) GetByID(ctx context.Context, id string) (*Org, error) {
-	query := `SELECT id, name, created_at, updated_at FROM orgs WHERE id = ?`
-	row := store.db.QueryRowContext(ctx, query, id)
+// scanOrg scans a row of orgColumns followed by extra.
+func scanOrg(row interface{ Scan(dest ...any) error }, extra ...any) (*Org, error) {
+	org := &Org{}
+	var deleted sql.NullInt64
+	err := row.Scan(append([]any{&org.id, &org.Name, &org.ParentID, &org.CreatedAt, &org.UpdatedAt, &deleted}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	org.DeletedAt = fromUnixMs(deleted)
+	return org, nil
+}
 
-	var org Org
-	err := row.Scan(&org.id, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+func (store *SQLiteStore) GetByID(ctx context.Context, id string) (*Org, error) {
+	query := `SELECT ` + orgColumns + ` FROM orgs WHERE id = ?`
+	org, err := scanOrg(sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return &org, nil
+	return org, nil
 }
 
 func (store *SQLiteStore) GetByName(ctx context.Context, name string) (*Org, error) {
-	query := `SELECT id, name, created_at, updated_at FROM orgs WHERE name = ?`
-	row := store.db.QueryRowContext(ctx, query, name)
-
-	var org Org
-	err := row.Scan(&org.id, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	query := `SELECT ` + orgColumns + ` FROM orgs WHERE name = ?`
+	org, err := scanOrg(sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, name))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return &org, nil
+	return org, nil
 }
 
 func (store *SQLiteStore) Update(ctx context.Context, org *Org) error {
-	query := `UPDATE orgs SET name = ?, updated_at = ? WHERE id = ?`
-	result, err := store.db.ExecContext(ctx, query, org.Name, org.UpdatedAt, org.id)
+	query := `UPDATE orgs SET name = ?, updated_at = ?, deleted_ms = ? WHERE id = ?`
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, org.Name, org.UpdatedAt, unixMs(org.DeletedAt), org.id)
 	if err != nil {
 		return err
 	}
@@ -134,7 +311,7 @@ func (store *SQLiteStore) Update(ctx context.Context, org *Org) error {
 
 func (store *SQLiteStore) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM orgs WHERE id = ?`
-	result, err := store.db.ExecContext(ctx, query, id)
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -148,39 +325,187 @@ func (store *SQLiteStore) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+// List returns the organizations matching opts with their member counts.
+func (store *SQLiteStore) List(ctx context.Context, opts ListOptions, offset, limit int) ([]*OrgSummary, error) {
+	where, args := orgFilter(opts)
+	order, ok := orgSort.OrderBy(opts.SortBy)
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	query := `SELECT ` + orgColumns + `,
+			(SELECT COUNT(*) FROM memberships WHERE memberships.org_id = orgs.id AND ` + unexpired + `) AS member_count
+		FROM orgs` + where + ` ORDER BY ` + order + ` LIMIT ? OFFSET ?`
+	args = append([]any{time.Now().UnixMilli()}, args...)
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	summaries := make([]*OrgSummary, 0)
+	for rows.Next() {
+		summary := &OrgSummary{}
+		org, err := scanOrg(rows, &summary.MemberCount)
+		if err != nil {
+			return nil, err
+		}
+		summary.Org = org
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// Count returns the number of organizations matching opts.
+func (store *SQLiteStore) Count(ctx context.Context, opts ListOptions) (int, error) {
+	where, args := orgFilter(opts)
+	var count int
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM orgs`+where, args...).Scan(&count)
+	return count, err
+}
+
+// orgFilter returns the WHERE clause for the filters in opts.
+func orgFilter(opts ListOptions) (string, []any) {
+	var filter db.Filter
+	filter.Search(opts.Query, "orgs.name")
+	if opts.Deleted {
+		filter.Where("orgs.deleted_ms IS NOT NULL")
+	} else {
+		filter.Where("orgs.deleted_ms IS NULL")
+	}
+	return filter.Clause()
+}
+
+// orgSort maps ListOptions.SortBy to columns, by name by default.
+var orgSort = db.Sort{
+	Columns:  map[string]string{"name": "orgs.name", "created_at": "orgs.created_ms", "members": "member_count"},
+	Default:  "name",
+	Tiebreak: "orgs.id",
+}
+
+// GetOrgsWithRole returns the live organizations in which userID holds
+// role through their membership or a team.
+func (store *SQLiteStore) GetOrgsWithRole(ctx context.Context, userID, role string) ([]*Org, error) {
+	query := `SELECT ` + orgColumns + ` FROM orgs WHERE deleted_ms IS NULL AND id IN (
+			SELECT org_id FROM memberships WHERE user_id = ? AND role = ? AND ` + unexpired + `
+			UNION
+			SELECT teams.org_id FROM teams
+			JOIN team_members ON team_members.team_id = teams.id
+			JOIN memberships ON memberships.org_id = teams.org_id AND memberships.user_id = team_members.user_id
+			WHERE team_members.user_id = ? AND teams.role = ? AND ` + unexpired + `
+		) ORDER BY name, id`
+	now := time.Now().UnixMilli()
+	return store.queryOrgs(ctx, query, userID, role, now, userID, role, now)
+}
+
+// ListChildren returns the organizations whose parent is parentID.
+func (store *SQLiteStore) ListChildren(ctx context.Context, parentID string) ([]*Org, error) {
+	return store.queryOrgs(ctx, `SELECT `+orgColumns+` FROM orgs WHERE parent_id = ? ORDER BY name, id`, parentID)
+}
+
+// ListDeletedOrgs returns the organizations whose deletion was scheduled
+// before the given time.
+func (store *SQLiteStore) ListDeletedOrgs(ctx context.Context, before time.Time) ([]*Org, error) {
+	query := `SELECT ` + orgColumns + ` FROM orgs WHERE deleted_ms IS NOT NULL AND deleted_ms <= ? ORDER BY deleted_ms, id`
+	return store.queryOrgs(ctx, query, before.UnixMilli())
+}
+
+func (store *SQLiteStore) queryOrgs(ctx context.Context, query string, args ...any) ([]*Org, error) {
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	orgs := make([]*Org, 0)
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// membershipColumns are scanned by scanMembership. expires_ms is the
+// expiry as Unix milliseconds, comparable whatever time zone it was
+// written in.
+const membershipColumns = `id, org_id, user_id, role, created_at, updated_at, expires_ms, expiry_warned`
+
 func (store *SQLiteStore) CreateMembership(ctx context.Context, membership *Membership) error {
-	query := `INSERT INTO memberships (id, org_id, user_id, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err := store.db.ExecContext(ctx, query, membership.ID, membership.OrgID, membership.UserID, membership.Role, membership.CreatedAt, membership.UpdatedAt)
+	query := `INSERT INTO memberships (` + membershipColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, membership.ID, membership.OrgID, membership.UserID, membership.Role,
+		membership.CreatedAt, membership.UpdatedAt, unixMs(membership.ExpiresAt), membership.ExpiryWarned)
 	return err
 }
 
-func (store *SQLiteStore) GetMembership(ctx context.Context, orgID, userID string) (*Membership, error) {
-	query := `SELECT id, org_id, user_id, role, created_at, updated_at FROM memberships WHERE org_id = ? AND user_id = ?`
-	row := store.db.QueryRowContext(ctx, query, orgID, userID)
+// unixMs is the value of a nullable millisecond column, such as
+// expires_ms, for an optional time.
+func unixMs(at *time.Time) sql.NullInt64 {
+	if at == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: at.UnixMilli(), Valid: true}
+}
+
+// fromUnixMs is the optional time of a nullable millisecond column.
+func fromUnixMs(ms sql.NullInt64) *time.Time {
+	if !ms.Valid {
+		return nil
+	}
+	at := time.UnixMilli(ms.Int64)
+	return &at
+}
+
+// scanMembership scans a row of membershipColumns.
+func scanMembership(row interface{ Scan(dest ...any) error }) (*Membership, error) {
+	membership := &Membership{}
+	var expires sql.NullInt64
+	err := row.Scan(&membership.ID, &membership.OrgID, &membership.UserID, &membership.Role,
+		&membership.CreatedAt, &membership.UpdatedAt, &expires, &membership.ExpiryWarned)
+	if err != nil {
+		return nil, err
+	}
+	membership.ExpiresAt = fromUnixMs(expires)
+	return membership, nil
+}
 
-	var membership Membership
-	err := row.Scan(&membership.ID, &membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt, &membership.UpdatedAt)
+func (store *SQLiteStore) GetMembership(ctx context.Context, orgID, userID string) (*Membership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM memberships WHERE org_id = ? AND user_id = ?`
+	membership, err := scanMembership(sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, orgID, userID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrMemberNotFound
 		}
 		return nil, err
 	}
-	return &membership, nil
+	return membership, nil
 }
 
 func (store *SQLiteStore) GetMembersByOrgID(ctx context.Context, orgID string) ([]*Membership, error) {
-	query := `SELECT id, org_id, user_id, role, created_at, updated_at FROM memberships WHERE org_id = ?`
-	rows, err := store.db.QueryContext(ctx, query, orgID)
+	return store.queryMemberships(ctx, `SELECT `+membershipColumns+` FROM memberships WHERE org_id = ?`, orgID)
+}
+
+// unexpired is the condition on memberships not expired at a time, in
+// Unix milliseconds.
+const unexpired = `(expires_ms IS NULL OR expires_ms > ?)`
+
+func (store *SQLiteStore) ListMembersByOrgID(ctx context.Context, orgID string, offset, limit int) ([]*Membership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM memberships
+		WHERE org_id = ? AND ` + unexpired + ` ORDER BY created_at, id LIMIT ? OFFSET ?`
+	return store.queryMemberships(ctx, query, orgID, time.Now().UnixMilli(), limit, offset)
+}
+
+func (store *SQLiteStore) queryMemberships(ctx context.Context, query string, args ...any) ([]*Membership, error) {
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
-	var memberships []*Membership
+	memberships := make([]*Membership, 0)
 	for rows.Next() {
-		membership := &Membership{}
-		err := rows.Scan(&membership.ID, &membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt, &membership.UpdatedAt)
+		membership, err := scanMembership(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -189,29 +514,68 @@ func (store *SQLiteStore) GetMembersByOrgID(ctx context.Context, orgID string) (
 	return memberships, rows.Err()
 }
 
-func (store *SQLiteStore) GetMembershipsByUserID(ctx context.Context, userID string) ([]*Membership, error) {
-	query := `SELECT id, org_id, user_id, role, created_at, updated_at FROM memberships WHERE user_id = ?`
-	rows, err := store.db.QueryContext(ctx, query, userID)
+func (store *SQLiteStore) CountMembersByOrgID(ctx context.Context, orgID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM memberships WHERE org_id = ? AND ` + unexpired
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, orgID, time.Now().UnixMilli()).Scan(&count)
+	return count, err
+}
+
+func (store *SQLiteStore) CountMembersWithRole(ctx context.Context, orgID, role string) (int, error) {
+	var count int
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM memberships WHERE org_id = ? AND role = ?`, orgID, role).Scan(&count)
+	return count, err
+}
+
+func (store *SQLiteStore) TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID string, now time.Time) error {
+	tx, err := sqlite.Begin(ctx, store.db)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() { _ = rows.Close() }()
+	defer func() { _ = tx.Rollback() }()
 
-	var memberships []*Membership
-	for rows.Next() {
-		membership := &Membership{}
-		err := rows.Scan(&membership.ID, &membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt, &membership.UpdatedAt)
+	// The new owner's membership becomes permanent; an owner can't expire
+	changes := []struct{ query, userID string }{
+		{`UPDATE memberships SET role = 'owner', updated_at = ?, expires_ms = NULL, expiry_warned = 0 WHERE org_id = ? AND user_id = ?`, toUserID},
+		{`UPDATE memberships SET role = 'admin', updated_at = ? WHERE org_id = ? AND user_id = ?`, fromUserID},
+	}
+	for _, change := range changes {
+		result, err := tx.ExecContext(ctx, change.query, now, orgID, change.userID)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrMemberNotFound
 		}
-		memberships = append(memberships, membership)
 	}
-	return memberships, rows.Err()
+	return tx.Commit()
+}
+
+func (store *SQLiteStore) GetMembershipsByUserID(ctx context.Context, userID string) ([]*Membership, error) {
+	return store.queryMemberships(ctx, `SELECT `+membershipColumns+` FROM memberships WHERE user_id = ?`, userID)
+}
+
+// ListMemberships returns every membership. Used by the consistency checker.
+func (store *SQLiteStore) ListMemberships(ctx context.Context) ([]*Membership, error) {
+	return store.queryMemberships(ctx, `SELECT `+membershipColumns+` FROM memberships ORDER BY created_at`)
+}
+
+// ListExpiringMemberships returns the memberships expiring by before,
+// including those already expired.
+func (store *SQLiteStore) ListExpiringMemberships(ctx context.Context, before time.Time) ([]*Membership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM memberships
+		WHERE expires_ms IS NOT NULL AND expires_ms <= ? ORDER BY expires_ms, id`
+	return store.queryMemberships(ctx, query, before.UnixMilli())
 }
 
 func (store *SQLiteStore) UpdateMembership(ctx context.Context, membership *Membership) error {
-	query := `UPDATE memberships SET role = ?, updated_at = ? WHERE id = ?`
-	result, err := store.db.ExecContext(ctx, query, membership.Role, membership.UpdatedAt, membership.ID)
+	query := `UPDATE memberships SET role = ?, updated_at = ?, expires_ms = ?, expiry_warned = ? WHERE id = ?`
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, membership.Role, membership.UpdatedAt,
+		unixMs(membership.ExpiresAt), membership.ExpiryWarned, membership.ID)
 	if err != nil {
 		return err
 	}
@@ -227,7 +591,7 @@ func (store *SQLiteStore) UpdateMembership(ctx context.Context, membership *Memb
 
 func (store *SQLiteStore) DeleteMembership(ctx context.Context, orgID, userID string) error {
 	query := `DELETE FROM memberships WHERE org_id = ? AND user_id = ?`
-	result, err := store.db.ExecContext(ctx, query, orgID, userID)
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, orgID, userID)
 	if err != nil {
 		return err
 	}
@@ -243,10 +607,359 @@ func (store *SQLiteStore) DeleteMembership(ctx context.Context, orgID, userID st
 
 func (store *SQLiteStore) DeleteMembershipsByOrgID(ctx context.Context, orgID string) error {
 	query := `DELETE FROM memberships WHERE org_id = ?`
-	_, err := store.db.ExecContext(ctx, query, orgID)
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, orgID)
+	return err
+}
+
+func (store *SQLiteStore) CreateInvitation(ctx context.Context, invitation *Invitation, tokenHash string) error {
+	query := `INSERT INTO invitations (id, org_id, email, role, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, invitation.ID, invitation.OrgID, invitation.Email, invitation.Role, tokenHash, invitation.CreatedAt, invitation.ExpiresAt)
+	return err
+}
+
+func (store *SQLiteStore) GetInvitationByToken(ctx context.Context, tokenHash string) (*Invitation, error) {
+	query := `SELECT id, org_id, email, role, created_at, expires_at FROM invitations WHERE token_hash = ?`
+	row := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, tokenHash)
+
+	var invitation Invitation
+	err := row.Scan(&invitation.ID, &invitation.OrgID, &invitation.Email, &invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (store *SQLiteStore) ListInvitationsByOrgID(ctx context.Context, orgID string) ([]*Invitation, error) {
+	query := `SELECT id, org_id, email, role, created_at, expires_at FROM invitations WHERE org_id = ? ORDER BY created_at, id`
+	return store.queryInvitations(ctx, query, orgID)
+}
+
+func (store *SQLiteStore) ListInvitationsByEmail(ctx context.Context, email string) ([]*Invitation, error) {
+	query := `SELECT id, org_id, email, role, created_at, expires_at FROM invitations WHERE email = ? ORDER BY created_at, id`
+	return store.queryInvitations(ctx, query, email)
+}
+
+func (store *SQLiteStore) queryInvitations(ctx context.Context, query string, args ...any) ([]*Invitation, error) {
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	invitations := make([]*Invitation, 0)
+	for rows.Next() {
+		invitation := &Invitation{}
+		err := rows.Scan(&invitation.ID, &invitation.OrgID, &invitation.Email, &invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+func (store *SQLiteStore) DeleteInvitation(ctx context.Context, id string) error {
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM invitations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) DeleteInvitationByEmail(ctx context.Context, orgID, email string) error {
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM invitations WHERE org_id = ? AND email = ?`, orgID, email)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) DeleteInvitationsByOrgID(ctx context.Context, orgID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM invitations WHERE org_id = ?`, orgID)
+	return err
+}
+
+const teamColumns = `id, org_id, name, role, created_at, updated_at`
+
+func (store *SQLiteStore) CreateTeam(ctx context.Context, team *Team) error {
+	query := `INSERT INTO teams (` + teamColumns + `) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, team.ID, team.OrgID, team.Name, team.Role, team.CreatedAt, team.UpdatedAt)
+	return err
+}
+
+func (store *SQLiteStore) GetTeam(ctx context.Context, id string) (*Team, error) {
+	row := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, `SELECT `+teamColumns+` FROM teams WHERE id = ?`, id)
+
+	var team Team
+	err := row.Scan(&team.ID, &team.OrgID, &team.Name, &team.Role, &team.CreatedAt, &team.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (store *SQLiteStore) ListTeamsByOrgID(ctx context.Context, orgID string) ([]*Team, error) {
+	return store.queryTeams(ctx, `SELECT `+teamColumns+` FROM teams WHERE org_id = ? ORDER BY name`, orgID)
+}
+
+func (store *SQLiteStore) GetTeamsByUserID(ctx context.Context, orgID, userID string) ([]*Team, error) {
+	query := `SELECT id, org_id, name, role, teams.created_at, updated_at FROM teams
+		JOIN team_members ON team_members.team_id = teams.id
+		WHERE teams.org_id = ? AND team_members.user_id = ? ORDER BY name`
+	return store.queryTeams(ctx, query, orgID, userID)
+}
+
+func (store *SQLiteStore) queryTeams(ctx context.Context, query string, args ...any) ([]*Team, error) {
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	teams := make([]*Team, 0)
+	for rows.Next() {
+		team := &Team{}
+		if err := rows.Scan(&team.ID, &team.OrgID, &team.Name, &team.Role, &team.CreatedAt, &team.UpdatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+func (store *SQLiteStore) UpdateTeam(ctx context.Context, team *Team) error {
+	query := `UPDATE teams SET name = ?, role = ?, updated_at = ? WHERE id = ?`
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, team.Name, team.Role, team.UpdatedAt, team.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) DeleteTeam(ctx context.Context, id string) error {
+	tx, err := sqlite.Begin(ctx, store.db)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM team_members WHERE team_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM teams WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTeamNotFound
+	}
+	return tx.Commit()
+}
+
+func (store *SQLiteStore) DeleteTeamsByOrgID(ctx context.Context, orgID string) error {
+	tx, err := sqlite.Begin(ctx, store.db)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM team_members WHERE team_id IN (SELECT id FROM teams WHERE org_id = ?)`, orgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM teams WHERE org_id = ?`, orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (store *SQLiteStore) CreateTeamMember(ctx context.Context, member *TeamMember) error {
+	query := `INSERT INTO team_members (team_id, user_id, created_at) VALUES (?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, member.TeamID, member.UserID, member.CreatedAt)
+	return err
+}
+
+func (store *SQLiteStore) ListTeamMembers(ctx context.Context, teamID string) ([]*TeamMember, error) {
+	query := `SELECT team_id, user_id, created_at FROM team_members WHERE team_id = ? ORDER BY created_at, user_id`
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	members := make([]*TeamMember, 0)
+	for rows.Next() {
+		member := &TeamMember{}
+		if err := rows.Scan(&member.TeamID, &member.UserID, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (store *SQLiteStore) DeleteTeamMember(ctx context.Context, teamID, userID string) error {
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM team_members WHERE team_id = ? AND user_id = ?`, teamID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTeamMemberNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) DeleteTeamMembershipsByUserID(ctx context.Context, orgID, userID string) error {
+	query := `DELETE FROM team_members WHERE user_id = ? AND team_id IN (SELECT id FROM teams WHERE org_id = ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, userID, orgID)
+	return err
+}
+
+const exportColumns = `id, org_id, requested_by, status, progress, storage_key, url, error, created_at, updated_at, completed_at`
+
+func (store *SQLiteStore) SaveExport(ctx context.Context, export *Export) error {
+	query := `INSERT OR REPLACE INTO org_exports (` + exportColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, export.ID, export.OrgID, export.RequestedBy, export.Status,
+		export.Progress, export.Key, export.URL, export.Error, export.CreatedAt, export.UpdatedAt, export.CompletedAt)
+	return err
+}
+
+func (store *SQLiteStore) GetExport(ctx context.Context, id string) (*Export, error) {
+	exports, err := store.queryExports(ctx, `SELECT `+exportColumns+` FROM org_exports WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return nil, ErrExportNotFound
+	}
+	return exports[0], nil
+}
+
+func (store *SQLiteStore) ListExports(ctx context.Context, orgID string) ([]*Export, error) {
+	return store.queryExports(ctx, `SELECT `+exportColumns+` FROM org_exports WHERE org_id = ? ORDER BY created_at DESC, id`, orgID)
+}
+
+func (store *SQLiteStore) queryExports(ctx context.Context, query string, args ...any) ([]*Export, error) {
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	exports := make([]*Export, 0)
+	for rows.Next() {
+		export := &Export{}
+		var completedAt sql.NullTime
+		err := rows.Scan(&export.ID, &export.OrgID, &export.RequestedBy, &export.Status, &export.Progress,
+			&export.Key, &export.URL, &export.Error, &export.CreatedAt, &export.UpdatedAt, &completedAt)
+		if err != nil {
+			return nil, err
+		}
+		if completedAt.Valid {
+			export.CompletedAt = &completedAt.Time
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+const activityColumns = `id, org_id, type, actor_id, user_id, details, created_at`
+
+func (store *SQLiteStore) RecordActivity(ctx context.Context, activity *Activity) error {
+	details, err := json.Marshal(activity.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode activity details: %w", err)
+	}
+	query := `INSERT INTO org_activity (` + activityColumns + `, created_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = sqlite.Conn(ctx, store.db).ExecContext(ctx, query, activity.ID, activity.OrgID, activity.Type, activity.ActorID,
+		activity.UserID, string(details), activity.CreatedAt, activity.CreatedAt.UnixMilli())
+	return err
+}
+
+// ListActivity returns the organization's activity newest first; entries
+// recorded in the same millisecond keep the order they were recorded in.
+func (store *SQLiteStore) ListActivity(ctx context.Context, orgID string, offset, limit int) ([]*Activity, error) {
+	query := `SELECT ` + activityColumns + ` FROM org_activity WHERE org_id = ? ORDER BY created_ms DESC, rowid DESC LIMIT ? OFFSET ?`
+	rows, err := sqlite.Conn(ctx, store.db).QueryContext(ctx, query, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	entries := make([]*Activity, 0)
+	for rows.Next() {
+		activity := &Activity{}
+		var details string
+		err := rows.Scan(&activity.ID, &activity.OrgID, &activity.Type, &activity.ActorID, &activity.UserID, &details, &activity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(details), &activity.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode activity details: %w", err)
+		}
+		entries = append(entries, activity)
+	}
+	return entries, rows.Err()
+}
+
+func (store *SQLiteStore) CountActivity(ctx context.Context, orgID string) (int, error) {
+	var count int
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM org_activity WHERE org_id = ?`, orgID).Scan(&count)
+	return count, err
+}
+
+func (store *SQLiteStore) DeleteActivityByOrgID(ctx context.Context, orgID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM org_activity WHERE org_id = ?`, orgID)
 	return err
 }
 
 func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
 	return store.db.Close()
 }
+
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
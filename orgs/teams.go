@@ -0,0 +1,248 @@
+package orgs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrTeamNotFound       = chassis.NewError(chassis.CodeNotFound, "team not found")
+	ErrTeamNameRequired   = chassis.NewError(chassis.CodeInvalidArgument, "team name is required")
+	ErrTeamExists         = chassis.NewError(chassis.CodeAlreadyExists, "team name already exists in this organization")
+	ErrTeamMemberNotFound = chassis.NewError(chassis.CodeNotFound, "user is not a member of this team")
+	ErrTeamMemberExists   = chassis.NewError(chassis.CodeAlreadyExists, "user is already a member of this team")
+)
+
+// Team events published when the events module is registered.
+const (
+	EventTeamCreated       = "org.team_created"        // payload: *TeamEvent
+	EventTeamDeleted       = "org.team_deleted"        // payload: *TeamEvent
+	EventTeamMemberAdded   = "org.team_member_added"   // payload: *TeamEvent
+	EventTeamMemberRemoved = "org.team_member_removed" // payload: *TeamEvent
+)
+
+// TeamEvent is the payload of team events. UserID is set for member events.
+type TeamEvent struct {
+	TeamID string
+	OrgID  string
+	Role   string
+	UserID string
+}
+
+// Team is a group of an organization's members. Its members hold the
+// team's role in the organization on top of their own, so permissions can
+// be granted to a team at once.
+type Team struct {
+	ID        string
+	OrgID     string
+	Name      string
+	Role      string // "" grants nothing beyond the members' own roles
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TeamMember is a user's membership in a team.
+type TeamMember struct {
+	TeamID    string
+	UserID    string
+	CreatedAt time.Time
+}
+
+// CreateTeam creates a team in an organization. Its members gain role,
+// which may be "" for a team used only for grouping.
+func (mod *Module) CreateTeam(ctx context.Context, orgID, name, role string) (*Team, error) {
+	if name == "" {
+		return nil, ErrTeamNameRequired
+	}
+	if role != "" && !ValidRoles[role] {
+		return nil, ErrInvalidRole
+	}
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+	if err := mod.checkTeamName(ctx, orgID, "", name); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	team := &Team{
+		ID:        uuid.New().String(),
+		OrgID:     orgID,
+		Name:      name,
+		Role:      role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := mod.store.CreateTeam(ctx, team); err != nil {
+		return nil, fmt.Errorf("failed to create team: %w", err)
+	}
+
+	mod.app.PublishEvent(ctx, EventTeamCreated, &TeamEvent{TeamID: team.ID, OrgID: orgID, Role: role})
+	return team, nil
+}
+
+// checkTeamName fails with ErrTeamExists if another team than teamID in
+// the organization is called name.
+func (mod *Module) checkTeamName(ctx context.Context, orgID, teamID, name string) error {
+	teams, err := mod.store.ListTeamsByOrgID(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to check existing teams: %w", err)
+	}
+	for _, team := range teams {
+		if team.Name == name && team.ID != teamID {
+			return ErrTeamExists
+		}
+	}
+	return nil
+}
+
+// GetTeam retrieves a team by its ID.
+func (mod *Module) GetTeam(ctx context.Context, teamID string) (*Team, error) {
+	return mod.store.GetTeam(ctx, teamID)
+}
+
+// ListTeams returns an organization's teams, by name.
+func (mod *Module) ListTeams(ctx context.Context, orgID string) ([]*Team, error) {
+	if _, err := mod.getOrg(ctx, orgID); err != nil {
+		return nil, err
+	}
+	return mod.store.ListTeamsByOrgID(ctx, orgID)
+}
+
+// RenameTeam changes a team's name.
+func (mod *Module) RenameTeam(ctx context.Context, teamID, name string) (*Team, error) {
+	if name == "" {
+		return nil, ErrTeamNameRequired
+	}
+	team, err := mod.store.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.checkTeamName(ctx, team.OrgID, teamID, name); err != nil {
+		return nil, err
+	}
+	team.Name = name
+	team.UpdatedAt = time.Now()
+	if err := mod.store.UpdateTeam(ctx, team); err != nil {
+		return nil, fmt.Errorf("failed to update team: %w", err)
+	}
+	return team, nil
+}
+
+// SetTeamRole changes the role a team grants its members; "" grants none.
+func (mod *Module) SetTeamRole(ctx context.Context, teamID, role string) (*Team, error) {
+	if role != "" && !ValidRoles[role] {
+		return nil, ErrInvalidRole
+	}
+	team, err := mod.store.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	team.Role = role
+	team.UpdatedAt = time.Now()
+	if err := mod.store.UpdateTeam(ctx, team); err != nil {
+		return nil, fmt.Errorf("failed to update team: %w", err)
+	}
+	return team, nil
+}
+
+// DeleteTeam removes a team and its memberships.
+func (mod *Module) DeleteTeam(ctx context.Context, teamID string) error {
+	team, err := mod.store.GetTeam(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if err := mod.store.DeleteTeam(ctx, teamID); err != nil {
+		return err
+	}
+
+	mod.app.PublishEvent(ctx, EventTeamDeleted, &TeamEvent{TeamID: teamID, OrgID: team.OrgID, Role: team.Role})
+	return nil
+}
+
+// AddTeamMember adds a member of the team's organization to the team.
+// Users who aren't members of the organization fail with
+// ErrMemberNotFound.
+func (mod *Module) AddTeamMember(ctx context.Context, teamID, userID string) (*TeamMember, error) {
+	team, err := mod.store.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mod.store.GetMembership(ctx, team.OrgID, userID); err != nil {
+		return nil, err
+	}
+
+	members, err := mod.store.ListTeamMembers(ctx, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing team members: %w", err)
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return nil, ErrTeamMemberExists
+		}
+	}
+
+	member := &TeamMember{TeamID: teamID, UserID: userID, CreatedAt: time.Now()}
+	if err := mod.store.CreateTeamMember(ctx, member); err != nil {
+		return nil, fmt.Errorf("failed to add team member: %w", err)
+	}
+
+	mod.app.PublishEvent(ctx, EventTeamMemberAdded, &TeamEvent{TeamID: teamID, OrgID: team.OrgID, Role: team.Role, UserID: userID})
+	return member, nil
+}
+
+// RemoveTeamMember removes a user from a team.
+func (mod *Module) RemoveTeamMember(ctx context.Context, teamID, userID string) error {
+	team, err := mod.store.GetTeam(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if err := mod.store.DeleteTeamMember(ctx, teamID, userID); err != nil {
+		return err
+	}
+
+	mod.app.PublishEvent(ctx, EventTeamMemberRemoved, &TeamEvent{TeamID: teamID, OrgID: team.OrgID, Role: team.Role, UserID: userID})
+	return nil
+}
+
+// ListTeamMembers returns a team's members, oldest first.
+func (mod *Module) ListTeamMembers(ctx context.Context, teamID string) ([]*TeamMember, error) {
+	if _, err := mod.store.GetTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	return mod.store.ListTeamMembers(ctx, teamID)
+}
+
+// GetUserTeams returns the teams a user belongs to in an organization.
+func (mod *Module) GetUserTeams(ctx context.Context, orgID, userID string) ([]*Team, error) {
+	return mod.store.GetTeamsByUserID(ctx, orgID, userID)
+}
+
+// GetUserRoles returns every role a user holds in an organization: their
+// membership role followed by the roles of their teams, without
+// duplicates. It returns nil if they aren't a member.
+func (mod *Module) GetUserRoles(ctx context.Context, orgID, userID string) []string {
+	membership, err := mod.activeMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil
+	}
+	roles := []string{membership.Role}
+
+	teams, err := mod.store.GetTeamsByUserID(ctx, orgID, userID)
+	if err != nil {
+		mod.logger().Warn("failed to load team roles", "org_id", orgID, "user_id", userID, "error", err)
+		return roles
+	}
+	seen := map[string]bool{membership.Role: true}
+	for _, team := range teams {
+		if team.Role != "" && !seen[team.Role] {
+			seen[team.Role] = true
+			roles = append(roles, team.Role)
+		}
+	}
+	return roles
+}
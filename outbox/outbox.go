@@ -0,0 +1,327 @@
+// Package outbox implements the transactional outbox pattern for chassis modules.
+//
+// Modules keep their data in separate SQLite files, so publishing an event
+// after a write can be lost if the process stops in between ("user created
+// but user.created never published"). With an outbox, the event is inserted
+// into the module's own database in the same transaction as the data change,
+// and a Relay publishes it to the events bus afterward.
+//
+// # Usage
+//
+//	box, err := outbox.New(ctx, db)
+//
+//	tx, _ := db.BeginTx(ctx, nil)
+//	_, _ = tx.ExecContext(ctx, `INSERT INTO users ...`)
+//	_ = box.Add(ctx, tx, "user.created", map[string]string{"user_id": id})
+//	_ = tx.Commit()
+//
+//	relay := outbox.NewRelay(box, app.Events())
+//	go relay.Run(ctx)
+//	relay.Notify() // publish promptly instead of waiting for the next poll
+//
+// Delivery is at-least-once: an event is removed from the outbox only after
+// it has been published, so a crash between the two republishes it on restart.
+// Payloads are stored as JSON and delivered as decoded JSON values
+// (map[string]any for objects), unless WithPayloadType gives the Go type
+// to decode an event type into. The request ID and tenant of the context
+// passed to Add (see chassis.WithRequestID and chassis.WithTenant) are
+// stored too and put back in the context the event is published with.
+//
+// The users and orgs modules write their lifecycle events to an outbox in
+// their database and relay them themselves. Modules sharing a database
+// name their outbox with WithSource, so each relays only its own events.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// DefaultInterval is how often a Relay polls for pending events.
+const DefaultInterval = time.Second
+
+// DefaultBatchSize is the maximum number of events a Relay publishes per poll.
+const DefaultBatchSize = 100
+
+// Execer is satisfied by *sql.Tx, *sql.DB, and *sql.Conn.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Publisher delivers events to subscribers.
+// The events module and chassis.EventsModule satisfy this interface.
+type Publisher interface {
+	Publish(ctx context.Context, eventType string, payload any)
+}
+
+// Event is an event waiting in the outbox.
+type Event struct {
+	ID        int64
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	RequestID string
+	TenantID  string
+}
+
+// Outbox stores pending events in a module's database.
+type Outbox struct {
+	db     *sql.DB
+	source string
+}
+
+// Option configures an Outbox.
+type Option func(*Outbox)
+
+// WithSource names the outbox, so several can share one database's
+// outbox_events table, each relaying only the events added to it.
+func WithSource(source string) Option {
+	return func(box *Outbox) {
+		box.source = source
+	}
+}
+
+// New creates an outbox in db, creating the outbox_events table if needed.
+func New(ctx context.Context, db *sql.DB, opts ...Option) (*Outbox, error) {
+	schema := `
+		CREATE TABLE IF NOT EXISTS outbox_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_type TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+	`
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create outbox table: %w", err)
+	}
+	for _, column := range []string{"request_id", "tenant_id", "source"} {
+		if err := addColumn(ctx, db, column); err != nil {
+			return nil, fmt.Errorf("failed to migrate outbox table: %w", err)
+		}
+	}
+	box := &Outbox{db: db}
+	for _, opt := range opts {
+		opt(box)
+	}
+	return box, nil
+}
+
+// addColumn adds a text column to outbox tables created before it.
+func addColumn(ctx context.Context, db *sql.DB, column string) error {
+	var count int
+	query := `SELECT COUNT(*) FROM pragma_table_info('outbox_events') WHERE name = ?`
+	if err := db.QueryRowContext(ctx, query, column).Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `ALTER TABLE outbox_events ADD COLUMN `+column+` TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// Add records an event using exec, which should be the transaction that
+// performs the related data change. The event becomes visible to the relay
+// only when that transaction commits.
+func (box *Outbox) Add(ctx context.Context, exec Execer, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	query := `INSERT INTO outbox_events (event_type, payload, created_at, request_id, tenant_id, source) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := exec.ExecContext(ctx, query, eventType, data, time.Now(),
+		chassis.RequestIDFromContext(ctx), chassis.TenantFromContext(ctx), box.source); err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	return nil
+}
+
+// Pending returns up to limit unpublished events, oldest first.
+func (box *Outbox) Pending(ctx context.Context, limit int) ([]*Event, error) {
+	query := `SELECT id, event_type, payload, created_at, request_id, tenant_id FROM outbox_events WHERE source = ? ORDER BY id LIMIT ?`
+	rows, err := box.db.QueryContext(ctx, query, box.source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []*Event
+	for rows.Next() {
+		event := &Event{}
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Type, &payload, &event.CreatedAt, &event.RequestID, &event.TenantID); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Remove deletes a published event from the outbox.
+func (box *Outbox) Remove(ctx context.Context, id int64) error {
+	_, err := box.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE id = ?`, id)
+	return err
+}
+
+// Count returns the number of unpublished events.
+func (box *Outbox) Count(ctx context.Context) (int, error) {
+	var count int
+	err := box.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox_events WHERE source = ?`, box.source).Scan(&count)
+	return count, err
+}
+
+// Relay publishes events from an outbox to the events bus.
+type Relay struct {
+	mu        sync.Mutex // serializes Flush, so an event is published once
+	box       *Outbox
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	logger    *slog.Logger
+	payloads  map[string]func() any
+	notify    chan struct{}
+}
+
+// RelayOption configures a Relay.
+type RelayOption func(*Relay)
+
+// WithInterval sets how often the relay polls for pending events.
+func WithInterval(interval time.Duration) RelayOption {
+	return func(relay *Relay) {
+		relay.interval = interval
+	}
+}
+
+// WithBatchSize sets the maximum number of events published per poll.
+func WithBatchSize(size int) RelayOption {
+	return func(relay *Relay) {
+		relay.batchSize = size
+	}
+}
+
+// WithPayloadType decodes the payloads of eventType into the value
+// newPayload returns, a pointer, so subscribers get the Go type the event
+// was added with rather than decoded JSON:
+//
+//	outbox.WithPayloadType(users.EventUserCreated, func() any { return &users.UserEvent{} })
+func WithPayloadType(eventType string, newPayload func() any) RelayOption {
+	return func(relay *Relay) {
+		relay.payloads[eventType] = newPayload
+	}
+}
+
+// WithLogger sets the logger used to report relay errors.
+func WithLogger(logger *slog.Logger) RelayOption {
+	return func(relay *Relay) {
+		relay.logger = logger
+	}
+}
+
+// NewRelay creates a relay that publishes events from box via publisher.
+func NewRelay(box *Outbox, publisher Publisher, opts ...RelayOption) *Relay {
+	relay := &Relay{
+		box:       box,
+		publisher: publisher,
+		interval:  DefaultInterval,
+		batchSize: DefaultBatchSize,
+		logger:    slog.Default(),
+		payloads:  make(map[string]func() any),
+		notify:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(relay)
+	}
+	return relay
+}
+
+// Notify wakes the relay so events committed just now are published without
+// waiting for the next poll. It never blocks.
+func (relay *Relay) Notify() {
+	select {
+	case relay.notify <- struct{}{}:
+	default:
+	}
+}
+
+// flushingKey marks the context a relay publishes events with.
+type flushingKey struct{ relay *Relay }
+
+// Flush publishes all pending events and returns how many were published.
+// Events are published in the order they were added. Called from a handler
+// of an event the relay is publishing, with the handler's context, it
+// returns at once; the events the handler added are published by the
+// Flush already running.
+func (relay *Relay) Flush(ctx context.Context) (int, error) {
+	if ctx.Value(flushingKey{relay}) != nil {
+		return 0, nil
+	}
+	relay.mu.Lock()
+	defer relay.mu.Unlock()
+	flushingCtx := context.WithValue(ctx, flushingKey{relay}, true)
+	published := 0
+	for {
+		events, err := relay.box.Pending(ctx, relay.batchSize)
+		if err != nil {
+			return published, fmt.Errorf("failed to read outbox: %w", err)
+		}
+		if len(events) == 0 {
+			return published, nil
+		}
+
+		for _, event := range events {
+			var payload any
+			if newPayload, ok := relay.payloads[event.Type]; ok {
+				payload = newPayload()
+			} else {
+				payload = new(any)
+			}
+			if err := json.Unmarshal(event.Payload, payload); err != nil {
+				// A payload that can't be decoded will never succeed; drop it
+				// rather than blocking every event behind it
+				relay.logger.Error("dropping outbox event with invalid payload",
+					"id", event.ID,
+					"event", event.Type,
+					"error", err,
+				)
+			} else {
+				publishCtx := chassis.WithRequestID(flushingCtx, event.RequestID)
+				publishCtx = chassis.WithTenant(publishCtx, event.TenantID)
+				if decoded, ok := payload.(*any); ok {
+					payload = *decoded
+				}
+				relay.publisher.Publish(publishCtx, event.Type, payload)
+				published++
+			}
+
+			if err := relay.box.Remove(ctx, event.ID); err != nil {
+				return published, fmt.Errorf("failed to remove published event: %w", err)
+			}
+		}
+	}
+}
+
+// Run publishes pending events until ctx is canceled, polling at the
+// configured interval and whenever Notify is called.
+func (relay *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := relay.Flush(ctx); err != nil && ctx.Err() == nil {
+			relay.logger.Error("outbox relay failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-relay.notify:
+		}
+	}
+}
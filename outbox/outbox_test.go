@@ -0,0 +1,259 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/talosaether/chassis"
+)
+
+type recordingPublisher struct {
+	mu            sync.Mutex
+	events        []string
+	last          any
+	lastRequestID string
+	lastTenant    string
+}
+
+func (publisher *recordingPublisher) Publish(ctx context.Context, eventType string, payload any) {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	publisher.events = append(publisher.events, eventType)
+	publisher.last = payload
+	publisher.lastRequestID = chassis.RequestIDFromContext(ctx)
+	publisher.lastTenant = chassis.TenantFromContext(ctx)
+}
+
+func (publisher *recordingPublisher) published() []string {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	return append([]string(nil), publisher.events...)
+}
+
+func setupOutbox(t *testing.T) (*sql.DB, *Outbox) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE items (id TEXT PRIMARY KEY)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	box, err := New(context.Background(), db)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return db, box
+}
+
+func TestOutbox_CommitPublishes(t *testing.T) {
+	db, box := setupOutbox(t)
+	ctx := chassis.WithTenant(chassis.WithRequestID(context.Background(), "req-1"), "org-1")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO items (id) VALUES ('a')`); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if err := box.Add(ctx, tx, "item.created", map[string]string{"id": "a"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	publisher := &recordingPublisher{}
+	published, err := NewRelay(box, publisher).Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if published != 1 {
+		t.Fatalf("expected 1 event published, got %d", published)
+	}
+	if publisher.lastRequestID != "req-1" {
+		t.Errorf("expected the request ID of Add, got %q", publisher.lastRequestID)
+	}
+	if publisher.lastTenant != "org-1" {
+		t.Errorf("expected the tenant of Add, got %q", publisher.lastTenant)
+	}
+
+	payload, ok := publisher.last.(map[string]any)
+	if !ok || payload["id"] != "a" {
+		t.Errorf("expected decoded payload with id=a, got %#v", publisher.last)
+	}
+
+	if count, _ := box.Count(ctx); count != 0 {
+		t.Errorf("expected outbox to be empty after flush, got %d", count)
+	}
+}
+
+func TestOutbox_RollbackDiscardsEvent(t *testing.T) {
+	db, box := setupOutbox(t)
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	if err := box.Add(ctx, tx, "item.created", nil); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	publisher := &recordingPublisher{}
+	if _, err := NewRelay(box, publisher).Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if len(publisher.published()) != 0 {
+		t.Errorf("rolled back event should not be published, got %v", publisher.published())
+	}
+}
+
+func TestRelay_PublishesInOrder(t *testing.T) {
+	db, box := setupOutbox(t)
+	ctx := context.Background()
+
+	for _, eventType := range []string{"first", "second", "third"} {
+		if err := box.Add(ctx, db, eventType, nil); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	publisher := &recordingPublisher{}
+	if _, err := NewRelay(box, publisher, WithBatchSize(2)).Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	got := publisher.published()
+	want := []string{"first", "second", "third"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestRelay_SourcesAndPayloadTypes(t *testing.T) {
+	db, box := setupOutbox(t)
+	ctx := context.Background()
+	other, err := New(ctx, db, WithSource("other"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	type created struct{ ID string }
+	if err := box.Add(ctx, db, "item.created", &created{ID: "a"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := other.Add(ctx, db, "other.created", nil); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	publisher := &recordingPublisher{}
+	relay := NewRelay(box, publisher, WithPayloadType("item.created", func() any { return &created{} }))
+	if published, err := relay.Flush(ctx); err != nil || published != 1 {
+		t.Fatalf("expected only the outbox's own event, got %d, %v", published, err)
+	}
+	if payload, ok := publisher.last.(*created); !ok || payload.ID != "a" {
+		t.Errorf("expected the payload decoded into its type, got %#v", publisher.last)
+	}
+	if count, _ := other.Count(ctx); count != 1 {
+		t.Errorf("expected the other outbox's event left, got %d", count)
+	}
+}
+
+// publisherFunc adapts a function to Publisher.
+type publisherFunc func(ctx context.Context, eventType string, payload any)
+
+func (fn publisherFunc) Publish(ctx context.Context, eventType string, payload any) {
+	fn(ctx, eventType, payload)
+}
+
+func TestRelay_FlushFromHandler(t *testing.T) {
+	db, box := setupOutbox(t)
+	ctx := context.Background()
+	if err := box.Add(ctx, db, "item.created", nil); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	var relay *Relay
+	var events []string
+	relay = NewRelay(box, publisherFunc(func(ctx context.Context, eventType string, payload any) {
+		events = append(events, eventType)
+		if eventType != "item.created" {
+			return
+		}
+		if err := box.Add(ctx, db, "item.updated", nil); err != nil {
+			t.Errorf("Add failed: %v", err)
+		}
+		if _, err := relay.Flush(ctx); err != nil {
+			t.Errorf("Flush from handler failed: %v", err)
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if published, err := relay.Flush(ctx); err != nil || published != 2 {
+			t.Errorf("expected both events published, got %d, %v", published, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Flush from a handler deadlocked")
+	}
+	if len(events) != 2 || events[1] != "item.updated" {
+		t.Errorf("expected the handler's event published after its own, got %v", events)
+	}
+}
+
+func TestRelay_RunNotify(t *testing.T) {
+	db, box := setupOutbox(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	publisher := &recordingPublisher{}
+	relay := NewRelay(box, publisher, WithInterval(time.Hour))
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	if err := box.Add(ctx, db, "item.created", nil); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	relay.Notify()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(publisher.published()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(publisher.published()) != 1 {
+		t.Errorf("expected Notify to trigger a publish, got %v", publisher.published())
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("Run did not return after cancel")
+	}
+}
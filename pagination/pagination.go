@@ -0,0 +1,211 @@
+// Package pagination provides the request and result types shared by every
+// chassis listing, so API consumers see one convention.
+//
+// A Request asks for a page either by number or by continuation cursor:
+//
+//	req := pagination.Request{Page: 2, Limit: 50}
+//	req := pagination.Request{Cursor: previous.NextCursor, Limit: 50}
+//
+// Results carry the items with totals and the cursor of the next page:
+//
+//	result, err := queueMod.List(ctx, queue.StatusPending, req)
+//	for _, job := range result.Items { ... }
+//	if result.HasMore {
+//	    next := pagination.Request{Cursor: result.NextCursor, Limit: req.Limit}
+//	}
+//
+// In HTTP handlers, FromRequest reads ?page=, ?limit= and ?cursor=:
+//
+//	req, err := pagination.FromRequest(request)
+//	if err != nil {
+//	    api.WriteError(writer, request, err)
+//	    return
+//	}
+//
+// Cursors are opaque to clients. Modules listing by offset use
+// Request.Offset and NewResult; modules that page by key (e.g., storage)
+// encode their own position with EncodeCursor.
+package pagination
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrInvalidCursor = chassis.NewError(chassis.CodeInvalidArgument, "invalid pagination cursor")
+	ErrInvalidPage   = chassis.NewError(chassis.CodeInvalidArgument, "page and limit must be positive integers")
+)
+
+// Limits applied by Normalize.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// offsetPrefix marks cursors created by NewResult.
+const offsetPrefix = "o:"
+
+// Request selects a page of a listing. Cursor takes precedence over Page.
+type Request struct {
+	Page   int    `json:"page,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Normalize returns the request with Page at least 1 and Limit between 1
+// and MaxLimit, defaulting to DefaultLimit.
+func (req Request) Normalize() Request {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 {
+		req.Limit = DefaultLimit
+	}
+	if req.Limit > MaxLimit {
+		req.Limit = MaxLimit
+	}
+	return req
+}
+
+// Offset returns the number of items to skip for the normalized request:
+// the position in its cursor, or (Page-1)*Limit.
+func (req Request) Offset() (int, error) {
+	req = req.Normalize()
+	if req.Cursor == "" {
+		return (req.Page - 1) * req.Limit, nil
+	}
+
+	position, err := DecodeCursor(req.Cursor)
+	if err != nil || !strings.HasPrefix(position, offsetPrefix) {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(position, offsetPrefix))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// Result is one page of a listing.
+type Result[T any] struct {
+	Items      []T    `json:"items"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"totalPages"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// NewResult builds the result of an offset listing: items is the page
+// starting at offset, out of total items.
+func NewResult[T any](items []T, req Request, offset, total int) *Result[T] {
+	req = req.Normalize()
+	if items == nil {
+		items = []T{}
+	}
+
+	totalPages := (total + req.Limit - 1) / req.Limit
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	result := &Result[T]{
+		Items:      items,
+		Page:       offset/req.Limit + 1,
+		Limit:      req.Limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+	if next := offset + len(items); len(items) > 0 && next < total {
+		result.HasMore = true
+		result.NextCursor = OffsetCursor(next)
+	}
+	return result
+}
+
+// Slice pages an in-memory slice.
+func Slice[T any](items []T, req Request) (*Result[T], error) {
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	start := min(offset, len(items))
+	end := min(start+req.Limit, len(items))
+	return NewResult(items[start:end], req, offset, len(items)), nil
+}
+
+// Map converts the items of a result, keeping its pagination metadata.
+// Useful for turning stored records into response types.
+func Map[T, U any](result *Result[T], convert func(T) U) *Result[U] {
+	items := make([]U, len(result.Items))
+	for i, item := range result.Items {
+		items[i] = convert(item)
+	}
+	return &Result[U]{
+		Items:      items,
+		Page:       result.Page,
+		Limit:      result.Limit,
+		Total:      result.Total,
+		TotalPages: result.TotalPages,
+		HasMore:    result.HasMore,
+		NextCursor: result.NextCursor,
+	}
+}
+
+// OffsetCursor returns the cursor of an offset listing that starts at
+// offset, for protocols that page by position (e.g., SCIM's startIndex).
+func OffsetCursor(offset int) string {
+	return EncodeCursor(offsetPrefix + strconv.Itoa(offset))
+}
+
+// EncodeCursor makes an opaque cursor from a module-defined position.
+func EncodeCursor(position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// DecodeCursor returns the position encoded by EncodeCursor.
+func DecodeCursor(cursor string) (string, error) {
+	position, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(position), nil
+}
+
+// FromQuery reads page, limit and cursor from URL query values.
+// Missing values are left zero; Normalize fills in the defaults.
+func FromQuery(query url.Values) (Request, error) {
+	var req Request
+	for name, field := range map[string]*int{"page": &req.Page, "limit": &req.Limit} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return Request{}, ErrInvalidPage
+		}
+		*field = parsed
+	}
+	req.Cursor = query.Get("cursor")
+	if req.Cursor != "" {
+		if _, err := DecodeCursor(req.Cursor); err != nil {
+			return Request{}, err
+		}
+	}
+	return req, nil
+}
+
+// FromRequest reads page, limit and cursor from the request's query string.
+func FromRequest(request *http.Request) (Request, error) {
+	return FromQuery(request.URL.Query())
+}
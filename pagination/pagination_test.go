@@ -0,0 +1,84 @@
+package pagination
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want Request
+	}{
+		{Request{}, Request{Page: 1, Limit: DefaultLimit}},
+		{Request{Page: -1, Limit: -5}, Request{Page: 1, Limit: DefaultLimit}},
+		{Request{Page: 3, Limit: 1000}, Request{Page: 3, Limit: MaxLimit}},
+	}
+	for _, test := range tests {
+		if got := test.in.Normalize(); got != test.want {
+			t.Errorf("Normalize(%+v) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSlice_PagesAndCursors(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5, 6, 7}
+
+	page, err := Slice(items, Request{Page: 3, Limit: 3})
+	if err != nil {
+		t.Fatalf("Slice failed: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0] != 7 || page.Page != 3 || page.TotalPages != 3 || page.HasMore {
+		t.Errorf("unexpected last page: %+v", page)
+	}
+
+	var collected []int
+	req := Request{Limit: 2}
+	for {
+		page, err := Slice(items, req)
+		if err != nil {
+			t.Fatalf("Slice failed: %v", err)
+		}
+		collected = append(collected, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	if len(collected) != len(items) {
+		t.Errorf("following cursors collected %v", collected)
+	}
+
+	empty, _ := Slice(items, Request{Page: 10})
+	if empty.Items == nil || len(empty.Items) != 0 || empty.Total != 7 {
+		t.Errorf("out-of-range page should be empty with totals, got %+v", empty)
+	}
+}
+
+func TestOffset_InvalidCursor(t *testing.T) {
+	for _, cursor := range []string{"%%%", EncodeCursor("key:abc"), EncodeCursor("o:-1")} {
+		if _, err := (Request{Cursor: cursor}).Offset(); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Offset(%q) = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	page, _ := Slice([]int{1, 2, 3}, Request{Limit: 2})
+	mapped := Map(page, func(n int) string { return string(rune('a' + n - 1)) })
+	if len(mapped.Items) != 2 || mapped.Items[1] != "b" || mapped.NextCursor != page.NextCursor || mapped.Total != 3 {
+		t.Errorf("Map = %+v", mapped)
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+	req, err := FromQuery(url.Values{"page": {"2"}, "limit": {"50"}})
+	if err != nil || req.Page != 2 || req.Limit != 50 {
+		t.Errorf("FromQuery = %+v, %v", req, err)
+	}
+	for _, query := range []url.Values{{"page": {"0"}}, {"limit": {"x"}}, {"cursor": {"%%%"}}} {
+		if _, err := FromQuery(query); err == nil {
+			t.Errorf("FromQuery(%v) should fail", query)
+		}
+	}
+}
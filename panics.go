@@ -0,0 +1,127 @@
+package chassis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrPanicked wraps the panics recovered at module boundaries.
+var ErrPanicked = NewError(CodeInternal, "panic recovered")
+
+// EventModulePanic is published when a panic is recovered at a module
+// boundary. The payload is a *ModulePanic.
+const EventModulePanic = "module.panic"
+
+// Module boundaries where panics are recovered, reported in
+// ModulePanic.Boundary.
+const (
+	PanicInInit         = "init"
+	PanicInService      = "service"
+	PanicInEventHandler = "event_handler"
+	PanicInJobHandler   = "job_handler"
+	PanicInHTTPHandler  = "http_handler"
+)
+
+// ModulePanic describes a recovered panic.
+type ModulePanic struct {
+	Module    string    `json:"module"`
+	Boundary  string    `json:"boundary"`
+	Target    string    `json:"target,omitempty"` // event or job type, or request path
+	Value     string    `json:"value"`
+	Stack     string    `json:"stack"`
+	RequestID string    `json:"request_id,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// panicCounts counts recovered panics by module.
+type panicCounts struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// ReportPanic records a panic recovered at a module boundary, so one bad
+// handler doesn't take down the app unnoticed: it logs the panic with its
+// stack, counts it in Panics and publishes module.panic if the events
+// module is registered. It returns an error wrapping ErrPanicked for the
+// caller to handle like any other failure. Modules recovering panics
+// themselves call it from their deferred recover:
+//
+//	defer func() {
+//	    if recovered := recover(); recovered != nil {
+//	        err = app.ReportPanic(ctx, "billing", chassis.PanicInJobHandler, job.Type, recovered)
+//	    }
+//	}()
+func (app *App) ReportPanic(ctx context.Context, module, boundary, target string, recovered any) error {
+	report := &ModulePanic{
+		Module:    module,
+		Boundary:  boundary,
+		Target:    target,
+		Value:     fmt.Sprint(recovered),
+		Stack:     string(debug.Stack()),
+		RequestID: RequestIDFromContext(ctx),
+		At:        time.Now(),
+	}
+	app.logger.ErrorContext(ctx, "panic recovered",
+		"module", module,
+		"boundary", boundary,
+		"target", target,
+		"panic", report.Value,
+		"stack", report.Stack,
+	)
+
+	app.panics.mu.Lock()
+	if app.panics.counts == nil {
+		app.panics.counts = make(map[string]uint64)
+	}
+	app.panics.counts[module]++
+	app.panics.mu.Unlock()
+
+	// A panicking module.panic handler is only logged, so it can't loop
+	if !(boundary == PanicInEventHandler && target == EventModulePanic) {
+		app.PublishEvent(ctx, EventModulePanic, report)
+	}
+	return fmt.Errorf("%w: %v", ErrPanicked, recovered)
+}
+
+// Panics returns the number of panics recovered at module boundaries
+// since the app was created, by module.
+func (app *App) Panics() map[string]uint64 {
+	app.panics.mu.Lock()
+	defer app.panics.mu.Unlock()
+	counts := make(map[string]uint64, len(app.panics.counts))
+	for module, count := range app.panics.counts {
+		counts[module] = count
+	}
+	return counts
+}
+
+// initModule calls Init, turning a panic into an error.
+func (app *App) initModule(ctx context.Context, mod Module) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = app.ReportPanic(ctx, mod.Name(), PanicInInit, "", recovered)
+		}
+	}()
+	return mod.Init(ctx, app)
+}
+
+// recoverHTTP reports a panic in an HTTP handler and answers with a 500
+// error envelope, unless the handler aborted on purpose with
+// http.ErrAbortHandler.
+func (app *App) recoverHTTP(writer http.ResponseWriter, request *http.Request) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+	_ = app.ReportPanic(request.Context(), "http", PanicInHTTPHandler, request.Method+" "+request.URL.Path, recovered)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(writer, "{\"code\":%q,\"message\":\"internal server error\",\"request_id\":%q}\n", CodeInternal, RequestIDFromContext(request.Context()))
+}
@@ -0,0 +1,206 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Decision is the step of a permission check that settled it.
+type Decision string
+
+const (
+	DecisionDenyPolicy  Decision = "deny_policy"  // a Deny policy matched
+	DecisionGrant       Decision = "grant"        // the user holds a grant on the resource
+	DecisionRole        Decision = "role"         // one of the user's roles has the permission
+	DecisionInherited   Decision = "inherited"    // a role in a parent organization carries the permission
+	DecisionAllowPolicy Decision = "allow_policy" // an Allow policy matched
+	DecisionNoMatch     Decision = "no_match"     // nothing allowed it
+)
+
+// Explanation is a trace of a permission check, returned by Explain.
+type Explanation struct {
+	UserID     string `json:"user_id"`
+	Permission string `json:"permission"`
+	ResourceID string `json:"resource_id"`
+
+	Allowed  bool     `json:"allowed"`
+	Decision Decision `json:"decision"`
+
+	// Roles are the roles the user holds on the resource; Role is the one
+	// that allowed the check, if any.
+	Roles []string `json:"roles,omitempty"`
+	Role  string   `json:"role,omitempty"`
+
+	// InheritedFrom is the ancestor organization in which the user holds
+	// Role, for DecisionInherited.
+	InheritedFrom string `json:"inherited_from,omitempty"`
+
+	// Grants are the user's grants on the resource, whatever their
+	// permission.
+	Grants []*Grant `json:"grants,omitempty"`
+
+	// Policies are the policies whose permission and roles applied, in
+	// evaluation order.
+	Policies []PolicyTrace `json:"policies,omitempty"`
+}
+
+// PolicyTrace is how a policy fared in a permission check.
+type PolicyTrace struct {
+	Name    string `json:"name"`
+	Effect  Effect `json:"effect"`
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// String summarizes the explanation on one line, for logs.
+func (explanation *Explanation) String() string {
+	verdict := "denied"
+	if explanation.Allowed {
+		verdict = "allowed"
+	}
+	summary := fmt.Sprintf("%s %s on %q for user %s: %s", verdict, explanation.Permission, explanation.ResourceID, explanation.UserID, explanation.Decision)
+	if explanation.InheritedFrom != "" {
+		summary += " (" + explanation.Role + " of " + explanation.InheritedFrom + ")"
+	} else if explanation.Role != "" {
+		summary += " (" + explanation.Role + ")"
+	}
+	for _, policy := range explanation.Policies {
+		if policy.Matched {
+			summary += " (policy " + policy.Name + ")"
+			break
+		}
+	}
+	return summary + fmt.Sprintf("; roles [%s], %d grants, %d policies evaluated",
+		strings.Join(explanation.Roles, ", "), len(explanation.Grants), len(explanation.Policies))
+}
+
+// Explain runs the same check as Can and returns an *Explanation of how
+// it was decided, for debugging "why was this user denied":
+//
+//	explanation := app.Permissions().Explain(ctx, userID, "org:update", orgID).(*permissions.Explanation)
+//	log.Println(explanation)
+func (mod *Module) Explain(ctx context.Context, userID, permission, resourceID string) any {
+	return mod.explain(ctx, userID, permission, resourceID)
+}
+
+// explain is the internal implementation.
+func (mod *Module) explain(ctx context.Context, userID, permission, resourceID string) *Explanation {
+	trace := &Explanation{UserID: userID, Permission: permission, ResourceID: resourceID}
+	trace.Allowed = mod.decide(ctx, userID, permission, resourceID, trace)
+	return trace
+}
+
+// decide is Can's logic. When trace is non-nil it records every step.
+func (mod *Module) decide(ctx context.Context, userID, permission, resourceID string, trace *Explanation) bool {
+	request := &PolicyRequest{UserID: userID, Permission: permission, ResourceID: resourceID, mod: mod}
+	if trace != nil {
+		trace.Roles = request.Roles(ctx)
+		trace.Grants = mod.grantsOn(ctx, userID, resourceID)
+	}
+
+	if mod.evaluatePolicies(ctx, request, Deny, trace) {
+		trace.decided(DecisionDenyPolicy, "")
+		return false
+	}
+	if mod.hasGrant(ctx, userID, permission, resourceID) {
+		trace.decided(DecisionGrant, "")
+		return true
+	}
+	for _, role := range request.Roles(ctx) {
+		if mod.RoleHasPermission(role, permission) {
+			trace.decided(DecisionRole, role)
+			return true
+		}
+	}
+	if ancestorID, role := mod.inheritedRole(ctx, userID, permission, resourceID); role != "" {
+		trace.decided(DecisionInherited, role)
+		trace.inherited(ancestorID)
+		return true
+	}
+	if mod.evaluatePolicies(ctx, request, Allow, trace) {
+		trace.decided(DecisionAllowPolicy, "")
+		return true
+	}
+	trace.decided(DecisionNoMatch, "")
+	return false
+}
+
+func (trace *Explanation) decided(decision Decision, role string) {
+	if trace != nil {
+		trace.Decision = decision
+		trace.Role = role
+	}
+}
+
+func (trace *Explanation) inherited(ancestorID string) {
+	if trace != nil {
+		trace.InheritedFrom = ancestorID
+	}
+}
+
+func (trace *Explanation) policy(policy Policy, matched bool, err error) {
+	if trace == nil {
+		return
+	}
+	entry := PolicyTrace{Name: policy.Name, Effect: policy.Effect, Matched: matched}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	trace.Policies = append(trace.Policies, entry)
+}
+
+// orgHierarchy is implemented by the orgs module.
+type orgHierarchy interface {
+	AncestorIDs(ctx context.Context, orgID string) []string
+}
+
+// inheritedRole returns the nearest ancestor of the organization in which
+// the user holds a role inheriting the permission, with that role, or
+// empty strings.
+func (mod *Module) inheritedRole(ctx context.Context, userID, permission, orgID string) (string, string) {
+	if len(mod.inheritedPermissions) == 0 {
+		return "", ""
+	}
+	orgsMod, ok := mod.app.TryOrgs()
+	if !ok {
+		return "", ""
+	}
+	hierarchy, ok := orgsMod.(orgHierarchy)
+	if !ok {
+		return "", ""
+	}
+	for _, ancestorID := range hierarchy.AncestorIDs(ctx, orgID) {
+		for _, role := range orgsMod.GetUserRoles(ctx, ancestorID, userID) {
+			if mod.inheritedPermissions[role][permission] {
+				return ancestorID, role
+			}
+		}
+	}
+	return "", ""
+}
+
+// grantsOn returns the user's grants on resource.
+func (mod *Module) grantsOn(ctx context.Context, userID, resource string) []*Grant {
+	if mod.store == nil {
+		return nil
+	}
+	grants, err := mod.store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil
+	}
+	var on []*Grant
+	for _, grant := range grants {
+		if grant.Resource == resource {
+			on = append(on, grant)
+		}
+	}
+	return on
+}
+
+// debugDenials reports whether denials should be logged with their
+// explanation, which costs extra lookups.
+func (mod *Module) debugDenials(ctx context.Context) bool {
+	return mod.app != nil && mod.app.Logger().Enabled(ctx, slog.LevelDebug)
+}
@@ -0,0 +1,67 @@
+package permissions
+
+import (
+	"net/http"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/auth"
+)
+
+// DeniedDetails are the details of the error envelope Require writes when
+// a request is denied.
+type DeniedDetails struct {
+	Permission string `json:"permission"`
+	Resource   string `json:"resource,omitempty"`
+}
+
+// Require returns middleware that lets a request through only if its user
+// has permission on the resource resourceID extracts from the request.
+// Place it inside auth.RequireAuth, which puts the user on the context:
+//
+//	http.Handle("/orgs/members", authMod.RequireAuth(
+//	    app.Permissions().Require("org:manage_members", func(request *http.Request) string {
+//	        return request.URL.Query().Get("org_id")
+//	    })(handler),
+//	))
+//
+// Without a session on the context the auth module, if registered, is
+// asked for the user; requests with no user get a 401 envelope. Denied
+// requests get a 403 envelope with DeniedDetails, and the denial is logged.
+func (mod *Module) Require(permission string, resourceID func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ctx := request.Context()
+			userID := auth.UserIDFromContext(ctx)
+			if authMod, ok := mod.app.TryAuth(); userID == "" && ok {
+				userID = authMod.GetUserID(ctx, request)
+			}
+			if userID == "" {
+				api.WriteError(writer, request, auth.ErrNotAuthenticated)
+				return
+			}
+
+			resource := ""
+			if resourceID != nil {
+				resource = resourceID(request)
+			}
+			if !mod.Can(ctx, userID, permission, resource) {
+				if mod.app != nil {
+					mod.app.Logger().Warn("permission denied",
+						"user_id", userID,
+						"permission", permission,
+						"resource", resource,
+						"method", request.Method,
+						"path", request.URL.Path,
+						"request_id", api.RequestID(request),
+					)
+				}
+				api.WriteError(writer, request, chassis.ErrorWithDetails(chassis.CodePermissionDenied, "permission denied",
+					DeniedDetails{Permission: permission, Resource: resource}))
+				return
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
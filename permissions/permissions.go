@@ -26,6 +26,8 @@
 //	    // User is an admin
 //	}
 //
+// Roles granted through orgs teams count like the user's own.
+//
 // # Default Permissions
 //
 // Built-in role permissions:
@@ -34,6 +36,86 @@
 //	admin:  org:read, org:update, org:delete, org:manage_members
 //	member: org:read
 //
+// # Inherited Permissions
+//
+// Roles in an organization carry some permissions over its child
+// organizations and theirs (see orgs.Module.CreateChild), so a reseller's
+// admins can manage their customers' organizations without joining each
+// one. By default owners and admins inherit org:read, org:update and
+// org:manage_members; WithInheritedPermissions changes the set, and an
+// empty map turns inheritance off:
+//
+//	permissions.New(permissions.WithInheritedPermissions(map[string][]string{
+//	    "owner": {"org:read", "org:update", "org:delete", "org:manage_members"},
+//	    "admin": {"org:read"},
+//	}))
+//
+// Can checks the user's direct roles first, then their roles in each
+// ancestor, nearest first.
+//
+// # Resource Grants
+//
+// Share individual resources with users, whatever their org roles. Can
+// checks grants before falling back to org roles:
+//
+//	err := app.Permissions().Grant(ctx, userID, "document:123", "edit")
+//	app.Permissions().Can(ctx, userID, "edit", "document:123") // true
+//	err = app.Permissions().Revoke(ctx, userID, "document:123", "edit")
+//
+// Grants are kept in SQLite at permissions.db_path (default
+// ./data/permissions.db), or a custom Store set with WithStore.
+//
+// # HTTP Middleware
+//
+// Require replaces Can checks in handlers. It runs after auth.RequireAuth
+// and writes a 403 error envelope, logging the denial, when the user lacks
+// the permission on the resource extracted from the request:
+//
+//	orgID := func(request *http.Request) string { return request.PathValue("org_id") }
+//	mux.Handle("POST /orgs/{org_id}/members", authMod.RequireAuth(
+//	    app.Permissions().Require("org:manage_members", orgID)(handler),
+//	))
+//
+// # Policies
+//
+// Policies add attribute-based rules to Can. An Allow policy grants a
+// permission its condition approves; a Deny policy withholds it whatever
+// roles and grants say. Conditions load the resource only when they ask
+// for it:
+//
+//	permissions.New(permissions.WithPolicies(
+//	    permissions.Policy{
+//	        Name:       "open-edit",
+//	        Permission: "org:update",
+//	        Roles:      []string{"member"},
+//	        Effect:     permissions.Allow,
+//	        Condition: func(ctx context.Context, request *permissions.PolicyRequest) (bool, error) {
+//	            return openEdit[request.ResourceID], nil
+//	        },
+//	    },
+//	    permissions.Policy{
+//	        Name:       "office-hours",
+//	        Permission: permissions.AllPermissions,
+//	        Effect:     permissions.Deny,
+//	        Condition: func(ctx context.Context, request *permissions.PolicyRequest) (bool, error) {
+//	            hour := time.Now().Hour()
+//	            return hour < 8 || hour >= 18, nil
+//	        },
+//	    },
+//	))
+//
+// Resources load as *orgs.Org by default; WithResourceLoader adds loaders
+// for other resource ID prefixes, for PolicyRequest.Resource.
+//
+// # Explaining Decisions
+//
+// Explain runs the same check as Can and returns an *Explanation: the
+// roles found, the grants and policies consulted and the step that decided
+// it. With the logger at debug level, Can logs every denial with its
+// explanation.
+//
+//	explanation := app.Permissions().Explain(ctx, userID, "org:update", orgID).(*permissions.Explanation)
+//
 // # Custom Permissions
 //
 // Override default permissions:
@@ -47,6 +129,9 @@ package permissions
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
 
 	"github.com/talosaether/chassis"
 )
@@ -71,10 +156,32 @@ var DefaultRolePermissions = map[string][]string{
 	},
 }
 
+// DefaultInheritedPermissions defines the permissions roles in an
+// organization carry over the organizations under it.
+var DefaultInheritedPermissions = map[string][]string{
+	"owner": {
+		"org:read",
+		"org:update",
+		"org:manage_members",
+	},
+	"admin": {
+		"org:read",
+		"org:update",
+		"org:manage_members",
+	},
+}
+
 // Module is the permissions module implementation.
 type Module struct {
-	app             *chassis.App
-	rolePermissions map[string]map[string]bool
+	app                  *chassis.App
+	rolePermissions      map[string]map[string]bool
+	inheritedPermissions map[string]map[string]bool
+	store                Store
+	dbPath               string
+
+	policyMu sync.RWMutex
+	policies []Policy
+	loaders  map[string]ResourceLoader
 }
 
 // Option is a function that configures the permissions module.
@@ -87,15 +194,44 @@ func WithRolePermissions(rolePerms map[string][]string) Option {
 	}
 }
 
+// WithInheritedPermissions sets the permissions each role in an
+// organization carries over its child organizations, and theirs. An empty
+// map turns inheritance off.
+func WithInheritedPermissions(rolePerms map[string][]string) Option {
+	return func(mod *Module) {
+		mod.inheritedPermissions = buildPermissionMap(rolePerms)
+	}
+}
+
+// WithStore sets a custom grant store implementation.
+func WithStore(store Store) Option {
+	return func(mod *Module) {
+		mod.store = store
+	}
+}
+
+// WithDBPath sets the SQLite database path of resource grants.
+func WithDBPath(path string) Option {
+	return func(mod *Module) {
+		mod.dbPath = path
+	}
+}
+
 // New creates a new permissions module with the given options.
 func New(opts ...Option) *Module {
 	mod := &Module{
-		rolePermissions: buildPermissionMap(DefaultRolePermissions),
+		rolePermissions:      buildPermissionMap(DefaultRolePermissions),
+		inheritedPermissions: buildPermissionMap(DefaultInheritedPermissions),
+		dbPath:               "./data/permissions.db",
+		loaders:              make(map[string]ResourceLoader),
 	}
 
 	for _, opt := range opts {
 		opt(mod)
 	}
+	if _, ok := mod.loaders[""]; !ok {
+		mod.loaders[""] = mod.loadOrg
+	}
 
 	return mod
 }
@@ -116,28 +252,95 @@ func (mod *Module) Name() string {
 	return "permissions"
 }
 
+// Dependencies returns the modules permissions needs. Implements
+// chassis.Dependent.
+func (mod *Module) Dependencies() []string {
+	return []string{"orgs"}
+}
+
 // Init initializes the permissions module.
 func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 	mod.app = app
-	app.Logger().Info("permissions module initialized")
+
+	for _, policy := range mod.policies {
+		if err := validatePolicy(policy); err != nil {
+			return fmt.Errorf("invalid policy %q: %w", policy.Name, err)
+		}
+	}
+
+	if cfg := app.ConfigData(); cfg != nil {
+		if dbPath := cfg.GetString("permissions.db_path"); dbPath != "" {
+			mod.dbPath = dbPath
+		}
+	}
+
+	if mod.store == nil {
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to create permissions store: %w", err)
+		}
+		mod.store = sqliteStore
+		app.Logger().Info("permissions module initialized", "db_path", mod.dbPath)
+	} else {
+		app.Logger().Info("permissions module initialized with custom store")
+	}
 	return nil
 }
 
+// openSQLiteStore creates the store on the database named by
+// permissions.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("permissions")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
 // Shutdown cleans up the permissions module.
 func (mod *Module) Shutdown(ctx context.Context) error {
+	if mod.store != nil {
+		return mod.store.Close()
+	}
 	return nil
 }
 
-// Can checks if a user has a specific permission for a resource (typically an org ID).
-func (mod *Module) Can(ctx context.Context, userID, permission, resourceID string) bool {
-	orgsModule := mod.app.Orgs()
-	userRole := orgsModule.GetUserRole(ctx, resourceID, userID)
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "permissions.db"))
+}
 
-	if userRole == "" {
-		return false
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
 	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "permissions.db"))
+}
 
-	return mod.RoleHasPermission(userRole, permission)
+// Can checks if a user has a specific permission for a resource: a grant
+// of it on the resource (see Grant), or, for an org ID, their membership
+// role or the role of any of their teams, a role in a parent organization
+// inheriting it (see WithInheritedPermissions), or an Allow policy. A Deny
+// policy whose condition holds overrides all of them.
+func (mod *Module) Can(ctx context.Context, userID, permission, resourceID string) bool {
+	if !mod.debugDenials(ctx) {
+		return mod.decide(ctx, userID, permission, resourceID, nil)
+	}
+	explanation := mod.explain(ctx, userID, permission, resourceID)
+	if !explanation.Allowed {
+		mod.app.Logger().Debug("permission denied", "explanation", explanation.String())
+	}
+	return explanation.Allowed
 }
 
 // RoleHasPermission checks if a role has a specific permission.
@@ -172,25 +375,20 @@ func (mod *Module) GetAllRoles() []string {
 	return roles
 }
 
-// HasRole checks if a user has a specific role in an organization.
+// HasRole checks if a user has a specific role in an organization, directly
+// or through a team.
 func (mod *Module) HasRole(ctx context.Context, userID, role, resourceID string) bool {
-	orgsModule := mod.app.Orgs()
-	userRole := orgsModule.GetUserRole(ctx, resourceID, userID)
-	return userRole == role
+	return mod.HasAnyRole(ctx, userID, []string{role}, resourceID)
 }
 
-// HasAnyRole checks if a user has any of the specified roles in an organization.
+// HasAnyRole checks if a user has any of the specified roles in an organization,
+// directly or through a team.
 func (mod *Module) HasAnyRole(ctx context.Context, userID string, roles []string, resourceID string) bool {
-	orgsModule := mod.app.Orgs()
-	userRole := orgsModule.GetUserRole(ctx, resourceID, userID)
-
-	if userRole == "" {
-		return false
-	}
-
-	for _, role := range roles {
-		if userRole == role {
-			return true
+	for _, userRole := range mod.app.Orgs().GetUserRoles(ctx, resourceID, userID) {
+		for _, role := range roles {
+			if userRole == role {
+				return true
+			}
 		}
 	}
 	return false
@@ -1,8 +1,14 @@
 package permissions
 
 import (
+	"context"
+	"errors"
+	"path/filepath"
 	"sort"
 	"testing"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/orgs"
 )
 
 func TestModule_Name(t *testing.T) {
@@ -164,3 +170,250 @@ func TestBuildPermissionMap(t *testing.T) {
 		t.Error("role1 should not have perm3")
 	}
 }
+
+func TestModule_Grants(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := New(WithDBPath(filepath.Join(tmpDir, "permissions.db")))
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db")))
+	app := chassis.New(chassis.WithModules(orgsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if mod.Can(ctx, "ann", "edit", "document:1") {
+		t.Fatal("nothing granted yet")
+	}
+	if err := mod.Grant(ctx, "ann", "document:1", "edit"); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if err := mod.Grant(ctx, "ann", "document:1", "edit"); err != nil {
+		t.Fatalf("granting twice should be a no-op: %v", err)
+	}
+	if err := mod.Grant(ctx, "ann", "", "edit"); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected ErrInvalidGrant, got %v", err)
+	}
+
+	if !mod.Can(ctx, "ann", "edit", "document:1") {
+		t.Error("ann should be able to edit document:1")
+	}
+	if mod.Can(ctx, "ann", "delete", "document:1") || mod.Can(ctx, "ann", "edit", "document:2") || mod.Can(ctx, "bob", "edit", "document:1") {
+		t.Error("grants should only cover their user, resource and permission")
+	}
+
+	mod.Grant(ctx, "bob", "document:1", AllPermissions)
+	if !mod.Can(ctx, "bob", "delete", "document:1") {
+		t.Error("AllPermissions should allow everything on the resource")
+	}
+	if grants, _ := mod.ListGrants(ctx, "document:1"); len(grants) != 2 {
+		t.Errorf("expected 2 grants on document:1, got %d", len(grants))
+	}
+
+	if err := mod.Revoke(ctx, "ann", "document:1", "edit"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if mod.Can(ctx, "ann", "edit", "document:1") {
+		t.Error("revoked grant should not allow")
+	}
+	if err := mod.Revoke(ctx, "ann", "document:1", "edit"); !errors.Is(err, ErrGrantNotFound) {
+		t.Errorf("expected ErrGrantNotFound, got %v", err)
+	}
+}
+
+func TestModule_Policies(t *testing.T) {
+	tmpDir := t.TempDir()
+	openEdit := map[string]bool{}
+	frozen := false
+	loaded := 0
+
+	mod := New(
+		WithDBPath(filepath.Join(tmpDir, "permissions.db")),
+		WithPolicies(
+			Policy{
+				Name:       "open-edit",
+				Permission: "org:update",
+				Roles:      []string{"member"},
+				Effect:     Allow,
+				Condition: func(ctx context.Context, request *PolicyRequest) (bool, error) {
+					resource, err := request.Resource(ctx)
+					if err != nil {
+						return false, err
+					}
+					return openEdit[resource.(*orgs.Org).Name], nil
+				},
+			},
+			Policy{
+				Name:       "freeze",
+				Permission: AllPermissions,
+				Effect:     Deny,
+				Condition: func(ctx context.Context, request *PolicyRequest) (bool, error) {
+					return frozen, nil
+				},
+			},
+		),
+		WithResourceLoader("document:", func(ctx context.Context, id string) (any, error) {
+			loaded++
+			return id, nil
+		}),
+	)
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db")))
+	app := chassis.New(chassis.WithModules(orgsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	result, _ := orgsMod.Create(ctx, orgs.CreateInput{Name: "Acme"})
+	org := result.(*orgs.Org)
+	orgsMod.AddMember(ctx, org.ID(), "member-1", "member")
+
+	if mod.Can(ctx, "member-1", "org:update", org.ID()) {
+		t.Error("members can't update without open editing")
+	}
+	openEdit["Acme"] = true
+	if !mod.Can(ctx, "member-1", "org:update", org.ID()) {
+		t.Error("open-edit policy should let members update")
+	}
+	if mod.Can(ctx, "stranger", "org:update", org.ID()) {
+		t.Error("open-edit policy only applies to members")
+	}
+
+	frozen = true
+	if mod.Can(ctx, "member-1", "org:read", org.ID()) {
+		t.Error("deny policy should override roles")
+	}
+	mod.Grant(ctx, "member-1", "document:1", "edit")
+	if mod.Can(ctx, "member-1", "edit", "document:1") {
+		t.Error("deny policy should override grants")
+	}
+	frozen = false
+
+	err := mod.AddPolicy(Policy{
+		Name:       "broken",
+		Permission: "view",
+		Effect:     Deny,
+		Condition: func(ctx context.Context, request *PolicyRequest) (bool, error) {
+			if _, err := request.Resource(ctx); err != nil {
+				return false, err
+			}
+			return false, errors.New("lookup failed")
+		},
+	})
+	if err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	mod.Grant(ctx, "member-1", "document:1", "view")
+	if mod.Can(ctx, "member-1", "view", "document:1") {
+		t.Error("failing deny conditions should deny")
+	}
+	if loaded != 1 {
+		t.Errorf("expected the document loader to run once, got %d", loaded)
+	}
+
+	if err := mod.AddPolicy(Policy{Name: "incomplete", Permission: "view"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("expected ErrInvalidPolicy, got %v", err)
+	}
+}
+
+func TestModule_Explain(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := New(
+		WithDBPath(filepath.Join(tmpDir, "permissions.db")),
+		WithPolicies(Policy{
+			Name:       "readonly",
+			Permission: "org:delete",
+			Effect:     Deny,
+			Condition: func(ctx context.Context, request *PolicyRequest) (bool, error) {
+				return request.UserID == "admin-2", nil
+			},
+		}),
+	)
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db")))
+	app := chassis.New(chassis.WithModules(orgsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	result, _ := orgsMod.Create(ctx, orgs.CreateInput{Name: "Acme"})
+	org := result.(*orgs.Org)
+	orgsMod.AddMember(ctx, org.ID(), "admin-1", "admin")
+	orgsMod.AddMember(ctx, org.ID(), "admin-2", "admin")
+	mod.Grant(ctx, "admin-1", org.ID(), "billing:view")
+
+	tests := []struct {
+		userID     string
+		permission string
+		allowed    bool
+		decision   Decision
+	}{
+		{"admin-1", "org:delete", true, DecisionRole},
+		{"admin-1", "billing:view", true, DecisionGrant},
+		{"admin-2", "org:delete", false, DecisionDenyPolicy},
+		{"admin-1", "org:manage_roles", false, DecisionNoMatch},
+	}
+	for _, tt := range tests {
+		explanation := mod.Explain(ctx, tt.userID, tt.permission, org.ID()).(*Explanation)
+		if explanation.Allowed != tt.allowed || explanation.Decision != tt.decision {
+			t.Errorf("%s %s: got %v/%s, want %v/%s", tt.userID, tt.permission, explanation.Allowed, explanation.Decision, tt.allowed, tt.decision)
+		}
+		if explanation.Allowed != mod.Can(ctx, tt.userID, tt.permission, org.ID()) {
+			t.Errorf("%s %s: Explain and Can disagree", tt.userID, tt.permission)
+		}
+	}
+
+	explanation := mod.Explain(ctx, "admin-2", "org:delete", org.ID()).(*Explanation)
+	if len(explanation.Policies) != 1 || !explanation.Policies[0].Matched || explanation.Policies[0].Name != "readonly" {
+		t.Errorf("expected the readonly policy to be traced, got %+v", explanation.Policies)
+	}
+	explanation = mod.Explain(ctx, "admin-1", "org:delete", org.ID()).(*Explanation)
+	if explanation.Role != "admin" || len(explanation.Roles) != 1 || len(explanation.Grants) != 1 {
+		t.Errorf("expected role admin and one grant consulted, got %+v", explanation)
+	}
+}
+
+func TestModule_InheritedPermissions(t *testing.T) {
+	tmpDir := t.TempDir()
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(tmpDir, "orgs.db")))
+	mod := New(WithDBPath(filepath.Join(tmpDir, "permissions.db")))
+	app := chassis.New(chassis.WithModules(orgsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	result, _ := orgsMod.Create(ctx, orgs.CreateInput{Name: "Reseller"})
+	reseller := result.(*orgs.Org)
+	result, _ = app.Orgs().CreateChild(ctx, reseller.ID(), orgs.CreateInput{Name: "Acme"})
+	acme := result.(*orgs.Org)
+	result, _ = orgsMod.CreateChild(ctx, acme.ID(), orgs.CreateInput{Name: "Acme Labs"})
+	labs := result.(*orgs.Org)
+	orgsMod.AddMember(ctx, reseller.ID(), "ann", "admin")
+	orgsMod.AddMember(ctx, reseller.ID(), "bob", "member")
+
+	if !mod.Can(ctx, "ann", "org:manage_members", labs.ID()) {
+		t.Error("expected a parent admin to manage a grandchild's members")
+	}
+	if mod.Can(ctx, "ann", "org:delete", acme.ID()) {
+		t.Error("org:delete should not be inherited by default")
+	}
+	if mod.Can(ctx, "bob", "org:read", acme.ID()) {
+		t.Error("parent members should inherit nothing by default")
+	}
+	if mod.Can(ctx, "ann", "org:read", "elsewhere") {
+		t.Error("expected nothing outside the hierarchy")
+	}
+
+	explanation := mod.Explain(ctx, "ann", "org:update", labs.ID()).(*Explanation)
+	if explanation.Decision != DecisionInherited || explanation.Role != "admin" || explanation.InheritedFrom != reseller.ID() {
+		t.Errorf("expected the admin role inherited from the reseller, got %+v", explanation)
+	}
+
+	WithInheritedPermissions(nil)(mod)
+	if mod.Can(ctx, "ann", "org:read", acme.ID()) {
+		t.Error("expected no inheritance with WithInheritedPermissions(nil)")
+	}
+}
+
+func TestModule_RequiresOrgs(t *testing.T) {
+	app := chassis.New()
+	err := app.Register(context.Background(), New(WithDBPath(filepath.Join(t.TempDir(), "permissions.db"))))
+	if !errors.Is(err, chassis.ErrMissingDependency) || err.Error() != "missing module dependency: permissions requires orgs module" {
+		t.Errorf("expected a missing dependency error, got %v", err)
+	}
+	if app.HasModule("permissions") {
+		t.Error("permissions should not be registered without orgs")
+	}
+}
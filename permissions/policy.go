@@ -0,0 +1,214 @@
+package permissions
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrInvalidPolicy = chassis.NewError(chassis.CodeInvalidArgument, "policies need a name, a permission and a condition")
+
+// Effect is what a policy does when its condition holds.
+type Effect int
+
+const (
+	// Allow grants the permission, on top of roles and grants.
+	Allow Effect = iota
+	// Deny withholds the permission, whatever roles and grants say.
+	Deny
+)
+
+// String returns "allow" or "deny".
+func (effect Effect) String() string {
+	if effect == Deny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// MarshalText encodes the effect as its String.
+func (effect Effect) MarshalText() ([]byte, error) {
+	return []byte(effect.String()), nil
+}
+
+// Policy is an attribute-based rule Can evaluates alongside roles and
+// grants, such as "members can update an org that allows open editing" or
+// "nobody deletes anything outside office hours".
+type Policy struct {
+	// Name identifies the policy in logs.
+	Name string
+
+	// Permission is the permission the policy applies to, or
+	// AllPermissions for every permission.
+	Permission string
+
+	// Roles restricts the policy to users holding one of them on the
+	// resource; empty applies it to every user.
+	Roles []string
+
+	Effect Effect
+
+	// Condition decides whether the policy applies to a check. An error
+	// counts as false for Allow policies and true for Deny policies, so
+	// failures never widen access.
+	Condition func(ctx context.Context, request *PolicyRequest) (bool, error)
+}
+
+// ResourceLoader loads the resource a permission is checked on, for
+// policy conditions.
+type ResourceLoader func(ctx context.Context, resourceID string) (any, error)
+
+// PolicyRequest is the permission check a policy condition is asked
+// about. The user's roles and the resource are loaded on first use, so
+// conditions that don't need them cost nothing.
+type PolicyRequest struct {
+	UserID     string
+	Permission string
+	ResourceID string
+
+	mod       *Module
+	rolesOnce sync.Once
+	roles     []string
+	loadOnce  sync.Once
+	resource  any
+	loadErr   error
+}
+
+// Roles returns the roles the user holds on the resource, directly or
+// through teams. It is empty unless the resource is an organization.
+func (request *PolicyRequest) Roles(ctx context.Context) []string {
+	request.rolesOnce.Do(func() {
+		if orgsMod, ok := request.mod.app.TryOrgs(); ok {
+			request.roles = orgsMod.GetUserRoles(ctx, request.ResourceID, request.UserID)
+		}
+	})
+	return request.roles
+}
+
+// Resource loads the resource with the loader registered for its ID
+// (see WithResourceLoader). Organizations load as *orgs.Org by default.
+func (request *PolicyRequest) Resource(ctx context.Context) (any, error) {
+	request.loadOnce.Do(func() {
+		loader := request.mod.resourceLoader(request.ResourceID)
+		if loader == nil {
+			request.loadErr = chassis.NewError(chassis.CodeNotFound, "no loader for resource "+request.ResourceID)
+			return
+		}
+		request.resource, request.loadErr = loader(ctx, request.ResourceID)
+	})
+	return request.resource, request.loadErr
+}
+
+// WithPolicies registers policies for Can to evaluate.
+func WithPolicies(policies ...Policy) Option {
+	return func(mod *Module) {
+		mod.policies = append(mod.policies, policies...)
+	}
+}
+
+// WithResourceLoader sets how resources whose ID starts with prefix are
+// loaded for policy conditions; the longest matching prefix wins. The ""
+// prefix replaces the default loader, which loads organizations.
+//
+//	permissions.WithResourceLoader("document:", func(ctx context.Context, id string) (any, error) {
+//	    return documents.Get(ctx, strings.TrimPrefix(id, "document:"))
+//	})
+func WithResourceLoader(prefix string, loader ResourceLoader) Option {
+	return func(mod *Module) {
+		mod.loaders[prefix] = loader
+	}
+}
+
+// AddPolicy registers a policy after the module is created.
+func (mod *Module) AddPolicy(policy Policy) error {
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+	mod.policyMu.Lock()
+	defer mod.policyMu.Unlock()
+	mod.policies = append(mod.policies, policy)
+	return nil
+}
+
+func validatePolicy(policy Policy) error {
+	if policy.Name == "" || policy.Permission == "" || policy.Condition == nil {
+		return ErrInvalidPolicy
+	}
+	if policy.Effect != Allow && policy.Effect != Deny {
+		return ErrInvalidPolicy
+	}
+	return nil
+}
+
+// loadOrg is the default resource loader.
+func (mod *Module) loadOrg(ctx context.Context, resourceID string) (any, error) {
+	orgsMod, ok := mod.app.TryOrgs()
+	if !ok {
+		return nil, chassis.NewError(chassis.CodeNotFound, "no loader for resource "+resourceID)
+	}
+	return orgsMod.GetByID(ctx, resourceID)
+}
+
+func (mod *Module) resourceLoader(resourceID string) ResourceLoader {
+	var (
+		loader  ResourceLoader
+		longest = -1
+	)
+	for prefix, candidate := range mod.loaders {
+		if strings.HasPrefix(resourceID, prefix) && len(prefix) > longest {
+			loader, longest = candidate, len(prefix)
+		}
+	}
+	return loader
+}
+
+// evaluatePolicies reports whether a policy with effect applies to
+// request, recording the policies it evaluates in trace.
+func (mod *Module) evaluatePolicies(ctx context.Context, request *PolicyRequest, effect Effect, trace *Explanation) bool {
+	mod.policyMu.RLock()
+	policies := mod.policies
+	mod.policyMu.RUnlock()
+
+	for _, policy := range policies {
+		if policy.Effect != effect || !policy.appliesTo(ctx, request) {
+			continue
+		}
+		matched, err := policy.Condition(ctx, request)
+		if err != nil {
+			if mod.app != nil {
+				mod.app.Logger().Warn("policy condition failed",
+					"policy", policy.Name,
+					"user_id", request.UserID,
+					"permission", request.Permission,
+					"resource", request.ResourceID,
+					"error", err,
+				)
+			}
+			matched = effect == Deny
+		}
+		trace.policy(policy, matched, err)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy Policy) appliesTo(ctx context.Context, request *PolicyRequest) bool {
+	if policy.Permission != AllPermissions && policy.Permission != request.Permission {
+		return false
+	}
+	if len(policy.Roles) == 0 {
+		return true
+	}
+	for _, held := range request.Roles(ctx) {
+		for _, role := range policy.Roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package permissions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/talosaether/chassis/internal/sqlite"
+)
+
+// Store defines the interface for resource grant persistence.
+type Store interface {
+	Grant(ctx context.Context, grant *Grant) error // no-op if already granted
+	Revoke(ctx context.Context, userID, resource, permission string) error
+	HasGrant(ctx context.Context, userID, resource string, permissions ...string) (bool, error)
+	ListByResource(ctx context.Context, resource string) ([]*Grant, error)
+	ListByUser(ctx context.Context, userID string) ([]*Grant, error)
+	DeleteByUser(ctx context.Context, userID string) error
+	Close() error
+}
+
+// SQLiteStore implements Store using SQLite.
+type SQLiteStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteStore creates a new SQLite-backed grant store.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewSQLiteStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteStoreFromDB creates a grant store on a database the caller
+// owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
+	schema := `
+		CREATE TABLE IF NOT EXISTS grants (
+			user_id TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			permission TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY(resource, user_id, permission)
+		);
+		CREATE INDEX IF NOT EXISTS idx_grants_user_id ON grants(user_id);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (store *SQLiteStore) Grant(ctx context.Context, grant *Grant) error {
+	query := `INSERT OR IGNORE INTO grants (user_id, resource, permission, created_at) VALUES (?, ?, ?, ?)`
+	_, err := store.db.ExecContext(ctx, query, grant.UserID, grant.Resource, grant.Permission, grant.CreatedAt)
+	return err
+}
+
+func (store *SQLiteStore) Revoke(ctx context.Context, userID, resource, permission string) error {
+	query := `DELETE FROM grants WHERE user_id = ? AND resource = ? AND permission = ?`
+	result, err := store.db.ExecContext(ctx, query, userID, resource, permission)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrGrantNotFound
+	}
+	return nil
+}
+
+// HasGrant reports whether userID holds any of permissions on resource.
+func (store *SQLiteStore) HasGrant(ctx context.Context, userID, resource string, permissions ...string) (bool, error) {
+	if len(permissions) == 0 {
+		return false, nil
+	}
+	query := `SELECT COUNT(*) FROM grants WHERE user_id = ? AND resource = ? AND permission IN (?` + strings.Repeat(", ?", len(permissions)-1) + `)`
+	args := []any{userID, resource}
+	for _, permission := range permissions {
+		args = append(args, permission)
+	}
+	var count int
+	if err := store.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (store *SQLiteStore) ListByResource(ctx context.Context, resource string) ([]*Grant, error) {
+	query := `SELECT user_id, resource, permission, created_at FROM grants WHERE resource = ? ORDER BY created_at, user_id, permission`
+	return store.query(ctx, query, resource)
+}
+
+func (store *SQLiteStore) ListByUser(ctx context.Context, userID string) ([]*Grant, error) {
+	query := `SELECT user_id, resource, permission, created_at FROM grants WHERE user_id = ? ORDER BY resource, permission`
+	return store.query(ctx, query, userID)
+}
+
+func (store *SQLiteStore) query(ctx context.Context, query string, args ...any) ([]*Grant, error) {
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	grants := make([]*Grant, 0)
+	for rows.Next() {
+		grant := &Grant{}
+		if err := rows.Scan(&grant.UserID, &grant.Resource, &grant.Permission, &grant.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+func (store *SQLiteStore) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM grants WHERE user_id = ?`, userID)
+	return err
+}
+
+func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/talosaether/chassis"
+)
+
+// orgChecker is implemented by orgs modules that tell an organization
+// scheduled for deletion from one that is gone; orgs.Module does.
+type orgChecker interface {
+	Exists(ctx context.Context, orgID string) (bool, error)
+}
+
+// Check finds pending jobs whose payload names an org_id that no longer
+// exists, when the orgs module is registered. Such jobs would fail or act on
+// deleted data when processed. An organization still in its deletion grace
+// period exists, since it can be restored. Implements chassis.Checker.
+func (mod *Module) Check(ctx context.Context) ([]chassis.Issue, error) {
+	orgsMod, ok := mod.app.TryOrgs()
+	if !ok {
+		return nil, nil
+	}
+
+	jobs, err := mod.store.GetByStatus(ctx, StatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+
+	orgExistence := make(map[string]bool)
+	var issues []chassis.Issue
+	for _, job := range jobs {
+		var payload struct {
+			OrgID string `json:"org_id"`
+		}
+		if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.OrgID == "" {
+			continue
+		}
+
+		exists, seen := orgExistence[payload.OrgID]
+		if !seen {
+			exists, err = orgExists(ctx, orgsMod, payload.OrgID)
+			if err != nil {
+				return nil, err
+			}
+			orgExistence[payload.OrgID] = exists
+		}
+		if exists {
+			continue
+		}
+
+		jobID, orgID := job.ID, payload.OrgID
+		issues = append(issues, chassis.Issue{
+			Module:   mod.Name(),
+			Kind:     "orphaned_job",
+			Resource: jobID,
+			Message:  fmt.Sprintf("pending %s job %s belongs to deleted org %s", job.Type, jobID, orgID),
+			Repair:   "mark job " + jobID + " as failed",
+			Fix: func(ctx context.Context) error {
+				return mod.Fail(ctx, jobID, fmt.Errorf("org %s no longer exists", orgID))
+			},
+		})
+	}
+	return issues, nil
+}
+
+// orgExists reports whether orgID exists, asking orgsMod's Exists if it
+// has one, since GetByID hides organizations scheduled for deletion.
+func orgExists(ctx context.Context, orgsMod chassis.OrgsModule, orgID string) (bool, error) {
+	if checker, ok := orgsMod.(orgChecker); ok {
+		return checker.Exists(ctx, orgID)
+	}
+	_, err := orgsMod.GetByID(ctx, orgID)
+	if err != nil && chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+		return false, err
+	}
+	return err == nil, nil
+}
@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// ErrDrainTimeout is the cause of a handler's context cancellation when its
+// worker stopped and the handler didn't finish within the drain timeout.
+var ErrDrainTimeout = chassis.NewError(chassis.CodeUnavailable, "queue worker stopped before the job finished")
+
+// DefaultDrainTimeout is how long a stopping worker waits for its in-flight
+// job. It is below chassis.DefaultShutdownTimeout, so app.Run has time to
+// release jobs before it gives up on the queue.
+const DefaultDrainTimeout = 20 * time.Second
+
+// WithDrainTimeout sets how long a worker whose context is cancelled waits
+// for the job it is running before releasing it. Zero releases in-flight
+// jobs as soon as the worker stops. Defaults to DefaultDrainTimeout.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(mod *Module) {
+		if timeout >= 0 {
+			mod.drainTimeout = timeout
+		}
+	}
+}
+
+// run calls the handler with a context that outlives the worker's by the
+// drain timeout. It returns the handler's error, or ErrDrainTimeout when
+// the worker stopped and the handler didn't finish in time; the handler's
+// context is then cancelled with that cause and its result is ignored.
+func (mod *Module) run(ctx context.Context, handler Handler, job *Job) error {
+	handlerCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancel(nil)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- mod.runHandler(handlerCtx, handler, job)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+
+	mod.app.Logger().Info("waiting for in-flight job", "job_id", job.ID, "type", job.Type, "timeout", mod.drainTimeout)
+	timer := time.NewTimer(mod.drainTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		cancel(ErrDrainTimeout)
+		return ErrDrainTimeout
+	}
+}
+
+// release puts a job its worker gave up on back in the queue, so another
+// worker runs it from the start.
+func (mod *Module) release(ctx context.Context, job *Job) {
+	if err := mod.store.UpdateStatus(ctx, job.ID, StatusPending, "", nil); err != nil {
+		mod.app.Logger().Error("failed to release in-flight job", "job_id", job.ID, "error", err)
+		return
+	}
+	mod.app.Logger().Warn("in-flight job released", "job_id", job.ID, "type", job.Type)
+}
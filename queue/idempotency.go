@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore records idempotency keys of jobs that completed successfully.
+type IdempotencyStore interface {
+	IsCompleted(ctx context.Context, key string) (bool, error)
+	MarkCompleted(ctx context.Context, key string) error
+}
+
+// KeyFunc derives an idempotency key from a job.
+// Returning an empty string runs the handler without idempotency tracking.
+type KeyFunc func(job *Job) string
+
+// JobIDKey uses the job ID as the idempotency key. A redelivered job keeps
+// its ID, so this protects against re-execution after a requeue.
+func JobIDKey(job *Job) string {
+	return job.ID
+}
+
+type idempotencyConfig struct {
+	store IdempotencyStore
+}
+
+// IdempotencyOption configures the Idempotent middleware.
+type IdempotencyOption func(*idempotencyConfig)
+
+// WithIdempotencyStore sets where completed keys are recorded.
+// Use the module's SQLite store (it implements IdempotencyStore) for durability,
+// or NewCacheIdempotencyStore to share keys through the cache module.
+func WithIdempotencyStore(store IdempotencyStore) IdempotencyOption {
+	return func(cfg *idempotencyConfig) {
+		cfg.store = store
+	}
+}
+
+// Idempotent wraps a handler so that a job whose key has already completed is
+// acknowledged without running the handler again. Keys are recorded only after
+// the handler succeeds, so failed jobs are still retried.
+//
+// This gives at-least-once workers effectively-once side effects on redelivery.
+// It does not serialize two workers running the same key concurrently.
+//
+//	worker := queue.Idempotent(sendEmail, func(job *queue.Job) string {
+//	    var payload struct{ MessageID string }
+//	    _ = json.Unmarshal(job.Payload, &payload)
+//	    return "send_email:" + payload.MessageID
+//	}, queue.WithIdempotencyStore(queueMod.IdempotencyStore()))
+//
+// A nil keyFn uses JobIDKey. Without WithIdempotencyStore, keys are kept in memory.
+func Idempotent(handler Handler, keyFn KeyFunc, opts ...IdempotencyOption) Handler {
+	cfg := &idempotencyConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.store == nil {
+		cfg.store = NewMemoryIdempotencyStore()
+	}
+	if keyFn == nil {
+		keyFn = JobIDKey
+	}
+
+	return func(ctx context.Context, job *Job) error {
+		key := keyFn(job)
+		if key == "" {
+			return handler(ctx, job)
+		}
+
+		done, err := cfg.store.IsCompleted(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to check idempotency key: %w", err)
+		}
+		if done {
+			return nil
+		}
+
+		if err := handler(ctx, job); err != nil {
+			return err
+		}
+
+		if err := cfg.store.MarkCompleted(ctx, key); err != nil {
+			return fmt.Errorf("job succeeded but idempotency key was not recorded: %w", err)
+		}
+		return nil
+	}
+}
+
+// IdempotencyStore returns the module's store as an IdempotencyStore.
+// Returns nil if the configured store doesn't support idempotency tracking.
+func (mod *Module) IdempotencyStore() IdempotencyStore {
+	idempotencyStore, _ := mod.store.(IdempotencyStore)
+	return idempotencyStore
+}
+
+// MemoryIdempotencyStore keeps completed keys in process memory.
+type MemoryIdempotencyStore struct {
+	mu   sync.RWMutex
+	keys map[string]struct{}
+}
+
+// NewMemoryIdempotencyStore creates an in-memory idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{keys: make(map[string]struct{})}
+}
+
+func (store *MemoryIdempotencyStore) IsCompleted(ctx context.Context, key string) (bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	_, done := store.keys[key]
+	return done, nil
+}
+
+func (store *MemoryIdempotencyStore) MarkCompleted(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.keys[key] = struct{}{}
+	return nil
+}
+
+// TTLCache is the subset of the cache module used to record idempotency keys.
+// The cache module's *cache.Module implements this interface.
+type TTLCache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CacheIdempotencyStore records completed keys in a cache with a TTL.
+type CacheIdempotencyStore struct {
+	cache  TTLCache
+	ttl    time.Duration
+	prefix string
+}
+
+// NewCacheIdempotencyStore creates an idempotency store backed by a cache.
+// Keys are forgotten after ttl, so it should exceed the longest redelivery delay.
+func NewCacheIdempotencyStore(cache TTLCache, ttl time.Duration) *CacheIdempotencyStore {
+	return &CacheIdempotencyStore{cache: cache, ttl: ttl, prefix: "queue:idempotency:"}
+}
+
+func (store *CacheIdempotencyStore) IsCompleted(ctx context.Context, key string) (bool, error) {
+	_, found := store.cache.Get(ctx, store.prefix+key)
+	return found, nil
+}
+
+func (store *CacheIdempotencyStore) MarkCompleted(ctx context.Context, key string) error {
+	return store.cache.SetWithTTL(ctx, store.prefix+key, []byte{1}, store.ttl)
+}
@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLimitPeriod is the period of a Limit's Rate when Per is zero.
+const DefaultLimitPeriod = time.Minute
+
+// limitPollInterval is how often a worker holding a job over its
+// concurrency limit checks for a free slot.
+const limitPollInterval = 50 * time.Millisecond
+
+// Limit caps how fast the worker pool runs jobs of one type, e.g. to stay
+// within an external API's quota. Limits are enforced per process across
+// the workers started by Start and Worker.
+type Limit struct {
+	// Concurrency is how many jobs of the type may run at once; zero
+	// means no limit.
+	Concurrency int
+	// Rate is how many jobs of the type may start per Per; zero means no
+	// limit. Up to Rate jobs may start in a burst.
+	Rate int
+	// Per is the period of Rate. Defaults to DefaultLimitPeriod.
+	Per time.Duration
+}
+
+// WithLimit sets the concurrency and rate limit of a job type:
+//
+//	queue.New(
+//	    queue.WithLimit("video_encode", queue.Limit{Concurrency: 2}),
+//	    queue.WithLimit("send_email", queue.Limit{Rate: 100, Per: time.Minute}),
+//	)
+func WithLimit(jobType string, limit Limit) Option {
+	return func(mod *Module) {
+		if mod.limits == nil {
+			mod.limits = newLimiter()
+		}
+		mod.limits.set(jobType, limit)
+	}
+}
+
+// ExceptDequeuer is implemented by stores that can claim the next job
+// while skipping some types, which lets workers pass over job types at
+// their limit. SQLiteStore and MemoryStore implement it; with other stores
+// a worker that claims a job over its limit holds it until the limit
+// allows it to run.
+type ExceptDequeuer interface {
+	DequeueExcept(ctx context.Context, excluded []string) (*Job, error)
+}
+
+// limiter tracks the running jobs and rate tokens of limited job types.
+type limiter struct {
+	mu    sync.Mutex
+	types map[string]*typeLimit
+	now   func() time.Time
+}
+
+type typeLimit struct {
+	Limit
+	running int
+	tokens  float64
+	updated time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{types: make(map[string]*typeLimit), now: time.Now}
+}
+
+func (lim *limiter) set(jobType string, limit Limit) {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	if limit.Per <= 0 {
+		limit.Per = DefaultLimitPeriod
+	}
+	lim.types[jobType] = &typeLimit{Limit: limit, tokens: float64(limit.Rate), updated: lim.now()}
+}
+
+// refill adds the tokens earned since the last update. Callers hold
+// lim.mu.
+func (lim *limiter) refill(state *typeLimit) {
+	if state.Rate <= 0 {
+		return
+	}
+	now := lim.now()
+	state.tokens += now.Sub(state.updated).Seconds() * float64(state.Rate) / state.Per.Seconds()
+	state.tokens = min(state.tokens, float64(state.Rate))
+	state.updated = now
+}
+
+// blocked returns the job types that can't start now, sorted.
+func (lim *limiter) blocked() []string {
+	if lim == nil {
+		return nil
+	}
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	var types []string
+	for jobType, state := range lim.types {
+		lim.refill(state)
+		if (state.Concurrency > 0 && state.running >= state.Concurrency) || (state.Rate > 0 && state.tokens < 1) {
+			types = append(types, jobType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// try takes a concurrency slot and rate token for jobType. It returns the
+// function releasing the slot, or how long to wait before trying again.
+func (lim *limiter) try(jobType string) (func(), time.Duration) {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	state, ok := lim.types[jobType]
+	if !ok {
+		return func() {}, 0
+	}
+	lim.refill(state)
+	if state.Concurrency > 0 && state.running >= state.Concurrency {
+		return nil, limitPollInterval
+	}
+	if state.Rate > 0 && state.tokens < 1 {
+		return nil, time.Duration((1 - state.tokens) * float64(state.Per) / float64(state.Rate))
+	}
+	state.running++
+	if state.Rate > 0 {
+		state.tokens--
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lim.mu.Lock()
+			defer lim.mu.Unlock()
+			state.running--
+		})
+	}, 0
+}
+
+// acquire waits until jobType may start and returns the function releasing
+// its slot. It returns false if ctx ends first.
+func (lim *limiter) acquire(ctx context.Context, jobType string) (func(), bool) {
+	if lim == nil {
+		return func() {}, true
+	}
+	for {
+		done, wait := lim.try(jobType)
+		if done != nil {
+			return done, true
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false
+		case <-timer.C:
+		}
+	}
+}
+
+// next claims the next job whose type isn't at its limit, when the store
+// allows skipping types.
+func (mod *Module) next(ctx context.Context) (*Job, error) {
+	blocked := mod.limits.blocked()
+	if dequeuer, ok := mod.store.(ExceptDequeuer); ok && len(blocked) > 0 {
+		return dequeuer.DequeueExcept(ctx, blocked)
+	}
+	return mod.dequeue(ctx)
+}
@@ -0,0 +1,234 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+var errJobExists = errors.New("queue: job already exists")
+
+// MemoryStore is a Store that keeps jobs in process memory, for tests and
+// short-lived tools. It behaves like the SQLite store: Dequeue claims the
+// oldest pending job atomically, lists come back in the same order, and it
+// implements the optional OrgLister, Purger, ExceptDequeuer, CrashCounter
+// and IdempotencyStore interfaces. Jobs are lost when the process exits.
+type MemoryStore struct {
+	*MemoryIdempotencyStore
+	*MemoryCrashCounter
+
+	mu   sync.Mutex
+	jobs []*Job // in creation order
+}
+
+// NewMemoryStore creates an empty in-memory queue store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryIdempotencyStore: NewMemoryIdempotencyStore(),
+		MemoryCrashCounter:     NewMemoryCrashCounter(),
+	}
+}
+
+func (store *MemoryStore) Create(ctx context.Context, job *Job) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.find(job.ID) != nil {
+		return errJobExists
+	}
+	store.jobs = append(store.jobs, copyJob(job))
+	return nil
+}
+
+func (store *MemoryStore) GetByID(ctx context.Context, id string) (*Job, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job := store.find(id)
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+// GetAll returns every job, oldest first.
+func (store *MemoryStore) GetAll(ctx context.Context) ([]*Job, error) {
+	return store.where(func(job *Job) bool { return true }), nil
+}
+
+// GetByStatus returns the jobs with status, oldest first, or nil like the
+// SQLite store.
+func (store *MemoryStore) GetByStatus(ctx context.Context, status JobStatus) ([]*Job, error) {
+	jobs := store.where(withStatus(status))
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return jobs, nil
+}
+
+// GetAllPaginated returns a page of jobs, newest first.
+func (store *MemoryStore) GetAllPaginated(ctx context.Context, offset, limit int) ([]*Job, error) {
+	return pageOf(newestFirst(store.where(func(job *Job) bool { return true })), offset, limit), nil
+}
+
+// GetByStatusPaginated returns a page of jobs with status, newest first.
+func (store *MemoryStore) GetByStatusPaginated(ctx context.Context, status JobStatus, offset, limit int) ([]*Job, error) {
+	return pageOf(newestFirst(store.where(withStatus(status))), offset, limit), nil
+}
+
+// GetByOrgPaginated returns a page of the org's jobs, newest first. An
+// empty status matches every status.
+func (store *MemoryStore) GetByOrgPaginated(ctx context.Context, orgID string, status JobStatus, offset, limit int) ([]*Job, error) {
+	return pageOf(newestFirst(store.where(orgJobs(orgID, status))), offset, limit), nil
+}
+
+// CountByOrg counts the org's jobs. An empty status matches every status.
+func (store *MemoryStore) CountByOrg(ctx context.Context, orgID string, status JobStatus) (int, error) {
+	return len(store.where(orgJobs(orgID, status))), nil
+}
+
+func (store *MemoryStore) CountAll(ctx context.Context) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.jobs), nil
+}
+
+func (store *MemoryStore) CountByStatus(ctx context.Context, status JobStatus) (int, error) {
+	return len(store.where(withStatus(status))), nil
+}
+
+func (store *MemoryStore) Dequeue(ctx context.Context) (*Job, error) {
+	return store.claim(func(job *Job) bool { return true })
+}
+
+func (store *MemoryStore) DequeueByType(ctx context.Context, jobType string) (*Job, error) {
+	return store.claim(func(job *Job) bool { return job.Type == jobType })
+}
+
+// DequeueExcept claims the oldest pending job whose type isn't excluded.
+func (store *MemoryStore) DequeueExcept(ctx context.Context, excluded []string) (*Job, error) {
+	return store.claim(func(job *Job) bool { return !slices.Contains(excluded, job.Type) })
+}
+
+func (store *MemoryStore) UpdateStatus(ctx context.Context, id string, status JobStatus, errMsg string, processedAt *time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job := store.find(id)
+	if job == nil {
+		return ErrJobNotFound
+	}
+	job.Status, job.Error = status, errMsg
+	job.ProcessedAt = nil
+	if processedAt != nil {
+		processed := *processedAt
+		job.ProcessedAt = &processed
+	}
+	return nil
+}
+
+// FinishedBefore returns up to limit jobs with one of statuses processed
+// before cutoff, oldest first.
+func (store *MemoryStore) FinishedBefore(ctx context.Context, cutoff time.Time, statuses []JobStatus, limit int) ([]*Job, error) {
+	jobs := store.where(func(job *Job) bool {
+		return slices.Contains(statuses, job.Status) && job.ProcessedAt != nil && job.ProcessedAt.Before(cutoff)
+	})
+	slices.SortStableFunc(jobs, func(a, b *Job) int { return a.ProcessedAt.Compare(*b.ProcessedAt) })
+	return pageOf(jobs, 0, limit), nil
+}
+
+// DeleteJobs deletes jobs and their crash counts.
+func (store *MemoryStore) DeleteJobs(ctx context.Context, ids []string) (int, error) {
+	store.mu.Lock()
+	before := len(store.jobs)
+	store.jobs = slices.DeleteFunc(store.jobs, func(job *Job) bool { return slices.Contains(ids, job.ID) })
+	deleted := before - len(store.jobs)
+	store.mu.Unlock()
+
+	for _, id := range ids {
+		_ = store.ResetCrashes(ctx, id)
+	}
+	return deleted, nil
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+// claim marks the oldest matching pending job as processing and returns
+// it.
+func (store *MemoryStore) claim(match func(job *Job) bool) (*Job, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var oldest *Job
+	for _, job := range store.jobs {
+		if job.Status == StatusPending && match(job) && (oldest == nil || job.CreatedAt.Before(oldest.CreatedAt)) {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return nil, ErrNoJobs
+	}
+	oldest.Status = StatusProcessing
+	return copyJob(oldest), nil
+}
+
+// where returns copies of the matching jobs, oldest first.
+func (store *MemoryStore) where(match func(job *Job) bool) []*Job {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	found := make([]*Job, 0)
+	for _, job := range store.jobs {
+		if match(job) {
+			found = append(found, copyJob(job))
+		}
+	}
+	slices.SortStableFunc(found, func(a, b *Job) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return found
+}
+
+func (store *MemoryStore) find(id string) *Job {
+	for _, job := range store.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func withStatus(status JobStatus) func(job *Job) bool {
+	return func(job *Job) bool { return job.Status == status }
+}
+
+func orgJobs(orgID string, status JobStatus) func(job *Job) bool {
+	return func(job *Job) bool {
+		return job.OrgID == orgID && (status == "" || job.Status == status)
+	}
+}
+
+func newestFirst(jobs []*Job) []*Job {
+	slices.Reverse(jobs)
+	return jobs
+}
+
+// pageOf returns jobs[offset:offset+limit], clamped to the slice.
+func pageOf(jobs []*Job, offset, limit int) []*Job {
+	if offset >= len(jobs) {
+		return jobs[:0]
+	}
+	jobs = jobs[offset:]
+	if limit >= 0 && limit < len(jobs) {
+		jobs = jobs[:limit]
+	}
+	return jobs
+}
+
+func copyJob(job *Job) *Job {
+	copied := *job
+	copied.Payload = bytes.Clone(job.Payload)
+	if job.ProcessedAt != nil {
+		processed := *job.ProcessedAt
+		copied.ProcessedAt = &processed
+	}
+	return &copied
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrJobPanicked = chassis.NewError(chassis.CodeInternal, "job handler panicked")
+
+// DefaultPoisonThreshold is how many consecutive crashes quarantine a job.
+const DefaultPoisonThreshold = 3
+
+// CrashCounter records consecutive handler crashes per job. SQLiteStore
+// implements it, so counts survive restarts; other stores fall back to an
+// in-memory counter.
+type CrashCounter interface {
+	// RecordCrash increments the job's crash count and returns the new count.
+	RecordCrash(ctx context.Context, jobID string) (int, error)
+	// ResetCrashes clears the job's crash count.
+	ResetCrashes(ctx context.Context, jobID string) error
+}
+
+// MemoryCrashCounter keeps crash counts in process memory.
+type MemoryCrashCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewMemoryCrashCounter creates an in-memory crash counter.
+func NewMemoryCrashCounter() *MemoryCrashCounter {
+	return &MemoryCrashCounter{counts: make(map[string]int)}
+}
+
+func (counter *MemoryCrashCounter) RecordCrash(ctx context.Context, jobID string) (int, error) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	counter.counts[jobID]++
+	return counter.counts[jobID], nil
+}
+
+func (counter *MemoryCrashCounter) ResetCrashes(ctx context.Context, jobID string) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	delete(counter.counts, jobID)
+	return nil
+}
+
+// runHandler calls handler, turning a panic into an error wrapping
+// ErrJobPanicked.
+func (mod *Module) runHandler(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_ = mod.app.ReportPanic(ctx, mod.Name(), chassis.PanicInJobHandler, job.Type, recovered)
+			err = fmt.Errorf("%w: %v", ErrJobPanicked, recovered)
+		}
+	}()
+	if chassis.FromContext(ctx) == nil {
+		ctx = chassis.WithApp(ctx, mod.app)
+	}
+	if job.OrgID != "" {
+		ctx = chassis.WithTenant(ctx, job.OrgID)
+	}
+	if job.RequestID != "" {
+		ctx = chassis.WithRequestID(ctx, job.RequestID)
+		ctx = chassis.WithLogger(ctx, chassis.LoggerFromContext(ctx).With("job_id", job.ID, "request_id", job.RequestID))
+	}
+	return handler(ctx, job)
+}
+
+// process runs one dequeued job and records the outcome. A crashed job is
+// put back in the queue, as it would be had the worker died, until it has
+// crashed poisonThreshold times in a row; then it is moved to the dead
+// letter status so it can't take down more workers. A job still running
+// when the worker stops is given the drain timeout to finish, then
+// released back to pending.
+func (mod *Module) process(ctx context.Context, handler Handler, job *Job) {
+	started := time.Now()
+	err := mod.run(ctx, handler, job)
+	duration := time.Since(started)
+	// Record the outcome even though the worker is stopping
+	ctx = context.WithoutCancel(ctx)
+	defer mod.observe(ctx, job, duration, err)
+	if errors.Is(err, ErrDrainTimeout) {
+		mod.release(ctx, job)
+		return
+	}
+	if errors.Is(err, ErrJobPanicked) {
+		mod.crashed(ctx, job, err)
+		return
+	}
+
+	if resetErr := mod.crashes.ResetCrashes(ctx, job.ID); resetErr != nil {
+		mod.app.Logger().Error("failed to reset job crash count", "job_id", job.ID, "error", resetErr)
+	}
+	if err != nil {
+		if failErr := mod.Fail(ctx, job.ID, err); failErr != nil {
+			mod.app.Logger().Error("failed to mark job as failed", "job_id", job.ID, "error", failErr)
+		}
+		mod.app.Logger().Error("job failed", "job_id", job.ID, "type", job.Type, "error", err)
+		return
+	}
+	if completeErr := mod.Complete(ctx, job.ID); completeErr != nil {
+		mod.app.Logger().Error("failed to mark job as complete", "job_id", job.ID, "error", completeErr)
+	}
+	mod.app.Logger().Info("job completed", "job_id", job.ID, "type", job.Type)
+}
+
+func (mod *Module) crashed(ctx context.Context, job *Job, err error) {
+	crashes, countErr := mod.crashes.RecordCrash(ctx, job.ID)
+	if countErr != nil {
+		mod.app.Logger().Error("failed to record job crash", "job_id", job.ID, "error", countErr)
+	}
+
+	if crashes < mod.poisonThreshold {
+		if requeueErr := mod.store.UpdateStatus(ctx, job.ID, StatusPending, err.Error(), nil); requeueErr != nil {
+			mod.app.Logger().Error("failed to requeue crashed job", "job_id", job.ID, "error", requeueErr)
+		}
+		mod.app.Logger().Warn("job crashed, requeued", "job_id", job.ID, "type", job.Type, "crashes", crashes)
+		return
+	}
+
+	now := time.Now()
+	if deadErr := mod.store.UpdateStatus(ctx, job.ID, StatusDead, err.Error(), &now); deadErr != nil {
+		mod.app.Logger().Error("failed to quarantine poison job", "job_id", job.ID, "error", deadErr)
+		return
+	}
+	mod.app.Logger().Error("poison job quarantined", "job_id", job.ID, "type", job.Type, "crashes", crashes)
+	mod.app.PublishEvent(ctx, EventJobPoisoned, &JobEvent{JobID: job.ID, Type: job.Type, Error: err.Error(), Crashes: crashes})
+}
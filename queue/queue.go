@@ -29,6 +29,18 @@
 //	    return nil
 //	})
 //
+// Or let app.Run start the workers, with handlers registered per job type:
+//
+//	queueMod := queue.New(queue.WithWorkers(4))
+//	queueMod.Handle("send-email", sendEmail)
+//
+// RegisterTyped decodes and validates the payload for the handler, failing
+// jobs whose payload is missing or invalid with ErrInvalidPayload:
+//
+//	queue.RegisterTyped(queueMod, "send-email", func(ctx context.Context, p SendEmail) error {
+//	    return send(ctx, p.To, p.Subject)
+//	})
+//
 // # Job Lifecycle
 //
 // Jobs progress through statuses: pending -> processing -> completed/failed.
@@ -36,16 +48,66 @@
 //
 //	app.Queue().Retry(ctx, jobID)
 //
+// Workers recover handler panics. A job whose handler panics is put back
+// in the queue; after it has crashed poison_threshold times in a row
+// (default 3) it is moved to the dead status instead, and a job.poisoned
+// event is published. Dead jobs are never dequeued; list them with
+// List(ctx, StatusDead, req) and requeue them with Retry once fixed.
+//
+// A worker whose context is cancelled stops dequeuing and gives its
+// in-flight job drain_timeout (default 20s) to finish. The handler's
+// context is not cancelled in the meantime; after the timeout it is, with
+// ErrDrainTimeout as the cause, and the job is released back to pending
+// rather than left in processing.
+//
+// # Retention
+//
+// Finished jobs are kept until purged. PurgeBefore deletes jobs processed
+// before a cutoff; with a retention per status, a background routine does
+// so every retention interval. WithArchive, or retention.archive, exports
+// each purged batch to the storage module as JSONL first:
+//
+//	queue.New(
+//	    queue.WithRetention(queue.StatusCompleted, 7*24*time.Hour),
+//	    queue.WithArchive("queue-archive/"),
+//	)
+//
+// # Limits
+//
+// WithLimit, or queue.limits, caps how many jobs of a type run at once and
+// how many start per period, across this process's workers:
+//
+//	queue.New(queue.WithLimit("send_email", queue.Limit{Rate: 100, Per: time.Minute}))
+//
 // # Configuration
 //
 // Configure via config.yaml:
 //
 //	queue:
 //	  db_path: ./data/queue.db
+//	  poison_threshold: 3
+//	  workers: 4 # started by app.Run
+//	  drain_timeout: 20s
+//	  limits:
+//	    video_encode:
+//	      concurrency: 2
+//	    send_email:
+//	      rate: 100
+//	      per: 1m
+//	  retention:
+//	    completed: 168h
+//	    failed: 720h
+//	    interval: 1h
+//	    archive: true # to storage, under archive_prefix
+//	    archive_prefix: queue-archive/
 //
 // Or programmatically:
 //
 //	queue.New(queue.WithDBPath("/custom/queue.db"))
+//
+// Tests and short-lived tools can keep jobs in memory instead:
+//
+//	queue.New(queue.WithStore(queue.NewMemoryStore()))
 package queue
 
 import (
@@ -53,17 +115,37 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/pagination"
 )
 
 var (
-	ErrJobNotFound = errors.New("job not found")
-	ErrNoJobs      = errors.New("no jobs available")
+	ErrJobNotFound = chassis.NewError(chassis.CodeNotFound, "job not found")
+	ErrNoJobs      = chassis.NewError(chassis.CodeNotFound, "no jobs available")
+	ErrNoHandler   = chassis.NewError(chassis.CodeFailedPrecondition, "no handler registered for job type")
 )
 
+// Lifecycle events published when the events module is registered.
+// The payload is a *JobEvent.
+const (
+	EventJobCompleted = "job.completed"
+	EventJobFailed    = "job.failed"
+	EventJobPoisoned  = "job.poisoned"
+)
+
+// JobEvent is the payload of job lifecycle events.
+type JobEvent struct {
+	JobID   string
+	Type    string
+	Error   string
+	Crashes int // consecutive crashes, for job.poisoned
+}
+
 // JobStatus represents the status of a job.
 type JobStatus string
 
@@ -72,6 +154,7 @@ const (
 	StatusProcessing JobStatus = "processing"
 	StatusCompleted  JobStatus = "completed"
 	StatusFailed     JobStatus = "failed"
+	StatusDead       JobStatus = "dead" // quarantined poison jobs
 )
 
 // Job represents a background job in the queue.
@@ -83,6 +166,8 @@ type Job struct {
 	Error       string
 	CreatedAt   time.Time
 	ProcessedAt *time.Time
+	OrgID       string // tenant the job was enqueued for; see chassis.WithTenant
+	RequestID   string // request the job was enqueued from; see chassis.WithRequestID
 }
 
 // Module is the queue module implementation.
@@ -90,6 +175,24 @@ type Module struct {
 	store  Store
 	dbPath string
 	app    *chassis.App
+
+	poisonThreshold int
+	crashes         CrashCounter
+
+	handlersMu sync.RWMutex
+	handlers   map[string]Handler
+	observers  []JobObserver
+
+	workers      int
+	fallback     Handler
+	drainTimeout time.Duration
+	limits       *limiter
+
+	retention         map[JobStatus]time.Duration
+	retentionInterval time.Duration
+	archivePrefix     string
+	stop              chan struct{}
+	stopped           sync.WaitGroup
 }
 
 // Option is a function that configures the queue module.
@@ -109,10 +212,24 @@ func WithDBPath(path string) Option {
 	}
 }
 
+// WithPoisonThreshold sets how many consecutive handler crashes move a job
+// to the dead status. Defaults to DefaultPoisonThreshold.
+func WithPoisonThreshold(crashes int) Option {
+	return func(mod *Module) {
+		if crashes > 0 {
+			mod.poisonThreshold = crashes
+		}
+	}
+}
+
 // New creates a new queue module with the given options.
 func New(opts ...Option) *Module {
 	mod := &Module{
-		dbPath: "./data/queue.db",
+		dbPath:          "./data/queue.db",
+		poisonThreshold: DefaultPoisonThreshold,
+		drainTimeout:    DefaultDrainTimeout,
+
+		retentionInterval: DefaultRetentionInterval,
 	}
 
 	for _, opt := range opts {
@@ -136,11 +253,72 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		if dbPath := cfg.GetString("queue.db_path"); dbPath != "" {
 			mod.dbPath = dbPath
 		}
+		if threshold := cfg.GetInt("queue.poison_threshold"); threshold > 0 {
+			mod.poisonThreshold = threshold
+		}
+		if workers := cfg.GetInt("queue.workers"); workers > 0 {
+			mod.workers = workers
+		}
+		if cfg.Get("queue.drain_timeout") != nil {
+			timeout, err := cfg.MustGetDuration("queue.drain_timeout")
+			if err != nil {
+				return err
+			}
+			if timeout < 0 {
+				return fmt.Errorf("%w: queue.drain_timeout: %s is negative", chassis.ErrInvalidConfig, timeout)
+			}
+			mod.drainTimeout = timeout
+		}
+		for jobType, value := range cfg.Section("queue.limits") {
+			// Read the entry directly, as job types may contain dots
+			var limit chassis.ConfigData
+			switch entry := value.(type) {
+			case chassis.ConfigData:
+				limit = entry
+			case map[string]any:
+				limit = entry
+			default:
+				continue
+			}
+			var per time.Duration
+			if limit.Get("per") != nil {
+				var err error
+				if per, err = limit.MustGetDuration("per"); err != nil {
+					return fmt.Errorf("queue.limits.%s: %w", jobType, err)
+				}
+			}
+			WithLimit(jobType, Limit{Concurrency: limit.GetInt("concurrency"), Rate: limit.GetInt("rate"), Per: per})(mod)
+		}
+		retention := cfg.Section("queue.retention")
+		for key := range retention {
+			switch key {
+			case "interval":
+				interval, err := cfg.MustGetDuration("queue.retention.interval")
+				if err != nil {
+					return err
+				}
+				mod.retentionInterval = interval
+			case "archive":
+				if retention.GetBool(key) && mod.archivePrefix == "" {
+					mod.archivePrefix = DefaultArchivePrefix
+				}
+			case "archive_prefix":
+				if prefix := retention.GetString(key); prefix != "" {
+					mod.archivePrefix = prefix
+				}
+			default:
+				keep, err := cfg.MustGetDuration("queue.retention." + key)
+				if err != nil {
+					return err
+				}
+				WithRetention(JobStatus(key), keep)(mod)
+			}
+		}
 	}
 
 	// Use default SQLite store if none provided
 	if mod.store == nil {
-		sqliteStore, err := NewSQLiteStore(mod.dbPath)
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
 		if err != nil {
 			return fmt.Errorf("failed to create queue store: %w", err)
 		}
@@ -150,18 +328,74 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		app.Logger().Info("queue module initialized with custom store")
 	}
 
+	if counter, ok := mod.store.(CrashCounter); ok {
+		mod.crashes = counter
+	} else {
+		mod.crashes = NewMemoryCrashCounter()
+	}
+
+	if len(mod.retention) > 0 && mod.retentionInterval > 0 {
+		if _, ok := mod.store.(Purger); !ok {
+			app.Logger().Warn("queue retention ignored: the store does not support purging")
+		} else {
+			mod.stop = make(chan struct{})
+			mod.stopped.Add(1)
+			go mod.retentionLoop()
+		}
+	}
+
 	return nil
 }
 
-// Shutdown cleans up the queue module.
+// openSQLiteStore creates the store on the database named by
+// queue.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("queue")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
+// Shutdown stops the retention purge, if running, and closes the store.
 func (mod *Module) Shutdown(ctx context.Context) error {
+	if mod.stop != nil {
+		close(mod.stop)
+		mod.stopped.Wait()
+		mod.stop = nil
+	}
 	if mod.store != nil {
 		return mod.store.Close()
 	}
 	return nil
 }
 
-// Enqueue adds a new job to the queue.
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "queue.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "queue.db"))
+}
+
+// Enqueue adds a new job to the queue. A job enqueued with a context
+// scoped to a tenant records its org ID and is handled with a context
+// scoped to the same tenant. The request ID of ctx, if any, is kept the
+// same way, so the job's logs can be traced to the request that caused it.
 func (mod *Module) Enqueue(ctx context.Context, jobType string, payload any) (any, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -174,6 +408,8 @@ func (mod *Module) Enqueue(ctx context.Context, jobType string, payload any) (an
 		Payload:   payloadBytes,
 		Status:    StatusPending,
 		CreatedAt: time.Now(),
+		OrgID:     chassis.TenantFromContext(ctx),
+		RequestID: chassis.RequestIDFromContext(ctx),
 	}
 
 	if err := mod.store.Create(ctx, job); err != nil {
@@ -201,7 +437,11 @@ func (mod *Module) DequeueByType(ctx context.Context, jobType string) (any, erro
 // Complete marks a job as completed.
 func (mod *Module) Complete(ctx context.Context, jobID string) error {
 	now := time.Now()
-	return mod.store.UpdateStatus(ctx, jobID, StatusCompleted, "", &now)
+	if err := mod.store.UpdateStatus(ctx, jobID, StatusCompleted, "", &now); err != nil {
+		return err
+	}
+	mod.publishJobEvent(ctx, EventJobCompleted, jobID, "")
+	return nil
 }
 
 // Fail marks a job as failed with an error message.
@@ -211,7 +451,25 @@ func (mod *Module) Fail(ctx context.Context, jobID string, err error) error {
 	if err != nil {
 		errMsg = err.Error()
 	}
-	return mod.store.UpdateStatus(ctx, jobID, StatusFailed, errMsg, &now)
+	if err := mod.store.UpdateStatus(ctx, jobID, StatusFailed, errMsg, &now); err != nil {
+		return err
+	}
+	mod.publishJobEvent(ctx, EventJobFailed, jobID, errMsg)
+	return nil
+}
+
+// publishJobEvent publishes a job lifecycle event. The job is only loaded
+// (for its type) when the events module is registered.
+func (mod *Module) publishJobEvent(ctx context.Context, eventType, jobID, errMsg string) {
+	if _, ok := mod.app.TryEvents(); !ok {
+		return
+	}
+	job, err := mod.store.GetByID(ctx, jobID)
+	if err != nil {
+		mod.app.Logger().Warn("failed to load job for event", "job_id", jobID, "event", eventType, "error", err)
+		return
+	}
+	mod.app.PublishEvent(ctx, eventType, &JobEvent{JobID: job.ID, Type: job.Type, Error: errMsg})
 }
 
 // GetByID retrieves a job by its ID.
@@ -239,7 +497,43 @@ func (mod *Module) GetFailed(ctx context.Context) (any, error) {
 	return mod.store.GetByStatus(ctx, StatusFailed)
 }
 
+// List returns a page of jobs, newest first. An empty status lists jobs
+// of every status.
+func (mod *Module) List(ctx context.Context, status JobStatus, req pagination.Request) (*pagination.Result[*Job], error) {
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, total, err := mod.page(ctx, status, offset, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(jobs, req, offset, total), nil
+}
+
+func (mod *Module) page(ctx context.Context, status JobStatus, offset, limit int) ([]*Job, int, error) {
+	if status == "" {
+		jobs, err := mod.store.GetAllPaginated(ctx, offset, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		total, err := mod.store.CountAll(ctx)
+		return jobs, total, err
+	}
+
+	jobs, err := mod.store.GetByStatusPaginated(ctx, status, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := mod.store.CountByStatus(ctx, status)
+	return jobs, total, err
+}
+
 // PaginatedResult contains jobs and pagination metadata.
+//
+// Deprecated: use List, which returns the shared pagination.Result.
 type PaginatedResult struct {
 	Jobs       []*Job `json:"jobs"`
 	Page       int    `json:"page"`
@@ -249,21 +543,29 @@ type PaginatedResult struct {
 }
 
 // GetAllPaginated retrieves jobs with pagination.
+//
+// Deprecated: use List with an empty status.
 func (mod *Module) GetAllPaginated(ctx context.Context, page, limit int) (*PaginatedResult, error) {
+	return mod.legacyPage(ctx, "", page, limit)
+}
+
+// GetByStatusPaginated retrieves jobs by status with pagination.
+//
+// Deprecated: use List.
+func (mod *Module) GetByStatusPaginated(ctx context.Context, status JobStatus, page, limit int) (*PaginatedResult, error) {
+	return mod.legacyPage(ctx, status, page, limit)
+}
+
+// legacyPage serves the deprecated methods, which don't cap the limit.
+func (mod *Module) legacyPage(ctx context.Context, status JobStatus, page, limit int) (*PaginatedResult, error) {
 	if page < 1 {
 		page = 1
 	}
 	if limit < 1 {
-		limit = 20
+		limit = pagination.DefaultLimit
 	}
-	offset := (page - 1) * limit
 
-	jobs, err := mod.store.GetAllPaginated(ctx, offset, limit)
-	if err != nil {
-		return nil, err
-	}
-
-	total, err := mod.store.CountAll(ctx)
+	jobs, total, err := mod.page(ctx, status, (page-1)*limit, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -282,79 +584,158 @@ func (mod *Module) GetAllPaginated(ctx context.Context, page, limit int) (*Pagin
 	}, nil
 }
 
-// GetByStatusPaginated retrieves jobs by status with pagination.
-func (mod *Module) GetByStatusPaginated(ctx context.Context, status JobStatus, page, limit int) (*PaginatedResult, error) {
-	if page < 1 {
-		page = 1
+// Retry moves a failed or dead job back to pending status and clears its
+// crash count.
+func (mod *Module) Retry(ctx context.Context, jobID string) error {
+	if err := mod.store.UpdateStatus(ctx, jobID, StatusPending, "", nil); err != nil {
+		return err
 	}
-	if limit < 1 {
-		limit = 20
+	if mod.crashes != nil {
+		return mod.crashes.ResetCrashes(ctx, jobID)
 	}
-	offset := (page - 1) * limit
+	return nil
+}
 
-	jobs, err := mod.store.GetByStatusPaginated(ctx, status, offset, limit)
-	if err != nil {
-		return nil, err
+// Handler is a function that processes a job.
+type Handler func(ctx context.Context, job *Job) error
+
+// Handle registers a handler for one job type. Workers run it for jobs of
+// that type instead of the handler passed to Worker, which lets modules
+// (e.g., webhooks) own their job types while the application runs a
+// single generic worker.
+func (mod *Module) Handle(jobType string, handler Handler) {
+	mod.handlersMu.Lock()
+	defer mod.handlersMu.Unlock()
+	if mod.handlers == nil {
+		mod.handlers = make(map[string]Handler)
 	}
+	mod.handlers[jobType] = handler
+}
 
-	total, err := mod.store.CountByStatus(ctx, status)
-	if err != nil {
-		return nil, err
+// JobObserver is told about every job a worker has run: how long its
+// handler took and what it returned. The error is ErrJobPanicked for a
+// handler that panicked and ErrDrainTimeout for one abandoned at shutdown.
+type JobObserver func(ctx context.Context, job *Job, duration time.Duration, err error)
+
+// Observe registers an observer of the jobs workers run, such as for
+// metrics. Observers run on the worker, after the job's status is saved,
+// so they should be quick.
+func (mod *Module) Observe(observer JobObserver) {
+	mod.handlersMu.Lock()
+	defer mod.handlersMu.Unlock()
+	mod.observers = append(mod.observers, observer)
+}
+
+// observe calls the observers of a job.
+func (mod *Module) observe(ctx context.Context, job *Job, duration time.Duration, err error) {
+	mod.handlersMu.RLock()
+	observers := mod.observers
+	mod.handlersMu.RUnlock()
+	for _, observer := range observers {
+		observer(ctx, job, duration, err)
 	}
+}
 
-	totalPages := (total + limit - 1) / limit
-	if totalPages < 1 {
-		totalPages = 1
+// handlerFor returns the handler registered for jobType, or fallback.
+func (mod *Module) handlerFor(jobType string, fallback Handler) Handler {
+	mod.handlersMu.RLock()
+	defer mod.handlersMu.RUnlock()
+	if handler, ok := mod.handlers[jobType]; ok {
+		return handler
 	}
+	return fallback
+}
 
-	return &PaginatedResult{
-		Jobs:       jobs,
-		Page:       page,
-		Limit:      limit,
-		Total:      total,
-		TotalPages: totalPages,
-	}, nil
+// WithWorkers sets how many workers Start runs; none by default.
+func WithWorkers(count int) Option {
+	return func(mod *Module) {
+		mod.workers = count
+	}
 }
 
-// Retry moves a failed job back to pending status.
-func (mod *Module) Retry(ctx context.Context, jobID string) error {
-	return mod.store.UpdateStatus(ctx, jobID, StatusPending, "", nil)
+// WithFallbackHandler sets the handler workers started by Start use for
+// job types without one registered with Handle. Without it, such jobs
+// fail with ErrNoHandler.
+func WithFallbackHandler(handler Handler) Option {
+	return func(mod *Module) {
+		mod.fallback = handler
+	}
 }
 
-// Handler is a function that processes a job.
-type Handler func(ctx context.Context, job *Job) error
+// Start runs the configured number of workers until ctx is cancelled,
+// then returns once they have drained their in-flight jobs. Implements chassis.Service, so app.Run processes jobs without a
+// hand-rolled worker goroutine. Handler panics are recovered per job; a
+// worker that panics outside a handler stops the pool and panics in Start,
+// and app.Run restarts it.
+func (mod *Module) Start(ctx context.Context) error {
+	fallback := mod.fallback
+	if fallback == nil {
+		fallback = func(ctx context.Context, job *Job) error {
+			return fmt.Errorf("%w: %s", ErrNoHandler, job.Type)
+		}
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	panicked := make(chan any, mod.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < mod.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					panicked <- recovered
+				}
+			}()
+			mod.Worker(workerCtx, fallback)
+		}()
+	}
+	select {
+	case <-ctx.Done():
+		wg.Wait()
+		return nil
+	case recovered := <-panicked:
+		// Stop the other workers and panic on the supervised goroutine, so
+		// app.Run restarts the pool
+		cancel()
+		wg.Wait()
+		panic(recovered)
+	}
+}
 
 // Worker processes jobs in a loop.
-// It runs until the context is cancelled.
+// It runs until the context is cancelled, then stops dequeuing and waits
+// up to the drain timeout for the job it is running. Jobs whose type has a
+// handler registered with Handle are passed to that handler instead.
+// Jobs of a type with a Limit wait for it. Handler panics are recovered;
+// see the package docs for poison job handling.
 func (mod *Module) Worker(ctx context.Context, handler Handler) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			job, err := mod.dequeue(ctx)
+			job, err := mod.next(ctx)
 			if err != nil {
-				if errors.Is(err, ErrNoJobs) || errors.Is(err, ErrJobNotFound) {
-					// No jobs available, wait before checking again
-					time.Sleep(time.Second)
-					continue
+				if !errors.Is(err, ErrNoJobs) && !errors.Is(err, ErrJobNotFound) {
+					mod.app.Logger().Error("failed to dequeue job", "error", err)
+				}
+				// Wait before checking again, but stop promptly on shutdown
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
 				}
-				mod.app.Logger().Error("failed to dequeue job", "error", err)
-				time.Sleep(time.Second)
 				continue
 			}
 
-			if err := handler(ctx, job); err != nil {
-				if failErr := mod.Fail(ctx, job.ID, err); failErr != nil {
-					mod.app.Logger().Error("failed to mark job as failed", "job_id", job.ID, "error", failErr)
-				}
-				mod.app.Logger().Error("job failed", "job_id", job.ID, "type", job.Type, "error", err)
-			} else {
-				if completeErr := mod.Complete(ctx, job.ID); completeErr != nil {
-					mod.app.Logger().Error("failed to mark job as complete", "job_id", job.ID, "error", completeErr)
-				}
-				mod.app.Logger().Info("job completed", "job_id", job.ID, "type", job.Type)
+			done, ok := mod.limits.acquire(ctx, job.Type)
+			if !ok {
+				mod.release(context.WithoutCancel(ctx), job)
+				return
 			}
+			mod.process(ctx, mod.handlerFor(job.Type, handler), job)
+			done()
 		}
 	}
 }
@@ -7,7 +7,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/storage"
 )
 
 func setupTestStore(t *testing.T) (*SQLiteStore, func()) {
@@ -880,4 +888,978 @@ func TestJobStatus_Constants(t *testing.T) {
 	if StatusFailed != "failed" {
 		t.Errorf("StatusFailed should be 'failed', got %q", StatusFailed)
 	}
+	if StatusDead != "dead" {
+		t.Errorf("StatusDead should be 'dead', got %q", StatusDead)
+	}
+}
+
+func TestIdempotent_SkipsCompletedKeys(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	calls := 0
+	handler := Idempotent(func(ctx context.Context, job *Job) error {
+		calls++
+		return nil
+	}, nil, WithIdempotencyStore(store))
+
+	job := &Job{ID: "job-1", Type: "email"}
+
+	if err := handler(ctx, job); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	// Simulate redelivery of the same job
+	if err := handler(ctx, job); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("handler should run once, ran %d times", calls)
+	}
+}
+
+func TestIdempotent_FailureNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	handler := Idempotent(func(ctx context.Context, job *Job) error {
+		calls++
+		if calls == 1 {
+			return errors.New("transient")
+		}
+		return nil
+	}, JobIDKey)
+
+	job := &Job{ID: "job-1"}
+
+	if err := handler(ctx, job); err == nil {
+		t.Fatal("first run should fail")
+	}
+	if err := handler(ctx, job); err != nil {
+		t.Fatalf("retry should succeed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("failed job should be retried, handler ran %d times", calls)
+	}
+}
+
+func TestIdempotent_CustomKeyAndEmptyKey(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	handler := Idempotent(func(ctx context.Context, job *Job) error {
+		calls++
+		return nil
+	}, func(job *Job) string {
+		var payload map[string]string
+		_ = json.Unmarshal(job.Payload, &payload)
+		return payload["message_id"]
+	}, WithIdempotencyStore(NewMemoryIdempotencyStore()))
+
+	// Different jobs, same business key
+	handler(ctx, &Job{ID: "a", Payload: json.RawMessage(`{"message_id":"m1"}`)})
+	handler(ctx, &Job{ID: "b", Payload: json.RawMessage(`{"message_id":"m1"}`)})
+	if calls != 1 {
+		t.Errorf("jobs sharing a key should run once, ran %d times", calls)
+	}
+
+	// Empty key disables tracking
+	handler(ctx, &Job{ID: "c", Payload: json.RawMessage(`{}`)})
+	handler(ctx, &Job{ID: "c", Payload: json.RawMessage(`{}`)})
+	if calls != 3 {
+		t.Errorf("empty key should always run, total calls %d", calls)
+	}
+}
+
+func TestModule_IdempotencyStore(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	if mod.IdempotencyStore() == nil {
+		t.Fatal("SQLite store should support idempotency tracking")
+	}
+
+	ctx := context.Background()
+	if err := store.MarkCompleted(ctx, "k"); err != nil {
+		t.Fatalf("MarkCompleted failed: %v", err)
+	}
+	if err := store.MarkCompleted(ctx, "k"); err != nil {
+		t.Fatalf("MarkCompleted should be idempotent: %v", err)
+	}
+	done, err := store.IsCompleted(ctx, "k")
+	if err != nil || !done {
+		t.Errorf("key should be completed, got %v (%v)", done, err)
+	}
+}
+
+func TestModule_HandleRoutesByType(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan string, 2)
+	mod.Handle("typed", func(ctx context.Context, job *Job) error {
+		handled <- "typed:" + job.Type
+		return nil
+	})
+
+	if _, err := mod.Enqueue(ctx, "typed", nil); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if _, err := mod.Enqueue(ctx, "other", nil); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	go mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+		handled <- "fallback:" + job.Type
+		return nil
+	})
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-handled:
+			got[name] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 handled jobs, got %v", got)
+		}
+	}
+	if !got["typed:typed"] || !got["fallback:other"] {
+		t.Errorf("jobs routed to wrong handlers: %v", got)
+	}
+}
+
+func TestModule_Observe(t *testing.T) {
+	mod := New(WithStore(NewMemoryStore()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	observed := make(chan error, 1)
+	mod.Observe(func(ctx context.Context, job *Job, duration time.Duration, err error) {
+		if job.Type != "observed" || duration <= 0 {
+			t.Errorf("unexpected job %s after %v", job.Type, duration)
+		}
+		observed <- err
+	})
+	if _, err := mod.Enqueue(ctx, "observed", nil); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	go mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+		time.Sleep(time.Millisecond)
+		return errors.New("boom")
+	})
+
+	select {
+	case err := <-observed:
+		if err == nil || err.Error() != "boom" {
+			t.Errorf("expected the handler's error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the job to be observed")
+	}
+}
+
+func TestModule_List(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		mod.Enqueue(ctx, fmt.Sprintf("type%d", i), nil)
+	}
+	job, _ := mod.Dequeue(ctx)
+	mod.Complete(ctx, job.(*Job).ID)
+
+	all, err := mod.List(ctx, "", pagination.Request{Page: 2, Limit: 3})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(all.Items) != 3 || all.Page != 2 || all.Total != 7 || all.TotalPages != 3 || !all.HasMore {
+		t.Errorf("unexpected page: %+v", all)
+	}
+
+	next, err := mod.List(ctx, "", pagination.Request{Cursor: all.NextCursor, Limit: 3})
+	if err != nil {
+		t.Fatalf("List with cursor failed: %v", err)
+	}
+	if len(next.Items) != 1 || next.HasMore || next.NextCursor != "" {
+		t.Errorf("expected a final page of 1, got %+v", next)
+	}
+
+	pending, err := mod.List(ctx, StatusPending, pagination.Request{})
+	if err != nil {
+		t.Fatalf("List pending failed: %v", err)
+	}
+	if pending.Total != 6 || pending.Limit != pagination.DefaultLimit {
+		t.Errorf("expected 6 pending jobs with the default limit, got %+v", pending)
+	}
+
+	if _, err := mod.List(ctx, "", pagination.Request{Cursor: "not-a-cursor"}); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestWorker_QuarantinesPoisonJobs(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store), WithPoisonThreshold(2))
+	eventsMod := events.New()
+	app := chassis.New(chassis.WithModules(eventsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	poisoned := make(chan *JobEvent, 1)
+	app.Events().Subscribe(EventJobPoisoned, func(ctx context.Context, eventType string, payload any) {
+		poisoned <- payload.(*JobEvent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result, err := mod.Enqueue(ctx, "crash", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	jobID := result.(*Job).ID
+
+	calls := make(chan struct{}, 10)
+	mod.Handle("crash", func(ctx context.Context, job *Job) error {
+		calls <- struct{}{}
+		panic("boom")
+	})
+	stopped := make(chan struct{})
+	go func() {
+		mod.Worker(ctx, nil)
+		close(stopped)
+	}()
+
+	var event *JobEvent
+	select {
+	case event = <-poisoned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a job.poisoned event")
+	}
+	if event.JobID != jobID || event.Crashes != 2 || !strings.Contains(event.Error, "boom") {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if len(calls) != 2 {
+		t.Errorf("expected the job to run twice before quarantine, ran %d times", len(calls))
+	}
+
+	cancel()
+	<-stopped
+
+	job, err := store.GetByID(context.Background(), jobID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if job.Status != StatusDead {
+		t.Errorf("expected dead status, got %s", job.Status)
+	}
+
+	// Retry starts a fresh count
+	if err := mod.Retry(context.Background(), jobID); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if crashes, _ := store.RecordCrash(context.Background(), jobID); crashes != 1 {
+		t.Errorf("expected Retry to reset the crash count, got %d", crashes)
+	}
+}
+
+func TestWorker_CrashCountResetsOnSuccess(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(events.New(), mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	completed := make(chan struct{}, 1)
+	app.Events().Subscribe(EventJobCompleted, func(ctx context.Context, eventType string, payload any) {
+		completed <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result, err := mod.Enqueue(ctx, "flaky", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	jobID := result.(*Job).ID
+
+	runs := 0
+	stopped := make(chan struct{})
+	go func() {
+		mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+			runs++
+			if runs == 1 {
+				panic("first run crashes")
+			}
+			return nil
+		})
+		close(stopped)
+	}()
+
+	select {
+	case <-completed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the crashed job to be requeued and completed")
+	}
+	cancel()
+	<-stopped
+
+	if runs != 2 {
+		t.Errorf("expected 2 runs, got %d", runs)
+	}
+	if crashes, _ := store.RecordCrash(context.Background(), jobID); crashes != 1 {
+		t.Errorf("expected success to reset the crash count, got %d", crashes)
+	}
+}
+
+func TestTenantQueue(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	tenant := mod.Tenant()
+	acme := chassis.WithTenant(context.Background(), "acme")
+	globex := chassis.WithTenant(context.Background(), "globex")
+
+	acmeJob, err := tenant.Enqueue(acme, "report", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if acmeJob.OrgID != "acme" {
+		t.Errorf("expected the job to record its org, got %q", acmeJob.OrgID)
+	}
+	if _, err := tenant.Enqueue(globex, "report", nil); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if _, err := mod.Enqueue(context.Background(), "report", nil); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if _, err := tenant.Enqueue(context.Background(), "report", nil); !errors.Is(err, chassis.ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+
+	if job, err := tenant.GetByID(acme, acmeJob.ID); err != nil || job.OrgID != "acme" {
+		t.Errorf("expected acme's job, got %+v (%v)", job, err)
+	}
+	if _, err := tenant.GetByID(globex, acmeJob.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound for another org's job, got %v", err)
+	}
+
+	// The SQLite store filters in SQL, other stores in Go
+	stores := map[string]*TenantQueue{"sqlite": tenant, "fallback": New(WithStore(struct{ Store }{store})).Tenant()}
+	for name, view := range stores {
+		page, err := view.List(acme, "", pagination.Request{})
+		if err != nil || page.Total != 1 || len(page.Items) != 1 || page.Items[0].ID != acmeJob.ID {
+			t.Errorf("%s: expected only acme's job, got %+v (%v)", name, page, err)
+		}
+		page, err = view.List(acme, StatusCompleted, pagination.Request{})
+		if err != nil || page.Total != 0 {
+			t.Errorf("%s: expected no completed jobs, got %+v (%v)", name, page, err)
+		}
+	}
+
+	// Handlers run scoped to the job's tenant
+	orgIDs := make(chan string, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+		orgIDs <- chassis.TenantFromContext(ctx)
+		return nil
+	})
+	seen := map[string]bool{}
+	for range 3 {
+		select {
+		case orgID := <-orgIDs:
+			seen[orgID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("jobs were not processed")
+		}
+	}
+	if !seen["acme"] || !seen["globex"] || !seen[""] {
+		t.Errorf("expected handlers scoped to each job's tenant, got %v", seen)
+	}
+}
+
+func TestPurgeOrg(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	acme := chassis.WithTenant(context.Background(), "acme")
+	globex := chassis.WithTenant(context.Background(), "globex")
+	mod.Tenant().Enqueue(acme, "report", nil)
+	mod.Tenant().Enqueue(acme, "report", nil)
+	running, _ := mod.Tenant().Enqueue(acme, "export", nil)
+	mod.Tenant().Enqueue(globex, "report", nil)
+	if job, err := store.DequeueByType(context.Background(), "export"); err != nil || job.ID != running.ID {
+		t.Fatalf("expected the export job dequeued, got %+v (%v)", job, err)
+	}
+
+	if err := mod.PurgeOrg(context.Background(), "acme"); err != nil {
+		t.Fatalf("PurgeOrg failed: %v", err)
+	}
+	page, _ := mod.Tenant().List(acme, "", pagination.Request{})
+	if page.Total != 1 || page.Items[0].ID != running.ID {
+		t.Errorf("expected only the processing job kept, got %+v", page.Items)
+	}
+	if page, _ := mod.Tenant().List(globex, "", pagination.Request{}); page.Total != 1 {
+		t.Errorf("expected another org's jobs kept, got %d", page.Total)
+	}
+}
+
+func TestWorker_DrainsInFlightJob(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result, err := mod.Enqueue(ctx, "slow", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	jobID := result.(*Job).ID
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	var handlerErr error
+	stopped := make(chan struct{})
+	go func() {
+		mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+			close(started)
+			<-finish
+			handlerErr = ctx.Err()
+			return nil
+		})
+		close(stopped)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("expected the worker to wait for its in-flight job")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(finish)
+	<-stopped
+
+	if handlerErr != nil {
+		t.Errorf("expected the handler's context to outlive the worker's, got %v", handlerErr)
+	}
+	job, err := store.GetByID(context.Background(), jobID)
+	if err != nil || job.Status != StatusCompleted {
+		t.Errorf("expected the drained job to complete, got %+v (%v)", job, err)
+	}
+}
+
+func TestWorker_ReleasesJobAfterDrainTimeout(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store), WithDrainTimeout(50*time.Millisecond))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result, err := mod.Enqueue(ctx, "stuck", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	jobID := result.(*Job).ID
+
+	started := make(chan struct{})
+	causes := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+			close(started)
+			<-ctx.Done()
+			causes <- context.Cause(ctx)
+			return ctx.Err()
+		})
+		close(stopped)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the worker to stop after the drain timeout")
+	}
+
+	if cause := <-causes; !errors.Is(cause, ErrDrainTimeout) {
+		t.Errorf("expected the handler to be cancelled with ErrDrainTimeout, got %v", cause)
+	}
+	job, err := store.GetByID(context.Background(), jobID)
+	if err != nil || job.Status != StatusPending || job.Error != "" {
+		t.Errorf("expected the job to be released back to pending, got %+v (%v)", job, err)
+	}
+	if next, err := store.Dequeue(context.Background()); err != nil || next.ID != jobID {
+		t.Errorf("expected the released job to be dequeued again, got %+v (%v)", next, err)
+	}
+}
+
+type sendEmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+func (payload sendEmailPayload) Validate() error {
+	if payload.To == "" {
+		return errors.New("to is required")
+	}
+	return nil
+}
+
+func TestRegisterTyped(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	received := make(chan sendEmailPayload, 1)
+	RegisterTyped(mod, "send_email", func(ctx context.Context, payload sendEmailPayload) error {
+		if job := JobFromContext(ctx); job == nil || job.Type != "send_email" {
+			t.Errorf("expected the job in the context, got %+v", job)
+		}
+		received <- payload
+		return nil
+	})
+
+	ctx := context.Background()
+	jobIDs := map[string]string{}
+	for name, payload := range map[string]any{
+		"valid":   sendEmailPayload{To: "ann@example.com", Subject: "Hi"},
+		"invalid": sendEmailPayload{Subject: "Hi"},
+		"nil":     nil,
+		"garbled": []string{"not", "an", "object"},
+	} {
+		result, err := mod.Enqueue(ctx, "send_email", payload)
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		jobIDs[name] = result.(*Job).ID
+	}
+
+	handler := mod.handlerFor("send_email", nil)
+	for range jobIDs {
+		job, err := mod.dequeue(ctx)
+		if err != nil {
+			t.Fatalf("dequeue failed: %v", err)
+		}
+		mod.process(ctx, handler, job)
+	}
+
+	if payload := <-received; payload.To != "ann@example.com" || payload.Subject != "Hi" {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+	if job, _ := store.GetByID(ctx, jobIDs["valid"]); job.Status != StatusCompleted {
+		t.Errorf("expected the valid job to complete, got %s", job.Status)
+	}
+	for _, name := range []string{"invalid", "nil", "garbled"} {
+		job, _ := store.GetByID(ctx, jobIDs[name])
+		if job.Status != StatusFailed || !strings.Contains(job.Error, ErrInvalidPayload.Error()) {
+			t.Errorf("%s: expected a payload validation failure, got %s %q", name, job.Status, job.Error)
+		}
+	}
+	if _, err := DecodePayload[sendEmailPayload](&Job{Type: "send_email", Payload: json.RawMessage(`{}`)}); !errors.Is(err, ErrInvalidPayload) || !strings.Contains(err.Error(), "to is required") {
+		t.Errorf("expected the Validate error, got %v", err)
+	}
+}
+
+func TestPurgeBefore(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	storageMod := storage.New(storage.WithBasePath(t.TempDir()))
+	mod := New(WithStore(store), WithArchive(""))
+	app := chassis.New(chassis.WithModules(storageMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	now := time.Now()
+	old, recent := now.Add(-48*time.Hour), now.Add(-time.Hour)
+	finish := map[string]struct {
+		status      JobStatus
+		processedAt *time.Time
+	}{
+		"old-completed":    {StatusCompleted, &old},
+		"old-failed":       {StatusFailed, &old},
+		"old-dead":         {StatusDead, &old},
+		"recent-completed": {StatusCompleted, &recent},
+		"pending":          {StatusPending, nil},
+	}
+	for id, state := range finish {
+		if err := store.Create(ctx, &Job{ID: id, Type: "report", Status: StatusPending, CreatedAt: old}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.UpdateStatus(ctx, id, state.status, "", state.processedAt); err != nil {
+			t.Fatalf("UpdateStatus failed: %v", err)
+		}
+	}
+	if _, err := store.RecordCrash(ctx, "old-failed"); err != nil {
+		t.Fatalf("RecordCrash failed: %v", err)
+	}
+
+	purged, err := mod.PurgeBefore(ctx, now.Add(-24*time.Hour))
+	if err != nil || purged != 2 {
+		t.Fatalf("expected 2 jobs purged, got %d (%v)", purged, err)
+	}
+	for id := range finish {
+		_, err := store.GetByID(ctx, id)
+		if gone := errors.Is(err, ErrJobNotFound); gone != (id == "old-completed" || id == "old-failed") {
+			t.Errorf("%s: unexpected purge result: %v", id, err)
+		}
+	}
+	if crashes, _ := store.RecordCrash(ctx, "old-failed"); crashes != 1 {
+		t.Errorf("expected the purged job's crash count to be deleted, got %d", crashes)
+	}
+
+	keys, err := storageMod.List(ctx, DefaultArchivePrefix)
+	if err != nil || len(keys) != 1 || !strings.HasSuffix(keys[0], ".jsonl") {
+		t.Fatalf("expected one archive, got %v (%v)", keys, err)
+	}
+	data, err := storageMod.Get(ctx, keys[0])
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 archived jobs, got %q", data)
+	}
+	for _, line := range lines {
+		var job Job
+		if err := json.Unmarshal([]byte(line), &job); err != nil || !strings.HasPrefix(job.ID, "old-") || job.ProcessedAt == nil {
+			t.Errorf("unexpected archived job %q (%v)", line, err)
+		}
+	}
+
+	if purged, err := mod.PurgeBefore(ctx, now, StatusDead); err != nil || purged != 1 {
+		t.Errorf("expected the dead job purged, got %d (%v)", purged, err)
+	}
+	if _, err := New(WithStore(struct{ Store }{store})).PurgeBefore(ctx, now); !errors.Is(err, ErrPurgeNotSupported) {
+		t.Errorf("expected ErrPurgeNotSupported, got %v", err)
+	}
+}
+
+func TestRetentionConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "queue:\n  retention:\n    completed: 1h\n    failed: 72h\n    interval: 10ms\n"
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	if mod.retention[StatusCompleted] != time.Hour || mod.retention[StatusFailed] != 72*time.Hour || mod.retentionInterval != 10*time.Millisecond {
+		t.Fatalf("unexpected retention config: %v every %s", mod.retention, mod.retentionInterval)
+	}
+
+	ctx := context.Background()
+	processedAt := time.Now().Add(-2 * time.Hour)
+	for _, id := range []string{"expired", "kept"} {
+		if err := store.Create(ctx, &Job{ID: id, Type: "report", Status: StatusPending, CreatedAt: processedAt}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	_ = store.UpdateStatus(ctx, "expired", StatusCompleted, "", &processedAt)
+	_ = store.UpdateStatus(ctx, "kept", StatusFailed, "boom", &processedAt)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := store.GetByID(ctx, "expired"); errors.Is(err, ErrJobNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the background purge to delete the expired job")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := store.GetByID(ctx, "kept"); err != nil {
+		t.Errorf("expected the failed job to be kept, got %v", err)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	lim := newLimiter()
+	now := time.Now()
+	lim.now = func() time.Time { return now }
+	lim.set("encode", Limit{Concurrency: 2})
+	lim.set("email", Limit{Rate: 2, Per: time.Minute})
+
+	first, _ := lim.try("encode")
+	second, _ := lim.try("encode")
+	if first == nil || second == nil {
+		t.Fatal("expected two encode slots")
+	}
+	if done, wait := lim.try("encode"); done != nil || wait != limitPollInterval {
+		t.Errorf("expected the third encode job to wait, got %v", wait)
+	}
+	if got := lim.blocked(); len(got) != 1 || got[0] != "encode" {
+		t.Errorf("expected encode blocked, got %v", got)
+	}
+	first()
+	first() // releasing twice frees one slot
+	if done, _ := lim.try("encode"); done == nil {
+		t.Error("expected a released slot to be reused")
+	}
+	if done, _ := lim.try("encode"); done != nil {
+		t.Error("expected a double release not to free a second slot")
+	}
+
+	for range 2 {
+		if done, _ := lim.try("email"); done == nil {
+			t.Fatal("expected the email burst to be allowed")
+		}
+	}
+	if done, wait := lim.try("email"); done != nil || wait != 30*time.Second {
+		t.Errorf("expected the rate limit to wait 30s for a token, got %v", wait)
+	}
+	now = now.Add(30 * time.Second)
+	if done, _ := lim.try("email"); done == nil {
+		t.Error("expected a token after 30s")
+	}
+	if done, _ := lim.try("report"); done == nil {
+		t.Error("expected unlimited types to start")
+	}
+}
+
+func TestWorker_SkipsLimitedTypes(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "queue:\n  limits:\n    emails.send:\n      rate: 1\n      per: 1h\n"
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var ids []string
+	for _, jobType := range []string{"emails.send", "emails.send", "report"} {
+		result, err := mod.Enqueue(ctx, jobType, nil)
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		ids = append(ids, result.(*Job).ID)
+		time.Sleep(time.Millisecond) // keep creation order
+	}
+
+	ran := make(chan string, 3)
+	stopped := make(chan struct{})
+	go func() {
+		mod.Worker(ctx, func(ctx context.Context, job *Job) error {
+			ran <- job.ID
+			return nil
+		})
+		close(stopped)
+	}()
+	for _, want := range []string{ids[0], ids[2]} {
+		select {
+		case got := <-ran:
+			if got != want {
+				t.Errorf("expected job %s to run, got %s", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the worker to run jobs within their limits")
+		}
+	}
+	select {
+	case got := <-ran:
+		t.Errorf("expected the rate limit to hold back job %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	<-stopped
+
+	if job, _ := store.GetByID(context.Background(), ids[1]); job.Status != StatusPending {
+		t.Errorf("expected the limited job to stay pending, got %s", job.Status)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		job := &Job{ID: fmt.Sprint("job-", i), Type: "work", Status: StatusPending, CreatedAt: now.Add(time.Duration(i)), OrgID: "acme"}
+		if err := store.Create(ctx, job); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if err := store.Create(ctx, &Job{ID: "job-0"}); err == nil {
+		t.Error("expected a duplicate job ID to be rejected")
+	}
+	if jobs, _ := store.GetAllPaginated(ctx, 0, 2); len(jobs) != 2 || jobs[0].ID != "job-49" {
+		t.Errorf("expected pages newest first, got %v", jobs)
+	}
+
+	// Concurrent workers claim every job exactly once and finish it
+	var mu sync.Mutex
+	claimed := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := store.Dequeue(ctx)
+				if errors.Is(err, ErrNoJobs) {
+					return
+				}
+				if err != nil || job.Status != StatusProcessing {
+					t.Errorf("unexpected claim %+v (%v)", job, err)
+					return
+				}
+				processed := time.Now()
+				if err := store.UpdateStatus(ctx, job.ID, StatusCompleted, "", &processed); err != nil {
+					t.Errorf("UpdateStatus failed: %v", err)
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != 50 {
+		t.Errorf("expected every job claimed, got %d", len(claimed))
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Errorf("%s claimed %d times", id, count)
+		}
+	}
+	if count, _ := store.CountByStatus(ctx, StatusCompleted); count != 50 {
+		t.Errorf("expected 50 completed jobs, got %d", count)
+	}
+	if count, _ := store.CountByOrg(ctx, "acme", StatusCompleted); count != 50 {
+		t.Errorf("expected 50 of acme's jobs, got %d", count)
+	}
+	if pending, _ := store.GetByStatus(ctx, StatusPending); pending != nil {
+		t.Errorf("expected nil like the SQLite store, got %v", pending)
+	}
+	if err := store.UpdateStatus(ctx, "missing", StatusFailed, "", nil); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+
+	// Returned jobs are copies
+	job, _ := store.GetByID(ctx, "job-0")
+	job.Status = StatusFailed
+	if stored, _ := store.GetByID(ctx, "job-0"); stored.Status != StatusCompleted {
+		t.Errorf("expected the stored job to be unchanged, got %s", stored.Status)
+	}
+
+	if purged, err := New(WithStore(store)).PurgeBefore(ctx, time.Now().Add(time.Second)); err != nil || purged != 50 {
+		t.Errorf("expected every job purged, got %d (%v)", purged, err)
+	}
+}
+
+func TestStart_ConcurrencyLimit(t *testing.T) {
+	mod := New(WithStore(NewMemoryStore()), WithWorkers(4), WithLimit("encode", Limit{Concurrency: 2}))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	var mu sync.Mutex
+	running, peak, done := 0, 0, 0
+	finished := make(chan struct{})
+	mod.Handle("encode", func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		done++
+		if done == 6 {
+			close(finished)
+		}
+		mu.Unlock()
+		return nil
+	})
+	others := make(chan struct{}, 2)
+	mod.Handle("thumbnail", func(ctx context.Context, job *Job) error {
+		others <- struct{}{}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 6; i++ {
+		if _, err := mod.Enqueue(ctx, "encode", nil); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := mod.Enqueue(ctx, "thumbnail", nil); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		_ = mod.Start(ctx)
+		close(stopped)
+	}()
+
+	for range 2 {
+		select {
+		case <-others:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected other job types to run while encode is at its limit")
+		}
+	}
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected every encode job to run")
+	}
+	cancel()
+	<-stopped
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent encode jobs, got %d", peak)
+	}
 }
@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrPurgeNotSupported = chassis.NewError(chassis.CodeFailedPrecondition, "queue store does not support purging jobs")
+	ErrArchiveNoStorage  = chassis.NewError(chassis.CodeFailedPrecondition, "queue archive requires the storage module")
+)
+
+// DefaultRetentionInterval is how often jobs past their retention are
+// purged.
+const DefaultRetentionInterval = time.Hour
+
+// DefaultArchivePrefix is the storage prefix archived jobs are written
+// under.
+const DefaultArchivePrefix = "queue-archive/"
+
+// purgeBatchSize bounds how many jobs are archived and deleted at once.
+const purgeBatchSize = 500
+
+// Purger is implemented by stores that can delete finished jobs.
+// SQLiteStore and MemoryStore implement it.
+type Purger interface {
+	// FinishedBefore returns up to limit jobs with one of statuses that
+	// were processed before cutoff, oldest first.
+	FinishedBefore(ctx context.Context, cutoff time.Time, statuses []JobStatus, limit int) ([]*Job, error)
+	// DeleteJobs deletes jobs by ID and returns how many were deleted.
+	DeleteJobs(ctx context.Context, ids []string) (int, error)
+}
+
+// WithRetention keeps jobs with status for keep after they were
+// processed; a background routine purges older ones every retention
+// interval. Statuses without a retention are kept forever.
+func WithRetention(status JobStatus, keep time.Duration) Option {
+	return func(mod *Module) {
+		if keep > 0 {
+			if mod.retention == nil {
+				mod.retention = make(map[JobStatus]time.Duration)
+			}
+			mod.retention[status] = keep
+		}
+	}
+}
+
+// WithRetentionInterval sets how often jobs past their retention are
+// purged. Defaults to DefaultRetentionInterval.
+func WithRetentionInterval(interval time.Duration) Option {
+	return func(mod *Module) {
+		mod.retentionInterval = interval
+	}
+}
+
+// WithArchive has purges export jobs to the storage module before deleting
+// them, as one JSONL object per batch under prefix (DefaultArchivePrefix
+// if empty).
+func WithArchive(prefix string) Option {
+	return func(mod *Module) {
+		if prefix == "" {
+			prefix = DefaultArchivePrefix
+		}
+		mod.archivePrefix = prefix
+	}
+}
+
+// PurgeBefore deletes jobs with one of statuses, completed and failed by
+// default, that were processed before cutoff, and returns how many it
+// deleted. With WithArchive each batch is written to storage first, and a
+// batch that can't be archived is kept.
+func (mod *Module) PurgeBefore(ctx context.Context, cutoff time.Time, statuses ...JobStatus) (int, error) {
+	purger, ok := mod.store.(Purger)
+	if !ok {
+		return 0, ErrPurgeNotSupported
+	}
+	if len(statuses) == 0 {
+		statuses = []JobStatus{StatusCompleted, StatusFailed}
+	}
+
+	purged := 0
+	for {
+		jobs, err := purger.FinishedBefore(ctx, cutoff, statuses, purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list jobs to purge: %w", err)
+		}
+		if len(jobs) == 0 {
+			return purged, nil
+		}
+		if mod.archivePrefix != "" {
+			if err := mod.archive(ctx, jobs); err != nil {
+				return purged, err
+			}
+		}
+		ids := make([]string, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.ID
+		}
+		deleted, err := purger.DeleteJobs(ctx, ids)
+		purged += deleted
+		if err != nil {
+			return purged, fmt.Errorf("failed to delete jobs: %w", err)
+		}
+		if len(jobs) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// archive writes jobs to storage as JSONL, under a key named after the
+// newest job's processing time so archives list in order.
+func (mod *Module) archive(ctx context.Context, jobs []*Job) error {
+	storage, ok := mod.app.TryStorage()
+	if !ok {
+		return ErrArchiveNoStorage
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, job := range jobs {
+		if err := encoder.Encode(job); err != nil {
+			return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+		}
+	}
+	last := jobs[len(jobs)-1]
+	processed := last.CreatedAt
+	if last.ProcessedAt != nil {
+		processed = *last.ProcessedAt
+	}
+	processed = processed.UTC()
+	key := fmt.Sprintf("%s%s/%s-%s.jsonl", mod.archivePrefix, processed.Format("2006/01/02"), processed.Format("150405.000000000"), last.ID)
+	if err := storage.Put(ctx, key, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to archive jobs: %w", err)
+	}
+	return nil
+}
+
+// purgeExpired purges every status past its retention.
+func (mod *Module) purgeExpired(ctx context.Context) {
+	statuses := make([]JobStatus, 0, len(mod.retention))
+	for status := range mod.retention {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+
+	now := time.Now()
+	for _, status := range statuses {
+		purged, err := mod.PurgeBefore(ctx, now.Add(-mod.retention[status]), status)
+		if err != nil {
+			mod.app.Logger().Error("queue retention purge failed", "status", status, "error", err)
+		} else if purged > 0 {
+			mod.app.Logger().Info("queue jobs purged", "status", status, "purged", purged)
+		}
+	}
+}
+
+// retentionLoop purges expired jobs every retention interval until
+// Shutdown.
+func (mod *Module) retentionLoop() {
+	defer mod.stopped.Done()
+	ticker := time.NewTicker(mod.retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mod.stop:
+			return
+		case <-ticker.C:
+			mod.purgeExpired(context.Background())
+		}
+	}
+}
@@ -5,11 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
-	_ "modernc.org/sqlite"
+	"github.com/talosaether/chassis/internal/sqlite"
 )
 
 // Store defines the interface for queue persistence.
@@ -30,26 +29,32 @@ type Store interface {
 
 // SQLiteStore implements Store using SQLite.
 type SQLiteStore struct {
-	db *sql.DB
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
 }
 
 // NewSQLiteStore creates a new SQLite-backed queue store.
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	store, err := NewSQLiteStoreFromDB(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		_ = db.Close()
+		return nil, err
 	}
+	store.owned = true
+	return store, nil
+}
 
+// NewSQLiteStoreFromDB creates a queue store on a database the caller owns,
+// such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
 	if err := initQueueSchema(db); err != nil {
-		_ = db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
-
 	return &SQLiteStore{db: db}, nil
 }
 
@@ -66,19 +71,71 @@ func initQueueSchema(db *sql.DB) error {
 		);
 		CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
 		CREATE INDEX IF NOT EXISTS idx_jobs_type_status ON jobs(type, status);
+
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			key TEXT PRIMARY KEY,
+			completed_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS job_crashes (
+			job_id TEXT PRIMARY KEY,
+			crashes INTEGER NOT NULL
+		);
 	`
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := addJobColumns(db); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_jobs_org_status ON jobs(org_id, status)`)
 	return err
 }
 
+// addJobColumns adds the columns introduced after the first schema to
+// databases created before them.
+func addJobColumns(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('jobs')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !existing["org_id"] {
+		if _, err := db.Exec(`ALTER TABLE jobs ADD COLUMN org_id TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	if !existing["request_id"] {
+		if _, err := db.Exec(`ALTER TABLE jobs ADD COLUMN request_id TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const jobColumns = `id, type, payload, status, error, created_at, processed_at, org_id, request_id`
+
 func (store *SQLiteStore) Create(ctx context.Context, job *Job) error {
-	query := `INSERT INTO jobs (id, type, payload, status, created_at) VALUES (?, ?, ?, ?, ?)`
-	_, err := store.db.ExecContext(ctx, query, job.ID, job.Type, job.Payload, job.Status, job.CreatedAt)
+	query := `INSERT INTO jobs (id, type, payload, status, created_at, org_id, request_id) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := store.db.ExecContext(ctx, query, job.ID, job.Type, job.Payload, job.Status, job.CreatedAt, job.OrgID, job.RequestID)
 	return err
 }
 
 func (store *SQLiteStore) GetByID(ctx context.Context, id string) (*Job, error) {
-	query := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs WHERE id = ?`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
 	row := store.db.QueryRowContext(ctx, query, id)
 	job, err := scanJob(row)
 	if err != nil {
@@ -91,7 +148,7 @@ func (store *SQLiteStore) GetByID(ctx context.Context, id string) (*Job, error)
 }
 
 func (store *SQLiteStore) GetAll(ctx context.Context) ([]*Job, error) {
-	query := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs ORDER BY created_at ASC`
+	query := `SELECT ` + jobColumns + ` FROM jobs ORDER BY created_at ASC`
 	rows, err := store.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
@@ -110,7 +167,7 @@ func (store *SQLiteStore) GetAll(ctx context.Context) ([]*Job, error) {
 }
 
 func (store *SQLiteStore) GetByStatus(ctx context.Context, status JobStatus) ([]*Job, error) {
-	query := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs WHERE status = ? ORDER BY created_at ASC`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE status = ? ORDER BY created_at ASC`
 	rows, err := store.db.QueryContext(ctx, query, status)
 	if err != nil {
 		return nil, err
@@ -129,7 +186,7 @@ func (store *SQLiteStore) GetByStatus(ctx context.Context, status JobStatus) ([]
 }
 
 func (store *SQLiteStore) GetAllPaginated(ctx context.Context, offset, limit int) ([]*Job, error) {
-	query := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	query := `SELECT ` + jobColumns + ` FROM jobs ORDER BY created_at DESC LIMIT ? OFFSET ?`
 	rows, err := store.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, err
@@ -148,7 +205,7 @@ func (store *SQLiteStore) GetAllPaginated(ctx context.Context, offset, limit int
 }
 
 func (store *SQLiteStore) GetByStatusPaginated(ctx context.Context, status JobStatus, offset, limit int) ([]*Job, error) {
-	query := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs WHERE status = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE status = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`
 	rows, err := store.db.QueryContext(ctx, query, status, limit, offset)
 	if err != nil {
 		return nil, err
@@ -187,7 +244,7 @@ func (store *SQLiteStore) Dequeue(ctx context.Context) (*Job, error) {
 	defer func() { _ = tx.Rollback() }()
 
 	// Select the oldest pending job
-	selectQuery := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs WHERE status = ? ORDER BY created_at ASC LIMIT 1`
+	selectQuery := `SELECT ` + jobColumns + ` FROM jobs WHERE status = ? ORDER BY created_at ASC LIMIT 1`
 	row := tx.QueryRowContext(ctx, selectQuery, StatusPending)
 
 	job, err := scanJob(row)
@@ -220,7 +277,7 @@ func (store *SQLiteStore) DequeueByType(ctx context.Context, jobType string) (*J
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	selectQuery := `SELECT id, type, payload, status, error, created_at, processed_at FROM jobs WHERE status = ? AND type = ? ORDER BY created_at ASC LIMIT 1`
+	selectQuery := `SELECT ` + jobColumns + ` FROM jobs WHERE status = ? AND type = ? ORDER BY created_at ASC LIMIT 1`
 	row := tx.QueryRowContext(ctx, selectQuery, StatusPending, jobType)
 
 	job, err := scanJob(row)
@@ -245,6 +302,46 @@ func (store *SQLiteStore) DequeueByType(ctx context.Context, jobType string) (*J
 	return job, nil
 }
 
+// DequeueExcept claims the oldest pending job whose type isn't excluded.
+func (store *SQLiteStore) DequeueExcept(ctx context.Context, excluded []string) (*Job, error) {
+	if len(excluded) == 0 {
+		return store.Dequeue(ctx)
+	}
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	args := []any{StatusPending}
+	for _, jobType := range excluded {
+		args = append(args, jobType)
+	}
+	selectQuery := `SELECT ` + jobColumns + ` FROM jobs WHERE status = ? AND type NOT IN (?` + strings.Repeat(", ?", len(excluded)-1) + `) ORDER BY created_at ASC LIMIT 1`
+	row := tx.QueryRowContext(ctx, selectQuery, args...)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoJobs
+		}
+		return nil, err
+	}
+
+	updateQuery := `UPDATE jobs SET status = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, updateQuery, StatusProcessing, job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	job.Status = StatusProcessing
+	return job, nil
+}
+
 func (store *SQLiteStore) UpdateStatus(ctx context.Context, id string, status JobStatus, errMsg string, processedAt *time.Time) error {
 	query := `UPDATE jobs SET status = ?, error = ?, processed_at = ? WHERE id = ?`
 	result, err := store.db.ExecContext(ctx, query, status, errMsg, processedAt, id)
@@ -261,17 +358,148 @@ func (store *SQLiteStore) UpdateStatus(ctx context.Context, id string, status Jo
 	return nil
 }
 
+// GetByOrgPaginated returns a page of the org's jobs, newest first. An
+// empty status matches every status.
+func (store *SQLiteStore) GetByOrgPaginated(ctx context.Context, orgID string, status JobStatus, offset, limit int) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE org_id = ? AND (? = '' OR status = ?) ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	rows, err := store.db.QueryContext(ctx, query, orgID, status, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	jobs := make([]*Job, 0)
+	for rows.Next() {
+		job, err := scanJobRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// CountByOrg counts the org's jobs. An empty status matches every status.
+func (store *SQLiteStore) CountByOrg(ctx context.Context, orgID string, status JobStatus) (int, error) {
+	var count int
+	err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM jobs WHERE org_id = ? AND (? = '' OR status = ?)`, orgID, status, status).Scan(&count)
+	return count, err
+}
+
+// IsCompleted reports whether the idempotency key has been recorded.
+func (store *SQLiteStore) IsCompleted(ctx context.Context, key string) (bool, error) {
+	var count int
+	err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM idempotency_keys WHERE key = ?`, key).Scan(&count)
+	return count > 0, err
+}
+
+// MarkCompleted records an idempotency key. Recording a key twice is not an error.
+func (store *SQLiteStore) MarkCompleted(ctx context.Context, key string) error {
+	query := `INSERT OR IGNORE INTO idempotency_keys (key, completed_at) VALUES (?, ?)`
+	_, err := store.db.ExecContext(ctx, query, key, time.Now())
+	return err
+}
+
+// RecordCrash increments the job's crash count and returns the new count.
+func (store *SQLiteStore) RecordCrash(ctx context.Context, jobID string) (int, error) {
+	query := `INSERT INTO job_crashes (job_id, crashes) VALUES (?, 1)
+		ON CONFLICT(job_id) DO UPDATE SET crashes = crashes + 1
+		RETURNING crashes`
+	var crashes int
+	err := store.db.QueryRowContext(ctx, query, jobID).Scan(&crashes)
+	return crashes, err
+}
+
+// ResetCrashes clears the job's crash count.
+func (store *SQLiteStore) ResetCrashes(ctx context.Context, jobID string) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM job_crashes WHERE job_id = ?`, jobID)
+	return err
+}
+
+// FinishedBefore returns up to limit jobs with one of statuses processed
+// before cutoff, oldest first.
+func (store *SQLiteStore) FinishedBefore(ctx context.Context, cutoff time.Time, statuses []JobStatus, limit int) ([]*Job, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, len(statuses)+2)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	args = append(args, cutoff, limit)
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE status IN (?` + strings.Repeat(", ?", len(statuses)-1) + `)
+		AND processed_at IS NOT NULL AND processed_at < ? ORDER BY processed_at LIMIT ?`
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJobRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteJobs deletes jobs and their crash counts.
+func (store *SQLiteStore) DeleteJobs(ctx context.Context, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := `(?` + strings.Repeat(", ?", len(ids)-1) + `)`
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	result, err := tx.ExecContext(ctx, `DELETE FROM jobs WHERE id IN `+placeholders, args...)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM job_crashes WHERE job_id IN `+placeholders, args...); err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(deleted), tx.Commit()
+}
+
 func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
 	return store.db.Close()
 }
 
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
+
 func scanJob(row *sql.Row) (*Job, error) {
 	var job Job
 	var payload []byte
 	var errMsg sql.NullString
 	var processedAt sql.NullTime
 
-	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &errMsg, &job.CreatedAt, &processedAt)
+	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &errMsg, &job.CreatedAt, &processedAt, &job.OrgID, &job.RequestID)
 	if err != nil {
 		// Return sql.ErrNoRows directly so callers can map it appropriately
 		return nil, err
@@ -296,7 +524,7 @@ func scanJobRow(rows *sql.Rows) (*Job, error) {
 	var errMsg sql.NullString
 	var processedAt sql.NullTime
 
-	err := rows.Scan(&job.ID, &job.Type, &payload, &job.Status, &errMsg, &job.CreatedAt, &processedAt)
+	err := rows.Scan(&job.ID, &job.Type, &payload, &job.Status, &errMsg, &job.CreatedAt, &processedAt, &job.OrgID, &job.RequestID)
 	if err != nil {
 		return nil, err
 	}
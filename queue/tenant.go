@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// OrgLister is implemented by stores that can list the jobs of one org.
+// SQLiteStore implements it; with other stores TenantQueue.List filters
+// every job of the status instead.
+type OrgLister interface {
+	GetByOrgPaginated(ctx context.Context, orgID string, status JobStatus, offset, limit int) ([]*Job, error)
+	CountByOrg(ctx context.Context, orgID string, status JobStatus) (int, error)
+}
+
+// TenantQueue is a view of the module scoped to the tenant of each call's
+// context; see chassis.WithTenant. It only enqueues jobs for that org and
+// only finds the org's jobs. Calls without a tenant fail with
+// chassis.ErrNoTenant.
+type TenantQueue struct {
+	mod *Module
+}
+
+// Tenant returns the tenant-scoped view of the module.
+func (mod *Module) Tenant() *TenantQueue {
+	return &TenantQueue{mod: mod}
+}
+
+// Enqueue adds a job for the tenant to the queue.
+func (tenant *TenantQueue) Enqueue(ctx context.Context, jobType string, payload any) (*Job, error) {
+	if _, err := chassis.RequireTenant(ctx); err != nil {
+		return nil, err
+	}
+	job, err := tenant.mod.Enqueue(ctx, jobType, payload)
+	if err != nil {
+		return nil, err
+	}
+	return job.(*Job), nil
+}
+
+// GetByID retrieves one of the tenant's jobs. Jobs of other orgs are
+// ErrJobNotFound.
+func (tenant *TenantQueue) GetByID(ctx context.Context, jobID string) (*Job, error) {
+	orgID, err := chassis.RequireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	job, err := tenant.mod.store.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.OrgID != orgID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List returns a page of the tenant's jobs, newest first. An empty status
+// lists jobs of every status.
+func (tenant *TenantQueue) List(ctx context.Context, status JobStatus, req pagination.Request) (*pagination.Result[*Job], error) {
+	orgID, err := chassis.RequireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	if lister, ok := tenant.mod.store.(OrgLister); ok {
+		jobs, err := lister.GetByOrgPaginated(ctx, orgID, status, offset, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		total, err := lister.CountByOrg(ctx, orgID, status)
+		if err != nil {
+			return nil, err
+		}
+		return pagination.NewResult(jobs, req, offset, total), nil
+	}
+
+	var all []*Job
+	if status == "" {
+		all, err = tenant.mod.store.GetAll(ctx)
+	} else {
+		all, err = tenant.mod.store.GetByStatus(ctx, status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0)
+	for _, job := range slices.Backward(all) {
+		if job.OrgID == orgID {
+			jobs = append(jobs, job)
+		}
+	}
+	total := len(jobs)
+	jobs = jobs[min(offset, total):min(offset+req.Limit, total)]
+	return pagination.NewResult(jobs, req, offset, total), nil
+}
+
+// ExportOrg writes the org's jobs, newest first, to jobs.json. Implements
+// chassis.OrgExporter.
+func (mod *Module) ExportOrg(ctx context.Context, orgID string, export chassis.ExportWriter) error {
+	ctx = chassis.WithTenant(ctx, orgID)
+	jobs := make([]*Job, 0)
+	req := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		page, err := mod.Tenant().List(ctx, "", req)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	return export.WriteJSON("jobs.json", jobs)
+}
+
+// PurgeOrg deletes the org's jobs, leaving any still processing to
+// finish. Implements chassis.OrgPurger. With a store that can't delete
+// jobs (see Purger) the jobs are kept and a warning logged.
+func (mod *Module) PurgeOrg(ctx context.Context, orgID string) error {
+	purger, ok := mod.store.(Purger)
+	if !ok {
+		mod.app.Logger().Warn("queue store can't delete jobs, keeping the jobs of the purged org", "org_id", orgID)
+		return nil
+	}
+	ctx = chassis.WithTenant(ctx, orgID)
+	var ids []string
+	req := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		page, err := mod.Tenant().List(ctx, "", req)
+		if err != nil {
+			return err
+		}
+		for _, job := range page.Items {
+			if job.Status != StatusProcessing {
+				ids = append(ids, job.ID)
+			}
+		}
+		if !page.HasMore {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	for batch := range slices.Chunk(ids, purgeBatchSize) {
+		if _, err := purger.DeleteJobs(ctx, batch); err != nil {
+			return fmt.Errorf("failed to delete jobs: %w", err)
+		}
+	}
+	return nil
+}
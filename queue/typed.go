@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrInvalidPayload = chassis.NewError(chassis.CodeInvalidArgument, "invalid job payload")
+
+// Validator is implemented by payload types that check their own fields.
+// Typed handlers call Validate after decoding and fail the job with its
+// error.
+type Validator interface {
+	Validate() error
+}
+
+// TypedHandler processes the decoded payload of a job.
+type TypedHandler[T any] func(ctx context.Context, payload T) error
+
+// Typed adapts handler to a Handler that decodes the job's payload into a
+// T first. A payload that is missing, isn't valid JSON for T, or fails T's
+// Validate method fails the job with an error wrapping ErrInvalidPayload,
+// without calling handler. The job itself is available from the context
+// with JobFromContext.
+func Typed[T any](handler TypedHandler[T]) Handler {
+	return func(ctx context.Context, job *Job) error {
+		payload, err := DecodePayload[T](job)
+		if err != nil {
+			return err
+		}
+		return handler(withJob(ctx, job), payload)
+	}
+}
+
+// RegisterTyped registers a typed handler for one job type, like Handle:
+//
+//	type SendEmail struct {
+//	    To      string `json:"to"`
+//	    Subject string `json:"subject"`
+//	}
+//
+//	func (p SendEmail) Validate() error {
+//	    if p.To == "" {
+//	        return errors.New("to is required")
+//	    }
+//	    return nil
+//	}
+//
+//	queue.RegisterTyped(queueMod, "send_email", func(ctx context.Context, p SendEmail) error {
+//	    return app.Email().Send(ctx, p.To, p.Subject, "")
+//	})
+func RegisterTyped[T any](mod *Module, jobType string, handler TypedHandler[T]) {
+	mod.Handle(jobType, Typed(handler))
+}
+
+// DecodePayload decodes and validates a job's payload as a T.
+func DecodePayload[T any](job *Job) (T, error) {
+	var payload T
+	data := bytes.TrimSpace(job.Payload)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return payload, fmt.Errorf("%w: %s job has no payload", ErrInvalidPayload, job.Type)
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, fmt.Errorf("%w: %s: %v", ErrInvalidPayload, job.Type, err)
+	}
+	if err := validate(&payload); err != nil {
+		return payload, fmt.Errorf("%w: %s: %v", ErrInvalidPayload, job.Type, err)
+	}
+	return payload, nil
+}
+
+// validate calls Validate on payload whether T or *T implements it.
+func validate[T any](payload *T) error {
+	if validator, ok := any(payload).(Validator); ok {
+		return validator.Validate()
+	}
+	if validator, ok := any(*payload).(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+type jobContextKey struct{}
+
+func withJob(ctx context.Context, job *Job) context.Context {
+	return context.WithValue(ctx, jobContextKey{}, job)
+}
+
+// JobFromContext returns the job a typed handler is running, or nil.
+func JobFromContext(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobContextKey{}).(*Job)
+	return job
+}
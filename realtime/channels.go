@@ -0,0 +1,375 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// Channel prefixes. Every user may join their own user channel; org
+// channels need the org permission (see WithOrgPermission).
+const (
+	UserChannelPrefix = "user:"
+	OrgChannelPrefix  = "org:"
+)
+
+// EventPush is the event of messages sent with Push and PushOrg.
+const EventPush = "push"
+
+// DefaultOrgPermission is the permission needed to join an org's channel
+// when the permissions module is registered.
+const DefaultOrgPermission = "org:read"
+
+// subscriptionBuffer is how many messages a subscription holds before it is
+// considered too slow and closed.
+const subscriptionBuffer = 64
+
+var (
+	ErrInvalidChannel   = chassis.NewError(chassis.CodeInvalidArgument, "invalid realtime channel")
+	ErrChannelForbidden = chassis.NewError(chassis.CodePermissionDenied, "not allowed to join realtime channel")
+)
+
+// Message is what subscribers receive.
+type Message struct {
+	ID      string    `json:"id"`
+	Channel string    `json:"channel"`
+	Event   string    `json:"event"`
+	Data    any       `json:"data,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Route returns the channels an event is delivered to.
+type Route func(ctx context.Context, eventType string, payload any) []string
+
+// Authorizer decides whether a user may join a channel the built-in rules
+// don't allow, such as an app-defined "project:<id>" channel.
+type Authorizer func(ctx context.Context, userID, channel string) bool
+
+// UserChannel returns the channel of a user.
+func UserChannel(userID string) string {
+	return UserChannelPrefix + userID
+}
+
+// OrgChannel returns the channel of an org.
+func OrgChannel(orgID string) string {
+	return OrgChannelPrefix + orgID
+}
+
+// DefaultRoute delivers presence changes to the org's channel and other
+// events to the channel of the payload's user_id field, or else its org_id
+// field, as encoded in JSON. Events with neither are dropped.
+func DefaultRoute(ctx context.Context, eventType string, payload any) []string {
+	if change, ok := payload.(*PresenceChange); ok {
+		return []string{OrgChannel(change.OrgID)}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	var fields struct {
+		UserID string `json:"user_id"`
+		OrgID  string `json:"org_id"`
+	}
+	if json.Unmarshal(data, &fields) != nil {
+		return nil
+	}
+	switch {
+	case fields.UserID != "":
+		return []string{UserChannel(fields.UserID)}
+	case fields.OrgID != "":
+		return []string{OrgChannel(fields.OrgID)}
+	}
+	return nil
+}
+
+// Subscription is a user's connection to a set of channels. The WebSocket
+// and SSE handlers hold one per client; Subscribe returns one for
+// in-process consumers.
+type Subscription struct {
+	userID    string
+	mod       *Module
+	messages  chan *Message
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	channels map[string]bool
+}
+
+// Subscribe joins userID to their user channel and the given channels,
+// checking each is allowed. Close the subscription when done.
+func (mod *Module) Subscribe(ctx context.Context, userID string, channels ...string) (*Subscription, error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+	sub := &Subscription{
+		userID:   userID,
+		mod:      mod,
+		messages: make(chan *Message, subscriptionBuffer),
+		done:     make(chan struct{}),
+		channels: make(map[string]bool),
+	}
+	for _, channel := range append([]string{UserChannel(userID)}, channels...) {
+		if err := sub.Join(ctx, channel); err != nil {
+			sub.Close()
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// UserID returns the subscribed user.
+func (sub *Subscription) UserID() string {
+	return sub.userID
+}
+
+// Messages returns the channel messages are delivered on.
+func (sub *Subscription) Messages() <-chan *Message {
+	return sub.messages
+}
+
+// Done is closed when the subscription is closed, including when it falls
+// too far behind and is dropped.
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Channels returns the joined channels, sorted.
+func (sub *Subscription) Channels() []string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	channels := make([]string, 0, len(sub.channels))
+	for channel := range sub.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Join adds a channel after checking the user may join it. Joining an org
+// channel connects the user in the org's presence.
+func (sub *Subscription) Join(ctx context.Context, channel string) error {
+	if err := sub.mod.authorize(ctx, sub.userID, channel); err != nil {
+		return err
+	}
+	sub.mu.Lock()
+	select {
+	case <-sub.done:
+		sub.mu.Unlock()
+		return nil
+	default:
+	}
+	if sub.channels[channel] {
+		sub.mu.Unlock()
+		return nil
+	}
+	sub.channels[channel] = true
+	sub.mu.Unlock()
+
+	sub.mod.hub.add(channel, sub)
+	if orgID, ok := strings.CutPrefix(channel, OrgChannelPrefix); ok {
+		return sub.mod.Connect(ctx, orgID, sub.userID)
+	}
+	return nil
+}
+
+// Leave removes a channel.
+func (sub *Subscription) Leave(ctx context.Context, channel string) {
+	sub.mu.Lock()
+	joined := sub.channels[channel]
+	delete(sub.channels, channel)
+	sub.mu.Unlock()
+	if joined {
+		sub.leave(ctx, channel)
+	}
+}
+
+// Close leaves every channel.
+func (sub *Subscription) Close() {
+	sub.closeOnce.Do(func() {
+		sub.mu.Lock()
+		close(sub.done)
+		channels := sub.channels
+		sub.channels = map[string]bool{}
+		sub.mu.Unlock()
+		for channel := range channels {
+			sub.leave(context.Background(), channel)
+		}
+	})
+}
+
+func (sub *Subscription) leave(ctx context.Context, channel string) {
+	sub.mod.hub.remove(channel, sub)
+	if orgID, ok := strings.CutPrefix(channel, OrgChannelPrefix); ok {
+		_ = sub.mod.Disconnect(ctx, orgID, sub.userID)
+	}
+}
+
+// deliver queues a message without blocking, reporting whether there was
+// room.
+func (sub *Subscription) deliver(message *Message) bool {
+	select {
+	case <-sub.done:
+		return true
+	case sub.messages <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// hub indexes subscriptions by channel.
+type hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscription]struct{}
+}
+
+func newHub() *hub {
+	return &hub{channels: make(map[string]map[*Subscription]struct{})}
+}
+
+func (hub *hub) add(channel string, sub *Subscription) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subs := hub.channels[channel]
+	if subs == nil {
+		subs = make(map[*Subscription]struct{})
+		hub.channels[channel] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+func (hub *hub) remove(channel string, sub *Subscription) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.channels[channel], sub)
+	if len(hub.channels[channel]) == 0 {
+		delete(hub.channels, channel)
+	}
+}
+
+// Subscribers returns how many subscriptions have joined a channel.
+func (mod *Module) Subscribers(channel string) int {
+	mod.hub.mu.RLock()
+	defer mod.hub.mu.RUnlock()
+	return len(mod.hub.channels[channel])
+}
+
+// Broadcast sends an event to every subscriber of a channel. Subscribers
+// too slow to keep up are dropped rather than holding up the others.
+func (mod *Module) Broadcast(ctx context.Context, channel, event string, data any) error {
+	kind, id, _ := strings.Cut(channel, ":")
+	if kind == "" || id == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidChannel, channel)
+	}
+	message := &Message{
+		ID:      strconv.FormatUint(mod.sequence.Add(1), 10),
+		Channel: channel,
+		Event:   event,
+		Data:    data,
+		Time:    mod.now().UTC(),
+	}
+
+	var slow []*Subscription
+	mod.hub.mu.RLock()
+	for sub := range mod.hub.channels[channel] {
+		if !sub.deliver(message) {
+			slow = append(slow, sub)
+		}
+	}
+	mod.hub.mu.RUnlock()
+
+	for _, sub := range slow {
+		mod.app.Logger().Warn("dropping slow realtime subscriber", "user_id", sub.userID, "channel", channel)
+		sub.Close()
+	}
+	return nil
+}
+
+// Push sends payload to every connection of a user.
+func (mod *Module) Push(ctx context.Context, userID string, payload any) error {
+	if userID == "" {
+		return ErrUserIDRequired
+	}
+	return mod.Broadcast(ctx, UserChannel(userID), EventPush, payload)
+}
+
+// PushOrg sends payload to every connection subscribed to an org.
+func (mod *Module) PushOrg(ctx context.Context, orgID string, payload any) error {
+	if orgID == "" {
+		return ErrOrgIDRequired
+	}
+	return mod.Broadcast(ctx, OrgChannel(orgID), EventPush, payload)
+}
+
+// authorize checks that userID may join channel: their own user channel,
+// the channel of an org they can read, or what the Authorizer allows.
+func (mod *Module) authorize(ctx context.Context, userID, channel string) error {
+	kind, id, _ := strings.Cut(channel, ":")
+	if kind == "" || id == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidChannel, channel)
+	}
+	switch {
+	case channel == UserChannel(userID):
+		return nil
+	case kind+":" == OrgChannelPrefix && mod.canReadOrg(ctx, userID, id):
+		return nil
+	case mod.authorizer != nil && mod.authorizer(ctx, userID, channel):
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrChannelForbidden, channel)
+}
+
+// canReadOrg checks the org permission with the permissions module, or
+// membership with the orgs module. Without either nobody can join.
+func (mod *Module) canReadOrg(ctx context.Context, userID, orgID string) bool {
+	if permissionsMod, ok := mod.app.TryPermissions(); ok {
+		return permissionsMod.Can(ctx, userID, mod.orgPermission, orgID)
+	}
+	if orgsMod, ok := mod.app.TryOrgs(); ok {
+		return orgsMod.GetUserRole(ctx, orgID, userID) != ""
+	}
+	return false
+}
+
+// Forward delivers events of the given type to the channels route picks,
+// like WithRoute.
+func (mod *Module) Forward(eventType string, route Route) {
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+	mod.routes = append(mod.routes, eventRoute{eventType: eventType, route: route})
+	if mod.app != nil {
+		mod.subscribe(mod.routes[len(mod.routes)-1])
+	}
+}
+
+// subscribe registers a route's event handler. It is a no-op without the
+// events module. Callers hold mod.mu.
+func (mod *Module) subscribe(route eventRoute) {
+	eventsMod, ok := mod.app.TryEvents()
+	if !ok {
+		mod.app.Logger().Warn("realtime route ignored without the events module", "event", route.eventType)
+		return
+	}
+	unsubscribe := eventsMod.Subscribe(route.eventType, func(ctx context.Context, eventType string, payload any) error {
+		for _, channel := range route.route(ctx, eventType, payload) {
+			if err := mod.Broadcast(ctx, channel, eventType, payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	mod.unsubscribes = append(mod.unsubscribes, unsubscribe)
+}
+
+type eventRoute struct {
+	eventType string
+	route     Route
+}
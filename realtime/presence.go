@@ -0,0 +1,202 @@
+package realtime
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// Presence statuses reported in PresenceChange.
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+var (
+	ErrOrgIDRequired  = chassis.NewError(chassis.CodeInvalidArgument, "org ID is required")
+	ErrUserIDRequired = chassis.NewError(chassis.CodeInvalidArgument, "user ID is required")
+)
+
+// Presence describes a user currently online in an org.
+type Presence struct {
+	OrgID       string    `json:"org_id"`
+	UserID      string    `json:"user_id"`
+	Connections int       `json:"connections"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// PresenceChange is the payload of presence.changed events.
+type PresenceChange struct {
+	OrgID    string    `json:"org_id"`
+	UserID   string    `json:"user_id"`
+	Status   string    `json:"status"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type presenceTracker struct {
+	mu   sync.Mutex
+	orgs map[string]map[string]*Presence
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{orgs: make(map[string]map[string]*Presence)}
+}
+
+// Heartbeat records that a user is connected to an org. The first heartbeat
+// marks the user online; later ones refresh their last-seen time.
+func (mod *Module) Heartbeat(ctx context.Context, orgID, userID string) error {
+	return mod.touch(ctx, orgID, userID, false)
+}
+
+// Connect records a new connection (e.g., a browser tab) for a user.
+// A user with several connections stays online until all are closed with Disconnect.
+func (mod *Module) Connect(ctx context.Context, orgID, userID string) error {
+	return mod.touch(ctx, orgID, userID, true)
+}
+
+func (mod *Module) touch(ctx context.Context, orgID, userID string, connect bool) error {
+	if err := validateIdentity(orgID, userID); err != nil {
+		return err
+	}
+
+	now := mod.now()
+	tracker := mod.presence
+	tracker.mu.Lock()
+	users := tracker.orgs[orgID]
+	if users == nil {
+		users = make(map[string]*Presence)
+		tracker.orgs[orgID] = users
+	}
+	entry, online := users[userID]
+	if !online {
+		entry = &Presence{OrgID: orgID, UserID: userID, ConnectedAt: now}
+		users[userID] = entry
+	}
+	entry.LastSeen = now
+	if connect {
+		entry.Connections++
+	}
+	tracker.mu.Unlock()
+
+	if !online {
+		mod.publish(ctx, EventPresenceChanged, &PresenceChange{
+			OrgID: orgID, UserID: userID, Status: StatusOnline, LastSeen: now,
+		})
+	}
+	return nil
+}
+
+// Disconnect records that a connection closed. The user goes offline when
+// their last connection closes; users tracked only through heartbeats go
+// offline immediately.
+func (mod *Module) Disconnect(ctx context.Context, orgID, userID string) error {
+	if err := validateIdentity(orgID, userID); err != nil {
+		return err
+	}
+
+	tracker := mod.presence
+	tracker.mu.Lock()
+	entry, online := tracker.orgs[orgID][userID]
+	if !online {
+		tracker.mu.Unlock()
+		return nil
+	}
+	if entry.Connections > 1 {
+		entry.Connections--
+		tracker.mu.Unlock()
+		return nil
+	}
+	tracker.remove(orgID, userID)
+	tracker.mu.Unlock()
+
+	mod.publish(ctx, EventPresenceChanged, &PresenceChange{
+		OrgID: orgID, UserID: userID, Status: StatusOffline, LastSeen: entry.LastSeen,
+	})
+	return nil
+}
+
+// Presence returns the users online in an org as []*Presence, sorted by user ID.
+func (mod *Module) Presence(ctx context.Context, orgID string) (any, error) {
+	return mod.OnlineUsers(ctx, orgID)
+}
+
+// OnlineUsers is the typed form of Presence.
+func (mod *Module) OnlineUsers(ctx context.Context, orgID string) ([]*Presence, error) {
+	if orgID == "" {
+		return nil, ErrOrgIDRequired
+	}
+
+	now := mod.now()
+	tracker := mod.presence
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	result := make([]*Presence, 0, len(tracker.orgs[orgID]))
+	for _, entry := range tracker.orgs[orgID] {
+		// Hide entries the sweeper hasn't collected yet
+		if now.Sub(entry.LastSeen) > mod.presenceTTL {
+			continue
+		}
+		copied := *entry
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+	return result, nil
+}
+
+// IsOnline reports whether a user is online in an org.
+func (mod *Module) IsOnline(ctx context.Context, orgID, userID string) bool {
+	tracker := mod.presence
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	entry, online := tracker.orgs[orgID][userID]
+	return online && mod.now().Sub(entry.LastSeen) <= mod.presenceTTL
+}
+
+// Sweep marks users offline whose last heartbeat is older than the presence TTL.
+// It runs periodically in the background; call it directly in tests.
+func (mod *Module) Sweep(ctx context.Context) {
+	now := mod.now()
+	tracker := mod.presence
+
+	var expired []*Presence
+	tracker.mu.Lock()
+	for orgID, users := range tracker.orgs {
+		for userID, entry := range users {
+			if now.Sub(entry.LastSeen) > mod.presenceTTL {
+				expired = append(expired, entry)
+				tracker.remove(orgID, userID)
+			}
+		}
+	}
+	tracker.mu.Unlock()
+
+	for _, entry := range expired {
+		mod.publish(ctx, EventPresenceChanged, &PresenceChange{
+			OrgID: entry.OrgID, UserID: entry.UserID, Status: StatusOffline, LastSeen: entry.LastSeen,
+		})
+	}
+}
+
+func validateIdentity(orgID, userID string) error {
+	if orgID == "" {
+		return ErrOrgIDRequired
+	}
+	if userID == "" {
+		return ErrUserIDRequired
+	}
+	return nil
+}
+
+// remove deletes an entry. Caller must hold tracker.mu.
+func (tracker *presenceTracker) remove(orgID, userID string) {
+	delete(tracker.orgs[orgID], userID)
+	if len(tracker.orgs[orgID]) == 0 {
+		delete(tracker.orgs, orgID)
+	}
+}
@@ -0,0 +1,283 @@
+// Package realtime provides soft real-time features for the chassis framework.
+//
+// It tracks presence, which users are connected in each org, and delivers
+// messages to connected clients over WebSocket or server-sent events.
+// Clients (or the connection handler serving them) send heartbeats; users
+// whose heartbeats stop are marked offline after the presence TTL.
+//
+// # Usage
+//
+// Register the module with chassis:
+//
+//	app := chassis.New(
+//	    chassis.WithModules(
+//	        events.New(),
+//	        realtime.New(),
+//	    ),
+//	)
+//
+// Record activity and query who's online:
+//
+//	app.Realtime().Heartbeat(ctx, orgID, userID)   // on connect and periodically
+//	app.Realtime().Disconnect(ctx, orgID, userID)  // when a connection closes
+//
+//	result, _ := app.Realtime().Presence(ctx, orgID)
+//	for _, entry := range result.([]*realtime.Presence) {
+//	    log.Printf("%s online since %s", entry.UserID, entry.ConnectedAt)
+//	}
+//
+// # Channels
+//
+// Messages are sent to channels. Each user has a "user:<id>" channel, and
+// each org an "org:<id>" channel that members can join: with the
+// permissions module, users need org:read (see WithOrgPermission); with
+// only the orgs module, any role. WithAuthorizer allows other channels.
+// Clients connected to an org channel are kept online in its presence.
+//
+//	app.Realtime().Push(ctx, userID, map[string]any{"unread": 3})
+//	realtimeMod.PushOrg(ctx, orgID, payload)
+//	realtimeMod.Broadcast(ctx, "project:42", "task.moved", task)
+//
+// Handler serves authenticated clients at <prefix>/ws (WebSocket) and
+// <prefix>/events (server-sent events); api.Mount mounts it at /realtime/.
+// Clients pick org channels with ?channels=org:acme, and WebSocket clients
+// can send {"type": "subscribe", "channel": "org:acme"} later.
+//
+// # Events
+//
+// When the events module is registered, a presence.changed event with a
+// *PresenceChange payload is published whenever a user comes online or goes
+// offline in an org. Heartbeats from users already online don't publish.
+//
+// WithEvents forwards events of the given types to clients, routed by
+// DefaultRoute to the payload's user or org; WithRoute picks the channels
+// itself:
+//
+//	realtime.New(
+//	    realtime.WithEvents(notifications.EventCreated, realtime.EventPresenceChanged),
+//	    realtime.WithRoute("task.moved", func(ctx context.Context, eventType string, payload any) []string {
+//	        return []string{"project:" + payload.(*Task).ProjectID}
+//	    }),
+//	)
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	realtime:
+//	  presence_ttl: 60s
+//	  events: [notification.created, presence.changed]
+//	  org_permission: org:read
+//	  allowed_origins: [https://app.example.com]
+//
+// Or programmatically:
+//
+//	realtime.New(realtime.WithPresenceTTL(time.Minute))
+package realtime
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// EventPresenceChanged is published when a user comes online or goes offline.
+const EventPresenceChanged = "presence.changed"
+
+// DefaultPresenceTTL is how long a user stays online without a heartbeat.
+const DefaultPresenceTTL = 60 * time.Second
+
+// Module is the realtime module implementation.
+type Module struct {
+	app         *chassis.App
+	presenceTTL time.Duration
+	now         func() time.Time
+	presence    *presenceTracker
+	stop        chan struct{}
+	stopped     sync.WaitGroup
+
+	hub            *hub
+	sequence       atomic.Uint64
+	orgPermission  string
+	authorizer     Authorizer
+	allowedOrigins []string
+
+	mu           sync.Mutex
+	routes       []eventRoute
+	unsubscribes []func()
+}
+
+// Option is a function that configures the realtime module.
+type Option func(*Module)
+
+// WithPresenceTTL sets how long a user stays online after their last heartbeat.
+func WithPresenceTTL(ttl time.Duration) Option {
+	return func(mod *Module) {
+		mod.presenceTTL = ttl
+	}
+}
+
+// WithClock sets the time source. Intended for tests.
+func WithClock(now func() time.Time) Option {
+	return func(mod *Module) {
+		mod.now = now
+	}
+}
+
+// WithEvents forwards events of the given types to clients, on the
+// channels picked by DefaultRoute.
+func WithEvents(eventTypes ...string) Option {
+	return func(mod *Module) {
+		for _, eventType := range eventTypes {
+			mod.routes = append(mod.routes, eventRoute{eventType: eventType, route: DefaultRoute})
+		}
+	}
+}
+
+// WithRoute forwards events of a type to the channels route picks.
+func WithRoute(eventType string, route Route) Option {
+	return func(mod *Module) {
+		mod.routes = append(mod.routes, eventRoute{eventType: eventType, route: route})
+	}
+}
+
+// WithOrgPermission sets the permission needed to join an org's channel
+// when the permissions module is registered.
+func WithOrgPermission(permission string) Option {
+	return func(mod *Module) {
+		mod.orgPermission = permission
+	}
+}
+
+// WithAuthorizer allows joining channels beyond the user's own and their
+// orgs'.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(mod *Module) {
+		mod.authorizer = authorizer
+	}
+}
+
+// WithAllowedOrigins allows WebSocket connections from other origins than
+// the host serving them, e.g. "https://app.example.com".
+func WithAllowedOrigins(origins ...string) Option {
+	return func(mod *Module) {
+		mod.allowedOrigins = append(mod.allowedOrigins, origins...)
+	}
+}
+
+// New creates a new realtime module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		presenceTTL: DefaultPresenceTTL,
+		now:         time.Now,
+		presence:    newPresenceTracker(),
+
+		hub:           newHub(),
+		orgPermission: DefaultOrgPermission,
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "realtime"
+}
+
+// Init initializes the realtime module and starts the presence sweeper.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	// Read config if available
+	if cfg := app.ConfigData(); cfg != nil {
+		if cfg.Get("realtime.presence_ttl") != nil {
+			ttl, err := cfg.MustGetDuration("realtime.presence_ttl")
+			if err != nil {
+				return err
+			}
+			mod.presenceTTL = ttl
+		}
+		for _, eventType := range cfg.GetStringSlice("realtime.events") {
+			mod.routes = append(mod.routes, eventRoute{eventType: eventType, route: DefaultRoute})
+		}
+		if permission := cfg.GetString("realtime.org_permission"); permission != "" {
+			mod.orgPermission = permission
+		}
+		mod.allowedOrigins = append(mod.allowedOrigins, cfg.GetStringSlice("realtime.allowed_origins")...)
+	}
+
+	mod.mu.Lock()
+	for _, route := range mod.routes {
+		mod.subscribe(route)
+	}
+	mod.mu.Unlock()
+
+	mod.stop = make(chan struct{})
+	mod.stopped.Add(1)
+	go mod.sweepLoop()
+
+	app.Logger().Info("realtime module initialized", "presence_ttl", mod.presenceTTL, "routes", len(mod.routes))
+	return nil
+}
+
+// Shutdown stops forwarding events, closes subscriptions, which ends their
+// connections, and stops the presence sweeper.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	mod.mu.Lock()
+	for _, unsubscribe := range mod.unsubscribes {
+		unsubscribe()
+	}
+	mod.unsubscribes = nil
+	mod.mu.Unlock()
+
+	var subs []*Subscription
+	mod.hub.mu.RLock()
+	for _, channel := range mod.hub.channels {
+		for sub := range channel {
+			subs = append(subs, sub)
+		}
+	}
+	mod.hub.mu.RUnlock()
+	for _, sub := range subs {
+		sub.Close()
+	}
+
+	if mod.stop != nil {
+		close(mod.stop)
+		mod.stopped.Wait()
+		mod.stop = nil
+	}
+	return nil
+}
+
+func (mod *Module) sweepLoop() {
+	defer mod.stopped.Done()
+
+	interval := mod.presenceTTL / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mod.stop:
+			return
+		case <-ticker.C:
+			mod.Sweep(context.Background())
+		}
+	}
+}
+
+// publish sends an event if the events module is registered.
+func (mod *Module) publish(ctx context.Context, eventType string, payload any) {
+	mod.app.PublishEvent(ctx, eventType, payload)
+}
@@ -0,0 +1,453 @@
+package realtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/orgs"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(duration time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(duration)
+}
+
+func setupRealtime(t *testing.T) (*Module, *fakeClock, chan *PresenceChange) {
+	t.Helper()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	mod := New(WithPresenceTTL(time.Minute), WithClock(clock.Now))
+
+	app := chassis.New(chassis.WithModules(events.New(), mod))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+
+	changes := make(chan *PresenceChange, 16)
+	app.Events().Subscribe(EventPresenceChanged, events.Handler(func(ctx context.Context, eventType string, payload any) error {
+		changes <- payload.(*PresenceChange)
+		return nil
+	}))
+	return mod, clock, changes
+}
+
+func expectChange(t *testing.T, changes chan *PresenceChange, userID, status string) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		if change.UserID != userID || change.Status != status {
+			t.Errorf("expected %s %s, got %s %s", userID, status, change.UserID, change.Status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected presence.changed for %s %s", userID, status)
+	}
+}
+
+func expectNoChange(t *testing.T, changes chan *PresenceChange) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected presence.changed: %+v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPresence_HeartbeatAndQuery(t *testing.T) {
+	mod, _, changes := setupRealtime(t)
+	ctx := context.Background()
+
+	if err := mod.Heartbeat(ctx, "org-1", "bob"); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	expectChange(t, changes, "bob", StatusOnline)
+	if err := mod.Heartbeat(ctx, "org-1", "alice"); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	expectChange(t, changes, "alice", StatusOnline)
+
+	// Repeated heartbeats don't publish
+	if err := mod.Heartbeat(ctx, "org-1", "bob"); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	expectNoChange(t, changes)
+
+	result, err := mod.Presence(ctx, "org-1")
+	if err != nil {
+		t.Fatalf("Presence failed: %v", err)
+	}
+	online := result.([]*Presence)
+	if len(online) != 2 || online[0].UserID != "alice" || online[1].UserID != "bob" {
+		t.Errorf("expected [alice bob], got %+v", online)
+	}
+
+	other, _ := mod.OnlineUsers(ctx, "org-2")
+	if len(other) != 0 {
+		t.Errorf("presence should be scoped per org, got %+v", other)
+	}
+}
+
+func TestPresence_ExpiresWithoutHeartbeat(t *testing.T) {
+	mod, clock, changes := setupRealtime(t)
+	ctx := context.Background()
+
+	_ = mod.Heartbeat(ctx, "org-1", "alice")
+	expectChange(t, changes, "alice", StatusOnline)
+
+	clock.Advance(2 * time.Minute)
+	if mod.IsOnline(ctx, "org-1", "alice") {
+		t.Error("user should be offline after TTL")
+	}
+
+	mod.Sweep(ctx)
+	expectChange(t, changes, "alice", StatusOffline)
+
+	online, _ := mod.OnlineUsers(ctx, "org-1")
+	if len(online) != 0 {
+		t.Errorf("expected no one online, got %+v", online)
+	}
+}
+
+func TestPresence_MultipleConnections(t *testing.T) {
+	mod, _, changes := setupRealtime(t)
+	ctx := context.Background()
+
+	_ = mod.Connect(ctx, "org-1", "alice")
+	_ = mod.Connect(ctx, "org-1", "alice")
+	expectChange(t, changes, "alice", StatusOnline)
+
+	_ = mod.Disconnect(ctx, "org-1", "alice")
+	if !mod.IsOnline(ctx, "org-1", "alice") {
+		t.Error("user with an open connection should stay online")
+	}
+	expectNoChange(t, changes)
+
+	_ = mod.Disconnect(ctx, "org-1", "alice")
+	expectChange(t, changes, "alice", StatusOffline)
+	if mod.IsOnline(ctx, "org-1", "alice") {
+		t.Error("user should be offline after last disconnect")
+	}
+}
+
+func TestPresence_Validation(t *testing.T) {
+	mod := New()
+	ctx := context.Background()
+
+	if err := mod.Heartbeat(ctx, "", "alice"); !errors.Is(err, ErrOrgIDRequired) {
+		t.Errorf("expected ErrOrgIDRequired, got %v", err)
+	}
+	if err := mod.Heartbeat(ctx, "org-1", ""); !errors.Is(err, ErrUserIDRequired) {
+		t.Errorf("expected ErrUserIDRequired, got %v", err)
+	}
+	if _, err := mod.Presence(ctx, ""); !errors.Is(err, ErrOrgIDRequired) {
+		t.Errorf("expected ErrOrgIDRequired, got %v", err)
+	}
+}
+
+func TestPresence_WithoutEventsModule(t *testing.T) {
+	mod := New()
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	if err := app.Realtime().Heartbeat(context.Background(), "org-1", "alice"); err != nil {
+		t.Fatalf("Heartbeat without events module failed: %v", err)
+	}
+	if !mod.IsOnline(context.Background(), "org-1", "alice") {
+		t.Error("expected alice to be online")
+	}
+}
+
+// setupChannels returns a realtime module with an org "acme" that user-1
+// belongs to.
+func setupChannels(t *testing.T, opts ...Option) (*Module, *chassis.App, string) {
+	t.Helper()
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(t.TempDir(), "orgs.db")))
+	mod := New(opts...)
+	app := chassis.New(chassis.WithModules(events.New(), orgsMod, mod))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+
+	ctx := context.Background()
+	result, err := orgsMod.Create(ctx, orgs.CreateInput{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	orgID := result.(*orgs.Org).ID()
+	if _, err := orgsMod.AddMember(ctx, orgID, "user-1", "member"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	return mod, app, orgID
+}
+
+func receive(t *testing.T, sub *Subscription) *Message {
+	t.Helper()
+	select {
+	case message := <-sub.Messages():
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+func TestSubscribeAndPush(t *testing.T) {
+	mod, app, orgID := setupChannels(t)
+	ctx := context.Background()
+
+	sub, err := mod.Subscribe(ctx, "user-1", OrgChannel(orgID))
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer sub.Close()
+	if got := strings.Join(sub.Channels(), ","); got != OrgChannel(orgID)+",user:user-1" {
+		t.Errorf("unexpected channels: %s", got)
+	}
+	if !mod.IsOnline(ctx, orgID, "user-1") {
+		t.Error("expected joining the org channel to mark the user online")
+	}
+
+	if _, err := mod.Subscribe(ctx, "user-2", OrgChannel(orgID)); !errors.Is(err, ErrChannelForbidden) {
+		t.Errorf("expected ErrChannelForbidden for a non-member, got %v", err)
+	}
+	if _, err := mod.Subscribe(ctx, "user-2", UserChannel("user-1")); !errors.Is(err, ErrChannelForbidden) {
+		t.Errorf("expected ErrChannelForbidden for another user's channel, got %v", err)
+	}
+	if err := sub.Join(ctx, "nonsense"); !errors.Is(err, ErrInvalidChannel) {
+		t.Errorf("expected ErrInvalidChannel, got %v", err)
+	}
+
+	if err := app.Realtime().Push(ctx, "user-1", map[string]int{"unread": 3}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	message := receive(t, sub)
+	if message.Event != EventPush || message.Channel != "user:user-1" || message.ID == "" {
+		t.Errorf("unexpected message: %+v", message)
+	}
+	if err := mod.PushOrg(ctx, orgID, "hello"); err != nil {
+		t.Fatalf("PushOrg failed: %v", err)
+	}
+	if message := receive(t, sub); message.Channel != OrgChannel(orgID) || message.Data != "hello" {
+		t.Errorf("unexpected org message: %+v", message)
+	}
+
+	sub.Close()
+	if mod.Subscribers(UserChannel("user-1")) != 0 || mod.IsOnline(ctx, orgID, "user-1") {
+		t.Error("expected closing to leave the channels and go offline")
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	mod, _, _ := setupChannels(t, WithAuthorizer(func(ctx context.Context, userID, channel string) bool {
+		return channel == "project:42" && userID == "user-1"
+	}))
+	ctx := context.Background()
+
+	sub, err := mod.Subscribe(ctx, "user-1", "project:42")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer sub.Close()
+	if _, err := mod.Subscribe(ctx, "user-2", "project:42"); !errors.Is(err, ErrChannelForbidden) {
+		t.Errorf("expected ErrChannelForbidden, got %v", err)
+	}
+	if err := mod.Broadcast(ctx, "project:42", "task.moved", "task-1"); err != nil {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+	if message := receive(t, sub); message.Event != "task.moved" || message.Data != "task-1" {
+		t.Errorf("unexpected message: %+v", message)
+	}
+}
+
+func TestForwardEvents(t *testing.T) {
+	type invoice struct {
+		UserID string `json:"user_id"`
+		OrgID  string `json:"org_id"`
+	}
+	mod, app, orgID := setupChannels(t,
+		WithEvents("invoice.paid", EventPresenceChanged),
+		WithRoute("deploy.finished", func(ctx context.Context, eventType string, payload any) []string {
+			return []string{"user:" + payload.(string)}
+		}),
+	)
+	ctx := context.Background()
+
+	sub, err := mod.Subscribe(ctx, "user-1", OrgChannel(orgID))
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer sub.Close()
+	if message := receive(t, sub); message.Event != EventPresenceChanged || message.Channel != OrgChannel(orgID) {
+		t.Errorf("expected the user's own presence change on the org channel, got %+v", message)
+	}
+
+	app.Events().Publish(ctx, "invoice.paid", &invoice{UserID: "user-1", OrgID: orgID})
+	if message := receive(t, sub); message.Event != "invoice.paid" || message.Channel != "user:user-1" {
+		t.Errorf("expected the invoice on the user channel, got %+v", message)
+	}
+	app.Events().Publish(ctx, "invoice.paid", &invoice{OrgID: orgID})
+	if message := receive(t, sub); message.Channel != OrgChannel(orgID) {
+		t.Errorf("expected an org-wide invoice on the org channel, got %+v", message)
+	}
+	app.Events().Publish(ctx, "deploy.finished", "user-1")
+	if message := receive(t, sub); message.Event != "deploy.finished" {
+		t.Errorf("expected the routed event, got %+v", message)
+	}
+	app.Events().Publish(ctx, "comment.added", &invoice{UserID: "user-1"})
+	select {
+	case message := <-sub.Messages():
+		t.Errorf("expected events not forwarded to be skipped, got %+v", message)
+	default:
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	mod, _, _ := setupChannels(t)
+	ctx := context.Background()
+	sub, err := mod.Subscribe(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	for i := 0; i <= subscriptionBuffer; i++ {
+		_ = mod.Push(ctx, "user-1", i)
+	}
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the slow subscriber closed")
+	}
+	if mod.Subscribers(UserChannel("user-1")) != 0 {
+		t.Error("expected the slow subscriber removed")
+	}
+}
+
+func serveRealtime(t *testing.T, mod *Module) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if userID := request.URL.Query().Get("as"); userID != "" {
+			request = request.WithContext(auth.WithSession(request.Context(), &auth.Session{UserID: userID}))
+		}
+		mod.Handler().ServeHTTP(writer, request)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func waitForSubscribers(t *testing.T, mod *Module, channel string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for mod.Subscribers(channel) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers of %s, got %d", count, channel, mod.Subscribers(channel))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	mod, _, orgID := setupChannels(t)
+	server := serveRealtime(t, mod)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if response, err := http.Get(server.URL + "/realtime/ws"); err != nil || response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a user, got %v, %v", response, err)
+	}
+	if _, err := websocket.Dial(wsURL+"/realtime/ws?as=user-1", "", "https://evil.example.com"); err == nil {
+		t.Error("expected a cross-origin handshake to fail")
+	}
+
+	conn, err := websocket.Dial(wsURL+"/realtime/ws?as=user-1", "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	waitForSubscribers(t, mod, UserChannel("user-1"), 1)
+
+	if err := mod.Push(context.Background(), "user-1", "hello"); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	var message Message
+	if err := websocket.JSON.Receive(conn, &message); err != nil || message.Event != EventPush || message.Data != "hello" {
+		t.Fatalf("unexpected message %+v: %v", message, err)
+	}
+
+	if err := websocket.JSON.Send(conn, clientMessage{Type: "subscribe", Channel: "org:other"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := websocket.JSON.Receive(conn, &message); err != nil || message.Event != "error" {
+		t.Errorf("expected an error joining another org, got %+v: %v", message, err)
+	}
+	if err := websocket.JSON.Send(conn, clientMessage{Type: "subscribe", Channel: OrgChannel(orgID)}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := websocket.JSON.Receive(conn, &message); err != nil || message.Event != "subscribed" {
+		t.Fatalf("expected the subscription acknowledged, got %+v: %v", message, err)
+	}
+	if !mod.IsOnline(context.Background(), orgID, "user-1") {
+		t.Error("expected the connection to mark the user online")
+	}
+
+	_ = conn.Close()
+	waitForSubscribers(t, mod, UserChannel("user-1"), 0)
+}
+
+func TestServerSentEvents(t *testing.T) {
+	mod, _, orgID := setupChannels(t)
+	server := serveRealtime(t, mod)
+
+	if response, err := http.Get(server.URL + "/realtime/events?as=user-2&channels=" + OrgChannel(orgID)); err != nil || response.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-member, got %v, %v", response, err)
+	}
+
+	response, err := http.Get(server.URL + "/realtime/events?as=user-1&channels=" + OrgChannel(orgID))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", response.Header.Get("Content-Type"))
+	}
+	waitForSubscribers(t, mod, OrgChannel(orgID), 1)
+
+	if err := mod.PushOrg(context.Background(), orgID, map[string]string{"status": "deployed"}); err != nil {
+		t.Fatalf("PushOrg failed: %v", err)
+	}
+	reader := bufio.NewReader(response.Body)
+	var event, data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString failed: %v", err)
+		}
+		if value, ok := strings.CutPrefix(line, "event: "); ok {
+			event = strings.TrimSpace(value)
+		}
+		if value, ok := strings.CutPrefix(line, "data: "); ok {
+			data = value
+		}
+	}
+	var message Message
+	if err := json.Unmarshal([]byte(data), &message); err != nil || event != EventPush || message.Channel != OrgChannel(orgID) {
+		t.Errorf("unexpected event %q: %s", event, data)
+	}
+}
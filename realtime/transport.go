@@ -0,0 +1,234 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/auth"
+)
+
+// clientMessage is what WebSocket clients send to change their channels:
+//
+//	{"type": "subscribe", "channel": "org:acme"}
+//	{"type": "unsubscribe", "channel": "org:acme"}
+type clientMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+}
+
+// Handler serves the realtime endpoints for logged-in users, wherever it is
+// mounted:
+//
+//	GET <prefix>/ws      WebSocket
+//	GET <prefix>/events  server-sent events
+//
+// Both join the user's channel and those in the channels query parameter,
+// e.g. ?channels=org:acme,org:globex; WebSocket clients can also subscribe
+// and unsubscribe later. Every client is sent a "ping" event at least every
+// half presence TTL, which keeps the user online in their orgs.
+func (mod *Module) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch path.Base(request.URL.Path) {
+		case "ws":
+			mod.serveWebSocket(writer, request)
+		case "events":
+			mod.serveEvents(writer, request)
+		default:
+			http.NotFound(writer, request)
+		}
+	})
+}
+
+// Endpoints serves Handler at /realtime/ for logged-in users. Implements
+// chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{{
+		Name:       "realtime",
+		Path:       "/realtime/",
+		Handler:    mod.Handler(),
+		Permission: api.PermissionAuthenticated,
+		Enabled:    true,
+	}}
+}
+
+// subscribeRequest opens the subscription of a request, or writes an error.
+func (mod *Module) subscribeRequest(writer http.ResponseWriter, request *http.Request) (*Subscription, bool) {
+	if request.Method != http.MethodGet {
+		api.MethodNotAllowed(writer, request)
+		return nil, false
+	}
+	ctx := request.Context()
+	userID := auth.UserIDFromContext(ctx)
+	if authMod, ok := mod.app.TryAuth(); userID == "" && ok {
+		userID = authMod.GetUserID(ctx, request)
+	}
+	if userID == "" {
+		api.WriteError(writer, request, auth.ErrNotAuthenticated)
+		return nil, false
+	}
+
+	var channels []string
+	for _, value := range request.URL.Query()["channels"] {
+		for _, channel := range strings.Split(value, ",") {
+			if channel = strings.TrimSpace(channel); channel != "" {
+				channels = append(channels, channel)
+			}
+		}
+	}
+	sub, err := mod.Subscribe(ctx, userID, channels...)
+	if err != nil {
+		api.WriteError(writer, request, err)
+		return nil, false
+	}
+	return sub, true
+}
+
+// serveEvents streams messages as server-sent events until the client goes
+// away.
+func (mod *Module) serveEvents(writer http.ResponseWriter, request *http.Request) {
+	sub, ok := mod.subscribeRequest(writer, request)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	controller := http.NewResponseController(writer)
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	write := func(message *Message) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", message.ID, message.Event, data); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+	mod.pump(request.Context(), sub, write)
+}
+
+// serveWebSocket upgrades the request and relays messages both ways until
+// either side closes.
+func (mod *Module) serveWebSocket(writer http.ResponseWriter, request *http.Request) {
+	sub, ok := mod.subscribeRequest(writer, request)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	server := websocket.Server{
+		Handshake: mod.checkOrigin,
+		Handler: func(conn *websocket.Conn) {
+			defer func() { _ = conn.Close() }()
+			ctx, cancel := context.WithCancel(request.Context())
+			defer cancel()
+
+			go func() {
+				defer cancel()
+				for {
+					var incoming clientMessage
+					if err := websocket.JSON.Receive(conn, &incoming); err != nil {
+						return
+					}
+					mod.handleClientMessage(ctx, sub, incoming)
+				}
+			}()
+			mod.pump(ctx, sub, func(message *Message) error {
+				return websocket.JSON.Send(conn, message)
+			})
+		},
+	}
+	server.ServeHTTP(writer, request)
+}
+
+// handleClientMessage applies a WebSocket client's message, acknowledging
+// it on the subscription.
+func (mod *Module) handleClientMessage(ctx context.Context, sub *Subscription, incoming clientMessage) {
+	reply := &Message{Channel: incoming.Channel, Time: mod.now().UTC()}
+	switch incoming.Type {
+	case "subscribe":
+		if err := sub.Join(ctx, incoming.Channel); err != nil {
+			reply.Event, reply.Data = "error", map[string]string{"code": string(chassis.ErrorCodeOf(err)), "message": err.Error()}
+		} else {
+			reply.Event = "subscribed"
+		}
+	case "unsubscribe":
+		sub.Leave(ctx, incoming.Channel)
+		reply.Event = "unsubscribed"
+	default:
+		reply.Event, reply.Data = "error", map[string]string{"code": string(chassis.CodeInvalidArgument), "message": "unknown message type " + incoming.Type}
+	}
+	sub.deliver(reply)
+}
+
+// pump writes the subscription's messages, and pings while it is idle,
+// until ctx ends, the subscription closes or a write fails.
+func (mod *Module) pump(ctx context.Context, sub *Subscription, write func(*Message) error) {
+	interval := mod.presenceTTL / 2
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			return
+		case message := <-sub.Messages():
+			if err := write(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			for _, channel := range sub.Channels() {
+				if orgID, ok := strings.CutPrefix(channel, OrgChannelPrefix); ok {
+					_ = mod.Heartbeat(ctx, orgID, sub.UserID())
+				}
+			}
+			if err := write(&Message{Event: "ping", Time: mod.now().UTC()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// checkOrigin accepts WebSocket handshakes from the request's own host or
+// an allowed origin, so other sites can't open connections with the user's
+// cookies. Clients that send no Origin, such as servers, are accepted.
+func (mod *Module) checkOrigin(config *websocket.Config, request *http.Request) error {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return errors.New("realtime: invalid origin")
+	}
+	config.Origin = parsed
+	if strings.EqualFold(parsed.Host, request.Host) || slices.Contains(mod.allowedOrigins, origin) {
+		return nil
+	}
+	return fmt.Errorf("realtime: origin %s not allowed", origin)
+}
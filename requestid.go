@@ -0,0 +1,123 @@
+package chassis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader is the header request IDs are read from and returned in.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken from clients, so they can't
+// bloat logs.
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context carrying a request ID. Loggers built with
+// NewLogHandler tag records logged with the context, the events module
+// records the ID on dead letters and the queue module on enqueued jobs, so
+// one ID follows a request through everything it sets off.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// RequestIDMiddleware gives every request an ID: the X-Request-ID header
+// when the client or a proxy sent a usable one, otherwise a new one. The ID
+// is put in the request context and its logger and returned in the
+// response's X-Request-ID header. App.Middleware includes it.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx, requestID := requestContext(request)
+		ctx = WithLogger(ctx, LoggerFromContext(request.Context()).With("request_id", requestID))
+		writer.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// requestContext returns the request's context with its request ID,
+// keeping one already set by earlier middleware.
+func requestContext(request *http.Request) (context.Context, string) {
+	ctx := request.Context()
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		return ctx, requestID
+	}
+	requestID := request.Header.Get(RequestIDHeader)
+	if !validRequestID(requestID) {
+		requestID = NewRequestID()
+	}
+	return WithRequestID(ctx, requestID), requestID
+}
+
+// validRequestID reports whether a client-supplied ID is short and made of
+// characters that are safe to log and echo in a header.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, char := range requestID {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9':
+		case char == '-', char == '_', char == '.', char == ':', char == '/', char == '+', char == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logHandler adds the request ID of the context to records.
+type logHandler struct {
+	slog.Handler
+	tagged bool // a request_id attribute was already added with WithAttrs
+}
+
+// NewLogHandler wraps handler to add a request_id attribute to records
+// logged with a context carrying one (InfoContext and friends). The app's
+// logger uses it, so module logs written while serving a request carry its
+// ID.
+func NewLogHandler(handler slog.Handler) slog.Handler {
+	return &logHandler{Handler: handler}
+}
+
+// Handle adds the request ID, unless the logger already has one.
+func (handler *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !handler.tagged {
+		if requestID := RequestIDFromContext(ctx); requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+// WithAttrs remembers whether a request ID was added.
+func (handler *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	tagged := handler.tagged
+	for _, attr := range attrs {
+		if attr.Key == "request_id" {
+			tagged = true
+		}
+	}
+	return &logHandler{Handler: handler.Handler.WithAttrs(attrs), tagged: tagged}
+}
+
+// WithGroup wraps the grouped handler.
+func (handler *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{Handler: handler.Handler.WithGroup(name), tagged: handler.tagged}
+}
@@ -0,0 +1,232 @@
+package chassis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds the graceful shutdown of Run unless
+// WithShutdownTimeout or chassis.shutdown_timeout says otherwise.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Service is implemented by modules with background work, such as serving
+// HTTP, processing jobs or sweeping expired entries. Run starts each
+// service in its own goroutine once every module is registered and
+// supervises it: Start blocks until ctx is cancelled and then returns nil.
+// A panic restarts the service after a backoff; returning an error stops
+// the app.
+type Service interface {
+	Start(ctx context.Context) error
+}
+
+// Starter is the former name of Service.
+//
+// Deprecated: Use Service.
+type Starter = Service
+
+// Service states reported by App.Services.
+const (
+	ServiceStarting   = "starting"
+	ServiceRunning    = "running"
+	ServiceRestarting = "restarting" // waiting to restart after a panic
+	ServiceStopped    = "stopped"
+	ServiceFailed     = "failed"
+)
+
+// Restart backoff of services that panic. It doubles with every panic in
+// a row and resets once a service has run for serviceStableAfter.
+const (
+	serviceMinBackoff  = 100 * time.Millisecond
+	serviceMaxBackoff  = 30 * time.Second
+	serviceStableAfter = time.Minute
+)
+
+// ServiceStatus is the state of a service run by Run.
+type ServiceStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// WithShutdownTimeout sets how long Run waits for services to return and
+// modules to shut down once the app is stopping.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(app *App) {
+		app.shutdownTimeout = timeout
+	}
+}
+
+// Services returns the status of each service started by Run, in
+// registration order. It is empty before Run.
+func (app *App) Services() []ServiceStatus {
+	app.servicesMu.Lock()
+	defer app.servicesMu.Unlock()
+	statuses := make([]ServiceStatus, 0, len(app.services))
+	for _, status := range app.services {
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// setServiceStatus updates the status of a service under the lock.
+func (app *App) setServiceStatus(status *ServiceStatus, update func(status *ServiceStatus)) {
+	app.servicesMu.Lock()
+	defer app.servicesMu.Unlock()
+	update(status)
+}
+
+// Run starts every module implementing Service, in registration order,
+// and blocks until ctx is cancelled, the process receives SIGINT or
+// SIGTERM, or a service fails. It then cancels the services, waits for
+// them and shuts the modules down in reverse registration order, all
+// within the shutdown timeout:
+//
+//	app := chassis.New(chassis.WithConfigFile("./config.yaml"), chassis.WithModules(...))
+//	if err := app.Run(context.Background()); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Run returns the service's error if one failed, joined with any shutdown
+// errors; a signal or cancelled ctx is a clean stop.
+func (app *App) Run(ctx context.Context) error {
+	ctx, stopSignals := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	app.mu.RLock()
+	var services []Module
+	for _, name := range app.order {
+		if _, ok := app.modules[name].(Service); ok {
+			services = append(services, app.modules[name])
+		}
+	}
+	app.mu.RUnlock()
+
+	app.servicesMu.Lock()
+	app.services = make([]*ServiceStatus, len(services))
+	for i, mod := range services {
+		app.services[i] = &ServiceStatus{Name: mod.Name(), State: ServiceStarting}
+	}
+	statuses := app.services
+	app.servicesMu.Unlock()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		startErr error
+	)
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return startErr
+	}
+	for i, mod := range services {
+		wg.Add(1)
+		go func(mod Module, status *ServiceStatus) {
+			defer wg.Done()
+			if err := app.supervise(runCtx, mod, status); err != nil {
+				mu.Lock()
+				if startErr == nil {
+					startErr = fmt.Errorf("module %q failed: %w", mod.Name(), err)
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}(mod, statuses[i])
+	}
+
+	<-runCtx.Done()
+	if err := failed(); err != nil {
+		app.logger.Error("stopping", "error", err)
+	} else {
+		app.logger.Info("stopping", "reason", context.Cause(runCtx))
+	}
+
+	timeout := app.shutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), timeout)
+	defer cancelShutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	var errs []error
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		errs = append(errs, errors.New("services did not stop within the shutdown timeout"))
+	}
+
+	if err := app.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(append([]error{failed()}, errs...)...)
+}
+
+// supervise runs a service until ctx is cancelled, restarting it after
+// panics. It returns the error the service stopped with, if any.
+func (app *App) supervise(ctx context.Context, mod Module, status *ServiceStatus) error {
+	backoff := serviceMinBackoff
+	for {
+		startedAt := time.Now()
+		app.setServiceStatus(status, func(status *ServiceStatus) {
+			status.State = ServiceRunning
+			status.StartedAt = startedAt
+		})
+		app.logger.Info("service started", "module", mod.Name())
+
+		err, panicked := app.runService(ctx, mod)
+		if !panicked {
+			if err != nil && !errors.Is(err, context.Canceled) {
+				app.setServiceStatus(status, func(status *ServiceStatus) {
+					status.State = ServiceFailed
+					status.LastError = err.Error()
+				})
+				return err
+			}
+			app.setServiceStatus(status, func(status *ServiceStatus) { status.State = ServiceStopped })
+			return nil
+		}
+
+		if time.Since(startedAt) >= serviceStableAfter {
+			backoff = serviceMinBackoff
+		}
+		app.logger.Error("service panicked, restarting", "module", mod.Name(), "error", err, "backoff", backoff)
+		app.setServiceStatus(status, func(status *ServiceStatus) {
+			status.State = ServiceRestarting
+			status.Restarts++
+			status.LastError = err.Error()
+		})
+
+		select {
+		case <-ctx.Done():
+			app.setServiceStatus(status, func(status *ServiceStatus) { status.State = ServiceStopped })
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, serviceMaxBackoff)
+	}
+}
+
+// runService calls Start, turning a panic into an error.
+func (app *App) runService(ctx context.Context, mod Module) (err error, panicked bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_ = app.ReportPanic(ctx, mod.Name(), PanicInService, "", recovered)
+			err, panicked = fmt.Errorf("panic: %v", recovered), true
+		}
+	}()
+	return mod.(Service).Start(ctx), false
+}
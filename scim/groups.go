@@ -0,0 +1,387 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// serveGroups serves /Groups and /Groups/{id}.
+func (mod *Module) serveGroups(writer http.ResponseWriter, request *http.Request, id string) {
+	ctx := request.Context()
+	base := baseURL(request, "Groups")
+
+	if id == "" {
+		switch request.Method {
+		case http.MethodGet:
+			mod.listGroups(writer, request, base)
+		case http.MethodPost:
+			resource, err := readResource(writer, request)
+			if err != nil {
+				mod.writeError(writer, request, err)
+				return
+			}
+			org, err := mod.createGroup(ctx, resource)
+			if err != nil {
+				mod.writeError(writer, request, err)
+				return
+			}
+			mod.writeGroup(writer, request, http.StatusCreated, org, base)
+		default:
+			mod.methodNotAllowed(writer, request)
+		}
+		return
+	}
+
+	org, err := mod.getGroup(ctx, id)
+	if err != nil {
+		mod.writeError(writer, request, err)
+		return
+	}
+	switch request.Method {
+	case http.MethodGet:
+		mod.writeGroup(writer, request, http.StatusOK, org, base)
+	case http.MethodPut:
+		resource, err := readResource(writer, request)
+		if err == nil {
+			err = mod.replaceGroup(ctx, org, resource)
+		}
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		mod.writeGroup(writer, request, http.StatusOK, org, base)
+	case http.MethodPatch:
+		operations, err := readPatch(writer, request)
+		if err == nil {
+			err = mod.patchGroup(ctx, org, operations)
+		}
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		mod.writeGroup(writer, request, http.StatusOK, org, base)
+	case http.MethodDelete:
+		if err := mod.groups.Delete(ctx, id); err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		mod.methodNotAllowed(writer, request)
+	}
+}
+
+// listGroups serves a page of groups, or those matching an eq filter on
+// displayName or id. excludedAttributes=members leaves members out.
+func (mod *Module) listGroups(writer http.ResponseWriter, request *http.Request, base string) {
+	filter, req, startIndex, err := listParams(request)
+	if err != nil {
+		mod.writeError(writer, request, err)
+		return
+	}
+	ctx := request.Context()
+	withMembers := !strings.Contains(strings.ToLower(request.URL.Query().Get("excludedAttributes")), "members")
+
+	var found []*orgs.Org
+	total := 0
+	if filter != "" {
+		attribute, value, err := parseFilter(filter)
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		switch strings.ToLower(attribute) {
+		case "displayname":
+			found, err = mod.groupsNamed(ctx, value)
+		case "id":
+			var org *orgs.Org
+			if org, err = mod.getGroup(ctx, value); err == nil {
+				found = []*orgs.Org{org}
+			} else if chassis.ErrorCodeOf(err) == chassis.CodeNotFound {
+				err = nil
+			}
+		default:
+			err = ErrInvalidFilter
+		}
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		total, startIndex = len(found), 1
+	} else {
+		page, err := mod.groups.List(ctx, orgs.ListOptions{Limit: req.Limit, Cursor: req.Cursor, SortBy: "created_at"})
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		for _, summary := range page.Items {
+			found = append(found, summary.Org)
+		}
+		total = page.Total
+	}
+
+	resources := make([]map[string]any, 0, len(found))
+	for _, org := range found {
+		resource, err := mod.groupResource(ctx, org, base, withMembers)
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+	writeSCIM(writer, http.StatusOK, listResponse(resources, total, startIndex))
+}
+
+// groupsNamed returns the organizations named exactly name.
+func (mod *Module) groupsNamed(ctx context.Context, name string) ([]*orgs.Org, error) {
+	page, err := mod.groups.List(ctx, orgs.ListOptions{Query: name, Limit: pagination.MaxLimit})
+	if err != nil {
+		return nil, err
+	}
+	var named []*orgs.Org
+	for _, summary := range page.Items {
+		if summary.Name == name {
+			named = append(named, summary.Org)
+		}
+	}
+	return named, nil
+}
+
+// getGroup returns the organization with the given ID.
+func (mod *Module) getGroup(ctx context.Context, id string) (*orgs.Org, error) {
+	result, err := mod.groups.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*orgs.Org), nil
+}
+
+// writeGroup writes the group with its members.
+func (mod *Module) writeGroup(writer http.ResponseWriter, request *http.Request, status int, org *orgs.Org, base string) {
+	resource, err := mod.groupResource(request.Context(), org, base, true)
+	if err != nil {
+		mod.writeError(writer, request, err)
+		return
+	}
+	if status == http.StatusCreated {
+		writer.Header().Set("Location", base+"/Groups/"+org.ID())
+	}
+	writeSCIM(writer, status, resource)
+}
+
+// createGroup creates an organization with the resource's members.
+func (mod *Module) createGroup(ctx context.Context, resource map[string]any) (*orgs.Org, error) {
+	name := stringAttribute(resource, "displayName")
+	if name == "" {
+		return nil, ErrDisplayNameRequired
+	}
+	result, err := mod.groups.Create(ctx, orgs.CreateInput{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	org := result.(*orgs.Org)
+	for _, userID := range memberIDs(getAttribute(resource, []string{"members"})) {
+		if err := mod.addMember(ctx, org.ID(), userID); err != nil {
+			return nil, err
+		}
+	}
+	return org, nil
+}
+
+// replaceGroup renames the organization and replaces its members with the
+// resource's, as PUT does.
+func (mod *Module) replaceGroup(ctx context.Context, org *orgs.Org, resource map[string]any) error {
+	if err := mod.renameGroup(ctx, org, getAttribute(resource, []string{"displayName"})); err != nil {
+		return err
+	}
+	return mod.replaceMembers(ctx, org.ID(), memberIDs(getAttribute(resource, []string{"members"})))
+}
+
+// patchGroup applies a PATCH request's operations to the organization.
+// Operations may rename it and add, remove or replace members.
+func (mod *Module) patchGroup(ctx context.Context, org *orgs.Org, operations []patchOperation) error {
+	for _, operation := range operations {
+		if operation.Path == "" {
+			values, ok := operation.Value.(map[string]any)
+			if !ok || operation.Op == "remove" {
+				return ErrInvalidSyntax
+			}
+			for key, value := range values {
+				if err := mod.patchGroupAttribute(ctx, org, operation.Op, key, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := mod.patchGroupAttribute(ctx, org, operation.Op, operation.Path, operation.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchGroupAttribute applies one operation on a group attribute path.
+func (mod *Module) patchGroupAttribute(ctx context.Context, org *orgs.Org, op, path string, value any) error {
+	attribute, filter, _ := strings.Cut(path, "[")
+	switch strings.ToLower(attribute) {
+	case "displayname":
+		if op == "remove" {
+			return ErrDisplayNameRequired
+		}
+		return mod.renameGroup(ctx, org, value)
+	case "members":
+		ids := memberIDs(value)
+		if filter != "" {
+			// members[value eq "<user ID>"]
+			field, id, err := parseFilter(strings.TrimSuffix(filter, "]"))
+			if err != nil || !strings.EqualFold(field, "value") {
+				return ErrInvalidPath
+			}
+			ids = []string{id}
+		}
+		switch {
+		case op == "remove" && filter == "" && len(ids) == 0:
+			return mod.replaceMembers(ctx, org.ID(), nil)
+		case op == "remove":
+			for _, userID := range ids {
+				if err := mod.groups.RemoveMember(ctx, org.ID(), userID); err != nil && !errors.Is(err, orgs.ErrMemberNotFound) {
+					return err
+				}
+			}
+		case op == "replace" && filter == "":
+			return mod.replaceMembers(ctx, org.ID(), ids)
+		default:
+			for _, userID := range ids {
+				if err := mod.addMember(ctx, org.ID(), userID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case "id", "externalid", "schemas", "meta":
+		return nil
+	default:
+		return ErrInvalidPath
+	}
+}
+
+// renameGroup sets the organization's name to a displayName value.
+func (mod *Module) renameGroup(ctx context.Context, org *orgs.Org, value any) error {
+	name, _ := value.(string)
+	if name = strings.TrimSpace(name); name == "" {
+		return ErrDisplayNameRequired
+	}
+	if name == org.Name {
+		return nil
+	}
+	result, err := mod.groups.Update(ctx, org.ID(), orgs.UpdateInput{Name: &name})
+	if err != nil {
+		return err
+	}
+	*org = *result.(*orgs.Org)
+	return nil
+}
+
+// addMember adds a user to the organization with the group role. Users
+// who are already members keep their role.
+func (mod *Module) addMember(ctx context.Context, orgID, userID string) error {
+	if _, err := mod.users.GetByID(ctx, userID); err != nil {
+		if chassis.ErrorCodeOf(err) == chassis.CodeNotFound {
+			return chassis.WrapError(chassis.CodeInvalidArgument, "unknown group member "+userID, err)
+		}
+		return err
+	}
+	_, err := mod.groups.AddMember(ctx, orgID, userID, mod.groupRole)
+	if errors.Is(err, orgs.ErrMemberExists) {
+		return nil
+	}
+	return err
+}
+
+// replaceMembers makes the organization's members exactly userIDs.
+func (mod *Module) replaceMembers(ctx context.Context, orgID string, userIDs []string) error {
+	members, err := mod.members(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		keep[userID] = true
+		if err := mod.addMember(ctx, orgID, userID); err != nil {
+			return err
+		}
+	}
+	for _, member := range members {
+		if !keep[member.UserID] {
+			if err := mod.groups.RemoveMember(ctx, orgID, member.UserID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// members returns the organization's memberships.
+func (mod *Module) members(ctx context.Context, orgID string) ([]*orgs.Membership, error) {
+	result, err := mod.groups.GetMembers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*orgs.Membership), nil
+}
+
+// groupResource returns the SCIM representation of an organization.
+func (mod *Module) groupResource(ctx context.Context, org *orgs.Org, base string, withMembers bool) (map[string]any, error) {
+	resource := map[string]any{
+		"schemas":     []string{SchemaGroup},
+		"id":          org.ID(),
+		"displayName": org.Name,
+		"meta": map[string]any{
+			"resourceType": "Group",
+			"created":      org.CreatedAt.UTC().Format(time.RFC3339),
+			"lastModified": org.UpdatedAt.UTC().Format(time.RFC3339),
+			"location":     base + "/Groups/" + org.ID(),
+		},
+	}
+	if !withMembers {
+		return resource, nil
+	}
+	members, err := mod.members(ctx, org.ID())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]map[string]any, len(members))
+	for i, member := range members {
+		entries[i] = map[string]any{"value": member.UserID, "$ref": base + "/Users/" + member.UserID}
+	}
+	resource["members"] = entries
+	return resource, nil
+}
+
+// memberIDs returns the user IDs of a members value: a list of
+// {"value": id} objects, or one.
+func memberIDs(value any) []string {
+	var items []any
+	switch typed := value.(type) {
+	case []any:
+		items = typed
+	case map[string]any:
+		items = []any{typed}
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if member, ok := item.(map[string]any); ok {
+			if id, ok := member[lookupKey(member, "value")].(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,281 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/pagination"
+)
+
+// maxBodyBytes bounds the request bodies the handler reads.
+const maxBodyBytes = 1 << 20
+
+// contentType is the media type of SCIM messages.
+const contentType = "application/scim+json"
+
+// Handler serves the SCIM endpoints wherever it is mounted, for requests
+// bearing one of the module's tokens.
+func (mod *Module) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !mod.authorized(request) {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			mod.writeError(writer, request, ErrUnauthorized)
+			return
+		}
+
+		resource, id, ok := route(request.URL.Path)
+		if !ok {
+			mod.writeError(writer, request, chassis.NewError(chassis.CodeNotFound, "unknown SCIM resource"))
+			return
+		}
+		switch {
+		case resource == "ServiceProviderConfig" && id == "" && request.Method == http.MethodGet:
+			writeSCIM(writer, http.StatusOK, serviceProviderConfig)
+		case resource == "ResourceTypes" && id == "" && request.Method == http.MethodGet:
+			writeSCIM(writer, http.StatusOK, listResponse(resourceTypes, len(resourceTypes), 1))
+		case resource == "Users":
+			mod.serveUsers(writer, request, id)
+		case resource == "Groups":
+			mod.serveGroups(writer, request, id)
+		default:
+			mod.methodNotAllowed(writer, request)
+		}
+	})
+}
+
+// authorized reports whether the request bears one of the tokens. Tokens
+// are compared by hash, in constant time.
+func (mod *Module) authorized(request *http.Request) bool {
+	token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	presented := sha256.Sum256([]byte(token))
+	matched := 0
+	for _, candidate := range mod.tokens {
+		expected := sha256.Sum256([]byte(candidate))
+		matched |= subtle.ConstantTimeCompare(presented[:], expected[:])
+	}
+	return matched == 1
+}
+
+// route splits a request path into the resource type and, for a single
+// resource, its ID, wherever the handler is mounted.
+func route(urlPath string) (resource, id string, ok bool) {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	for i := len(segments) - 1; i >= 0 && i >= len(segments)-2; i-- {
+		switch segments[i] {
+		case "Users", "Groups", "ServiceProviderConfig", "ResourceTypes":
+			if i == len(segments)-1 {
+				return segments[i], "", true
+			}
+			return segments[i], segments[i+1], true
+		}
+	}
+	return "", "", false
+}
+
+// baseURL returns the URL the handler is mounted at, for resource
+// locations.
+func baseURL(request *http.Request, resource string) string {
+	scheme := "https"
+	if request.TLS == nil {
+		scheme = "http"
+	}
+	prefix, _, _ := strings.Cut(request.URL.Path, "/"+resource)
+	return scheme + "://" + request.Host + prefix
+}
+
+// listParams reads a list request's filter and its startIndex and count,
+// as the pagination request they select.
+func listParams(request *http.Request) (filter string, req pagination.Request, startIndex int, err error) {
+	query := request.URL.Query()
+	startIndex = 1
+	count := pagination.DefaultLimit
+	for name, field := range map[string]*int{"startIndex": &startIndex, "count": &count} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, convErr := strconv.Atoi(value)
+		if convErr != nil || parsed < 0 {
+			return "", req, 0, chassis.NewError(chassis.CodeInvalidArgument, name+" must be a non-negative integer")
+		}
+		*field = parsed
+	}
+	startIndex = max(startIndex, 1)
+	req = pagination.Request{Limit: max(count, 1), Cursor: pagination.OffsetCursor(startIndex - 1)}
+	return query.Get("filter"), req, startIndex, nil
+}
+
+// filterPattern matches the filters the handler supports: one attribute
+// compared with eq to a string.
+var filterPattern = regexp.MustCompile(`^\s*([\w.:]+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseFilter returns the attribute and value of an eq filter.
+func parseFilter(filter string) (attribute, value string, err error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", ErrInvalidFilter
+	}
+	if err := json.Unmarshal([]byte(`"`+match[2]+`"`), &value); err != nil {
+		return "", "", ErrInvalidFilter
+	}
+	return match[1], value, nil
+}
+
+// listResponse wraps a page of resources in a SCIM ListResponse.
+func listResponse(resources []map[string]any, total, startIndex int) map[string]any {
+	return map[string]any{
+		"schemas":      []string{SchemaListResponse},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	}
+}
+
+// readResource decodes a request body as a JSON object.
+func readResource(writer http.ResponseWriter, request *http.Request) (map[string]any, error) {
+	var resource map[string]any
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxBodyBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&resource); err != nil || resource == nil {
+		return nil, ErrInvalidSyntax
+	}
+	return resource, nil
+}
+
+// patchOperation is one operation of a PATCH request.
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// readPatch decodes a PATCH request's operations.
+func readPatch(writer http.ResponseWriter, request *http.Request) ([]patchOperation, error) {
+	var body struct {
+		Operations []patchOperation `json:"Operations"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxBodyBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, ErrInvalidSyntax
+	}
+	for i := range body.Operations {
+		body.Operations[i].Op = strings.ToLower(body.Operations[i].Op)
+		switch body.Operations[i].Op {
+		case "add", "replace", "remove":
+		default:
+			return nil, chassis.NewError(chassis.CodeInvalidArgument, "PATCH op must be add, replace or remove")
+		}
+	}
+	return body.Operations, nil
+}
+
+// writeSCIM writes value as a SCIM JSON message.
+func writeSCIM(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", contentType)
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		slog.Default().Error("failed to encode SCIM response", "error", err)
+	}
+}
+
+// scimTypes are the scimType values of the errors that have one.
+var scimTypes = map[error]string{
+	ErrInvalidSyntax: "invalidSyntax",
+	ErrInvalidFilter: "invalidFilter",
+	ErrInvalidPath:   "invalidPath",
+}
+
+// writeError writes err as a SCIM error, with the status of its chassis
+// error code. Internal errors are logged, not described.
+func (mod *Module) writeError(writer http.ResponseWriter, request *http.Request, err error) {
+	code := chassis.ErrorCodeOf(err)
+	status := api.StatusForCode(code)
+	response := map[string]any{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(status),
+	}
+
+	var chassisErr *chassis.Error
+	if errors.As(err, &chassisErr) {
+		response["detail"] = chassisErr.Error()
+	} else {
+		response["detail"] = "internal server error"
+	}
+	for sentinel, scimType := range scimTypes {
+		if errors.Is(err, sentinel) {
+			response["scimType"] = scimType
+		}
+	}
+	if _, ok := response["scimType"]; !ok {
+		switch code {
+		case chassis.CodeAlreadyExists:
+			response["scimType"] = "uniqueness"
+		case chassis.CodeInvalidArgument:
+			response["scimType"] = "invalidValue"
+		}
+	}
+
+	if status >= http.StatusInternalServerError {
+		mod.app.Logger().Error("scim request failed",
+			"method", request.Method,
+			"path", request.URL.Path,
+			"error", err,
+		)
+	}
+	writeSCIM(writer, status, response)
+}
+
+// methodNotAllowed writes a 405 SCIM error.
+func (mod *Module) methodNotAllowed(writer http.ResponseWriter, request *http.Request) {
+	mod.writeError(writer, request, chassis.NewError(chassis.CodeMethodNotAllowed, "method not allowed"))
+}
+
+// serviceProviderConfig describes the features the handler supports.
+var serviceProviderConfig = map[string]any{
+	"schemas":        []string{SchemaServiceProviderConfig},
+	"patch":          map[string]any{"supported": true},
+	"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+	"filter":         map[string]any{"supported": true, "maxResults": pagination.MaxLimit},
+	"changePassword": map[string]any{"supported": false},
+	"sort":           map[string]any{"supported": false},
+	"etag":           map[string]any{"supported": false},
+	"authenticationSchemes": []map[string]any{{
+		"type":        "oauthbearertoken",
+		"name":        "Bearer token",
+		"description": "Authentication with a SCIM token in the Authorization header",
+		"primary":     true,
+	}},
+}
+
+// resourceTypes describes the resources the handler serves.
+var resourceTypes = []map[string]any{
+	{
+		"schemas":          []string{SchemaResourceType},
+		"id":               "User",
+		"name":             "User",
+		"endpoint":         "/Users",
+		"schema":           SchemaUser,
+		"schemaExtensions": []map[string]any{{"schema": SchemaEnterpriseUser, "required": false}},
+	},
+	{
+		"schemas":  []string{SchemaResourceType},
+		"id":       "Group",
+		"name":     "Group",
+		"endpoint": "/Groups",
+		"schema":   SchemaGroup,
+	},
+}
@@ -0,0 +1,256 @@
+// Package scim serves a SCIM 2.0 provisioning API (RFC 7643, RFC 7644), so
+// identity providers such as Okta and Azure AD can create, update and
+// deprovision users and groups. Users are users module users; groups are
+// organizations, and group members are their members.
+//
+// # Usage
+//
+// Register the module after the users and orgs modules and mount its
+// endpoint (see api.Mount), which serves /scim/v2/ once a token is set:
+//
+//	scimMod := scim.New(scim.WithToken(os.Getenv("SCIM_TOKEN")))
+//	app := chassis.New(chassis.WithModules(users.New(), orgs.New(), scimMod))
+//	api.Mount(app, mux)
+//
+// Or mount Handler yourself, anywhere:
+//
+//	mux.Handle("/scim/v2/", scimMod.Handler())
+//
+// The identity provider authenticates with one of the tokens, sent as
+// "Authorization: Bearer <token>"; other requests get a 401.
+//
+// # Resources
+//
+// The endpoints, relative to the mount path:
+//
+//	GET    /ServiceProviderConfig, /ResourceTypes
+//	GET    /Users              ?filter=userName eq "ann@example.com", startIndex, count
+//	POST   /Users
+//	GET    /Users/{id}
+//	PUT    /Users/{id}
+//	PATCH  /Users/{id}
+//	DELETE /Users/{id}
+//	       /Groups, /Groups/{id}  the same, filtering on displayName
+//
+// A user's userName is their email and their displayName (or name) their
+// name. Provisioned users have no password: they are linked to an identity
+// of the provider (WithProvider) and sign in through it. Setting active to
+// false deprovisions a user like DELETE, deleting them with their data in
+// other modules. Filters support eq on userName, id and displayName.
+//
+// Members added to a group join the organization with the group role
+// (WithGroupRole), "member" by default.
+//
+// # Attribute mapping
+//
+// Other user attributes are kept in the user's metadata. WithAttribute
+// maps a SCIM attribute path, with the schema URN for extension
+// attributes, to a metadata key; externalId is mapped to
+// scim_external_id by default.
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	scim:
+//	  tokens: [${SCIM_TOKEN}]
+//	  provider: okta
+//	  group_role: member
+//	  attributes:
+//	    title: job_title
+//	    "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department": department
+//
+// Or programmatically:
+//
+//	scim.New(scim.WithToken(token), scim.WithAttribute("title", "job_title"))
+package scim
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/users"
+)
+
+var (
+	ErrUnauthorized        = chassis.NewError(chassis.CodeUnauthenticated, "invalid SCIM bearer token")
+	ErrInvalidSyntax       = chassis.NewError(chassis.CodeInvalidArgument, "request body must be a SCIM JSON object")
+	ErrInvalidFilter       = chassis.NewError(chassis.CodeInvalidArgument, `filter must be <attribute> eq "<value>" on a supported attribute`)
+	ErrInvalidPath         = chassis.NewError(chassis.CodeInvalidArgument, "unsupported PATCH path")
+	ErrUserNameRequired    = chassis.NewError(chassis.CodeInvalidArgument, "userName is required")
+	ErrDisplayNameRequired = chassis.NewError(chassis.CodeInvalidArgument, "displayName is required")
+)
+
+// Schema URNs of the resources and messages.
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaEnterpriseUser        = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// DefaultProvider is the identity provider name provisioned users are
+// linked to unless WithProvider or scim.provider says otherwise.
+const DefaultProvider = "scim"
+
+// userDirectory is implemented by *users.Module.
+type userDirectory interface {
+	GetByID(ctx context.Context, id string) (any, error)
+	GetByEmail(ctx context.Context, email string) (any, error)
+	List(ctx context.Context, opts users.ListOptions) (*pagination.Result[*users.User], error)
+	SignInWithIdentity(ctx context.Context, input users.IdentityInput) (*users.User, bool, error)
+	Update(ctx context.Context, id string, input users.UpdateInput) (*users.User, error)
+	UpdateProfile(ctx context.Context, id string, input any) (any, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// groupDirectory is implemented by *orgs.Module.
+type groupDirectory interface {
+	Create(ctx context.Context, input any) (any, error)
+	GetByID(ctx context.Context, orgID string) (any, error)
+	Update(ctx context.Context, orgID string, input any) (any, error)
+	Delete(ctx context.Context, orgID string) error
+	List(ctx context.Context, opts orgs.ListOptions) (*pagination.Result[*orgs.OrgSummary], error)
+	GetMembers(ctx context.Context, orgID string) (any, error)
+	AddMember(ctx context.Context, orgID, userID, role string) (any, error)
+	RemoveMember(ctx context.Context, orgID, userID string) error
+}
+
+// Module is the SCIM module implementation.
+type Module struct {
+	app    *chassis.App
+	users  userDirectory
+	groups groupDirectory
+
+	tokens     []string
+	provider   string
+	groupRole  string
+	attributes map[string]string // SCIM attribute path to metadata key
+}
+
+// Option is a function that configures the SCIM module.
+type Option func(*Module)
+
+// WithToken adds bearer tokens the identity provider may authenticate
+// with. Several tokens allow rotating them.
+func WithToken(tokens ...string) Option {
+	return func(mod *Module) {
+		mod.tokens = append(mod.tokens, tokens...)
+	}
+}
+
+// WithProvider sets the identity provider name provisioned users are
+// linked to, e.g. "okta", matching the provider they sign in with.
+func WithProvider(provider string) Option {
+	return func(mod *Module) {
+		mod.provider = provider
+	}
+}
+
+// WithGroupRole sets the organization role of group members.
+func WithGroupRole(role string) Option {
+	return func(mod *Module) {
+		mod.groupRole = role
+	}
+}
+
+// WithAttribute stores the SCIM attribute at path, such as "title" or
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department",
+// in the user's metadata under key. An empty key drops the attribute.
+func WithAttribute(path, key string) Option {
+	return func(mod *Module) {
+		mod.attributes[path] = key
+	}
+}
+
+// New creates a new SCIM module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		provider:   DefaultProvider,
+		groupRole:  "member",
+		attributes: map[string]string{"externalId": "scim_external_id"},
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "scim"
+}
+
+// Dependencies returns the modules SCIM needs. Implements
+// chassis.Dependent.
+func (mod *Module) Dependencies() []string {
+	return []string{"users", "orgs"}
+}
+
+// Init initializes the SCIM module.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	// Read config if available
+	if cfg := app.ConfigData(); cfg != nil {
+		mod.tokens = append(mod.tokens, cfg.GetStringSlice("scim.tokens")...)
+		if provider := cfg.GetString("scim.provider"); provider != "" {
+			mod.provider = provider
+		}
+		if role := cfg.GetString("scim.group_role"); role != "" {
+			mod.groupRole = role
+		}
+		for path, key := range cfg.GetStringMap("scim.attributes") {
+			mod.attributes[path] = key
+		}
+	}
+	mod.tokens = slices.DeleteFunc(mod.tokens, func(token string) bool { return token == "" })
+	if !orgs.ValidRoles[mod.groupRole] {
+		return fmt.Errorf("%w: scim group role %q", orgs.ErrInvalidRole, mod.groupRole)
+	}
+
+	var ok bool
+	if mod.users, ok = app.Users().(userDirectory); !ok {
+		return fmt.Errorf("scim requires the chassis users module")
+	}
+	if mod.groups, ok = app.Orgs().(groupDirectory); !ok {
+		return fmt.Errorf("scim requires the chassis orgs module")
+	}
+
+	if len(mod.tokens) == 0 {
+		app.Logger().Warn("scim module has no tokens; its endpoint rejects every request")
+	}
+	app.Logger().Info("scim module initialized",
+		"provider", mod.provider,
+		"group_role", mod.groupRole,
+		"attributes", len(mod.attributes),
+	)
+	return nil
+}
+
+// Shutdown is a no-op; the module keeps no state of its own.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Endpoints serves Handler at /scim/v2/ when a token is set. Requests are
+// authenticated with the SCIM tokens rather than sessions. Implements
+// chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{{
+		Name:    "scim",
+		Path:    "/scim/v2/",
+		Handler: mod.Handler(),
+		Enabled: len(mod.tokens) > 0,
+	}}
+}
@@ -0,0 +1,239 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/users"
+)
+
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	users   *users.Module
+	orgs    *orgs.Module
+}
+
+func newTestServer(t *testing.T, opts ...Option) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+	usersMod := users.New(users.WithDBPath(filepath.Join(dir, "users.db")))
+	orgsMod := orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db")))
+	mod := New(append([]Option{WithToken("scim-token")}, opts...)...)
+	app := chassis.New(chassis.WithModules(usersMod, orgsMod, mod))
+	if !app.HasModule("scim") {
+		t.Fatal("scim module not registered")
+	}
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return &testServer{t: t, handler: mod.Handler(), users: usersMod, orgs: orgsMod}
+}
+
+// do sends a request with the SCIM token and decodes the JSON response.
+func (server *testServer) do(method, path, body string) (int, map[string]any) {
+	server.t.Helper()
+	request := httptest.NewRequest(method, "/scim/v2"+path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer scim-token")
+	request.Header.Set("Content-Type", contentType)
+	response := httptest.NewRecorder()
+	server.handler.ServeHTTP(response, request)
+
+	var decoded map[string]any
+	if response.Body.Len() > 0 {
+		if err := json.Unmarshal(response.Body.Bytes(), &decoded); err != nil {
+			server.t.Fatalf("%s %s: invalid JSON %q", method, path, response.Body.String())
+		}
+	}
+	return response.Code, decoded
+}
+
+func TestAuthentication(t *testing.T) {
+	server := newTestServer(t)
+	for _, header := range []string{"", "Bearer wrong", "Basic scim-token"} {
+		request := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		response := httptest.NewRecorder()
+		server.handler.ServeHTTP(response, request)
+		if response.Code != http.StatusUnauthorized || response.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: expected 401, got %d", header, response.Code)
+		}
+	}
+
+	if status, config := server.do(http.MethodGet, "/ServiceProviderConfig", ""); status != http.StatusOK || config["patch"] == nil {
+		t.Errorf("expected the service provider config, got %d %v", status, config)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	server := newTestServer(t,
+		WithProvider("okta"),
+		WithAttribute("title", "job_title"),
+		WithAttribute(SchemaEnterpriseUser+":department", "department"),
+	)
+	ctx := context.Background()
+
+	status, created := server.do(http.MethodPost, "/Users", `{
+		"schemas": ["`+SchemaUser+`", "`+SchemaEnterpriseUser+`"],
+		"userName": "Ann@Example.com",
+		"externalId": "00u1",
+		"name": {"givenName": "Ann", "familyName": "Lee"},
+		"title": "Engineer",
+		"`+SchemaEnterpriseUser+`": {"department": "R&D"}
+	}`)
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", status, created)
+	}
+	id, _ := created["id"].(string)
+	user, err := server.users.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("provisioned user not found: %v", err)
+	}
+	ann := user.(*users.User)
+	if ann.Email != "ann@example.com" || ann.Name != "Ann Lee" || ann.PasswordHash != "" ||
+		ann.Metadata["job_title"] != "Engineer" || ann.Metadata["department"] != "R&D" || ann.Metadata["scim_external_id"] != "00u1" {
+		t.Errorf("unexpected provisioned user %+v", ann)
+	}
+	if signedIn, _, err := server.users.SignInWithIdentity(ctx, users.IdentityInput{Provider: "okta", Subject: "00u1"}); err != nil || signedIn.ID != id {
+		t.Errorf("expected the user to be linked to the provider, got %v, %v", signedIn, err)
+	}
+	if extension, _ := created[SchemaEnterpriseUser].(map[string]any); extension["department"] != "R&D" || created["externalId"] != "00u1" {
+		t.Errorf("expected mapped attributes in the resource, got %v", created)
+	}
+
+	if status, conflict := server.do(http.MethodPost, "/Users", `{"userName": "ann@example.com"}`); status != http.StatusConflict || conflict["scimType"] != "uniqueness" {
+		t.Errorf("expected a uniqueness conflict, got %d %v", status, conflict)
+	}
+	if status, _ := server.do(http.MethodPost, "/Users", `{"name": {"givenName": "Bob"}}`); status != http.StatusBadRequest {
+		t.Errorf("expected a missing userName to be rejected, got %d", status)
+	}
+
+	status, list := server.do(http.MethodGet, `/Users?filter=userName+eq+"ann@example.com"`, "")
+	if resources, _ := list["Resources"].([]any); status != http.StatusOK || list["totalResults"] != float64(1) || len(resources) != 1 {
+		t.Errorf("expected the filtered user, got %d %v", status, list)
+	}
+	status, list = server.do(http.MethodGet, `/Users?filter=userName+eq+"nobody@example.com"`, "")
+	if status != http.StatusOK || list["totalResults"] != float64(0) {
+		t.Errorf("expected no users, got %d %v", status, list)
+	}
+	if status, invalid := server.do(http.MethodGet, `/Users?filter=title+co+"eng"`, ""); status != http.StatusBadRequest || invalid["scimType"] != "invalidFilter" {
+		t.Errorf("expected invalidFilter, got %d %v", status, invalid)
+	}
+
+	status, patched := server.do(http.MethodPatch, "/Users/"+id, `{
+		"schemas": ["`+SchemaPatchOp+`"],
+		"Operations": [
+			{"op": "Replace", "path": "title", "value": "Manager"},
+			{"op": "replace", "value": {"displayName": "Ann B. Lee", "`+SchemaEnterpriseUser+`:department": "Sales"}}
+		]
+	}`)
+	if status != http.StatusOK || patched["title"] != "Manager" || patched["displayName"] != "Ann B. Lee" {
+		t.Errorf("unexpected patch result %d %v", status, patched)
+	}
+	user, _ = server.users.GetByID(ctx, id)
+	if ann = user.(*users.User); ann.Name != "Ann B. Lee" || ann.Metadata["department"] != "Sales" {
+		t.Errorf("expected the patch to be applied, got %+v", ann)
+	}
+
+	status, replaced := server.do(http.MethodPut, "/Users/"+id, `{"userName": "ann.lee@example.com", "displayName": "Ann Lee"}`)
+	if status != http.StatusOK || replaced["userName"] != "ann.lee@example.com" || replaced["title"] != nil {
+		t.Errorf("expected PUT to replace the attributes, got %d %v", status, replaced)
+	}
+
+	status, deactivated := server.do(http.MethodPatch, "/Users/"+id, `{"Operations": [{"op": "Replace", "path": "active", "value": "False"}]}`)
+	if status != http.StatusOK || deactivated["active"] != false {
+		t.Errorf("expected the user to be deprovisioned, got %d %v", status, deactivated)
+	}
+	if status, _ := server.do(http.MethodGet, "/Users/"+id, ""); status != http.StatusNotFound {
+		t.Errorf("expected a deprovisioned user to be gone, got %d", status)
+	}
+
+	_, bob := server.do(http.MethodPost, "/Users", `{"userName": "bob@example.com"}`)
+	if status, _ := server.do(http.MethodDelete, "/Users/"+bob["id"].(string), ""); status != http.StatusNoContent {
+		t.Errorf("expected DELETE to succeed, got %d", status)
+	}
+}
+
+func TestUsersPaging(t *testing.T) {
+	server := newTestServer(t)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if status, _ := server.do(http.MethodPost, "/Users", `{"userName": "`+email+`"}`); status != http.StatusCreated {
+			t.Fatalf("failed to provision %s: %d", email, status)
+		}
+	}
+	seen := make(map[any]bool)
+	for _, startIndex := range []string{"1", "3"} {
+		_, page := server.do(http.MethodGet, "/Users?count=2&startIndex="+startIndex, "")
+		resources, _ := page["Resources"].([]any)
+		if page["totalResults"] != float64(3) || page["startIndex"] != float64(len(seen)+1) {
+			t.Fatalf("unexpected page %v", page)
+		}
+		for _, resource := range resources {
+			seen[resource.(map[string]any)["userName"]] = true
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected the pages to list every user once, got %v", seen)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	server := newTestServer(t, WithGroupRole("admin"))
+	ctx := context.Background()
+	_, ann := server.do(http.MethodPost, "/Users", `{"userName": "ann@example.com"}`)
+	_, bob := server.do(http.MethodPost, "/Users", `{"userName": "bob@example.com"}`)
+	annID, bobID := ann["id"].(string), bob["id"].(string)
+
+	status, group := server.do(http.MethodPost, "/Groups", `{"displayName": "Engineering", "members": [{"value": "`+annID+`"}]}`)
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", status, group)
+	}
+	groupID := group["id"].(string)
+	if role := server.orgs.GetUserRole(ctx, groupID, annID); role != "admin" {
+		t.Errorf("expected members to get the group role, got %q", role)
+	}
+	if status, _ := server.do(http.MethodPost, "/Groups", `{"displayName": "Sales", "members": [{"value": "missing"}]}`); status != http.StatusBadRequest {
+		t.Errorf("expected an unknown member to be rejected, got %d", status)
+	}
+
+	status, group = server.do(http.MethodPatch, "/Groups/"+groupID, `{"Operations": [
+		{"op": "add", "path": "members", "value": [{"value": "`+bobID+`"}]},
+		{"op": "remove", "path": "members[value eq \"`+annID+`\"]"},
+		{"op": "replace", "value": {"displayName": "Platform"}}
+	]}`)
+	members, _ := group["members"].([]any)
+	if status != http.StatusOK || group["displayName"] != "Platform" || len(members) != 1 {
+		t.Fatalf("unexpected patch result %d %v", status, group)
+	}
+	if server.orgs.GetUserRole(ctx, groupID, annID) != "" || server.orgs.GetUserRole(ctx, groupID, bobID) == "" {
+		t.Error("expected ann to be removed and bob added")
+	}
+
+	status, list := server.do(http.MethodGet, `/Groups?filter=displayName+eq+"Platform"&excludedAttributes=members`, "")
+	resources, _ := list["Resources"].([]any)
+	if status != http.StatusOK || len(resources) != 1 {
+		t.Fatalf("expected the filtered group, got %d %v", status, list)
+	}
+	if listed, _ := resources[0].(map[string]any); listed["members"] != nil {
+		t.Errorf("expected members to be excluded, got %v", listed)
+	}
+
+	status, group = server.do(http.MethodPut, "/Groups/"+groupID, `{"displayName": "Platform", "members": [{"value": "`+annID+`"}, {"value": "`+bobID+`"}]}`)
+	if members, _ := group["members"].([]any); status != http.StatusOK || len(members) != 2 {
+		t.Errorf("expected PUT to replace the members, got %d %v", status, group)
+	}
+
+	if status, _ := server.do(http.MethodDelete, "/Groups/"+groupID, ""); status != http.StatusNoContent {
+		t.Errorf("expected DELETE to succeed, got %d", status)
+	}
+	if _, err := server.orgs.GetByID(ctx, groupID); err == nil {
+		t.Error("expected the organization to be deleted")
+	}
+}
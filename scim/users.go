@@ -0,0 +1,402 @@
+package scim
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/users"
+)
+
+// serveUsers serves /Users and /Users/{id}.
+func (mod *Module) serveUsers(writer http.ResponseWriter, request *http.Request, id string) {
+	ctx := request.Context()
+	base := baseURL(request, "Users")
+
+	if id == "" {
+		switch request.Method {
+		case http.MethodGet:
+			mod.listUsers(writer, request, base)
+		case http.MethodPost:
+			resource, err := readResource(writer, request)
+			if err != nil {
+				mod.writeError(writer, request, err)
+				return
+			}
+			user, err := mod.createUser(ctx, resource)
+			if err != nil {
+				mod.writeError(writer, request, err)
+				return
+			}
+			created := mod.userResource(user, base)
+			writer.Header().Set("Location", base+"/Users/"+user.ID)
+			writeSCIM(writer, http.StatusCreated, created)
+		default:
+			mod.methodNotAllowed(writer, request)
+		}
+		return
+	}
+
+	user, err := mod.getUser(ctx, id)
+	if err != nil {
+		mod.writeError(writer, request, err)
+		return
+	}
+	switch request.Method {
+	case http.MethodGet:
+		writeSCIM(writer, http.StatusOK, mod.userResource(user, base))
+	case http.MethodPut, http.MethodPatch:
+		resource := mod.userResource(user, base)
+		if request.Method == http.MethodPut {
+			resource, err = readResource(writer, request)
+		} else {
+			err = patchResource(writer, request, resource)
+		}
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		updated, err := mod.applyUser(ctx, user, resource)
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		if updated == nil {
+			// Deprovisioned: the user is gone, so echo it inactive.
+			resource = mod.userResource(user, base)
+			resource["active"] = false
+			writeSCIM(writer, http.StatusOK, resource)
+			return
+		}
+		writeSCIM(writer, http.StatusOK, mod.userResource(updated, base))
+	case http.MethodDelete:
+		if err := mod.users.Delete(ctx, id); err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		mod.methodNotAllowed(writer, request)
+	}
+}
+
+// listUsers serves a page of users, or those matching an eq filter on
+// userName, emails.value or id.
+func (mod *Module) listUsers(writer http.ResponseWriter, request *http.Request, base string) {
+	filter, req, startIndex, err := listParams(request)
+	if err != nil {
+		mod.writeError(writer, request, err)
+		return
+	}
+	ctx := request.Context()
+
+	if filter != "" {
+		attribute, value, err := parseFilter(filter)
+		if err != nil {
+			mod.writeError(writer, request, err)
+			return
+		}
+		var found any
+		switch strings.ToLower(attribute) {
+		case "username", "emails.value", "emails":
+			found, err = mod.users.GetByEmail(ctx, value)
+		case "id":
+			found, err = mod.users.GetByID(ctx, value)
+		default:
+			mod.writeError(writer, request, ErrInvalidFilter)
+			return
+		}
+		resources := make([]map[string]any, 0, 1)
+		switch {
+		case err == nil:
+			resources = append(resources, mod.userResource(found.(*users.User), base))
+		case chassis.ErrorCodeOf(err) == chassis.CodeNotFound || chassis.ErrorCodeOf(err) == chassis.CodeInvalidArgument:
+			// No such user; an invalid email can't match one either.
+		default:
+			mod.writeError(writer, request, err)
+			return
+		}
+		writeSCIM(writer, http.StatusOK, listResponse(resources, len(resources), 1))
+		return
+	}
+
+	page, err := mod.users.List(ctx, users.ListOptions{Limit: req.Limit, Cursor: req.Cursor, SortBy: "created_at"})
+	if err != nil {
+		mod.writeError(writer, request, err)
+		return
+	}
+	resources := make([]map[string]any, len(page.Items))
+	for i, user := range page.Items {
+		resources[i] = mod.userResource(user, base)
+	}
+	writeSCIM(writer, http.StatusOK, listResponse(resources, page.Total, startIndex))
+}
+
+// getUser returns the user with the given ID.
+func (mod *Module) getUser(ctx context.Context, id string) (*users.User, error) {
+	result, err := mod.users.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*users.User), nil
+}
+
+// createUser provisions a passwordless user linked to the provider, then
+// applies the rest of the resource to it. A userName already in use fails
+// with users.ErrEmailExists.
+func (mod *Module) createUser(ctx context.Context, resource map[string]any) (*users.User, error) {
+	userName := stringAttribute(resource, "userName")
+	if userName == "" {
+		return nil, ErrUserNameRequired
+	}
+	if _, err := mod.users.GetByEmail(ctx, userName); err == nil {
+		return nil, users.ErrEmailExists
+	} else if chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+		return nil, err
+	}
+
+	subject := stringAttribute(resource, "externalId")
+	if subject == "" {
+		subject = userName
+	}
+	user, created, err := mod.users.SignInWithIdentity(ctx, users.IdentityInput{
+		Provider: mod.provider,
+		Subject:  subject,
+		Email:    userName,
+		Verified: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, users.ErrIdentityLinked
+	}
+
+	delete(resource, lookupKey(resource, "active")) // new users are active
+	return mod.applyUser(ctx, user, resource)
+}
+
+// applyUser replaces the user's attributes with the resource's, as PUT
+// does. It deletes the user, returning nil, if the resource is inactive.
+func (mod *Module) applyUser(ctx context.Context, user *users.User, resource map[string]any) (*users.User, error) {
+	userName := stringAttribute(resource, "userName")
+	if userName == "" {
+		return nil, ErrUserNameRequired
+	}
+	if active, ok := getAttribute(resource, []string{"active"}).(bool); ok && !active ||
+		strings.EqualFold(stringAttribute(resource, "active"), "false") {
+		if err := mod.users.Delete(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if !strings.EqualFold(userName, user.Email) {
+		if _, err := mod.users.Update(ctx, user.ID, users.UpdateInput{Email: &userName}); err != nil {
+			return nil, err
+		}
+	}
+
+	// The name is the first of displayName, name.formatted and the given
+	// and family names that changed, so a PATCH of any one of them sticks.
+	name := ""
+	for _, candidate := range []string{
+		stringAttribute(resource, "displayName"),
+		stringAttribute(resource, "name.formatted"),
+		strings.TrimSpace(stringAttribute(resource, "name.givenName") + " " + stringAttribute(resource, "name.familyName")),
+	} {
+		if candidate == "" {
+			continue
+		}
+		if name == "" || candidate != user.Name {
+			name = candidate
+		}
+		if candidate != user.Name {
+			break
+		}
+	}
+	metadata := make(map[string]any, len(mod.attributes))
+	for path, key := range mod.attributes {
+		if key != "" {
+			metadata[key] = getAttribute(resource, splitPath(path))
+		}
+	}
+
+	updated, err := mod.users.UpdateProfile(ctx, user.ID, users.ProfileInput{Name: &name, Metadata: metadata})
+	if err != nil {
+		return nil, err
+	}
+	return updated.(*users.User), nil
+}
+
+// userResource returns the SCIM representation of a user.
+func (mod *Module) userResource(user *users.User, base string) map[string]any {
+	resource := map[string]any{
+		"schemas":  []string{SchemaUser},
+		"id":       user.ID,
+		"userName": user.Email,
+		"emails":   []map[string]any{{"value": user.Email, "primary": true}},
+		"active":   true,
+		"meta": map[string]any{
+			"resourceType": "User",
+			"created":      user.CreatedAt.UTC().Format(time.RFC3339),
+			"lastModified": user.UpdatedAt.UTC().Format(time.RFC3339),
+			"location":     base + "/Users/" + user.ID,
+		},
+	}
+	if user.Name != "" {
+		resource["displayName"] = user.Name
+		resource["name"] = map[string]any{"formatted": user.Name}
+	}
+
+	schemas := []string{SchemaUser}
+	for path, key := range mod.attributes {
+		value, ok := user.Metadata[key]
+		if key == "" || !ok {
+			continue
+		}
+		segments := splitPath(path)
+		setAttribute(resource, segments, value)
+		if strings.HasPrefix(segments[0], "urn:") && !containsFold(schemas, segments[0]) {
+			schemas = append(schemas, segments[0])
+		}
+	}
+	resource["schemas"] = schemas
+	return resource
+}
+
+// patchResource applies a PATCH request's operations to resource.
+func patchResource(writer http.ResponseWriter, request *http.Request, resource map[string]any) error {
+	operations, err := readPatch(writer, request)
+	if err != nil {
+		return err
+	}
+	for _, operation := range operations {
+		switch {
+		case operation.Op == "remove" && operation.Path == "":
+			return ErrInvalidPath
+		case operation.Op == "remove":
+			removeAttribute(resource, splitPath(operation.Path))
+		case operation.Path == "":
+			values, ok := operation.Value.(map[string]any)
+			if !ok {
+				return ErrInvalidSyntax
+			}
+			mergeAttributes(resource, values)
+		default:
+			setAttribute(resource, splitPath(operation.Path), operation.Value)
+		}
+	}
+	return nil
+}
+
+// valueFilter matches the value filters of PATCH paths, such as
+// [type eq "work"] in emails[type eq "work"].value.
+var valueFilter = regexp.MustCompile(`\[[^\]]*\]`)
+
+// splitPath splits an attribute path into the keys it descends through.
+// An extension attribute's schema URN is one key; the core schemas' URNs
+// are dropped, since their attributes sit at the top level.
+func splitPath(path string) []string {
+	path = valueFilter.ReplaceAllString(path, "")
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		if i := strings.LastIndex(path, ":"); i > 0 {
+			schema, attribute := path[:i], path[i+1:]
+			if strings.EqualFold(schema, SchemaUser) || strings.EqualFold(schema, SchemaGroup) {
+				return strings.Split(attribute, ".")
+			}
+			return append([]string{schema}, strings.Split(attribute, ".")...)
+		}
+	}
+	return strings.Split(path, ".")
+}
+
+// lookupKey returns the key of resource matching name case-insensitively,
+// as SCIM attribute names are, or name if there is none.
+func lookupKey(resource map[string]any, name string) string {
+	if _, ok := resource[name]; ok {
+		return name
+	}
+	for key := range resource {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+// getAttribute returns the value at the keys, or nil.
+func getAttribute(resource map[string]any, keys []string) any {
+	var current any = resource
+	for _, key := range keys {
+		section, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = section[lookupKey(section, key)]
+	}
+	return current
+}
+
+// stringAttribute returns the string at a dot path, or "".
+func stringAttribute(resource map[string]any, path string) string {
+	value, _ := getAttribute(resource, splitPath(path)).(string)
+	return strings.TrimSpace(value)
+}
+
+// setAttribute sets the value at the keys, creating sections as needed.
+func setAttribute(resource map[string]any, keys []string, value any) {
+	section := resource
+	for _, key := range keys[:len(keys)-1] {
+		key = lookupKey(section, key)
+		next, ok := section[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			section[key] = next
+		}
+		section = next
+	}
+	section[lookupKey(section, keys[len(keys)-1])] = value
+}
+
+// removeAttribute deletes the value at the keys.
+func removeAttribute(resource map[string]any, keys []string) {
+	section := resource
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := section[lookupKey(section, key)].(map[string]any)
+		if !ok {
+			return
+		}
+		section = next
+	}
+	delete(section, lookupKey(section, keys[len(keys)-1]))
+}
+
+// mergeAttributes sets the attributes of a pathless PATCH value, whose
+// keys may themselves be paths, merging sections.
+func mergeAttributes(resource, values map[string]any) {
+	for key, value := range values {
+		keys := splitPath(key)
+		if section, ok := value.(map[string]any); ok {
+			existing, isSection := getAttribute(resource, keys).(map[string]any)
+			if isSection {
+				mergeAttributes(existing, section)
+				continue
+			}
+		}
+		setAttribute(resource, keys, value)
+	}
+}
+
+// containsFold reports whether values contains value, ignoring case.
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package chassis
+
+import (
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaskedValue replaces the values of secret settings in masked config.
+const MaskedValue = "********"
+
+// SecretKeyer is implemented by modules with sensitive settings whose names
+// don't look secret, such as webhook URLs with embedded tokens. SecretKeys
+// returns dot paths, where * matches a single segment
+// ("alerts.channels.*.url"). Register adds them to the app's secret keys.
+type SecretKeyer interface {
+	SecretKeys() []string
+}
+
+// WithSecretKeys marks the settings at the given dot paths as secret, in
+// addition to those whose names look secret and those declared by modules.
+// A * matches a single segment, or part of one:
+//
+//	chassis.WithSecretKeys("billing.*.api_url", "database.dsn")
+func WithSecretKeys(patterns ...string) Option {
+	return func(app *App) {
+		app.secretKeys = append(app.secretKeys, patterns...)
+	}
+}
+
+// LooksSecret reports whether a setting's name suggests it holds a secret:
+// it contains password, secret or token, or ends with key.
+func LooksSecret(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "password") || strings.Contains(key, "secret") ||
+		strings.Contains(key, "token") || strings.HasSuffix(key, "key")
+}
+
+// IsSecret reports whether the setting at the dot path is secret, either
+// because its name looks secret or because it matches one of patterns.
+func IsSecret(dotPath string, patterns ...string) bool {
+	name := dotPath[strings.LastIndex(dotPath, ".")+1:]
+	return LooksSecret(name) || matchesSecret(dotPath, patterns)
+}
+
+// matchesSecret reports whether the dot path matches one of patterns.
+func matchesSecret(dotPath string, patterns []string) bool {
+	slashed := strings.ReplaceAll(dotPath, ".", "/")
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ReplaceAll(pattern, ".", "/"), slashed); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Masked returns a copy of the config with the values of secret settings
+// replaced by MaskedValue. Settings are secret if their names look secret,
+// or if their dot paths match one of patterns, which masks whole sections
+// too. The original config is unchanged.
+func (cfg ConfigData) Masked(patterns ...string) ConfigData {
+	masked, _ := maskValue("", cfg, patterns).(ConfigData)
+	return masked
+}
+
+// DumpSafe returns the config as YAML with secrets masked, for debug
+// endpoints and support bundles:
+//
+//	out, err := app.ConfigData().DumpSafe(app.SecretKeys()...)
+func (cfg ConfigData) DumpSafe(patterns ...string) ([]byte, error) {
+	return yaml.Marshal(cfg.Masked(patterns...))
+}
+
+// SecretPaths returns the sorted dot paths of the config's secret
+// settings, without their values.
+func (cfg ConfigData) SecretPaths(patterns ...string) []string {
+	found := make(map[string]bool)
+	collectSecrets("", cfg, patterns, found)
+	paths := make([]string, 0, len(found))
+	for dotPath := range found {
+		paths = append(paths, dotPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// LogValue implements slog.LogValuer, so logging the config never prints
+// the values of settings whose names look secret.
+func (cfg ConfigData) LogValue() slog.Value {
+	return slog.AnyValue(map[string]any(cfg.Masked()))
+}
+
+// SecretKeys returns the patterns the app masks in addition to settings
+// whose names look secret: those from WithSecretKeys, then those declared by
+// registered modules.
+func (app *App) SecretKeys() []string {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return append([]string(nil), app.secretKeys...)
+}
+
+// DumpConfig returns the loaded config as YAML, masked with the app's
+// secret keys.
+func (app *App) DumpConfig() ([]byte, error) {
+	return app.ConfigData().DumpSafe(app.SecretKeys()...)
+}
+
+// maskValue masks the secrets in value, found at the dot path. Items of a
+// list share the list's path.
+func maskValue(dotPath string, value any, patterns []string) any {
+	if dotPath != "" && matchesSecret(dotPath, patterns) {
+		return MaskedValue
+	}
+	if section := toStringMap(value); section != nil {
+		masked := make(ConfigData, len(section))
+		for key, item := range section {
+			if toStringMap(item) == nil && LooksSecret(key) {
+				masked[key] = MaskedValue
+				continue
+			}
+			masked[key] = maskValue(joinPath(dotPath, key), item, patterns)
+		}
+		return masked
+	}
+	if list, ok := value.([]any); ok {
+		masked := make([]any, len(list))
+		for i, item := range list {
+			masked[i] = maskValue(dotPath, item, patterns)
+		}
+		return masked
+	}
+	return value
+}
+
+// collectSecrets adds the dot paths of the secrets in value to paths.
+func collectSecrets(dotPath string, value any, patterns []string, paths map[string]bool) {
+	if dotPath != "" && matchesSecret(dotPath, patterns) {
+		paths[dotPath] = true
+		return
+	}
+	if section := toStringMap(value); section != nil {
+		for key, item := range section {
+			itemPath := joinPath(dotPath, key)
+			if toStringMap(item) == nil && LooksSecret(key) {
+				paths[itemPath] = true
+				continue
+			}
+			collectSecrets(itemPath, item, patterns, paths)
+		}
+	}
+	if list, ok := value.([]any); ok {
+		for _, item := range list {
+			collectSecrets(dotPath, item, patterns, paths)
+		}
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
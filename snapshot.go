@@ -0,0 +1,101 @@
+package chassis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrSnapshotNotSupported is returned by modules whose store or provider
+// cannot be snapshotted (e.g., a custom store that doesn't implement Snapshotter).
+var ErrSnapshotNotSupported = errors.New("snapshot not supported")
+
+// Snapshotter is implemented by modules, stores, and providers that can save
+// and restore their state. The path is owned by the implementer: modules
+// receive a directory, stores typically write a single file.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+	Restore(ctx context.Context, path string) error
+}
+
+// Snapshot is a saved copy of the state of all snapshot-capable modules.
+// Call Close to remove the snapshot files when done.
+type Snapshot struct {
+	dir     string
+	modules []string
+}
+
+// Modules returns the names of the modules captured in the snapshot.
+func (snap *Snapshot) Modules() []string {
+	return snap.modules
+}
+
+// Close removes the snapshot files.
+func (snap *Snapshot) Close() error {
+	return os.RemoveAll(snap.dir)
+}
+
+// Snapshot captures the state of every registered module that implements
+// Snapshotter. Modules reporting ErrSnapshotNotSupported are skipped.
+//
+// Intended for tests: run an expensive setup once, snapshot, and Restore
+// before each test instead of rebuilding the fixtures.
+func (app *App) Snapshot(ctx context.Context) (*Snapshot, error) {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	dir, err := os.MkdirTemp("", "chassis-snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	snap := &Snapshot{dir: dir}
+	for name, mod := range app.modules {
+		snapshotter, ok := mod.(Snapshotter)
+		if !ok {
+			continue
+		}
+
+		moduleDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(moduleDir, 0750); err != nil {
+			_ = snap.Close()
+			return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+
+		if err := snapshotter.Snapshot(ctx, moduleDir); err != nil {
+			if errors.Is(err, ErrSnapshotNotSupported) {
+				app.logger.Debug("module does not support snapshots", "module", name)
+				continue
+			}
+			_ = snap.Close()
+			return nil, fmt.Errorf("failed to snapshot module %q: %w", name, err)
+		}
+		snap.modules = append(snap.modules, name)
+	}
+
+	return snap, nil
+}
+
+// Restore resets every module captured in the snapshot to its saved state.
+func (app *App) Restore(ctx context.Context, snap *Snapshot) error {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+
+	for _, name := range snap.modules {
+		mod, exists := app.modules[name]
+		if !exists {
+			return fmt.Errorf("module %q in snapshot is not registered", name)
+		}
+		snapshotter, ok := mod.(Snapshotter)
+		if !ok {
+			return fmt.Errorf("module %q does not support snapshots", name)
+		}
+		if err := snapshotter.Restore(ctx, filepath.Join(snap.dir, name)); err != nil {
+			return fmt.Errorf("failed to restore module %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CopyingProvider is implemented by providers that can check for, copy and
+// move objects without reading them through the module, e.g. with a
+// server-side copy or a rename. LocalProvider implements it; use Copying
+// to get one for any provider.
+type CopyingProvider interface {
+	Provider
+
+	// Exists reports whether an object is stored at key.
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// Copy stores a copy of the object at src, with its metadata, at dst,
+	// overwriting dst. Returns os.ErrNotExist if src doesn't exist.
+	Copy(ctx context.Context, src, dst string) error
+
+	// Move is Copy, then deleting src. Returns os.ErrNotExist if src
+	// doesn't exist.
+	Move(ctx context.Context, src, dst string) error
+}
+
+// Copying returns provider as a CopyingProvider. Providers that can't copy
+// are adapted by streaming the object to its new key, and deleting the
+// old one for Move, which works but isn't atomic.
+func Copying(provider Provider) CopyingProvider {
+	if copying, ok := provider.(CopyingProvider); ok {
+		return copying
+	}
+	return streamedCopies{Provider: provider}
+}
+
+// streamedCopies adapts a Provider to CopyingProvider with reads and
+// writes.
+type streamedCopies struct {
+	Provider
+}
+
+func (streamed streamedCopies) Exists(ctx context.Context, key string) (bool, error) {
+	reader, err := Streaming(streamed.Provider).GetReader(ctx, key)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, reader.Close()
+}
+
+func (streamed streamedCopies) Copy(ctx context.Context, src, dst string) error {
+	return copyObject(ctx, streamed.Provider, src, dst)
+}
+
+func (streamed streamedCopies) Move(ctx context.Context, src, dst string) error {
+	if err := copyObject(ctx, streamed.Provider, src, dst); err != nil {
+		return err
+	}
+	return streamed.Delete(ctx, src)
+}
+
+// Exists reports whether key is in the module's storage.
+func (mod *Module) Exists(ctx context.Context, key string) (bool, error) {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Read)
+	defer cancel()
+	return Copying(mod.provider).Exists(ctx, key)
+}
+
+// Copy copies the object at src, with its metadata, to dst, counting it
+// against dst's quotas.
+func (mod *Module) Copy(ctx context.Context, src, dst string) error {
+	src, dst, err := validateKeys(src, dst)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Write)
+	defer cancel()
+	return Copying(mod.provider).Copy(ctx, src, dst)
+}
+
+// Move moves the object at src, with its metadata, to dst. Unlike Delete,
+// the source never goes to the trash, as its data lives on at dst.
+func (mod *Module) Move(ctx context.Context, src, dst string) error {
+	src, dst, err := validateKeys(src, dst)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Write)
+	defer cancel()
+	return Copying(mod.provider).Move(ctx, src, dst)
+}
+
+func validateKeys(src, dst string) (string, string, error) {
+	src, err := ValidateKey(src)
+	if err != nil {
+		return "", "", err
+	}
+	dst, err = ValidateKey(dst)
+	if err != nil {
+		return "", "", err
+	}
+	return src, dst, nil
+}
+
+// Exists reports whether a file is stored at key.
+func (local *LocalProvider) Exists(ctx context.Context, key string) (bool, error) {
+	fullPath, err := local.path(key)
+	if err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// Copy writes a copy of the file through a temporary file, like PutReader,
+// so dst is replaced atomically, then copies its metadata.
+func (local *LocalProvider) Copy(ctx context.Context, src, dst string) error {
+	srcPath, err := local.path(src)
+	if err != nil {
+		return err
+	}
+	if _, err := local.path(dst); err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Clean(srcPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.ErrNotExist
+		}
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	if err := local.PutReader(ctx, dst, file, info.Size()); err != nil {
+		return err
+	}
+	meta, err := os.ReadFile(filepath.Clean(local.sidecarPath(src)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return writeSidecar(local.sidecarPath(dst), meta)
+}
+
+// Move renames the file and its metadata, which is atomic within the base
+// path.
+func (local *LocalProvider) Move(ctx context.Context, src, dst string) error {
+	srcPath, err := local.path(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := local.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0750); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		if os.IsNotExist(err) {
+			return os.ErrNotExist
+		}
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	srcSidecar, dstSidecar := local.sidecarPath(src), local.sidecarPath(dst)
+	if _, err := os.Stat(srcSidecar); os.IsNotExist(err) {
+		return local.removeSidecar(dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstSidecar), 0750); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	if err := os.Rename(srcSidecar, dstSidecar); err != nil {
+		return fmt.Errorf("failed to move metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrInvalidEncryptionKey = chassis.NewError(chassis.CodeInvalidArgument, "storage encryption keys must be 32 bytes")
+	ErrEncryptionKeyUnknown = chassis.NewError(chassis.CodeFailedPrecondition, "storage encryption key not found")
+	ErrDecryptionFailed     = chassis.NewError(chassis.CodeInternal, "failed to decrypt storage object")
+	ErrEncryptionDisabled   = chassis.NewError(chassis.CodeFailedPrecondition, "storage encryption is not enabled")
+)
+
+// KeyProvider wraps and unwraps the per-object data keys of an
+// EncryptedProvider with key encryption keys (KEKs) it holds, so a KMS can
+// be plugged in without the KEKs leaving it. StaticKeys holds them in
+// memory.
+type KeyProvider interface {
+	// CurrentKeyID names the KEK new objects are encrypted with.
+	CurrentKeyID() string
+
+	// WrapKey encrypts a data key with the KEK keyID.
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+
+	// UnwrapKey decrypts a data key wrapped with the KEK keyID. Returns
+	// ErrEncryptionKeyUnknown if the KEK is gone.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider with AES-256 KEKs held in memory. Old keys
+// are kept so objects encrypted with them stay readable until rotated.
+type StaticKeys struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewStaticKeys returns a KeyProvider that encrypts with keys[current] and
+// decrypts with any of keys. Each key is 32 bytes.
+func NewStaticKeys(current string, keys map[string][]byte) (*StaticKeys, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionKeyUnknown, current)
+	}
+	static := &StaticKeys{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for keyID, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidEncryptionKey, keyID)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		static.keys[keyID] = aead
+	}
+	return static, nil
+}
+
+// CurrentKeyID returns the key new objects are encrypted with.
+func (static *StaticKeys) CurrentKeyID() string {
+	return static.current
+}
+
+// WrapKey encrypts dataKey with the KEK keyID, binding it to the ID.
+func (static *StaticKeys) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, ok := static.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionKeyUnknown, keyID)
+	}
+	return seal(aead, dataKey, []byte(keyID))
+}
+
+// UnwrapKey decrypts a data key wrapped with the KEK keyID.
+func (static *StaticKeys) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := static.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionKeyUnknown, keyID)
+	}
+	return open(aead, wrapped, []byte(keyID))
+}
+
+// staticKeysFromConfig reads storage.encryption: current_key names the key
+// to encrypt with, and keys maps key IDs to base64-encoded 32-byte keys.
+func staticKeysFromConfig(cfg chassis.ConfigData) (*StaticKeys, error) {
+	current := cfg.GetString("storage.encryption.current_key")
+	section := cfg.Section("storage.encryption.keys")
+	keys := make(map[string][]byte, len(section))
+	for keyID := range section {
+		key, err := base64.StdEncoding.DecodeString(section.GetString(keyID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode storage.encryption.keys.%s: %w", keyID, err)
+		}
+		keys[keyID] = key
+	}
+	return NewStaticKeys(current, keys)
+}
+
+// envelopeMagic starts every object written by an EncryptedProvider. It is
+// followed by the JSON envelope, a newline and the sealed data.
+const envelopeMagic = "chassis-enc:v1\n"
+
+// envelope is the encryption metadata stored with each object: the KEK
+// that wrapped its data key, and the wrapped data key.
+type envelope struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// EncryptedProvider encrypts objects with AES-256-GCM before delegating to
+// the wrapped provider. Each object gets its own random data key, wrapped
+// by the KeyProvider and stored in an envelope at the start of the object,
+// so rotating KEKs only rewrites envelopes. Objects without an envelope,
+// stored before encryption was enabled, are read as is until Rotate
+// encrypts them.
+type EncryptedProvider struct {
+	Provider
+	keys KeyProvider
+}
+
+// NewEncryptedProvider returns provider with encryption at rest. Use it
+// with WithWrapper, or WithEncryption to have the module install it.
+func NewEncryptedProvider(provider Provider, keys KeyProvider) *EncryptedProvider {
+	return &EncryptedProvider{Provider: provider, keys: keys}
+}
+
+// Put encrypts data with a new data key under the current KEK. When the
+// wrapped provider stores metadata, the content type detected from the
+// plaintext is recorded, as it can't be detected from the ciphertext.
+func (encrypted *EncryptedProvider) Put(ctx context.Context, key string, data []byte) error {
+	if storesMetadata(encrypted.Provider) {
+		return encrypted.PutWithMetadata(ctx, key, bytes.NewReader(data), int64(len(data)), Metadata{})
+	}
+	sealed, err := encrypted.encrypt(ctx, data)
+	if err != nil {
+		return err
+	}
+	return encrypted.Provider.Put(ctx, key, sealed)
+}
+
+// Get decrypts the object at key.
+func (encrypted *EncryptedProvider) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := encrypted.Provider.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return encrypted.decrypt(ctx, data)
+}
+
+// PutWithMetadata encrypts the data, which means reading it into memory,
+// and stores it with meta.
+func (encrypted *EncryptedProvider) PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta Metadata) error {
+	described, ok := encrypted.Provider.(MetadataProvider)
+	if !ok {
+		return ErrMetadataNotSupported
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("%w: read %d of %d bytes", ErrSizeMismatch, len(data), size)
+	}
+	sealed, err := encrypted.encrypt(ctx, data)
+	if err != nil {
+		return err
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = DetectContentType(key, data)
+	}
+	return described.PutWithMetadata(ctx, key, bytes.NewReader(sealed), int64(len(sealed)), meta)
+}
+
+// Stat reports the size and checksum of the plaintext.
+func (encrypted *EncryptedProvider) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info := &ObjectInfo{Key: key}
+	if described, ok := encrypted.Provider.(MetadataProvider); ok {
+		stored, err := described.Stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		info = stored
+	}
+
+	data, err := encrypted.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = int64(len(data))
+	info.Checksum = Checksum(data)
+	if info.ContentType == "" || !storesMetadata(encrypted.Provider) {
+		info.ContentType = DetectContentType(key, data)
+	}
+	return info, nil
+}
+
+// Rotate rewrites the envelopes of objects under prefix whose data key is
+// wrapped with an old KEK, and encrypts objects stored before encryption
+// was enabled. It returns how many objects were rewritten. Once it has
+// run, old keys can be removed from the KeyProvider.
+func (encrypted *EncryptedProvider) Rotate(ctx context.Context, prefix string) (int, error) {
+	keys, err := encrypted.Provider.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	current := encrypted.keys.CurrentKeyID()
+	rotated := 0
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return rotated, err
+		}
+		data, err := encrypted.Provider.Get(ctx, key)
+		if err != nil {
+			return rotated, err
+		}
+
+		var sealed []byte
+		header, body, ok, err := parseEnvelope(data)
+		switch {
+		case err != nil:
+			return rotated, fmt.Errorf("%s: %w", key, err)
+		case !ok:
+			sealed, err = encrypted.encrypt(ctx, data)
+		case header.KeyID != current:
+			sealed, err = encrypted.rewrap(ctx, header, body)
+		default:
+			continue
+		}
+		if err != nil {
+			return rotated, fmt.Errorf("%s: %w", key, err)
+		}
+		if err := encrypted.rewrite(ctx, key, sealed); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// rewrite replaces the stored bytes of key, keeping its metadata.
+func (encrypted *EncryptedProvider) rewrite(ctx context.Context, key string, sealed []byte) error {
+	if described, ok := encrypted.Provider.(MetadataProvider); ok && storesMetadata(encrypted.Provider) {
+		info, err := described.Stat(ctx, key)
+		if err != nil {
+			return err
+		}
+		return described.PutWithMetadata(ctx, key, bytes.NewReader(sealed), int64(len(sealed)), info.Metadata)
+	}
+	return encrypted.Provider.Put(ctx, key, sealed)
+}
+
+// Exists delegates to the wrapped provider.
+func (encrypted *EncryptedProvider) Exists(ctx context.Context, key string) (bool, error) {
+	return Copying(encrypted.Provider).Exists(ctx, key)
+}
+
+// Copy delegates to the wrapped provider. Data keys aren't bound to the
+// object's key, so the ciphertext is copied as is.
+func (encrypted *EncryptedProvider) Copy(ctx context.Context, src, dst string) error {
+	return Copying(encrypted.Provider).Copy(ctx, src, dst)
+}
+
+// Move delegates to the wrapped provider.
+func (encrypted *EncryptedProvider) Move(ctx context.Context, src, dst string) error {
+	return Copying(encrypted.Provider).Move(ctx, src, dst)
+}
+
+// ListPage delegates to the wrapped provider.
+func (encrypted *EncryptedProvider) ListPage(ctx context.Context, prefix string, opts ListOptions) (*Page, error) {
+	return Paging(encrypted.Provider).ListPage(ctx, prefix, opts)
+}
+
+// Snapshot delegates to the wrapped provider. Snapshots hold ciphertext.
+func (encrypted *EncryptedProvider) Snapshot(ctx context.Context, path string) error {
+	snapshotter, ok := encrypted.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, path)
+}
+
+// Restore delegates to the wrapped provider.
+func (encrypted *EncryptedProvider) Restore(ctx context.Context, path string) error {
+	snapshotter, ok := encrypted.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, path)
+}
+
+func (encrypted *EncryptedProvider) encrypt(ctx context.Context, data []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := seal(aead, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return encrypted.seal(ctx, dataKey, body)
+}
+
+// rewrap wraps the data key of an object with the current KEK.
+func (encrypted *EncryptedProvider) rewrap(ctx context.Context, header envelope, body []byte) ([]byte, error) {
+	dataKey, err := encrypted.keys.UnwrapKey(ctx, header.KeyID, header.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return encrypted.seal(ctx, dataKey, body)
+}
+
+// seal prepends the envelope of dataKey, wrapped with the current KEK.
+func (encrypted *EncryptedProvider) seal(ctx context.Context, dataKey, body []byte) ([]byte, error) {
+	keyID := encrypted.keys.CurrentKeyID()
+	wrapped, err := encrypted.keys.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	header, err := json.Marshal(envelope{KeyID: keyID, WrappedKey: wrapped})
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(envelopeMagic)+len(header)+1+len(body))
+	sealed = append(sealed, envelopeMagic...)
+	sealed = append(sealed, header...)
+	sealed = append(sealed, '\n')
+	return append(sealed, body...), nil
+}
+
+func (encrypted *EncryptedProvider) decrypt(ctx context.Context, data []byte) ([]byte, error) {
+	header, body, ok, err := parseEnvelope(data)
+	if err != nil || !ok {
+		return data, err
+	}
+	dataKey, err := encrypted.keys.UnwrapKey(ctx, header.KeyID, header.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, body, nil)
+}
+
+// parseEnvelope splits an encrypted object into its envelope and sealed
+// data. ok is false for objects that aren't encrypted.
+func parseEnvelope(data []byte) (header envelope, body []byte, ok bool, err error) {
+	rest, ok := bytes.CutPrefix(data, []byte(envelopeMagic))
+	if !ok {
+		return envelope{}, nil, false, nil
+	}
+	encoded, body, found := bytes.Cut(rest, []byte("\n"))
+	if !found {
+		return envelope{}, nil, true, ErrDecryptionFailed
+	}
+	if err := json.Unmarshal(encoded, &header); err != nil {
+		return envelope{}, nil, true, ErrDecryptionFailed
+	}
+	return header, body, true, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open decrypts what seal returned.
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, ErrDecryptionFailed
+	}
+	plaintext, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additional)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
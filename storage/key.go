@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrInvalidKey = chassis.NewError(chassis.CodeInvalidArgument, "invalid storage key")
+
+// MaxKeyLength is the longest key accepted, in bytes (S3's limit).
+const MaxKeyLength = 1024
+
+// ValidateKey checks that key is safe to use with any provider and returns
+// it normalized: empty and "." segments are dropped, so "a//./b" becomes
+// "a/b". Keys that are absolute, contain ".." segments, backslashes,
+// control characters or invalid UTF-8, or are longer than MaxKeyLength
+// fail with ErrInvalidKey. So do keys under the local provider's metadata
+// directory or TrashPrefix, which only the module itself writes; trashed
+// objects are reached through Module.Trash. The module validates every key
+// it is given.
+func ValidateKey(key string) (string, error) {
+	normalized, err := normalizeKey(key)
+	if err != nil {
+		return "", err
+	}
+	if normalized == "" {
+		return "", fmt.Errorf("%w: key is empty", ErrInvalidKey)
+	}
+	for _, reserved := range []string{metaDir, strings.TrimSuffix(TrashPrefix, "/")} {
+		if normalized == reserved || strings.HasPrefix(normalized, reserved+"/") {
+			return "", fmt.Errorf("%w: %q is under the reserved %s/ prefix", ErrInvalidKey, key, reserved)
+		}
+	}
+	return normalized, nil
+}
+
+// validatePrefix is ValidateKey for List prefixes, which may be empty and
+// keep a trailing "/".
+func validatePrefix(prefix string) (string, error) {
+	normalized, err := normalizeKey(prefix)
+	if err != nil || normalized == "" {
+		return normalized, err
+	}
+	if strings.HasSuffix(prefix, "/") {
+		normalized += "/"
+	}
+	return normalized, nil
+}
+
+func normalizeKey(key string) (string, error) {
+	if len(key) > MaxKeyLength {
+		return "", fmt.Errorf("%w: key is longer than %d bytes", ErrInvalidKey, MaxKeyLength)
+	}
+	if !utf8.ValidString(key) {
+		return "", fmt.Errorf("%w: key is not valid UTF-8", ErrInvalidKey)
+	}
+	if strings.HasPrefix(key, "/") || filepath.VolumeName(key) != "" {
+		return "", fmt.Errorf("%w: %q is absolute", ErrInvalidKey, key)
+	}
+	for _, char := range key {
+		if char == '\\' || unicode.IsControl(char) {
+			return "", fmt.Errorf("%w: %q contains %q", ErrInvalidKey, key, char)
+		}
+	}
+
+	segments := strings.Split(key, "/")
+	kept := segments[:0]
+	for _, segment := range segments {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("%w: %q contains a .. segment", ErrInvalidKey, key)
+		}
+		kept = append(kept, segment)
+	}
+	return strings.Join(kept, "/"), nil
+}
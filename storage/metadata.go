@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrMetadataNotSupported = chassis.NewError(chassis.CodeFailedPrecondition, "storage provider does not support object metadata")
+
+// Metadata is what callers set on an object.
+type Metadata struct {
+	ContentType string            // detected from the key or data when empty
+	Values      map[string]string // custom key/values, e.g. x-amz-meta-* on S3
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key      string
+	Size     int64
+	ModTime  time.Time // zero if the provider doesn't know it
+	Checksum string    // hex SHA-256 of the data
+	Metadata
+}
+
+// MetadataProvider is implemented by providers that store metadata with
+// objects. LocalProvider keeps it in sidecar files; an S3 provider would
+// map it to Content-Type and x-amz-meta-* headers. Stat works on other
+// providers too, by reading the object.
+type MetadataProvider interface {
+	Provider
+
+	// PutWithMetadata stores the data read from reader at key with meta,
+	// like PutReader. Putting the object again without metadata clears it.
+	PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta Metadata) error
+
+	// Stat describes the object at key without reading it where possible.
+	// Returns os.ErrNotExist if the key doesn't exist.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+// Stat describes the object at key.
+func (mod *Module) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Read)
+	defer cancel()
+	return stat(ctx, mod.provider, key)
+}
+
+// PutWithMetadata streams the data from reader to key with meta. It fails
+// with ErrMetadataNotSupported if the provider can't store metadata.
+func (mod *Module) PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta Metadata) error {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Write)
+	defer cancel()
+	return putWithMetadata(ctx, mod.provider, key, reader, size, meta)
+}
+
+// Serve writes the object at key as an HTTP response with its content
+// type, size, checksum as ETag and modification time, so downloads get the
+// right headers. Conditional and range requests are supported when the
+// provider's reader can seek.
+func (mod *Module) Serve(writer http.ResponseWriter, request *http.Request, key string) {
+	ctx := request.Context()
+	info, err := mod.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(writer, request)
+			return
+		}
+		mod.app.Logger().Error("failed to stat object", "key", key, "error", err)
+		http.Error(writer, "internal error", http.StatusInternalServerError)
+		return
+	}
+	reader, err := mod.GetReader(ctx, key)
+	if err != nil {
+		mod.app.Logger().Error("failed to open object", "key", key, "error", err)
+		http.Error(writer, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = reader.Close() }()
+
+	header := writer.Header()
+	header.Set("Content-Type", info.ContentType)
+	if info.Checksum != "" {
+		header.Set("ETag", `"`+info.Checksum+`"`)
+	}
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(writer, request, path.Base(key), info.ModTime, seeker)
+		return
+	}
+	header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if !info.ModTime.IsZero() {
+		header.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	_, _ = io.Copy(writer, reader)
+}
+
+func stat(ctx context.Context, provider Provider, key string) (*ObjectInfo, error) {
+	if described, ok := provider.(MetadataProvider); ok {
+		return described.Stat(ctx, key)
+	}
+	data, err := provider.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:      key,
+		Size:     int64(len(data)),
+		Checksum: Checksum(data),
+		Metadata: Metadata{ContentType: DetectContentType(key, data)},
+	}, nil
+}
+
+func putWithMetadata(ctx context.Context, provider Provider, key string, reader io.Reader, size int64, meta Metadata) error {
+	described, ok := provider.(MetadataProvider)
+	if !ok {
+		return ErrMetadataNotSupported
+	}
+	return described.PutWithMetadata(ctx, key, reader, size, meta)
+}
+
+// Checksum returns the hex SHA-256 of data, as reported in ObjectInfo.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DetectContentType guesses an object's content type from the extension of
+// key, falling back to sniffing the first bytes of data.
+func DetectContentType(key string, data []byte) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(data)
+}
+
+// metaDir holds the local provider's metadata sidecars, one JSON file per
+// object at metaDir/<key>.json. List skips it.
+const metaDir = ".meta"
+
+// sidecar is the JSON stored for an object with metadata.
+type sidecar struct {
+	ContentType string            `json:"content_type,omitempty"`
+	Values      map[string]string `json:"values,omitempty"`
+	Checksum    string            `json:"checksum"`
+}
+
+func (local *LocalProvider) sidecarPath(key string) string {
+	return filepath.Join(local.basePath, metaDir, key+".json")
+}
+
+// PutWithMetadata streams the data to key and records meta and the
+// checksum in a sidecar file.
+func (local *LocalProvider) PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta Metadata) error {
+	hash := sha256.New()
+	if err := local.PutReader(ctx, key, io.TeeReader(reader, hash), size); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(sidecar{
+		ContentType: meta.ContentType,
+		Values:      meta.Values,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeSidecar(local.sidecarPath(key), data)
+}
+
+// writeSidecar writes the metadata file at path.
+func writeSidecar(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// Stat reads the file's size and modification time and the sidecar, if
+// any. Objects stored without metadata are hashed and their content type
+// detected.
+func (local *LocalProvider) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	fullPath, err := local.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	info := &ObjectInfo{Key: key, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}
+
+	var meta sidecar
+	data, err := os.ReadFile(filepath.Clean(local.sidecarPath(key)))
+	if err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	info.ContentType = meta.ContentType
+	info.Values = meta.Values
+	info.Checksum = meta.Checksum
+
+	if info.Checksum == "" || info.ContentType == "" {
+		if err := local.describe(ctx, fullPath, info); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// describe fills in the checksum and content type from the file itself,
+// stopping if ctx is cancelled.
+func (local *LocalProvider) describe(ctx context.Context, fullPath string, info *ObjectInfo) error {
+	opened, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = opened.Close() }()
+	file := contextReader{ctx: ctx, reader: opened}
+
+	var head bytes.Buffer
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.TeeReader(io.LimitReader(file, 512), &head)); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.ContentType == "" {
+		info.ContentType = DetectContentType(info.Key, head.Bytes())
+	}
+	if info.Checksum == "" {
+		if _, err := io.Copy(hash, file); err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		info.Checksum = hex.EncodeToString(hash.Sum(nil))
+	}
+	return nil
+}
+
+// removeSidecar deletes the metadata of key, if any.
+func (local *LocalProvider) removeSidecar(key string) error {
+	err := os.Remove(local.sidecarPath(key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete metadata: %w", err)
+	}
+	return nil
+}
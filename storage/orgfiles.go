@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"net/http"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/auth"
+)
+
+var ErrOrgFilesDenied = chassis.NewError(chassis.CodePermissionDenied, "permission denied")
+
+// OrgFilesPermission is the permission OrgFilesHandler checks on the org
+// before serving its files.
+const OrgFilesPermission = "org:read"
+
+// OrgFilesHandler returns an HTTP handler serving the files of the ForOrg
+// view of each org to users with OrgFilesPermission on the org, checked
+// with the permissions module. Mount it under a prefix behind
+// auth.RequireAuth:
+//
+//	mux.Handle("/files/", http.StripPrefix("/files", authMod.RequireAuth(storageMod.OrgFilesHandler())))
+//
+// Routes (relative to the prefix):
+//
+//	GET /{org_id}/{key...}   download orgs/<org_id>/<key> with Serve
+//
+// Requests without a user get a 401 envelope; requests for an org the user
+// can't read, or any request without the permissions module, get a 403
+// before the object is looked up, so they can't probe which keys exist.
+func (mod *Module) OrgFilesHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{org_id}/{key...}", func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		userID := auth.UserIDFromContext(ctx)
+		if authMod, ok := mod.app.TryAuth(); userID == "" && ok {
+			userID = authMod.GetUserID(ctx, request)
+		}
+		if userID == "" {
+			api.WriteError(writer, request, auth.ErrNotAuthenticated)
+			return
+		}
+
+		orgID := request.PathValue("org_id")
+		if permissionsMod, ok := mod.app.TryPermissions(); !ok || !permissionsMod.Can(ctx, userID, OrgFilesPermission, orgID) {
+			if mod.app != nil {
+				mod.app.Logger().Warn("org file access denied", "user_id", userID, "org_id", orgID, "path", request.URL.Path)
+			}
+			api.WriteError(writer, request, ErrOrgFilesDenied)
+			return
+		}
+		mod.ForOrg(orgID).Serve(writer, request, request.PathValue("key"))
+	})
+	return mux
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/talosaether/chassis/pagination"
+)
+
+// ListOptions selects a page of keys.
+type ListOptions struct {
+	Cursor    string // NextCursor of the previous page, "" for the first
+	Limit     int    // at most this many keys and prefixes
+	Delimiter string // group keys containing it after the prefix, e.g. "/"
+}
+
+// Page is one page of a listing, in key order.
+type Page struct {
+	Keys []string `json:"keys"`
+	// Prefixes are the "directories" under a delimiter: the part of each
+	// grouped key up to and including the delimiter, e.g. "photos/2024/".
+	Prefixes   []string `json:"prefixes,omitempty"`
+	HasMore    bool     `json:"hasMore"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// PagingProvider is implemented by providers that list a page at a time,
+// such as S3 with ListObjectsV2 continuation tokens. Cursors are opaque
+// and only passed back to the provider that made them. Use Paging to get
+// one for any provider.
+type PagingProvider interface {
+	Provider
+
+	// ListPage returns up to opts.Limit keys and prefixes under prefix,
+	// starting after opts.Cursor.
+	ListPage(ctx context.Context, prefix string, opts ListOptions) (*Page, error)
+}
+
+// ListOption configures ListPage.
+type ListOption func(*ListOptions)
+
+// WithDelimiter groups keys by delimiter, so a listing shows one level of
+// "directories" like a file browser.
+func WithDelimiter(delimiter string) ListOption {
+	return func(opts *ListOptions) {
+		opts.Delimiter = delimiter
+	}
+}
+
+// ListPage returns a page of the keys under prefix, starting after cursor.
+// limit is normalized like pagination.Request, so at most
+// pagination.MaxLimit entries are returned:
+//
+//	page, err := storageMod.ListPage(ctx, "photos/", "", 50, storage.WithDelimiter("/"))
+//	for _, dir := range page.Prefixes { ... }
+//	next, err := storageMod.ListPage(ctx, "photos/", page.NextCursor, 50, storage.WithDelimiter("/"))
+//
+// Pages may hold fewer entries than limit even when HasMore is set.
+func (mod *Module) ListPage(ctx context.Context, prefix, cursor string, limit int, opts ...ListOption) (*Page, error) {
+	prefix, err := validatePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	options := ListOptions{
+		Cursor: cursor,
+		Limit:  pagination.Request{Limit: limit}.Normalize().Limit,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.List)
+	defer cancel()
+	return Paging(mod.provider).ListPage(ctx, prefix, options)
+}
+
+// Paging returns provider as a PagingProvider. Providers that don't page
+// are adapted by listing every key and paging in memory.
+func Paging(provider Provider) PagingProvider {
+	if paging, ok := provider.(PagingProvider); ok {
+		return paging
+	}
+	return listingProvider{Provider: provider}
+}
+
+// listingProvider adapts a Provider to PagingProvider with full listings.
+type listingProvider struct {
+	Provider
+}
+
+func (listing listingProvider) ListPage(ctx context.Context, prefix string, opts ListOptions) (*Page, error) {
+	keys, err := listing.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return pageKeys(keys, prefix, opts)
+}
+
+// listEntry is a key or, under a delimiter, a prefix.
+type listEntry struct {
+	name     string
+	isPrefix bool
+}
+
+// pageKeys pages keys under prefix, grouping them by opts.Delimiter.
+func pageKeys(keys []string, prefix string, opts ListOptions) (*Page, error) {
+	sort.Strings(keys)
+	entries := make([]listEntry, 0, len(keys))
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		entry := listEntry{name: key}
+		if opts.Delimiter != "" {
+			if index := strings.Index(rest, opts.Delimiter); index >= 0 {
+				entry = listEntry{name: prefix + rest[:index+len(opts.Delimiter)], isPrefix: true}
+			}
+		}
+		// Keys sharing a prefix are adjacent once sorted
+		if len(entries) > 0 && entries[len(entries)-1].name == entry.name {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return paginate(entries, opts)
+}
+
+// paginate returns the entries, in order, after the position in
+// opts.Cursor.
+func paginate(entries []listEntry, opts ListOptions) (*Page, error) {
+	after := ""
+	if opts.Cursor != "" {
+		position, err := pagination.DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = position
+	}
+
+	page := &Page{Keys: []string{}}
+	count := 0
+	for _, entry := range entries {
+		if entry.name <= after {
+			continue
+		}
+		if opts.Limit > 0 && count == opts.Limit {
+			page.HasMore = true
+			page.NextCursor = pagination.EncodeCursor(after)
+			break
+		}
+		if entry.isPrefix {
+			page.Prefixes = append(page.Prefixes, entry.name)
+		} else {
+			page.Keys = append(page.Keys, entry.name)
+		}
+		after = entry.name
+		count++
+	}
+	return page, nil
+}
+
+// ListPage reads only the directory of prefix when listing by "/" under a
+// directory prefix, like a file browser. Other listings walk the tree.
+func (local *LocalProvider) ListPage(ctx context.Context, prefix string, opts ListOptions) (*Page, error) {
+	if opts.Delimiter != "/" || (prefix != "" && !strings.HasSuffix(prefix, "/")) {
+		keys, err := local.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return pageKeys(keys, prefix, opts)
+	}
+
+	dir := local.basePath
+	if prefix != "" {
+		var err error
+		if dir, err = local.path(strings.TrimSuffix(prefix, "/")); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	entries := make([]listEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		switch {
+		case strings.HasPrefix(name, uploadTempPrefix):
+			continue
+		case dirEntry.IsDir() && filepath.Join(dir, name) == filepath.Join(local.basePath, metaDir):
+			continue
+		case dirEntry.IsDir() && !hasFiles(ctx, filepath.Join(dir, name)):
+			continue // left behind by deletes
+		case dirEntry.IsDir():
+			entries = append(entries, listEntry{name: prefix + name + "/", isPrefix: true})
+		default:
+			entries = append(entries, listEntry{name: prefix + name})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return paginate(entries, opts)
+}
+
+// hasFiles reports whether the tree at dir holds any stored file. It stops
+// early, reporting none, once ctx is done.
+func hasFiles(ctx context.Context, dir string) bool {
+	found := false
+	_ = filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return fs.SkipAll
+		}
+		if err == nil && !entry.IsDir() && !strings.HasPrefix(entry.Name(), uploadTempPrefix) {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/internal/sqlite"
+)
+
+var (
+	ErrQuotaExceeded   = chassis.NewError(chassis.CodeResourceExhausted, "storage quota exceeded")
+	ErrUsageNotTracked = chassis.NewError(chassis.CodeFailedPrecondition, "storage usage is not tracked")
+)
+
+// QuotaLimit returns the byte limit for the prefix a quota matched, e.g.
+// from the plan of the org that owns it. Zero or less means unlimited.
+type QuotaLimit func(ctx context.Context, prefix string) (int64, error)
+
+// Quota limits the bytes stored under the key prefixes matching Pattern.
+type Quota struct {
+	Pattern string
+	Limit   QuotaLimit
+}
+
+// match returns the prefix of key that the quota applies to. Each "*"
+// segment of the pattern matches one path segment, so "orgs/*/" gives
+// every org its own quota: "orgs/acme/logo.png" is counted under
+// "orgs/acme/".
+func (q Quota) match(key string) (string, bool) {
+	var prefix strings.Builder
+	rest := key
+	pattern := q.Pattern
+	for pattern != "" {
+		segment, more, hasMore := strings.Cut(pattern, "*")
+		if !strings.HasPrefix(rest, segment) {
+			return "", false
+		}
+		prefix.WriteString(segment)
+		rest = rest[len(segment):]
+		if !hasMore {
+			break
+		}
+		name, _, found := strings.Cut(rest, "/")
+		if !found || name == "" {
+			return "", false
+		}
+		prefix.WriteString(name)
+		rest = rest[len(name):]
+		pattern = more
+	}
+	return prefix.String(), true
+}
+
+// UsageStore records the size of each stored object so that usage can be
+// summed by key prefix. The module keeps it in memory unless
+// storage.usage_db_path or WithUsageStore says otherwise.
+type UsageStore interface {
+	// Size returns the recorded size of key, or 0 if none is recorded.
+	Size(ctx context.Context, key string) (int64, error)
+	SetSize(ctx context.Context, key string, size int64) error
+	RemoveSize(ctx context.Context, key string) error
+	// Usage returns the total size of the keys starting with prefix.
+	Usage(ctx context.Context, prefix string) (int64, error)
+	// Reset replaces all records with sizes.
+	Reset(ctx context.Context, sizes map[string]int64) error
+	Close() error
+}
+
+// MemoryUsageStore keeps object sizes in process memory.
+type MemoryUsageStore struct {
+	mu    sync.RWMutex
+	sizes map[string]int64
+}
+
+// NewMemoryUsageStore creates an in-memory usage store.
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{sizes: make(map[string]int64)}
+}
+
+func (store *MemoryUsageStore) Size(ctx context.Context, key string) (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.sizes[key], nil
+}
+
+func (store *MemoryUsageStore) SetSize(ctx context.Context, key string, size int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.sizes[key] = size
+	return nil
+}
+
+func (store *MemoryUsageStore) RemoveSize(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.sizes, key)
+	return nil
+}
+
+func (store *MemoryUsageStore) Usage(ctx context.Context, prefix string) (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var total int64
+	for key, size := range store.sizes {
+		if strings.HasPrefix(key, prefix) {
+			total += size
+		}
+	}
+	return total, nil
+}
+
+func (store *MemoryUsageStore) Reset(ctx context.Context, sizes map[string]int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.sizes = make(map[string]int64, len(sizes))
+	for key, size := range sizes {
+		store.sizes[key] = size
+	}
+	return nil
+}
+
+func (store *MemoryUsageStore) Close() error {
+	return nil
+}
+
+// SQLiteUsageStore implements UsageStore using SQLite.
+type SQLiteUsageStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteUsageStore creates a new SQLite-backed usage store.
+func NewSQLiteUsageStore(dbPath string) (*SQLiteUsageStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLiteUsageStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteUsageStoreFromDB creates a usage store on a database the caller
+// owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteUsageStoreFromDB(db *sql.DB) (*SQLiteUsageStore, error) {
+	if err := initUsageSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteUsageStore{db: db}, nil
+}
+
+func initUsageSchema(db *sql.DB) error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS storage_usage (
+			key TEXT PRIMARY KEY,
+			size INTEGER NOT NULL
+		);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+func (store *SQLiteUsageStore) Size(ctx context.Context, key string) (int64, error) {
+	var size int64
+	err := store.db.QueryRowContext(ctx, `SELECT size FROM storage_usage WHERE key = ?`, key).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return size, err
+}
+
+func (store *SQLiteUsageStore) SetSize(ctx context.Context, key string, size int64) error {
+	query := `INSERT INTO storage_usage (key, size) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET size = excluded.size`
+	_, err := store.db.ExecContext(ctx, query, key, size)
+	return err
+}
+
+func (store *SQLiteUsageStore) RemoveSize(ctx context.Context, key string) error {
+	_, err := store.db.ExecContext(ctx, `DELETE FROM storage_usage WHERE key = ?`, key)
+	return err
+}
+
+func (store *SQLiteUsageStore) Usage(ctx context.Context, prefix string) (int64, error) {
+	var total int64
+	query := `SELECT COALESCE(SUM(size), 0) FROM storage_usage WHERE substr(key, 1, length(?)) = ?`
+	err := store.db.QueryRowContext(ctx, query, prefix, prefix).Scan(&total)
+	return total, err
+}
+
+func (store *SQLiteUsageStore) Reset(ctx context.Context, sizes map[string]int64) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM storage_usage`); err != nil {
+		return err
+	}
+	for key, size := range sizes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO storage_usage (key, size) VALUES (?, ?)`, key, size); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (store *SQLiteUsageStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// quotaProvider records object sizes and rejects writes that would take a
+// prefix over its quota. It sits directly above the base provider, so it
+// counts the bytes actually stored (after encryption, say) and trashed
+// objects stop counting against the prefix they were deleted from.
+type quotaProvider struct {
+	Provider
+	usage  UsageStore
+	quotas []Quota
+
+	// mu serializes the accounting, not the writes: Put reserves the new
+	// size before writing and rolls it back if the write fails.
+	mu sync.Mutex
+}
+
+// Put stores data if every quota matching key has room for it.
+func (quotas *quotaProvider) Put(ctx context.Context, key string, data []byte) error {
+	return quotas.PutReader(ctx, key, bytes.NewReader(data), int64(len(data)))
+}
+
+// PutReader stores the data if every quota matching key has room for it.
+// A known size is checked up front; a write of unknown size fails with
+// ErrQuotaExceeded once it reads past the room left.
+func (quotas *quotaProvider) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	return quotas.write(ctx, key, reader, size, func(reader io.Reader) error {
+		return Streaming(quotas.Provider).PutReader(ctx, key, reader, size)
+	})
+}
+
+// PutWithMetadata is PutReader with metadata.
+func (quotas *quotaProvider) PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta Metadata) error {
+	return quotas.write(ctx, key, reader, size, func(reader io.Reader) error {
+		return putWithMetadata(ctx, quotas.Provider, key, reader, size, meta)
+	})
+}
+
+// Stat delegates to the wrapped provider.
+func (quotas *quotaProvider) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	return stat(ctx, quotas.Provider, key)
+}
+
+// write runs put with a reader that enforces the quotas of key and records
+// the size written.
+func (quotas *quotaProvider) write(ctx context.Context, key string, reader io.Reader, size int64, put func(io.Reader) error) error {
+	quotas.mu.Lock()
+	previous, room, err := quotas.reserve(ctx, key, max(size, 0))
+	quotas.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	counted := &quotaReader{reader: reader, key: key, room: room}
+	putErr := put(counted)
+
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	if putErr != nil {
+		if previous == 0 {
+			err = quotas.usage.RemoveSize(ctx, key)
+		} else {
+			err = quotas.usage.SetSize(ctx, key, previous)
+		}
+		if err != nil {
+			return fmt.Errorf("%w (and failed to release quota: %v)", putErr, err)
+		}
+		return putErr
+	}
+	if err := quotas.usage.SetSize(ctx, key, counted.read); err != nil {
+		return fmt.Errorf("failed to record object size: %w", err)
+	}
+	return nil
+}
+
+// reserve checks that key can grow to size bytes and records the larger of
+// its old and new sizes until the write finishes. It returns the previous
+// size and the most bytes key may hold. The caller holds mu.
+func (quotas *quotaProvider) reserve(ctx context.Context, key string, size int64) (int64, int64, error) {
+	previous, err := quotas.usage.Size(ctx, key)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read object size: %w", err)
+	}
+
+	room := int64(math.MaxInt64)
+	for _, q := range quotas.quotas {
+		prefix, ok := q.match(key)
+		if !ok {
+			continue
+		}
+		limit, err := q.Limit(ctx, prefix)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get quota for %s: %w", prefix, err)
+		}
+		if limit <= 0 {
+			continue
+		}
+		used, err := quotas.usage.Usage(ctx, prefix)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read usage of %s: %w", prefix, err)
+		}
+		// Shrinking an object is allowed even over quota
+		keyRoom := max(limit-(used-previous), previous)
+		if size > keyRoom {
+			return 0, 0, fmt.Errorf("%w: %s would use %d of %d bytes", ErrQuotaExceeded, prefix, used-previous+size, limit)
+		}
+		room = min(room, keyRoom)
+	}
+
+	if size > previous {
+		if err := quotas.usage.SetSize(ctx, key, size); err != nil {
+			return 0, 0, fmt.Errorf("failed to record object size: %w", err)
+		}
+	}
+	return previous, room, nil
+}
+
+// quotaReader counts the bytes read and fails once there are more than
+// room.
+type quotaReader struct {
+	reader io.Reader
+	key    string
+	room   int64
+	read   int64
+}
+
+func (counted *quotaReader) Read(p []byte) (int, error) {
+	n, err := counted.reader.Read(p)
+	counted.read += int64(n)
+	if counted.read > counted.room {
+		return n, fmt.Errorf("%w: %s is larger than the %d bytes left", ErrQuotaExceeded, counted.key, counted.room)
+	}
+	return n, err
+}
+
+// GetReader delegates to the wrapped provider.
+func (quotas *quotaProvider) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	return Streaming(quotas.Provider).GetReader(ctx, key)
+}
+
+// ListPage delegates to the wrapped provider.
+func (quotas *quotaProvider) ListPage(ctx context.Context, prefix string, opts ListOptions) (*Page, error) {
+	return Paging(quotas.Provider).ListPage(ctx, prefix, opts)
+}
+
+// Delete removes the object and its recorded size.
+func (quotas *quotaProvider) Delete(ctx context.Context, key string) error {
+	if err := quotas.Provider.Delete(ctx, key); err != nil {
+		return err
+	}
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	return quotas.usage.RemoveSize(ctx, key)
+}
+
+// Exists delegates to the wrapped provider.
+func (quotas *quotaProvider) Exists(ctx context.Context, key string) (bool, error) {
+	return Copying(quotas.Provider).Exists(ctx, key)
+}
+
+// Copy copies the object if every quota matching dst has room for it.
+func (quotas *quotaProvider) Copy(ctx context.Context, src, dst string) error {
+	return quotas.transfer(ctx, src, dst, false, func() error {
+		return Copying(quotas.Provider).Copy(ctx, src, dst)
+	})
+}
+
+// Move moves the object if every quota matching dst has room for it. The
+// object stops counting against src's quotas first, so moves within a
+// prefix that is at its quota succeed.
+func (quotas *quotaProvider) Move(ctx context.Context, src, dst string) error {
+	return quotas.transfer(ctx, src, dst, true, func() error {
+		return Copying(quotas.Provider).Move(ctx, src, dst)
+	})
+}
+
+// transfer runs a copy or move of src to dst with dst's size reserved, and
+// records the sizes once it finishes.
+func (quotas *quotaProvider) transfer(ctx context.Context, src, dst string, move bool, transfer func() error) error {
+	quotas.mu.Lock()
+	size, err := quotas.usage.Size(ctx, src)
+	if err != nil {
+		quotas.mu.Unlock()
+		return fmt.Errorf("failed to read object size: %w", err)
+	}
+	if move {
+		if err := quotas.usage.RemoveSize(ctx, src); err != nil {
+			quotas.mu.Unlock()
+			return fmt.Errorf("failed to record object size: %w", err)
+		}
+	}
+	previous, _, err := quotas.reserve(ctx, dst, size)
+	if err != nil && move {
+		_ = quotas.usage.SetSize(ctx, src, size)
+	}
+	quotas.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	transferErr := transfer()
+
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	if transferErr != nil {
+		if previous == 0 {
+			err = quotas.usage.RemoveSize(ctx, dst)
+		} else {
+			err = quotas.usage.SetSize(ctx, dst, previous)
+		}
+		if move && err == nil {
+			err = quotas.usage.SetSize(ctx, src, size)
+		}
+		if err != nil {
+			return fmt.Errorf("%w (and failed to release quota: %v)", transferErr, err)
+		}
+		return transferErr
+	}
+	if err := quotas.usage.SetSize(ctx, dst, size); err != nil {
+		return fmt.Errorf("failed to record object size: %w", err)
+	}
+	return nil
+}
+
+// recount replaces the recorded sizes with those of the stored objects.
+func (quotas *quotaProvider) recount(ctx context.Context) error {
+	keys, err := quotas.Provider.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	sizes := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		data, err := quotas.Provider.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		sizes[key] = int64(len(data))
+	}
+
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	return quotas.usage.Reset(ctx, sizes)
+}
+
+// Snapshot delegates to the wrapped provider.
+func (quotas *quotaProvider) Snapshot(ctx context.Context, path string) error {
+	snapshotter, ok := quotas.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, path)
+}
+
+// Restore delegates to the wrapped provider, then recounts usage.
+func (quotas *quotaProvider) Restore(ctx context.Context, path string) error {
+	snapshotter, ok := quotas.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	if err := snapshotter.Restore(ctx, path); err != nil {
+		return err
+	}
+	return quotas.recount(ctx)
+}
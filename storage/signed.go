@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+var (
+	ErrSigningNotConfigured = chassis.NewError(chassis.CodeFailedPrecondition, "storage URL signing is not configured")
+	ErrUnsupportedMethod    = chassis.NewError(chassis.CodeInvalidArgument, "signed URLs support GET and PUT only")
+	ErrInvalidSignature     = chassis.NewError(chassis.CodePermissionDenied, "invalid storage URL signature")
+	ErrURLExpired           = chassis.NewError(chassis.CodePermissionDenied, "storage URL has expired")
+)
+
+// DefaultSignedURLBase is where signed URLs point unless configured.
+const DefaultSignedURLBase = "/files/"
+
+// URLSigner is implemented by providers that presign URLs for direct
+// access to the backend, such as S3 presigned URLs.
+type URLSigner interface {
+	SignedURL(ctx context.Context, key string, ttl time.Duration, method string) (string, error)
+}
+
+// SignedURL returns a URL that allows method (GET or PUT) on key until ttl
+// has passed, so browsers can download or upload without the app proxying
+// the bytes. A provider that implements URLSigner presigns its own URLs
+// when nothing wraps it; otherwise, e.g. with quotas, the trash or
+// encryption, the URL is HMAC-signed and served by SignedURLHandler.
+func (mod *Module) SignedURL(ctx context.Context, key string, ttl time.Duration, method string) (string, error) {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return "", err
+	}
+	method = strings.ToUpper(method)
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", ErrUnsupportedMethod
+	}
+	if signer, ok := mod.provider.(URLSigner); ok {
+		return signer.SignedURL(ctx, key, ttl, method)
+	}
+	if len(mod.signingKey) == 0 {
+		return "", ErrSigningNotConfigured
+	}
+
+	expires := strconv.FormatInt(mod.now().Add(ttl).Unix(), 10)
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {mod.sign(method, key, expires)},
+	}
+	return strings.TrimSuffix(mod.signedURLBase, "/") + "/" + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+// sign returns the signature of a signed URL.
+func (mod *Module) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, mod.signingKey)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURLHandler serves the URLs made by SignedURL. Mount it at the path
+// of storage.signed_url_base, or let api.Mount do it:
+//
+//	mux.Handle("/files/", storageMod.SignedURLHandler())
+//
+// GET and HEAD download the object with Serve; PUT stores the request body,
+// with its Content-Type when the provider stores metadata.
+func (mod *Module) SignedURLHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		key, ok := strings.CutPrefix(request.URL.Path, mod.signedURLPath())
+		if !ok || key == "" {
+			http.NotFound(writer, request)
+			return
+		}
+
+		method := request.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if method != http.MethodGet && method != http.MethodPut {
+			api.MethodNotAllowed(writer, request)
+			return
+		}
+		if err := mod.verify(method, key, request.URL.Query()); err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+
+		if method == http.MethodGet {
+			mod.Serve(writer, request, key)
+			return
+		}
+		if err := mod.store(request, key); err != nil {
+			mod.app.Logger().Warn("signed upload failed", "key", key, "error", err)
+			api.WriteError(writer, request, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// verify checks the signature and expiry of a signed URL.
+func (mod *Module) verify(method, key string, query url.Values) error {
+	if len(mod.signingKey) == 0 {
+		return ErrSigningNotConfigured
+	}
+	expires := query.Get("expires")
+	signature := query.Get("signature")
+	if !hmac.Equal([]byte(signature), []byte(mod.sign(method, key, expires))) {
+		return ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if mod.now().Unix() > expiresAt {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+// store writes the body of a signed upload to key.
+func (mod *Module) store(request *http.Request, key string) error {
+	ctx := request.Context()
+	contentType := request.Header.Get("Content-Type")
+	if contentType != "" && storesMetadata(mod.provider) {
+		return mod.PutWithMetadata(ctx, key, request.Body, request.ContentLength, Metadata{ContentType: contentType})
+	}
+	return mod.PutReader(ctx, key, request.Body, request.ContentLength)
+}
+
+// signedURLPath is the path part of the signed URL base, ending in "/".
+func (mod *Module) signedURLPath() string {
+	path := mod.signedURLBase
+	if parsed, err := url.Parse(mod.signedURLBase); err == nil {
+		path = parsed.Path
+	}
+	return strings.TrimSuffix(path, "/") + "/"
+}
+
+// Endpoints serves signed URLs at the signed URL base path when signing is
+// configured. Implements chassis.EndpointProvider.
+func (mod *Module) Endpoints() []chassis.Endpoint {
+	return []chassis.Endpoint{{
+		Name:    "storage_files",
+		Path:    mod.signedURLPath(),
+		Handler: mod.SignedURLHandler(),
+		Enabled: len(mod.signingKey) > 0,
+	}}
+}
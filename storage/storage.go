@@ -11,6 +11,74 @@
 //	)
 //	app.Storage().Put(ctx, "files/doc.pdf", data)
 //
+// Keys are "/"-separated paths checked by ValidateKey, so user input such
+// as "../../etc/passwd" fails with ErrInvalidKey instead of escaping the
+// base path.
+//
+// ListPage lists a page at a time, optionally one "directory" level deep:
+//
+//	page, err := storageMod.ListPage(ctx, "photos/", cursor, 50, storage.WithDelimiter("/"))
+//
+// Large files can be streamed instead of loaded into memory. Providers
+// that don't implement StreamingProvider are adapted by buffering:
+//
+//	err := app.Storage().PutReader(ctx, "videos/intro.mp4", request.Body, request.ContentLength)
+//	reader, err := app.Storage().GetReader(ctx, "videos/intro.mp4")
+//	defer reader.Close()
+//
+// Exists, Copy and Move work without round-trips through the caller. The
+// local provider copies atomically and moves with a rename; providers that
+// don't implement CopyingProvider are adapted by streaming:
+//
+//	err := app.Storage().Move(ctx, "uploads/tmp/abc", "docs/contract.pdf")
+//
+// Objects can carry a content type and custom values. Stat describes an
+// object, and Serve writes it as an HTTP response with matching headers:
+//
+//	err := storageMod.PutWithMetadata(ctx, "docs/report.pdf", file, size, storage.Metadata{
+//	    ContentType: "application/pdf",
+//	    Values:      map[string]string{"uploaded_by": userID},
+//	})
+//	info, err := storageMod.Stat(ctx, "docs/report.pdf") // size, mtime, checksum
+//	storageMod.Serve(writer, request, "docs/report.pdf")
+//
+// Uploads:
+//
+// Uploads returns an Uploader that validates user uploads by size and
+// sniffed content type, runs an optional Scanner, stores them under
+// generated keys with their original name and uploader as metadata, and
+// runs hooks such as Thumbnails. Its Handler accepts multipart forms:
+//
+//	uploads := storageMod.Uploads(
+//	    storage.WithMaxUploadSize(5<<20),
+//	    storage.WithAllowedTypes("image/*"),
+//	    storage.WithUploadHook(storage.Thumbnails(256)),
+//	)
+//	mux.Handle("POST /uploads", uploads.Handler())
+//
+// Each stored upload publishes EventFileUploaded with the *Upload.
+//
+// Signed URLs:
+//
+// SignedURL lets a browser download or upload an object directly until the
+// URL expires. Providers that implement URLSigner (S3) presign their own
+// URLs; otherwise the URL is HMAC-signed and served by SignedURLHandler:
+//
+//	storage:
+//	  signing_secret: ${STORAGE_SIGNING_SECRET}
+//	  signed_url_base: https://app.example.com/files/
+//
+//	link, err := app.Storage().SignedURL(ctx, "docs/report.pdf", 15*time.Minute, http.MethodGet)
+//	mux.Handle("/files/", storageMod.SignedURLHandler())
+//
+// Org files:
+//
+// ForOrg returns a view jailed under one org's prefix, and
+// OrgFilesHandler serves it to users with org:read on the org:
+//
+//	err := storageMod.ForOrg("acme").Put(ctx, "reports/q1.csv", data)
+//	mux.Handle("/org-files/", http.StripPrefix("/org-files", authMod.RequireAuth(storageMod.OrgFilesHandler())))
+//
 // Custom provider:
 //
 //	app := chassis.New(
@@ -18,15 +86,87 @@
 //	        storage.New(storage.WithProvider(myS3Provider)),
 //	    ),
 //	)
+//
+// Trash:
+//
+// With the trash enabled, Delete moves objects under TrashPrefix instead
+// of removing them. They can be restored until a periodic sweep purges them
+// after the retention period:
+//
+//	storageMod := storage.New(storage.WithTrash(30 * 24 * time.Hour))
+//	err := storageMod.Delete(ctx, "files/doc.pdf")
+//	err = storageMod.Trash().Restore(ctx, "files/doc.pdf")
+//
+// Or via config.yaml:
+//
+//	storage:
+//	  trash:
+//	    enabled: true
+//	    retention_days: 30
+//	    sweep_interval: 1h
+//
+// Quotas:
+//
+// Quotas cap the bytes stored under key prefixes. A "*" segment matches
+// any one path segment, so "orgs/*/" gives each org its own quota. Put
+// fails with ErrQuotaExceeded when a write would go over, and Usage sums
+// the bytes stored under any prefix:
+//
+//	storageMod := storage.New(
+//	    storage.WithQuota("orgs/*/", 1<<30),
+//	    storage.WithQuotaFunc("users/*/", planLimit), // per-plan limits
+//	)
+//	used, err := storageMod.Usage(ctx, "orgs/acme/")
+//
+// Or via config.yaml (limits in bytes):
+//
+//	storage:
+//	  usage_db_path: ./data/storage.db
+//	  quotas:
+//	    orgs/*/: 1073741824
+//
+// Object sizes are tracked in memory and recounted from the provider at
+// startup unless usage_db_path persists them. Objects stored before quotas
+// were enabled are counted once RecountUsage runs.
+//
+// Encryption:
+//
+// WithEncryption seals every object with its own AES-256-GCM data key,
+// wrapped by a KeyProvider. RotateEncryption re-wraps data keys after the
+// current key changes:
+//
+//	storage:
+//	  encryption:
+//	    current_key: "2026-10"
+//	    keys:
+//	      "2026-10": ${STORAGE_KEY_2026_10} # base64-encoded 32-byte key
+//	      "2026-01": ${STORAGE_KEY_2026_01}
+//
+// Timeouts:
+//
+// The local provider stops as soon as the caller's context is cancelled,
+// between file operations and directory entries, and leaves existing
+// objects untouched. WithTimeouts or storage.timeouts bound reads, writes
+// and listings further:
+//
+//	storage:
+//	  timeouts:
+//	    read: 10s
+//	    write: 1m
+//	    list: 5s
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/talosaether/chassis"
 )
@@ -56,6 +196,29 @@ type Module struct {
 	provider        Provider
 	basePath        string
 	basePathFromOpt bool // true if basePath was set via WithBasePath option
+	wrappers        []func(Provider) Provider
+	app             *chassis.App
+
+	trashEnabled   bool
+	trashRetention time.Duration
+	sweepInterval  time.Duration
+	trash          *Trash
+	stop           chan struct{}
+	stopped        sync.WaitGroup
+
+	quotaRules  []Quota
+	usage       UsageStore
+	usageDBPath string
+	quotas      *quotaProvider
+
+	signingKey    []byte
+	signedURLBase string
+	now           func() time.Time
+
+	encryptionKeys KeyProvider
+	encrypted      *EncryptedProvider
+
+	timeouts Timeouts
 }
 
 // Options configures the storage module.
@@ -63,6 +226,15 @@ type Options struct {
 	Provider        Provider
 	BasePath        string // For local provider, the root directory
 	BasePathFromOpt bool   // true if BasePath was explicitly set
+	Wrappers        []func(Provider) Provider
+	Trash           bool          // move deleted objects to TrashPrefix
+	TrashRetention  time.Duration // how long trashed objects are kept
+	Quotas          []Quota
+	UsageStore      UsageStore  // where object sizes are tracked for quotas
+	SigningKey      []byte      // HMAC key for signed URLs
+	SignedURLBase   string      // where signed URLs point, e.g. https://app.example.com/files/
+	EncryptionKeys  KeyProvider // encrypts objects at rest when set
+	Timeouts        Timeouts    // per-operation timeouts
 }
 
 // Option is a function that configures the storage module.
@@ -83,10 +255,72 @@ func WithBasePath(path string) Option {
 	}
 }
 
+// WithWrapper wraps the provider (custom or default) at Init, e.g. to add
+// encryption. Wrappers are applied in order, so the last one is outermost.
+func WithWrapper(wrap func(Provider) Provider) Option {
+	return func(opts *Options) {
+		opts.Wrappers = append(opts.Wrappers, wrap)
+	}
+}
+
+// WithTrash makes Delete move objects to the trash, where they can be
+// restored until they are purged after retention (zero keeps them forever).
+func WithTrash(retention time.Duration) Option {
+	return func(opts *Options) {
+		opts.Trash = true
+		opts.TrashRetention = retention
+	}
+}
+
+// WithQuota limits the bytes stored under the prefixes matching pattern.
+func WithQuota(pattern string, limit int64) Option {
+	return WithQuotaFunc(pattern, func(ctx context.Context, prefix string) (int64, error) {
+		return limit, nil
+	})
+}
+
+// WithQuotaFunc limits the bytes stored under the prefixes matching
+// pattern to what limit returns for each prefix, e.g. the limit of an org's
+// plan.
+func WithQuotaFunc(pattern string, limit QuotaLimit) Option {
+	return func(opts *Options) {
+		opts.Quotas = append(opts.Quotas, Quota{Pattern: pattern, Limit: limit})
+	}
+}
+
+// WithUsageStore tracks object sizes in store, enabling Usage even without
+// quotas.
+func WithUsageStore(store UsageStore) Option {
+	return func(opts *Options) {
+		opts.UsageStore = store
+	}
+}
+
+// WithURLSigning enables SignedURL with an HMAC key. Signed URLs point to
+// baseURL (DefaultSignedURLBase if empty), where SignedURLHandler serves them.
+func WithURLSigning(key []byte, baseURL string) Option {
+	return func(opts *Options) {
+		opts.SigningKey = key
+		if baseURL != "" {
+			opts.SignedURLBase = baseURL
+		}
+	}
+}
+
+// WithEncryption encrypts objects at rest with data keys wrapped by keys,
+// e.g. NewStaticKeys or a KMS-backed KeyProvider.
+func WithEncryption(keys KeyProvider) Option {
+	return func(opts *Options) {
+		opts.EncryptionKeys = keys
+	}
+}
+
 // New creates a new storage module with the given options.
 func New(opts ...Option) *Module {
 	options := &Options{
-		BasePath: "./data/storage", // Default local path
+		BasePath:       "./data/storage", // Default local path
+		TrashRetention: DefaultTrashRetention,
+		SignedURLBase:  DefaultSignedURLBase,
 	}
 
 	for _, opt := range opts {
@@ -97,6 +331,17 @@ func New(opts ...Option) *Module {
 		basePath:        options.BasePath,
 		basePathFromOpt: options.BasePathFromOpt,
 		provider:        options.Provider,
+		wrappers:        options.Wrappers,
+		trashEnabled:    options.Trash,
+		trashRetention:  options.TrashRetention,
+		sweepInterval:   DefaultTrashSweepInterval,
+		quotaRules:      options.Quotas,
+		usage:           options.UsageStore,
+		signingKey:      options.SigningKey,
+		signedURLBase:   options.SignedURLBase,
+		now:             time.Now,
+		encryptionKeys:  options.EncryptionKeys,
+		timeouts:        options.Timeouts,
 	}
 }
 
@@ -107,6 +352,8 @@ func (mod *Module) Name() string {
 
 // Init initializes the storage module.
 func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
 	// Read base_path from config if not explicitly set via option
 	if !mod.basePathFromOpt {
 		if cfg := app.ConfigData(); cfg != nil {
@@ -115,6 +362,57 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 			}
 		}
 	}
+	if cfg := app.ConfigData(); cfg != nil {
+		if cfg.GetBool("storage.trash.enabled") {
+			mod.trashEnabled = true
+		}
+		if cfg.Get("storage.trash.retention_days") != nil {
+			mod.trashRetention = time.Duration(cfg.GetInt("storage.trash.retention_days")) * 24 * time.Hour
+		}
+		if cfg.Get("storage.trash.sweep_interval") != nil {
+			interval, err := cfg.MustGetDuration("storage.trash.sweep_interval")
+			if err != nil {
+				return err
+			}
+			mod.sweepInterval = interval
+		}
+		quotas := cfg.Section("storage.quotas")
+		for pattern := range quotas {
+			limit := int64(quotas.GetInt(pattern))
+			mod.quotaRules = append(mod.quotaRules, Quota{Pattern: pattern, Limit: func(ctx context.Context, prefix string) (int64, error) {
+				return limit, nil
+			}})
+		}
+		if dbPath := cfg.GetString("storage.usage_db_path"); dbPath != "" {
+			mod.usageDBPath = dbPath
+		}
+		if secret := cfg.GetString("storage.signing_secret"); secret != "" && len(mod.signingKey) == 0 {
+			mod.signingKey = []byte(secret)
+		}
+		if baseURL := cfg.GetString("storage.signed_url_base"); baseURL != "" {
+			mod.signedURLBase = baseURL
+		}
+		for key, timeout := range map[string]*time.Duration{
+			"storage.timeouts.read":  &mod.timeouts.Read,
+			"storage.timeouts.write": &mod.timeouts.Write,
+			"storage.timeouts.list":  &mod.timeouts.List,
+		} {
+			if cfg.Get(key) != nil && *timeout == 0 {
+				parsed, err := cfg.MustGetDuration(key)
+				if err != nil {
+					return err
+				}
+				*timeout = parsed
+			}
+		}
+		if cfg.Get("storage.encryption") != nil && mod.encryptionKeys == nil {
+			keys, err := staticKeysFromConfig(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to load storage encryption keys: %w", err)
+			}
+			mod.encryptionKeys = keys
+		}
+	}
 
 	// If no custom provider, use local filesystem
 	if mod.provider == nil {
@@ -128,32 +426,235 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		app.Logger().Info("storage using custom provider")
 	}
 
+	// Quotas count what is stored, so they go right above the base provider
+	if err := mod.initQuotas(ctx); err != nil {
+		return err
+	}
+
+	// The trash goes below the wrappers so they see the original keys
+	if mod.trashEnabled {
+		mod.trash = &Trash{provider: mod.provider, retention: mod.trashRetention, now: time.Now}
+		mod.provider = &trashProvider{Provider: mod.provider, trash: mod.trash}
+		if mod.sweepInterval > 0 && mod.trashRetention > 0 {
+			mod.stop = make(chan struct{})
+			mod.stopped.Add(1)
+			go mod.sweepLoop()
+		}
+		app.Logger().Info("storage trash enabled", "retention", mod.trashRetention)
+	}
+
+	// Encryption goes above the trash and quotas, which move and count
+	// ciphertext
+	if mod.encryptionKeys != nil {
+		mod.encrypted = NewEncryptedProvider(mod.provider, mod.encryptionKeys)
+		mod.provider = mod.encrypted
+		app.Logger().Info("storage encryption enabled", "key_id", mod.encryptionKeys.CurrentKeyID())
+	}
+
+	for _, wrap := range mod.wrappers {
+		mod.provider = wrap(mod.provider)
+	}
+
 	return nil
 }
 
-// Shutdown cleans up the storage module.
+// initQuotas installs the quota layer when quotas or usage tracking are
+// configured.
+func (mod *Module) initQuotas(ctx context.Context) error {
+	if len(mod.quotaRules) == 0 && mod.usage == nil && mod.usageDBPath == "" {
+		return nil
+	}
+
+	recount := false
+	if mod.usage == nil {
+		if mod.usageDBPath != "" {
+			store, err := NewSQLiteUsageStore(mod.usageDBPath)
+			if err != nil {
+				return fmt.Errorf("failed to open usage store: %w", err)
+			}
+			mod.usage = store
+		} else {
+			mod.usage = NewMemoryUsageStore()
+			recount = true
+		}
+	}
+
+	mod.quotas = &quotaProvider{Provider: mod.provider, usage: mod.usage, quotas: mod.quotaRules}
+	mod.provider = mod.quotas
+	if recount {
+		if err := mod.quotas.recount(ctx); err != nil {
+			return fmt.Errorf("failed to count storage usage: %w", err)
+		}
+	}
+	mod.app.Logger().Info("storage quotas enabled", "quotas", len(mod.quotaRules))
+	return nil
+}
+
+// Shutdown stops the trash sweep, if running, and closes the usage store.
 func (mod *Module) Shutdown(ctx context.Context) error {
-	// Nothing to clean up for basic implementation
+	if mod.stop != nil {
+		close(mod.stop)
+		mod.stopped.Wait()
+		mod.stop = nil
+	}
+	if mod.usage != nil {
+		return mod.usage.Close()
+	}
 	return nil
 }
 
-// Put stores data at the given key.
+// Usage returns the bytes stored under prefix. It fails with
+// ErrUsageNotTracked unless quotas or a usage store are configured.
+func (mod *Module) Usage(ctx context.Context, prefix string) (int64, error) {
+	if mod.quotas == nil {
+		return 0, ErrUsageNotTracked
+	}
+	return mod.usage.Usage(ctx, prefix)
+}
+
+// RecountUsage recounts the size of every stored object, e.g. after objects
+// were written with quotas disabled or behind the module's back.
+func (mod *Module) RecountUsage(ctx context.Context) error {
+	if mod.quotas == nil {
+		return ErrUsageNotTracked
+	}
+	return mod.quotas.recount(ctx)
+}
+
+// RotateEncryption re-wraps every object's data key with the current KEK,
+// including trashed objects, and encrypts objects stored before encryption
+// was enabled. It returns how many objects were rewritten.
+func (mod *Module) RotateEncryption(ctx context.Context) (int, error) {
+	if mod.encrypted == nil {
+		return 0, ErrEncryptionDisabled
+	}
+	rotated, err := mod.encrypted.Rotate(ctx, "")
+	if err != nil || mod.trash == nil {
+		return rotated, err
+	}
+	trashed, err := mod.encrypted.Rotate(ctx, TrashPrefix)
+	return rotated + trashed, err
+}
+
+// Trash returns the trash, or nil unless it is enabled with WithTrash or
+// storage.trash.enabled.
+func (mod *Module) Trash() *Trash {
+	return mod.trash
+}
+
+// sweepLoop purges expired trash every sweep interval until Shutdown.
+func (mod *Module) sweepLoop() {
+	defer mod.stopped.Done()
+	ticker := time.NewTicker(mod.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mod.stop:
+			return
+		case <-ticker.C:
+			purged, err := mod.trash.Sweep(context.Background())
+			if err != nil {
+				mod.app.Logger().Error("storage trash sweep failed", "error", err)
+			} else if purged > 0 {
+				mod.app.Logger().Info("storage trash swept", "purged", purged)
+			}
+		}
+	}
+}
+
+// Snapshot saves all stored objects into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "files"))
+}
+
+// Restore resets stored objects to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "files"))
+}
+
+// Put stores data at the given key. Keys are checked with ValidateKey by
+// every module method.
 func (mod *Module) Put(ctx context.Context, key string, data []byte) error {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Write)
+	defer cancel()
 	return mod.provider.Put(ctx, key, data)
 }
 
 // Get retrieves data for the given key.
 func (mod *Module) Get(ctx context.Context, key string) ([]byte, error) {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Read)
+	defer cancel()
 	return mod.provider.Get(ctx, key)
 }
 
-// Delete removes data at the given key.
+// PutReader streams the data from reader to key. size is the number of
+// bytes reader yields, or -1 if unknown.
+func (mod *Module) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Write)
+	defer cancel()
+	return Streaming(mod.provider).PutReader(ctx, key, reader, size)
+}
+
+// GetReader opens the data at key for streaming. The caller closes it.
+// With a read timeout, reads fail once it expires.
+func (mod *Module) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if mod.timeouts.Read <= 0 {
+		return Streaming(mod.provider).GetReader(ctx, key)
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Read)
+	stream, err := Streaming(mod.provider).GetReader(ctx, key)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return boundReader(ctx, stream, cancel), nil
+}
+
+// Delete removes data at the given key. With the trash enabled, the object
+// is moved to the trash instead.
 func (mod *Module) Delete(ctx context.Context, key string) error {
+	key, err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.Write)
+	defer cancel()
 	return mod.provider.Delete(ctx, key)
 }
 
 // List returns all keys matching the prefix.
 func (mod *Module) List(ctx context.Context, prefix string) ([]string, error) {
+	prefix, err := validatePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, mod.timeouts.List)
+	defer cancel()
 	return mod.provider.List(ctx, prefix)
 }
 
@@ -162,9 +663,35 @@ type LocalProvider struct {
 	basePath string
 }
 
+// path returns the file of key, refusing keys that would resolve outside
+// the base path even when the provider is used without the module.
+func (local *LocalProvider) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("%w: %q escapes the base path", ErrInvalidKey, key)
+	}
+	return filepath.Join(local.basePath, filepath.FromSlash(key)), nil
+}
+
+// uploadTempPrefix starts the names of files being written by PutReader.
+const uploadTempPrefix = ".upload-"
+
 // Put writes data to a file.
 func (local *LocalProvider) Put(ctx context.Context, key string, data []byte) error {
-	fullPath := filepath.Join(local.basePath, key)
+	return local.PutReader(ctx, key, bytes.NewReader(data), int64(len(data)))
+}
+
+// PutReader streams reader into a temporary file next to the target and
+// renames it into place, so readers never see a partial file. A write
+// whose ctx is cancelled, even after the data was copied, leaves the
+// existing object untouched.
+func (local *LocalProvider) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	fullPath, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// Ensure parent directory exists
 	dir := filepath.Dir(fullPath)
@@ -172,53 +699,118 @@ func (local *LocalProvider) Put(ctx context.Context, key string, data []byte) er
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	if err := os.WriteFile(fullPath, data, 0600); err != nil {
+	file, err := os.CreateTemp(dir, uploadTempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	tempPath := file.Name()
+	defer func() { _ = os.Remove(tempPath) }()
+
+	written, err := io.Copy(file, contextReader{ctx: ctx, reader: reader})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("%w: read %d of %d bytes", ErrSizeMismatch, written, size)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return nil
+	if err := os.Rename(tempPath, fullPath); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return local.removeSidecar(key)
 }
 
-// Get reads data from a file.
+// Get reads data from a file, stopping if ctx is cancelled.
 func (local *LocalProvider) Get(ctx context.Context, key string) ([]byte, error) {
-	fullPath := filepath.Clean(filepath.Join(local.basePath, key))
+	file, err := local.GetReader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(contextReader{ctx: ctx, reader: file})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
 
-	data, err := os.ReadFile(fullPath)
+// GetReader opens a file for reading. The file is returned as is, so it
+// can seek; callers stop reading when they are done with ctx.
+func (local *LocalProvider) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	fullPath, err := local.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, os.ErrNotExist
 		}
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
-	return data, nil
+	return file, nil
 }
 
 // Delete removes a file.
 func (local *LocalProvider) Delete(ctx context.Context, key string) error {
-	fullPath := filepath.Join(local.basePath, key)
+	fullPath, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	err := os.Remove(fullPath)
+	err = os.Remove(fullPath)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
-	return nil
+	return local.removeSidecar(key)
 }
 
-// List returns all keys matching the prefix.
+// List returns all keys matching the prefix. The walk stops as soon as
+// ctx is cancelled, so abandoned requests don't traverse large trees.
 func (local *LocalProvider) List(ctx context.Context, prefix string) ([]string, error) {
 	var keys []string
 
+	if prefix != "" && !filepath.IsLocal(filepath.FromSlash(prefix)) {
+		return nil, fmt.Errorf("%w: %q escapes the base path", ErrInvalidKey, prefix)
+	}
 	searchPath := filepath.Join(local.basePath, prefix)
 	searchDir := filepath.Dir(searchPath)
+	if prefix == "" {
+		searchDir = local.basePath
+	}
+	sidecars := filepath.Join(local.basePath, metaDir)
 
 	err := filepath.WalkDir(searchDir, func(filePath string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		if entry.IsDir() {
+		if entry.IsDir() && filePath == sidecars {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), uploadTempPrefix) {
 			return nil
 		}
 
@@ -236,9 +828,94 @@ func (local *LocalProvider) List(ctx context.Context, prefix string) ([]string,
 		return nil
 	})
 
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
 	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
 
 	return keys, nil
 }
+
+// Snapshot copies the whole base directory to path.
+func (local *LocalProvider) Snapshot(ctx context.Context, path string) error {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return copyTree(ctx, local.basePath, path)
+}
+
+// Restore replaces the base directory contents with the snapshot at path.
+func (local *LocalProvider) Restore(ctx context.Context, path string) error {
+	entries, err := os.ReadDir(local.basePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read storage directory: %w", err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(local.basePath, entry.Name())); err != nil {
+			return fmt.Errorf("failed to clear storage directory: %w", err)
+		}
+	}
+	return copyTree(ctx, path, local.basePath)
+}
+
+// copyTree copies all regular files under src into dst, preserving layout.
+func copyTree(ctx context.Context, src, dst string) error {
+	err := filepath.WalkDir(src, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0750)
+		}
+
+		return copyFile(filePath, target)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to copy files: %w", err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(filepath.Clean(dst), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// contextReader stops reading once ctx is done, so abandoned uploads don't
+// keep writing.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (reader contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.reader.Read(p)
+}
@@ -1,10 +1,30 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/permissions"
 )
 
 func TestLocalProvider_PutAndGet(t *testing.T) {
@@ -230,3 +250,1371 @@ func TestModule_Integration(t *testing.T) {
 		t.Error("file should not exist after delete")
 	}
 }
+
+func newTrashModule(t *testing.T, retention time.Duration) (*Module, *time.Time) {
+	t.Helper()
+	mod := New(WithBasePath(t.TempDir()), WithTrash(retention))
+	app := chassis.New(chassis.WithModules(mod))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mod.Trash().now = func() time.Time { return now }
+	return mod, &now
+}
+
+func TestTrash_DeleteAndRestore(t *testing.T) {
+	mod, now := newTrashModule(t, 0)
+	ctx := context.Background()
+
+	_ = mod.Put(ctx, "docs/report.txt", []byte("v1"))
+	if err := mod.Delete(ctx, "docs/report.txt"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := mod.Get(ctx, "docs/report.txt"); !os.IsNotExist(err) {
+		t.Errorf("deleted object should be gone, got %v", err)
+	}
+	if keys, _ := mod.List(ctx, ""); len(keys) != 0 {
+		t.Errorf("List should hide the trash, got %v", keys)
+	}
+
+	// A second deletion of the same key is kept separately
+	*now = now.Add(time.Minute)
+	_ = mod.Put(ctx, "docs/report.txt", []byte("v2"))
+	_ = mod.Delete(ctx, "docs/report.txt")
+
+	trashed, err := mod.Trash().List(ctx)
+	if err != nil {
+		t.Fatalf("Trash List failed: %v", err)
+	}
+	if len(trashed) != 2 || trashed[0].Key != "docs/report.txt" || !trashed[0].DeletedAt.Equal(*now) {
+		t.Fatalf("unexpected trash contents: %+v", trashed)
+	}
+
+	if err := mod.Trash().Restore(ctx, "docs/report.txt"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, _ := mod.Get(ctx, "docs/report.txt"); string(data) != "v2" {
+		t.Errorf("expected the latest version to be restored, got %q", data)
+	}
+	if err := mod.Trash().Restore(ctx, "docs/report.txt"); !errors.Is(err, ErrRestoreConflict) {
+		t.Errorf("expected ErrRestoreConflict, got %v", err)
+	}
+
+	if err := mod.Trash().Purge(ctx, "docs/report.txt"); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if err := mod.Trash().Restore(ctx, "missing.txt"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("expected ErrNotInTrash, got %v", err)
+	}
+	if trashed, _ := mod.Trash().List(ctx); len(trashed) != 0 {
+		t.Errorf("Purge should empty the trash, got %+v", trashed)
+	}
+}
+
+func TestTrash_Sweep(t *testing.T) {
+	mod, now := newTrashModule(t, 24*time.Hour)
+	ctx := context.Background()
+
+	_ = mod.Put(ctx, "old.txt", []byte("old"))
+	_ = mod.Delete(ctx, "old.txt")
+	*now = now.Add(12 * time.Hour)
+	_ = mod.Put(ctx, "new.txt", []byte("new"))
+	_ = mod.Delete(ctx, "new.txt")
+
+	*now = now.Add(13 * time.Hour)
+	purged, err := mod.Trash().Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	trashed, _ := mod.Trash().List(ctx)
+	if purged != 1 || len(trashed) != 1 || trashed[0].Key != "new.txt" {
+		t.Errorf("expected only the expired object to be purged, got %d purged and %+v", purged, trashed)
+	}
+}
+
+func TestTrash_Disabled(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	if err := mod.Trash().Restore(context.Background(), "x"); !errors.Is(err, ErrTrashDisabled) {
+		t.Errorf("expected ErrTrashDisabled, got %v", err)
+	}
+}
+
+func TestQuota_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		prefix  string
+		match   bool
+	}{
+		{"orgs/*/", "orgs/acme/logo.png", "orgs/acme/", true},
+		{"orgs/*/", "orgs/acme/docs/a.txt", "orgs/acme/", true},
+		{"orgs/*/", "orgs/logo.png", "", false},
+		{"orgs/*/", "users/1/a.txt", "", false},
+		{"orgs/*/files/", "orgs/acme/files/a.txt", "orgs/acme/files/", true},
+		{"orgs/*/files/", "orgs/acme/logs/a.txt", "", false},
+		{"uploads/", "uploads/a.txt", "uploads/", true},
+		{"", "anything", "", true},
+	}
+	for _, tt := range tests {
+		prefix, ok := Quota{Pattern: tt.pattern}.match(tt.key)
+		if ok != tt.match || prefix != tt.prefix {
+			t.Errorf("match(%q, %q) = %q, %v; want %q, %v", tt.pattern, tt.key, prefix, ok, tt.prefix, tt.match)
+		}
+	}
+}
+
+func TestQuota_Enforced(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()), WithTrash(0), WithQuota("orgs/*/", 10))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := mod.Put(ctx, "orgs/acme/a.txt", []byte("123456")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := mod.Put(ctx, "orgs/acme/b.txt", []byte("12345")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if chassis.ErrorCodeOf(ErrQuotaExceeded) != chassis.CodeResourceExhausted {
+		t.Error("ErrQuotaExceeded should be resource_exhausted")
+	}
+	if _, err := mod.Get(ctx, "orgs/acme/b.txt"); !os.IsNotExist(err) {
+		t.Errorf("rejected object should not be stored, got %v", err)
+	}
+
+	// Overwrites count the difference, and other orgs have their own quota
+	if err := mod.Put(ctx, "orgs/acme/a.txt", []byte("1234567890")); err != nil {
+		t.Errorf("overwrite within quota failed: %v", err)
+	}
+	if err := mod.Put(ctx, "orgs/globex/a.txt", []byte("1234567890")); err != nil {
+		t.Errorf("another org's quota should be separate: %v", err)
+	}
+	if err := mod.Put(ctx, "public/big.txt", make([]byte, 100)); err != nil {
+		t.Errorf("keys without a quota should be unlimited: %v", err)
+	}
+
+	if used, err := app.Storage().Usage(ctx, "orgs/acme/"); err != nil || used != 10 {
+		t.Errorf("expected 10 bytes used by acme, got %d (%v)", used, err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/"); used != 20 {
+		t.Errorf("expected 20 bytes under orgs/, got %d", used)
+	}
+
+	// Trashed objects stop counting, and restoring them is checked again
+	if err := mod.Delete(ctx, "orgs/acme/a.txt"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/acme/"); used != 0 {
+		t.Errorf("expected deleted objects to free the quota, got %d", used)
+	}
+	if err := mod.Put(ctx, "orgs/acme/c.txt", []byte("12345")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := mod.Trash().Restore(ctx, "orgs/acme/a.txt"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected restore to be over quota, got %v", err)
+	}
+}
+
+func TestQuota_FromConfigAndPersisted(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	configYAML := "storage:\n  base_path: " + filepath.Join(dir, "files") + "\n  usage_db_path: " + filepath.Join(dir, "storage.db") + "\n  quotas:\n    orgs/*/: 8\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	mod := New()
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	if err := mod.Put(ctx, "orgs/acme/a.txt", []byte("12345")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	_ = app.Shutdown(ctx)
+
+	mod = New()
+	app = chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+	if used, err := mod.Usage(ctx, "orgs/acme/"); err != nil || used != 5 {
+		t.Errorf("expected usage to persist, got %d (%v)", used, err)
+	}
+	if err := mod.Put(ctx, "orgs/acme/b.txt", []byte("12345")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestQuota_RecountAndUntracked(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	provider := &LocalProvider{basePath: dir}
+	_ = provider.Put(ctx, "orgs/acme/old.txt", []byte("1234"))
+
+	// Memory usage is counted from the provider at startup
+	mod := New(WithBasePath(dir), WithQuota("orgs/*/", 100))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+	if used, _ := mod.Usage(ctx, ""); used != 4 {
+		t.Errorf("expected existing objects to be counted, got %d", used)
+	}
+
+	_ = provider.Put(ctx, "orgs/acme/direct.txt", []byte("123"))
+	if err := mod.RecountUsage(ctx); err != nil {
+		t.Fatalf("RecountUsage failed: %v", err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/acme/"); used != 7 {
+		t.Errorf("expected 7 bytes after recount, got %d", used)
+	}
+
+	plain := New(WithBasePath(t.TempDir()))
+	plainApp := chassis.New(chassis.WithModules(plain))
+	defer func() { _ = plainApp.Shutdown(ctx) }()
+	if _, err := plain.Usage(ctx, ""); !errors.Is(err, ErrUsageNotTracked) {
+		t.Errorf("expected ErrUsageNotTracked, got %v", err)
+	}
+}
+
+func TestLocalProvider_Streaming(t *testing.T) {
+	tmpDir := t.TempDir()
+	provider := &LocalProvider{basePath: tmpDir}
+	ctx := context.Background()
+
+	data := strings.Repeat("large file ", 10000)
+	if err := provider.PutReader(ctx, "videos/intro.mp4", strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutReader failed: %v", err)
+	}
+	reader, err := provider.GetReader(ctx, "videos/intro.mp4")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(got) != data {
+		t.Errorf("streamed data differs: got %d bytes, want %d", len(got), len(data))
+	}
+
+	// A short read stores nothing and leaves the old object in place
+	err = provider.PutReader(ctx, "videos/intro.mp4", strings.NewReader("short"), 100)
+	if !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+	if stored, _ := provider.Get(ctx, "videos/intro.mp4"); string(stored) != data {
+		t.Error("a failed PutReader should not replace the object")
+	}
+	keys, _ := provider.List(ctx, "videos/")
+	if len(keys) != 1 {
+		t.Errorf("expected no temporary files to be listed, got %v", keys)
+	}
+	entries, _ := os.ReadDir(filepath.Join(tmpDir, "videos"))
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be removed, got %d entries", len(entries))
+	}
+
+	if _, err := provider.GetReader(ctx, "missing"); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+// bytesProvider is a non-streaming provider kept in memory.
+type bytesProvider struct {
+	objects map[string][]byte
+}
+
+func (provider *bytesProvider) Put(ctx context.Context, key string, data []byte) error {
+	provider.objects[key] = data
+	return nil
+}
+
+func (provider *bytesProvider) Get(ctx context.Context, key string) ([]byte, error) {
+	data, ok := provider.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (provider *bytesProvider) Delete(ctx context.Context, key string) error {
+	delete(provider.objects, key)
+	return nil
+}
+
+func (provider *bytesProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range provider.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func TestModule_StreamingAdaptsProviders(t *testing.T) {
+	provider := &bytesProvider{objects: make(map[string][]byte)}
+	mod := New(WithProvider(provider), WithTrash(0))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := app.Storage().PutReader(ctx, "docs/a.txt", strings.NewReader("hello"), -1); err != nil {
+		t.Fatalf("PutReader failed: %v", err)
+	}
+	if string(provider.objects["docs/a.txt"]) != "hello" {
+		t.Errorf("expected the adapter to Put the data, got %q", provider.objects["docs/a.txt"])
+	}
+	reader, err := app.Storage().GetReader(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(got) != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+	if err := mod.PutReader(ctx, "docs/b.txt", strings.NewReader("hi"), 5); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+
+	// The trash moves objects through the streaming adapter too
+	if err := mod.Delete(ctx, "docs/a.txt"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := mod.Trash().Restore(ctx, "docs/a.txt"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, _ := mod.Get(ctx, "docs/a.txt"); string(data) != "hello" {
+		t.Errorf("expected the restored object, got %q", data)
+	}
+}
+
+func TestQuota_StreamingUnknownSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	mod := New(WithBasePath(tmpDir), WithQuota("orgs/*/", 10))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := mod.PutReader(ctx, "orgs/acme/a.txt", strings.NewReader("12345"), 5); err != nil {
+		t.Fatalf("PutReader failed: %v", err)
+	}
+	if err := mod.PutReader(ctx, "orgs/acme/b.txt", strings.NewReader("123456"), 6); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected a known size over quota to be rejected, got %v", err)
+	}
+	if err := mod.PutReader(ctx, "orgs/acme/b.txt", strings.NewReader("123456"), -1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected an unknown size over quota to be cut off, got %v", err)
+	}
+	if _, err := mod.Get(ctx, "orgs/acme/b.txt"); !os.IsNotExist(err) {
+		t.Errorf("cut off upload should not be stored, got %v", err)
+	}
+	if err := mod.PutReader(ctx, "orgs/acme/b.txt", strings.NewReader("1234"), -1); err != nil {
+		t.Errorf("upload within quota failed: %v", err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/acme/"); used != 9 {
+		t.Errorf("expected 9 bytes used, got %d", used)
+	}
+}
+
+func TestLocalProvider_Metadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	provider := &LocalProvider{basePath: tmpDir}
+	ctx := context.Background()
+
+	err := provider.PutWithMetadata(ctx, "docs/report", strings.NewReader("%PDF-1.7"), 8, Metadata{
+		ContentType: "application/pdf",
+		Values:      map[string]string{"uploaded_by": "user-1"},
+	})
+	if err != nil {
+		t.Fatalf("PutWithMetadata failed: %v", err)
+	}
+	info, err := provider.Stat(ctx, "docs/report")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != 8 || info.ContentType != "application/pdf" || info.Values["uploaded_by"] != "user-1" ||
+		info.Checksum != Checksum([]byte("%PDF-1.7")) || info.ModTime.IsZero() {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if keys, _ := provider.List(ctx, ""); len(keys) != 1 || keys[0] != "docs/report" {
+		t.Errorf("sidecars should not be listed, got %v", keys)
+	}
+
+	// A plain Put clears the metadata; the content type is then detected
+	_ = provider.Put(ctx, "docs/report", []byte("<html><body>hi</body></html>"))
+	info, _ = provider.Stat(ctx, "docs/report")
+	if info.ContentType != "text/html; charset=utf-8" || info.Values != nil || info.Checksum != Checksum([]byte("<html><body>hi</body></html>")) {
+		t.Errorf("expected detected metadata after Put, got %+v", info)
+	}
+	_ = provider.Put(ctx, "styles/site.css", []byte("body {}"))
+	if info, _ := provider.Stat(ctx, "styles/site.css"); info.ContentType != "text/css; charset=utf-8" {
+		t.Errorf("expected the content type from the extension, got %q", info.ContentType)
+	}
+
+	_ = provider.PutWithMetadata(ctx, "docs/report", strings.NewReader("x"), 1, Metadata{ContentType: "text/plain"})
+	_ = provider.Delete(ctx, "docs/report")
+	if _, err := os.Stat(provider.sidecarPath("docs/report")); !os.IsNotExist(err) {
+		t.Error("Delete should remove the sidecar")
+	}
+	if _, err := provider.Stat(ctx, "docs/report"); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestModule_MetadataAndServe(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()), WithTrash(0), WithQuota("orgs/*/", 100))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	meta := Metadata{ContentType: "application/json", Values: map[string]string{"version": "2"}}
+	if err := mod.PutWithMetadata(ctx, "orgs/acme/data", strings.NewReader(`{"a":1}`), 7, meta); err != nil {
+		t.Fatalf("PutWithMetadata failed: %v", err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/acme/"); used != 7 {
+		t.Errorf("expected metadata puts to count against quotas, got %d", used)
+	}
+
+	// Metadata survives a trip through the trash
+	_ = mod.Delete(ctx, "orgs/acme/data")
+	if err := mod.Trash().Restore(ctx, "orgs/acme/data"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	info, err := mod.Stat(ctx, "orgs/acme/data")
+	if err != nil || info.ContentType != "application/json" || info.Values["version"] != "2" {
+		t.Fatalf("expected metadata to be restored, got %+v (%v)", info, err)
+	}
+
+	recorder := httptest.NewRecorder()
+	mod.Serve(recorder, httptest.NewRequest(http.MethodGet, "/files/data", nil), "orgs/acme/data")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"a":1}` {
+		t.Fatalf("unexpected response: %d %q", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected the stored content type, got %q", contentType)
+	}
+	etag := recorder.Header().Get("ETag")
+	if etag != `"`+info.Checksum+`"` {
+		t.Errorf("expected the checksum as ETag, got %q", etag)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/files/data", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	mod.Serve(recorder, request, "orgs/acme/data")
+	if recorder.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mod.Serve(recorder, httptest.NewRequest(http.MethodGet, "/files/missing", nil), "missing")
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", recorder.Code)
+	}
+}
+
+func TestModule_MetadataUnsupported(t *testing.T) {
+	provider := &bytesProvider{objects: map[string][]byte{"notes.txt": []byte("hello")}}
+	mod := New(WithProvider(provider))
+	ctx := context.Background()
+
+	info, err := mod.Stat(ctx, "notes.txt")
+	if err != nil || info.Size != 5 || info.ContentType != "text/plain; charset=utf-8" || info.Checksum != Checksum([]byte("hello")) {
+		t.Errorf("expected Stat to fall back to reading the object, got %+v (%v)", info, err)
+	}
+	err = mod.PutWithMetadata(ctx, "notes.txt", strings.NewReader("x"), 1, Metadata{ContentType: "text/plain"})
+	if !errors.Is(err, ErrMetadataNotSupported) {
+		t.Errorf("expected ErrMetadataNotSupported, got %v", err)
+	}
+}
+
+func TestModule_SignedURLs(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()), WithURLSigning([]byte("secret"), "https://app.example.com/files/"), WithQuota("orgs/*/", 10))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+	handler := mod.SignedURLHandler()
+
+	do := func(method, link string, body string, contentType string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, link, strings.NewReader(body))
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	upload, err := app.Storage().SignedURL(ctx, "orgs/acme/my report.txt", time.Minute, "put")
+	if err != nil {
+		t.Fatalf("SignedURL failed: %v", err)
+	}
+	if !strings.HasPrefix(upload, "https://app.example.com/files/orgs/acme/my%20report.txt?") {
+		t.Errorf("unexpected URL: %s", upload)
+	}
+	if recorder := do(http.MethodPut, upload, "hello", "text/markdown"); recorder.Code != http.StatusNoContent {
+		t.Fatalf("signed upload failed: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if info, _ := mod.Stat(ctx, "orgs/acme/my report.txt"); info == nil || info.ContentType != "text/markdown" {
+		t.Errorf("expected the upload's content type to be stored, got %+v", info)
+	}
+	if recorder := do(http.MethodPut, upload, "way too large", ""); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("expected quotas to apply to signed uploads, got %d", recorder.Code)
+	}
+
+	download, _ := mod.SignedURL(ctx, "orgs/acme/my report.txt", time.Minute, http.MethodGet)
+	recorder := do(http.MethodGet, download, "", "")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "hello" || recorder.Header().Get("Content-Type") != "text/markdown" {
+		t.Errorf("signed download failed: %d %q %q", recorder.Code, recorder.Body.String(), recorder.Header().Get("Content-Type"))
+	}
+	if recorder := do(http.MethodHead, download, "", ""); recorder.Code != http.StatusOK {
+		t.Errorf("HEAD should be allowed by GET URLs, got %d", recorder.Code)
+	}
+
+	// URLs are bound to their method, key and expiry
+	if recorder := do(http.MethodPut, download, "overwrite", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("a GET URL must not allow PUT, got %d", recorder.Code)
+	}
+	tampered := strings.Replace(download, "my%20report.txt", "other.txt", 1)
+	if recorder := do(http.MethodGet, tampered, "", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected a tampered URL to be rejected, got %d", recorder.Code)
+	}
+	mod.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	recorder = do(http.MethodGet, download, "", "")
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), "expired") {
+		t.Errorf("expected an expired URL to be rejected, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if _, err := mod.SignedURL(ctx, "a.txt", time.Minute, http.MethodDelete); !errors.Is(err, ErrUnsupportedMethod) {
+		t.Errorf("expected ErrUnsupportedMethod, got %v", err)
+	}
+	if endpoints := mod.Endpoints(); len(endpoints) != 1 || endpoints[0].Path != "/files/" || !endpoints[0].Enabled {
+		t.Errorf("unexpected endpoints: %+v", endpoints)
+	}
+}
+
+// presigningProvider presigns URLs like S3.
+type presigningProvider struct {
+	bytesProvider
+}
+
+func (provider *presigningProvider) SignedURL(ctx context.Context, key string, ttl time.Duration, method string) (string, error) {
+	return "https://bucket.s3.example.com/" + key + "?X-Amz-Expires=" + strconv.Itoa(int(ttl.Seconds())), nil
+}
+
+func TestModule_SignedURLProviders(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := New(WithBasePath(t.TempDir())).SignedURL(ctx, "a.txt", time.Minute, http.MethodGet); !errors.Is(err, ErrSigningNotConfigured) {
+		t.Errorf("expected ErrSigningNotConfigured, got %v", err)
+	}
+	if endpoints := New().Endpoints(); endpoints[0].Enabled {
+		t.Error("the signed URL endpoint should be disabled without a signing key")
+	}
+
+	provider := &presigningProvider{bytesProvider{objects: make(map[string][]byte)}}
+	link, err := New(WithProvider(provider)).SignedURL(ctx, "a.txt", time.Minute, http.MethodGet)
+	if err != nil || link != "https://bucket.s3.example.com/a.txt?X-Amz-Expires=60" {
+		t.Errorf("expected the provider to presign, got %q (%v)", link, err)
+	}
+
+	// Layers that must see the bytes disable presigning
+	mod := New(WithProvider(provider), WithTrash(0), WithURLSigning([]byte("secret"), ""))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+	link, err = mod.SignedURL(ctx, "a.txt", time.Minute, http.MethodGet)
+	if err != nil || !strings.HasPrefix(link, "/files/a.txt?") {
+		t.Errorf("expected an HMAC-signed URL, got %q (%v)", link, err)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	valid := map[string]string{
+		"docs/report.pdf":     "docs/report.pdf",
+		"docs//report.pdf":    "docs/report.pdf",
+		"./docs/./report.pdf": "docs/report.pdf",
+		"docs/":               "docs",
+		"orgs/acme/..hidden":  "orgs/acme/..hidden",
+		"naïve café.txt":      "naïve café.txt",
+		"docs/.meta/a.json":   "docs/.meta/a.json",
+		".trashed/a.txt":      ".trashed/a.txt",
+	}
+	for key, want := range valid {
+		got, err := ValidateKey(key)
+		if err != nil || got != want {
+			t.Errorf("ValidateKey(%q) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/",
+		"./",
+		"/etc/passwd",
+		"../../etc/passwd",
+		"docs/../../secret",
+		"docs/..",
+		`docs\..\secret`,
+		"docs/\x00.txt",
+		"docs/\nname",
+		"\xff\xfe",
+		strings.Repeat("a", MaxKeyLength+1),
+		".meta/docs/report.pdf.json",
+		"./.meta",
+		TrashPrefix + "20260101T000000.000000000Z/docs/report.pdf",
+		".trash",
+	}
+	for _, key := range invalid {
+		if _, err := ValidateKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ValidateKey(%q) should fail with ErrInvalidKey, got %v", key, err)
+		}
+	}
+	if chassis.ErrorCodeOf(ErrInvalidKey) != chassis.CodeInvalidArgument {
+		t.Error("ErrInvalidKey should be invalid_argument")
+	}
+}
+
+func TestModule_RejectsPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	basePath := filepath.Join(root, "storage")
+	secret := filepath.Join(root, "secret.txt")
+	_ = os.WriteFile(secret, []byte("secret"), 0600)
+
+	mod := New(WithBasePath(basePath))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if _, err := mod.Get(ctx, "../secret.txt"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+	if err := mod.Put(ctx, "../secret.txt", []byte("pwned")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+	if err := mod.Delete(ctx, "/"+secret); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+	if _, err := mod.List(ctx, "../"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+	if data, _ := os.ReadFile(secret); string(data) != "secret" {
+		t.Error("files outside the base path must not be touched")
+	}
+
+	// Metadata sidecars and the trash are the module's own
+	if err := mod.Put(ctx, ".meta/docs/a.txt.json", []byte(`{"checksum":"forged"}`)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey for a sidecar key, got %v", err)
+	}
+	if err := mod.Put(ctx, TrashPrefix+"20260101T000000.000000000Z/docs/a.txt", []byte("planted")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey for a trash key, got %v", err)
+	}
+
+	// Keys are normalized before reaching the provider
+	if err := mod.Put(ctx, "docs//./a.txt", []byte("a")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if keys, _ := mod.List(ctx, "docs/"); len(keys) != 1 || keys[0] != "docs/a.txt" {
+		t.Errorf("expected the normalized key, got %v", keys)
+	}
+
+	// The local provider refuses escaping keys on its own too
+	provider := &LocalProvider{basePath: basePath}
+	if _, err := provider.Get(ctx, "../secret.txt"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected LocalProvider to refuse the key, got %v", err)
+	}
+}
+
+func FuzzValidateKey(f *testing.F) {
+	for _, seed := range []string{"docs/a.txt", "../etc/passwd", "a/../../b", "/abs", "a//b/./c", `a\b`, "..", ".../x", "a/\x00", ""} {
+		f.Add(seed)
+	}
+	basePath := f.TempDir()
+	provider := &LocalProvider{basePath: basePath}
+
+	f.Fuzz(func(t *testing.T, key string) {
+		normalized, err := ValidateKey(key)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("unexpected error type: %v", err)
+			}
+			return
+		}
+		if again, err := ValidateKey(normalized); err != nil || again != normalized {
+			t.Fatalf("ValidateKey is not idempotent: %q -> %q -> %q, %v", key, normalized, again, err)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(normalized)) {
+			t.Fatalf("ValidateKey(%q) = %q, which is not local", key, normalized)
+		}
+		fullPath, err := provider.path(normalized)
+		if err != nil {
+			t.Fatalf("LocalProvider refused a valid key %q: %v", normalized, err)
+		}
+		relPath, err := filepath.Rel(basePath, fullPath)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			t.Fatalf("key %q resolves outside the base path: %s", key, fullPath)
+		}
+	})
+}
+
+func TestEncryptedProvider_EncryptAndRotate(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	base := &bytesProvider{objects: map[string][]byte{"legacy.txt": []byte("plaintext")}}
+	keys, err := NewStaticKeys("2025", map[string][]byte{"2025": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	encrypted := NewEncryptedProvider(base, keys)
+	if err := encrypted.Put(ctx, "secret.txt", []byte("top secret")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if stored := base.objects["secret.txt"]; bytes.Contains(stored, []byte("top secret")) || !bytes.HasPrefix(stored, []byte(envelopeMagic)) {
+		t.Errorf("expected an encrypted envelope, got %q", stored)
+	}
+	if data, err := encrypted.Get(ctx, "secret.txt"); err != nil || string(data) != "top secret" {
+		t.Errorf("expected plaintext back, got %q (%v)", data, err)
+	}
+	if data, err := encrypted.Get(ctx, "legacy.txt"); err != nil || string(data) != "plaintext" {
+		t.Errorf("expected unencrypted objects to be read as is, got %q (%v)", data, err)
+	}
+
+	tampered := bytes.Clone(base.objects["secret.txt"])
+	tampered[len(tampered)-1] ^= 1
+	base.objects["tampered.txt"] = tampered
+	if _, err := encrypted.Get(ctx, "tampered.txt"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed, got %v", err)
+	}
+	delete(base.objects, "tampered.txt")
+
+	rotatedKeys, err := NewStaticKeys("2026", map[string][]byte{"2025": oldKey, "2026": newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted = NewEncryptedProvider(base, rotatedKeys)
+	if rotated, err := encrypted.Rotate(ctx, ""); err != nil || rotated != 2 {
+		t.Fatalf("expected 2 objects rotated, got %d (%v)", rotated, err)
+	}
+	if rotated, err := encrypted.Rotate(ctx, ""); err != nil || rotated != 0 {
+		t.Errorf("expected nothing left to rotate, got %d (%v)", rotated, err)
+	}
+
+	newOnly, err := NewStaticKeys("2026", map[string][]byte{"2026": newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted = NewEncryptedProvider(base, newOnly)
+	for key, want := range map[string]string{"secret.txt": "top secret", "legacy.txt": "plaintext"} {
+		if data, err := encrypted.Get(ctx, key); err != nil || string(data) != want {
+			t.Errorf("expected %s readable without the old key, got %q (%v)", key, data, err)
+		}
+	}
+	if _, err := NewEncryptedProvider(base, keys).Get(ctx, "secret.txt"); !errors.Is(err, ErrEncryptionKeyUnknown) {
+		t.Errorf("expected ErrEncryptionKeyUnknown, got %v", err)
+	}
+
+	if _, err := NewStaticKeys("missing", map[string][]byte{"2026": newKey}); !errors.Is(err, ErrEncryptionKeyUnknown) {
+		t.Errorf("expected ErrEncryptionKeyUnknown, got %v", err)
+	}
+	if _, err := NewStaticKeys("short", map[string][]byte{"short": []byte("too short")}); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("expected ErrInvalidEncryptionKey, got %v", err)
+	}
+}
+
+func TestModule_EncryptionFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	configYAML := "storage:\n  base_path: " + filepath.Join(dir, "files") + "\n  trash:\n    enabled: true\n  encryption:\n    current_key: k1\n    keys:\n      k1: " + key + "\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	mod := New()
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	if err := mod.Put(ctx, "docs/readme", []byte("hello, world")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, "files", "docs", "readme"))
+	if err != nil || bytes.Contains(stored, []byte("hello")) {
+		t.Errorf("expected the file to be encrypted, got %q (%v)", stored, err)
+	}
+	info, err := mod.Stat(ctx, "docs/readme")
+	if err != nil || info.Size != 12 || info.ContentType != "text/plain; charset=utf-8" || info.Checksum != Checksum([]byte("hello, world")) {
+		t.Errorf("expected Stat to describe the plaintext, got %+v (%v)", info, err)
+	}
+
+	if err := mod.Put(ctx, "docs/old", []byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mod.Delete(ctx, "docs/old"); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, err := mod.RotateEncryption(ctx); err != nil || rotated != 0 {
+		t.Errorf("expected nothing to rotate, got %d (%v)", rotated, err)
+	}
+	if err := mod.Trash().Restore(ctx, "docs/old"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if data, err := mod.Get(ctx, "docs/old"); err != nil || string(data) != "bye" {
+		t.Errorf("expected the restored object to decrypt, got %q (%v)", data, err)
+	}
+
+	plain := New(WithBasePath(t.TempDir()))
+	plainApp := chassis.New(chassis.WithModules(plain))
+	defer func() { _ = plainApp.Shutdown(ctx) }()
+	if _, err := plain.RotateEncryption(ctx); !errors.Is(err, ErrEncryptionDisabled) {
+		t.Errorf("expected ErrEncryptionDisabled, got %v", err)
+	}
+}
+
+func TestModule_ListPage(t *testing.T) {
+	keys := []string{"a.txt", "photos/2024/x.jpg", "photos/2024/y.jpg", "photos/cat.jpg", "photos/dog.jpg", "tmp/old.txt", "z.txt"}
+	providers := map[string]Option{
+		"local": WithBasePath(t.TempDir()),
+		"list":  WithProvider(&bytesProvider{objects: map[string][]byte{}}),
+	}
+	for name, opt := range providers {
+		t.Run(name, func(t *testing.T) {
+			mod := New(opt, WithTrash(time.Hour))
+			app := chassis.New(chassis.WithModules(mod))
+			defer func() { _ = app.Shutdown(context.Background()) }()
+			ctx := context.Background()
+			for _, key := range keys {
+				if err := mod.Put(ctx, key, []byte(key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := mod.Delete(ctx, "tmp/old.txt"); err != nil {
+				t.Fatal(err)
+			}
+
+			var all []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				page, err := mod.ListPage(ctx, "", cursor, 2)
+				if err != nil || pages > 5 {
+					t.Fatalf("ListPage failed: %v (page %d)", err, pages)
+				}
+				all = append(all, page.Keys...)
+				if !page.HasMore {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			if strings.Join(all, ",") != "a.txt,photos/2024/x.jpg,photos/2024/y.jpg,photos/cat.jpg,photos/dog.jpg,z.txt" {
+				t.Errorf("unexpected keys: %v", all)
+			}
+
+			page, err := mod.ListPage(ctx, "", "", 10, WithDelimiter("/"))
+			if err != nil || strings.Join(page.Keys, ",") != "a.txt,z.txt" || strings.Join(page.Prefixes, ",") != "photos/" || page.HasMore {
+				t.Errorf("unexpected root listing: %+v (%v)", page, err)
+			}
+			page, err = mod.ListPage(ctx, "photos/", "", 2, WithDelimiter("/"))
+			if err != nil || strings.Join(page.Prefixes, ",") != "photos/2024/" || strings.Join(page.Keys, ",") != "photos/cat.jpg" || !page.HasMore {
+				t.Fatalf("unexpected first page: %+v (%v)", page, err)
+			}
+			page, err = mod.ListPage(ctx, "photos/", page.NextCursor, 2, WithDelimiter("/"))
+			if err != nil || len(page.Prefixes) != 0 || strings.Join(page.Keys, ",") != "photos/dog.jpg" || page.HasMore {
+				t.Errorf("unexpected second page: %+v (%v)", page, err)
+			}
+
+			if _, err := mod.ListPage(ctx, "", "not base64!", 2); !errors.Is(err, pagination.ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor, got %v", err)
+			}
+			if _, err := mod.ListPage(ctx, "../", "", 2); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("expected ErrInvalidKey, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantStorage(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	tenant := mod.Tenant()
+	acme := chassis.WithTenant(context.Background(), "acme")
+	globex := chassis.WithTenant(context.Background(), "globex")
+
+	if err := tenant.Put(acme, "invoices/1.pdf", []byte("acme")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := tenant.Put(globex, "invoices/1.pdf", []byte("globex")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if data, err := tenant.Get(acme, "invoices/1.pdf"); err != nil || string(data) != "acme" {
+		t.Errorf("expected acme's object, got %q (%v)", data, err)
+	}
+	if data, err := mod.Get(context.Background(), "orgs/globex/invoices/1.pdf"); err != nil || string(data) != "globex" {
+		t.Errorf("expected globex's object under its prefix, got %q (%v)", data, err)
+	}
+
+	keys, err := tenant.List(acme, "invoices/")
+	if err != nil || strings.Join(keys, ",") != "invoices/1.pdf" {
+		t.Errorf("expected acme's keys relative to its prefix, got %v (%v)", keys, err)
+	}
+
+	if _, err := tenant.Get(acme, "../globex/invoices/1.pdf"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey climbing out of the org prefix, got %v", err)
+	}
+	if err := tenant.Put(context.Background(), "x", nil); !errors.Is(err, chassis.ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+	if _, err := tenant.Get(chassis.WithTenant(context.Background(), "a/b"), "x"); !errors.Is(err, chassis.ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant for an org ID with a slash, got %v", err)
+	}
+
+	if err := tenant.Delete(acme, "invoices/1.pdf"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := tenant.Get(globex, "invoices/1.pdf"); err != nil {
+		t.Errorf("expected globex's object to remain, got %v", err)
+	}
+}
+
+func TestForOrg(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := chassis.WithTenant(context.Background(), "globex")
+
+	acme := mod.ForOrg("acme")
+	if err := acme.Put(ctx, "reports/q1.csv", []byte("a,b")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if data, err := mod.Get(ctx, "orgs/acme/reports/q1.csv"); err != nil || string(data) != "a,b" {
+		t.Errorf("expected the object under acme's prefix whatever the tenant, got %q (%v)", data, err)
+	}
+	if ok, err := acme.Exists(ctx, "reports/q1.csv"); err != nil || !ok {
+		t.Errorf("expected the object to exist in the view, got %v (%v)", ok, err)
+	}
+	if _, err := acme.Get(ctx, "../globex/x"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey climbing out of the org prefix, got %v", err)
+	}
+	for _, orgID := range []string{"a/b", ".."} {
+		if err := mod.ForOrg(orgID).Put(ctx, "x", nil); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("expected ErrInvalidKey for org ID %q, got %v", orgID, err)
+		}
+	}
+}
+
+func TestForUser(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := mod.ForUser("ann").Put(ctx, "avatar.png", []byte("png")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := mod.ForUser("bob").Put(ctx, "avatar.png", []byte("bob")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if data, err := mod.Get(ctx, "users/ann/avatar.png"); err != nil || string(data) != "png" {
+		t.Errorf("expected the object under ann's prefix, got %q (%v)", data, err)
+	}
+	if err := mod.ForUser("a/b").Put(ctx, "x", nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey for a nested user ID, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	bundle := chassis.NewZipExport(&buf)
+	if err := mod.ExportUser(ctx, "ann", bundle.Dir("storage")); err != nil {
+		t.Fatalf("ExportUser failed: %v", err)
+	}
+	if files := bundle.Files(); len(files) != 1 || files[0] != "storage/files/avatar.png" {
+		t.Errorf("expected only ann's objects, got %v", files)
+	}
+
+	actions, err := mod.PlanUserCleanup(ctx, "ann")
+	if err != nil || len(actions) != 1 || actions[0].Resource != "users/ann/avatar.png" {
+		t.Fatalf("unexpected plan %+v (%v)", actions, err)
+	}
+	if err := actions[0].Apply(ctx); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if ok, _ := mod.Exists(ctx, "users/ann/avatar.png"); ok {
+		t.Error("expected ann's object to be deleted")
+	}
+	if ok, _ := mod.Exists(ctx, "users/bob/avatar.png"); !ok {
+		t.Error("expected bob's object to be kept")
+	}
+}
+
+func TestOrgFilesHandler(t *testing.T) {
+	dir := t.TempDir()
+	mod := New(WithBasePath(filepath.Join(dir, "files")))
+	perms := permissions.New(permissions.WithDBPath(filepath.Join(dir, "permissions.db")))
+	app := chassis.New(chassis.WithModules(mod, orgs.New(orgs.WithDBPath(filepath.Join(dir, "orgs.db"))), perms))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := mod.ForOrg("acme").Put(ctx, "docs/readme.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := perms.Grant(ctx, "u1", "acme", OrgFilesPermission); err != nil {
+		t.Fatal(err)
+	}
+	handler := http.StripPrefix("/files", mod.OrgFilesHandler())
+
+	get := func(userID, path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if userID != "" {
+			request = request.WithContext(auth.WithSession(request.Context(), &auth.Session{UserID: userID}))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := get("u1", "/files/acme/docs/readme.txt"); recorder.Code != http.StatusOK || recorder.Body.String() != "hello" {
+		t.Errorf("expected the file, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder := get("u1", "/files/acme/docs/missing.txt"); recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", recorder.Code)
+	}
+	if recorder := get("u2", "/files/acme/docs/readme.txt"); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without org:read, got %d", recorder.Code)
+	}
+	if recorder := get("u2", "/files/acme/docs/missing.txt"); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected 403 before the object is looked up, got %d", recorder.Code)
+	}
+	if recorder := get("", "/files/acme/docs/readme.txt"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a user, got %d", recorder.Code)
+	}
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploader_Upload(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	scanner := ScannerFunc(func(ctx context.Context, name string, reader io.Reader) error {
+		data, _ := io.ReadAll(reader)
+		if bytes.Contains(data, []byte("EICAR")) {
+			return ErrUploadInfected
+		}
+		return nil
+	})
+	uploader := mod.Uploads(
+		WithMaxUploadSize(64<<10),
+		WithAllowedTypes("image/*", "text/csv"),
+		WithScanner(scanner),
+		WithUploadHook(Thumbnails(32, 512)),
+	)
+	ctx := auth.WithSession(chassis.WithTenant(context.Background(), "acme"), &auth.Session{UserID: "user-1"})
+
+	upload, err := uploader.Upload(ctx, `C:\photos\cat.PNG`, bytes.NewReader(testPNG(t, 100, 50)))
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if upload.Name != "cat.PNG" || upload.ContentType != "image/png" || upload.UploadedBy != "user-1" || upload.OrgID != "acme" {
+		t.Errorf("unexpected upload: %+v", upload)
+	}
+	if !strings.HasPrefix(upload.Key, "orgs/acme/uploads/") || !strings.HasSuffix(upload.Key, ".png") {
+		t.Errorf("expected a generated key under the org's prefix, got %q", upload.Key)
+	}
+	thumbnail, ok := upload.Thumbnails["32"]
+	if !ok || len(upload.Thumbnails) != 1 {
+		t.Fatalf("expected only the 32px thumbnail, got %v", upload.Thumbnails)
+	}
+	data, err := mod.Get(ctx, thumbnail)
+	if err != nil {
+		t.Fatalf("Get thumbnail failed: %v", err)
+	}
+	if img, err := png.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != 32 || img.Bounds().Dy() != 16 {
+		t.Errorf("expected a 32x16 thumbnail, got %v (%v)", img, err)
+	}
+
+	got, err := uploader.Get(ctx, upload.Key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Name != "cat.PNG" || got.UploadedBy != "user-1" || got.OrgID != "acme" || got.Checksum != upload.Checksum || got.Thumbnails["32"] != thumbnail {
+		t.Errorf("expected the recorded metadata, got %+v", got)
+	}
+
+	if csv, err := uploader.Upload(ctx, "report.csv", strings.NewReader("a,b\n1,2\n")); err != nil || csv.ContentType != "text/csv" {
+		t.Errorf("expected a CSV by its extension, got %+v (%v)", csv, err)
+	}
+	if _, err := uploader.Upload(ctx, "evil.png", strings.NewReader("MZ\x90\x00 not an image")); !errors.Is(err, ErrContentTypeNotAllowed) {
+		t.Errorf("expected ErrContentTypeNotAllowed for a renamed binary, got %v", err)
+	}
+	if _, err := uploader.Upload(ctx, "big.csv", bytes.NewReader(make([]byte, 65<<10))); !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("expected ErrUploadTooLarge, got %v", err)
+	}
+	if _, err := uploader.Upload(ctx, "virus.csv", strings.NewReader("a,EICAR")); !errors.Is(err, ErrUploadInfected) {
+		t.Errorf("expected ErrUploadInfected, got %v", err)
+	}
+
+	if err := uploader.Delete(ctx, upload.Key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := mod.Get(ctx, thumbnail); !os.IsNotExist(err) {
+		t.Errorf("expected the thumbnail deleted with the upload, got %v", err)
+	}
+}
+
+func TestUploader_Handler(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	handler := mod.Uploads(WithAllowedTypes("image/png"), WithUploadField("file"), WithMaxUploadFiles(2)).Handler()
+
+	post := func(files map[string][]byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		_ = form.WriteField("title", "Holiday")
+		for name, data := range files {
+			part, _ := form.CreateFormFile("file", name)
+			_, _ = part.Write(data)
+		}
+		_ = form.Close()
+		request := httptest.NewRequest(http.MethodPost, "/uploads", &body)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	response := post(map[string][]byte{"a.png": testPNG(t, 4, 4)})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", response.Code, response.Body)
+	}
+	var result struct {
+		Uploads []*Upload `json:"uploads"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil || len(result.Uploads) != 1 || result.Uploads[0].Name != "a.png" {
+		t.Fatalf("unexpected response: %s", response.Body)
+	}
+	if _, err := mod.Stat(context.Background(), result.Uploads[0].Key); err != nil {
+		t.Errorf("expected the upload stored, got %v", err)
+	}
+
+	if response := post(map[string][]byte{"notes.txt": []byte("hello")}); response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a disallowed type, got %d", response.Code)
+	}
+	if response := post(nil); response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without files, got %d", response.Code)
+	}
+	response = post(map[string][]byte{"1.png": testPNG(t, 2, 2), "2.png": testPNG(t, 2, 2), "3.png": testPNG(t, 2, 2)})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too many files, got %d", response.Code)
+	}
+	if keys, _ := mod.List(context.Background(), DefaultUploadPrefix); len(keys) != 1 {
+		t.Errorf("expected the files of failed requests removed, got %v", keys)
+	}
+}
+
+func TestLocalProvider_HonorsCancellation(t *testing.T) {
+	tmpDir := t.TempDir()
+	provider := &LocalProvider{basePath: tmpDir}
+	if err := provider.Put(context.Background(), "dir/existing", []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := provider.Put(ctx, "dir/new", []byte("data")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Put to fail with context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "dir", "new")); !os.IsNotExist(err) {
+		t.Errorf("expected a cancelled Put to leave no file, got %v", err)
+	}
+	if _, err := provider.Get(ctx, "dir/existing"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Get to fail with context.Canceled, got %v", err)
+	}
+	if _, err := provider.List(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected List to fail with context.Canceled, got %v", err)
+	}
+	if _, err := provider.ListPage(ctx, "", ListOptions{Delimiter: "/", Limit: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected ListPage to fail with context.Canceled, got %v", err)
+	}
+	if _, err := provider.Stat(ctx, "dir/existing"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Stat to fail with context.Canceled, got %v", err)
+	}
+	if err := provider.Delete(ctx, "dir/existing"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Delete to fail with context.Canceled, got %v", err)
+	}
+	if data, err := provider.Get(context.Background(), "dir/existing"); err != nil || string(data) != "kept" {
+		t.Errorf("expected the existing object untouched, got %q (%v)", data, err)
+	}
+}
+
+// slowProvider blocks every operation until its context is done.
+type slowProvider struct {
+	bytesProvider
+}
+
+func (provider *slowProvider) Put(ctx context.Context, key string, data []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (provider *slowProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestModule_Timeouts(t *testing.T) {
+	provider := &slowProvider{bytesProvider{objects: map[string][]byte{"a": []byte("a")}}}
+	mod := New(WithProvider(provider), WithTimeouts(Timeouts{Write: 20 * time.Millisecond, List: 20 * time.Millisecond}))
+	ctx := context.Background()
+
+	if err := mod.Put(ctx, "b", []byte("b")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Put to time out, got %v", err)
+	}
+	if _, err := mod.List(ctx, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected List to time out, got %v", err)
+	}
+	if data, err := mod.Get(ctx, "a"); err != nil || string(data) != "a" {
+		t.Errorf("expected Get without a read timeout to succeed, got %q (%v)", data, err)
+	}
+}
+
+func TestModule_TimeoutsFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	configYAML := "storage:\n  base_path: " + filepath.Join(dir, "files") + "\n  timeouts:\n    read: 5s\n    write: 1m\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	mod := New()
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(ctx) }()
+
+	if mod.timeouts != (Timeouts{Read: 5 * time.Second, Write: time.Minute}) {
+		t.Errorf("expected timeouts from config, got %+v", mod.timeouts)
+	}
+	if err := mod.Put(ctx, "docs/readme", []byte("hello")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	reader, err := mod.GetReader(ctx, "docs/readme")
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	if _, ok := reader.(io.ReadSeeker); !ok {
+		t.Error("expected a bounded reader to stay seekable")
+	}
+	if data, err := io.ReadAll(reader); err != nil || string(data) != "hello" {
+		t.Errorf("expected to read the object, got %q (%v)", data, err)
+	}
+}
+
+func TestLocalProvider_CopyMoveExists(t *testing.T) {
+	tmpDir := t.TempDir()
+	provider := &LocalProvider{basePath: tmpDir}
+	ctx := context.Background()
+	meta := Metadata{ContentType: "text/csv", Values: map[string]string{"owner": "alice"}}
+	if err := provider.PutWithMetadata(ctx, "reports/q1.csv", strings.NewReader("a,b"), 3, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := provider.Exists(ctx, "reports/q1.csv"); err != nil || !ok {
+		t.Errorf("expected the object to exist, got %v (%v)", ok, err)
+	}
+	if ok, err := provider.Exists(ctx, "reports"); err != nil || ok {
+		t.Errorf("expected directories not to exist as objects, got %v (%v)", ok, err)
+	}
+
+	if err := provider.Copy(ctx, "reports/q1.csv", "backup/q1.csv"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	info, err := provider.Stat(ctx, "backup/q1.csv")
+	if err != nil || info.ContentType != "text/csv" || info.Values["owner"] != "alice" || info.Checksum != Checksum([]byte("a,b")) {
+		t.Errorf("expected the copy with its metadata, got %+v (%v)", info, err)
+	}
+
+	if err := provider.Move(ctx, "reports/q1.csv", "archive/2026/q1.csv"); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if ok, _ := provider.Exists(ctx, "reports/q1.csv"); ok {
+		t.Error("expected the source to be gone after Move")
+	}
+	info, err = provider.Stat(ctx, "archive/2026/q1.csv")
+	if err != nil || info.Values["owner"] != "alice" {
+		t.Errorf("expected the moved object with its metadata, got %+v (%v)", info, err)
+	}
+
+	if err := provider.Copy(ctx, "missing", "other"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist copying a missing object, got %v", err)
+	}
+	if err := provider.Move(ctx, "missing", "other"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist moving a missing object, got %v", err)
+	}
+}
+
+func TestModule_CopyAdaptsProviders(t *testing.T) {
+	provider := &bytesProvider{objects: map[string][]byte{"a": []byte("data")}}
+	mod := New(WithProvider(provider))
+	ctx := context.Background()
+
+	if ok, err := mod.Exists(ctx, "a"); err != nil || !ok {
+		t.Errorf("expected a to exist, got %v (%v)", ok, err)
+	}
+	if ok, err := mod.Exists(ctx, "b"); err != nil || ok {
+		t.Errorf("expected b not to exist, got %v (%v)", ok, err)
+	}
+	if err := mod.Copy(ctx, "a", "b"); err != nil || string(provider.objects["b"]) != "data" {
+		t.Errorf("expected Copy to store b, got %q (%v)", provider.objects["b"], err)
+	}
+	if err := mod.Move(ctx, "b", "c"); err != nil || string(provider.objects["c"]) != "data" {
+		t.Errorf("expected Move to store c, got %q (%v)", provider.objects["c"], err)
+	}
+	if _, ok := provider.objects["b"]; ok {
+		t.Error("expected Move to delete b")
+	}
+	if err := mod.Copy(ctx, "a", "../escape"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestModule_CopyMoveWithQuotaAndTrash(t *testing.T) {
+	mod := New(WithBasePath(t.TempDir()), WithTrash(time.Hour), WithQuota("orgs/*/", 10))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	if err := mod.Put(ctx, "orgs/acme/a", []byte("123456")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mod.Copy(ctx, "orgs/acme/a", "orgs/acme/b"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected a copy over quota to fail, got %v", err)
+	}
+	if err := mod.Move(ctx, "orgs/acme/a", "orgs/acme/b"); err != nil {
+		t.Errorf("expected a move within a full prefix to succeed, got %v", err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/acme/"); used != 6 {
+		t.Errorf("expected 6 bytes used after Move, got %d", used)
+	}
+	if err := mod.Copy(ctx, "orgs/acme/b", "orgs/globex/b"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if used, _ := mod.Usage(ctx, "orgs/globex/"); used != 6 {
+		t.Errorf("expected the copy to count against its own prefix, got %d", used)
+	}
+	if trashed, _ := mod.Trash().List(ctx); len(trashed) != 0 {
+		t.Errorf("expected Move not to trash the source, got %v", trashed)
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/talosaether/chassis"
+)
+
+var ErrSizeMismatch = chassis.NewError(chassis.CodeInvalidArgument, "object size does not match the data read")
+
+// StreamingProvider is implemented by providers that can store and read
+// objects without holding them in memory, so multi-GB files can pass
+// through. LocalProvider implements it; use Streaming to get one for any
+// provider.
+type StreamingProvider interface {
+	Provider
+
+	// PutReader stores everything read from reader at key. size is the
+	// number of bytes reader yields, or -1 if unknown; a known size that
+	// doesn't match fails with ErrSizeMismatch. Nothing is stored if the
+	// read fails.
+	PutReader(ctx context.Context, key string, reader io.Reader, size int64) error
+
+	// GetReader opens the data at key for reading. The caller closes it.
+	// Returns os.ErrNotExist if the key doesn't exist.
+	GetReader(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Streaming returns provider as a StreamingProvider. Providers that don't
+// stream are adapted by buffering each object in memory, so they keep
+// working, without the memory savings.
+func Streaming(provider Provider) StreamingProvider {
+	if streaming, ok := provider.(StreamingProvider); ok {
+		return streaming
+	}
+	return bufferedProvider{Provider: provider}
+}
+
+// bufferedProvider adapts a Provider to StreamingProvider with whole-object
+// reads and writes.
+type bufferedProvider struct {
+	Provider
+}
+
+func (buffered bufferedProvider) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("%w: read %d of %d bytes", ErrSizeMismatch, len(data), size)
+	}
+	return buffered.Put(ctx, key, data)
+}
+
+func (buffered bufferedProvider) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, err := buffered.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// copyObject streams the object at from to to, with its metadata if the
+// provider stores any.
+func copyObject(ctx context.Context, provider Provider, from, to string) error {
+	streaming := Streaming(provider)
+	reader, err := streaming.GetReader(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	if described, ok := provider.(MetadataProvider); ok && storesMetadata(provider) {
+		info, err := described.Stat(ctx, from)
+		if err != nil {
+			return err
+		}
+		return described.PutWithMetadata(ctx, to, reader, info.Size, info.Metadata)
+	}
+	return streaming.PutReader(ctx, to, reader, -1)
+}
+
+// storesMetadata reports whether the provider below the module's own
+// layers stores metadata.
+func storesMetadata(provider Provider) bool {
+	for {
+		switch layer := provider.(type) {
+		case *quotaProvider:
+			provider = layer.Provider
+		case *trashProvider:
+			provider = layer.Provider
+		case *EncryptedProvider:
+			provider = layer.Provider
+		case MetadataProvider:
+			return true
+		default:
+			return false
+		}
+	}
+}
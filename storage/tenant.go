@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+// TenantPrefix is the key prefix under which Tenant keeps each org's
+// objects: orgs/<org ID>/<key>.
+const TenantPrefix = "orgs/"
+
+// TenantStorage is a view of the module scoped to the tenant of each
+// call's context (see chassis.WithTenant), to one org with ForOrg, or to
+// one user with ForUser. Keys are relative to the view's prefix, so one
+// org can't read or list another's objects. Tenant views fail with
+// chassis.ErrNoTenant on calls without a tenant.
+type TenantStorage struct {
+	mod    *Module
+	orgID  string // fixed org of ForOrg views
+	userID string // fixed user of ForUser views
+}
+
+// Tenant returns the tenant-scoped view of the module.
+func (mod *Module) Tenant() *TenantStorage {
+	return &TenantStorage{mod: mod}
+}
+
+// ForOrg returns a view of the module jailed under the prefix of orgID,
+// whatever the tenant of each call's context, e.g. for jobs run on an
+// org's behalf:
+//
+//	files := storageMod.ForOrg(orgID)
+//	err := files.Put(ctx, "reports/q1.csv", data) // stored at orgs/<orgID>/reports/q1.csv
+//
+// An org ID that isn't a single key segment fails every call with
+// ErrInvalidKey.
+func (mod *Module) ForOrg(orgID string) *TenantStorage {
+	return &TenantStorage{mod: mod, orgID: orgID}
+}
+
+// prefix returns the prefix of the view's user or org, or of the tenant
+// of ctx.
+func (tenant *TenantStorage) prefix(ctx context.Context) (string, error) {
+	if tenant.userID != "" {
+		return segmentPrefix(UserPrefix, "user", tenant.userID)
+	}
+	if tenant.orgID != "" {
+		return segmentPrefix(TenantPrefix, "org", tenant.orgID)
+	}
+	orgID, err := chassis.RequireTenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	return TenantPrefix + orgID + "/", nil
+}
+
+// segmentPrefix returns base + id + "/", failing with ErrInvalidKey unless
+// id is a single key segment.
+func segmentPrefix(base, kind, id string) (string, error) {
+	if strings.Contains(id, "/") {
+		return "", fmt.Errorf("%w: %s ID %q", ErrInvalidKey, kind, id)
+	}
+	if _, err := ValidateKey(id); err != nil {
+		return "", err
+	}
+	return base + id + "/", nil
+}
+
+// key returns the full key of key for the tenant of ctx. The key is
+// validated on its own first, so ".." can't climb out of the org prefix.
+func (tenant *TenantStorage) key(ctx context.Context, key string) (string, error) {
+	prefix, err := tenant.prefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	key, err = ValidateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return prefix + key, nil
+}
+
+// Put stores data at key.
+func (tenant *TenantStorage) Put(ctx context.Context, key string, data []byte) error {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.Put(ctx, key, data)
+}
+
+// Get retrieves the data at key.
+func (tenant *TenantStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.mod.Get(ctx, key)
+}
+
+// PutReader streams the data from reader to key.
+func (tenant *TenantStorage) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.PutReader(ctx, key, reader, size)
+}
+
+// GetReader opens the data at key for streaming. The caller closes it.
+func (tenant *TenantStorage) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.mod.GetReader(ctx, key)
+}
+
+// Stat returns the metadata of the object at key.
+func (tenant *TenantStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.mod.Stat(ctx, key)
+}
+
+// Serve writes the object at key as an HTTP response, like Module.Serve.
+func (tenant *TenantStorage) Serve(writer http.ResponseWriter, request *http.Request, key string) {
+	key, err := tenant.key(request.Context(), key)
+	if err != nil {
+		api.WriteError(writer, request, err)
+		return
+	}
+	tenant.mod.Serve(writer, request, key)
+}
+
+// Delete removes the data at key.
+func (tenant *TenantStorage) Delete(ctx context.Context, key string) error {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.Delete(ctx, key)
+}
+
+// Exists reports whether an object is stored at key.
+func (tenant *TenantStorage) Exists(ctx context.Context, key string) (bool, error) {
+	key, err := tenant.key(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return tenant.mod.Exists(ctx, key)
+}
+
+// Copy copies the object at src to dst, both within the tenant.
+func (tenant *TenantStorage) Copy(ctx context.Context, src, dst string) error {
+	src, dst, err := tenant.keys(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.Copy(ctx, src, dst)
+}
+
+// Move moves the object at src to dst, both within the tenant.
+func (tenant *TenantStorage) Move(ctx context.Context, src, dst string) error {
+	src, dst, err := tenant.keys(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	return tenant.mod.Move(ctx, src, dst)
+}
+
+func (tenant *TenantStorage) keys(ctx context.Context, src, dst string) (string, string, error) {
+	src, err := tenant.key(ctx, src)
+	if err != nil {
+		return "", "", err
+	}
+	dst, err = tenant.key(ctx, dst)
+	if err != nil {
+		return "", "", err
+	}
+	return src, dst, nil
+}
+
+// List returns the tenant's keys matching prefix, relative to the org
+// prefix like the keys given to Put.
+func (tenant *TenantStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	orgPrefix, err := tenant.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err = validatePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := tenant.mod.List(ctx, orgPrefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, orgPrefix)
+	}
+	return keys, nil
+}
+
+// ExportOrg copies the objects under the org's prefix into the export's
+// files directory, at their keys relative to the prefix. Implements
+// chassis.OrgExporter.
+func (mod *Module) ExportOrg(ctx context.Context, orgID string, export chassis.ExportWriter) error {
+	files := mod.ForOrg(orgID)
+	keys, err := files.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list org files: %w", err)
+	}
+	for _, key := range keys {
+		if err := exportObject(ctx, files, key, export); err != nil {
+			return fmt.Errorf("failed to export %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// PurgeOrg deletes the objects under the org's prefix. Implements
+// chassis.OrgPurger.
+func (mod *Module) PurgeOrg(ctx context.Context, orgID string) error {
+	files := mod.ForOrg(orgID)
+	keys, err := files.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list org files: %w", err)
+	}
+	for _, key := range keys {
+		if err := files.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// exportObject copies one object into the export.
+func exportObject(ctx context.Context, files *TenantStorage, key string, export chassis.ExportWriter) error {
+	reader, err := files.GetReader(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+	writer, err := export.Create("files/" + key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, reader)
+	return err
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Timeouts bounds how long module operations may take. A zero field means
+// no timeout beyond the caller's context.
+type Timeouts struct {
+	// Read bounds Get and Stat, and a GetReader stream until it is closed.
+	Read time.Duration
+	// Write bounds Put, PutReader, PutWithMetadata and Delete.
+	Write time.Duration
+	// List bounds List and ListPage.
+	List time.Duration
+}
+
+// WithTimeouts sets per-operation timeouts, so a slow disk or remote
+// provider can't hold a request forever:
+//
+//	storage.New(storage.WithTimeouts(storage.Timeouts{
+//	    Read:  10 * time.Second,
+//	    Write: time.Minute,
+//	    List:  5 * time.Second,
+//	}))
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(opts *Options) {
+		opts.Timeouts = timeouts
+	}
+}
+
+// withTimeout derives the context of an operation bounded by timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutReader ends a GetReader stream's timeout when it is closed and
+// stops reading once it expires.
+type timeoutReader struct {
+	contextReader
+	closer io.Closer
+	cancel context.CancelFunc
+}
+
+func (reader *timeoutReader) Close() error {
+	reader.cancel()
+	return reader.closer.Close()
+}
+
+// timeoutReadSeeker keeps the stream seekable, so Serve can still answer
+// range requests.
+type timeoutReadSeeker struct {
+	*timeoutReader
+	seeker io.Seeker
+}
+
+func (reader timeoutReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return reader.seeker.Seek(offset, whence)
+}
+
+// boundReader ties the stream to the timeout behind cancel.
+func boundReader(ctx context.Context, stream io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	reader := &timeoutReader{contextReader: contextReader{ctx: ctx, reader: stream}, closer: stream, cancel: cancel}
+	if seeker, ok := stream.(io.Seeker); ok {
+		return timeoutReadSeeker{timeoutReader: reader, seeker: seeker}
+	}
+	return reader
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+)
+
+// TrashPrefix is the key namespace that Delete moves objects to when the
+// trash is enabled. Trashed objects are stored at
+// TrashPrefix + <deletion time> + "/" + <original key>.
+const TrashPrefix = ".trash/"
+
+// trashTimeFormat sorts lexically in time order.
+const trashTimeFormat = "20060102T150405.000000000Z"
+
+// Trash defaults.
+const (
+	DefaultTrashRetention     = 30 * 24 * time.Hour
+	DefaultTrashSweepInterval = time.Hour
+)
+
+var (
+	ErrTrashDisabled   = chassis.NewError(chassis.CodeFailedPrecondition, "storage trash is not enabled")
+	ErrNotInTrash      = chassis.NewError(chassis.CodeNotFound, "object not found in trash")
+	ErrRestoreConflict = chassis.NewError(chassis.CodeAlreadyExists, "an object already exists at the key being restored")
+)
+
+// TrashedObject is a deleted object held in the trash.
+type TrashedObject struct {
+	Key       string // original key
+	DeletedAt time.Time
+	TrashKey  string // where the object is stored now
+}
+
+// Trash manages objects deleted while the trash is enabled. Get it with
+// Module.Trash. Its methods return ErrTrashDisabled on a nil Trash.
+type Trash struct {
+	provider  Provider // the provider below the trash
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Restore moves the most recently deleted object at key back into place.
+// It fails with ErrRestoreConflict if key has been written since.
+func (trash *Trash) Restore(ctx context.Context, key string) error {
+	if trash == nil {
+		return ErrTrashDisabled
+	}
+	key, err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	versions, err := trash.versions(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return ErrNotInTrash
+	}
+
+	if existing, err := Streaming(trash.provider).GetReader(ctx, key); err == nil {
+		_ = existing.Close()
+		return ErrRestoreConflict
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	latest := versions[0]
+	if err := copyObject(ctx, trash.provider, latest.TrashKey, key); err != nil {
+		return err
+	}
+	return trash.provider.Delete(ctx, latest.TrashKey)
+}
+
+// List returns the trashed objects, most recently deleted first.
+func (trash *Trash) List(ctx context.Context) ([]TrashedObject, error) {
+	if trash == nil {
+		return nil, ErrTrashDisabled
+	}
+	keys, err := trash.provider.List(ctx, TrashPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]TrashedObject, 0, len(keys))
+	for _, trashKey := range keys {
+		if object, ok := parseTrashKey(trashKey); ok {
+			objects = append(objects, object)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].DeletedAt.After(objects[j].DeletedAt)
+	})
+	return objects, nil
+}
+
+// Purge permanently deletes every trashed version of key.
+func (trash *Trash) Purge(ctx context.Context, key string) error {
+	if trash == nil {
+		return ErrTrashDisabled
+	}
+	key, err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	versions, err := trash.versions(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return ErrNotInTrash
+	}
+	for _, version := range versions {
+		if err := trash.provider.Delete(ctx, version.TrashKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep permanently deletes objects trashed longer ago than the retention
+// period and returns how many it removed. It runs periodically while the
+// module is up; a zero retention keeps trashed objects forever.
+func (trash *Trash) Sweep(ctx context.Context) (int, error) {
+	if trash == nil {
+		return 0, ErrTrashDisabled
+	}
+	if trash.retention <= 0 {
+		return 0, nil
+	}
+	objects, err := trash.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := trash.now().Add(-trash.retention)
+	purged := 0
+	for _, object := range objects {
+		if !object.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := trash.provider.Delete(ctx, object.TrashKey); err != nil {
+			return purged, fmt.Errorf("failed to purge %s: %w", object.TrashKey, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// versions returns the trashed versions of key, newest first.
+func (trash *Trash) versions(ctx context.Context, key string) ([]TrashedObject, error) {
+	objects, err := trash.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var versions []TrashedObject
+	for _, object := range objects {
+		if object.Key == key {
+			versions = append(versions, object)
+		}
+	}
+	return versions, nil
+}
+
+// parseTrashKey splits a trash key into its deletion time and original key.
+func parseTrashKey(trashKey string) (TrashedObject, bool) {
+	rest, ok := strings.CutPrefix(trashKey, TrashPrefix)
+	if !ok {
+		return TrashedObject{}, false
+	}
+	stamp, key, ok := strings.Cut(rest, "/")
+	if !ok || key == "" {
+		return TrashedObject{}, false
+	}
+	deletedAt, err := time.Parse(trashTimeFormat, stamp)
+	if err != nil {
+		return TrashedObject{}, false
+	}
+	return TrashedObject{Key: key, DeletedAt: deletedAt, TrashKey: trashKey}, true
+}
+
+// trashProvider moves deleted objects into the trash and hides the trash
+// from listings. It sits directly above the base provider, so wrappers such
+// as encryption see the original keys and trashed data stays as stored.
+type trashProvider struct {
+	Provider
+	trash *Trash
+}
+
+// Delete moves the object at key to the trash. Keys already in the trash
+// are deleted permanently.
+func (trashed *trashProvider) Delete(ctx context.Context, key string) error {
+	if strings.HasPrefix(key, TrashPrefix) {
+		return trashed.Provider.Delete(ctx, key)
+	}
+
+	trashKey := TrashPrefix + trashed.trash.now().UTC().Format(trashTimeFormat) + "/" + key
+	err := copyObject(ctx, trashed.Provider, key, trashKey)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move object to trash: %w", err)
+	}
+	return trashed.Provider.Delete(ctx, key)
+}
+
+// PutReader delegates to the wrapped provider.
+func (trashed *trashProvider) PutReader(ctx context.Context, key string, reader io.Reader, size int64) error {
+	return Streaming(trashed.Provider).PutReader(ctx, key, reader, size)
+}
+
+// PutWithMetadata delegates to the wrapped provider.
+func (trashed *trashProvider) PutWithMetadata(ctx context.Context, key string, reader io.Reader, size int64, meta Metadata) error {
+	return putWithMetadata(ctx, trashed.Provider, key, reader, size, meta)
+}
+
+// Stat delegates to the wrapped provider.
+func (trashed *trashProvider) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	return stat(ctx, trashed.Provider, key)
+}
+
+// GetReader delegates to the wrapped provider.
+func (trashed *trashProvider) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	return Streaming(trashed.Provider).GetReader(ctx, key)
+}
+
+// Exists delegates to the wrapped provider.
+func (trashed *trashProvider) Exists(ctx context.Context, key string) (bool, error) {
+	return Copying(trashed.Provider).Exists(ctx, key)
+}
+
+// Copy delegates to the wrapped provider.
+func (trashed *trashProvider) Copy(ctx context.Context, src, dst string) error {
+	return Copying(trashed.Provider).Copy(ctx, src, dst)
+}
+
+// Move delegates to the wrapped provider; the source isn't trashed, as its
+// data lives on at dst.
+func (trashed *trashProvider) Move(ctx context.Context, src, dst string) error {
+	return Copying(trashed.Provider).Move(ctx, src, dst)
+}
+
+// List omits trashed objects unless prefix is inside the trash.
+func (trashed *trashProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := trashed.Provider.List(ctx, prefix)
+	if err != nil || strings.HasPrefix(prefix, TrashPrefix) {
+		return keys, err
+	}
+	return visibleKeys(keys), nil
+}
+
+// ListPage omits trashed objects and the trash prefix unless prefix is
+// inside the trash, so pages may come out short.
+func (trashed *trashProvider) ListPage(ctx context.Context, prefix string, opts ListOptions) (*Page, error) {
+	page, err := Paging(trashed.Provider).ListPage(ctx, prefix, opts)
+	if err != nil || strings.HasPrefix(prefix, TrashPrefix) {
+		return page, err
+	}
+	page.Keys = visibleKeys(page.Keys)
+	page.Prefixes = visibleKeys(page.Prefixes)
+	return page, nil
+}
+
+// visibleKeys drops keys inside the trash.
+func visibleKeys(keys []string) []string {
+	visible := keys[:0]
+	for _, key := range keys {
+		if !strings.HasPrefix(key, TrashPrefix) {
+			visible = append(visible, key)
+		}
+	}
+	return visible
+}
+
+// Snapshot delegates to the wrapped provider. Snapshots include the trash.
+func (trashed *trashProvider) Snapshot(ctx context.Context, path string) error {
+	snapshotter, ok := trashed.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, path)
+}
+
+// Restore delegates to the wrapped provider.
+func (trashed *trashProvider) Restore(ctx context.Context, path string) error {
+	snapshotter, ok := trashed.Provider.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, path)
+}
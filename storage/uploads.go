@@ -0,0 +1,568 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // GIF decoding for Thumbnails
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+	"github.com/talosaether/chassis/auth"
+)
+
+var (
+	ErrUploadTooLarge        = chassis.NewError(chassis.CodeInvalidArgument, "upload is too large")
+	ErrContentTypeNotAllowed = chassis.NewError(chassis.CodeInvalidArgument, "upload content type is not allowed")
+	ErrUploadInfected        = chassis.NewError(chassis.CodeInvalidArgument, "upload failed the virus scan")
+	ErrNoUploadFiles         = chassis.NewError(chassis.CodeInvalidArgument, "no files in the upload")
+)
+
+const (
+	// DefaultUploadPrefix is where uploads are stored unless WithUploadPrefix
+	// says otherwise.
+	DefaultUploadPrefix = "uploads/"
+
+	// DefaultMaxUploadSize is the largest upload accepted by default, 10 MiB.
+	DefaultMaxUploadSize = 10 << 20
+
+	// DefaultMaxUploadFiles is how many files the handler accepts per request.
+	DefaultMaxUploadFiles = 10
+)
+
+// EventFileUploaded is published for every stored upload, when the events
+// module is registered.
+const EventFileUploaded = "storage.file_uploaded" // payload: *Upload
+
+// Metadata values recorded on every upload.
+const (
+	UploadMetaName       = "original_name"
+	UploadMetaUploadedBy = "uploaded_by"
+	UploadMetaThumbnails = "thumbnails"
+)
+
+// Upload describes a stored upload.
+type Upload struct {
+	Key         string            `json:"key"`
+	Name        string            `json:"name"` // original file name, cleaned
+	ContentType string            `json:"content_type"`
+	Size        int64             `json:"size"`
+	Checksum    string            `json:"checksum"`
+	UploadedBy  string            `json:"uploaded_by,omitempty"`
+	OrgID       string            `json:"org_id,omitempty"`
+	Thumbnails  map[string]string `json:"thumbnails,omitempty"` // e.g. "256" -> key
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// Scanner checks uploads for malware before they are stored. Scan returns
+// an error wrapping ErrUploadInfected for infected files; other errors
+// reject the upload too, so a scanner outage doesn't let files through.
+type Scanner interface {
+	Scan(ctx context.Context, name string, reader io.Reader) error
+}
+
+// ScannerFunc adapts a function to Scanner.
+type ScannerFunc func(ctx context.Context, name string, reader io.Reader) error
+
+// Scan calls fn.
+func (fn ScannerFunc) Scan(ctx context.Context, name string, reader io.Reader) error {
+	return fn(ctx, name, reader)
+}
+
+// UploadHook runs after an upload is validated, before it is recorded, with
+// the upload's data. Hooks may store derived objects and note them on the
+// upload; an error fails the upload and removes what was stored.
+type UploadHook func(ctx context.Context, uploader *Uploader, upload *Upload, data []byte) error
+
+// Uploader validates, scans and stores uploaded files; see Module.Uploads.
+type Uploader struct {
+	mod      *Module
+	prefix   string
+	maxSize  int64
+	maxFiles int
+	allowed  []string
+	scanner  Scanner
+	hooks    []UploadHook
+	field    string
+	keyFunc  func(ctx context.Context, upload *Upload) string
+}
+
+// UploadOption configures an Uploader.
+type UploadOption func(*Uploader)
+
+// WithMaxUploadSize sets the largest file accepted, in bytes.
+func WithMaxUploadSize(size int64) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.maxSize = size
+	}
+}
+
+// WithMaxUploadFiles sets how many files the handler accepts per request.
+func WithMaxUploadFiles(count int) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.maxFiles = count
+	}
+}
+
+// WithAllowedTypes limits uploads to content types, e.g. "image/*" or
+// "application/pdf". Any type is allowed by default.
+func WithAllowedTypes(contentTypes ...string) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.allowed = append(uploader.allowed, contentTypes...)
+	}
+}
+
+// WithScanner scans every upload before it is stored.
+func WithScanner(scanner Scanner) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.scanner = scanner
+	}
+}
+
+// WithUploadHook adds a hook run for every upload, such as Thumbnails.
+func WithUploadHook(hook UploadHook) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.hooks = append(uploader.hooks, hook)
+	}
+}
+
+// WithUploadPrefix sets the key prefix uploads are stored under.
+func WithUploadPrefix(prefix string) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.prefix = prefix
+	}
+}
+
+// WithUploadField sets the multipart form field the handler reads files
+// from. By default every file part is accepted.
+func WithUploadField(name string) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.field = name
+	}
+}
+
+// WithUploadKeys replaces the generated keys. keyFunc gets the upload with
+// everything but Key set and returns a key relative to the prefix.
+func WithUploadKeys(keyFunc func(ctx context.Context, upload *Upload) string) UploadOption {
+	return func(uploader *Uploader) {
+		uploader.keyFunc = keyFunc
+	}
+}
+
+// Uploads returns an Uploader storing files through the module. Uploads of
+// a context with a tenant go under the org's TenantPrefix.
+func (mod *Module) Uploads(opts ...UploadOption) *Uploader {
+	uploader := &Uploader{
+		mod:      mod,
+		prefix:   DefaultUploadPrefix,
+		maxSize:  DefaultMaxUploadSize,
+		maxFiles: DefaultMaxUploadFiles,
+		keyFunc:  generatedKey,
+	}
+	for _, opt := range opts {
+		opt(uploader)
+	}
+	if uploader.prefix != "" && !strings.HasSuffix(uploader.prefix, "/") {
+		uploader.prefix += "/"
+	}
+	return uploader
+}
+
+// Upload validates, scans and stores the file read from reader. The
+// content type is sniffed from the data rather than trusted from the
+// client; the extension of name only refines plain text. The file is held in memory, up to the maximum size.
+func (uploader *Uploader) Upload(ctx context.Context, name string, reader io.Reader) (*Upload, error) {
+	orgID := chassis.TenantFromContext(ctx)
+	if orgID != "" {
+		if _, err := chassis.RequireTenant(ctx); err != nil {
+			return nil, err
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, uploader.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if int64(len(data)) > uploader.maxSize {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrUploadTooLarge, uploader.maxSize)
+	}
+
+	upload := &Upload{
+		Name:        cleanUploadName(name),
+		ContentType: uploadContentType(name, data),
+		Size:        int64(len(data)),
+		Checksum:    Checksum(data),
+		UploadedBy:  auth.UserIDFromContext(ctx),
+		OrgID:       orgID,
+		CreatedAt:   uploader.mod.now().UTC(),
+	}
+	if !uploader.allows(upload.ContentType) {
+		return nil, fmt.Errorf("%w: %s", ErrContentTypeNotAllowed, upload.ContentType)
+	}
+	if uploader.scanner != nil {
+		if err := uploader.scanner.Scan(ctx, upload.Name, bytes.NewReader(data)); err != nil {
+			if errors.Is(err, ErrUploadInfected) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+	}
+
+	key, err := ValidateKey(uploader.keyFunc(ctx, upload))
+	if err != nil {
+		return nil, err
+	}
+	if upload.OrgID != "" {
+		key = TenantPrefix + upload.OrgID + "/" + uploader.prefix + key
+	} else {
+		key = uploader.prefix + key
+	}
+	upload.Key = key
+
+	if err := uploader.put(ctx, upload.Key, data, upload.ContentType, uploadValues(upload)); err != nil {
+		return nil, err
+	}
+	for _, hook := range uploader.hooks {
+		if err := hook(ctx, uploader, upload, data); err != nil {
+			uploader.remove(ctx, upload)
+			return nil, err
+		}
+	}
+	if len(upload.Thumbnails) > 0 {
+		// Record what the hooks added
+		if err := uploader.put(ctx, upload.Key, data, upload.ContentType, uploadValues(upload)); err != nil {
+			uploader.remove(ctx, upload)
+			return nil, err
+		}
+	}
+	uploader.mod.app.PublishEvent(ctx, EventFileUploaded, upload)
+	return upload, nil
+}
+
+// Put stores a derived object of an upload, such as a thumbnail. It is
+// meant for hooks.
+func (uploader *Uploader) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return uploader.put(ctx, key, data, contentType, nil)
+}
+
+// Get returns the upload stored at key, with the metadata recorded when it
+// was uploaded if the provider stores metadata.
+func (uploader *Uploader) Get(ctx context.Context, key string) (*Upload, error) {
+	info, err := uploader.mod.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	upload := &Upload{
+		Key:         info.Key,
+		Name:        info.Values[UploadMetaName],
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		Checksum:    info.Checksum,
+		UploadedBy:  info.Values[UploadMetaUploadedBy],
+		CreatedAt:   info.ModTime,
+	}
+	if upload.Name == "" {
+		upload.Name = path.Base(info.Key)
+	}
+	if orgID, ok := strings.CutPrefix(info.Key, TenantPrefix); ok {
+		upload.OrgID, _, _ = strings.Cut(orgID, "/")
+	}
+	for _, entry := range strings.Split(info.Values[UploadMetaThumbnails], ",") {
+		size, thumbnailKey, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if upload.Thumbnails == nil {
+			upload.Thumbnails = make(map[string]string)
+		}
+		upload.Thumbnails[size] = thumbnailKey
+	}
+	return upload, nil
+}
+
+// Delete removes the upload at key and its thumbnails.
+func (uploader *Uploader) Delete(ctx context.Context, key string) error {
+	upload, err := uploader.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, thumbnailKey := range upload.Thumbnails {
+		if err := uploader.mod.Delete(ctx, thumbnailKey); err != nil {
+			return err
+		}
+	}
+	return uploader.mod.Delete(ctx, upload.Key)
+}
+
+// Handler accepts multipart/form-data POSTs and responds 201 with the
+// stored uploads as {"uploads": [...]}. Mount it behind auth so uploads
+// record who made them:
+//
+//	mux.Handle("POST /uploads", storageMod.Uploads(storage.WithAllowedTypes("image/*")).Handler())
+//
+// A request fails as a whole: files stored before a rejected one are
+// removed again.
+func (uploader *Uploader) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			api.MethodNotAllowed(writer, request)
+			return
+		}
+		ctx := request.Context()
+		// Leave room for the multipart framing and form fields
+		request.Body = http.MaxBytesReader(writer, request.Body, uploader.maxSize*int64(uploader.maxFiles)+1<<20)
+		reader, err := request.MultipartReader()
+		if err != nil {
+			api.WriteError(writer, request, chassis.NewError(chassis.CodeInvalidArgument, "expected a multipart/form-data body"))
+			return
+		}
+
+		uploads := []*Upload{}
+		fail := func(err error) {
+			for _, upload := range uploads {
+				uploader.remove(ctx, upload)
+			}
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				err = ErrUploadTooLarge
+			}
+			api.WriteError(writer, request, err)
+		}
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				fail(fmt.Errorf("%w: %v", chassis.NewError(chassis.CodeInvalidArgument, "malformed multipart body"), err))
+				return
+			}
+			if part.FileName() == "" || (uploader.field != "" && part.FormName() != uploader.field) {
+				_ = part.Close()
+				continue
+			}
+			if len(uploads) == uploader.maxFiles {
+				_ = part.Close()
+				fail(fmt.Errorf("%w: more than %d files", ErrUploadTooLarge, uploader.maxFiles))
+				return
+			}
+			upload, err := uploader.Upload(ctx, part.FileName(), part)
+			_ = part.Close()
+			if err != nil {
+				fail(err)
+				return
+			}
+			uploads = append(uploads, upload)
+		}
+		if len(uploads) == 0 {
+			api.WriteError(writer, request, ErrNoUploadFiles)
+			return
+		}
+		api.WriteJSON(writer, http.StatusCreated, map[string]any{"uploads": uploads})
+	})
+}
+
+// Thumbnails returns a hook that stores scaled-down copies of PNG, JPEG
+// and GIF uploads, fitting within each size in pixels, next to the upload
+// at "<key>_<size>.<ext>". GIFs are thumbnailed as PNG. Other uploads, and
+// images already within a size, are left alone.
+func Thumbnails(sizes ...int) UploadHook {
+	return func(ctx context.Context, uploader *Uploader, upload *Upload, data []byte) error {
+		if upload.ContentType != "image/png" && upload.ContentType != "image/jpeg" && upload.ContentType != "image/gif" {
+			return nil
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: %v", chassis.NewError(chassis.CodeInvalidArgument, "invalid image"), err)
+		}
+		base := strings.TrimSuffix(upload.Key, path.Ext(upload.Key))
+		for _, size := range sizes {
+			bounds := img.Bounds()
+			if bounds.Dx() <= size && bounds.Dy() <= size {
+				continue
+			}
+			var encoded bytes.Buffer
+			thumbnail := scaleImage(img, size)
+			contentType, ext := "image/png", ".png"
+			if upload.ContentType == "image/jpeg" {
+				contentType, ext = "image/jpeg", ".jpg"
+				err = jpeg.Encode(&encoded, thumbnail, &jpeg.Options{Quality: 85})
+			} else {
+				err = png.Encode(&encoded, thumbnail)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to encode thumbnail: %w", err)
+			}
+			key := base + "_" + strconv.Itoa(size) + ext
+			if err := uploader.Put(ctx, key, encoded.Bytes(), contentType); err != nil {
+				return err
+			}
+			if upload.Thumbnails == nil {
+				upload.Thumbnails = make(map[string]string)
+			}
+			upload.Thumbnails[strconv.Itoa(size)] = key
+		}
+		return nil
+	}
+}
+
+// scaleImage scales img to fit within size×size, averaging the source
+// pixels that make up each thumbnail pixel.
+func scaleImage(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := size, bounds.Dy()*size/bounds.Dx()
+	if bounds.Dy() > bounds.Dx() {
+		width, height = bounds.Dx()*size/bounds.Dy(), size
+	}
+	width, height = max(width, 1), max(height, 1)
+
+	scaled := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := range width {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+			offset := scaled.PixOffset(x, y)
+			for i, channel := range []uint64{r / count, g / count, b / count, a / count} {
+				scaled.Pix[offset+2*i] = uint8(channel >> 8)
+				scaled.Pix[offset+2*i+1] = uint8(channel)
+			}
+		}
+	}
+	return scaled
+}
+
+func (uploader *Uploader) allows(contentType string) bool {
+	if len(uploader.allowed) == 0 {
+		return true
+	}
+	for _, allowed := range uploader.allowed {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(contentType, prefix+"/") {
+				return true
+			}
+		} else if contentType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// put stores data with metadata when the provider supports it.
+func (uploader *Uploader) put(ctx context.Context, key string, data []byte, contentType string, values map[string]string) error {
+	if storesMetadata(uploader.mod.provider) {
+		return uploader.mod.PutWithMetadata(ctx, key, bytes.NewReader(data), int64(len(data)), Metadata{ContentType: contentType, Values: values})
+	}
+	return uploader.mod.Put(ctx, key, data)
+}
+
+// remove deletes a stored upload and its thumbnails, logging failures.
+func (uploader *Uploader) remove(ctx context.Context, upload *Upload) {
+	keys := []string{upload.Key}
+	for _, key := range upload.Thumbnails {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if err := uploader.mod.Delete(ctx, key); err != nil {
+			uploader.mod.app.Logger().Warn("failed to remove upload", "key", key, "error", err)
+		}
+	}
+}
+
+// generatedKey is the default key of an upload: <yyyy>/<mm>/<uuid><ext>.
+func generatedKey(ctx context.Context, upload *Upload) string {
+	return upload.CreatedAt.Format("2006/01/") + uuid.NewString() + uploadExtension(upload)
+}
+
+// uploadExtension returns the extension for an upload's key: the original
+// one when it matches the content type, otherwise one for the type.
+func uploadExtension(upload *Upload) string {
+	ext := strings.ToLower(path.Ext(upload.Name))
+	if ext != "" && sameMediaType(mime.TypeByExtension(ext), upload.ContentType) {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(upload.ContentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// uploadContentType sniffs the content type of data. The extension of name
+// only refines plain text, e.g. to text/csv or application/json, so a
+// renamed executable can't pass as an image.
+func uploadContentType(name string, data []byte) string {
+	sniffed := mediaType(http.DetectContentType(data))
+	if sniffed != "text/plain" {
+		return sniffed
+	}
+	byExt := mediaType(mime.TypeByExtension(strings.ToLower(path.Ext(name))))
+	if strings.HasPrefix(byExt, "text/") || strings.HasSuffix(byExt, "json") || strings.HasSuffix(byExt, "xml") {
+		return byExt
+	}
+	return sniffed
+}
+
+// cleanUploadName strips directories and control characters from a client
+// file name.
+func cleanUploadName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// uploadValues are the metadata values recorded for an upload.
+func uploadValues(upload *Upload) map[string]string {
+	values := map[string]string{UploadMetaName: upload.Name}
+	if upload.UploadedBy != "" {
+		values[UploadMetaUploadedBy] = upload.UploadedBy
+	}
+	if len(upload.Thumbnails) > 0 {
+		entries := make([]string, 0, len(upload.Thumbnails))
+		for size, key := range upload.Thumbnails {
+			entries = append(entries, size+"="+key)
+		}
+		sort.Strings(entries)
+		values[UploadMetaThumbnails] = strings.Join(entries, ",")
+	}
+	return values
+}
+
+func mediaType(contentType string) string {
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		return parsed
+	}
+	return contentType
+}
+
+func sameMediaType(a, b string) bool {
+	return a != "" && mediaType(a) == mediaType(b)
+}
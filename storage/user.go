@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/talosaether/chassis"
+)
+
+// UserPrefix is the key prefix under which ForUser keeps each user's
+// objects: users/<user ID>/<key>.
+const UserPrefix = "users/"
+
+// ForUser returns a view of the module jailed under the prefix of userID,
+// like ForOrg, for files that belong to a user rather than an org, such as
+// avatars and uploads. The user's objects are part of their data export
+// and are deleted with them.
+//
+// A user ID that isn't a single key segment fails every call with
+// ErrInvalidKey.
+func (mod *Module) ForUser(userID string) *TenantStorage {
+	return &TenantStorage{mod: mod, userID: userID}
+}
+
+// ExportUser copies the objects under the user's prefix into the export's
+// files directory, at their keys relative to the prefix. Implements
+// chassis.UserExporter.
+func (mod *Module) ExportUser(ctx context.Context, userID string, export chassis.ExportWriter) error {
+	files := mod.ForUser(userID)
+	keys, err := files.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list user files: %w", err)
+	}
+	for _, key := range keys {
+		if err := exportObject(ctx, files, key, export); err != nil {
+			return fmt.Errorf("failed to export %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// PlanUserCleanup plans deleting the objects under the user's prefix.
+// Implements chassis.UserCleaner.
+func (mod *Module) PlanUserCleanup(ctx context.Context, userID string) ([]chassis.CleanupAction, error) {
+	files := mod.ForUser(userID)
+	keys, err := files.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user files: %w", err)
+	}
+
+	var actions []chassis.CleanupAction
+	for _, key := range keys {
+		actions = append(actions, chassis.CleanupAction{
+			Module:      mod.Name(),
+			Kind:        "object",
+			Resource:    UserPrefix + userID + "/" + key,
+			Description: fmt.Sprintf("delete file %s of user %s", key, userID),
+			Apply: func(ctx context.Context) error {
+				return files.Delete(ctx, key)
+			},
+		})
+	}
+	return actions, nil
+}
@@ -0,0 +1,169 @@
+// Package tenant scopes requests to the org they are for.
+//
+// Middleware resolves the current org from the request, by subdomain,
+// header or path, and stores its ID in the request context with
+// chassis.WithTenant. The tenant views of the storage, cache and queue
+// modules then keep each org's data apart on their own, prefixing keys
+// and filtering queries by the org ID, instead of every handler building
+// "orgs/" + orgID + "/..." keys by hand:
+//
+//	scoped := tenant.Middleware(tenant.First(
+//	    tenant.FromSubdomain("example.com"), // acme.example.com
+//	    tenant.FromHeader("X-Org-ID"),
+//	))
+//	mux.Handle("/files/", scoped(filesHandler))
+//
+//	func filesHandler(writer http.ResponseWriter, request *http.Request) {
+//	    files := storageMod.Tenant()
+//	    data, err := files.Get(request.Context(), "invoices/2024-01.pdf") // orgs/<id>/invoices/2024-01.pdf
+//	    // ...
+//	}
+//
+// Resolving a tenant doesn't check that the user belongs to the org. Put
+// permissions.Require inside the middleware with OrgID as the resource:
+//
+//	scoped(authMod.RequireAuth(app.Permissions().Require("org:read", tenant.OrgID)(handler)))
+//
+// Outside HTTP, scope a context with chassis.WithTenant. Jobs enqueued
+// with a scoped context are handled with the same tenant.
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+// ErrTenantRequired is written by Middleware with Required when no tenant
+// can be resolved from the request.
+var ErrTenantRequired = chassis.NewError(chassis.CodeInvalidArgument, "tenant required")
+
+// Resolver returns the tenant key of a request, or "" if it names none.
+type Resolver func(request *http.Request) string
+
+// FromHeader resolves the tenant from a request header.
+func FromHeader(name string) Resolver {
+	return func(request *http.Request) string {
+		return strings.TrimSpace(request.Header.Get(name))
+	}
+}
+
+// FromSubdomain resolves the tenant from the subdomain of domain the
+// request is for: "acme" for acme.example.com with domain "example.com".
+// Requests for domain itself or nested subdomains name no tenant.
+func FromSubdomain(domain string) Resolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(request *http.Request) string {
+		host := request.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.ToLower(host)
+		sub, ok := strings.CutSuffix(host, suffix)
+		if !ok || sub == "" || strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+}
+
+// FromPath resolves the tenant from the path segment following prefix:
+// "acme" for /orgs/acme/files with prefix "/orgs/".
+func FromPath(prefix string) Resolver {
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	return func(request *http.Request) string {
+		rest, ok := strings.CutPrefix(request.URL.Path, prefix)
+		if !ok {
+			return ""
+		}
+		segment, _, _ := strings.Cut(rest, "/")
+		return segment
+	}
+}
+
+// First resolves the tenant with the first resolver that names one.
+func First(resolvers ...Resolver) Resolver {
+	return func(request *http.Request) string {
+		for _, resolve := range resolvers {
+			if key := resolve(request); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+// Option configures Middleware.
+type Option func(*options)
+
+type options struct {
+	required bool
+	lookup   func(ctx context.Context, key string) (string, error)
+}
+
+// Required makes Middleware reject requests naming no tenant with
+// ErrTenantRequired instead of passing them on unscoped.
+func Required() Option {
+	return func(opts *options) {
+		opts.required = true
+	}
+}
+
+// WithLookup maps the resolved key, such as a subdomain, to an org ID.
+// Requests for which lookup fails get the error's envelope, so return
+// an error with CodeNotFound for unknown orgs. Without a lookup the key
+// is the org ID.
+func WithLookup(lookup func(ctx context.Context, key string) (string, error)) Option {
+	return func(opts *options) {
+		opts.lookup = lookup
+	}
+}
+
+// Middleware returns middleware scoping request contexts to the tenant
+// resolve names, and adding org_id to their logger.
+func Middleware(resolve Resolver, opts ...Option) func(http.Handler) http.Handler {
+	var cfg options
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			key := resolve(request)
+			if key == "" {
+				if cfg.required {
+					api.WriteError(writer, request, ErrTenantRequired)
+					return
+				}
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			ctx := request.Context()
+			orgID := key
+			if cfg.lookup != nil {
+				var err error
+				if orgID, err = cfg.lookup(ctx, key); err != nil {
+					api.WriteError(writer, request, err)
+					return
+				}
+			}
+			ctx = chassis.WithTenant(ctx, orgID)
+			if _, err := chassis.RequireTenant(ctx); err != nil {
+				api.WriteError(writer, request, chassis.WrapError(chassis.CodeInvalidArgument, "invalid tenant", err))
+				return
+			}
+			ctx = chassis.WithLogger(ctx, chassis.LoggerFromContext(ctx).With("org_id", orgID))
+			next.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
+
+// OrgID returns the org ID the request is scoped to, or "". It fits the
+// resource argument of permissions.Require.
+func OrgID(request *http.Request) string {
+	return chassis.TenantFromContext(request.Context())
+}
@@ -0,0 +1,90 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/talosaether/chassis"
+)
+
+func TestResolvers(t *testing.T) {
+	cases := []struct {
+		name    string
+		resolve Resolver
+		url     string
+		header  string
+		want    string
+	}{
+		{"subdomain", FromSubdomain("example.com"), "http://acme.example.com/files", "", "acme"},
+		{"subdomain with port", FromSubdomain("example.com"), "http://Acme.example.com:8080/", "", "acme"},
+		{"apex domain", FromSubdomain("example.com"), "http://example.com/", "", ""},
+		{"nested subdomain", FromSubdomain("example.com"), "http://a.b.example.com/", "", ""},
+		{"other domain", FromSubdomain("example.com"), "http://acme.example.org/", "", ""},
+		{"header", FromHeader("X-Org-ID"), "http://example.com/", "globex", "globex"},
+		{"path", FromPath("/orgs/"), "http://example.com/orgs/acme/files", "", "acme"},
+		{"path without slashes", FromPath("orgs"), "http://example.com/orgs/acme", "", "acme"},
+		{"other path", FromPath("/orgs/"), "http://example.com/users/1", "", ""},
+		{"first match", First(FromHeader("X-Org-ID"), FromPath("/orgs/")), "http://example.com/orgs/acme", "", "acme"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.header != "" {
+				request.Header.Set("X-Org-ID", tc.header)
+			}
+			if got := tc.resolve(request); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var orgID string
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		orgID = OrgID(request)
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(middleware func(http.Handler) http.Handler, header string) int {
+		orgID = ""
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			request.Header.Set("X-Org-ID", header)
+		}
+		response := httptest.NewRecorder()
+		middleware(handler).ServeHTTP(response, request)
+		return response.Code
+	}
+
+	optional := Middleware(FromHeader("X-Org-ID"))
+	if code := serve(optional, "acme"); code != http.StatusNoContent || orgID != "acme" {
+		t.Errorf("expected the request scoped to acme, got %d %q", code, orgID)
+	}
+	if code := serve(optional, ""); code != http.StatusNoContent || orgID != "" {
+		t.Errorf("expected an unscoped request, got %d %q", code, orgID)
+	}
+	if code := serve(optional, "../acme"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unsafe org ID, got %d", code)
+	}
+
+	required := Middleware(FromHeader("X-Org-ID"), Required())
+	if code := serve(required, ""); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a tenant, got %d", code)
+	}
+
+	slugs := map[string]string{"acme": "org-1"}
+	lookup := Middleware(FromHeader("X-Org-ID"), WithLookup(func(ctx context.Context, key string) (string, error) {
+		if id, ok := slugs[key]; ok {
+			return id, nil
+		}
+		return "", chassis.NewError(chassis.CodeNotFound, "org not found")
+	}))
+	if code := serve(lookup, "acme"); code != http.StatusNoContent || orgID != "org-1" {
+		t.Errorf("expected the looked up org ID, got %d %q", code, orgID)
+	}
+	if code := serve(lookup, "initech"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown org, got %d", code)
+	}
+}
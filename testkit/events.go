@@ -0,0 +1,118 @@
+package testkit
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/talosaether/chassis/events"
+)
+
+// RecordedEvent is an event published through a Recorder.
+type RecordedEvent struct {
+	Type    string
+	Payload any
+}
+
+// Recorder is an events module that records every event it publishes
+// before delivering it to subscribers. Register it in place of
+// events.New():
+//
+//	recorder := testkit.NewRecorder()
+//	app := chassis.New(chassis.WithModules(recorder, ...))
+//	// ...
+//	event := recorder.AssertPublished(t, orgs.EventMemberAdded)
+type Recorder struct {
+	*events.Module
+
+	mu       sync.Mutex
+	recorded []RecordedEvent
+}
+
+// NewRecorder creates a recording events module.
+func NewRecorder(opts ...events.Option) *Recorder {
+	return &Recorder{Module: events.New(opts...)}
+}
+
+// Publish records the event and delivers it synchronously.
+func (recorder *Recorder) Publish(ctx context.Context, eventType string, payload any) {
+	recorder.record(eventType, payload)
+	recorder.Module.Publish(ctx, eventType, payload)
+}
+
+// PublishAsync records the event and delivers it asynchronously.
+func (recorder *Recorder) PublishAsync(ctx context.Context, eventType string, payload any) {
+	recorder.record(eventType, payload)
+	recorder.Module.PublishAsync(ctx, eventType, payload)
+}
+
+func (recorder *Recorder) record(eventType string, payload any) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.recorded = append(recorder.recorded, RecordedEvent{Type: eventType, Payload: payload})
+}
+
+// Events returns the recorded events of the given types in publishing
+// order, or all of them if no type is given.
+func (recorder *Recorder) Events(eventTypes ...string) []RecordedEvent {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	found := make([]RecordedEvent, 0)
+	for _, event := range recorder.recorded {
+		if len(eventTypes) == 0 || slices.Contains(eventTypes, event.Type) {
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+// Reset forgets the recorded events.
+func (recorder *Recorder) Reset() {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.recorded = nil
+}
+
+// AssertPublished fails the test unless an event of eventType was
+// published, and returns the most recent one.
+func (recorder *Recorder) AssertPublished(t testing.TB, eventType string) RecordedEvent {
+	t.Helper()
+	found := recorder.Events(eventType)
+	if len(found) == 0 {
+		t.Fatalf("no %q event was published; recorded %v", eventType, recorder.types())
+		return RecordedEvent{}
+	}
+	return found[len(found)-1]
+}
+
+// AssertNotPublished fails the test if an event of eventType was
+// published.
+func (recorder *Recorder) AssertNotPublished(t testing.TB, eventType string) {
+	t.Helper()
+	if found := recorder.Events(eventType); len(found) > 0 {
+		t.Fatalf("unexpected %q event: %+v", eventType, found[0].Payload)
+	}
+}
+
+// types returns the types of the recorded events, for failure messages.
+func (recorder *Recorder) types() []string {
+	var types []string
+	for _, event := range recorder.Events() {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// Payload returns the payload of event as a T, failing the test if it is
+// another type:
+//
+//	added := testkit.Payload[*orgs.MemberEvent](t, recorder.AssertPublished(t, orgs.EventMemberAdded))
+func Payload[T any](t testing.TB, event RecordedEvent) T {
+	t.Helper()
+	payload, ok := event.Payload.(T)
+	if !ok {
+		t.Fatalf("%q event payload is %T, not %T", event.Type, event.Payload, payload)
+	}
+	return payload
+}
@@ -0,0 +1,60 @@
+package testkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/users"
+)
+
+// Password is the password of users created by CreateUser.
+const Password = "testkit-password-1"
+
+// CreateUser creates a user with Password, failing the test on error.
+func (app *App) CreateUser(t testing.TB, email string) *users.User {
+	t.Helper()
+	user, err := app.Users.Create(context.Background(), email, Password)
+	if err != nil {
+		t.Fatalf("testkit: failed to create user %s: %v", email, err)
+	}
+	return user.(*users.User)
+}
+
+// CreateOrg creates an organization owned by ownerID, or without members
+// if ownerID is "", failing the test on error.
+func (app *App) CreateOrg(t testing.TB, name, ownerID string) *orgs.Org {
+	t.Helper()
+	ctx := context.Background()
+	created, err := app.Orgs.Create(ctx, orgs.CreateInput{Name: name})
+	if err != nil {
+		t.Fatalf("testkit: failed to create org %s: %v", name, err)
+	}
+	org := created.(*orgs.Org)
+	if ownerID != "" {
+		if _, err := app.Orgs.AddMember(ctx, org.ID(), ownerID, "owner"); err != nil {
+			t.Fatalf("testkit: failed to add owner to org %s: %v", name, err)
+		}
+	}
+	return org
+}
+
+// SessionCookie logs in a user created by CreateUser and returns the
+// session cookie, for requests to handlers behind auth.RequireAuth:
+//
+//	request := httptest.NewRequest(http.MethodGet, "/me", nil)
+//	request.AddCookie(app.SessionCookie(t, "ann@example.com"))
+func (app *App) SessionCookie(t testing.TB, email string) *http.Cookie {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	if _, err := app.Auth.Login(context.Background(), recorder, email, Password); err != nil {
+		t.Fatalf("testkit: failed to log in %s: %v", email, err)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatalf("testkit: login of %s set no cookie", email)
+	}
+	return cookies[0]
+}
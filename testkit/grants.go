@@ -0,0 +1,97 @@
+package testkit
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/talosaether/chassis/permissions"
+)
+
+// GrantStore is an in-memory permissions.Store.
+type GrantStore struct {
+	mu     sync.RWMutex
+	grants []permissions.Grant
+}
+
+// NewGrantStore creates an empty in-memory grant store.
+func NewGrantStore() *GrantStore {
+	return &GrantStore{}
+}
+
+// Grant records grant; granting again is a no-op.
+func (store *GrantStore) Grant(ctx context.Context, grant *permissions.Grant) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.index(grant.UserID, grant.Resource, grant.Permission) < 0 {
+		store.grants = append(store.grants, *grant)
+	}
+	return nil
+}
+
+func (store *GrantStore) Revoke(ctx context.Context, userID, resource, permission string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	i := store.index(userID, resource, permission)
+	if i < 0 {
+		return permissions.ErrGrantNotFound
+	}
+	store.grants = slices.Delete(store.grants, i, i+1)
+	return nil
+}
+
+// HasGrant reports whether userID holds any of perms on resource.
+func (store *GrantStore) HasGrant(ctx context.Context, userID, resource string, perms ...string) (bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, permission := range perms {
+		if store.index(userID, resource, permission) >= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListByResource returns the grants on resource in the order they were
+// made.
+func (store *GrantStore) ListByResource(ctx context.Context, resource string) ([]*permissions.Grant, error) {
+	return store.where(func(grant *permissions.Grant) bool { return grant.Resource == resource }), nil
+}
+
+// ListByUser returns the grants of userID ordered by resource and
+// permission.
+func (store *GrantStore) ListByUser(ctx context.Context, userID string) ([]*permissions.Grant, error) {
+	grants := store.where(func(grant *permissions.Grant) bool { return grant.UserID == userID })
+	sortBy(grants, false, func(grant *permissions.Grant) string { return pairKey(grant.Resource, grant.Permission) },
+		func(*permissions.Grant) string { return "" })
+	return grants, nil
+}
+
+func (store *GrantStore) DeleteByUser(ctx context.Context, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.grants = slices.DeleteFunc(store.grants, func(grant permissions.Grant) bool { return grant.UserID == userID })
+	return nil
+}
+
+func (store *GrantStore) Close() error {
+	return nil
+}
+
+func (store *GrantStore) index(userID, resource, permission string) int {
+	return slices.IndexFunc(store.grants, func(grant permissions.Grant) bool {
+		return grant.UserID == userID && grant.Resource == resource && grant.Permission == permission
+	})
+}
+
+func (store *GrantStore) where(match func(grant *permissions.Grant) bool) []*permissions.Grant {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	found := make([]*permissions.Grant, 0)
+	for _, grant := range store.grants {
+		if match(&grant) {
+			found = append(found, &grant)
+		}
+	}
+	return found
+}
@@ -0,0 +1,600 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis/orgs"
+)
+
+var errInvitationExists = errors.New("testkit: invitation already exists")
+
+// OrgStore is an in-memory orgs.Store.
+type OrgStore struct {
+	mu          sync.RWMutex
+	orgs        map[string]orgs.Org
+	memberships map[string]orgs.Membership // by org ID and user ID
+	invitations map[string]storedInvitation
+	teams       map[string]orgs.Team
+	teamMembers map[string]orgs.TeamMember // by team ID and user ID
+}
+
+type storedInvitation struct {
+	orgs.Invitation
+	tokenHash string
+}
+
+// NewOrgStore creates an empty in-memory organization store.
+func NewOrgStore() *OrgStore {
+	return &OrgStore{
+		orgs:        make(map[string]orgs.Org),
+		memberships: make(map[string]orgs.Membership),
+		invitations: make(map[string]storedInvitation),
+		teams:       make(map[string]orgs.Team),
+		teamMembers: make(map[string]orgs.TeamMember),
+	}
+}
+
+func pairKey(a, b string) string {
+	return a + "\x00" + b
+}
+
+func (store *OrgStore) Create(ctx context.Context, org *orgs.Org) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, exists := store.orgs[org.ID()]; exists || store.orgNamed(org.Name) != nil {
+		return orgs.ErrNameExists
+	}
+	store.orgs[org.ID()] = *org
+	return nil
+}
+
+func (store *OrgStore) GetByID(ctx context.Context, id string) (*orgs.Org, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	org, ok := store.orgs[id]
+	if !ok {
+		return nil, orgs.ErrNotFound
+	}
+	return &org, nil
+}
+
+func (store *OrgStore) GetByName(ctx context.Context, name string) (*orgs.Org, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	org := store.orgNamed(name)
+	if org == nil {
+		return nil, orgs.ErrNotFound
+	}
+	return org, nil
+}
+
+func (store *OrgStore) Update(ctx context.Context, org *orgs.Org) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	existing, ok := store.orgs[org.ID()]
+	if !ok {
+		return orgs.ErrNotFound
+	}
+	if other := store.orgNamed(org.Name); other != nil && other.ID() != org.ID() {
+		return orgs.ErrNameExists
+	}
+	updated := *org
+	updated.CreatedAt = existing.CreatedAt
+	store.orgs[org.ID()] = updated
+	return nil
+}
+
+func (store *OrgStore) Delete(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.orgs[id]; !ok {
+		return orgs.ErrNotFound
+	}
+	delete(store.orgs, id)
+	return nil
+}
+
+func (store *OrgStore) List(ctx context.Context, opts orgs.ListOptions, offset, limit int) ([]*orgs.OrgSummary, error) {
+	matched, err := store.matching(opts)
+	if err != nil {
+		return nil, err
+	}
+	return page(matched, offset, limit), nil
+}
+
+func (store *OrgStore) Count(ctx context.Context, opts orgs.ListOptions) (int, error) {
+	matched, err := store.matching(opts)
+	return len(matched), err
+}
+
+// matching returns the organizations matching opts with their member
+// counts, sorted like the SQLite store.
+func (store *OrgStore) matching(opts orgs.ListOptions) ([]*orgs.OrgSummary, error) {
+	field, descending := strings.CutPrefix(opts.SortBy, "-")
+	var key func(summary *orgs.OrgSummary) string
+	switch field {
+	case "", "name":
+		key = func(summary *orgs.OrgSummary) string { return summary.Name }
+	case "created_at":
+		key = func(summary *orgs.OrgSummary) string { return sortableMillis(summary.CreatedAt) }
+	case "members":
+		key = func(summary *orgs.OrgSummary) string { return sortableInt(summary.MemberCount) }
+	default:
+		return nil, orgs.ErrInvalidSort
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	now := time.Now()
+	counts := make(map[string]int)
+	for _, membership := range store.memberships {
+		if !membership.Expired(now) {
+			counts[membership.OrgID]++
+		}
+	}
+	query := strings.ToLower(opts.Query)
+	matched := make([]*orgs.OrgSummary, 0)
+	for id, org := range store.orgs {
+		if query != "" && !strings.Contains(strings.ToLower(org.Name), query) {
+			continue
+		}
+		if (org.DeletedAt != nil) != opts.Deleted {
+			continue
+		}
+		matched = append(matched, &orgs.OrgSummary{Org: &org, MemberCount: counts[id]})
+	}
+	sortBy(matched, descending, key, func(summary *orgs.OrgSummary) string { return summary.ID() })
+	return matched, nil
+}
+
+// GetOrgsWithRole returns the live organizations in which userID holds
+// role through their unexpired membership or a team.
+func (store *OrgStore) GetOrgsWithRole(ctx context.Context, userID, role string) ([]*orgs.Org, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	now := time.Now()
+	orgIDs := make(map[string]bool)
+	for _, membership := range store.memberships {
+		if membership.UserID == userID && membership.Role == role && !membership.Expired(now) {
+			orgIDs[membership.OrgID] = true
+		}
+	}
+	for _, member := range store.teamMembers {
+		team, ok := store.teams[member.TeamID]
+		if !ok || member.UserID != userID || team.Role != role {
+			continue
+		}
+		if membership, isMember := store.memberships[pairKey(team.OrgID, userID)]; isMember && !membership.Expired(now) {
+			orgIDs[team.OrgID] = true
+		}
+	}
+
+	found := make([]*orgs.Org, 0)
+	for id := range orgIDs {
+		if org, ok := store.orgs[id]; ok && org.DeletedAt == nil {
+			found = append(found, &org)
+		}
+	}
+	sortBy(found, false, func(org *orgs.Org) string { return org.Name }, (*orgs.Org).ID)
+	return found, nil
+}
+
+// ListChildren returns the organizations whose parent is parentID.
+func (store *OrgStore) ListChildren(ctx context.Context, parentID string) ([]*orgs.Org, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	children := make([]*orgs.Org, 0)
+	for _, org := range store.orgs {
+		if org.ParentID == parentID {
+			children = append(children, &org)
+		}
+	}
+	sortBy(children, false, func(org *orgs.Org) string { return org.Name }, (*orgs.Org).ID)
+	return children, nil
+}
+
+// ListDeletedOrgs returns the organizations whose deletion was scheduled
+// before the given time, oldest first.
+func (store *OrgStore) ListDeletedOrgs(ctx context.Context, before time.Time) ([]*orgs.Org, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	deleted := make([]*orgs.Org, 0)
+	for _, org := range store.orgs {
+		if org.DeletedAt != nil && !org.DeletedAt.After(before) {
+			deleted = append(deleted, &org)
+		}
+	}
+	sortBy(deleted, false, func(org *orgs.Org) string { return sortableMillis(*org.DeletedAt) }, (*orgs.Org).ID)
+	return deleted, nil
+}
+
+func (store *OrgStore) CreateMembership(ctx context.Context, membership *orgs.Membership) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := pairKey(membership.OrgID, membership.UserID)
+	if _, exists := store.memberships[key]; exists {
+		return orgs.ErrMemberExists
+	}
+	store.memberships[key] = *membership
+	return nil
+}
+
+func (store *OrgStore) GetMembership(ctx context.Context, orgID, userID string) (*orgs.Membership, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	membership, ok := store.memberships[pairKey(orgID, userID)]
+	if !ok {
+		return nil, orgs.ErrMemberNotFound
+	}
+	return &membership, nil
+}
+
+func (store *OrgStore) GetMembersByOrgID(ctx context.Context, orgID string) ([]*orgs.Membership, error) {
+	return store.membershipsWhere(func(membership *orgs.Membership) bool { return membership.OrgID == orgID }), nil
+}
+
+// ListMembersByOrgID returns a page of the organization's unexpired
+// memberships.
+func (store *OrgStore) ListMembersByOrgID(ctx context.Context, orgID string, offset, limit int) ([]*orgs.Membership, error) {
+	now := time.Now()
+	return page(store.membershipsWhere(func(membership *orgs.Membership) bool {
+		return membership.OrgID == orgID && !membership.Expired(now)
+	}), offset, limit), nil
+}
+
+func (store *OrgStore) CountMembersByOrgID(ctx context.Context, orgID string) (int, error) {
+	now := time.Now()
+	return len(store.membershipsWhere(func(membership *orgs.Membership) bool {
+		return membership.OrgID == orgID && !membership.Expired(now)
+	})), nil
+}
+
+func (store *OrgStore) CountMembersWithRole(ctx context.Context, orgID, role string) (int, error) {
+	return len(store.membershipsWhere(func(membership *orgs.Membership) bool {
+		return membership.OrgID == orgID && membership.Role == role
+	})), nil
+}
+
+func (store *OrgStore) GetMembershipsByUserID(ctx context.Context, userID string) ([]*orgs.Membership, error) {
+	return store.membershipsWhere(func(membership *orgs.Membership) bool { return membership.UserID == userID }), nil
+}
+
+// ListMemberships returns every membership. Used by the consistency checker.
+func (store *OrgStore) ListMemberships(ctx context.Context) ([]*orgs.Membership, error) {
+	return store.membershipsWhere(func(membership *orgs.Membership) bool { return true }), nil
+}
+
+// ListExpiringMemberships returns the memberships expiring by before,
+// soonest first.
+func (store *OrgStore) ListExpiringMemberships(ctx context.Context, before time.Time) ([]*orgs.Membership, error) {
+	expiring := store.membershipsWhere(func(membership *orgs.Membership) bool {
+		return membership.ExpiresAt != nil && !membership.ExpiresAt.After(before)
+	})
+	sortBy(expiring, false, func(membership *orgs.Membership) string { return sortableMillis(*membership.ExpiresAt) },
+		func(membership *orgs.Membership) string { return membership.ID })
+	return expiring, nil
+}
+
+// membershipsWhere returns the matching memberships, oldest first.
+func (store *OrgStore) membershipsWhere(match func(membership *orgs.Membership) bool) []*orgs.Membership {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	found := make([]*orgs.Membership, 0)
+	for _, membership := range store.memberships {
+		if match(&membership) {
+			found = append(found, &membership)
+		}
+	}
+	sortBy(found, false, func(membership *orgs.Membership) string { return sortableNanos(membership.CreatedAt) },
+		func(membership *orgs.Membership) string { return membership.ID })
+	return found
+}
+
+func (store *OrgStore) UpdateMembership(ctx context.Context, membership *orgs.Membership) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for key, existing := range store.memberships {
+		if existing.ID == membership.ID {
+			existing.Role = membership.Role
+			existing.UpdatedAt = membership.UpdatedAt
+			existing.ExpiresAt, existing.ExpiryWarned = membership.ExpiresAt, membership.ExpiryWarned
+			store.memberships[key] = existing
+			return nil
+		}
+	}
+	return orgs.ErrMemberNotFound
+}
+
+// TransferOwnership makes toUserID an owner and fromUserID an admin,
+// changing neither unless both are members.
+func (store *OrgStore) TransferOwnership(ctx context.Context, orgID, fromUserID, toUserID string, now time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	to, toOK := store.memberships[pairKey(orgID, toUserID)]
+	from, fromOK := store.memberships[pairKey(orgID, fromUserID)]
+	if !toOK || !fromOK {
+		return orgs.ErrMemberNotFound
+	}
+	to.Role, to.UpdatedAt, to.ExpiresAt, to.ExpiryWarned = "owner", now, nil, false
+	store.memberships[pairKey(orgID, toUserID)] = to
+	from = store.memberships[pairKey(orgID, fromUserID)] // Re-read in case from and to are the same user
+	from.Role, from.UpdatedAt = "admin", now
+	store.memberships[pairKey(orgID, fromUserID)] = from
+	return nil
+}
+
+func (store *OrgStore) DeleteMembership(ctx context.Context, orgID, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := pairKey(orgID, userID)
+	if _, ok := store.memberships[key]; !ok {
+		return orgs.ErrMemberNotFound
+	}
+	delete(store.memberships, key)
+	return nil
+}
+
+func (store *OrgStore) DeleteMembershipsByOrgID(ctx context.Context, orgID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for key, membership := range store.memberships {
+		if membership.OrgID == orgID {
+			delete(store.memberships, key)
+		}
+	}
+	return nil
+}
+
+func (store *OrgStore) CreateInvitation(ctx context.Context, invitation *orgs.Invitation, tokenHash string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, existing := range store.invitations {
+		if existing.tokenHash == tokenHash || (existing.OrgID == invitation.OrgID && existing.Email == invitation.Email) {
+			return errInvitationExists
+		}
+	}
+	stored := storedInvitation{Invitation: *invitation, tokenHash: tokenHash}
+	stored.Token = "" // Only the hash is stored
+	store.invitations[invitation.ID] = stored
+	return nil
+}
+
+func (store *OrgStore) GetInvitationByToken(ctx context.Context, tokenHash string) (*orgs.Invitation, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, stored := range store.invitations {
+		if stored.tokenHash == tokenHash {
+			return &stored.Invitation, nil
+		}
+	}
+	return nil, orgs.ErrInvitationNotFound
+}
+
+func (store *OrgStore) ListInvitationsByOrgID(ctx context.Context, orgID string) ([]*orgs.Invitation, error) {
+	return store.invitationsWhere(func(invitation *orgs.Invitation) bool { return invitation.OrgID == orgID }), nil
+}
+
+func (store *OrgStore) ListInvitationsByEmail(ctx context.Context, email string) ([]*orgs.Invitation, error) {
+	return store.invitationsWhere(func(invitation *orgs.Invitation) bool { return invitation.Email == email }), nil
+}
+
+// invitationsWhere returns the matching invitations, oldest first.
+func (store *OrgStore) invitationsWhere(match func(invitation *orgs.Invitation) bool) []*orgs.Invitation {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	found := make([]*orgs.Invitation, 0)
+	for _, stored := range store.invitations {
+		if match(&stored.Invitation) {
+			found = append(found, &stored.Invitation)
+		}
+	}
+	sortBy(found, false, func(invitation *orgs.Invitation) string { return sortableNanos(invitation.CreatedAt) },
+		func(invitation *orgs.Invitation) string { return invitation.ID })
+	return found
+}
+
+func (store *OrgStore) DeleteInvitation(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.invitations[id]; !ok {
+		return orgs.ErrInvitationNotFound
+	}
+	delete(store.invitations, id)
+	return nil
+}
+
+func (store *OrgStore) DeleteInvitationByEmail(ctx context.Context, orgID, email string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, stored := range store.invitations {
+		if stored.OrgID == orgID && stored.Email == email {
+			delete(store.invitations, id)
+			return nil
+		}
+	}
+	return orgs.ErrInvitationNotFound
+}
+
+func (store *OrgStore) DeleteInvitationsByOrgID(ctx context.Context, orgID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, stored := range store.invitations {
+		if stored.OrgID == orgID {
+			delete(store.invitations, id)
+		}
+	}
+	return nil
+}
+
+func (store *OrgStore) CreateTeam(ctx context.Context, team *orgs.Team) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, exists := store.teams[team.ID]; exists || store.teamNamed(team.OrgID, team.Name, "") {
+		return orgs.ErrTeamExists
+	}
+	store.teams[team.ID] = *team
+	return nil
+}
+
+func (store *OrgStore) GetTeam(ctx context.Context, id string) (*orgs.Team, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	team, ok := store.teams[id]
+	if !ok {
+		return nil, orgs.ErrTeamNotFound
+	}
+	return &team, nil
+}
+
+func (store *OrgStore) ListTeamsByOrgID(ctx context.Context, orgID string) ([]*orgs.Team, error) {
+	return store.teamsWhere(func(team *orgs.Team) bool { return team.OrgID == orgID }), nil
+}
+
+func (store *OrgStore) GetTeamsByUserID(ctx context.Context, orgID, userID string) ([]*orgs.Team, error) {
+	store.mu.RLock()
+	member := make(map[string]bool)
+	for _, teamMember := range store.teamMembers {
+		if teamMember.UserID == userID {
+			member[teamMember.TeamID] = true
+		}
+	}
+	store.mu.RUnlock()
+	return store.teamsWhere(func(team *orgs.Team) bool { return team.OrgID == orgID && member[team.ID] }), nil
+}
+
+// teamsWhere returns the matching teams ordered by name.
+func (store *OrgStore) teamsWhere(match func(team *orgs.Team) bool) []*orgs.Team {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	found := make([]*orgs.Team, 0)
+	for _, team := range store.teams {
+		if match(&team) {
+			found = append(found, &team)
+		}
+	}
+	sortBy(found, false, func(team *orgs.Team) string { return team.Name }, func(team *orgs.Team) string { return team.ID })
+	return found
+}
+
+func (store *OrgStore) UpdateTeam(ctx context.Context, team *orgs.Team) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	existing, ok := store.teams[team.ID]
+	if !ok {
+		return orgs.ErrTeamNotFound
+	}
+	if store.teamNamed(existing.OrgID, team.Name, team.ID) {
+		return orgs.ErrTeamExists
+	}
+	existing.Name, existing.Role, existing.UpdatedAt = team.Name, team.Role, team.UpdatedAt
+	store.teams[team.ID] = existing
+	return nil
+}
+
+// DeleteTeam removes a team with its members.
+func (store *OrgStore) DeleteTeam(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.teams[id]; !ok {
+		return orgs.ErrTeamNotFound
+	}
+	store.deleteTeam(id)
+	return nil
+}
+
+func (store *OrgStore) DeleteTeamsByOrgID(ctx context.Context, orgID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, team := range store.teams {
+		if team.OrgID == orgID {
+			store.deleteTeam(id)
+		}
+	}
+	return nil
+}
+
+func (store *OrgStore) CreateTeamMember(ctx context.Context, member *orgs.TeamMember) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := pairKey(member.TeamID, member.UserID)
+	if _, exists := store.teamMembers[key]; exists {
+		return orgs.ErrTeamMemberExists
+	}
+	store.teamMembers[key] = *member
+	return nil
+}
+
+func (store *OrgStore) ListTeamMembers(ctx context.Context, teamID string) ([]*orgs.TeamMember, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	members := make([]*orgs.TeamMember, 0)
+	for _, member := range store.teamMembers {
+		if member.TeamID == teamID {
+			members = append(members, &member)
+		}
+	}
+	sortBy(members, false, func(member *orgs.TeamMember) string { return sortableNanos(member.CreatedAt) },
+		func(member *orgs.TeamMember) string { return member.UserID })
+	return members, nil
+}
+
+func (store *OrgStore) DeleteTeamMember(ctx context.Context, teamID, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := pairKey(teamID, userID)
+	if _, ok := store.teamMembers[key]; !ok {
+		return orgs.ErrTeamMemberNotFound
+	}
+	delete(store.teamMembers, key)
+	return nil
+}
+
+func (store *OrgStore) DeleteTeamMembershipsByUserID(ctx context.Context, orgID, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for key, member := range store.teamMembers {
+		if team, ok := store.teams[member.TeamID]; ok && team.OrgID == orgID && member.UserID == userID {
+			delete(store.teamMembers, key)
+		}
+	}
+	return nil
+}
+
+func (store *OrgStore) Close() error {
+	return nil
+}
+
+// orgNamed returns the organization called name, or nil.
+func (store *OrgStore) orgNamed(name string) *orgs.Org {
+	for _, org := range store.orgs {
+		if org.Name == name {
+			return &org
+		}
+	}
+	return nil
+}
+
+// teamNamed reports whether a team other than exceptID in orgID is
+// called name.
+func (store *OrgStore) teamNamed(orgID, name, exceptID string) bool {
+	for id, team := range store.teams {
+		if id != exceptID && team.OrgID == orgID && team.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteTeam removes a team and its members; the caller holds the lock.
+func (store *OrgStore) deleteTeam(id string) {
+	delete(store.teams, id)
+	for key, member := range store.teamMembers {
+		if member.TeamID == id {
+			delete(store.teamMembers, key)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package testkit
+
+import "github.com/talosaether/chassis/queue"
+
+// QueueStore is the in-memory queue store, queue.MemoryStore. Dequeue
+// claims the oldest pending job atomically, like the SQLite store.
+type QueueStore = queue.MemoryStore
+
+// NewQueueStore creates an empty in-memory queue store.
+func NewQueueStore() *QueueStore {
+	return queue.NewMemoryStore()
+}
@@ -0,0 +1,123 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/talosaether/chassis/auth"
+)
+
+// SessionStore is an in-memory auth.SessionStore. Remember-me tokens and
+// known logins use the auth module's own in-memory fallbacks.
+type SessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]auth.Session
+}
+
+// NewSessionStore creates an empty in-memory session store.
+func NewSessionStore() *SessionStore {
+	return &SessionStore{sessions: make(map[string]auth.Session)}
+}
+
+func (store *SessionStore) Create(ctx context.Context, session *auth.Session) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, exists := store.sessions[session.ID]; exists {
+		return errors.New("testkit: session already exists")
+	}
+	for _, existing := range store.sessions {
+		if existing.Token == session.Token {
+			return errors.New("testkit: session token already exists")
+		}
+	}
+	store.sessions[session.ID] = *session
+	return nil
+}
+
+func (store *SessionStore) GetByID(ctx context.Context, id string) (*auth.Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	session, ok := store.sessions[id]
+	if !ok {
+		return nil, auth.ErrInvalidSession
+	}
+	return &session, nil
+}
+
+func (store *SessionStore) GetByToken(ctx context.Context, token string) (*auth.Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, session := range store.sessions {
+		if session.Token == token {
+			return &session, nil
+		}
+	}
+	return nil, auth.ErrInvalidSession
+}
+
+func (store *SessionStore) Delete(ctx context.Context, id string) error {
+	store.deleteWhere(func(session *auth.Session) bool { return session.ID == id })
+	return nil
+}
+
+func (store *SessionStore) DeleteByToken(ctx context.Context, token string) error {
+	store.deleteWhere(func(session *auth.Session) bool { return session.Token == token })
+	return nil
+}
+
+func (store *SessionStore) DeleteByUserID(ctx context.Context, userID string) error {
+	store.deleteWhere(func(session *auth.Session) bool { return session.UserID == userID })
+	return nil
+}
+
+// DeleteByImpersonatorID removes the sessions an admin started with
+// Impersonate.
+func (store *SessionStore) DeleteByImpersonatorID(ctx context.Context, adminUserID string) error {
+	store.deleteWhere(func(session *auth.Session) bool { return session.ImpersonatorID == adminUserID })
+	return nil
+}
+
+// DeleteExpired removes the sessions that expired before now.
+func (store *SessionStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	return store.deleteWhere(func(session *auth.Session) bool { return !now.Before(session.ExpiresAt) }), nil
+}
+
+// List returns every session, including expired ones, oldest first.
+func (store *SessionStore) List(ctx context.Context) ([]*auth.Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	sessions := make([]*auth.Session, 0, len(store.sessions))
+	for _, session := range store.sessions {
+		sessions = append(sessions, &session)
+	}
+	sortBy(sessions, false, func(session *auth.Session) string { return sortableMillis(session.CreatedAt) },
+		func(session *auth.Session) string { return session.ID })
+	return sessions, nil
+}
+
+// Len returns the number of stored sessions, including expired ones.
+func (store *SessionStore) Len() int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return len(store.sessions)
+}
+
+func (store *SessionStore) Close() error {
+	return nil
+}
+
+// deleteWhere removes the matching sessions and returns how many went.
+func (store *SessionStore) deleteWhere(match func(session *auth.Session) bool) int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deleted := 0
+	for id, session := range store.sessions {
+		if match(&session) {
+			delete(store.sessions, id)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,59 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// StorageProvider is an in-memory storage.Provider.
+type StorageProvider struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewStorageProvider creates an empty in-memory storage provider.
+func NewStorageProvider() *StorageProvider {
+	return &StorageProvider{objects: make(map[string][]byte)}
+}
+
+func (provider *StorageProvider) Put(ctx context.Context, key string, data []byte) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.objects[key] = bytes.Clone(data)
+	return nil
+}
+
+func (provider *StorageProvider) Get(ctx context.Context, key string) ([]byte, error) {
+	provider.mu.RLock()
+	defer provider.mu.RUnlock()
+	data, ok := provider.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return bytes.Clone(data), nil
+}
+
+func (provider *StorageProvider) Delete(ctx context.Context, key string) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	delete(provider.objects, key)
+	return nil
+}
+
+// List returns the keys starting with prefix, sorted.
+func (provider *StorageProvider) List(ctx context.Context, prefix string) ([]string, error) {
+	provider.mu.RLock()
+	defer provider.mu.RUnlock()
+	keys := make([]string, 0)
+	for key := range provider.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
@@ -0,0 +1,225 @@
+// Package testkit provides in-memory stores and a ready-made app for fast
+// unit tests of chassis applications, without SQLite files or type
+// assertions on module accessors.
+//
+// NewApp registers every core module on in-memory stores, captures sent
+// email and records published events, and shuts the app down when the
+// test ends:
+//
+//	func TestInvite(t *testing.T) {
+//	    app := testkit.NewApp(t)
+//	    ann := app.CreateUser(t, "ann@example.com")
+//	    org := app.CreateOrg(t, "Acme", ann.ID)
+//
+//	    // ... exercise code that invites bob@example.com ...
+//
+//	    app.Events.AssertPublished(t, orgs.EventInvitationCreated)
+//	    emailtest.AssertSent(t, app.Inbox, "bob@example.com", "Acme")
+//	}
+//
+// CreateUser, CreateOrg and SessionCookie fail the test on error and
+// return typed values.
+//
+// Application modules are registered after the core ones, and core modules
+// can be configured through their options:
+//
+//	app := testkit.NewApp(t,
+//	    testkit.WithModules(billing.New()),
+//	    testkit.WithPermissions(permissions.WithRolePermissions(roles)),
+//	)
+//
+// The stores can also be used on their own, e.g. users.New(users.WithStore(testkit.NewUserStore())).
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/cache"
+	"github.com/talosaether/chassis/email"
+	"github.com/talosaether/chassis/email/emailtest"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/permissions"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/storage"
+	"github.com/talosaether/chassis/users"
+)
+
+// App is a chassis app for tests with typed access to its core modules.
+type App struct {
+	*chassis.App
+
+	Storage     *storage.Module
+	Users       *users.Module
+	Auth        *auth.Module
+	Orgs        *orgs.Module
+	Permissions *permissions.Module
+	Cache       *cache.Module
+	Queue       *queue.Module
+	Email       *email.Module
+	Events      *Recorder
+
+	// Inbox captures the emails sent through Email; see package emailtest
+	// for assertions.
+	Inbox *email.DevInboxProvider
+}
+
+// options configures NewApp.
+type options struct {
+	chassis     []chassis.Option
+	modules     []chassis.Module
+	users       []users.Option
+	auth        []auth.Option
+	orgs        []orgs.Option
+	permissions []permissions.Option
+	queue       []queue.Option
+}
+
+// Option configures NewApp.
+type Option func(*options)
+
+// WithChassisOptions applies chassis options, such as chassis.WithConfig,
+// before the modules are registered.
+func WithChassisOptions(opts ...chassis.Option) Option {
+	return func(o *options) {
+		o.chassis = append(o.chassis, opts...)
+	}
+}
+
+// WithModules registers application modules after the core modules.
+func WithModules(modules ...chassis.Module) Option {
+	return func(o *options) {
+		o.modules = append(o.modules, modules...)
+	}
+}
+
+// WithUsers configures the users module.
+func WithUsers(opts ...users.Option) Option {
+	return func(o *options) {
+		o.users = append(o.users, opts...)
+	}
+}
+
+// WithAuth configures the auth module.
+func WithAuth(opts ...auth.Option) Option {
+	return func(o *options) {
+		o.auth = append(o.auth, opts...)
+	}
+}
+
+// WithOrgs configures the orgs module.
+func WithOrgs(opts ...orgs.Option) Option {
+	return func(o *options) {
+		o.orgs = append(o.orgs, opts...)
+	}
+}
+
+// WithPermissions configures the permissions module.
+func WithPermissions(opts ...permissions.Option) Option {
+	return func(o *options) {
+		o.permissions = append(o.permissions, opts...)
+	}
+}
+
+// WithQueue configures the queue module.
+func WithQueue(opts ...queue.Option) Option {
+	return func(o *options) {
+		o.queue = append(o.queue, opts...)
+	}
+}
+
+// NewApp creates an app with every core module on in-memory stores. Logs
+// below warnings are discarded, and the app is shut down when the test
+// ends. The test fails if a module doesn't register.
+func NewApp(t testing.TB, opts ...Option) *App {
+	t.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	inbox := emailtest.NewInbox()
+	app := &App{
+		Storage:     storage.New(storage.WithProvider(NewStorageProvider())),
+		Users:       users.New(append([]users.Option{users.WithStore(NewUserStore())}, o.users...)...),
+		Auth:        auth.New(append([]auth.Option{auth.WithStore(NewSessionStore())}, o.auth...)...),
+		Orgs:        orgs.New(append([]orgs.Option{orgs.WithStore(NewOrgStore())}, o.orgs...)...),
+		Permissions: permissions.New(append([]permissions.Option{permissions.WithStore(NewGrantStore())}, o.permissions...)...),
+		Cache:       cache.New(),
+		Queue:       queue.New(append([]queue.Option{queue.WithStore(NewQueueStore())}, o.queue...)...),
+		Email:       email.New(email.WithProvider(inbox)),
+		Events:      NewRecorder(),
+		Inbox:       inbox,
+	}
+
+	modules := []chassis.Module{app.Events, app.Storage, app.Users, app.Auth, app.Orgs, app.Permissions, app.Cache, app.Queue, app.Email}
+	modules = append(modules, o.modules...)
+	chassisOpts := append([]chassis.Option{chassis.WithConfig(&chassis.Config{Env: "test", LogLevel: slog.LevelWarn})}, o.chassis...)
+	app.App = chassis.New(append(chassisOpts, chassis.WithModules(modules...))...)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := app.Shutdown(ctx); err != nil {
+			t.Errorf("testkit: shutdown failed: %v", err)
+		}
+	})
+
+	for _, mod := range modules {
+		if !app.HasModule(mod.Name()) {
+			t.Fatalf("testkit: module %q failed to register; see the log", mod.Name())
+		}
+	}
+	return app
+}
+
+// sortBy sorts items by key, then by id, keeping the order of ties.
+func sortBy[T any](items []T, descending bool, key, id func(T) string) {
+	slices.SortStableFunc(items, func(a, b T) int {
+		order := strings.Compare(key(a), key(b))
+		if order == 0 {
+			order = strings.Compare(id(a), id(b))
+		}
+		if descending {
+			return -order
+		}
+		return order
+	})
+}
+
+// sortableMillis formats a time as Unix milliseconds that sort as
+// strings, like the created_ms columns of the SQLite stores.
+func sortableMillis(t time.Time) string {
+	return sortableInt(int(t.UnixMilli()))
+}
+
+// sortableNanos formats a time so that later times sort after.
+func sortableNanos(t time.Time) string {
+	return sortableInt(int(t.UnixNano()))
+}
+
+func sortableInt(value int) string {
+	return fmt.Sprintf("%020d", value)
+}
+
+// page returns items[offset:offset+limit], clamped to the slice.
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
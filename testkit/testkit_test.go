@@ -0,0 +1,237 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/auth"
+	"github.com/talosaether/chassis/email/emailtest"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/users"
+)
+
+func TestNewApp(t *testing.T) {
+	app := NewApp(t)
+	ctx := context.Background()
+
+	ann := app.CreateUser(t, "ann@example.com")
+	org := app.CreateOrg(t, "Acme", ann.ID)
+	if !app.Permissions.Can(ctx, ann.ID, "org:delete", org.ID()) {
+		t.Error("owner should be allowed to delete the org")
+	}
+	created := Payload[*orgs.OrgEvent](t, app.Events.AssertPublished(t, orgs.EventOrgCreated))
+	if created.OrgID != org.ID() {
+		t.Errorf("expected org.created for %s, got %+v", org.ID(), created)
+	}
+	app.Events.AssertNotPublished(t, orgs.EventMemberRemoved)
+
+	if err := app.Email.Send(ctx, "ann@example.com", "Welcome to Acme", "Hi Ann"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	emailtest.AssertSent(t, app.Inbox, "ann@example.com", "Welcome")
+
+	if err := app.Storage.Put(ctx, "docs/a.txt", []byte("a")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if keys, _ := app.Storage.List(ctx, "docs/"); len(keys) != 1 || keys[0] != "docs/a.txt" {
+		t.Errorf("expected the stored key, got %v", keys)
+	}
+
+	if _, err := app.Queue.Enqueue(ctx, "send_report", map[string]string{"org": org.ID()}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	job, err := app.Queue.Dequeue(ctx)
+	if err != nil || job.(*queue.Job).Type != "send_report" {
+		t.Errorf("expected the job back, got %v, %v", job, err)
+	}
+
+	var userID string
+	handler := app.Auth.RequireAuth(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		userID = auth.UserIDFromContext(request.Context())
+	}))
+	request := httptest.NewRequest(http.MethodGet, "/me", nil)
+	request.AddCookie(app.SessionCookie(t, "ann@example.com"))
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if userID != ann.ID {
+		t.Errorf("expected the session of %s, got %q", ann.ID, userID)
+	}
+}
+
+// billing is an application module registered after the core modules.
+type billing struct{ usersFound bool }
+
+func (*billing) Name() string { return "billing" }
+func (mod *billing) Init(ctx context.Context, app *chassis.App) error {
+	mod.usersFound = app.HasModule("users")
+	return nil
+}
+func (*billing) Shutdown(ctx context.Context) error { return nil }
+
+func TestNewApp_Options(t *testing.T) {
+	mod := &billing{}
+	app := NewApp(t, WithModules(mod), WithUsers(users.WithPasswordPolicy(users.Policy{MinLength: 30})))
+	if !mod.usersFound {
+		t.Error("application modules should register after the core modules")
+	}
+	if _, err := app.Users.Create(context.Background(), "ann@example.com", "short-password"); !errors.Is(err, users.ErrWeakPassword) {
+		t.Errorf("expected the module options to apply, got %v", err)
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	store := NewUserStore()
+	ctx := context.Background()
+	now := time.Now()
+	for i, email := range []string{"ann@example.com", "Bob@example.com", "cat@example.org"} {
+		user := &users.User{ID: fmt.Sprint("user-", i), Email: email, CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if err := store.Create(ctx, &users.User{ID: "user-9", Email: "ann@example.com"}); !errors.Is(err, users.ErrEmailExists) {
+		t.Errorf("expected ErrEmailExists, got %v", err)
+	}
+	if user, err := store.GetByEmail(ctx, "bob@EXAMPLE.com"); err != nil || user.ID != "user-1" {
+		t.Errorf("expected a case-insensitive match, got %v, %v", user, err)
+	}
+
+	newest, _ := store.List(ctx, users.ListOptions{}, 0, 2)
+	if len(newest) != 2 || newest[0].ID != "user-2" || newest[1].ID != "user-1" {
+		t.Errorf("expected newest first, got %v", newest)
+	}
+	matched, _ := store.List(ctx, users.ListOptions{Query: "EXAMPLE.COM", SortBy: "email"}, 0, 10)
+	if len(matched) != 2 || matched[0].Email != "Bob@example.com" {
+		t.Errorf("expected the .com users by email, got %v", matched)
+	}
+	if count, _ := store.Count(ctx, users.ListOptions{CreatedAfter: now}); count != 2 {
+		t.Errorf("expected 2 users created after the first, got %d", count)
+	}
+	if _, err := store.List(ctx, users.ListOptions{SortBy: "password"}, 0, 10); !errors.Is(err, users.ErrInvalidSort) {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+
+	newest[0].Email = "changed@example.com"
+	if user, _ := store.GetByID(ctx, "user-2"); user.Email != "cat@example.org" {
+		t.Error("returned users should be copies")
+	}
+}
+
+func TestOrgStore(t *testing.T) {
+	app := NewApp(t)
+	ctx := context.Background()
+	ann := app.CreateUser(t, "ann@example.com")
+	bob := app.CreateUser(t, "bob@example.com")
+	acme := app.CreateOrg(t, "Acme", ann.ID)
+	app.CreateOrg(t, "Zeta", ann.ID)
+	if _, err := app.Orgs.AddMember(ctx, acme.ID(), bob.ID, "member"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	if _, err := app.Orgs.AddMember(ctx, acme.ID(), bob.ID, "member"); !errors.Is(err, orgs.ErrMemberExists) {
+		t.Errorf("expected ErrMemberExists, got %v", err)
+	}
+
+	result, err := app.Orgs.List(ctx, orgs.ListOptions{SortBy: "-members"})
+	if err != nil || len(result.Items) != 2 || result.Items[0].Name != "Acme" || result.Items[0].MemberCount != 2 {
+		t.Fatalf("expected Acme first with 2 members, got %+v, %v", result, err)
+	}
+
+	team, err := app.Orgs.CreateTeam(ctx, acme.ID(), "Ops", "admin")
+	if err != nil {
+		t.Fatalf("CreateTeam failed: %v", err)
+	}
+	if _, err := app.Orgs.AddTeamMember(ctx, team.ID, bob.ID); err != nil {
+		t.Fatalf("AddTeamMember failed: %v", err)
+	}
+	if admin, _ := app.Orgs.GetOrgsWithRole(ctx, bob.ID, "admin"); len(admin) != 1 || admin[0].ID() != acme.ID() {
+		t.Errorf("expected the team role in Acme, got %v", admin)
+	}
+
+	if err := app.Orgs.TransferOwnership(ctx, acme.ID(), ann.ID, bob.ID); err != nil {
+		t.Fatalf("TransferOwnership failed: %v", err)
+	}
+	if role := app.Orgs.GetUserRole(ctx, acme.ID(), ann.ID); role != "admin" {
+		t.Errorf("expected the previous owner to become admin, got %q", role)
+	}
+}
+
+func TestQueueStore_DequeueIsAtomic(t *testing.T) {
+	store := NewQueueStore()
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 50; i++ {
+		job := &queue.Job{ID: fmt.Sprint("job-", i), Type: "work", Status: queue.StatusPending, CreatedAt: now.Add(time.Duration(i))}
+		if err := store.Create(ctx, job); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	claimed := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := store.Dequeue(ctx)
+				if errors.Is(err, queue.ErrNoJobs) {
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != 50 {
+		t.Errorf("expected every job claimed, got %d", len(claimed))
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Errorf("job %s claimed %d times", id, count)
+		}
+	}
+	if count, _ := store.CountByStatus(ctx, queue.StatusProcessing); count != 50 {
+		t.Errorf("expected 50 processing jobs, got %d", count)
+	}
+	if jobs, _ := store.GetAllPaginated(ctx, 0, 1); len(jobs) != 1 || jobs[0].ID != "job-49" {
+		t.Errorf("expected newest first, got %v", jobs)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+	app := chassis.New(chassis.WithModules(recorder))
+	ctx := context.Background()
+
+	delivered := 0
+	recorder.Subscribe("thing.happened", func(ctx context.Context, eventType string, payload any) error {
+		delivered++
+		return nil
+	})
+	app.PublishEvent(ctx, "thing.happened", 1)
+	app.PublishEvent(ctx, "other.happened", 2)
+	app.PublishEvent(ctx, "thing.happened", 3)
+
+	if delivered != 2 {
+		t.Errorf("recorded events should still be delivered, got %d", delivered)
+	}
+	if event := recorder.AssertPublished(t, "thing.happened"); Payload[int](t, event) != 3 {
+		t.Errorf("expected the most recent event, got %+v", event)
+	}
+	if all := recorder.Events(); len(all) != 3 {
+		t.Errorf("expected 3 events, got %d", len(all))
+	}
+	recorder.Reset()
+	recorder.AssertNotPublished(t, "thing.happened")
+}
@@ -0,0 +1,154 @@
+package testkit
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/talosaether/chassis/users"
+)
+
+// UserStore is an in-memory users.Store.
+type UserStore struct {
+	mu    sync.RWMutex
+	users map[string]users.User
+}
+
+// NewUserStore creates an empty in-memory user store.
+func NewUserStore() *UserStore {
+	return &UserStore{users: make(map[string]users.User)}
+}
+
+func (store *UserStore) Create(ctx context.Context, user *users.User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, exists := store.users[user.ID]; exists || store.emailTaken(user.Email, "") {
+		return users.ErrEmailExists
+	}
+	store.users[user.ID] = copyUser(user)
+	return nil
+}
+
+func (store *UserStore) GetByID(ctx context.Context, id string) (*users.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user, ok := store.users[id]
+	if !ok {
+		return nil, users.ErrNotFound
+	}
+	return ptr(copyUser(&user)), nil
+}
+
+// GetByEmail ignores case like the SQLite store; an exact match wins.
+func (store *UserStore) GetByEmail(ctx context.Context, email string) (*users.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var found *users.User
+	for _, user := range store.users {
+		if user.Email == email {
+			return ptr(copyUser(&user)), nil
+		}
+		if found == nil && strings.EqualFold(user.Email, email) {
+			found = ptr(copyUser(&user))
+		}
+	}
+	if found == nil {
+		return nil, users.ErrNotFound
+	}
+	return found, nil
+}
+
+func (store *UserStore) Update(ctx context.Context, user *users.User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	existing, ok := store.users[user.ID]
+	if !ok {
+		return users.ErrNotFound
+	}
+	if store.emailTaken(user.Email, user.ID) {
+		return users.ErrEmailExists
+	}
+	updated := copyUser(user)
+	updated.CreatedAt = existing.CreatedAt
+	store.users[user.ID] = updated
+	return nil
+}
+
+func (store *UserStore) Delete(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.users[id]; !ok {
+		return users.ErrNotFound
+	}
+	delete(store.users, id)
+	return nil
+}
+
+func (store *UserStore) List(ctx context.Context, opts users.ListOptions, offset, limit int) ([]*users.User, error) {
+	matched, err := store.matching(opts)
+	if err != nil {
+		return nil, err
+	}
+	return page(matched, offset, limit), nil
+}
+
+func (store *UserStore) Count(ctx context.Context, opts users.ListOptions) (int, error) {
+	matched, err := store.matching(opts)
+	return len(matched), err
+}
+
+func (store *UserStore) Close() error {
+	return nil
+}
+
+// matching returns the users matching opts, sorted like the SQLite store.
+func (store *UserStore) matching(opts users.ListOptions) ([]*users.User, error) {
+	field, descending := strings.CutPrefix(opts.SortBy, "-")
+	if opts.SortBy == "" {
+		descending = true
+	}
+	var key func(user *users.User) string
+	switch field {
+	case "", "created_at":
+		key = func(user *users.User) string { return sortableMillis(user.CreatedAt) }
+	case "email":
+		key = func(user *users.User) string { return user.Email }
+	case "name":
+		key = func(user *users.User) string { return user.Name }
+	default:
+		return nil, users.ErrInvalidSort
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	query := strings.ToLower(opts.Query)
+	matched := make([]*users.User, 0)
+	for _, user := range store.users {
+		if query != "" && !strings.Contains(strings.ToLower(user.Email), query) && !strings.Contains(strings.ToLower(user.Name), query) {
+			continue
+		}
+		if !opts.CreatedAfter.IsZero() && user.CreatedAt.UnixMilli() <= opts.CreatedAfter.UnixMilli() {
+			continue
+		}
+		matched = append(matched, ptr(copyUser(&user)))
+	}
+	sortBy(matched, descending, key, func(user *users.User) string { return user.ID })
+	return matched, nil
+}
+
+// emailTaken reports whether a user other than exceptID has email.
+func (store *UserStore) emailTaken(email, exceptID string) bool {
+	for id, user := range store.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func copyUser(user *users.User) users.User {
+	copied := *user
+	copied.Metadata = maps.Clone(user.Metadata)
+	return copied
+}
@@ -0,0 +1,154 @@
+package chassis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTxDone is returned by EnlistTx for a transaction that has already
+// committed or rolled back, e.g. when a goroutine started inside app.Tx
+// outlives it.
+var ErrTxDone = NewError(CodeFailedPrecondition, "transaction already finished")
+
+// Transaction is a store's part of an app.Tx. *sql.Tx implements it.
+type Transaction interface {
+	Commit() error
+	Rollback() error
+}
+
+// txState is the coordinator an app.Tx puts in its context.
+type txState struct {
+	mu   sync.Mutex
+	keys []any // in the order they enlisted
+	txs  map[any]Transaction
+	errs []error // failures to enlist, which fail the whole transaction
+	done bool
+}
+
+type txContextKey struct{}
+
+// Tx runs fn in a transaction shared by the stores it calls. Stores that
+// participate (users, orgs and auth) find the transaction in the context
+// and enlist, so their writes either all commit when fn returns nil or all
+// roll back when it returns an error or panics:
+//
+//	err := app.Tx(ctx, func(ctx context.Context) error {
+//	    user, err := app.Users().Create(ctx, email, password)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    _, err = app.Orgs().AddMember(ctx, orgID, user.(*users.User).ID, "member")
+//	    return err
+//	})
+//
+// Stores on the same database pool share one transaction, so their commit
+// is atomic. Stores on separate pools each get their own, committed in the
+// order they enlisted once fn succeeds; a failing commit rolls back the
+// ones after it, but can't undo those before. Point the participating
+// modules at one named database where that matters (see Database); stores
+// opening the same file separately would wait on each other's write lock.
+// Calling Tx inside fn joins the outer transaction.
+//
+// Only work done with the context passed to fn takes part. The users and
+// orgs lifecycle events go through their outbox, so they are published by
+// its relay after the commit, and not at all on a rollback. Other events
+// are still published when they happen, so handlers may see records that
+// are later rolled back; use the outbox for events that must follow a
+// commit.
+func (app *App) Tx(ctx context.Context, fn func(txCtx context.Context) error) (err error) {
+	if InTx(ctx) {
+		return fn(ctx)
+	}
+	state := &txState{txs: make(map[any]Transaction)}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_ = state.finish(false)
+			panic(recovered)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, state)); err != nil {
+		if rollbackErr := state.finish(false); rollbackErr != nil {
+			app.logger.ErrorContext(ctx, "failed to roll back transaction", "error", rollbackErr)
+		}
+		return err
+	}
+	return state.finish(true)
+}
+
+// InTx reports whether ctx is inside app.Tx.
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txContextKey{}).(*txState)
+	return ok
+}
+
+// EnlistTx returns the transaction of the store database identified by key,
+// such as its *sql.DB, in ctx's app.Tx, calling begin to start it the first
+// time the key is enlisted. Keys must be comparable. Outside app.Tx it
+// returns nil, nil and the store runs statements directly. If begin fails,
+// the app.Tx fails with its error.
+func EnlistTx(ctx context.Context, key any, begin func() (Transaction, error)) (Transaction, error) {
+	state, ok := ctx.Value(txContextKey{}).(*txState)
+	if !ok {
+		return nil, nil
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.done {
+		return nil, ErrTxDone
+	}
+	if tx, ok := state.txs[key]; ok {
+		return tx, nil
+	}
+	tx, err := begin()
+	if err != nil {
+		err = fmt.Errorf("failed to begin transaction on %s: %w", txKeyName(key), err)
+		state.errs = append(state.errs, err)
+		return nil, err
+	}
+	state.keys = append(state.keys, key)
+	state.txs[key] = tx
+	return tx, nil
+}
+
+// finish commits or rolls back every enlisted transaction. A failure to
+// enlist turns a commit into a rollback.
+func (state *txState) finish(commit bool) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.done = true
+
+	var errs []error
+	if commit && len(state.errs) > 0 {
+		errs = append(errs, state.errs...)
+		commit = false
+	}
+	for _, key := range state.keys {
+		tx := state.txs[key]
+		if !commit {
+			if err := tx.Rollback(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to roll back %s: %w", txKeyName(key), err))
+			}
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to commit %s: %w", txKeyName(key), err))
+			commit = false
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// txKeyName describes an enlisted key in errors: the key itself if it is a
+// string or a fmt.Stringer, otherwise its type.
+func txKeyName(key any) string {
+	switch key := key.(type) {
+	case string:
+		return key
+	case fmt.Stringer:
+		return key.String()
+	}
+	return fmt.Sprintf("%T", key)
+}
@@ -0,0 +1,74 @@
+package users
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Length limits from RFC 5321.
+const (
+	maxEmailLength  = 254
+	maxLocalLength  = 64
+	maxDomainLength = 253
+)
+
+// NormalizeEmail validates an email address and returns it trimmed and
+// lowercased, as stored and looked up by the module. Display names
+// ("Ann <ann@example.com>"), missing or malformed domains and over-long
+// addresses fail with ErrInvalidEmail. With canonicalizePlus, a "+tag"
+// suffix of the local part is dropped, so "ann+news@example.com" becomes
+// "ann@example.com".
+func NormalizeEmail(email string, canonicalizePlus bool) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+	parsed, err := mail.ParseAddress(email)
+	if err != nil || parsed.Name != "" || parsed.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	local, domain, _ := strings.Cut(email, "@")
+	if len(local) > maxLocalLength || !validDomain(domain) {
+		return "", ErrInvalidEmail
+	}
+	if canonicalizePlus {
+		if base, _, found := strings.Cut(local, "+"); found && base != "" {
+			local = base
+		}
+	}
+	return local + "@" + domain, nil
+}
+
+// validDomain checks that domain is a dotted hostname with labels of
+// letters, digits and inner hyphens.
+func validDomain(domain string) bool {
+	if len(domain) > maxDomainLength || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, char := range label {
+			if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// normalizeEmail normalizes with the module's settings.
+func (mod *Module) normalizeEmail(email string) (string, error) {
+	return NormalizeEmail(email, mod.canonicalizePlus)
+}
+
+// lookupEmail returns the form of email to look up: normalized when valid,
+// otherwise just trimmed and lowercased, to find nothing rather than fail.
+func (mod *Module) lookupEmail(email string) string {
+	if normalized, err := mod.normalizeEmail(email); err == nil {
+		return normalized
+	}
+	return strings.ToLower(strings.TrimSpace(email))
+}
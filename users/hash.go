@@ -0,0 +1,265 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashParams are the Argon2id parameters new password hashes use. They
+// are encoded into each hash, so raising them later only affects new
+// hashes; older ones still verify and are re-hashed at the next login.
+type HashParams struct {
+	Time    uint32 // iterations
+	Memory  uint32 // in KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// DefaultHashParams are the parameters used unless WithHashParams is set.
+var DefaultHashParams = HashParams{Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+
+// WithHashParams sets the Argon2id parameters of new password hashes.
+func WithHashParams(params HashParams) Option {
+	return func(opts *Options) {
+		opts.HashParams = &params
+	}
+}
+
+// hashPassword hashes password with the default parameters.
+func hashPassword(password string) (string, error) {
+	return DefaultHashParams.hash(password)
+}
+
+// hash returns password hashed in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+func (params HashParams) hash(password string) (string, error) {
+	salt := make([]byte, params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// maxHashMemory bounds the memory, in KiB, of the hashes the module
+// accepts, so an imported hash can't exhaust memory at login.
+const maxHashMemory = 4 * 1024 * 1024 // 4 GiB
+
+// validate reports parameters argon2.IDKey can't hash with, which would
+// make it panic, or that would exhaust memory.
+func (params HashParams) validate() error {
+	switch {
+	case params.Time < 1:
+		return errors.New("time must be at least 1")
+	case params.Threads < 1:
+		return errors.New("threads must be at least 1")
+	case params.Memory < 8*uint32(params.Threads) || params.Memory > maxHashMemory:
+		return fmt.Errorf("memory must be between %d and %d KiB with %d threads", 8*uint32(params.Threads), maxHashMemory, params.Threads)
+	case params.KeyLen < 1:
+		return errors.New("key length must be at least 1")
+	}
+	return nil
+}
+
+// legacyHashParams are the parameters of hashes stored as "salt$hash",
+// before the parameters were encoded.
+var legacyHashParams = HashParams{Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+
+// verifyPassword reports whether password matches encoded, which may be a
+// PHC Argon2id hash, a legacy "salt$hash" or a bcrypt hash.
+func verifyPassword(password, encoded string) bool {
+	switch {
+	case isBcrypt(encoded):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := parseArgon2(encoded)
+		if err != nil {
+			return false
+		}
+		return argonMatches(password, params, salt, key)
+	}
+
+	saltB64, keyB64, ok := strings.Cut(encoded, "$")
+	if !ok || saltB64 == "" || keyB64 == "" {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(saltB64)
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return false
+	}
+	return argonMatches(password, legacyHashParams, salt, key)
+}
+
+func argonMatches(password string, params HashParams, salt, key []byte) bool {
+	actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1
+}
+
+// parseArgon2 decodes a PHC Argon2id hash, failing with ErrUnsupportedHash
+// for parameters the module can't verify with.
+func parseArgon2(encoded string) (HashParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return HashParams{}, nil, nil, ErrUnsupportedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return HashParams{}, nil, nil, ErrUnsupportedHash
+	}
+	var params HashParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return HashParams{}, nil, nil, ErrUnsupportedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return HashParams{}, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return HashParams{}, nil, nil, ErrUnsupportedHash
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	if err := params.validate(); err != nil {
+		return HashParams{}, nil, nil, ErrUnsupportedHash
+	}
+	return params, salt, key, nil
+}
+
+func isBcrypt(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsRehash reports whether encoded was made by another algorithm or
+// with other parameters than params.
+func needsRehash(encoded string, params HashParams) bool {
+	current, _, _, err := parseArgon2(encoded)
+	return err != nil || current != params
+}
+
+// checkHash reports whether encoded is a hash the module can verify, for
+// imports.
+func checkHash(encoded string) error {
+	if isBcrypt(encoded) {
+		if _, err := bcrypt.Cost([]byte(encoded)); err != nil {
+			return ErrUnsupportedHash
+		}
+		return nil
+	}
+	_, _, _, err := parseArgon2(encoded)
+	return err
+}
+
+// hashParamsFromConfig overrides the fields of params set under
+// users.password_hash:
+//
+//	users:
+//	  password_hash:
+//	    time: 3
+//	    memory: 131072 # KiB
+//	    threads: 4
+//
+// Parameters Argon2id can't hash with fail with chassis.ErrInvalidConfig.
+func hashParamsFromConfig(cfg chassis.ConfigData, params HashParams) (HashParams, error) {
+	section := cfg.Section("users.password_hash")
+	if section == nil {
+		return params, nil
+	}
+	for _, setting := range []struct {
+		key   string
+		max   int
+		field func(value int)
+	}{
+		{"time", math.MaxUint32, func(value int) { params.Time = uint32(value) }},
+		{"memory", maxHashMemory, func(value int) { params.Memory = uint32(value) }},
+		{"threads", math.MaxUint8, func(value int) { params.Threads = uint8(value) }},
+	} {
+		if section.Get(setting.key) == nil {
+			continue
+		}
+		value := section.GetInt(setting.key)
+		if value < 1 || value > setting.max {
+			return params, fmt.Errorf("%w: users.password_hash.%s: %d is not between 1 and %d", chassis.ErrInvalidConfig, setting.key, value, setting.max)
+		}
+		setting.field(value)
+	}
+	if err := params.validate(); err != nil {
+		return params, fmt.Errorf("%w: users.password_hash: %w", chassis.ErrInvalidConfig, err)
+	}
+	return params, nil
+}
+
+// rehash stores password hashed with the module's current parameters.
+func (mod *Module) rehash(ctx context.Context, user *User, password string) error {
+	hash, err := mod.hashParams.hash(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return mod.store.Update(ctx, user)
+}
+
+// Import creates a user with an existing password hash, for migrations
+// from other systems. passwordHash must be a PHC Argon2id or a bcrypt
+// ($2a$, $2b$, $2y$) hash; it is upgraded to the module's parameters at
+// the user's first login.
+func (mod *Module) Import(ctx context.Context, email, passwordHash string) (*User, error) {
+	email, err := mod.normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHash(passwordHash); err != nil {
+		return nil, err
+	}
+
+	existing, err := mod.store.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+	if existing != nil {
+		return nil, ErrEmailExists
+	}
+
+	now := time.Now()
+	user := &User{
+		ID:           uuid.New().String(),
+		Email:        email,
+		PasswordHash: passwordHash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	err = mod.write(ctx, EventUserCreated, &UserEvent{UserID: user.ID, Email: user.Email}, func(ctx context.Context) error {
+		if err := mod.store.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,313 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+var (
+	ErrIdentityNotFound = chassis.NewError(chassis.CodeNotFound, "identity not found")
+	ErrIdentityLinked   = chassis.NewError(chassis.CodeAlreadyExists, "identity is linked to another user")
+	ErrLinkRequired     = chassis.NewError(chassis.CodeAlreadyExists, "an account with this email exists; sign in to link the identity")
+	ErrLastIdentity     = chassis.NewError(chassis.CodeFailedPrecondition, "cannot unlink the user's only way to sign in")
+	ErrInvalidIdentity  = chassis.NewError(chassis.CodeInvalidArgument, "identity needs a provider and subject")
+)
+
+// Identity providers built into the chassis. Apps can use any other
+// provider name, such as "github". Passwords aren't stored as identities:
+// a user with a password hash can always sign in with it.
+const (
+	ProviderGoogle    = "google"
+	ProviderMagicLink = "magic_link" // subject is the email the links are sent to
+)
+
+// Events published when identities are linked and unlinked. The payload
+// is an *IdentityEvent.
+const (
+	EventIdentityLinked   = "user.identity_linked"
+	EventIdentityUnlinked = "user.identity_unlinked"
+)
+
+// IdentityEvent is the payload of identity events.
+type IdentityEvent struct {
+	UserID   string
+	Provider string
+	Subject  string
+}
+
+// Identity is a way for a user to sign in other than their password, such
+// as a Google account. Subject is the provider's ID for the account, e.g.
+// the "sub" claim of a Google ID token.
+type Identity struct {
+	ID        string
+	UserID    string
+	Provider  string
+	Subject   string
+	Email     string // email the provider reported, which may differ from the user's
+	Verified  bool   // whether the provider verified Email
+	CreatedAt time.Time
+}
+
+// IdentityInput describes an identity asserted by a provider, as passed to
+// LinkIdentity and SignInWithIdentity.
+type IdentityInput struct {
+	Provider string
+	Subject  string
+	Email    string
+	Verified bool
+}
+
+// IdentityStore stores identities. SQLiteStore implements it; other
+// stores fall back to an in-memory record.
+type IdentityStore interface {
+	CreateIdentity(ctx context.Context, identity *Identity) error
+	// GetIdentity returns ErrIdentityNotFound if no user has linked it.
+	GetIdentity(ctx context.Context, provider, subject string) (*Identity, error)
+	ListIdentities(ctx context.Context, userID string) ([]*Identity, error)
+	DeleteIdentity(ctx context.Context, userID, provider, subject string) error
+	DeleteIdentitiesByUser(ctx context.Context, userID string) error
+}
+
+// WithVerifiedEmailLinking makes SignInWithIdentity link an identity to the
+// existing user with the same email when the provider verified it, instead
+// of returning ErrLinkRequired. Only enable it for providers whose email
+// verification you trust.
+func WithVerifiedEmailLinking() Option {
+	return func(opts *Options) {
+		opts.LinkVerifiedEmails = true
+	}
+}
+
+// LinkIdentity links an identity to a user, so either can sign them in.
+// input must be an IdentityInput; the result is an *Identity. Linking an
+// identity the user already has returns it unchanged, and one linked to
+// another user fails with ErrIdentityLinked.
+func (mod *Module) LinkIdentity(ctx context.Context, userID string, input any) (any, error) {
+	identityInput, ok := input.(IdentityInput)
+	if !ok {
+		return nil, fmt.Errorf("invalid input type: expected IdentityInput")
+	}
+	return mod.linkIdentity(ctx, userID, identityInput)
+}
+
+// linkIdentity is the internal implementation.
+func (mod *Module) linkIdentity(ctx context.Context, userID string, input IdentityInput) (*Identity, error) {
+	if input.Provider == "" || input.Subject == "" {
+		return nil, ErrInvalidIdentity
+	}
+	if _, err := mod.store.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	existing, err := mod.identityStore().GetIdentity(ctx, input.Provider, input.Subject)
+	switch {
+	case err == nil && existing.UserID == userID:
+		return existing, nil
+	case err == nil:
+		return nil, ErrIdentityLinked
+	case !errors.Is(err, ErrIdentityNotFound):
+		return nil, err
+	}
+
+	identity := &Identity{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Provider:  input.Provider,
+		Subject:   input.Subject,
+		Email:     input.Email,
+		Verified:  input.Verified,
+		CreatedAt: time.Now(),
+	}
+	if err := mod.identityStore().CreateIdentity(ctx, identity); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	mod.app.PublishEvent(ctx, EventIdentityLinked, &IdentityEvent{UserID: userID, Provider: identity.Provider, Subject: identity.Subject})
+	return identity, nil
+}
+
+// UnlinkIdentity removes an identity from a user. It fails with
+// ErrLastIdentity if the user has no password and no other identity, since
+// they couldn't sign in again.
+func (mod *Module) UnlinkIdentity(ctx context.Context, userID, provider, subject string) error {
+	user, err := mod.store.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	identities, err := mod.identityStore().ListIdentities(ctx, userID)
+	if err != nil {
+		return err
+	}
+	index := slices.IndexFunc(identities, func(identity *Identity) bool {
+		return identity.Provider == provider && identity.Subject == subject
+	})
+	if index < 0 {
+		return ErrIdentityNotFound
+	}
+	if user.PasswordHash == "" && len(identities) == 1 {
+		return ErrLastIdentity
+	}
+
+	if err := mod.identityStore().DeleteIdentity(ctx, userID, provider, subject); err != nil {
+		return err
+	}
+	mod.app.PublishEvent(ctx, EventIdentityUnlinked, &IdentityEvent{UserID: userID, Provider: provider, Subject: subject})
+	return nil
+}
+
+// Identities returns the identities linked to a user, oldest first.
+func (mod *Module) Identities(ctx context.Context, userID string) ([]*Identity, error) {
+	if _, err := mod.store.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return mod.identityStore().ListIdentities(ctx, userID)
+}
+
+// SignInWithIdentity returns the user an identity signs in, after the app
+// has verified the provider's assertion (e.g. a Google ID token or a magic
+// link). An unknown identity creates a user without a password, unless its
+// email belongs to an existing user: then it fails with ErrLinkRequired,
+// so the user proves they own the account by signing in to it and calling
+// LinkIdentity, rather than anyone controlling a provider account with
+// that email taking it over. With WithVerifiedEmailLinking, an identity
+// whose email the provider verified is linked to the existing user
+// instead. created reports whether a user was created.
+func (mod *Module) SignInWithIdentity(ctx context.Context, input IdentityInput) (user *User, created bool, err error) {
+	if input.Provider == "" || input.Subject == "" {
+		return nil, false, ErrInvalidIdentity
+	}
+	identity, err := mod.identityStore().GetIdentity(ctx, input.Provider, input.Subject)
+	if err == nil {
+		user, err := mod.store.GetByID(ctx, identity.UserID)
+		return user, false, err
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, false, err
+	}
+
+	email, err := mod.normalizeEmail(input.Email)
+	if err != nil {
+		return nil, false, err
+	}
+	existing, err := mod.store.GetByEmail(ctx, email)
+	switch {
+	case err == nil && mod.linkVerifiedEmails && input.Verified:
+		if _, err := mod.linkIdentity(ctx, existing.ID, input); err != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	case err == nil:
+		return nil, false, ErrLinkRequired
+	case !errors.Is(err, ErrNotFound):
+		return nil, false, err
+	}
+
+	now := time.Now()
+	user = &User{
+		ID:        uuid.New().String(),
+		Email:     email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = mod.write(ctx, EventUserCreated, &UserEvent{UserID: user.ID, Email: user.Email}, func(ctx context.Context) error {
+		if err := mod.store.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		_, err := mod.linkIdentity(ctx, user.ID, input)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
+
+// identityStore returns the user store's IdentityStore, or an in-memory
+// one for stores without.
+func (mod *Module) identityStore() IdentityStore {
+	mod.identitiesOnce.Do(func() {
+		if identities, ok := mod.store.(IdentityStore); ok {
+			mod.identities = identities
+		} else {
+			mod.identities = NewMemoryIdentityStore()
+		}
+	})
+	return mod.identities
+}
+
+// MemoryIdentityStore keeps identities in process memory.
+type MemoryIdentityStore struct {
+	mu         sync.Mutex
+	identities []*Identity // oldest first
+}
+
+// NewMemoryIdentityStore creates an in-memory identity store.
+func NewMemoryIdentityStore() *MemoryIdentityStore {
+	return &MemoryIdentityStore{}
+}
+
+func (store *MemoryIdentityStore) CreateIdentity(ctx context.Context, identity *Identity) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, existing := range store.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return ErrIdentityLinked
+		}
+	}
+	copied := *identity
+	store.identities = append(store.identities, &copied)
+	return nil
+}
+
+func (store *MemoryIdentityStore) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, identity := range store.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+	return nil, ErrIdentityNotFound
+}
+
+func (store *MemoryIdentityStore) ListIdentities(ctx context.Context, userID string) ([]*Identity, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	identities := make([]*Identity, 0)
+	for _, identity := range store.identities {
+		if identity.UserID == userID {
+			copied := *identity
+			identities = append(identities, &copied)
+		}
+	}
+	return identities, nil
+}
+
+func (store *MemoryIdentityStore) DeleteIdentity(ctx context.Context, userID, provider, subject string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	before := len(store.identities)
+	store.identities = slices.DeleteFunc(store.identities, func(identity *Identity) bool {
+		return identity.UserID == userID && identity.Provider == provider && identity.Subject == subject
+	})
+	if len(store.identities) == before {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+func (store *MemoryIdentityStore) DeleteIdentitiesByUser(ctx context.Context, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.identities = slices.DeleteFunc(store.identities, func(identity *Identity) bool {
+		return identity.UserID == userID
+	})
+	return nil
+}
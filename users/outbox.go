@@ -0,0 +1,68 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/internal/sqlite"
+	"github.com/talosaether/chassis/outbox"
+)
+
+// openOutbox makes the module write its lifecycle events (user created,
+// updated and deleted) to an outbox in db, in the same transaction as the
+// change, and relay them to the events module. Without an events module
+// there is nothing to relay to, and none is opened.
+func (mod *Module) openOutbox(ctx context.Context, db *sql.DB) error {
+	eventsMod, ok := mod.app.TryEvents()
+	if !ok {
+		return nil
+	}
+	box, err := outbox.New(ctx, db, outbox.WithSource("users"))
+	if err != nil {
+		return fmt.Errorf("failed to create users outbox: %w", err)
+	}
+	newUserEvent := func() any { return &UserEvent{} }
+	mod.outbox = box
+	mod.outboxDB = db
+	mod.relay = outbox.NewRelay(box, eventsMod,
+		outbox.WithLogger(mod.app.Logger()),
+		outbox.WithPayloadType(EventUserCreated, newUserEvent),
+		outbox.WithPayloadType(EventUserUpdated, newUserEvent),
+		outbox.WithPayloadType(EventUserDeleted, newUserEvent),
+	)
+	return nil
+}
+
+// write runs fn, the store change, in a transaction and publishes the
+// lifecycle event for it. With an outbox the event is added in that
+// transaction and published once it commits: right away, or by the relay
+// when fn joins an outer app.Tx.
+func (mod *Module) write(ctx context.Context, eventType string, event *UserEvent, fn func(ctx context.Context) error) error {
+	err := mod.app.Tx(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil || mod.outbox == nil {
+			return err
+		}
+		return mod.outbox.Add(ctx, sqlite.Conn(ctx, mod.outboxDB), eventType, event)
+	})
+	switch {
+	case err != nil:
+		return err
+	case mod.outbox == nil:
+		mod.app.PublishEvent(ctx, eventType, event)
+	case !chassis.InTx(ctx):
+		if _, err := mod.relay.Flush(context.WithoutCancel(ctx)); err != nil {
+			mod.app.Logger().Error("failed to publish users events", "error", err)
+		}
+	}
+	return nil
+}
+
+// runRelay publishes the outbox events committed inside an outer app.Tx
+// until ctx is canceled.
+func (mod *Module) runRelay(ctx context.Context) {
+	if mod.relay != nil {
+		go mod.relay.Run(ctx)
+	}
+}
@@ -0,0 +1,269 @@
+package users
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/talosaether/chassis"
+)
+
+// Policy is the set of rules passwords must meet.
+type Policy struct {
+	MinLength      int      // in characters
+	MaxLength      int      // in characters, 0 for no limit
+	RequireClasses int      // how many of lowercase, uppercase, digits and symbols must appear
+	BannedList     []string // passwords rejected regardless of case
+	MinScore       int      // minimum strength score, 0 to 4 (see CheckPassword)
+}
+
+// DefaultPolicy requires 8 characters and nothing else.
+var DefaultPolicy = Policy{MinLength: 8}
+
+// WithPasswordPolicy sets the rules enforced when passwords are set.
+func WithPasswordPolicy(policy Policy) Option {
+	return func(opts *Options) {
+		opts.PasswordPolicy = &policy
+	}
+}
+
+// policyFromConfig overrides the fields of policy set under
+// users.password_policy:
+//
+//	users:
+//	  password_policy:
+//	    min_length: 12
+//	    max_length: 128
+//	    require_classes: 3
+//	    min_score: 3
+//	    banned_list: [acme2024, letmein]
+//	    banned_file: ./config/banned-passwords.txt # one per line
+func policyFromConfig(cfg chassis.ConfigData, policy Policy) (Policy, error) {
+	section := cfg.Section("users.password_policy")
+	if section == nil {
+		return policy, nil
+	}
+	for name, field := range map[string]*int{
+		"min_length":      &policy.MinLength,
+		"max_length":      &policy.MaxLength,
+		"require_classes": &policy.RequireClasses,
+		"min_score":       &policy.MinScore,
+	} {
+		if section.Get(name) != nil {
+			*field = section.GetInt(name)
+		}
+	}
+	if banned, ok := section.Get("banned_list").([]any); ok {
+		for _, password := range banned {
+			policy.BannedList = append(policy.BannedList, fmt.Sprint(password))
+		}
+	}
+	if path := section.GetString("banned_file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return policy, fmt.Errorf("failed to read users.password_policy.banned_file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if password := strings.TrimSpace(line); password != "" {
+				policy.BannedList = append(policy.BannedList, password)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// CheckPassword scores the strength of password from 0 (guessable in
+// under a thousand tries) to 4 (over ten billion), in the manner of
+// zxcvbn, and checks it against the password policy. The error wraps
+// ErrWeakPassword, with the unmet rules as details, if the policy rejects
+// it:
+//
+//	score, err := usersMod.CheckPassword(input)
+func (mod *Module) CheckPassword(password string) (int, error) {
+	return mod.policy.Check(password)
+}
+
+// Check scores password and checks it against the policy, like
+// Module.CheckPassword.
+func (policy Policy) Check(password string) (int, error) {
+	banned := make(map[string]bool, len(policy.BannedList))
+	for _, entry := range policy.BannedList {
+		banned[strings.ToLower(entry)] = true
+	}
+	score := PasswordScore(password, banned)
+
+	var problems []string
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", policy.MinLength))
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d characters", policy.MaxLength))
+	}
+	if classes := characterClasses(password); classes < policy.RequireClasses {
+		problems = append(problems, fmt.Sprintf("must mix at least %d of lowercase, uppercase, digits and symbols", policy.RequireClasses))
+	}
+	if banned[strings.ToLower(password)] {
+		problems = append(problems, "is not allowed")
+	}
+	if score < policy.MinScore {
+		problems = append(problems, "is too easy to guess")
+	}
+	if len(problems) == 0 {
+		return score, nil
+	}
+
+	weak := &chassis.Error{Code: chassis.CodeInvalidArgument, Details: map[string]any{"score": score, "problems": problems}, Err: ErrWeakPassword}
+	return score, fmt.Errorf("%w (password %s)", weak, strings.Join(problems, ", "))
+}
+
+// PasswordScore estimates how many guesses password would take and maps
+// it to a score from 0 to 4 like zxcvbn: under 10^3, 10^6, 10^8 and 10^10
+// guesses score 0 to 3, more scores 4. Common passwords and those in
+// banned (lowercased) score 0; repeats, sequences and keyboard runs count
+// for little.
+func PasswordScore(password string, banned map[string]bool) int {
+	lower := strings.ToLower(password)
+	if password == "" || banned[lower] || commonPasswords[lower] {
+		return 0
+	}
+
+	// A common password with digits or symbols around it is worth ten
+	// guesses per extra character
+	core := strings.TrimFunc(lower, func(char rune) bool { return !unicode.IsLetter(char) })
+	if commonPasswords[core] || banned[core] {
+		padding := utf8.RuneCountInString(lower) - utf8.RuneCountInString(core)
+		return scoreForGuesses(1e2 * math.Pow(10, float64(padding)))
+	}
+
+	// Like zxcvbn's brute-force estimate, each character is worth ten
+	// guesses
+	return scoreForGuesses(math.Pow(10, effectiveLength(lower)))
+}
+
+func scoreForGuesses(guesses float64) int {
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	}
+	return 4
+}
+
+// characterClasses counts the classes of characters used in password.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, char := range password {
+		switch {
+		case unicode.IsLower(char):
+			lower = true
+		case unicode.IsUpper(char):
+			upper = true
+		case unicode.IsDigit(char):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			classes++
+		}
+	}
+	return classes
+}
+
+// keyboardRows are runs attackers try.
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+
+// effectiveLength is the length of password with repeats, sequences and
+// keyboard runs of three or more characters counted as one character.
+func effectiveLength(password string) float64 {
+	chars := []rune(password)
+	length := 0.0
+	for i := 0; i < len(chars); {
+		run := patternRun(chars[i:])
+		if run >= 3 {
+			length += 1 + math.Log10(float64(run))
+			i += run
+			continue
+		}
+		length++
+		i++
+	}
+	return length
+}
+
+// patternRun returns how many characters at the start of chars repeat,
+// form a sequence like "abc" or "321", or follow a keyboard row.
+func patternRun(chars []rune) int {
+	if len(chars) < 2 {
+		return len(chars)
+	}
+	run := 1
+	if step := chars[1] - chars[0]; step >= -1 && step <= 1 {
+		run = 2
+		for run < len(chars) && chars[run]-chars[run-1] == step {
+			run++
+		}
+	}
+
+	for _, row := range keyboardRows {
+		for _, line := range []string{row, reverse(row)} {
+			index := strings.IndexRune(line, chars[0])
+			if index < 0 {
+				continue
+			}
+			keyboard := 0
+			for keyboard < len(chars) && index+keyboard < len(line) && rune(line[index+keyboard]) == chars[keyboard] {
+				keyboard++
+			}
+			run = max(run, keyboard)
+		}
+	}
+	return run
+}
+
+func reverse(text string) string {
+	chars := []rune(text)
+	for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
+
+// commonPasswords are among the most used passwords in public breach
+// corpora. They score 0 whatever the policy.
+var commonPasswords = wordSet(`
+		123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567
+		dragon 123123 baseball abc123 football monkey letmein 696969 shadow
+		master 666666 qwertyuiop 123321 mustang 1234567890 michael 654321
+		superman 1qaz2wsx 7777777 121212 000000 qazwsx 123qwe killer trustno1
+		jordan jennifer zxcvbnm asdfgh hunter buster soccer harley batman
+		andrew tigger sunshine iloveyou 2000 charlie robert thomas hockey
+		ranger daniel starwars klaster 112233 george computer michelle
+		jessica pepper 1111 zxcvbn 555555 11111111 131313 freedom 777777
+		pass maggie 159753 aaaaaa ginger princess joshua cheese amanda
+		summer love ashley nicole chelsea biteme matthew access yankees
+		987654321 dallas austin thunder taylor matrix welcome admin
+		password1 passw0rd p@ssword p@ssw0rd qwerty123 login secret
+		changeme welcome1 letmein1 admin123 root toor guest default
+	`)
+
+// wordSet returns the set of the whitespace-separated words.
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
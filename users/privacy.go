@@ -0,0 +1,412 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+)
+
+var ErrErasureNotFound = chassis.NewError(chassis.CodeNotFound, "no erasure is scheduled for this user")
+
+// Data protection events published when the events module is registered.
+const (
+	EventDataExported     = "user.data_exported"     // payload: *UserEvent
+	EventErasureScheduled = "user.erasure_scheduled" // payload: *ErasureEvent
+	EventErasureCancelled = "user.erasure_cancelled" // payload: *ErasureEvent
+	EventErasureFailed    = "user.erasure_failed"    // payload: *ErasureEvent
+	EventUserErased       = "user.erased"            // payload: *ErasureEvent
+)
+
+// DefaultErasureDelay is how long Erase waits before erasing a user,
+// giving them a window to cancel, unless WithErasureDelay or
+// users.erasure_delay says otherwise.
+const DefaultErasureDelay = 7 * 24 * time.Hour
+
+// DefaultErasureInterval is how often Start erases the users whose delay
+// is over.
+const DefaultErasureInterval = time.Hour
+
+// ErasureStatus is the state of an erasure.
+type ErasureStatus string
+
+const (
+	ErasureScheduled ErasureStatus = "scheduled"
+	ErasureCancelled ErasureStatus = "cancelled"
+	ErasureCompleted ErasureStatus = "completed"
+	ErasureFailed    ErasureStatus = "failed"
+)
+
+// Erasure is a request to erase a user, kept after the user is gone as
+// the audit trail of what was removed. It holds no personal data beyond
+// the user's ID.
+type Erasure struct {
+	ID           string
+	UserID       string
+	Status       ErasureStatus
+	Actions      []string // the cleanup plan applied, as CleanupReport.Plan lists it
+	Error        string
+	RequestedAt  time.Time
+	ScheduledFor time.Time
+	UpdatedAt    time.Time
+	CompletedAt  *time.Time
+}
+
+// ErasureEvent is the payload of erasure events. Email is only set on
+// EventErasureScheduled and EventErasureCancelled, while the user still
+// exists, so they can be told.
+type ErasureEvent struct {
+	ErasureID    string
+	UserID       string
+	Email        string
+	ScheduledFor time.Time
+	Actions      []string
+	Error        string
+}
+
+// ErasureStore persists erasures. SQLiteStore implements it; other stores
+// fall back to an in-memory record.
+type ErasureStore interface {
+	SaveErasure(ctx context.Context, erasure *Erasure) error
+	// ListErasures returns a user's erasures, newest first.
+	ListErasures(ctx context.Context, userID string) ([]*Erasure, error)
+	// DueErasures returns the scheduled erasures due by now, oldest first.
+	DueErasures(ctx context.Context, now time.Time) ([]*Erasure, error)
+}
+
+// WithErasureDelay sets how long Erase waits before erasing a user. Zero
+// erases at once.
+func WithErasureDelay(delay time.Duration) Option {
+	return func(opts *Options) {
+		opts.ErasureDelay = &delay
+	}
+}
+
+// WithErasureInterval sets how often Start erases the users whose delay is
+// over.
+func WithErasureInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.ErasureInterval = interval
+	}
+}
+
+// userManifest is manifest.json, at the root of a bundle.
+type userManifest struct {
+	UserID     string    `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	Modules    []string  `json:"modules"`
+	Files      []string  `json:"files"`
+}
+
+// ExportData writes a zip bundle of everything the app keeps about a user
+// to writer, for data access and portability requests: their profile and
+// linked identities under users/, and the files of every other module
+// implementing chassis.UserExporter under a directory named after it, such
+// as their sessions and login history, memberships, notifications and
+// storage objects. A manifest.json at the root lists the modules and files.
+func (mod *Module) ExportData(ctx context.Context, userID string, writer io.Writer) error {
+	user, err := mod.store.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	bundle := chassis.NewZipExport(writer)
+	manifest := userManifest{UserID: userID, ExportedAt: time.Now().UTC(), Modules: make([]string, 0)}
+	for _, module := range mod.app.Modules() {
+		exporter, ok := module.(chassis.UserExporter)
+		if !ok {
+			continue
+		}
+		if err := exporter.ExportUser(ctx, userID, bundle.Dir(module.Name())); err != nil {
+			return fmt.Errorf("failed to export module %q: %w", module.Name(), err)
+		}
+		manifest.Modules = append(manifest.Modules, module.Name())
+	}
+	manifest.Files = bundle.Files()
+	if err := bundle.WriteJSON("manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := bundle.Close(); err != nil {
+		return err
+	}
+
+	mod.app.PublishEvent(ctx, EventDataExported, &UserEvent{UserID: user.ID, Email: user.Email})
+	return nil
+}
+
+// exportedUser is profile.json, without the password hash.
+type exportedUser struct {
+	ID        string         `json:"id"`
+	Email     string         `json:"email"`
+	Name      string         `json:"name,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// exportedIdentity is an entry of identities.json.
+type exportedIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportUser writes the user's profile to profile.json and their linked
+// identities to identities.json. Implements chassis.UserExporter.
+func (mod *Module) ExportUser(ctx context.Context, userID string, export chassis.ExportWriter) error {
+	user, err := mod.store.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	profile := exportedUser{ID: user.ID, Email: user.Email, Name: user.Name, AvatarURL: user.AvatarURL,
+		Metadata: user.Metadata, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt}
+	if err := export.WriteJSON("profile.json", profile); err != nil {
+		return err
+	}
+
+	identities, err := mod.identityStore().ListIdentities(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list identities: %w", err)
+	}
+	exported := make([]exportedIdentity, len(identities))
+	for i, identity := range identities {
+		exported[i] = exportedIdentity{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email,
+			Verified: identity.Verified, CreatedAt: identity.CreatedAt}
+	}
+	return export.WriteJSON("identities.json", exported)
+}
+
+// Erase schedules erasing a user, and all their data in other modules as
+// Delete does, once the erasure delay is over; until then CancelErasure
+// calls it off. The result is an *Erasure. Erasing a user with an erasure
+// already scheduled returns it, and one that a module would refuse to
+// delete (e.g. the sole owner of an org under SoleOwnerBlock) fails now
+// rather than when the delay is over. With no delay the user is erased at
+// once.
+func (mod *Module) Erase(ctx context.Context, userID string) (any, error) {
+	return mod.erase(ctx, userID)
+}
+
+// erase is the internal implementation.
+func (mod *Module) erase(ctx context.Context, userID string) (*Erasure, error) {
+	user, err := mod.store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if scheduled, err := mod.scheduledErasure(ctx, userID); err == nil {
+		return scheduled, nil
+	} else if chassis.ErrorCodeOf(err) != chassis.CodeNotFound {
+		return nil, err
+	}
+	if _, err := mod.PlanDelete(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	erasure := &Erasure{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Status:       ErasureScheduled,
+		RequestedAt:  now,
+		ScheduledFor: now.Add(mod.erasureDelay),
+		UpdatedAt:    now,
+	}
+	if err := mod.erasureStore().SaveErasure(ctx, erasure); err != nil {
+		return nil, fmt.Errorf("failed to schedule erasure: %w", err)
+	}
+	mod.app.PublishEvent(ctx, EventErasureScheduled, &ErasureEvent{
+		ErasureID:    erasure.ID,
+		UserID:       userID,
+		Email:        user.Email,
+		ScheduledFor: erasure.ScheduledFor,
+	})
+
+	if mod.erasureDelay <= 0 {
+		mod.runErasure(ctx, erasure)
+	}
+	return erasure, nil
+}
+
+// CancelErasure calls off the user's scheduled erasure, failing with
+// ErrErasureNotFound if there is none.
+func (mod *Module) CancelErasure(ctx context.Context, userID string) error {
+	erasure, err := mod.scheduledErasure(ctx, userID)
+	if err != nil {
+		return err
+	}
+	erasure.Status = ErasureCancelled
+	erasure.UpdatedAt = time.Now()
+	if err := mod.erasureStore().SaveErasure(ctx, erasure); err != nil {
+		return fmt.Errorf("failed to cancel erasure: %w", err)
+	}
+
+	event := &ErasureEvent{ErasureID: erasure.ID, UserID: userID, ScheduledFor: erasure.ScheduledFor}
+	if user, err := mod.store.GetByID(ctx, userID); err == nil {
+		event.Email = user.Email
+	}
+	mod.app.PublishEvent(ctx, EventErasureCancelled, event)
+	return nil
+}
+
+// Erasures returns the user's erasures, newest first, including those of
+// users already erased.
+func (mod *Module) Erasures(ctx context.Context, userID string) ([]*Erasure, error) {
+	return mod.erasureStore().ListErasures(ctx, userID)
+}
+
+// scheduledErasure returns the user's scheduled erasure.
+func (mod *Module) scheduledErasure(ctx context.Context, userID string) (*Erasure, error) {
+	erasures, err := mod.erasureStore().ListErasures(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	index := slices.IndexFunc(erasures, func(erasure *Erasure) bool { return erasure.Status == ErasureScheduled })
+	if index < 0 {
+		return nil, ErrErasureNotFound
+	}
+	return erasures[index], nil
+}
+
+// EraseDue erases the users whose erasure delay is over and returns how
+// many were erased. Start calls it every erasure interval; call it from a
+// scheduled job instead when not using app.Run.
+func (mod *Module) EraseDue(ctx context.Context) (int, error) {
+	due, err := mod.erasureStore().DueErasures(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due erasures: %w", err)
+	}
+	erased := 0
+	for _, erasure := range due {
+		if mod.runErasure(ctx, erasure) {
+			erased++
+		}
+	}
+	return erased, nil
+}
+
+// runErasure deletes the user of a scheduled erasure, recording the
+// cleanup plan that was applied, and reports whether it succeeded.
+func (mod *Module) runErasure(ctx context.Context, erasure *Erasure) bool {
+	report, err := mod.PlanDelete(ctx, erasure.UserID)
+	if err == nil {
+		erasure.Actions = report.Plan()
+		err = mod.delete(ctx, erasure.UserID, report)
+	}
+
+	now := time.Now()
+	erasure.UpdatedAt = now
+	if err != nil {
+		erasure.Status = ErasureFailed
+		erasure.Error = err.Error()
+	} else {
+		erasure.Status = ErasureCompleted
+		erasure.CompletedAt = &now
+	}
+	if saveErr := mod.erasureStore().SaveErasure(ctx, erasure); saveErr != nil && mod.app != nil {
+		mod.app.Logger().Error("failed to record erasure", "erasure_id", erasure.ID, "user_id", erasure.UserID, "error", saveErr)
+	}
+
+	event := &ErasureEvent{ErasureID: erasure.ID, UserID: erasure.UserID, ScheduledFor: erasure.ScheduledFor, Actions: erasure.Actions, Error: erasure.Error}
+	if err != nil {
+		if mod.app != nil {
+			mod.app.Logger().Error("failed to erase user", "erasure_id", erasure.ID, "user_id", erasure.UserID, "error", err)
+		}
+		mod.app.PublishEvent(ctx, EventErasureFailed, event)
+		return false
+	}
+	if mod.app != nil {
+		mod.app.Logger().Info("user erased", "erasure_id", erasure.ID, "user_id", erasure.UserID, "actions", len(erasure.Actions))
+	}
+	mod.app.PublishEvent(ctx, EventUserErased, event)
+	return true
+}
+
+// Start erases the users whose erasure delay is over every erasure
+// interval until ctx is cancelled, and relays the lifecycle events written
+// inside an app.Tx. Implements chassis.Service, so app.Run carries out
+// scheduled erasures.
+func (mod *Module) Start(ctx context.Context) error {
+	mod.runRelay(ctx)
+	ticker := time.NewTicker(mod.erasureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := mod.EraseDue(ctx); err != nil {
+				mod.app.Logger().Error("failed to erase due users", "error", err)
+			}
+		}
+	}
+}
+
+// erasureStore returns the module's store if it implements ErasureStore,
+// or an in-memory one.
+func (mod *Module) erasureStore() ErasureStore {
+	mod.erasuresOnce.Do(func() {
+		if erasures, ok := mod.store.(ErasureStore); ok {
+			mod.erasures = erasures
+		} else {
+			mod.erasures = NewMemoryErasureStore()
+		}
+	})
+	return mod.erasures
+}
+
+// MemoryErasureStore keeps erasures in process memory.
+type MemoryErasureStore struct {
+	mu       sync.Mutex
+	erasures map[string]Erasure
+}
+
+// NewMemoryErasureStore creates an in-memory erasure store.
+func NewMemoryErasureStore() *MemoryErasureStore {
+	return &MemoryErasureStore{erasures: make(map[string]Erasure)}
+}
+
+func (store *MemoryErasureStore) SaveErasure(ctx context.Context, erasure *Erasure) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	copied := *erasure
+	copied.Actions = slices.Clone(erasure.Actions)
+	store.erasures[erasure.ID] = copied
+	return nil
+}
+
+func (store *MemoryErasureStore) ListErasures(ctx context.Context, userID string) ([]*Erasure, error) {
+	return store.filter(func(erasure *Erasure) bool { return erasure.UserID == userID }, func(a, b *Erasure) int {
+		return b.RequestedAt.Compare(a.RequestedAt)
+	}), nil
+}
+
+func (store *MemoryErasureStore) DueErasures(ctx context.Context, now time.Time) ([]*Erasure, error) {
+	return store.filter(func(erasure *Erasure) bool {
+		return erasure.Status == ErasureScheduled && !erasure.ScheduledFor.After(now)
+	}, func(a, b *Erasure) int {
+		return a.ScheduledFor.Compare(b.ScheduledFor)
+	}), nil
+}
+
+// filter returns copies of the erasures matching keep, sorted by compare.
+func (store *MemoryErasureStore) filter(keep func(*Erasure) bool, compare func(a, b *Erasure) int) []*Erasure {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	erasures := make([]*Erasure, 0)
+	for _, erasure := range store.erasures {
+		if keep(&erasure) {
+			erasure.Actions = slices.Clone(erasure.Actions)
+			erasures = append(erasures, &erasure)
+		}
+	}
+	slices.SortFunc(erasures, compare)
+	return erasures
+}
@@ -3,12 +3,13 @@ package users
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/internal/sqlite"
 )
 
 // Store defines the interface for user persistence.
@@ -19,33 +20,40 @@ type Store interface {
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, opts ListOptions, offset, limit int) ([]*User, error)
+	Count(ctx context.Context, opts ListOptions) (int, error)
 	Close() error
 }
 
 // SQLiteStore implements Store using SQLite.
 type SQLiteStore struct {
-	db *sql.DB
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
 }
 
 // NewSQLiteStore creates a new SQLite-backed user store.
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
-	// Ensure directory exists
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0750); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Create tables
+	store, err := NewSQLiteStoreFromDB(db)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		_ = db.Close()
+		return nil, err
 	}
+	store.owned = true
+	return store, nil
+}
 
-	// Create tables
+// NewSQLiteStoreFromDB creates a user store on a database the caller owns,
+// such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
 	if err := initSchema(db); err != nil {
-		_ = db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
-
 	return &SQLiteStore{db: db}, nil
 }
 
@@ -56,39 +64,169 @@ func initSchema(db *sql.DB) error {
 			email TEXT UNIQUE NOT NULL,
 			password_hash TEXT NOT NULL,
 			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
+			updated_at DATETIME NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			avatar_url TEXT NOT NULL DEFAULT '',
+			metadata TEXT NOT NULL DEFAULT '',
+			created_ms INTEGER NOT NULL DEFAULT 0
 		);
 		CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+		CREATE INDEX IF NOT EXISTS idx_users_email_nocase ON users(email COLLATE NOCASE);
 	`
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := addUserColumns(db); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_users_created ON users(created_ms);
+		CREATE INDEX IF NOT EXISTS idx_users_name ON users(name);
+
+		CREATE TABLE IF NOT EXISTS identities (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT NOT NULL,
+			verified INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			UNIQUE (provider, subject)
+		);
+		CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities(user_id);
+
+		CREATE TABLE IF NOT EXISTS user_erasures (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			actions TEXT NOT NULL DEFAULT '[]',
+			error TEXT NOT NULL DEFAULT '',
+			requested_at DATETIME NOT NULL,
+			scheduled_for DATETIME NOT NULL,
+			scheduled_ms INTEGER NOT NULL, -- scheduled_for as Unix milliseconds, for DueErasures
+			updated_at DATETIME NOT NULL,
+			completed_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_erasures_user_id ON user_erasures(user_id);
+		CREATE INDEX IF NOT EXISTS idx_user_erasures_due ON user_erasures(status, scheduled_ms);
+	`)
 	return err
 }
 
+// userColumnTypes are the columns added after the users table was first
+// released.
+var userColumnTypes = []struct{ name, definition string }{
+	{"name", "TEXT NOT NULL DEFAULT ''"},
+	{"avatar_url", "TEXT NOT NULL DEFAULT ''"},
+	{"metadata", "TEXT NOT NULL DEFAULT ''"},
+	// created_at as Unix milliseconds, so listings can filter and sort by
+	// it whatever time zone rows were written in
+	{"created_ms", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// addUserColumns adds the columns in userColumnTypes to user tables created
+// before they existed, and fills in created_ms.
+func addUserColumns(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('users')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range userColumnTypes {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE users ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return err
+		}
+	}
+	if existing["created_ms"] {
+		return nil
+	}
+	return backfillCreatedMs(db)
+}
+
+// backfillCreatedMs sets created_ms of users created before it existed.
+func backfillCreatedMs(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, created_at FROM users WHERE created_ms = 0`)
+	if err != nil {
+		return err
+	}
+	created := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		created[id] = createdAt
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, createdAt := range created {
+		if _, err := db.Exec(`UPDATE users SET created_ms = ? WHERE id = ?`, createdAt.UnixMilli(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const userColumns = `id, email, password_hash, created_at, updated_at, name, avatar_url, metadata`
+
 // Create inserts a new user into the database.
 func (store *SQLiteStore) Create(ctx context.Context, user *User) error {
-	query := `INSERT INTO users (id, email, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
-	_, err := store.db.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt)
+	metadata, err := encodeMetadata(user.Metadata)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO users (` + userColumns + `, created_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = sqlite.Conn(ctx, store.db).ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt,
+		user.Name, user.AvatarURL, metadata, user.CreatedAt.UnixMilli())
 	return err
 }
 
 // GetByID retrieves a user by their ID.
 func (store *SQLiteStore) GetByID(ctx context.Context, id string) (*User, error) {
-	query := `SELECT id, email, password_hash, created_at, updated_at FROM users WHERE id = ?`
-	row := store.db.QueryRowContext(ctx, query, id)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	row := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, id)
 	return scanUser(row)
 }
 
-// GetByEmail retrieves a user by their email address.
+// GetByEmail retrieves a user by their email address, ignoring case so
+// accounts stored before emails were normalized are still found. An exact
+// match wins.
 func (store *SQLiteStore) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `SELECT id, email, password_hash, created_at, updated_at FROM users WHERE email = ?`
-	row := store.db.QueryRowContext(ctx, query, email)
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ? COLLATE NOCASE ORDER BY email = ? DESC LIMIT 1`
+	row := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, email, email)
 	return scanUser(row)
 }
 
 // Update modifies an existing user in the database.
 func (store *SQLiteStore) Update(ctx context.Context, user *User) error {
-	query := `UPDATE users SET email = ?, password_hash = ?, updated_at = ? WHERE id = ?`
-	result, err := store.db.ExecContext(ctx, query, user.Email, user.PasswordHash, user.UpdatedAt, user.ID)
+	metadata, err := encodeMetadata(user.Metadata)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE users SET email = ?, password_hash = ?, updated_at = ?, name = ?, avatar_url = ?, metadata = ? WHERE id = ?`
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, user.Email, user.PasswordHash, user.UpdatedAt,
+		user.Name, user.AvatarURL, metadata, user.ID)
 	if err != nil {
 		return err
 	}
@@ -105,7 +243,7 @@ func (store *SQLiteStore) Update(ctx context.Context, user *User) error {
 // Delete removes a user from the database.
 func (store *SQLiteStore) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM users WHERE id = ?`
-	result, err := store.db.ExecContext(ctx, query, id)
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -119,19 +257,205 @@ func (store *SQLiteStore) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-// Close closes the database connection.
+// List returns the users matching opts, sorted by opts.SortBy.
+func (store *SQLiteStore) List(ctx context.Context, opts ListOptions, offset, limit int) ([]*User, error) {
+	where, args := listFilter(opts)
+	order, ok := userSort.OrderBy(opts.SortBy)
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY ` + order + ` LIMIT ? OFFSET ?`
+	return db.Query(ctx, sqlite.Conn(ctx, store.db), scanUser, query, append(args, limit, offset)...)
+}
+
+// Count returns the number of users matching opts.
+func (store *SQLiteStore) Count(ctx context.Context, opts ListOptions) (int, error) {
+	where, args := listFilter(opts)
+	var count int
+	err := sqlite.Conn(ctx, store.db).QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, args...).Scan(&count)
+	return count, err
+}
+
+// listFilter returns the WHERE clause for the filters in opts.
+func listFilter(opts ListOptions) (string, []any) {
+	var filter db.Filter
+	filter.Search(opts.Query, "email", "name")
+	if !opts.CreatedAfter.IsZero() {
+		filter.Where(`created_ms > ?`, opts.CreatedAfter.UnixMilli())
+	}
+	return filter.Clause()
+}
+
+// userSort maps ListOptions.SortBy to columns, newest first by default.
+var userSort = db.Sort{
+	Columns:  map[string]string{"created_at": "created_ms", "email": "email", "name": "name"},
+	Default:  "-created_at",
+	Tiebreak: "id",
+}
+
+// CreateIdentity stores a linked identity. Implements IdentityStore.
+func (store *SQLiteStore) CreateIdentity(ctx context.Context, identity *Identity) error {
+	query := `INSERT OR IGNORE INTO identities (id, user_id, provider, subject, email, verified, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, identity.ID, identity.UserID, identity.Provider,
+		identity.Subject, identity.Email, identity.Verified, identity.CreatedAt)
+	if err != nil {
+		return err
+	}
+	// A concurrent link of the same provider account won
+	if inserted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if inserted == 0 {
+		return ErrIdentityLinked
+	}
+	return nil
+}
+
+// GetIdentity returns the identity of a provider account. Implements
+// IdentityStore.
+func (store *SQLiteStore) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := `SELECT ` + identityColumns + ` FROM identities WHERE provider = ? AND subject = ?`
+	identity, err := scanIdentity(sqlite.Conn(ctx, store.db).QueryRowContext(ctx, query, provider, subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	return identity, err
+}
+
+// ListIdentities returns a user's identities, oldest first. Implements
+// IdentityStore.
+func (store *SQLiteStore) ListIdentities(ctx context.Context, userID string) ([]*Identity, error) {
+	query := `SELECT ` + identityColumns + ` FROM identities WHERE user_id = ? ORDER BY created_at, id`
+	return db.Query(ctx, sqlite.Conn(ctx, store.db), scanIdentity, query, userID)
+}
+
+// DeleteIdentity unlinks one of a user's identities. Implements
+// IdentityStore.
+func (store *SQLiteStore) DeleteIdentity(ctx context.Context, userID, provider, subject string) error {
+	query := `DELETE FROM identities WHERE user_id = ? AND provider = ? AND subject = ?`
+	result, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, query, userID, provider, subject)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// DeleteIdentitiesByUser unlinks all of a user's identities. Implements
+// IdentityStore.
+func (store *SQLiteStore) DeleteIdentitiesByUser(ctx context.Context, userID string) error {
+	_, err := sqlite.Conn(ctx, store.db).ExecContext(ctx, `DELETE FROM identities WHERE user_id = ?`, userID)
+	return err
+}
+
+const identityColumns = `id, user_id, provider, subject, email, verified, created_at`
+
+func scanIdentity(row db.Scanner) (*Identity, error) {
+	var identity Identity
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+		&identity.Verified, &identity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// SaveErasure creates or updates an erasure. Implements ErasureStore.
+func (store *SQLiteStore) SaveErasure(ctx context.Context, erasure *Erasure) error {
+	actions, err := json.Marshal(erasure.Actions)
+	if err != nil {
+		return err
+	}
+	query := `INSERT OR REPLACE INTO user_erasures (` + erasureColumns + `, scheduled_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = sqlite.Conn(ctx, store.db).ExecContext(ctx, query, erasure.ID, erasure.UserID, erasure.Status, string(actions),
+		erasure.Error, erasure.RequestedAt, erasure.ScheduledFor, erasure.UpdatedAt, erasure.CompletedAt, erasure.ScheduledFor.UnixMilli())
+	return err
+}
+
+// ListErasures returns a user's erasures, newest first. Implements
+// ErasureStore.
+func (store *SQLiteStore) ListErasures(ctx context.Context, userID string) ([]*Erasure, error) {
+	query := `SELECT ` + erasureColumns + ` FROM user_erasures WHERE user_id = ? ORDER BY requested_at DESC, id`
+	return db.Query(ctx, sqlite.Conn(ctx, store.db), scanErasure, query, userID)
+}
+
+// DueErasures returns the scheduled erasures due by now, oldest first.
+// Implements ErasureStore.
+func (store *SQLiteStore) DueErasures(ctx context.Context, now time.Time) ([]*Erasure, error) {
+	query := `SELECT ` + erasureColumns + ` FROM user_erasures WHERE status = ? AND scheduled_ms <= ? ORDER BY scheduled_ms, id`
+	return db.Query(ctx, sqlite.Conn(ctx, store.db), scanErasure, query, ErasureScheduled, now.UnixMilli())
+}
+
+const erasureColumns = `id, user_id, status, actions, error, requested_at, scheduled_for, updated_at, completed_at`
+
+func scanErasure(row db.Scanner) (*Erasure, error) {
+	var erasure Erasure
+	var actions string
+	var completedAt sql.NullTime
+	err := row.Scan(&erasure.ID, &erasure.UserID, &erasure.Status, &actions, &erasure.Error,
+		&erasure.RequestedAt, &erasure.ScheduledFor, &erasure.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(actions), &erasure.Actions); err != nil {
+		return nil, fmt.Errorf("invalid erasure actions: %w", err)
+	}
+	if completedAt.Valid {
+		erasure.CompletedAt = &completedAt.Time
+	}
+	return &erasure, nil
+}
+
+// Close closes the database connection, unless the caller owns it.
 func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
 	return store.db.Close()
 }
 
-func scanUser(row *sql.Row) (*User, error) {
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
+
+func scanUser(row db.Scanner) (*User, error) {
 	var user User
-	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	var metadata string
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
+		&user.Name, &user.AvatarURL, &metadata)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &user.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode user metadata: %w", err)
+		}
+	}
 	return &user, nil
 }
+
+// encodeMetadata stores empty metadata as "".
+func encodeMetadata(metadata map[string]any) (string, error) {
+	if len(metadata) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode user metadata: %w", err)
+	}
+	return string(data), nil
+}
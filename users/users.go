@@ -12,29 +12,61 @@
 //	    Email: "test@example.com",
 //	    Password: "secret",
 //	})
+//
+// # Data export and erasure
+//
+// ExportData writes a zip of a user's data from every module implementing
+// chassis.UserExporter. Erase schedules deleting the user after the
+// erasure delay, as Delete does, and keeps an Erasure record of the
+// cleanup plan applied:
+//
+//	err := usersMod.ExportData(ctx, userID, writer)
+//	erasure, err := usersMod.Erase(ctx, userID)
+//	err = usersMod.CancelErasure(ctx, userID) // within the delay
 package users
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/talosaether/chassis"
-	"golang.org/x/crypto/argon2"
+	"github.com/talosaether/chassis/db"
+	"github.com/talosaether/chassis/outbox"
+	"github.com/talosaether/chassis/pagination"
 )
 
 var (
-	ErrNotFound      = errors.New("user not found")
-	ErrEmailExists   = errors.New("email already exists")
-	ErrInvalidEmail  = errors.New("invalid email")
-	ErrWeakPassword  = errors.New("password too weak (minimum 8 characters)")
-	ErrWrongPassword = errors.New("wrong password")
+	ErrNotFound        = chassis.NewError(chassis.CodeNotFound, "user not found")
+	ErrEmailExists     = chassis.NewError(chassis.CodeAlreadyExists, "email already exists")
+	ErrInvalidEmail    = chassis.NewError(chassis.CodeInvalidArgument, "invalid email")
+	ErrWeakPassword    = chassis.NewError(chassis.CodeInvalidArgument, "password too weak")
+	ErrWrongPassword   = chassis.NewError(chassis.CodeUnauthenticated, "wrong password")
+	ErrInvalidAvatar   = chassis.NewError(chassis.CodeInvalidArgument, "avatar URL must be an absolute http(s) URL")
+	ErrInvalidSort     = chassis.NewError(chassis.CodeInvalidArgument, "users can be sorted by created_at, email or name")
+	ErrUnsupportedHash = chassis.NewError(chassis.CodeInvalidArgument, "password hash must be PHC argon2id or bcrypt")
+)
+
+// Lifecycle events published when the events module is registered.
+// The payload is a *UserEvent.
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
 )
 
+// UserEvent is the payload of user lifecycle events.
+type UserEvent struct {
+	UserID string
+	Email  string
+}
+
 // User represents a user in the system.
 type User struct {
 	ID           string
@@ -42,6 +74,9 @@ type User struct {
 	PasswordHash string
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	Name         string
+	AvatarURL    string
+	Metadata     map[string]any // application-defined attributes, stored as JSON
 }
 
 // GetID returns the user's ID.
@@ -54,23 +89,72 @@ func (user *User) GetEmail() string {
 	return user.Email
 }
 
+// GetName returns the user's display name.
+func (user *User) GetName() string {
+	return user.Name
+}
+
 // UpdateInput contains the data that can be updated on a user.
 type UpdateInput struct {
 	Email    *string
 	Password *string
 }
 
+// ProfileInput contains the profile fields to update. Nil fields are left
+// unchanged. Metadata is merged into the user's metadata; a nil value
+// removes the key.
+type ProfileInput struct {
+	Name      *string
+	AvatarURL *string // "" clears it
+	Metadata  map[string]any
+}
+
+// ListOptions selects and orders the users returned by List.
+type ListOptions struct {
+	Page   int
+	Limit  int
+	Cursor string // NextCursor of a previous page; takes precedence over Page
+
+	Query        string    // case-insensitive match anywhere in the email or name
+	SortBy       string    // created_at, email or name, "-" prefix for descending; default newest first
+	CreatedAfter time.Time // only users created after this time, if set
+}
+
 // Module is the users module implementation.
 type Module struct {
-	store  Store
-	dbPath string
-	app    *chassis.App
+	store            Store
+	dbPath           string
+	canonicalizePlus bool
+	policy           Policy
+	hashParams       HashParams
+	app              *chassis.App
+
+	identitiesOnce     sync.Once
+	identities         IdentityStore // see identityStore
+	linkVerifiedEmails bool
+
+	erasuresOnce    sync.Once
+	erasures        ErasureStore // see erasureStore
+	erasureDelay    time.Duration
+	erasureInterval time.Duration
+
+	outbox   *outbox.Outbox // lifecycle events, see openOutbox
+	outboxDB *sql.DB
+	relay    *outbox.Relay
 }
 
 // Options configures the users module.
 type Options struct {
-	Store  Store
-	DBPath string
+	Store            Store
+	DBPath           string
+	CanonicalizePlus bool // drop "+tag" from emails before storing and looking them up
+	PasswordPolicy   *Policy
+	HashParams       *HashParams
+
+	LinkVerifiedEmails bool // see WithVerifiedEmailLinking
+
+	ErasureDelay    *time.Duration // see WithErasureDelay
+	ErasureInterval time.Duration
 }
 
 // Option is a function that configures the users module.
@@ -90,19 +174,52 @@ func WithDBPath(path string) Option {
 	}
 }
 
+// WithPlusAddressCanonicalization drops "+tag" suffixes from emails, so
+// "ann+news@example.com" signs in to, and can't register beside,
+// "ann@example.com".
+func WithPlusAddressCanonicalization() Option {
+	return func(opts *Options) {
+		opts.CanonicalizePlus = true
+	}
+}
+
 // New creates a new users module with the given options.
 func New(opts ...Option) *Module {
 	options := &Options{
-		DBPath: "./data/users.db",
+		DBPath:          "./data/users.db",
+		ErasureInterval: DefaultErasureInterval,
 	}
 
 	for _, opt := range opts {
 		opt(options)
 	}
 
+	policy := DefaultPolicy
+	if options.PasswordPolicy != nil {
+		policy = *options.PasswordPolicy
+	}
+
+	hashParams := DefaultHashParams
+	if options.HashParams != nil {
+		hashParams = *options.HashParams
+	}
+
+	erasureDelay := DefaultErasureDelay
+	if options.ErasureDelay != nil {
+		erasureDelay = *options.ErasureDelay
+	}
+
 	return &Module{
-		store:  options.Store,
-		dbPath: options.DBPath,
+		store:            options.Store,
+		dbPath:           options.DBPath,
+		canonicalizePlus: options.CanonicalizePlus,
+		policy:           policy,
+		hashParams:       hashParams,
+
+		linkVerifiedEmails: options.LinkVerifiedEmails,
+
+		erasureDelay:    erasureDelay,
+		erasureInterval: options.ErasureInterval,
 	}
 }
 
@@ -120,15 +237,54 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 		if dbPath := cfg.GetString("users.db_path"); dbPath != "" {
 			mod.dbPath = dbPath
 		}
+		if cfg.GetBool("users.canonicalize_plus_addresses") {
+			mod.canonicalizePlus = true
+		}
+		policy, err := policyFromConfig(cfg, mod.policy)
+		if err != nil {
+			return err
+		}
+		mod.policy = policy
+		hashParams, err := hashParamsFromConfig(cfg, mod.hashParams)
+		if err != nil {
+			return err
+		}
+		mod.hashParams = hashParams
+		if cfg.GetBool("users.link_verified_emails") {
+			mod.linkVerifiedEmails = true
+		}
+		if cfg.Get("users.erasure_delay") != nil {
+			delay, err := cfg.MustGetDuration("users.erasure_delay")
+			if err != nil {
+				return err
+			}
+			mod.erasureDelay = delay
+		}
+		if cfg.Get("users.erasure_interval") != nil {
+			interval, err := cfg.MustGetDuration("users.erasure_interval")
+			if err != nil {
+				return err
+			}
+			mod.erasureInterval = interval
+		}
+	}
+	if mod.erasureInterval <= 0 {
+		mod.erasureInterval = DefaultErasureInterval
+	}
+	if err := mod.hashParams.validate(); err != nil {
+		return fmt.Errorf("invalid password hash parameters: %w", err)
 	}
 
 	// Use custom store if provided, otherwise create SQLite store
 	if mod.store == nil {
-		sqliteStore, err := NewSQLiteStore(mod.dbPath)
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
 		if err != nil {
 			return fmt.Errorf("failed to create users store: %w", err)
 		}
 		mod.store = sqliteStore
+		if err := mod.openOutbox(ctx, sqliteStore.db); err != nil {
+			return err
+		}
 		app.Logger().Info("users using SQLite store", "path", mod.dbPath)
 	} else {
 		app.Logger().Info("users using custom store")
@@ -137,6 +293,20 @@ func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
 	return nil
 }
 
+// openSQLiteStore creates the store on the database named by
+// users.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("users")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
 // Shutdown cleans up the users module.
 func (mod *Module) Shutdown(ctx context.Context) error {
 	if mod.store != nil {
@@ -145,13 +315,34 @@ func (mod *Module) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// Create creates a new user with the given email and password.
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "users.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "users.db"))
+}
+
+// Create creates a new user with the given email and password. The email
+// is validated and normalized with NormalizeEmail, and the password must
+// meet the password policy.
 func (mod *Module) Create(ctx context.Context, email, password string) (any, error) {
-	if email == "" {
-		return nil, ErrInvalidEmail
+	email, err := mod.normalizeEmail(email)
+	if err != nil {
+		return nil, err
 	}
-	if len(password) < 8 {
-		return nil, ErrWeakPassword
+	if _, err := mod.policy.Check(password); err != nil {
+		return nil, err
 	}
 
 	// Check if email already exists
@@ -164,7 +355,7 @@ func (mod *Module) Create(ctx context.Context, email, password string) (any, err
 	}
 
 	// Hash password
-	hash, err := hashPassword(password)
+	hash, err := mod.hashParams.hash(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -178,10 +369,15 @@ func (mod *Module) Create(ctx context.Context, email, password string) (any, err
 		UpdatedAt:    now,
 	}
 
-	if err := mod.store.Create(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	err = mod.write(ctx, EventUserCreated, &UserEvent{UserID: user.ID, Email: user.Email}, func(ctx context.Context) error {
+		if err := mod.store.Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return user, nil
 }
 
@@ -190,9 +386,9 @@ func (mod *Module) GetByID(ctx context.Context, id string) (any, error) {
 	return mod.store.GetByID(ctx, id)
 }
 
-// GetByEmail retrieves a user by their email.
+// GetByEmail retrieves a user by their email, normalized like Create.
 func (mod *Module) GetByEmail(ctx context.Context, email string) (any, error) {
-	return mod.store.GetByEmail(ctx, email)
+	return mod.store.GetByEmail(ctx, mod.lookupEmail(email))
 }
 
 // Update updates an existing user.
@@ -203,25 +399,26 @@ func (mod *Module) Update(ctx context.Context, id string, input UpdateInput) (*U
 	}
 
 	if input.Email != nil {
-		if *input.Email == "" {
-			return nil, ErrInvalidEmail
+		email, err := mod.normalizeEmail(*input.Email)
+		if err != nil {
+			return nil, err
 		}
 		// Check if new email already exists for a different user
-		existing, err := mod.store.GetByEmail(ctx, *input.Email)
+		existing, err := mod.store.GetByEmail(ctx, email)
 		if err != nil && !errors.Is(err, ErrNotFound) {
 			return nil, fmt.Errorf("failed to check existing user: %w", err)
 		}
 		if existing != nil && existing.ID != id {
 			return nil, ErrEmailExists
 		}
-		user.Email = *input.Email
+		user.Email = email
 	}
 
 	if input.Password != nil {
-		if len(*input.Password) < 8 {
-			return nil, ErrWeakPassword
+		if _, err := mod.policy.Check(*input.Password); err != nil {
+			return nil, err
 		}
-		hash, err := hashPassword(*input.Password)
+		hash, err := mod.hashParams.hash(*input.Password)
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
@@ -230,92 +427,145 @@ func (mod *Module) Update(ctx context.Context, id string, input UpdateInput) (*U
 
 	user.UpdatedAt = time.Now()
 
-	if err := mod.store.Update(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+	err = mod.write(ctx, EventUserUpdated, &UserEvent{UserID: user.ID, Email: user.Email}, func(ctx context.Context) error {
+		if err := mod.store.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return user, nil
 }
 
-// Delete removes a user by their ID.
-func (mod *Module) Delete(ctx context.Context, id string) error {
-	return mod.store.Delete(ctx, id)
+// List returns a page of users matching opts, with the total count, for
+// admin screens:
+//
+//	result, err := usersMod.List(ctx, users.ListOptions{Query: "acme.com", SortBy: "email", Limit: 50})
+func (mod *Module) List(ctx context.Context, opts ListOptions) (*pagination.Result[*User], error) {
+	req := pagination.Request{Page: opts.Page, Limit: opts.Limit, Cursor: opts.Cursor}
+	return db.Paginate(ctx, req,
+		func(ctx context.Context, offset, limit int) ([]*User, error) {
+			return mod.store.List(ctx, opts, offset, limit)
+		},
+		func(ctx context.Context) (int, error) { return mod.store.Count(ctx, opts) },
+	)
 }
 
-// Authenticate verifies a user's email and password, returning the user if valid.
-func (mod *Module) Authenticate(ctx context.Context, email, password string) (any, error) {
-	user, err := mod.store.GetByEmail(ctx, email)
+// UpdateProfile updates a user's profile fields. input must be a
+// ProfileInput.
+func (mod *Module) UpdateProfile(ctx context.Context, id string, input any) (any, error) {
+	profileInput, ok := input.(ProfileInput)
+	if !ok {
+		return nil, fmt.Errorf("invalid input type: expected ProfileInput")
+	}
+	return mod.updateProfile(ctx, id, profileInput)
+}
+
+// updateProfile is the internal implementation.
+func (mod *Module) updateProfile(ctx context.Context, id string, input ProfileInput) (*User, error) {
+	user, err := mod.store.GetByID(ctx, id)
 	if err != nil {
-		if errors.Is(err, ErrNotFound) {
-			return nil, ErrWrongPassword // Don't reveal if email exists
-		}
 		return nil, err
 	}
 
-	if !verifyPassword(password, user.PasswordHash) {
-		return nil, ErrWrongPassword
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.AvatarURL != nil {
+		if *input.AvatarURL != "" {
+			parsed, err := url.Parse(*input.AvatarURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, ErrInvalidAvatar
+			}
+		}
+		user.AvatarURL = *input.AvatarURL
+	}
+	for key, value := range input.Metadata {
+		if value == nil {
+			delete(user.Metadata, key)
+			continue
+		}
+		if user.Metadata == nil {
+			user.Metadata = make(map[string]any)
+		}
+		user.Metadata[key] = value
 	}
 
+	user.UpdatedAt = time.Now()
+
+	err = mod.write(ctx, EventUserUpdated, &UserEvent{UserID: user.ID, Email: user.Email}, func(ctx context.Context) error {
+		if err := mod.store.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
-// Password hashing using Argon2id
-const (
-	argonTime    = 1
-	argonMemory  = 64 * 1024
-	argonThreads = 4
-	argonKeyLen  = 32
-	saltLen      = 16
-)
-
-func hashPassword(password string) (string, error) {
-	salt := make([]byte, saltLen)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
+// PlanDelete reports what deleting a user would remove or change in
+// other modules (memberships, sessions, invitations, solely owned
+// organizations), without changing anything.
+func (mod *Module) PlanDelete(ctx context.Context, id string) (*chassis.CleanupReport, error) {
+	if _, err := mod.store.GetByID(ctx, id); err != nil {
+		return nil, err
 	}
-
-	hash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
-
-	// Encode as: salt$hash (both base64)
-	saltB64 := base64.RawStdEncoding.EncodeToString(salt)
-	hashB64 := base64.RawStdEncoding.EncodeToString(hash)
-
-	return saltB64 + "$" + hashB64, nil
+	return mod.app.PlanUserCleanup(ctx, id)
 }
 
-func verifyPassword(password, encoded string) bool {
-	// Split salt$hash
-	var saltB64, hashB64 string
-	for i, c := range encoded {
-		if c == '$' {
-			saltB64 = encoded[:i]
-			hashB64 = encoded[i+1:]
-			break
-		}
+// Delete removes a user by their ID, after cleaning up their data in other
+// modules as PlanDelete reports. If a module refuses, such as orgs for a
+// sole owner with SoleOwnerBlock, nothing is deleted.
+func (mod *Module) Delete(ctx context.Context, id string) error {
+	report, err := mod.PlanDelete(ctx, id)
+	if err != nil {
+		return err
 	}
-	if saltB64 == "" || hashB64 == "" {
-		return false
+	return mod.delete(ctx, id, report)
+}
+
+// delete applies the cleanup report, then deletes the user.
+func (mod *Module) delete(ctx context.Context, id string, report *chassis.CleanupReport) error {
+	if _, err := report.Apply(ctx); err != nil {
+		return fmt.Errorf("failed to clean up user data: %w", err)
 	}
 
-	salt, err := base64.RawStdEncoding.DecodeString(saltB64)
+	user, err := mod.store.GetByID(ctx, id)
 	if err != nil {
-		return false
+		return err
 	}
+	return mod.write(ctx, EventUserDeleted, &UserEvent{UserID: user.ID, Email: user.Email}, func(ctx context.Context) error {
+		if err := mod.identityStore().DeleteIdentitiesByUser(ctx, id); err != nil {
+			return fmt.Errorf("failed to unlink identities: %w", err)
+		}
+		return mod.store.Delete(ctx, id)
+	})
+}
 
-	expectedHash, err := base64.RawStdEncoding.DecodeString(hashB64)
+// Authenticate verifies a user's email and password, returning the user if valid.
+func (mod *Module) Authenticate(ctx context.Context, email, password string) (any, error) {
+	user, err := mod.store.GetByEmail(ctx, mod.lookupEmail(email))
 	if err != nil {
-		return false
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrWrongPassword // Don't reveal if email exists
+		}
+		return nil, err
 	}
 
-	actualHash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
-
-	// Constant-time comparison
-	if len(actualHash) != len(expectedHash) {
-		return false
+	if !verifyPassword(password, user.PasswordHash) {
+		return nil, ErrWrongPassword
 	}
-	var diff byte
-	for i := range actualHash {
-		diff |= actualHash[i] ^ expectedHash[i]
+
+	// Upgrade legacy, bcrypt and weaker hashes while the password is at hand
+	if needsRehash(user.PasswordHash, mod.hashParams) {
+		if err := mod.rehash(ctx, user, password); err != nil && mod.app != nil {
+			mod.app.Logger().Warn("failed to upgrade password hash", "user_id", user.ID, "error", err)
+		}
 	}
-	return diff == 0
+
+	return user, nil
 }
@@ -1,11 +1,24 @@
 package users
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/base64"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func setupTestStore(t *testing.T) (*SQLiteStore, func()) {
@@ -256,6 +269,72 @@ func TestVerifyPasswordInvalidFormat(t *testing.T) {
 	}
 }
 
+func TestPasswordHashFormats(t *testing.T) {
+	password := "testPassword123"
+
+	hash, _ := hashPassword(password)
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Errorf("hash should be PHC encoded, got %q", hash)
+	}
+	if needsRehash(hash, DefaultHashParams) {
+		t.Error("hash with current parameters should not need rehashing")
+	}
+	stronger := DefaultHashParams
+	stronger.Time = 2
+	if !needsRehash(hash, stronger) {
+		t.Error("hash with old parameters should need rehashing")
+	}
+
+	// Hashes from before parameters were encoded
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+	legacy := base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+	if !verifyPassword(password, legacy) || verifyPassword("wrongPassword", legacy) {
+		t.Error("legacy hash should verify only the right password")
+	}
+	if !needsRehash(legacy, DefaultHashParams) {
+		t.Error("legacy hash should need rehashing")
+	}
+
+	imported, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if !verifyPassword(password, string(imported)) || verifyPassword("wrongPassword", string(imported)) {
+		t.Error("bcrypt hash should verify only the right password")
+	}
+	if !needsRehash(string(imported), DefaultHashParams) {
+		t.Error("bcrypt hash should need rehashing")
+	}
+}
+
+func TestPasswordHashParamsRange(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+	for _, params := range []string{"m=65536,t=0,p=4", "m=65536,t=1,p=0", "m=0,t=1,p=4", "m=65536,t=1,p=300", "m=4294967295,t=1,p=4"} {
+		hash := "$argon2id$v=19$" + params + "$" + salt + "$" + key
+		if err := checkHash(hash); !errors.Is(err, ErrUnsupportedHash) {
+			t.Errorf("expected ErrUnsupportedHash for %s, got %v", params, err)
+		}
+		if verifyPassword("password123", hash) {
+			t.Errorf("expected %s not to verify", params)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, setting := range []string{"time: 0", "threads: 0", "threads: 256", "memory: 0", "memory: 16\n    threads: 4"} {
+		configPath := filepath.Join(dir, "config.yaml")
+		configYAML := "users:\n  db_path: " + filepath.Join(dir, "users.db") + "\n  password_hash:\n    " + setting + "\n"
+		if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := chassis.Build(chassis.WithConfigFile(configPath), chassis.WithModules(New()))
+		if !errors.Is(err, chassis.ErrInvalidConfig) {
+			t.Errorf("expected ErrInvalidConfig for %q, got %v", setting, err)
+		}
+	}
+	if _, err := chassis.Build(chassis.WithModules(New(WithDBPath(filepath.Join(dir, "users.db")), WithHashParams(HashParams{Memory: 1024, Threads: 1, KeyLen: 32})))); err == nil {
+		t.Error("expected Init to reject zero iterations")
+	}
+}
+
 // Module tests
 
 func TestModule_Name(t *testing.T) {
@@ -309,6 +388,165 @@ func TestModule_CreateValidation(t *testing.T) {
 	}
 }
 
+func TestNormalizeEmail(t *testing.T) {
+	valid := map[string]string{
+		"  Ann@Example.COM ":        "ann@example.com",
+		"first.last@sub.example.io": "first.last@sub.example.io",
+		"ann+news@example.com":      "ann+news@example.com",
+		"o'brien@example.ie":        "o'brien@example.ie",
+	}
+	for input, want := range valid {
+		if got, err := NormalizeEmail(input, false); err != nil || got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if got, err := NormalizeEmail("Ann+News@Example.com", true); err != nil || got != "ann@example.com" {
+		t.Errorf("expected the plus tag to be dropped, got %q (%v)", got, err)
+	}
+	if got, err := NormalizeEmail("+news@example.com", true); err != nil || got != "+news@example.com" {
+		t.Errorf("expected a local part that is only a tag to be kept, got %q (%v)", got, err)
+	}
+
+	invalid := []string{
+		"", "ann", "ann@", "@example.com", "ann@localhost", "ann@@example.com", "Ann <ann@example.com>",
+		"ann@example..com", "ann@-example.com", "ann@exa_mple.com", "ann smith@example.com",
+		strings.Repeat("a", 65) + "@example.com", "ann@" + strings.Repeat("a", 250) + ".com",
+	}
+	for _, input := range invalid {
+		if got, err := NormalizeEmail(input, false); !errors.Is(err, ErrInvalidEmail) {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want ErrInvalidEmail", input, got, err)
+		}
+	}
+}
+
+func TestModule_EmailNormalization(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store), WithPlusAddressCanonicalization())
+	ctx := context.Background()
+
+	result, err := mod.Create(ctx, " Ann+Signup@Example.com", "password123")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if email := result.(*User).Email; email != "ann@example.com" {
+		t.Errorf("expected the normalized email to be stored, got %q", email)
+	}
+	if _, err := mod.Create(ctx, "ANN@example.com", "password123"); !errors.Is(err, ErrEmailExists) {
+		t.Errorf("expected ErrEmailExists for a differently cased email, got %v", err)
+	}
+	if _, err := mod.Authenticate(ctx, "ann+other@EXAMPLE.com", "password123"); err != nil {
+		t.Errorf("expected to authenticate with a tagged, uppercase email, got %v", err)
+	}
+	if _, err := mod.GetByEmail(ctx, "not an email"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an invalid lookup, got %v", err)
+	}
+
+	// Accounts stored before normalization are still found
+	legacy := &User{ID: "legacy", Email: "Bob@Example.com", PasswordHash: "hash", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := store.Create(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := mod.GetByEmail(ctx, "bob@example.com"); err != nil || found.(*User).ID != "legacy" {
+		t.Errorf("expected the legacy account, got %v (%v)", found, err)
+	}
+	bad := "bob"
+	if _, err := mod.Update(ctx, "legacy", UpdateInput{Email: &bad}); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail, got %v", err)
+	}
+}
+
+func TestPasswordScore(t *testing.T) {
+	scores := map[string]int{
+		"password":                     0,
+		"abcdefgh":                     0,
+		"asdfghjkl;":                   0,
+		"Password1!":                   1,
+		"zebra42":                      2,
+		"kxmvqwpz":                     3,
+		"Tr0ub4dor&3":                  4,
+		"correct horse battery staple": 4,
+	}
+	for password, want := range scores {
+		if got := PasswordScore(password, nil); got != want {
+			t.Errorf("PasswordScore(%q) = %d, want %d", password, got, want)
+		}
+	}
+	if got := PasswordScore("AcmeCorp", map[string]bool{"acmecorp": true}); got != 0 {
+		t.Errorf("expected a banned password to score 0, got %d", got)
+	}
+}
+
+func TestModule_PasswordPolicy(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store), WithPasswordPolicy(Policy{
+		MinLength:      10,
+		MaxLength:      64,
+		RequireClasses: 3,
+		BannedList:     []string{"AcmeRocks2024!"},
+		MinScore:       3,
+	}))
+	ctx := context.Background()
+
+	score, err := mod.CheckPassword("short")
+	if !errors.Is(err, ErrWeakPassword) || score != 1 {
+		t.Fatalf("expected ErrWeakPassword, got %d (%v)", score, err)
+	}
+	var chassisErr *chassis.Error
+	if !errors.As(err, &chassisErr) || len(chassisErr.Details.(map[string]any)["problems"].([]string)) != 3 {
+		t.Errorf("expected the unmet rules as details, got %v", err)
+	}
+	for _, password := range []string{"acmerocks2024!", strings.Repeat("aB3$", 20), "alllowercaseletters"} {
+		if _, err := mod.CheckPassword(password); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("expected %q to be rejected, got %v", password, err)
+		}
+	}
+	if score, err := mod.CheckPassword("Tr0ub4dor&3x"); err != nil || score != 4 {
+		t.Errorf("expected a strong password to pass, got %d (%v)", score, err)
+	}
+
+	if _, err := mod.Create(ctx, "policy@example.com", "Password1!"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected Create to enforce the policy, got %v", err)
+	}
+	result, err := mod.Create(ctx, "policy@example.com", "Tr0ub4dor&3x")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	weak := "password12"
+	if _, err := mod.Update(ctx, result.(*User).ID, UpdateInput{Password: &weak}); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("expected Update to enforce the policy, got %v", err)
+	}
+}
+
+func TestModule_PasswordPolicyFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	bannedPath := filepath.Join(dir, "banned.txt")
+	if err := os.WriteFile(bannedPath, []byte("Summer2026!\n\nWinter2026!\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	configYAML := "users:\n  db_path: " + filepath.Join(dir, "users.db") + "\n  password_policy:\n    min_length: 12\n    banned_list: [correct horse battery]\n    banned_file: " + bannedPath + "\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := New()
+	app := chassis.New(chassis.WithConfigFile(configPath), chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+
+	for _, password := range []string{"password123", "correct horse battery", "winter2026!"} {
+		if _, err := app.Users().CheckPassword(password); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("expected %q to be rejected, got %v", password, err)
+		}
+	}
+	if _, err := app.Users().CheckPassword("twelve chars"); err != nil {
+		t.Errorf("expected the configured policy to keep the other defaults, got %v", err)
+	}
+}
+
 func TestModule_CreateSuccess(t *testing.T) {
 	store, cleanup := setupTestStore(t)
 	defer cleanup()
@@ -370,6 +608,68 @@ func TestModule_Authenticate(t *testing.T) {
 	}
 }
 
+func TestModule_RehashOnLogin(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	password := "password123"
+	result, err := New(WithStore(store)).Create(ctx, "rehash@example.com", password)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	oldHash := result.(*User).PasswordHash
+
+	params := DefaultHashParams
+	params.Time = 2
+	mod := New(WithStore(store), WithHashParams(params))
+	if _, err := mod.Authenticate(ctx, "rehash@example.com", password); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	user, _ := store.GetByEmail(ctx, "rehash@example.com")
+	if user.PasswordHash == oldHash || !strings.Contains(user.PasswordHash, "t=2") {
+		t.Errorf("hash should be upgraded at login, got %q", user.PasswordHash)
+	}
+	if _, err := mod.Authenticate(ctx, "rehash@example.com", password); err != nil {
+		t.Errorf("upgraded hash should still authenticate: %v", err)
+	}
+}
+
+func TestModule_Import(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	ctx := context.Background()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	user, err := mod.Import(ctx, "Imported@Example.com", string(hash))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if user.Email != "imported@example.com" {
+		t.Errorf("email should be normalized, got %q", user.Email)
+	}
+	if _, err := mod.Import(ctx, "imported@example.com", string(hash)); !errors.Is(err, ErrEmailExists) {
+		t.Errorf("expected ErrEmailExists, got %v", err)
+	}
+	if _, err := mod.Import(ctx, "md5@example.com", "5f4dcc3b5aa765d61d8327deb882cf99"); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("expected ErrUnsupportedHash, got %v", err)
+	}
+	if _, err := mod.Import(ctx, "zero@example.com", "$argon2id$v=19$m=65536,t=0,p=0$c2FsdHNhbHQ$a2V5a2V5"); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("expected ErrUnsupportedHash for zero parameters, got %v", err)
+	}
+
+	if _, err := mod.Authenticate(ctx, "imported@example.com", "password123"); err != nil {
+		t.Fatalf("imported user should authenticate: %v", err)
+	}
+	stored, _ := store.GetByID(ctx, user.ID)
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Errorf("bcrypt hash should be upgraded at login, got %q", stored.PasswordHash)
+	}
+}
+
 func TestModule_AuthenticateWrongPassword(t *testing.T) {
 	store, cleanup := setupTestStore(t)
 	defer cleanup()
@@ -463,6 +763,133 @@ func TestModule_Update(t *testing.T) {
 	}
 }
 
+func TestModule_UpdateProfile(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	ctx := context.Background()
+
+	createResult, _ := mod.Create(ctx, "profile@example.com", "password123")
+	created := createResult.(*User)
+
+	name, avatar := "Ada Lovelace", "https://cdn.example.com/ada.png"
+	if _, err := mod.UpdateProfile(ctx, created.ID, ProfileInput{
+		Name:      &name,
+		AvatarURL: &avatar,
+		Metadata:  map[string]any{"locale": "en-GB", "theme": "dark"},
+	}); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	if _, err := mod.UpdateProfile(ctx, created.ID, ProfileInput{Metadata: map[string]any{"theme": nil, "beta": true}}); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+
+	user, err := store.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != name || user.AvatarURL != avatar {
+		t.Errorf("expected profile fields to be stored, got %+v", user)
+	}
+	if len(user.Metadata) != 2 || user.Metadata["locale"] != "en-GB" || user.Metadata["beta"] != true {
+		t.Errorf("expected metadata to be merged, got %v", user.Metadata)
+	}
+
+	badAvatar := "javascript:alert(1)"
+	if _, err := mod.UpdateProfile(ctx, created.ID, ProfileInput{AvatarURL: &badAvatar}); !errors.Is(err, ErrInvalidAvatar) {
+		t.Errorf("expected ErrInvalidAvatar, got %v", err)
+	}
+	if _, err := mod.UpdateProfile(ctx, created.ID, &ProfileInput{}); err == nil {
+		t.Error("expected an error for the wrong input type")
+	}
+	if _, err := mod.UpdateProfile(ctx, "missing", ProfileInput{Name: &name}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSQLiteStore_AddsColumns(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "users.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE users (id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL, created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL);
+		INSERT INTO users VALUES ('old', 'old@example.com', 'hash', '2020-01-01 00:00:00', '2020-01-01 00:00:00')`)
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open an existing database: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if user, err := store.GetByID(context.Background(), "old"); err != nil || user.Name != "" || user.Metadata != nil {
+		t.Errorf("expected the old user without a profile, got %+v (%v)", user, err)
+	}
+	after := time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)
+	if users, err := store.List(context.Background(), ListOptions{CreatedAfter: after}, 0, 10); err != nil || len(users) != 1 {
+		t.Errorf("expected created_ms to be backfilled, got %v (%v)", users, err)
+	}
+}
+
+func TestModule_List(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+
+	mod := New(WithStore(store))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i, email := range []string{"carol@acme.com", "alice@example.com", "bob@acme.com", "dave_x@example.com"} {
+		result, err := mod.Create(ctx, email, "password123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := result.(*User)
+		user.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		if err := store.Delete(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	emails := func(users []*User) string {
+		var list []string
+		for _, user := range users {
+			list = append(list, user.Email)
+		}
+		return strings.Join(list, ",")
+	}
+
+	result, err := mod.List(ctx, ListOptions{Limit: 3})
+	if err != nil || result.Total != 4 || !result.HasMore || emails(result.Items) != "dave_x@example.com,bob@acme.com,alice@example.com" {
+		t.Fatalf("expected the newest users first, got %+v (%v)", result, err)
+	}
+	result, err = mod.List(ctx, ListOptions{Limit: 3, Cursor: result.NextCursor})
+	if err != nil || emails(result.Items) != "carol@acme.com" || result.HasMore {
+		t.Errorf("unexpected second page: %+v (%v)", result, err)
+	}
+
+	result, err = mod.List(ctx, ListOptions{Query: "ACME", SortBy: "email"})
+	if err != nil || result.Total != 2 || emails(result.Items) != "bob@acme.com,carol@acme.com" {
+		t.Errorf("expected a case-insensitive search sorted by email, got %+v (%v)", result, err)
+	}
+	if result, err = mod.List(ctx, ListOptions{Query: "_"}); err != nil || emails(result.Items) != "dave_x@example.com" {
+		t.Errorf("expected LIKE wildcards to match literally, got %+v (%v)", result, err)
+	}
+	result, err = mod.List(ctx, ListOptions{CreatedAfter: start.Add(90 * time.Minute), SortBy: "created_at"})
+	if err != nil || emails(result.Items) != "bob@acme.com,dave_x@example.com" {
+		t.Errorf("expected users created after the cutoff, oldest first, got %+v (%v)", result, err)
+	}
+	if _, err := mod.List(ctx, ListOptions{SortBy: "password_hash"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+}
+
 func TestModule_UpdatePassword(t *testing.T) {
 	store, cleanup := setupTestStore(t)
 	defer cleanup()
@@ -528,3 +955,188 @@ func TestUser_GetEmail(t *testing.T) {
 		t.Errorf("GetEmail() should return 'test@example.com', got %q", user.GetEmail())
 	}
 }
+
+func TestModule_Identities(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	mod := New(WithStore(store))
+	ctx := context.Background()
+
+	google := IdentityInput{Provider: ProviderGoogle, Subject: "g-123", Email: "Ann@Example.com", Verified: true}
+	ann, created, err := mod.SignInWithIdentity(ctx, google)
+	if err != nil || !created || ann.Email != "ann@example.com" || ann.PasswordHash != "" {
+		t.Fatalf("expected a passwordless user, got %+v, %v, %v", ann, created, err)
+	}
+	again, created, err := mod.SignInWithIdentity(ctx, google)
+	if err != nil || created || again.ID != ann.ID {
+		t.Errorf("expected the linked user, got %+v, %v, %v", again, created, err)
+	}
+	if _, err := mod.Authenticate(ctx, "ann@example.com", ""); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected passwordless users to fail password sign-in, got %v", err)
+	}
+
+	// An OAuth email matching a local account must be linked explicitly
+	localAny, _ := mod.Create(ctx, "bob@example.com", "password123")
+	local := localAny.(*User)
+	bobGoogle := IdentityInput{Provider: ProviderGoogle, Subject: "g-456", Email: "bob@example.com", Verified: true}
+	if _, _, err := mod.SignInWithIdentity(ctx, bobGoogle); !errors.Is(err, ErrLinkRequired) {
+		t.Errorf("expected ErrLinkRequired, got %v", err)
+	}
+	if _, err := mod.LinkIdentity(ctx, local.ID, google); !errors.Is(err, ErrIdentityLinked) {
+		t.Errorf("expected ErrIdentityLinked for another user's identity, got %v", err)
+	}
+	if _, err := mod.LinkIdentity(ctx, local.ID, bobGoogle); err != nil {
+		t.Fatalf("LinkIdentity failed: %v", err)
+	}
+	if user, _, err := mod.SignInWithIdentity(ctx, bobGoogle); err != nil || user.ID != local.ID {
+		t.Errorf("expected the linked local account, got %+v, %v", user, err)
+	}
+
+	linking := New(WithStore(store), WithVerifiedEmailLinking())
+	carolAny, _ := linking.Create(ctx, "carol@example.com", "password123")
+	carolGoogle := IdentityInput{Provider: ProviderGoogle, Subject: "g-789", Email: "carol@example.com"}
+	if _, _, err := linking.SignInWithIdentity(ctx, carolGoogle); !errors.Is(err, ErrLinkRequired) {
+		t.Errorf("expected unverified emails not to link, got %v", err)
+	}
+	carolGoogle.Verified = true
+	if user, created, err := linking.SignInWithIdentity(ctx, carolGoogle); err != nil || created || user.ID != carolAny.(*User).ID {
+		t.Errorf("expected the verified email to link, got %+v, %v, %v", user, created, err)
+	}
+
+	// A passwordless user keeps at least one identity
+	if err := mod.UnlinkIdentity(ctx, ann.ID, ProviderGoogle, "g-123"); !errors.Is(err, ErrLastIdentity) {
+		t.Errorf("expected ErrLastIdentity, got %v", err)
+	}
+	magic := IdentityInput{Provider: ProviderMagicLink, Subject: "ann@example.com", Email: "ann@example.com", Verified: true}
+	if _, err := mod.LinkIdentity(ctx, ann.ID, magic); err != nil {
+		t.Fatalf("LinkIdentity failed: %v", err)
+	}
+	if err := mod.UnlinkIdentity(ctx, ann.ID, ProviderGoogle, "g-123"); err != nil {
+		t.Errorf("UnlinkIdentity failed: %v", err)
+	}
+	if identities, err := mod.Identities(ctx, ann.ID); err != nil || len(identities) != 1 || identities[0].Provider != ProviderMagicLink {
+		t.Errorf("expected only the magic link identity, got %v, %v", identities, err)
+	}
+	if err := mod.UnlinkIdentity(ctx, local.ID, ProviderGoogle, "g-456"); err != nil {
+		t.Errorf("expected users with a password to unlink their only identity, got %v", err)
+	}
+
+	if err := mod.Delete(ctx, ann.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.GetIdentity(ctx, ProviderMagicLink, "ann@example.com"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("expected Delete to unlink identities, got %v", err)
+	}
+}
+
+func TestModule_ExportData(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	mod := New(WithStore(store))
+	app := chassis.New(chassis.WithModules(mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	createResult, _ := mod.Create(ctx, "ann@example.com", "password123")
+	created := createResult.(*User)
+	mod.LinkIdentity(ctx, created.ID, IdentityInput{Provider: ProviderGoogle, Subject: "g-123", Email: "ann@example.com", Verified: true})
+
+	var buf bytes.Buffer
+	if err := app.Users().ExportData(ctx, created.ID, &buf); err != nil {
+		t.Fatalf("ExportData failed: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid bundle: %v", err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		files[file.Name] = string(data)
+	}
+	if !strings.Contains(files["users/profile.json"], "ann@example.com") || strings.Contains(files["users/profile.json"], created.PasswordHash) {
+		t.Errorf("unexpected profile: %s", files["users/profile.json"])
+	}
+	if !strings.Contains(files["users/identities.json"], `"subject": "g-123"`) {
+		t.Errorf("unexpected identities: %s", files["users/identities.json"])
+	}
+	if !strings.Contains(files["manifest.json"], `"user_id": "`+created.ID+`"`) {
+		t.Errorf("unexpected manifest: %s", files["manifest.json"])
+	}
+	if err := mod.ExportData(ctx, "missing", io.Discard); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestModule_Erase(t *testing.T) {
+	store, cleanup := setupTestStore(t)
+	defer cleanup()
+	mod := New(WithStore(store), WithErasureDelay(time.Hour))
+	eventsMod := events.New()
+	app := chassis.New(chassis.WithModules(eventsMod, mod))
+	defer func() { _ = app.Shutdown(context.Background()) }()
+	ctx := context.Background()
+
+	var published []string
+	for _, eventType := range []string{EventErasureScheduled, EventErasureCancelled, EventUserErased, EventErasureFailed} {
+		eventsMod.Subscribe(eventType, func(ctx context.Context, eventType string, payload any) {
+			published = append(published, eventType)
+		})
+	}
+
+	createResult, _ := mod.Create(ctx, "ann@example.com", "password123")
+	created := createResult.(*User)
+	result, err := app.Users().Erase(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Erase failed: %v", err)
+	}
+	erasure := result.(*Erasure)
+	if erasure.Status != ErasureScheduled || erasure.ScheduledFor.Sub(erasure.RequestedAt) != time.Hour {
+		t.Errorf("unexpected erasure %+v", erasure)
+	}
+	if again, err := mod.erase(ctx, created.ID); err != nil || again.ID != erasure.ID {
+		t.Errorf("expected the scheduled erasure, got %+v, %v", again, err)
+	}
+	if erased, err := mod.EraseDue(ctx); err != nil || erased != 0 {
+		t.Errorf("expected nothing due, got %d, %v", erased, err)
+	}
+	if err := mod.CancelErasure(ctx, created.ID); err != nil {
+		t.Fatalf("CancelErasure failed: %v", err)
+	}
+	if err := mod.CancelErasure(ctx, created.ID); !errors.Is(err, ErrErasureNotFound) {
+		t.Errorf("expected ErrErasureNotFound, got %v", err)
+	}
+
+	erasure, _ = mod.erase(ctx, created.ID)
+	erasure.ScheduledFor = time.Now().Add(-time.Minute)
+	if err := store.SaveErasure(ctx, erasure); err != nil {
+		t.Fatal(err)
+	}
+	if erased, err := mod.EraseDue(ctx); err != nil || erased != 1 {
+		t.Fatalf("expected one erasure, got %d, %v", erased, err)
+	}
+	if _, err := mod.GetByID(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the user to be erased, got %v", err)
+	}
+	erasures, err := mod.Erasures(ctx, created.ID)
+	if err != nil || len(erasures) != 2 || erasures[0].Status != ErasureCompleted || erasures[0].CompletedAt == nil || erasures[1].Status != ErasureCancelled {
+		t.Errorf("expected the audit trail to be kept, got %v, %v", erasures, err)
+	}
+	want := []string{EventErasureScheduled, EventErasureCancelled, EventErasureScheduled, EventUserErased}
+	if !slices.Equal(published, want) {
+		t.Errorf("expected events %v, got %v", want, published)
+	}
+
+	// Without a delay the user is erased at once
+	immediate := New(WithStore(store), WithErasureDelay(0))
+	bobResult, _ := immediate.Create(ctx, "bob@example.com", "password123")
+	bob := bobResult.(*User)
+	if erasure, err := immediate.erase(ctx, bob.ID); err != nil || erasure.Status != ErasureCompleted {
+		t.Errorf("expected an immediate erasure, got %+v, %v", erasure, err)
+	}
+	if _, err := store.GetByID(ctx, bob.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the user to be erased, got %v", err)
+	}
+}
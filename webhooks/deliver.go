@@ -0,0 +1,354 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/webhooks/verify"
+)
+
+// dueBatchSize is the maximum number of due deliveries handled per poll.
+const dueBatchSize = 100
+
+// maxResponseBytes is how much of a response body is read before closing it.
+const maxResponseBytes = 64 << 10
+
+// deliveryJob is the payload of JobType queue jobs.
+type deliveryJob struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// syncSubscriptions subscribes to the event types of every stored endpoint.
+func (mod *Module) syncSubscriptions(ctx context.Context) error {
+	endpoints, err := mod.store.ListAllEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		mod.subscribe(endpoint.EventTypes)
+	}
+	return nil
+}
+
+// subscribe registers the dispatch handler for event types not yet subscribed.
+// It is a no-op without the events module.
+func (mod *Module) subscribe(eventTypes []string) {
+	eventsMod, ok := mod.app.TryEvents()
+	if !ok {
+		return
+	}
+
+	mod.subscribedMu.Lock()
+	defer mod.subscribedMu.Unlock()
+	for _, eventType := range eventTypes {
+		if _, ok := mod.subscribed[eventType]; ok {
+			continue
+		}
+		mod.subscribed[eventType] = eventsMod.Subscribe(eventType, mod.handleEvent)
+	}
+}
+
+// handleEvent is the event bus handler for subscribed event types.
+func (mod *Module) handleEvent(ctx context.Context, eventType string, payload any) error {
+	// Our own delivery jobs would otherwise feed job.completed back into
+	// endpoints subscribed to it, one delivery per delivery, forever
+	if job, ok := payload.(*queue.JobEvent); ok && job.Type == JobType {
+		return nil
+	}
+
+	_, err := mod.Dispatch(ctx, eventType, payload)
+	if err != nil {
+		mod.app.Logger().Error("failed to dispatch webhook", "event", eventType, "error", err)
+	}
+	return err
+}
+
+// Dispatch records a delivery of the event for every active endpoint
+// subscribed to it and returns the deliveries. They are sent in the
+// background. The events module calls this for subscribed event types; call
+// it directly to send events that don't go through the bus.
+func (mod *Module) Dispatch(ctx context.Context, eventType string, payload any) ([]*Delivery, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	orgID := orgIDOf(data)
+
+	endpoints, err := mod.store.ListEndpoints(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+
+	var deliveries []*Delivery
+	for _, endpoint := range endpoints {
+		if !endpoint.Active || !endpoint.subscribes(eventType) {
+			continue
+		}
+		delivery := mod.newDelivery(endpoint.ID, orgID, eventType, data)
+		if err := mod.store.CreateDelivery(ctx, delivery); err != nil {
+			return deliveries, fmt.Errorf("failed to create webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(deliveries) > 0 {
+		mod.notify()
+	}
+	return deliveries, nil
+}
+
+// subscribes reports whether the endpoint receives the event type.
+func (endpoint *Endpoint) subscribes(eventType string) bool {
+	for _, subscribed := range endpoint.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// orgIDOf returns the org ID carried by a JSON payload, if any.
+func orgIDOf(data []byte) string {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"OrgID", "org_id", "orgId"} {
+		if orgID, ok := fields[key].(string); ok && orgID != "" {
+			return orgID
+		}
+	}
+	return ""
+}
+
+func (mod *Module) newDelivery(endpointID, orgID, eventType string, payload json.RawMessage) *Delivery {
+	now := mod.now()
+	return &Delivery{
+		ID:            uuid.New().String(),
+		EndpointID:    endpointID,
+		OrgID:         orgID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// notify wakes the delivery loop. It never blocks.
+func (mod *Module) notify() {
+	select {
+	case mod.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop sends due deliveries until Shutdown, polling at the configured
+// interval and whenever new deliveries are recorded.
+func (mod *Module) loop() {
+	defer mod.stopped.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-mod.stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(mod.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := mod.poll(ctx); err != nil && ctx.Err() == nil {
+			mod.app.Logger().Error("webhook delivery loop failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-mod.wake:
+		}
+	}
+}
+
+// poll hands due deliveries to the queue, or sends them directly when the
+// queue module isn't registered, then works through queued delivery jobs.
+func (mod *Module) poll(ctx context.Context) error {
+	// Pick up subscriptions for endpoints created by other processes
+	if err := mod.syncSubscriptions(ctx); err != nil {
+		return err
+	}
+
+	due, err := mod.store.DueDeliveries(ctx, mod.now(), dueBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to load due deliveries: %w", err)
+	}
+	for _, delivery := range due {
+		if mod.queue == nil {
+			if err := mod.deliver(ctx, delivery); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mod.enqueue(ctx, delivery); err != nil {
+			return err
+		}
+	}
+
+	if mod.queue == nil {
+		return nil
+	}
+	for ctx.Err() == nil {
+		result, err := mod.queue.DequeueByType(ctx, JobType)
+		if errors.Is(err, queue.ErrNoJobs) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to dequeue delivery job: %w", err)
+		}
+		job := result.(*queue.Job)
+		if err := mod.handleJob(ctx, job); err != nil {
+			_ = mod.queue.Fail(ctx, job.ID, err)
+			continue
+		}
+		_ = mod.queue.Complete(ctx, job.ID)
+	}
+	return nil
+}
+
+// enqueue marks a delivery queued and adds a job for it.
+func (mod *Module) enqueue(ctx context.Context, delivery *Delivery) error {
+	delivery.Status = StatusQueued
+	delivery.UpdatedAt = mod.now()
+	if err := mod.store.UpdateDelivery(ctx, delivery); err != nil {
+		return fmt.Errorf("failed to mark delivery queued: %w", err)
+	}
+
+	if _, err := mod.queue.Enqueue(ctx, JobType, deliveryJob{DeliveryID: delivery.ID}); err != nil {
+		// Leave it for the next poll
+		delivery.Status = StatusPending
+		_ = mod.store.UpdateDelivery(ctx, delivery)
+		return fmt.Errorf("failed to enqueue delivery: %w", err)
+	}
+	return nil
+}
+
+// handleJob is the queue handler for JobType jobs.
+func (mod *Module) handleJob(ctx context.Context, job *queue.Job) error {
+	var payload deliveryJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid delivery job payload: %w", err)
+	}
+
+	delivery, err := mod.store.GetDelivery(ctx, payload.DeliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != StatusQueued && delivery.Status != StatusPending {
+		// Already settled, e.g. by a replayed job
+		return nil
+	}
+	return mod.deliver(ctx, delivery)
+}
+
+// deliver makes one attempt at a delivery and records the outcome. A failed
+// attempt is not an error; it schedules a retry or marks the delivery failed.
+// Errors are returned only when the outcome can't be stored.
+func (mod *Module) deliver(ctx context.Context, delivery *Delivery) error {
+	started := mod.now()
+	statusCode, attemptErr := mod.send(ctx, delivery)
+	finished := mod.now()
+
+	delivery.Attempts++
+	attempt := &Attempt{
+		DeliveryID:  delivery.ID,
+		Attempt:     delivery.Attempts,
+		StatusCode:  statusCode,
+		Duration:    finished.Sub(started),
+		AttemptedAt: started,
+	}
+	if attemptErr != nil {
+		attempt.Error = attemptErr.Error()
+	}
+	if err := mod.store.CreateAttempt(ctx, attempt); err != nil {
+		return fmt.Errorf("failed to record delivery attempt: %w", err)
+	}
+
+	delivery.ResponseCode = statusCode
+	delivery.LastError = attempt.Error
+	delivery.UpdatedAt = finished
+	switch {
+	case attemptErr == nil:
+		delivery.Status = StatusSucceeded
+		delivery.DeliveredAt = &finished
+	case delivery.Attempts >= mod.retry.MaxAttempts || errors.Is(attemptErr, ErrEndpointNotFound):
+		delivery.Status = StatusFailed
+		mod.app.Logger().Warn("webhook delivery failed",
+			"delivery_id", delivery.ID,
+			"endpoint_id", delivery.EndpointID,
+			"event", delivery.EventType,
+			"attempts", delivery.Attempts,
+			"error", attemptErr,
+		)
+	default:
+		delivery.Status = StatusPending
+		delivery.NextAttemptAt = finished.Add(mod.retry.backoff(delivery.Attempts))
+	}
+
+	if err := mod.store.UpdateDelivery(ctx, delivery); err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	return nil
+}
+
+// send POSTs a delivery to its endpoint and returns the response status code.
+func (mod *Module) send(ctx context.Context, delivery *Delivery) (int, error) {
+	endpoint, err := mod.store.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return 0, err
+	}
+	if !endpoint.Active {
+		return 0, errors.New("webhook endpoint is disabled")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"id":         delivery.ID,
+		"type":       delivery.EventType,
+		"created_at": delivery.CreatedAt.UTC(),
+		"data":       delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal webhook body: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(verify.DefaultHeader, verify.SignatureHeader([]byte(endpoint.Secret), mod.now(), body))
+
+	response, err := mod.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = response.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBytes))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint responded with %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
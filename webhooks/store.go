@@ -0,0 +1,362 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis/internal/sqlite"
+)
+
+// Store defines the interface for webhook persistence.
+type Store interface {
+	CreateEndpoint(ctx context.Context, endpoint *Endpoint) error
+	GetEndpoint(ctx context.Context, id string) (*Endpoint, error)
+	ListEndpoints(ctx context.Context, orgID string) ([]*Endpoint, error)
+	ListAllEndpoints(ctx context.Context) ([]*Endpoint, error)
+	UpdateEndpoint(ctx context.Context, endpoint *Endpoint) error
+	DeleteEndpoint(ctx context.Context, id string) error
+
+	CreateDelivery(ctx context.Context, delivery *Delivery) error
+	GetDelivery(ctx context.Context, id string) (*Delivery, error)
+	ListDeliveries(ctx context.Context, endpointID string, offset, limit int) ([]*Delivery, error)
+	CountDeliveries(ctx context.Context, endpointID string) (int, error)
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]*Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+
+	CreateAttempt(ctx context.Context, attempt *Attempt) error
+	ListAttempts(ctx context.Context, deliveryID string) ([]*Attempt, error)
+
+	Close() error
+}
+
+// SQLiteStore implements Store using SQLite.
+type SQLiteStore struct {
+	db    *sql.DB
+	owned bool // opened by the store, so closed by Close
+}
+
+// NewSQLiteStore creates a new SQLite-backed webhook store.
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewSQLiteStoreFromDB(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	store.owned = true
+	return store, nil
+}
+
+// NewSQLiteStoreFromDB creates a webhook store on a database the caller
+// owns, such as one from app.Database. Close leaves it open.
+func NewSQLiteStoreFromDB(db *sql.DB) (*SQLiteStore, error) {
+	if err := initWebhookSchema(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// next_attempt_at is stored as Unix milliseconds so due deliveries can be
+// found with a numeric comparison.
+func initWebhookSchema(db *sql.DB) error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id TEXT PRIMARY KEY,
+			org_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			event_types TEXT NOT NULL,
+			active INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_org_id ON webhook_endpoints(org_id);
+
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			endpoint_id TEXT NOT NULL,
+			org_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			response_code INTEGER NOT NULL,
+			next_attempt_at INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			delivered_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+
+		CREATE TABLE IF NOT EXISTS webhook_attempts (
+			delivery_id TEXT NOT NULL,
+			attempt INTEGER NOT NULL,
+			status_code INTEGER NOT NULL,
+			error TEXT NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			attempted_at DATETIME NOT NULL,
+			PRIMARY KEY (delivery_id, attempt)
+		);
+	`
+	_, err := db.Exec(schema)
+	return err
+}
+
+const endpointColumns = `id, org_id, url, secret, event_types, active, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEndpoint(row rowScanner) (*Endpoint, error) {
+	var endpoint Endpoint
+	var eventTypes string
+	err := row.Scan(&endpoint.ID, &endpoint.OrgID, &endpoint.URL, &endpoint.Secret,
+		&eventTypes, &endpoint.Active, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if eventTypes != "" {
+		endpoint.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return &endpoint, nil
+}
+
+func (store *SQLiteStore) CreateEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	query := `INSERT INTO webhook_endpoints (` + endpointColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := store.db.ExecContext(ctx, query,
+		endpoint.ID, endpoint.OrgID, endpoint.URL, endpoint.Secret,
+		strings.Join(endpoint.EventTypes, ","), endpoint.Active, endpoint.CreatedAt, endpoint.UpdatedAt)
+	return err
+}
+
+func (store *SQLiteStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	query := `SELECT ` + endpointColumns + ` FROM webhook_endpoints WHERE id = ?`
+	endpoint, err := scanEndpoint(store.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEndpointNotFound
+		}
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (store *SQLiteStore) ListEndpoints(ctx context.Context, orgID string) ([]*Endpoint, error) {
+	query := `SELECT ` + endpointColumns + ` FROM webhook_endpoints WHERE org_id = ? ORDER BY created_at`
+	return store.queryEndpoints(ctx, query, orgID)
+}
+
+func (store *SQLiteStore) ListAllEndpoints(ctx context.Context) ([]*Endpoint, error) {
+	query := `SELECT ` + endpointColumns + ` FROM webhook_endpoints ORDER BY created_at`
+	return store.queryEndpoints(ctx, query)
+}
+
+func (store *SQLiteStore) queryEndpoints(ctx context.Context, query string, args ...any) ([]*Endpoint, error) {
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var endpoints []*Endpoint
+	for rows.Next() {
+		endpoint, err := scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, rows.Err()
+}
+
+func (store *SQLiteStore) UpdateEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	query := `UPDATE webhook_endpoints SET url = ?, secret = ?, event_types = ?, active = ?, updated_at = ? WHERE id = ?`
+	result, err := store.db.ExecContext(ctx, query,
+		endpoint.URL, endpoint.Secret, strings.Join(endpoint.EventTypes, ","),
+		endpoint.Active, endpoint.UpdatedAt, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEndpointNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) DeleteEndpoint(ctx context.Context, id string) error {
+	query := `DELETE FROM webhook_endpoints WHERE id = ?`
+	result, err := store.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEndpointNotFound
+	}
+	return nil
+}
+
+const deliveryColumns = `id, endpoint_id, org_id, event_type, payload, status, attempts, last_error,
+	response_code, next_attempt_at, created_at, updated_at, delivered_at`
+
+func scanDelivery(row rowScanner) (*Delivery, error) {
+	var delivery Delivery
+	var payload []byte
+	var nextAttemptAt int64
+	var deliveredAt sql.NullTime
+	err := row.Scan(&delivery.ID, &delivery.EndpointID, &delivery.OrgID, &delivery.EventType,
+		&payload, &delivery.Status, &delivery.Attempts, &delivery.LastError,
+		&delivery.ResponseCode, &nextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	delivery.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return &delivery, nil
+}
+
+func (store *SQLiteStore) CreateDelivery(ctx context.Context, delivery *Delivery) error {
+	query := `INSERT INTO webhook_deliveries (` + deliveryColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := store.db.ExecContext(ctx, query,
+		delivery.ID, delivery.EndpointID, delivery.OrgID, delivery.EventType,
+		[]byte(delivery.Payload), delivery.Status, delivery.Attempts, delivery.LastError,
+		delivery.ResponseCode, delivery.NextAttemptAt.UnixMilli(), delivery.CreatedAt, delivery.UpdatedAt, delivery.DeliveredAt)
+	return err
+}
+
+func (store *SQLiteStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+	delivery, err := scanDelivery(store.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (store *SQLiteStore) ListDeliveries(ctx context.Context, endpointID string, offset, limit int) ([]*Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE endpoint_id = ? ORDER BY created_at DESC, id LIMIT ? OFFSET ?`
+	return store.queryDeliveries(ctx, query, endpointID, limit, offset)
+}
+
+func (store *SQLiteStore) CountDeliveries(ctx context.Context, endpointID string) (int, error) {
+	var count int
+	err := store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhook_deliveries WHERE endpoint_id = ?`, endpointID).Scan(&count)
+	return count, err
+}
+
+func (store *SQLiteStore) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]*Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?`
+	return store.queryDeliveries(ctx, query, StatusPending, now.UnixMilli(), limit)
+}
+
+func (store *SQLiteStore) queryDeliveries(ctx context.Context, query string, args ...any) ([]*Delivery, error) {
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []*Delivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (store *SQLiteStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_error = ?, response_code = ?,
+		next_attempt_at = ?, updated_at = ?, delivered_at = ? WHERE id = ?`
+	result, err := store.db.ExecContext(ctx, query,
+		delivery.Status, delivery.Attempts, delivery.LastError, delivery.ResponseCode,
+		delivery.NextAttemptAt.UnixMilli(), delivery.UpdatedAt, delivery.DeliveredAt, delivery.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (store *SQLiteStore) CreateAttempt(ctx context.Context, attempt *Attempt) error {
+	query := `INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := store.db.ExecContext(ctx, query,
+		attempt.DeliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error,
+		attempt.Duration.Milliseconds(), attempt.AttemptedAt)
+	return err
+}
+
+func (store *SQLiteStore) ListAttempts(ctx context.Context, deliveryID string) ([]*Attempt, error) {
+	query := `SELECT delivery_id, attempt, status_code, error, duration_ms, attempted_at
+		FROM webhook_attempts WHERE delivery_id = ? ORDER BY attempt`
+	rows, err := store.db.QueryContext(ctx, query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var attempts []*Attempt
+	for rows.Next() {
+		var attempt Attempt
+		var durationMS int64
+		if err := rows.Scan(&attempt.DeliveryID, &attempt.Attempt, &attempt.StatusCode,
+			&attempt.Error, &durationMS, &attempt.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempt.Duration = time.Duration(durationMS) * time.Millisecond
+		attempts = append(attempts, &attempt)
+	}
+	return attempts, rows.Err()
+}
+
+func (store *SQLiteStore) Close() error {
+	if !store.owned {
+		return nil
+	}
+	return store.db.Close()
+}
+
+// Snapshot writes a copy of the database to path.
+func (store *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	return sqlite.Snapshot(ctx, store.db, path)
+}
+
+// Restore replaces the database contents with the snapshot at path.
+func (store *SQLiteStore) Restore(ctx context.Context, path string) error {
+	return sqlite.Restore(ctx, store.db, path)
+}
@@ -0,0 +1,308 @@
+// Package verify provides signature verification for incoming webhooks.
+//
+// Signatures use the "t=<unix timestamp>,v1=<hex HMAC-SHA256>" header format,
+// where the HMAC is computed over "<timestamp>.<raw body>". This is the format
+// chassis uses for the webhooks it emits, and it is compatible with Stripe's
+// Stripe-Signature header, so the same Verifier can be reused when receiving
+// provider webhooks.
+//
+// # Usage
+//
+// Verify a request in an HTTP handler:
+//
+//	verifier := verify.New([]byte(secret),
+//	    verify.WithTolerance(5*time.Minute),
+//	    verify.WithReplayCache(app.Cache().(*cache.Module)),
+//	)
+//
+//	body, err := verifier.VerifyRequest(request)
+//	if err != nil {
+//	    api.WriteError(writer, request, err)
+//	    return
+//	}
+//
+// Produce a signature header (used by senders):
+//
+//	header := verify.SignatureHeader(secret, time.Now(), body)
+//
+// # Replay Protection
+//
+// When a ReplayCache is configured, each accepted signature is remembered for
+// the tolerance window and a second delivery with the same signature is
+// rejected with ErrReplayed, even when both arrive at once. The cache module
+// satisfies ReplayCache with a provider supporting atomic operations, such
+// as the memory provider.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/api"
+)
+
+var (
+	ErrMissingSignature   = chassis.NewError(chassis.CodeUnauthenticated, "missing webhook signature")
+	ErrMalformedSignature = chassis.NewError(chassis.CodeUnauthenticated, "malformed webhook signature header")
+	ErrInvalidSignature   = chassis.NewError(chassis.CodeUnauthenticated, "webhook signature does not match")
+	ErrTimestampExpired   = chassis.NewError(chassis.CodeUnauthenticated, "webhook timestamp outside tolerance")
+	ErrReplayed           = chassis.NewError(chassis.CodeAlreadyExists, "webhook already processed")
+)
+
+// DefaultHeader is the HTTP header chassis uses to carry webhook signatures.
+const DefaultHeader = "X-Chassis-Signature"
+
+// DefaultTolerance is the maximum allowed clock difference between the
+// signature timestamp and the receiver.
+const DefaultTolerance = 5 * time.Minute
+
+// DefaultMaxBodyBytes limits how much of a request body VerifyRequest reads.
+const DefaultMaxBodyBytes = 1 << 20
+
+// ReplayCache records signatures that have already been accepted. SetNX
+// must store the key only if it is absent, atomically, so concurrent
+// deliveries of one signature can't both be accepted. The cache module's
+// *cache.Module implements this interface with an atomic provider.
+type ReplayCache interface {
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// Verifier checks webhook signatures against one or more shared secrets.
+type Verifier struct {
+	secrets      [][]byte
+	header       string
+	tolerance    time.Duration
+	maxBodyBytes int64
+	replayCache  ReplayCache
+	replayPrefix string
+	now          func() time.Time
+}
+
+// Option is a function that configures a Verifier.
+type Option func(*Verifier)
+
+// WithTolerance sets the allowed timestamp skew. Zero disables the check.
+func WithTolerance(tolerance time.Duration) Option {
+	return func(verifier *Verifier) {
+		verifier.tolerance = tolerance
+	}
+}
+
+// WithHeader sets the HTTP header VerifyRequest reads the signature from.
+func WithHeader(name string) Option {
+	return func(verifier *Verifier) {
+		verifier.header = name
+	}
+}
+
+// WithReplayCache enables replay protection using the given cache.
+func WithReplayCache(cache ReplayCache) Option {
+	return func(verifier *Verifier) {
+		verifier.replayCache = cache
+	}
+}
+
+// WithReplayPrefix sets the cache key prefix used for replay records.
+func WithReplayPrefix(prefix string) Option {
+	return func(verifier *Verifier) {
+		verifier.replayPrefix = prefix
+	}
+}
+
+// WithAdditionalSecrets accepts signatures made with any of the given secrets.
+// Useful while rotating a secret.
+func WithAdditionalSecrets(secrets ...[]byte) Option {
+	return func(verifier *Verifier) {
+		verifier.secrets = append(verifier.secrets, secrets...)
+	}
+}
+
+// WithMaxBodyBytes limits the request body size read by VerifyRequest.
+func WithMaxBodyBytes(limit int64) Option {
+	return func(verifier *Verifier) {
+		verifier.maxBodyBytes = limit
+	}
+}
+
+// WithClock overrides the time source. Intended for tests.
+func WithClock(now func() time.Time) Option {
+	return func(verifier *Verifier) {
+		verifier.now = now
+	}
+}
+
+// New creates a Verifier for the given secret.
+func New(secret []byte, opts ...Option) *Verifier {
+	verifier := &Verifier{
+		secrets:      [][]byte{secret},
+		header:       DefaultHeader,
+		tolerance:    DefaultTolerance,
+		maxBodyBytes: DefaultMaxBodyBytes,
+		replayPrefix: "webhook:replay:",
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(verifier)
+	}
+
+	return verifier
+}
+
+// Verify checks a signature header against the raw payload.
+func (verifier *Verifier) Verify(ctx context.Context, header string, payload []byte) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+
+	timestamp, signatures, err := ParseHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if verifier.tolerance > 0 {
+		skew := verifier.now().Sub(timestamp)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > verifier.tolerance {
+			return ErrTimestampExpired
+		}
+	}
+
+	matched := ""
+	for _, secret := range verifier.secrets {
+		expected := Compute(secret, timestamp, payload)
+		for _, signature := range signatures {
+			if Equal(expected, signature) {
+				matched = signature
+			}
+		}
+	}
+	if matched == "" {
+		return ErrInvalidSignature
+	}
+
+	if verifier.replayCache != nil {
+		ttl := verifier.tolerance
+		if ttl <= 0 {
+			ttl = DefaultTolerance
+		}
+		// Keep the record a little longer than the window the timestamp allows
+		recorded, err := verifier.replayCache.SetNX(ctx, verifier.replayPrefix+matched, []byte{1}, 2*ttl)
+		if err != nil {
+			return fmt.Errorf("failed to record webhook signature: %w", err)
+		}
+		if !recorded {
+			return ErrReplayed
+		}
+	}
+
+	return nil
+}
+
+// VerifyRequest reads the request body, verifies its signature, and returns
+// the body. The request body is replaced so downstream handlers can read it again.
+func (verifier *Verifier) VerifyRequest(request *http.Request) ([]byte, error) {
+	header := request.Header.Get(verifier.header)
+	if header == "" {
+		return nil, ErrMissingSignature
+	}
+
+	body, err := io.ReadAll(io.LimitReader(request.Body, verifier.maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook body: %w", err)
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := verifier.Verify(request.Context(), header, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Middleware returns HTTP middleware that rejects requests with invalid
+// signatures with an api error envelope (401, or 409 for replays).
+func (verifier *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, err := verifier.VerifyRequest(request); err != nil {
+			api.WriteError(writer, request, err)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Compute returns the hex-encoded HMAC-SHA256 of "<unix timestamp>.<payload>".
+func Compute(secret []byte, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader builds a signature header value for the payload.
+func SignatureHeader(secret []byte, timestamp time.Time, payload []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), Compute(secret, timestamp, payload))
+}
+
+// ParseHeader splits a signature header into its timestamp and v1 signatures.
+// Unknown schemes are ignored so senders can add new versions.
+func ParseHeader(header string) (time.Time, []string, error) {
+	var timestamp time.Time
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return time.Time{}, nil, ErrMalformedSignature
+		}
+		switch key {
+		case "t":
+			unix, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return time.Time{}, nil, ErrMalformedSignature
+			}
+			timestamp = time.Unix(unix, 0)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp.IsZero() || len(signatures) == 0 {
+		return time.Time{}, nil, ErrMalformedSignature
+	}
+	return timestamp, signatures, nil
+}
+
+// Equal reports whether two hex signatures match using a constant-time comparison.
+func Equal(expected, actual string) bool {
+	expectedBytes, err := hex.DecodeString(expected)
+	if err != nil {
+		return false
+	}
+	actualBytes, err := hex.DecodeString(actual)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expectedBytes, actualBytes)
+}
+
+// VerifyHMAC checks a raw hex HMAC-SHA256 signature over the payload without
+// any timestamp. Some providers sign payloads this way.
+func VerifyHMAC(secret, payload []byte, signature string) bool {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return Equal(hex.EncodeToString(mac.Sum(nil)), signature)
+}
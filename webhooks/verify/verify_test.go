@@ -0,0 +1,221 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis/cache"
+)
+
+var testSecret = []byte("whsec_test")
+
+func fixedClock(at time.Time) func() time.Time {
+	return func() time.Time { return at }
+}
+
+func TestVerify_ValidSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"event":"user.created"}`)
+	header := SignatureHeader(testSecret, now, payload)
+
+	verifier := New(testSecret, WithClock(fixedClock(now)))
+	if err := verifier.Verify(context.Background(), header, payload); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+}
+
+func TestVerify_InvalidSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	header := SignatureHeader([]byte("other-secret"), now, []byte("payload"))
+
+	verifier := New(testSecret, WithClock(fixedClock(now)))
+	err := verifier.Verify(context.Background(), header, []byte("payload"))
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+}
+
+func TestVerify_TamperedPayload(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	header := SignatureHeader(testSecret, now, []byte("original"))
+
+	verifier := New(testSecret, WithClock(fixedClock(now)))
+	err := verifier.Verify(context.Background(), header, []byte("tampered"))
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+}
+
+func TestVerify_Tolerance(t *testing.T) {
+	signedAt := time.Unix(1700000000, 0)
+	payload := []byte("payload")
+	header := SignatureHeader(testSecret, signedAt, payload)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+	}{
+		{"within tolerance", signedAt.Add(4 * time.Minute), nil},
+		{"too old", signedAt.Add(6 * time.Minute), ErrTimestampExpired},
+		{"too far in future", signedAt.Add(-6 * time.Minute), ErrTimestampExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := New(testSecret, WithClock(fixedClock(tt.now)))
+			err := verifier.Verify(context.Background(), header, payload)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerify_ToleranceDisabled(t *testing.T) {
+	signedAt := time.Unix(1700000000, 0)
+	payload := []byte("payload")
+	header := SignatureHeader(testSecret, signedAt, payload)
+
+	verifier := New(testSecret, WithTolerance(0), WithClock(fixedClock(signedAt.Add(24*time.Hour))))
+	if err := verifier.Verify(context.Background(), header, payload); err != nil {
+		t.Errorf("Verify with tolerance disabled should succeed, got: %v", err)
+	}
+}
+
+func TestVerify_MalformedHeader(t *testing.T) {
+	verifier := New(testSecret)
+	ctx := context.Background()
+
+	headers := []string{
+		"garbage",
+		"t=notanumber,v1=abcd",
+		"t=1700000000",
+		"v1=abcd",
+	}
+	for _, header := range headers {
+		if err := verifier.Verify(ctx, header, nil); !errors.Is(err, ErrMalformedSignature) {
+			t.Errorf("header %q: expected ErrMalformedSignature, got: %v", header, err)
+		}
+	}
+
+	if err := verifier.Verify(ctx, "", nil); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("expected ErrMissingSignature, got: %v", err)
+	}
+}
+
+func TestVerify_ReplayCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte("payload")
+	header := SignatureHeader(testSecret, now, payload)
+
+	verifier := New(testSecret,
+		WithClock(fixedClock(now)),
+		WithReplayCache(cache.New(cache.WithProvider(cache.NewMemoryProvider()))),
+	)
+	ctx := context.Background()
+
+	if err := verifier.Verify(ctx, header, payload); err != nil {
+		t.Fatalf("first Verify failed: %v", err)
+	}
+	if err := verifier.Verify(ctx, header, payload); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected ErrReplayed on second delivery, got: %v", err)
+	}
+
+	// Concurrent deliveries of one signature are accepted once
+	concurrent := SignatureHeader(testSecret, now, []byte("concurrent"))
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if verifier.Verify(ctx, concurrent, []byte("concurrent")) == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted.Load() != 1 {
+		t.Errorf("expected one concurrent delivery accepted, got %d", accepted.Load())
+	}
+}
+
+func TestVerify_AdditionalSecrets(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	oldSecret := []byte("old-secret")
+	payload := []byte("payload")
+	header := SignatureHeader(oldSecret, now, payload)
+
+	verifier := New(testSecret, WithAdditionalSecrets(oldSecret), WithClock(fixedClock(now)))
+	if err := verifier.Verify(context.Background(), header, payload); err != nil {
+		t.Errorf("signature from rotated secret should verify, got: %v", err)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"id":"evt_1"}`)
+
+	request := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(payload))
+	request.Header.Set(DefaultHeader, SignatureHeader(testSecret, now, payload))
+
+	verifier := New(testSecret, WithClock(fixedClock(now)))
+	body, err := verifier.VerifyRequest(request)
+	if err != nil {
+		t.Fatalf("VerifyRequest failed: %v", err)
+	}
+	if string(body) != string(payload) {
+		t.Errorf("body mismatch: got %q", body)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte("payload")
+	verifier := New(testSecret, WithClock(fixedClock(now)))
+
+	called := false
+	handler := verifier.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		called = true
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(payload))
+	request.Header.Set(DefaultHeader, "t=1700000000,v1=deadbeef")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", recorder.Code)
+	}
+	if called {
+		t.Error("handler should not be called for invalid signature")
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	payload := []byte("payload")
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(payload)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	if !VerifyHMAC(testSecret, payload, signature) {
+		t.Error("raw HMAC signature should match")
+	}
+	if VerifyHMAC(testSecret, []byte("other"), signature) {
+		t.Error("signature should not match a different payload")
+	}
+	if VerifyHMAC(testSecret, payload, "not-hex") {
+		t.Error("non-hex signature should not match")
+	}
+}
@@ -0,0 +1,543 @@
+// Package webhooks delivers chassis events to HTTP endpoints registered by orgs.
+//
+// Orgs register endpoint URLs for the event types they care about. The
+// module subscribes to those types on the event bus, records a delivery for
+// each matching endpoint, and POSTs the event with an HMAC signature that
+// receivers check with the webhooks/verify package. Failed deliveries are
+// retried with exponential backoff, and every attempt is recorded so
+// deliveries can be inspected and replayed.
+//
+// # Usage
+//
+// Register the module after events (and queue, if used), keeping a
+// reference to it:
+//
+//	hooks := webhooks.New()
+//	app := chassis.New(
+//	    chassis.WithModules(
+//	        events.New(),
+//	        queue.New(),
+//	        hooks,
+//	    ),
+//	)
+//
+// Register an endpoint for an org:
+//
+//	endpoint, err := hooks.CreateEndpoint(ctx, orgID, "https://example.com/hooks",
+//	    orgs.EventMemberAdded, orgs.EventMemberRemoved,
+//	)
+//	// Share endpoint.Secret with the receiver so it can verify signatures
+//
+// Inspect and replay deliveries:
+//
+//	deliveries, _ := hooks.ListDeliveries(ctx, endpoint.ID, pagination.Request{Limit: 50})
+//	attempts, _ := hooks.ListAttempts(ctx, deliveries.Items[0].ID)
+//	replayed, _ := hooks.Replay(ctx, deliveries.Items[0].ID)
+//
+// # Routing
+//
+// An event is delivered to an org's endpoints when its payload carries that
+// org's ID in an OrgID, org_id or orgId field (e.g., *orgs.MemberEvent).
+// Events without an org ID are delivered only to endpoints registered with
+// an empty org ID, so one tenant never receives another tenant's events.
+//
+// # Requests
+//
+// Each delivery is a POST with a JSON body:
+//
+//	{"id": "<delivery id>", "type": "org.member_added", "created_at": "...", "data": {...}}
+//
+// and these headers:
+//
+//	X-Chassis-Signature: t=<unix timestamp>,v1=<hex HMAC-SHA256>
+//	X-Chassis-Event:     org.member_added
+//	X-Chassis-Delivery:  <delivery id>
+//
+// Any 2xx response counts as delivered. The delivery ID stays the same
+// across retries, so receivers can use it to deduplicate.
+//
+// # Queue
+//
+// When the queue module is registered, due deliveries are enqueued as
+// "webhooks.deliver" jobs and the module registers a handler for that type
+// with queue.Handle, so any queue worker can send them. Without the queue,
+// deliveries are sent from the module's own poll loop.
+//
+// # Configuration
+//
+// Configure via config.yaml:
+//
+//	webhooks:
+//	  db_path: ./data/webhooks.db
+//	  max_attempts: 6
+//	  timeout: 10s
+//
+// Or programmatically:
+//
+//	webhooks.New(
+//	    webhooks.WithDBPath("/custom/webhooks.db"),
+//	    webhooks.WithRetryPolicy(webhooks.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}),
+//	)
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/queue"
+)
+
+var (
+	ErrEndpointNotFound   = chassis.NewError(chassis.CodeNotFound, "webhook endpoint not found")
+	ErrDeliveryNotFound   = chassis.NewError(chassis.CodeNotFound, "webhook delivery not found")
+	ErrInvalidURL         = chassis.NewError(chassis.CodeInvalidArgument, "webhook URL must be an absolute http or https URL")
+	ErrEventTypesRequired = chassis.NewError(chassis.CodeInvalidArgument, "webhook endpoint needs at least one event type")
+)
+
+// JobType is the queue job type used for deliveries.
+const JobType = "webhooks.deliver"
+
+// Headers set on every delivery, in addition to the signature header.
+const (
+	EventHeader    = "X-Chassis-Event"
+	DeliveryHeader = "X-Chassis-Delivery"
+)
+
+// Endpoint is a URL that receives webhooks for an org.
+type Endpoint struct {
+	ID         string
+	OrgID      string
+	URL        string
+	Secret     string
+	EventTypes []string
+	Active     bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// DeliveryStatus represents the status of a delivery.
+type DeliveryStatus string
+
+const (
+	StatusPending   DeliveryStatus = "pending"
+	StatusQueued    DeliveryStatus = "queued"
+	StatusSucceeded DeliveryStatus = "succeeded"
+	StatusFailed    DeliveryStatus = "failed"
+)
+
+// Delivery is one event sent to one endpoint, across all its attempts.
+type Delivery struct {
+	ID            string
+	EndpointID    string
+	OrgID         string
+	EventType     string
+	Payload       json.RawMessage
+	Status        DeliveryStatus
+	Attempts      int
+	LastError     string
+	ResponseCode  int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeliveredAt   *time.Time
+}
+
+// Attempt records a single HTTP request made for a delivery.
+type Attempt struct {
+	DeliveryID  string
+	Attempt     int
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+	AttemptedAt time.Time
+}
+
+// RetryPolicy controls how failed deliveries are retried.
+// Backoff doubles after each attempt, starting at InitialBackoff and capped at MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy tries a delivery six times over roughly five minutes.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    6,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     time.Hour,
+}
+
+// backoff returns the delay after the given failed attempt (1-based).
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxBackoff > 0 && delay >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// DefaultPollInterval is how often the module looks for due deliveries.
+const DefaultPollInterval = time.Second
+
+// Module is the webhooks module implementation.
+type Module struct {
+	store        Store
+	dbPath       string
+	app          *chassis.App
+	client       *http.Client
+	retry        RetryPolicy
+	pollInterval time.Duration
+	now          func() time.Time
+
+	// queue is set when the queue module is registered
+	queue *queue.Module
+
+	subscribedMu sync.Mutex
+	subscribed   map[string]func()
+
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// Option is a function that configures the webhooks module.
+type Option func(*Module)
+
+// WithStore sets a custom store implementation.
+func WithStore(store Store) Option {
+	return func(mod *Module) {
+		mod.store = store
+	}
+}
+
+// WithDBPath sets the SQLite database path.
+func WithDBPath(path string) Option {
+	return func(mod *Module) {
+		mod.dbPath = path
+	}
+}
+
+// WithHTTPClient sets the client used to send deliveries.
+func WithHTTPClient(client *http.Client) Option {
+	return func(mod *Module) {
+		mod.client = client
+	}
+}
+
+// WithRetryPolicy sets how failed deliveries are retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(mod *Module) {
+		mod.retry = policy
+	}
+}
+
+// WithPollInterval sets how often the module looks for due deliveries.
+func WithPollInterval(interval time.Duration) Option {
+	return func(mod *Module) {
+		mod.pollInterval = interval
+	}
+}
+
+// WithClock sets the time source. Intended for tests.
+func WithClock(now func() time.Time) Option {
+	return func(mod *Module) {
+		mod.now = now
+	}
+}
+
+// New creates a new webhooks module with the given options.
+func New(opts ...Option) *Module {
+	mod := &Module{
+		dbPath:       "./data/webhooks.db",
+		client:       &http.Client{Timeout: 10 * time.Second},
+		retry:        DefaultRetryPolicy,
+		pollInterval: DefaultPollInterval,
+		now:          time.Now,
+		subscribed:   make(map[string]func()),
+		wake:         make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(mod)
+	}
+
+	return mod
+}
+
+// Name returns the module identifier.
+func (mod *Module) Name() string {
+	return "webhooks"
+}
+
+// Init initializes the webhooks module, subscribes to the event types of all
+// registered endpoints and starts the delivery loop.
+func (mod *Module) Init(ctx context.Context, app *chassis.App) error {
+	mod.app = app
+
+	// Read config if available
+	if cfg := app.ConfigData(); cfg != nil {
+		if dbPath := cfg.GetString("webhooks.db_path"); dbPath != "" {
+			mod.dbPath = dbPath
+		}
+		if maxAttempts := cfg.GetString("webhooks.max_attempts"); maxAttempts != "" {
+			if attempts, err := strconv.Atoi(maxAttempts); err == nil {
+				mod.retry.MaxAttempts = attempts
+			}
+		}
+		if cfg.Get("webhooks.timeout") != nil {
+			timeout, err := cfg.MustGetDuration("webhooks.timeout")
+			if err != nil {
+				return err
+			}
+			mod.client.Timeout = timeout
+		}
+	}
+	if mod.retry.MaxAttempts < 1 {
+		mod.retry.MaxAttempts = 1
+	}
+
+	// Use default SQLite store if none provided
+	if mod.store == nil {
+		sqliteStore, err := openSQLiteStore(app, mod.dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to create webhooks store: %w", err)
+		}
+		mod.store = sqliteStore
+	}
+
+	if queueAPI, ok := app.TryQueue(); ok {
+		if queueMod, ok := queueAPI.(*queue.Module); ok {
+			mod.queue = queueMod
+			queueMod.Handle(JobType, mod.handleJob)
+		}
+	}
+
+	if err := mod.syncSubscriptions(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe webhook endpoints: %w", err)
+	}
+
+	mod.stop = make(chan struct{})
+	mod.stopped.Add(1)
+	go mod.loop()
+
+	app.Logger().Info("webhooks module initialized",
+		"db_path", mod.dbPath,
+		"queue", mod.queue != nil,
+	)
+	return nil
+}
+
+// openSQLiteStore creates the store on the database named by
+// webhooks.database, shared with the modules naming the same one, or on its own
+// file at dbPath.
+func openSQLiteStore(app *chassis.App, dbPath string) (*SQLiteStore, error) {
+	db, err := app.ModuleDatabase("webhooks")
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return NewSQLiteStore(dbPath)
+	}
+	return NewSQLiteStoreFromDB(db)
+}
+
+// Shutdown stops the delivery loop, unsubscribes from events and closes the store.
+func (mod *Module) Shutdown(ctx context.Context) error {
+	if mod.stop != nil {
+		close(mod.stop)
+		mod.stopped.Wait()
+		mod.stop = nil
+	}
+
+	mod.subscribedMu.Lock()
+	for eventType, unsubscribe := range mod.subscribed {
+		unsubscribe()
+		delete(mod.subscribed, eventType)
+	}
+	mod.subscribedMu.Unlock()
+
+	if mod.store != nil {
+		return mod.store.Close()
+	}
+	return nil
+}
+
+// Snapshot saves the module's store into dir. Implements chassis.Snapshotter.
+func (mod *Module) Snapshot(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Snapshot(ctx, filepath.Join(dir, "webhooks.db"))
+}
+
+// Restore resets the module's store to the snapshot in dir.
+func (mod *Module) Restore(ctx context.Context, dir string) error {
+	snapshotter, ok := mod.store.(chassis.Snapshotter)
+	if !ok {
+		return chassis.ErrSnapshotNotSupported
+	}
+	return snapshotter.Restore(ctx, filepath.Join(dir, "webhooks.db"))
+}
+
+// CreateEndpoint registers a URL that receives the given event types for an
+// org. A signing secret is generated and returned in Endpoint.Secret.
+func (mod *Module) CreateEndpoint(ctx context.Context, orgID, endpointURL string, eventTypes ...string) (*Endpoint, error) {
+	if err := validateEndpoint(endpointURL, eventTypes); err != nil {
+		return nil, err
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	now := mod.now()
+	endpoint := &Endpoint{
+		ID:         uuid.New().String(),
+		OrgID:      orgID,
+		URL:        endpointURL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Active:     true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := mod.store.CreateEndpoint(ctx, endpoint); err != nil {
+		return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	mod.subscribe(eventTypes)
+	return endpoint, nil
+}
+
+// GetEndpoint retrieves an endpoint by ID.
+func (mod *Module) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	return mod.store.GetEndpoint(ctx, id)
+}
+
+// ListEndpoints returns the endpoints registered for an org.
+func (mod *Module) ListEndpoints(ctx context.Context, orgID string) ([]*Endpoint, error) {
+	return mod.store.ListEndpoints(ctx, orgID)
+}
+
+// UpdateEndpoint saves changes to an endpoint's URL, event types, secret or active flag.
+func (mod *Module) UpdateEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	if err := validateEndpoint(endpoint.URL, endpoint.EventTypes); err != nil {
+		return err
+	}
+	endpoint.UpdatedAt = mod.now()
+	if err := mod.store.UpdateEndpoint(ctx, endpoint); err != nil {
+		return err
+	}
+	mod.subscribe(endpoint.EventTypes)
+	return nil
+}
+
+// RotateSecret replaces an endpoint's signing secret and returns the new one.
+func (mod *Module) RotateSecret(ctx context.Context, id string) (string, error) {
+	endpoint, err := mod.store.GetEndpoint(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	endpoint.Secret = secret
+	endpoint.UpdatedAt = mod.now()
+	if err := mod.store.UpdateEndpoint(ctx, endpoint); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// DeleteEndpoint removes an endpoint. Its pending deliveries fail on their next attempt.
+func (mod *Module) DeleteEndpoint(ctx context.Context, id string) error {
+	return mod.store.DeleteEndpoint(ctx, id)
+}
+
+// GetDelivery retrieves a delivery by ID.
+func (mod *Module) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	return mod.store.GetDelivery(ctx, id)
+}
+
+// ListDeliveries returns a page of an endpoint's deliveries, newest first.
+func (mod *Module) ListDeliveries(ctx context.Context, endpointID string, req pagination.Request) (*pagination.Result[*Delivery], error) {
+	req = req.Normalize()
+	offset, err := req.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := mod.store.ListDeliveries(ctx, endpointID, offset, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := mod.store.CountDeliveries(ctx, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(deliveries, req, offset, total), nil
+}
+
+// ListAttempts returns the attempts made for a delivery, oldest first.
+func (mod *Module) ListAttempts(ctx context.Context, deliveryID string) ([]*Attempt, error) {
+	return mod.store.ListAttempts(ctx, deliveryID)
+}
+
+// Replay sends a delivery's event to its endpoint again as a new delivery.
+func (mod *Module) Replay(ctx context.Context, deliveryID string) (*Delivery, error) {
+	original, err := mod.store.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mod.store.GetEndpoint(ctx, original.EndpointID); err != nil {
+		return nil, err
+	}
+
+	delivery := mod.newDelivery(original.EndpointID, original.OrgID, original.EventType, original.Payload)
+	if err := mod.store.CreateDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	mod.notify()
+	return delivery, nil
+}
+
+func validateEndpoint(endpointURL string, eventTypes []string) error {
+	parsed, err := url.Parse(endpointURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidURL
+	}
+	if len(eventTypes) == 0 {
+		return ErrEventTypesRequired
+	}
+	for _, eventType := range eventTypes {
+		if eventType == "" {
+			return ErrEventTypesRequired
+		}
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,320 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/talosaether/chassis"
+	"github.com/talosaether/chassis/events"
+	"github.com/talosaether/chassis/orgs"
+	"github.com/talosaether/chassis/pagination"
+	"github.com/talosaether/chassis/queue"
+	"github.com/talosaether/chassis/webhooks/verify"
+)
+
+// receiver is a test webhook endpoint that records requests and responds
+// with a 500 to the first failures of them.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, failures int) (*receiver, *httptest.Server) {
+	t.Helper()
+	recv := &receiver{failures: failures, received: make(chan struct{}, 16)}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		recv.mu.Lock()
+		recv.requests = append(recv.requests, request)
+		recv.bodies = append(recv.bodies, body)
+		fail := len(recv.requests) <= recv.failures
+		recv.mu.Unlock()
+
+		if fail {
+			writer.WriteHeader(http.StatusInternalServerError)
+		} else {
+			writer.WriteHeader(http.StatusNoContent)
+		}
+		recv.received <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return recv, server
+}
+
+func (recv *receiver) wait(t *testing.T, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-recv.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d requests, got %d", count, i)
+		}
+	}
+}
+
+func setupWebhooks(t *testing.T, withQueue bool) *Module {
+	t.Helper()
+	dir := t.TempDir()
+	mod := New(
+		WithDBPath(filepath.Join(dir, "webhooks.db")),
+		WithPollInterval(10*time.Millisecond),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}),
+	)
+
+	modules := []chassis.Module{events.New()}
+	if withQueue {
+		modules = append(modules, queue.New(queue.WithDBPath(filepath.Join(dir, "queue.db"))))
+	}
+	modules = append(modules, mod)
+
+	app := chassis.New(chassis.WithModules(modules...))
+	t.Cleanup(func() { _ = app.Shutdown(context.Background()) })
+	return mod
+}
+
+func waitForStatus(t *testing.T, mod *Module, deliveryID string, status DeliveryStatus) *Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		delivery, err := mod.GetDelivery(context.Background(), deliveryID)
+		if err != nil {
+			t.Fatalf("failed to get delivery: %v", err)
+		}
+		if delivery.Status == status {
+			return delivery
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected delivery %s, got %s", status, delivery.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func onlyDelivery(t *testing.T, mod *Module, endpointID string) *Delivery {
+	t.Helper()
+	deliveries, err := mod.ListDeliveries(context.Background(), endpointID, pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to list deliveries: %v", err)
+	}
+	if len(deliveries.Items) != 1 || deliveries.Total != 1 {
+		t.Fatalf("expected 1 delivery, got %d of %d", len(deliveries.Items), deliveries.Total)
+	}
+	return deliveries.Items[0]
+}
+
+func TestCreateEndpoint_Validation(t *testing.T) {
+	mod := setupWebhooks(t, false)
+	ctx := context.Background()
+
+	if _, err := mod.CreateEndpoint(ctx, "org-1", "ftp://example.com", orgs.EventMemberAdded); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("expected ErrInvalidURL, got %v", err)
+	}
+	if _, err := mod.CreateEndpoint(ctx, "org-1", "https://example.com/hooks"); !errors.Is(err, ErrEventTypesRequired) {
+		t.Errorf("expected ErrEventTypesRequired, got %v", err)
+	}
+
+	endpoint, err := mod.CreateEndpoint(ctx, "org-1", "https://example.com/hooks", orgs.EventMemberAdded)
+	if err != nil {
+		t.Fatalf("failed to create endpoint: %v", err)
+	}
+	if endpoint.Secret == "" || !endpoint.Active {
+		t.Errorf("expected an active endpoint with a secret, got %+v", endpoint)
+	}
+
+	listed, err := mod.ListEndpoints(ctx, "org-1")
+	if err != nil || len(listed) != 1 || listed[0].EventTypes[0] != orgs.EventMemberAdded {
+		t.Errorf("expected endpoint to be listed, got %v (%v)", listed, err)
+	}
+
+	if err := mod.DeleteEndpoint(ctx, endpoint.ID); err != nil {
+		t.Fatalf("failed to delete endpoint: %v", err)
+	}
+	if _, err := mod.GetEndpoint(ctx, endpoint.ID); !errors.Is(err, ErrEndpointNotFound) {
+		t.Errorf("expected ErrEndpointNotFound, got %v", err)
+	}
+}
+
+func TestDelivery_SignedAndRoutedByOrg(t *testing.T) {
+	for _, withQueue := range []bool{false, true} {
+		name := "inline"
+		if withQueue {
+			name = "queue"
+		}
+		t.Run(name, func(t *testing.T) {
+			mod := setupWebhooks(t, withQueue)
+			ctx := context.Background()
+			recv, server := newReceiver(t, 0)
+
+			endpoint, err := mod.CreateEndpoint(ctx, "org-1", server.URL, orgs.EventMemberAdded)
+			if err != nil {
+				t.Fatalf("failed to create endpoint: %v", err)
+			}
+
+			// Another org's event must not reach this endpoint
+			mod.app.PublishEvent(ctx, orgs.EventMemberAdded, &orgs.MemberEvent{OrgID: "org-2", UserID: "user-2"})
+			mod.app.PublishEvent(ctx, orgs.EventMemberAdded, &orgs.MemberEvent{OrgID: "org-1", UserID: "user-1"})
+			recv.wait(t, 1)
+
+			delivery := waitForStatus(t, mod, onlyDelivery(t, mod, endpoint.ID).ID, StatusSucceeded)
+			if delivery.Attempts != 1 || delivery.ResponseCode != http.StatusNoContent {
+				t.Errorf("unexpected delivery: %+v", delivery)
+			}
+
+			recv.mu.Lock()
+			request, body := recv.requests[0], recv.bodies[0]
+			recv.mu.Unlock()
+
+			if request.Header.Get(EventHeader) != orgs.EventMemberAdded {
+				t.Errorf("expected event header, got %q", request.Header.Get(EventHeader))
+			}
+			if request.Header.Get(DeliveryHeader) != delivery.ID {
+				t.Errorf("expected delivery header %q, got %q", delivery.ID, request.Header.Get(DeliveryHeader))
+			}
+			verifier := verify.New([]byte(endpoint.Secret))
+			if err := verifier.Verify(ctx, request.Header.Get(verify.DefaultHeader), body); err != nil {
+				t.Errorf("signature should verify: %v", err)
+			}
+
+			var envelope struct {
+				ID   string
+				Type string
+				Data orgs.MemberEvent
+			}
+			if err := json.Unmarshal(body, &envelope); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+			if envelope.ID != delivery.ID || envelope.Data.UserID != "user-1" {
+				t.Errorf("unexpected body: %s", body)
+			}
+		})
+	}
+}
+
+func TestDelivery_RetriesThenFails(t *testing.T) {
+	mod := setupWebhooks(t, true)
+	ctx := context.Background()
+	recv, server := newReceiver(t, 10)
+
+	endpoint, err := mod.CreateEndpoint(ctx, "org-1", server.URL, orgs.EventMemberAdded)
+	if err != nil {
+		t.Fatalf("failed to create endpoint: %v", err)
+	}
+	mod.app.PublishEvent(ctx, orgs.EventMemberAdded, &orgs.MemberEvent{OrgID: "org-1"})
+	recv.wait(t, 3)
+
+	delivery := waitForStatus(t, mod, onlyDelivery(t, mod, endpoint.ID).ID, StatusFailed)
+	if delivery.Attempts != 3 || delivery.ResponseCode != http.StatusInternalServerError {
+		t.Errorf("unexpected delivery: %+v", delivery)
+	}
+
+	attempts, err := mod.ListAttempts(ctx, delivery.ID)
+	if err != nil {
+		t.Fatalf("failed to list attempts: %v", err)
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(attempts))
+	}
+	for i, attempt := range attempts {
+		if attempt.Attempt != i+1 || attempt.Error == "" {
+			t.Errorf("unexpected attempt %d: %+v", i, attempt)
+		}
+	}
+}
+
+func TestDelivery_RecoversAfterFailure(t *testing.T) {
+	mod := setupWebhooks(t, false)
+	ctx := context.Background()
+	recv, server := newReceiver(t, 1)
+
+	endpoint, err := mod.CreateEndpoint(ctx, "org-1", server.URL, orgs.EventMemberAdded)
+	if err != nil {
+		t.Fatalf("failed to create endpoint: %v", err)
+	}
+	mod.app.PublishEvent(ctx, orgs.EventMemberAdded, &orgs.MemberEvent{OrgID: "org-1"})
+	recv.wait(t, 2)
+
+	delivery := waitForStatus(t, mod, onlyDelivery(t, mod, endpoint.ID).ID, StatusSucceeded)
+	if delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Errorf("unexpected delivery: %+v", delivery)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	mod := setupWebhooks(t, false)
+	ctx := context.Background()
+	recv, server := newReceiver(t, 0)
+
+	endpoint, err := mod.CreateEndpoint(ctx, "org-1", server.URL, orgs.EventMemberAdded)
+	if err != nil {
+		t.Fatalf("failed to create endpoint: %v", err)
+	}
+	mod.app.PublishEvent(ctx, orgs.EventMemberAdded, &orgs.MemberEvent{OrgID: "org-1", UserID: "user-1"})
+	recv.wait(t, 1)
+	original := waitForStatus(t, mod, onlyDelivery(t, mod, endpoint.ID).ID, StatusSucceeded)
+
+	replayed, err := mod.Replay(ctx, original.ID)
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if replayed.ID == original.ID || string(replayed.Payload) != string(original.Payload) {
+		t.Errorf("replay should be a new delivery with the same payload, got %+v", replayed)
+	}
+	recv.wait(t, 1)
+	waitForStatus(t, mod, replayed.ID, StatusSucceeded)
+
+	if _, err := mod.Replay(ctx, "missing"); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("expected ErrDeliveryNotFound, got %v", err)
+	}
+}
+
+func TestDispatch_SkipsInactiveAndUnsubscribed(t *testing.T) {
+	mod := setupWebhooks(t, false)
+	ctx := context.Background()
+	_, server := newReceiver(t, 0)
+
+	active, _ := mod.CreateEndpoint(ctx, "", server.URL+"/a", "custom.event")
+	inactive, _ := mod.CreateEndpoint(ctx, "", server.URL+"/b", "custom.event")
+	_, _ = mod.CreateEndpoint(ctx, "", server.URL+"/c", "other.event")
+
+	inactive.Active = false
+	if err := mod.UpdateEndpoint(ctx, inactive); err != nil {
+		t.Fatalf("failed to update endpoint: %v", err)
+	}
+
+	deliveries, err := mod.Dispatch(ctx, "custom.event", map[string]string{"hello": "world"})
+	if err != nil {
+		t.Fatalf("failed to dispatch: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].EndpointID != active.ID {
+		t.Errorf("expected one delivery to the active endpoint, got %v", deliveries)
+	}
+}
+
+func TestOrgIDOf(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"OrgID":"a"}`, "a"},
+		{`{"org_id":"b"}`, "b"},
+		{`{"orgId":"c"}`, "c"},
+		{`{"UserID":"d"}`, ""},
+		{`"text"`, ""},
+	}
+	for _, tt := range tests {
+		if got := orgIDOf([]byte(tt.data)); got != tt.want {
+			t.Errorf("orgIDOf(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}